@@ -0,0 +1,29 @@
+package main
+
+import "github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+
+// AddressInfo is a billing or shipping address
+type AddressInfo struct {
+	Line1      string  `json:"line1,omitempty"`
+	Line2      string  `json:"line2,omitempty"`
+	City       string  `json:"city,omitempty"`
+	PostalCode string  `json:"postal_code,omitempty"`
+	Country    string  `json:"country,omitempty" doc:"ISO 3166-1 alpha-2 country code"`
+	Latitude   float64 `json:"latitude,omitempty" doc:"Set with longitude when the address is geocoded"`
+	Longitude  float64 `json:"longitude,omitempty"`
+}
+
+func convertAddress(address *AddressInfo) *detector.Address {
+	if address == nil {
+		return nil
+	}
+	return &detector.Address{
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+		Latitude:   address.Latitude,
+		Longitude:  address.Longitude,
+	}
+}
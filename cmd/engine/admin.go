@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+)
+
+type DecisionDiffRequest struct {
+	Baseline  string  `json:"baseline"`
+	Candidate string  `json:"candidate" openapi:"required,minLength=1"`
+	Hours     float64 `json:"hours" openapi:"exclusiveMinimum=0"`
+	Samples   int     `json:"samples"`
+}
+
+type DecisionDiffResponse struct {
+	Since  time.Time           `json:"since"`
+	Report decision.DiffReport `json:"report"`
+}
+
+func (s *Server) configsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"configurations": s.configs.List(),
+		}); err != nil {
+			log.Printf("Error encoding configurations: %v", err)
+		}
+	case http.MethodPost:
+		var config decision.Configuration
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := s.configs.Put(config); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(config); err != nil {
+			log.Printf("Error encoding configuration: %v", err)
+		}
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// decisionDiffHandler replays recent audited traffic under two named
+// configurations and reports the decisions that would change. With
+// ?async=true the replay runs as a background job instead.
+func (s *Server) decisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	req := DecisionDiffRequest{
+		Baseline: decision.CurrentConfiguration,
+		Hours:    24,
+		Samples:  5,
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Candidate == "" {
+		apierror.Write(w, "candidate configuration is required", http.StatusBadRequest)
+		return
+	}
+	if req.Hours <= 0 {
+		apierror.Write(w, "hours must be positive", http.StatusBadRequest)
+		return
+	}
+
+	baseline, candidate, err := s.diffScorers(req)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("async") == "true" {
+		s.enqueueJob(w, jobDecisionDiff, req)
+		return
+	}
+
+	response, err := s.decisionDiff(req, baseline, candidate)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding decision diff: %v", err)
+	}
+}
+
+// diffScorers builds the replay scorers of a decision diff's baseline and
+// candidate configurations
+func (s *Server) diffScorers(req DecisionDiffRequest) (baseline, candidate *decision.Scorer, err error) {
+	baseline, err = s.replayScorer(req.Baseline)
+	if err != nil {
+		return nil, nil, err
+	}
+	candidate, err = s.replayScorer(req.Candidate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return baseline, candidate, nil
+}
+
+// decisionDiff replays the traffic audited within the request's hours
+func (s *Server) decisionDiff(req DecisionDiffRequest, baseline, candidate *decision.Scorer) (DecisionDiffResponse, error) {
+	since := time.Now().Add(-time.Duration(req.Hours * float64(time.Hour)))
+	records, err := s.auditStore.Since(since)
+	if err != nil {
+		return DecisionDiffResponse{}, err
+	}
+	return DecisionDiffResponse{
+		Since:  since,
+		Report: decision.Diff(records, req.Baseline, baseline, req.Candidate, candidate, req.Samples),
+	}, nil
+}
+
+// replayScorer builds a scorer with empty state for a named configuration,
+// running on the time of the replayed transactions
+func (s *Server) replayScorer(name string) (*decision.Scorer, error) {
+	configuration, err := s.configs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.emptyScorer(configuration, s.lists, s.fraudDetector.GetActiveRules(), s.overrides, detector.NewReplayClock(time.Time{}))
+}
+
+// emptyScorer builds a scorer with empty state for a configuration, the
+// lists, expression rules and configuration layers, running on a clock
+func (s *Server) emptyScorer(configuration decision.Configuration, lists *detector.Lists, rules []detector.Rule, layers *config.Store, clock detector.Clock) (*decision.Scorer, error) {
+	detectorConfig, err := configuration.DetectorConfig()
+	if err != nil {
+		return nil, err
+	}
+	detectorConfig.Amounts = s.amounts
+
+	fraudDetector := detector.NewFraudDetectorWithComponents(detectorConfig, detector.Components{Clock: clock})
+	if s.addressRisk != nil {
+		fraudDetector.SetAddressRiskList(s.addressRisk)
+	}
+	if s.asns != nil {
+		fraudDetector.SetASNTable(s.asns)
+	}
+	if s.merchants != nil {
+		fraudDetector.SetMerchantRegistry(s.merchants)
+	}
+	if s.calendar != nil {
+		fraudDetector.SetCalendar(s.calendar)
+	}
+	if s.amountLimits != nil {
+		fraudDetector.SetAmountLimits(s.amountLimits)
+	}
+	if lists != nil {
+		fraudDetector.SetLists(lists)
+	}
+	fraudDetector.SetOverrideResolver(layers)
+	for _, rule := range rules {
+		if rule.Expression == "" {
+			continue
+		}
+		if err := fraudDetector.AddExpressionRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	scorer := decision.NewScorer(fraudDetector, ml.NewMLEngine(), configuration.Policy())
+	scorer.SetPolicyResolver(layers)
+	return scorer, nil
+}
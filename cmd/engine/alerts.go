@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// alertSender posts alert events, such as network and scenario alerts, to a
+// webhook, signed like decision events. Failed deliveries are retried with
+// backoff; alerts are dropped while the queue is full.
+type alertSender struct {
+	url    string
+	secret string
+	client *http.Client
+	queue  chan alertDelivery
+	done   chan struct{}
+	closed bool
+	mu     sync.Mutex
+}
+
+// alertDelivery is a queued event and the subject of its alert, such as the
+// entity of a network alert, for the log
+type alertDelivery struct {
+	subject string
+	event   interface{}
+}
+
+func newAlertSender(url, secret string) *alertSender {
+	sender := &alertSender{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan alertDelivery, 100),
+		done:   make(chan struct{}),
+	}
+	go sender.run()
+	return sender
+}
+
+// Send queues the event of an alert on a subject without waiting for its
+// delivery
+func (a *alertSender) Send(subject string, event interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.queue <- alertDelivery{subject: subject, event: event}:
+	default:
+		log.Printf("Alert queue is full, dropped the alert on %s", subject)
+	}
+}
+
+// Close delivers the queued alerts and stops
+func (a *alertSender) Close() {
+	a.mu.Lock()
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+	<-a.done
+}
+
+func (a *alertSender) run() {
+	defer close(a.done)
+	for delivery := range a.queue {
+		backoff := time.Second
+		var err error
+		for attempt := 1; attempt <= 3; attempt++ {
+			if err = a.post(delivery.event); err == nil {
+				break
+			}
+			if attempt < 3 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}
+		if err != nil {
+			log.Printf("Delivery of the alert on %s failed: %v", delivery.subject, err)
+		}
+	}
+}
+
+func (a *alertSender) post(event interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.SignatureHeader, events.Sign(a.secret, time.Now(), body))
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/annotation"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+)
+
+type AnnotationsResponse struct {
+	Count       int                     `json:"count"`
+	Annotations []annotation.Annotation `json:"annotations" doc:"Newest first, without attachment content"`
+}
+
+type AnnotationTagsResponse struct {
+	Tags []annotation.TagCount `json:"tags" doc:"Most used first"`
+}
+
+// annotationQueryParams are the query parameters of GET /fraud/annotations
+var annotationQueryParams = []string{"tx", "tag", "author", "q", "since", "until", "limit"}
+
+// annotationStore returns the store of analyst annotations, appended to
+// ANNOTATIONS_FILE when set
+func annotationStore() *annotation.Store {
+	config := annotation.DefaultConfig()
+	config.Path = os.Getenv("ANNOTATIONS_FILE")
+	config.MaxAttachmentBytes = getEnvInt("ANNOTATION_MAX_ATTACHMENT_BYTES", config.MaxAttachmentBytes)
+
+	store, err := annotation.Open(config)
+	if err != nil {
+		log.Fatalf("Failed to load annotations: %v", err)
+	}
+	if config.Path != "" {
+		log.Printf("Loaded %d annotations from %s", store.Len(), config.Path)
+	}
+	return store
+}
+
+// annotateHandler attaches a note, tags and attachments to an audited
+// decision, authored by the caller
+func (s *Server) annotateHandler(w http.ResponseWriter, r *http.Request) {
+	var req annotation.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.annotations.Validate(&req); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.auditStore.Search(audit.Query{TransactionID: req.TransactionID, Limit: 1})
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		apierror.Write(w, "no decision found for transaction: "+req.TransactionID, http.StatusNotFound)
+		return
+	}
+
+	req.Author, _ = caller(r)
+	added, err := s.annotations.Add(req)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Transaction %s annotated by %s", added.TransactionID, added.Author)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(added); err != nil {
+		log.Printf("Error encoding annotation: %v", err)
+	}
+}
+
+// annotationsHandler searches the annotations by transaction, tag, author,
+// text and time
+func (s *Server) annotationsHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseAnnotationQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	annotations := s.annotations.Search(query)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(AnnotationsResponse{Count: len(annotations), Annotations: annotations}); err != nil {
+		log.Printf("Error encoding annotations: %v", err)
+	}
+}
+
+func parseAnnotationQuery(params url.Values) (annotation.Query, error) {
+	query := annotation.Query{
+		TransactionID: params.Get("tx"),
+		Tag:           params.Get("tag"),
+		Author:        params.Get("author"),
+		Text:          params.Get("q"),
+	}
+	for param, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := params.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, errors.New("invalid " + param + ": must be RFC 3339")
+			}
+			*t = parsed
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, errors.New("invalid limit " + strconv.Quote(value))
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// annotationTagsHandler counts the annotations of each tag
+func (s *Server) annotationTagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(AnnotationTagsResponse{Tags: s.annotations.Tags()}); err != nil {
+		log.Printf("Error encoding annotation tags: %v", err)
+	}
+}
+
+// annotationAttachmentHandler serves the content of an uploaded attachment
+func (s *Server) annotationAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, err := s.annotations.Attachment(r.PathValue("id"), r.PathValue("name"))
+	if err != nil {
+		apierror.Write(w, "unknown attachment", http.StatusNotFound)
+		return
+	}
+	if len(attachment.Content) == 0 {
+		apierror.Write(w, "attachment was not uploaded; it is kept at "+attachment.URL, http.StatusNotFound)
+		return
+	}
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(attachment.Content)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(attachment.Name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := w.Write(attachment.Content); err != nil {
+		log.Printf("Error writing attachment: %v", err)
+	}
+}
+
+// annotatedRecords returns the audited decisions matching a query among the
+// transactions annotated with a tag, most recently annotated first
+func (s *Server) annotatedRecords(tag string, query audit.Query) ([]audit.Record, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = audit.DefaultSearchLimit
+	}
+	records := []audit.Record{}
+	seen := make(map[string]bool)
+	for _, annotated := range s.annotations.Search(annotation.Query{Tag: tag, Limit: annotation.MaxLimit}) {
+		id := annotated.TransactionID
+		if seen[id] || query.TransactionID != "" && query.TransactionID != id {
+			continue
+		}
+		seen[id] = true
+		q := query
+		q.TransactionID, q.Limit = id, 1
+		found, err := s.auditStore.Search(q)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+		if len(records) == limit {
+			break
+		}
+	}
+	return records, nil
+}
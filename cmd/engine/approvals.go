@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+)
+
+type RuleChangesResponse struct {
+	Changes []ruleset.Proposal `json:"changes"`
+}
+
+type RuleReviewRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// approvalNotifier posts rule changes waiting for sign-off to the approvers'
+// webhook, signed like decision event deliveries
+type approvalNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// ruleApprovalNotifier reads RULE_APPROVAL_WEBHOOK_URL and
+// RULE_APPROVAL_WEBHOOK_SECRET, returning nil when no webhook is set
+func ruleApprovalNotifier() *approvalNotifier {
+	url := os.Getenv("RULE_APPROVAL_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	log.Printf("Notifying rule approvers at %s", url)
+	return &approvalNotifier{
+		url:    url,
+		secret: os.Getenv("RULE_APPROVAL_WEBHOOK_SECRET"),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// notify posts a pending change in the background. It is a no-op on a nil
+// notifier.
+func (n *approvalNotifier) notify(proposal ruleset.Proposal) {
+	if n == nil {
+		return
+	}
+	go func() {
+		if err := n.post(proposal); err != nil {
+			log.Printf("Failed to notify the approvers of rule change %s: %v", proposal.ID, err)
+		}
+	}()
+}
+
+func (n *approvalNotifier) post(proposal ruleset.Proposal) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":  "rule_change.pending",
+		"change": proposal,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(n.secret, time.Now(), body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("approval webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// caller returns the subject and tenant of the caller, "anonymous" when the
+// request was not authenticated
+func caller(r *http.Request) (string, string) {
+	if principal, authenticated := auth.FromContext(r.Context()); authenticated {
+		return principal.Subject, principal.Tenant
+	}
+	return "anonymous", ""
+}
+
+// submitRuleChange holds a rule change for sign-off when the caller's tenant
+// requires it, responding with the pending change. It reports whether the
+// change was held; otherwise the caller applies it. Callers must hold
+// rulesMu.
+func (s *Server) submitRuleChange(w http.ResponseWriter, r *http.Request, proposal ruleset.Proposal) bool {
+	author, tenant := caller(r)
+	approver := s.overrides.RuleApprover(tenant)
+	if approver == "" {
+		return false
+	}
+
+	current := ruleset.FromRules(s.fraudDetector.GetActiveRules())
+	proposed := proposal.Apply(current)
+	if err := s.fraudDetector.CheckExpressionRules(proposed.ExpressionRules()); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	proposal.Author = author
+	proposal.Tenant = tenant
+	proposal.Approver = approver
+	proposal.Diff = ruleset.Compare(current, proposed)
+	proposal.SubmittedAt = time.Now()
+	proposal = s.ruleApprovals.Submit(proposal)
+
+	log.Printf("Rule change %s by %s through %s awaits sign-off by the %s role", proposal.ID, author, proposal.Source, approver)
+	s.approvalNotifier.notify(proposal)
+	writeRuleChange(w, http.StatusAccepted, proposal)
+	return true
+}
+
+// ruleChangesHandler lists the rule changes submitted for sign-off, newest
+// first, optionally by status
+func (s *Server) ruleChangesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(RuleChangesResponse{
+		Changes: s.ruleApprovals.List(r.URL.Query().Get("status")),
+	}); err != nil {
+		log.Printf("Error encoding rule changes: %v", err)
+	}
+}
+
+// ruleChangeHandler returns a rule change submitted for sign-off
+func (s *Server) ruleChangeHandler(w http.ResponseWriter, r *http.Request) {
+	proposal, exists := s.ruleApprovals.Get(r.PathValue("id"))
+	if !exists {
+		apierror.Write(w, ruleset.ErrProposalNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeRuleChange(w, http.StatusOK, proposal)
+}
+
+// approveRuleChangeHandler signs off a pending rule change and applies it
+func (s *Server) approveRuleChangeHandler(w http.ResponseWriter, r *http.Request) {
+	s.reviewRuleChange(w, r, true)
+}
+
+// rejectRuleChangeHandler turns down a pending rule change
+func (s *Server) rejectRuleChangeHandler(w http.ResponseWriter, r *http.Request) {
+	s.reviewRuleChange(w, r, false)
+}
+
+// reviewRuleChange approves or rejects a rule change. The reviewer must hold
+// the approver role the change was submitted with and must not be its
+// author.
+func (s *Server) reviewRuleChange(w http.ResponseWriter, r *http.Request, approve bool) {
+	var req RuleReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	reviewer, _ := caller(r)
+	id := r.PathValue("id")
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	proposal, err := s.ruleApprovals.Check(id, reviewer)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	if principal, authenticated := auth.FromContext(r.Context()); authenticated && !principal.Role.Allows(auth.Role(proposal.Approver)) {
+		apierror.Write(w, "reviewing this rule change requires the "+proposal.Approver+" role", http.StatusForbidden)
+		return
+	}
+
+	if approve {
+		rules := proposal.Apply(ruleset.FromRules(s.fraudDetector.GetActiveRules())).ExpressionRules()
+		if err := s.fraudDetector.ReplaceExpressionRules(rules); err != nil {
+			apierror.Write(w, "the rule change no longer applies: "+err.Error(), http.StatusConflict)
+			return
+		}
+		s.recordVersion()
+		s.recordRuleChangesBy(proposal.Author, proposal.Source)
+	}
+	proposal, err = s.ruleApprovals.Review(id, reviewer, approve, req.Comment, time.Now())
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	log.Printf("Rule change %s %s by %s", proposal.ID, proposal.Status, reviewer)
+	writeRuleChange(w, http.StatusOK, proposal)
+}
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ruleset.ErrProposalNotFound):
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ruleset.ErrSelfReview):
+		apierror.Write(w, err.Error(), http.StatusForbidden)
+	default:
+		apierror.Write(w, err.Error(), http.StatusConflict)
+	}
+}
+
+func writeRuleChange(w http.ResponseWriter, status int, proposal ruleset.Proposal) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(proposal); err != nil {
+		log.Printf("Error encoding rule change: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"os"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/objectstore"
+)
+
+// modelArtifacts reads model artifacts from disk or object storage,
+// verifying and decrypting them with the MODEL_* keys
+type modelArtifacts struct {
+	store *objectstore.Client
+	keys  ml.ArtifactKeys
+}
+
+// newModelArtifacts configures object storage from the AWS_* and
+// GCS_ACCESS_TOKEN environment variables
+func newModelArtifacts() *modelArtifacts {
+	artifacts := &modelArtifacts{
+		store: objectstore.NewClient(objectstore.Config{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Region:          os.Getenv("AWS_REGION"),
+			S3Endpoint:      os.Getenv("AWS_ENDPOINT_URL_S3"),
+			GCSToken:        os.Getenv("GCS_ACCESS_TOKEN"),
+		}),
+	}
+	if key := os.Getenv("MODEL_SIGNING_KEY"); key != "" {
+		artifacts.keys.SigningKey = []byte(key)
+	}
+	if key := os.Getenv("MODEL_ENCRYPTION_KEY"); key != "" {
+		decoded, err := hex.DecodeString(key)
+		if err != nil || len(decoded) != 32 {
+			log.Fatalf("MODEL_ENCRYPTION_KEY must be 32 bytes in hex")
+		}
+		artifacts.keys.EncryptionKey = decoded
+	}
+	return artifacts
+}
+
+// load reads the model artifact at a path or s3:// or gs:// URL. With a
+// signing key, the signature is read from the location followed by .sig.
+func (a *modelArtifacts) load(ctx context.Context, engine *ml.MLEngine, location, checksum string) (*ml.LinearModel, error) {
+	data, err := a.read(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	var signature []byte
+	if len(a.keys.SigningKey) > 0 {
+		if signature, err = a.read(ctx, location+".sig"); err != nil {
+			return nil, err
+		}
+	}
+	return engine.OpenArtifact(data, checksum, string(signature), a.keys)
+}
+
+func (a *modelArtifacts) read(ctx context.Context, location string) ([]byte, error) {
+	if objectstore.IsObject(location) {
+		return a.store.Get(ctx, location)
+	}
+	return os.ReadFile(location)
+}
+
+// loadActiveModel makes the ML_MODEL_ARTIFACT model, checked against
+// ML_MODEL_SHA256 when set, the active one
+func loadActiveModel(artifacts *modelArtifacts, engine *ml.MLEngine) {
+	location := os.Getenv("ML_MODEL_ARTIFACT")
+	if location == "" {
+		return
+	}
+	model, err := artifacts.load(context.Background(), engine, location, os.Getenv("ML_MODEL_SHA256"))
+	if err != nil {
+		log.Fatalf("Failed to load model artifact %s: %v", location, err)
+	}
+	engine.UseModel(model)
+	log.Printf("Loaded model %s from %s", model.Version(), location)
+}
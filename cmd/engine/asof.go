@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/bundle"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// recordVersion adds the live configuration to the timeline used for as-of
+// scoring
+func (s *Server) recordVersion() {
+	b, err := s.currentBundle()
+	if err != nil {
+		log.Printf("Failed to record the configuration version: %v", err)
+		return
+	}
+	s.timeline.Record(b, s.overrides.Hierarchy(), time.Now())
+}
+
+// asOfScorer builds a scorer with the rules, lists, thresholds and layers in
+// effect at a time, and the state rebuilt by replaying the decisions audited
+// within the state window before it. The transaction being re-scored is not
+// replayed. It returns the configuration version and the number of
+// decisions replayed.
+func (s *Server) asOfScorer(at time.Time, transactionID string) (*decision.Scorer, bundle.Version, int, error) {
+	version, exists := s.timeline.At(at)
+	if !exists {
+		return nil, bundle.Version{}, 0, fmt.Errorf("no configuration recorded at %s", at.Format(time.RFC3339))
+	}
+
+	configuration, err := s.configs.Get(decision.CurrentConfiguration)
+	if err != nil {
+		return nil, version, 0, err
+	}
+	configuration.ReviewThreshold = version.Bundle.Thresholds.Review
+	configuration.DeclineThreshold = version.Bundle.Thresholds.Decline
+	lists := detector.NewLists()
+	for name, values := range version.Bundle.Lists {
+		lists.Set(name, values)
+	}
+	clock := detector.NewReplayClock(at.Add(-s.asOfWindow))
+	scorer, err := s.emptyScorer(configuration, lists, version.Bundle.Rules.ExpressionRules(), config.NewStore(version.Layers), clock)
+	if err != nil {
+		return nil, version, 0, err
+	}
+
+	records, err := s.auditStore.Since(at.Add(-s.asOfWindow))
+	if err != nil {
+		return nil, version, 0, err
+	}
+	replayed := 0
+	for _, record := range records {
+		if !record.DecidedAt.Before(at) {
+			break
+		}
+		if record.Transaction.ID == transactionID {
+			continue
+		}
+		tx := record.Transaction
+		if _, err := scorer.Detector().AnalyzeTransaction(&tx); err != nil {
+			continue
+		}
+		replayed++
+	}
+	clock.Observe(at)
+	return scorer, version, replayed, nil
+}
+
+// analyzeAsOf scores a transaction as the engine would have at a past time.
+// Nothing is audited or published, and the live state is left untouched.
+func (s *Server) analyzeAsOf(w http.ResponseWriter, req TransactionRequest, asOf string, v verbosity, b Branding, start time.Time) {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		apierror.Write(w, "as_of must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if at.After(start) {
+		apierror.Write(w, "as_of must not be in the future", http.StatusBadRequest)
+		return
+	}
+
+	transaction := convertToInternalTransaction(req)
+	if req.Timestamp.IsZero() {
+		transaction.Timestamp = at
+	}
+
+	scorer, version, replayed, err := s.asOfScorer(at, transaction.ID)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	outcome, err := scorer.Score(transaction)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	outcome.DecidedAt = at
+	result := outcome.Detection
+
+	response := FraudResponse{
+		TransactionID:  req.ID,
+		RiskScore:      outcome.FinalScore,
+		Decision:       outcome.Decision,
+		Retry:          outcome.Retry,
+		Reasons:        result.Reasons,
+		ReasonCodes:    result.ReasonCodes,
+		Confidence:     outcome.Confidence,
+		ExpiresAt:      s.expiresAt(outcome),
+		ProcessingTime: time.Since(start).String(),
+		Splits:         splitResults(outcome),
+		Explanation:    outcome.Explanation,
+		Metadata: map[string]interface{}{
+			"rule_score":     result.Score,
+			"ml_score":       outcome.MLScore,
+			"version":        engineVersion,
+			"as_of":          at,
+			"bundle_id":      version.Bundle.ID,
+			"effective_from": version.From,
+			"model_version":  version.Bundle.ModelVersion,
+			"replayed":       replayed,
+		},
+	}
+	if config.NewStore(version.Layers).ObserveOnly(transaction.MerchantID) {
+		response.Metadata["observe_only"] = true
+	}
+	v.apply(&response, transaction)
+	b.apply(&response)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v.body(response)); err != nil {
+		log.Printf("Error encoding as-of response: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/metrics"
+)
+
+// Audit write modes
+const (
+	auditWriteSync  = "sync"
+	auditWriteAsync = "async"
+)
+
+// auditWriter returns the audit store written in batches in the background
+// with the AUDIT_WRITE_* settings, nil unless AUDIT_WRITE_MODE is async
+func auditWriter(store audit.Store, engineMetrics *metrics.Engine) *audit.BufferedStore {
+	switch mode := getEnv("AUDIT_WRITE_MODE", auditWriteSync); mode {
+	case auditWriteSync:
+		return nil
+	case auditWriteAsync:
+	default:
+		log.Fatalf("Unknown AUDIT_WRITE_MODE %q, use %s or %s", mode, auditWriteSync, auditWriteAsync)
+	}
+
+	config := audit.DefaultWriterConfig()
+	config.QueueSize = getEnvInt("AUDIT_WRITE_QUEUE_SIZE", config.QueueSize)
+	config.BatchSize = getEnvInt("AUDIT_WRITE_BATCH_SIZE", config.BatchSize)
+	config.FlushInterval = getEnvDuration("AUDIT_WRITE_FLUSH_INTERVAL", config.FlushInterval)
+	config.MaxAttempts = getEnvInt("AUDIT_WRITE_MAX_ATTEMPTS", config.MaxAttempts)
+	config.RetryBackoff = getEnvDuration("AUDIT_WRITE_RETRY_BACKOFF", config.RetryBackoff)
+	config.Overflow = getEnv("AUDIT_WRITE_OVERFLOW", config.Overflow)
+
+	buffered, err := audit.NewBufferedStore(store, config)
+	if err != nil {
+		log.Fatalf("Invalid audit write settings: %v", err)
+	}
+	buffered.Writer().SetObserver(auditWrites{engineMetrics})
+	log.Printf("Writing audit records in batches of up to %d every %s, %s when %d are queued",
+		config.BatchSize, config.FlushInterval, config.Overflow, config.QueueSize)
+	return buffered
+}
+
+// auditWrites counts batched audit writes and logs the records lost when the
+// audit store fails. Records dropped from a full queue are only counted, as
+// logging each would flood the log while the store is slow.
+type auditWrites struct {
+	*metrics.Engine
+}
+
+func (a auditWrites) ObserveAuditDropped(reason string, records int) {
+	if reason == audit.DropSinkError {
+		log.Printf("Audit store failed, dropped %d audit records", records)
+	}
+	a.Engine.ObserveAuditDropped(reason, records)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/replication"
+)
+
+// accessPolicy sets the role each endpoint requires. Reading and scoring is
+// open to every role; changing how decisions are made is not. Merchant
+// credentials only reach the merchant self-service API, and sandbox
+// credentials only score.
+func accessPolicy() *auth.Policy {
+	return auth.NewPolicy(auth.Viewer).
+		Public("/health").
+		Public("/openapi.json").
+		Public("/metrics").
+		// Peers sign their deltas with the replication secret instead
+		Public(replication.Path).
+		Merchant(merchantPath).
+		Sandbox("/fraud/analyze").
+		Sandbox("/fraud/batch").
+		Require(http.MethodPut, merchantPath+"trusted-customers", auth.Analyst).
+		Require(http.MethodPut, merchantPath+"webhook", auth.Analyst).
+		Require(http.MethodDelete, merchantPath+"webhook", auth.Analyst).
+		Require(http.MethodPost, merchantPath+"webhook/replay", auth.Analyst).
+		Require(http.MethodGet, "/fraud/webhooks/", auth.Analyst).
+		Require(http.MethodPost, "/fraud/webhooks/", auth.Analyst).
+		Require(http.MethodPost, "/fraud/admin/decision-diff", auth.Analyst).
+		Require(http.MethodPost, "/fraud/beneficiaries/", auth.Analyst).
+		Require(http.MethodPut, "/fraud/reputation/", auth.Analyst).
+		Require(http.MethodPost, "/fraud/feedback", auth.Analyst).
+		Require(http.MethodPost, "/fraud/feedback/batch", auth.Analyst).
+		Require(http.MethodPost, "/fraud/annotations", auth.Analyst).
+		Require(http.MethodGet, "/fraud/annotations", auth.Analyst).
+		Require(http.MethodGet, "/fraud/annotations/", auth.Analyst).
+		Require(http.MethodGet, "/fraud/throttled-merchants", auth.Analyst).
+		Require(http.MethodDelete, "/fraud/throttled-merchants/", auth.Analyst).
+		Require(http.MethodGet, "/fraud/network-alerts", auth.Analyst).
+		Require(http.MethodDelete, "/fraud/network-alerts/", auth.Analyst).
+		Require(http.MethodGet, "/fraud/scenarios", auth.Analyst).
+		Require(http.MethodPut, "/fraud/scenarios", auth.Admin).
+		Require(http.MethodGet, "/fraud/usage", auth.Admin).
+		Require(http.MethodGet, "/fraud/quotas", auth.Admin).
+		Require(http.MethodGet, "/fraud/reviews", auth.Analyst).
+		Require(http.MethodGet, "/fraud/reviews/", auth.Analyst).
+		Require(http.MethodPost, "/fraud/reviews/", auth.Analyst).
+		Require(http.MethodGet, "/fraud/fairness", auth.Analyst).
+		Require(http.MethodPut, "/fraud/merchants/", auth.Admin).
+		Require(http.MethodDelete, "/fraud/merchants/", auth.Admin).
+		Require(http.MethodPut, "/fraud/calendar", auth.Admin).
+		Require(http.MethodPut, "/fraud/amount-limits", auth.Admin).
+		Require(http.MethodPut, "/fraud/feature-flags", auth.Admin).
+		Require(http.MethodGet, "/fraud/reports", auth.Analyst).
+		Require(http.MethodGet, "/fraud/reports/", auth.Analyst).
+		Require(http.MethodPost, "/fraud/reports", auth.Analyst).
+		Require(http.MethodGet, "/fraud/admin/tenant-isolation", auth.Admin).
+		Require(http.MethodGet, "/fraud/admin/chaos", auth.Admin).
+		Require(http.MethodPost, "/fraud/admin/chaos", auth.Admin).
+		Require(http.MethodDelete, "/fraud/admin/chaos", auth.Admin).
+		Require(http.MethodGet, "/fraud/admin/recordings", auth.Analyst).
+		Require(http.MethodPost, "/fraud/admin/recordings", auth.Admin).
+		Require(http.MethodDelete, "/fraud/admin/recordings", auth.Admin).
+		Require(http.MethodGet, "/fraud/bundles/export", auth.RuleAuthor).
+		Require(http.MethodPost, "/fraud/bundles/import", auth.Admin).
+		Require(http.MethodPost, "/fraud/bundles/rollback", auth.Admin).
+		Require(http.MethodPost, "/fraud/configs", auth.RuleAuthor).
+		Require(http.MethodPut, "/fraud/overrides", auth.Admin).
+		Require(http.MethodPut, "/fraud/orgs/", auth.Admin).
+		Require(http.MethodPost, "/fraud/rules", auth.RuleAuthor).
+		Require(http.MethodPost, "/fraud/rules/import", auth.RuleAuthor).
+		Require(http.MethodDelete, "/fraud/rules/", auth.RuleAuthor).
+		Require(http.MethodPost, "/fraud/rules/", auth.RuleAuthor).
+		Require(http.MethodGet, "/fraud/rule-changes", auth.Analyst).
+		Require(http.MethodGet, "/fraud/rule-changes/", auth.Analyst).
+		Require(http.MethodPost, "/fraud/rule-changes/", auth.RuleAuthor).
+		Require(http.MethodPost, "/fraud/train", auth.Admin).
+		Require(http.MethodGet, replication.Path+"/status", auth.Analyst).
+		Require(http.MethodGet, "/fraud/near-misses", auth.Analyst).
+		Require(http.MethodPost, "/fraud/near-misses/mine", auth.Analyst).
+		Require(http.MethodGet, "/fraud/jobs", auth.Analyst).
+		Require(http.MethodGet, "/fraud/jobs/", auth.Analyst).
+		Require(http.MethodDelete, "/fraud/jobs/", auth.Admin).
+		Require(http.MethodPost, "/fraud/models/canary", auth.Admin).
+		Require(http.MethodDelete, "/fraud/models/canary", auth.Admin)
+}
+
+// authenticators returns the configured ways callers can authenticate.
+// Authentication is disabled when none are configured.
+func authenticators() []auth.Authenticator {
+	var authenticators []auth.Authenticator
+
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		keys, err := auth.LoadAPIKeysFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		authenticators = append(authenticators, keys)
+		log.Printf("Loaded %d API keys", keys.Size())
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		jwt, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			Issuer:        issuer,
+			Audience:      os.Getenv("OIDC_AUDIENCE"),
+			JWKSURL:       os.Getenv("OIDC_JWKS_URL"),
+			RoleClaim:     os.Getenv("OIDC_ROLE_CLAIM"),
+			TenantClaim:   os.Getenv("OIDC_TENANT_CLAIM"),
+			MerchantClaim: os.Getenv("OIDC_MERCHANT_CLAIM"),
+		})
+		if err != nil {
+			log.Fatalf("Failed to configure OIDC authentication: %v", err)
+		}
+		authenticators = append(authenticators, jwt)
+		log.Printf("Accepting bearer tokens from %s", issuer)
+	}
+
+	return authenticators
+}
+
+// withAuth enforces the access policy when authentication is configured
+func withAuth(next http.Handler) http.Handler {
+	authenticators := authenticators()
+	if len(authenticators) == 0 {
+		log.Println("Authentication disabled: no API keys or OIDC issuer configured")
+		return next
+	}
+	return auth.Middleware(accessPolicy(), authenticators, next)
+}
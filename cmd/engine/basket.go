@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// LineItemInfo is an item of the basket a transaction pays for
+type LineItemInfo struct {
+	SKU      string  `json:"sku,omitempty"`
+	Quantity int     `json:"quantity" openapi:"required,minimum=1"`
+	Price    float64 `json:"price" openapi:"required,minimum=0" doc:"Unit price, in the currency of the transaction"`
+	Category string  `json:"category,omitempty" doc:"Item category, e.g. gift_card or electronics"`
+}
+
+// validateBasket checks the line items and that the fee, tax and shipping
+// fit within the amount
+func validateBasket(req TransactionRequest) error {
+	for i, item := range req.Items {
+		if item.Quantity <= 0 {
+			return fmt.Errorf("items[%d]: quantity must be positive", i)
+		}
+		if item.Price < 0 {
+			return fmt.Errorf("items[%d]: price must not be negative", i)
+		}
+	}
+	if req.Fee < 0 || req.Tax < 0 || req.Shipping < 0 {
+		return fmt.Errorf("fee, tax and shipping must not be negative")
+	}
+	if extras := req.Fee + req.Tax + req.Shipping; extras > req.Amount+splitTolerance {
+		return fmt.Errorf("fee, tax and shipping add up to %.2f, more than the amount of %.2f", extras, req.Amount)
+	}
+	return nil
+}
+
+func convertItems(items []LineItemInfo) []detector.LineItem {
+	if len(items) == 0 {
+		return nil
+	}
+	converted := make([]detector.LineItem, len(items))
+	for i, item := range items {
+		converted[i] = detector.LineItem{
+			SKU:      item.SKU,
+			Quantity: item.Quantity,
+			Price:    item.Price,
+			Category: item.Category,
+		}
+	}
+	return converted
+}
+
+// basketConfig returns the basket item settings. BASKET_HIGH_RISK_CATEGORIES
+// replaces the scored categories with a list such as
+// "gift_card=0.25,electronics=0.1".
+func basketConfig() detector.BasketConfig {
+	config := detector.DefaultBasketConfig()
+	if value := os.Getenv("BASKET_HIGH_RISK_CATEGORIES"); value != "" {
+		config.Categories = make(map[string]float64)
+		for _, entry := range strings.Split(value, ",") {
+			category, raw, found := strings.Cut(strings.TrimSpace(entry), "=")
+			score, err := strconv.ParseFloat(raw, 64)
+			if !found || err != nil || score <= 0 {
+				log.Fatalf("Invalid BASKET_HIGH_RISK_CATEGORIES entry %q: want category=score", entry)
+			}
+			config.Categories[strings.ToLower(strings.TrimSpace(category))] = score
+		}
+	}
+	config.BulkQuantity = getEnvInt("BASKET_BULK_QUANTITY", config.BulkQuantity)
+	config.HighValueItem = getEnvFloat("BASKET_HIGH_VALUE_ITEM", config.HighValueItem)
+	config.NewAccountAge = getEnvDuration("BASKET_NEW_ACCOUNT_AGE", config.NewAccountAge)
+	config.MismatchTolerance = getEnvFloat("BASKET_MISMATCH_TOLERANCE", config.MismatchTolerance)
+	return config
+}
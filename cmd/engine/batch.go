@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+)
+
+// jobBatch analyzes a batch in the background
+const jobBatch = "batch"
+
+// BatchEnvelope is the schema /fraud/batch validates requests against: only
+// the envelope, so that an invalid transaction fails on its own as a
+// BatchError instead of failing the whole batch
+type BatchEnvelope struct {
+	Transactions []map[string]interface{} `json:"transactions" openapi:"required,minItems=1,maxItems=1000" doc:"TransactionRequest values, each validated on its own"`
+}
+
+// BatchError is a transaction of a batch that was not analyzed
+type BatchError struct {
+	Index         int           `json:"index" doc:"Position of the transaction in the batch"`
+	TransactionID string        `json:"transaction_id"`
+	Code          apierror.Code `json:"code"`
+	Message       string        `json:"message"`
+}
+
+// BatchJobResponse is a page of the results of an asynchronous batch
+type BatchJobResponse struct {
+	ID      string        `json:"id"`
+	Status  string        `json:"status" doc:"queued, running, succeeded, failed or canceled"`
+	Error   string        `json:"error,omitempty"`
+	Summary *BatchSummary `json:"summary,omitempty"`
+	// Results are FraudResponse values, MinimalResponse ones at minimal
+	// verbosity
+	Results    interface{}  `json:"results,omitempty"`
+	Errors     []BatchError `json:"errors,omitempty"`
+	Offset     int          `json:"offset"`
+	NextOffset int          `json:"next_offset,omitempty" doc:"Offset of the next page of results, absent on the last one"`
+}
+
+// batchJob is the payload of an asynchronous batch: the request and how its
+// caller sees the results
+type batchJob struct {
+	Request   BatchRequest `json:"request"`
+	Verbosity verbosity    `json:"verbosity"`
+	Branding  Branding     `json:"branding"`
+	Tenant    string       `json:"tenant,omitempty"`
+}
+
+// prepareBatch converts the transactions of a batch, leaving nil those that
+// fail validation and reporting them as errors
+func prepareBatch(req BatchRequest) ([]*detector.Transaction, []BatchError) {
+	transactions := make([]*detector.Transaction, len(req.Transactions))
+	var errs []BatchError
+	for i, txn := range req.Transactions {
+		err := validateBatchTransaction(txn)
+		if err == nil {
+			err = validateSplits(txn)
+		}
+		if err == nil {
+			err = validateBasket(txn)
+		}
+		if err != nil {
+			errs = append(errs, BatchError{
+				Index:         i,
+				TransactionID: txn.ID,
+				Code:          apierror.InvalidTransaction,
+				Message:       fmt.Sprintf("transactions[%d]: %v", i, err),
+			})
+			continue
+		}
+		transactions[i] = convertToInternalTransaction(txn)
+	}
+	return transactions, errs
+}
+
+// validateBatchTransaction checks what the schema checks of a lone
+// transaction, which the batch envelope leaves to each transaction
+func validateBatchTransaction(txn TransactionRequest) error {
+	if txn.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if txn.Amount <= 0 {
+		return fmt.Errorf("amount must be greater than 0")
+	}
+	return nil
+}
+
+// analyzed returns the transactions of a batch that passed validation
+func analyzed(transactions []*detector.Transaction) []*detector.Transaction {
+	valid := make([]*detector.Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx != nil {
+			valid = append(valid, tx)
+		}
+	}
+	return valid
+}
+
+// decideBatch analyzes the valid transactions of a batch and decides them,
+// with one ML model call. Sandbox callers get sandbox decisions instead.
+func (s *Server) decideBatch(req BatchRequest, transactions []*detector.Transaction, errs []BatchError, v verbosity, branding Branding, sandbox bool) (BatchResponse, error) {
+	start := time.Now()
+	valid := analyzed(transactions)
+	summary := BatchSummary{Total: len(req.Transactions), Failed: len(errs)}
+
+	var outcomes []*decision.Outcome
+	if sandbox {
+		outcomes = s.sandboxOutcomes(valid)
+	} else if len(valid) > 0 {
+		var err error
+		if outcomes, err = s.scoreBatch(valid); err != nil {
+			return BatchResponse{}, err
+		}
+	}
+
+	results := make([]FraudResponse, 0, len(valid))
+	next := 0
+	for i, tx := range transactions {
+		if tx == nil {
+			continue
+		}
+		outcome := outcomes[next]
+		next++
+		result := FraudResponse{
+			TransactionID:  req.Transactions[i].ID,
+			RiskScore:      outcome.FinalScore,
+			Decision:       outcome.Decision,
+			Retry:          outcome.Retry,
+			Reasons:        outcome.Detection.Reasons,
+			ReasonCodes:    outcome.Detection.ReasonCodes,
+			Confidence:     outcome.Confidence,
+			ExpiresAt:      s.expiresAt(outcome),
+			ProcessingTime: "batch",
+			Splits:         splitResults(outcome),
+			Explanation:    outcome.Explanation,
+		}
+		if outcome.FeatureTier != "" {
+			result.Metadata = map[string]interface{}{"feature_tier": outcome.FeatureTier}
+			if outcome.ConfidenceGated {
+				result.Metadata["confidence_gated"] = true
+			}
+		}
+		if sandbox {
+			result.Metadata = map[string]interface{}{"sandbox": true}
+		} else {
+			addLimitMetadata(&result, outcome.Detection)
+			if v.Level == verbosityFull {
+				result.Counterfactual = s.scorer.Counterfactual(tx, outcome)
+			}
+			s.applyObserveOnly(tx.MerchantID, &result)
+			v.apply(&result, tx)
+		}
+		branding.apply(&result)
+
+		switch result.Decision {
+		case decision.Decline:
+			summary.Declined++
+		case decision.SoftDecline:
+			summary.SoftDeclined++
+		case decision.Review:
+			summary.RequireReview++
+		default:
+			summary.Approved++
+		}
+		summary.AvgRiskScore += outcome.FinalScore
+		results = append(results, result)
+	}
+
+	if len(results) > 0 {
+		summary.AvgRiskScore /= float64(len(results))
+	}
+	summary.ProcessingTime = time.Since(start).String()
+	return BatchResponse{Results: results, Errors: errs, Summary: summary}, nil
+}
+
+// batchBody returns what is encoded for a batch response
+func (v verbosity) batchBody(response BatchResponse) interface{} {
+	if v.Level != verbosityMinimal {
+		return response
+	}
+	return MinimalBatchResponse{Results: minimalResults(response.Results), Errors: response.Errors, Summary: response.Summary}
+}
+
+func minimalResults(results []FraudResponse) []MinimalResponse {
+	minimalResults := make([]MinimalResponse, len(results))
+	for i := range results {
+		minimalResults[i] = minimal(results[i])
+	}
+	return minimalResults
+}
+
+// writeBatch writes a batch response: a 207 when some transactions were
+// not analyzed
+func writeBatch(w http.ResponseWriter, v verbosity, response BatchResponse) {
+	status := http.StatusOK
+	if len(response.Errors) > 0 {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v.batchBody(response)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// enqueueBatch queues a batch for analysis in the background, responding
+// with the job whose results /fraud/batch/{job_id} pages through
+func (s *Server) enqueueBatch(w http.ResponseWriter, r *http.Request, req BatchRequest, v verbosity, branding Branding) {
+	_, tenant := caller(r)
+	job, err := s.jobs.Enqueue(jobBatch, batchJob{Request: req, Verbosity: v, Branding: branding, Tenant: tenant})
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The caller has the transactions already
+	job.Payload = nil
+	w.Header().Set("Location", "/fraud/batch/"+job.ID)
+	writeJob(w, http.StatusAccepted, job)
+}
+
+// batchJobType runs asynchronous batches once: retrying a batch would
+// analyze and audit its transactions again
+func (s *Server) batchJobType() jobs.Type {
+	t := jobType(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var job batchJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		transactions, errs := prepareBatch(job.Request)
+		return s.decideBatch(job.Request, transactions, errs, job.Verbosity, job.Branding, false)
+	})
+	t.MaxAttempts = 1
+	return t
+}
+
+// batchJobHandler returns the status of an asynchronous batch and, once it
+// succeeded, a page of its results from offset, limit at a time (default
+// 100). Batches of other tenants are not found.
+func (s *Server) batchJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, exists := s.jobs.Get(r.PathValue("job_id"))
+	var payload batchJob
+	if exists && job.Type == jobBatch {
+		exists = json.Unmarshal(job.Payload, &payload) == nil
+	}
+	if _, tenant := caller(r); !exists || job.Type != jobBatch || payload.Tenant != tenant {
+		apierror.Write(w, "batch job not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	offset, limit := 0, 100
+	for name, value := range map[string]*int{"offset": &offset, "limit": &limit} {
+		if raw := query.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				apierror.Write(w, name+" must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			*value = n
+		}
+	}
+	if limit == 0 || limit > 1000 {
+		apierror.Write(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+
+	response := BatchJobResponse{ID: job.ID, Status: job.Status, Error: job.Error, Offset: offset}
+	if job.Status == jobs.Succeeded {
+		var result BatchResponse
+		if err := json.Unmarshal(job.Result, &result); err != nil {
+			apierror.Write(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Summary = &result.Summary
+		response.Errors = result.Errors
+		page := result.Results[min(offset, len(result.Results)):]
+		if len(page) > limit {
+			page = page[:limit]
+			response.NextOffset = offset + limit
+		}
+		response.Results = page
+		if payload.Verbosity.Level == verbosityMinimal {
+			response.Results = minimalResults(page)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding batch job: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/metrics"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBatchAPI returns the routes of a server with what batch analysis needs,
+// running its background jobs until the test ends
+func newBatchAPI(t *testing.T) http.Handler {
+	t.Helper()
+	fraudDetector := detector.NewFraudDetector()
+	mlEngine := ml.NewMLEngine()
+	queue, err := jobs.New(jobs.NewMemoryStore(), 100)
+	require.NoError(t, err)
+	scenarios, err := stats.NewScenarios(nil)
+	require.NoError(t, err)
+	engineMetrics := metrics.NewEngine(metrics.NewRegistry())
+	overrides := config.NewStore(config.Hierarchy{})
+
+	s := &Server{
+		fraudDetector:       fraudDetector,
+		mlEngine:            mlEngine,
+		scorer:              decision.NewScorer(fraudDetector, mlEngine, decision.DefaultPolicy()),
+		auditStore:          audit.NewMemoryStore(1000),
+		metrics:             engineMetrics,
+		stats:               stats.NewCollector(),
+		scenarios:           scenarios,
+		overrides:           overrides,
+		nearMisses:          nearMissDataset(),
+		reviews:             reviewQueue(overrides, engineMetrics),
+		merchantWebhooks:    merchantWebhooks(),
+		jobs:                queue,
+		verbosity:           verbosity{Level: verbosityStandard},
+		batchAsyncThreshold: 2,
+	}
+	s.registerJobs()
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		queue.Start(stop)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-stopped
+	})
+	return s.routes(apiDocument(), metrics.NewRegistry())
+}
+
+func batchTransaction(i int) TransactionRequest {
+	return TransactionRequest{
+		ID:            "TX-" + strconv.Itoa(i),
+		Amount:        50,
+		Currency:      "USD",
+		MerchantID:    "M-1",
+		CustomerID:    "C-" + strconv.Itoa(i),
+		PaymentMethod: "card",
+		Timestamp:     time.Now(),
+	}
+}
+
+func postBatch(t *testing.T, api http.Handler, query string, req interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/fraud/batch"+query, bytes.NewReader(body)))
+	return w
+}
+
+func getBatchJob(api http.Handler, id, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fraud/batch/"+id+query, nil))
+	return w
+}
+
+func TestBatchAnalysis_PartialFailure(t *testing.T) {
+	api := newBatchAPI(t)
+	invalid := batchTransaction(1)
+	invalid.Fee = 80
+	req := BatchRequest{Transactions: []TransactionRequest{batchTransaction(0), invalid, batchTransaction(2)}}
+
+	w := postBatch(t, api, "", req)
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, "TX-0", response.Results[0].TransactionID)
+	assert.Equal(t, "TX-2", response.Results[1].TransactionID)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, 1, response.Errors[0].Index)
+	assert.Equal(t, "TX-1", response.Errors[0].TransactionID)
+	assert.Equal(t, apierror.InvalidTransaction, response.Errors[0].Code)
+	assert.Contains(t, response.Errors[0].Message, "transactions[1]")
+	assert.Equal(t, 3, response.Summary.Total)
+	assert.Equal(t, 1, response.Summary.Failed)
+
+	req.Transactions = req.Transactions[:1]
+	assert.Equal(t, http.StatusOK, postBatch(t, api, "", req).Code, "a batch without errors is a 200")
+}
+
+func TestBatchAnalysis_SchemaChecksOnlyTheEnvelope(t *testing.T) {
+	api := newBatchAPI(t)
+	missingID := batchTransaction(1)
+	missingID.ID = ""
+	zeroAmount := batchTransaction(2)
+	zeroAmount.Amount = 0
+	req := BatchRequest{Transactions: []TransactionRequest{batchTransaction(0), missingID, zeroAmount, batchTransaction(3)}}
+
+	w := postBatch(t, api, "", req)
+	require.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, "TX-0", response.Results[0].TransactionID)
+	assert.Equal(t, "TX-3", response.Results[1].TransactionID)
+	require.Len(t, response.Errors, 2)
+	assert.Equal(t, 1, response.Errors[0].Index)
+	assert.Equal(t, apierror.InvalidTransaction, response.Errors[0].Code)
+	assert.Equal(t, "transactions[1]: id is required", response.Errors[0].Message)
+	assert.Equal(t, 2, response.Errors[1].Index)
+	assert.Equal(t, "TX-2", response.Errors[1].TransactionID)
+	assert.Equal(t, "transactions[2]: amount must be greater than 0", response.Errors[1].Message)
+
+	assert.Equal(t, http.StatusBadRequest, postBatch(t, api, "", BatchRequest{}).Code, "the envelope needs transactions")
+	assert.Equal(t, http.StatusBadRequest, postBatch(t, api, "", map[string]interface{}{"transactions": []int{1}}).Code)
+}
+
+func TestBatchAnalysis_AsyncJobPaging(t *testing.T) {
+	api := newBatchAPI(t)
+	var req BatchRequest
+	for i := 0; i < 5; i++ {
+		req.Transactions = append(req.Transactions, batchTransaction(i))
+	}
+	invalid := batchTransaction(5)
+	invalid.Items = []LineItemInfo{{SKU: "SKU-1", Quantity: 0, Price: 10}}
+	req.Transactions = append(req.Transactions, invalid)
+
+	w := postBatch(t, api, "?async=true", req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job jobs.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "/fraud/batch/"+job.ID, w.Header().Get("Location"))
+	assert.Empty(t, job.Payload, "the transactions are not echoed")
+
+	page := func(query string) BatchJobResponse {
+		w := getBatchJob(api, job.ID, query)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response BatchJobResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	require.Eventually(t, func() bool { return page("").Status == jobs.Succeeded }, 5*time.Second, 10*time.Millisecond)
+
+	first := page("?limit=2")
+	assert.Len(t, first.Results, 2)
+	assert.Equal(t, 2, first.NextOffset)
+	require.NotNil(t, first.Summary)
+	assert.Equal(t, 6, first.Summary.Total)
+	require.Len(t, first.Errors, 1)
+	assert.Equal(t, "TX-5", first.Errors[0].TransactionID)
+
+	last := page("?offset=4&limit=2")
+	assert.Len(t, last.Results, 1)
+	assert.Zero(t, last.NextOffset, "the last page has no next offset")
+	beyond := page("?offset=50")
+	assert.Empty(t, beyond.Results)
+	assert.Equal(t, 50, beyond.Offset)
+
+	for _, query := range []string{"?limit=0", "?limit=1001", "?offset=-1", "?limit=many"} {
+		assert.Equal(t, http.StatusBadRequest, getBatchJob(api, job.ID, query).Code, query)
+	}
+	assert.Equal(t, http.StatusNotFound, getBatchJob(api, "unknown", "").Code)
+}
+
+func TestBatchAnalysis_SmallBatchesStaySynchronous(t *testing.T) {
+	api := newBatchAPI(t)
+	req := BatchRequest{Transactions: []TransactionRequest{batchTransaction(0), batchTransaction(1)}}
+
+	w := postBatch(t, api, "?async=true", req)
+	assert.Equal(t, http.StatusOK, w.Code, "batches up to the threshold are analyzed inline")
+}
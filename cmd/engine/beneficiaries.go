@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type BeneficiaryLabelRequest struct {
+	Reason string `json:"reason" doc:"Why the beneficiary is considered fraudulent, e.g. confirmed scam report"`
+}
+
+// beneficiaryHandler serves beneficiary statistics
+func (s *Server) beneficiaryHandler(w http.ResponseWriter, r *http.Request) {
+	beneficiaryID := r.PathValue("id")
+	stats, exists := s.fraudDetector.Beneficiary(beneficiaryID)
+	if !exists {
+		apierror.Write(w, "beneficiary not found: "+beneficiaryID, http.StatusNotFound)
+		return
+	}
+	writeBeneficiary(w, stats)
+}
+
+// beneficiaryLabelHandler labels a beneficiary as fraudulent
+func (s *Server) beneficiaryLabelHandler(w http.ResponseWriter, r *http.Request) {
+	beneficiaryID := r.PathValue("id")
+	var req BeneficiaryLabelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	stats := s.fraudDetector.LabelBeneficiary(beneficiaryID, req.Reason)
+	log.Printf("Beneficiary %s labeled as fraudulent: %s", beneficiaryID, req.Reason)
+	writeBeneficiary(w, stats)
+}
+
+func writeBeneficiary(w http.ResponseWriter, stats detector.BeneficiaryStats) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding beneficiary: %v", err)
+	}
+}
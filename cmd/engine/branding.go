@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// engineVersion is the version reported in scoring responses
+const engineVersion = "v1.0.0"
+
+// subScores are the metadata scores a branding may reveal
+var subScores = map[string]bool{
+	"rule_score": true,
+	"ml_score":   true,
+	"mule_score": true,
+}
+
+// Branding shapes the scoring responses of a tenant, so white-label
+// partners show their merchants their own product rather than the engine's
+// versioning and scoring internals
+type Branding struct {
+	// Product is reported as the product metadata
+	Product string `json:"product,omitempty"`
+	// Version replaces the engine version; HideVersion drops it
+	Version     string `json:"version,omitempty"`
+	HideVersion bool   `json:"hide_version,omitempty"`
+	// Scores lists the sub-scores revealed, of rule_score, ml_score and
+	// mule_score; all of them when unset, none when empty
+	Scores []string `json:"scores"`
+	// HideExplanation drops the ML explanation, the counterfactual and the
+	// model features
+	HideExplanation bool `json:"hide_explanation,omitempty"`
+	// HideMetadata lists other metadata dropped, such as feature_tier or
+	// model_version
+	HideMetadata []string `json:"hide_metadata,omitempty"`
+}
+
+func (b Branding) validate() error {
+	for _, score := range b.Scores {
+		if !subScores[score] {
+			return fmt.Errorf("unknown sub-score %q: want rule_score, ml_score or mule_score", score)
+		}
+	}
+	return nil
+}
+
+// Brandings are the default branding of scoring responses and those of
+// tenants, which replace it entirely
+type Brandings struct {
+	Default Branding            `json:"default"`
+	Tenants map[string]Branding `json:"tenants"`
+}
+
+// For returns the branding of a tenant
+func (b Brandings) For(tenant string) Branding {
+	if branding, found := b.Tenants[tenant]; found {
+		return branding
+	}
+	return b.Default
+}
+
+// responseBrandings reads the brandings in BRANDING_FILE, reporting the
+// engine version and every sub-score when unset
+func responseBrandings() Brandings {
+	path := os.Getenv("BRANDING_FILE")
+	if path == "" {
+		return Brandings{}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to load brandings: %v", err)
+	}
+	defer f.Close()
+
+	var brandings Brandings
+	if err := json.NewDecoder(f).Decode(&brandings); err != nil {
+		log.Fatalf("Invalid BRANDING_FILE: %v", err)
+	}
+	if err := brandings.Default.validate(); err != nil {
+		log.Fatalf("Invalid default branding: %v", err)
+	}
+	for tenant, branding := range brandings.Tenants {
+		if err := branding.validate(); err != nil {
+			log.Fatalf("Invalid branding of tenant %s: %v", tenant, err)
+		}
+	}
+	log.Printf("Branding the responses of %d tenants", len(brandings.Tenants))
+	return brandings
+}
+
+// responseBranding returns the branding of the caller's tenant
+func (s *Server) responseBranding(r *http.Request) Branding {
+	_, tenant := caller(r)
+	return s.brandings.For(tenant)
+}
+
+// apply rebrands a scoring response. It only shapes the response: the
+// decision is audited and published in full.
+func (b Branding) apply(response *FraudResponse) {
+	if b.HideExplanation {
+		response.Explanation = nil
+		response.Counterfactual = nil
+		response.Features = nil
+	}
+	if response.Metadata == nil {
+		if b.Product == "" {
+			return
+		}
+		response.Metadata = map[string]interface{}{}
+	}
+
+	if b.Scores != nil {
+		revealed := make(map[string]bool, len(b.Scores))
+		for _, score := range b.Scores {
+			revealed[score] = true
+		}
+		for score := range subScores {
+			if !revealed[score] {
+				delete(response.Metadata, score)
+			}
+		}
+	}
+	for _, key := range b.HideMetadata {
+		delete(response.Metadata, key)
+	}
+	if _, versioned := response.Metadata["version"]; versioned && b.Version != "" {
+		response.Metadata["version"] = b.Version
+	}
+	if b.HideVersion {
+		delete(response.Metadata, "version")
+	}
+	if b.Product != "" {
+		response.Metadata["product"] = b.Product
+	}
+	if len(response.Metadata) == 0 {
+		response.Metadata = nil
+	}
+}
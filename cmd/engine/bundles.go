@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/bundle"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+// maxBundleBytes caps the size of an imported bundle
+const maxBundleBytes = 16 << 20
+
+type BundleImportResponse struct {
+	BundleID string       `json:"bundle_id"`
+	Previous string       `json:"previous,omitempty"`
+	DryRun   bool         `json:"dry_run"`
+	Applied  bool         `json:"applied"`
+	Rules    ruleset.Diff `json:"rules"`
+}
+
+// errModelMismatch is returned for bundles tuned against another model
+var errModelMismatch = errors.New("model version mismatch")
+
+// bundlesEnabled rejects bundle requests unless BUNDLE_SIGNING_KEY is set
+func (s *Server) bundlesEnabled(w http.ResponseWriter) bool {
+	if len(s.bundleKey) == 0 {
+		apierror.Write(w, "Config bundles are disabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// currentBundle captures the live scoring configuration
+func (s *Server) currentBundle() (bundle.Bundle, error) {
+	policy := s.scorer.Policy()
+	return bundle.Bundle{
+		Source:    s.bundleSource,
+		CreatedAt: time.Now().UTC(),
+		Rules:     ruleset.FromRules(s.fraudDetector.GetActiveRules()),
+		Thresholds: bundle.Thresholds{
+			Review:  policy.ReviewThreshold,
+			Decline: policy.DeclineThreshold,
+		},
+		Lists:        s.lists.Values(),
+		ModelVersion: s.mlEngine.ActiveVersion(),
+	}.Seal()
+}
+
+// applyBundle checks every part of a bundle against this engine, then
+// replaces the expression rules, lists and thresholds. Nothing changes when a
+// check fails. Callers must hold rulesMu.
+func (s *Server) applyBundle(b bundle.Bundle, dryRun bool) (ruleset.Diff, error) {
+	if active := s.mlEngine.ActiveVersion(); b.ModelVersion != active {
+		return ruleset.Diff{}, fmt.Errorf("%w: bundle needs model %s, engine runs %s", errModelMismatch, b.ModelVersion, active)
+	}
+
+	current := ruleset.FromRules(s.fraudDetector.GetActiveRules())
+	if err := b.Rules.CheckBuiltins(current); err != nil {
+		return ruleset.Diff{}, err
+	}
+	rules := b.Rules.ExpressionRules()
+	if err := s.fraudDetector.CheckExpressionRules(rules); err != nil {
+		return ruleset.Diff{}, err
+	}
+
+	config, err := s.configs.Get(decision.CurrentConfiguration)
+	if err != nil {
+		return ruleset.Diff{}, err
+	}
+	config.ReviewThreshold = b.Thresholds.Review
+	config.DeclineThreshold = b.Thresholds.Decline
+	if err := config.Validate(); err != nil {
+		return ruleset.Diff{}, err
+	}
+
+	diff := ruleset.Compare(current, b.Rules)
+	if dryRun {
+		return diff, nil
+	}
+
+	if err := s.fraudDetector.ReplaceExpressionRules(rules); err != nil {
+		return ruleset.Diff{}, err
+	}
+	lists := detector.NewLists()
+	for name, values := range b.Lists {
+		lists.Set(name, values)
+	}
+	previousLists := s.lists.Values()
+	s.lists.ReplaceAll(lists)
+	s.fraudDetector.SetLists(lists)
+	s.replicateLists(previousLists, lists.Values())
+	s.scorer.SetPolicy(config.Policy())
+	if err := s.configs.SetCurrent(config); err != nil {
+		return ruleset.Diff{}, err
+	}
+	return diff, nil
+}
+
+// bundlesHandler lists the applied bundles, most recent first
+func (s *Server) bundlesHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.bundlesEnabled(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"history": s.bundles.List(),
+	}); err != nil {
+		log.Printf("Error encoding bundle history: %v", err)
+	}
+}
+
+// bundleExportHandler signs and returns the live scoring configuration
+func (s *Server) bundleExportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.bundlesEnabled(w) {
+		return
+	}
+
+	current, err := s.currentBundle()
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signed, err := bundle.Sign(current, s.bundleKey)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=bundle-%s.json", signed.Bundle.ID))
+	if err := json.NewEncoder(w).Encode(signed); err != nil {
+		log.Printf("Error encoding bundle: %v", err)
+	}
+}
+
+// bundleImportHandler verifies a signed bundle and applies it. With
+// dry_run=true it only reports the rule changes.
+func (s *Server) bundleImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.bundlesEnabled(w) {
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	signed, err := bundle.Read(http.MaxBytesReader(w, r.Body, maxBundleBytes))
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := bundle.Verify(signed, s.bundleKey)
+	if errors.Is(err, bundle.ErrBadSignature) {
+		apierror.Write(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	// The configuration the engine started with is the first rollback target
+	if s.bundles.Empty() && !dryRun {
+		baseline, err := s.currentBundle()
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.bundles.Push(baseline, time.Now())
+	}
+	previous := s.bundles.List()
+
+	diff, err := s.applyBundle(b, dryRun)
+	if err != nil {
+		bundleError(w, err)
+		return
+	}
+	if !dryRun {
+		s.bundles.Push(b, time.Now())
+		s.recordVersion()
+		s.recordRuleChanges(r, "bundle")
+		log.Printf("Applied config bundle %s from %s", b.ID, b.Source)
+	}
+
+	response := BundleImportResponse{
+		BundleID: b.ID,
+		DryRun:   dryRun,
+		Applied:  !dryRun,
+		Rules:    diff,
+	}
+	if len(previous) > 0 {
+		response.Previous = previous[0].Bundle.ID
+	}
+	writeBundleResponse(w, response)
+}
+
+// bundleRollbackHandler re-applies the bundle applied before the current one
+func (s *Server) bundleRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.bundlesEnabled(w) {
+		return
+	}
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	history := s.bundles.List()
+	previous, err := s.bundles.Previous()
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusConflict)
+		return
+	}
+	diff, err := s.applyBundle(previous, false)
+	if err != nil {
+		bundleError(w, err)
+		return
+	}
+	s.bundles.Pop()
+	s.recordVersion()
+	s.recordRuleChanges(r, "bundle_rollback")
+	log.Printf("Rolled back config bundle %s to %s", history[0].Bundle.ID, previous.ID)
+
+	writeBundleResponse(w, BundleImportResponse{
+		BundleID: previous.ID,
+		Previous: history[0].Bundle.ID,
+		Applied:  true,
+		Rules:    diff,
+	})
+}
+
+func bundleError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errModelMismatch) {
+		status = http.StatusConflict
+	}
+	apierror.Write(w, err.Error(), status)
+}
+
+func writeBundleResponse(w http.ResponseWriter, response BundleImportResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding bundle response: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type CalendarEvents struct {
+	Events []detector.CalendarEvent `json:"events"`
+}
+
+// calendarHandler lists the calendar events, earliest first
+func (s *Server) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	writeCalendar(w, CalendarEvents{Events: s.calendar.Events()})
+}
+
+// putCalendarHandler replaces the calendar events. Transactions scored from
+// then on have their thresholds scaled by them.
+func (s *Server) putCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	var req CalendarEvents
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.calendar.Set(req.Events); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Calendar replaced: %d events", len(req.Events))
+	writeCalendar(w, CalendarEvents{Events: s.calendar.Events()})
+}
+
+func writeCalendar(w http.ResponseWriter, events CalendarEvents) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		log.Printf("Error encoding calendar: %v", err)
+	}
+}
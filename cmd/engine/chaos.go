@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/chaos"
+)
+
+type ChaosRequest struct {
+	MLLatency        string  `json:"ml_latency" doc:"Delay added to every ML prediction, e.g. 250ms"`
+	MLErrorRate      float64 `json:"ml_error_rate" openapi:"minimum=0,maximum=1"`
+	StorageErrorRate float64 `json:"storage_error_rate" openapi:"minimum=0,maximum=1"`
+}
+
+// faults converts the request into injected faults
+func (req ChaosRequest) faults() (chaos.Faults, error) {
+	faults := chaos.Faults{
+		MLErrorRate:      req.MLErrorRate,
+		StorageErrorRate: req.StorageErrorRate,
+	}
+	if req.MLLatency != "" {
+		latency, err := time.ParseDuration(req.MLLatency)
+		if err != nil {
+			return faults, fmt.Errorf("invalid ml_latency: %v", err)
+		}
+		faults.MLLatency = latency
+	}
+	return faults, faults.Validate()
+}
+
+func chaosResponse(faults chaos.Faults) ChaosRequest {
+	return ChaosRequest{
+		MLLatency:        faults.MLLatency.String(),
+		MLErrorRate:      faults.MLErrorRate,
+		StorageErrorRate: faults.StorageErrorRate,
+	}
+}
+
+// chaosInjector returns the fault injector when developer mode fault
+// injection is enabled with CHAOS_ENABLED, seeded with the faults set by the
+// CHAOS_* variables
+func chaosInjector() *chaos.Injector {
+	if enabled, _ := strconv.ParseBool(os.Getenv("CHAOS_ENABLED")); !enabled {
+		return nil
+	}
+
+	req := ChaosRequest{MLLatency: os.Getenv("CHAOS_ML_LATENCY")}
+	for key, rate := range map[string]*float64{
+		"CHAOS_ML_ERROR_RATE":      &req.MLErrorRate,
+		"CHAOS_STORAGE_ERROR_RATE": &req.StorageErrorRate,
+	} {
+		if value := os.Getenv(key); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				log.Fatalf("Invalid %s: %v", key, err)
+			}
+			*rate = parsed
+		}
+	}
+
+	faults, err := req.faults()
+	if err != nil {
+		log.Fatalf("Invalid fault injection settings: %v", err)
+	}
+	injector := chaos.NewInjector()
+	if err := injector.Set(faults); err != nil {
+		log.Fatalf("Invalid fault injection settings: %v", err)
+	}
+	log.Printf("Fault injection enabled: %+v", faults)
+	return injector
+}
+
+// chaosHandler reports, sets and clears the injected faults
+func (s *Server) chaosHandler(w http.ResponseWriter, r *http.Request) {
+	if s.chaos == nil {
+		apierror.Write(w, "fault injection is disabled; set CHAOS_ENABLED=true", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req ChaosRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		faults, err := req.faults()
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.chaos.Set(faults); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Fault injection set: %+v", faults)
+	case http.MethodDelete:
+		s.chaos.Clear()
+		log.Printf("Fault injection cleared")
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chaosResponse(s.chaos.Faults()))
+}
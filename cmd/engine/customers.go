@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type CustomerResponse struct {
+	CustomerID string                    `json:"customer_id"`
+	Locations  []detector.LocationRecord `json:"locations" doc:"Recent locations, oldest first"`
+}
+
+// customerHandler serves what the detector knows about a customer
+func (s *Server) customerHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := r.PathValue("id")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CustomerResponse{
+		CustomerID: customerID,
+		Locations:  s.fraudDetector.LocationHistory(customerID),
+	}); err != nil {
+		log.Printf("Error encoding customer: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+// decisionEvent converts an audited decision into a decision event
+func decisionEvent(record audit.Record) *events.DecisionEvent {
+	tx := record.Transaction
+	return &events.DecisionEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       tx.ID + ":" + strconv.FormatInt(record.DecidedAt.UnixNano(), 10),
+		OccurredAt:    record.DecidedAt.UTC(),
+		TransactionID: tx.ID,
+		AccountID:     tx.AccountID,
+		MerchantID:    tx.MerchantID,
+		Amount:        tx.Amount,
+		Currency:      tx.Currency,
+		Decision:      record.Decision,
+		RiskScore:     record.RiskScore,
+		RuleScore:     record.RuleScore,
+		MLScore:       record.MLScore,
+		Confidence:    record.Confidence,
+		ReasonCodes:   record.ReasonCodes,
+		Reasons:       record.Reasons,
+		Retry:         record.Retry,
+	}
+}
+
+// eventsHandler streams the decision events since a time, oldest first, as
+// JSON lines or, when the client accepts application/x-protobuf, as
+// length-delimited protobuf
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			apierror.Write(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	records, err := s.auditStore.Since(since)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), protobufContentType) {
+		w.Header().Set("Content-Type", protobufContentType)
+		for _, record := range records {
+			if err := events.WriteDelimited(w, decisionEvent(record)); err != nil {
+				log.Printf("Error writing decision events: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if err := encoder.Encode(decisionEvent(record)); err != nil {
+			log.Printf("Error writing decision events: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/fairness"
+)
+
+// fairnessMonitor returns the monitor of decline and false-positive rates
+// across the FAIRNESS_DIMENSIONS segments
+func fairnessMonitor(store audit.Store) *fairness.Monitor {
+	config := fairness.DefaultConfig()
+	if value := os.Getenv("FAIRNESS_DIMENSIONS"); value != "" {
+		config.Dimensions = strings.Split(value, ",")
+	}
+	if value := os.Getenv("FAIRNESS_AMOUNT_BANDS"); value != "" {
+		config.AmountBands = nil
+		for _, bound := range strings.Split(value, ",") {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+			if err != nil {
+				log.Fatalf("Invalid FAIRNESS_AMOUNT_BANDS: %v", err)
+			}
+			config.AmountBands = append(config.AmountBands, parsed)
+		}
+	}
+	config.Window = getEnvDuration("FAIRNESS_WINDOW", config.Window)
+	config.MinDecisions = getEnvInt("FAIRNESS_MIN_DECISIONS", config.MinDecisions)
+	config.MinLabeled = getEnvInt("FAIRNESS_MIN_LABELED", config.MinLabeled)
+
+	monitor, err := fairness.NewMonitor(config, store)
+	if err != nil {
+		log.Fatalf("Failed to configure fairness monitoring: %v", err)
+	}
+	return monitor
+}
+
+// fairnessHandler serves the latest fairness report, computing one when
+// none was yet or refresh is set
+func (s *Server) fairnessHandler(w http.ResponseWriter, r *http.Request) {
+	report, exists := s.fairness.Latest()
+	if !exists || r.URL.Query().Get("refresh") == "true" {
+		var err error
+		if report, err = s.fairness.Run(time.Now()); err != nil {
+			apierror.Write(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error encoding fairness report: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/labels"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/objectstore"
+)
+
+// maxLabelFileBytes and maxLabelRows cap the size of a label file
+const (
+	maxLabelFileBytes = 32 << 20
+	maxLabelRows      = 200000
+)
+
+type FeedbackRequest struct {
+	TransactionID string `json:"transaction_id" openapi:"required,minLength=1"`
+	Fraud         bool   `json:"fraud" openapi:"required" doc:"Whether the transaction turned out to be fraud, e.g. after a chargeback"`
+}
+
+type FeedbackResponse struct {
+	TransactionID string                  `json:"transaction_id"`
+	Fraud         bool                    `json:"fraud"`
+	Corridor      *detector.CorridorStats `json:"corridor,omitempty" doc:"The issuer, merchant and IP country corridor the label was learned for"`
+	ModelUpdated  bool                    `json:"model_updated,omitempty" doc:"Whether the online model learned the label"`
+}
+
+// LabelImport is a label file to import from object storage
+type LabelImport struct {
+	Location string `json:"location"`
+	Format   string `json:"format,omitempty"`
+	DryRun   bool   `json:"dry_run,omitempty"`
+}
+
+type FeedbackBatchResponse struct {
+	Rows       int  `json:"rows"`
+	Labeled    int  `json:"labeled" doc:"Rows whose transaction was labeled, or would be on a dry run"`
+	Fraud      int  `json:"fraud"`
+	Legitimate int  `json:"legitimate"`
+	Unmatched  int  `json:"unmatched" doc:"Rows naming a transaction without a decision"`
+	Invalid    int  `json:"invalid" doc:"Rows that could not be read"`
+	DryRun     bool `json:"dry_run"`
+	// Rejected lists the unmatched and invalid rows by line
+	Rejected []labels.RowError `json:"rejected"`
+}
+
+type CorridorsResponse struct {
+	Corridors []detector.CorridorStats `json:"corridors"`
+}
+
+// feedbackHandler records whether an audited transaction turned out to be
+// fraud. Labeling a transaction again replaces its label.
+func (s *Server) feedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.auditStore.Search(audit.Query{TransactionID: req.TransactionID, Limit: 1})
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		apierror.Write(w, "no decision found for transaction: "+req.TransactionID, http.StatusNotFound)
+		return
+	}
+
+	response := s.label(&records[0], req.Fraud)
+	log.Printf("Transaction %s labeled, fraud: %t", req.TransactionID, req.Fraud)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding feedback response: %v", err)
+	}
+}
+
+// label teaches the corridors, the online model, the reports and the review
+// triage whether an audited transaction turned out to be fraud
+func (s *Server) label(record *audit.Record, fraud bool) FeedbackResponse {
+	id := record.Transaction.ID
+	response := FeedbackResponse{TransactionID: id, Fraud: fraud}
+	if corridor, ok := s.fraudDetector.LabelTransaction(&record.Transaction, fraud); ok {
+		response.Corridor = &corridor
+	}
+	response.ModelUpdated = s.mlEngine.Learn(&record.Transaction, fraud)
+	s.fairness.Label(id, fraud, time.Now())
+	s.reports.Label(id, fraud, time.Now())
+	if _, err := s.nearMisses.Label(id, fraud, time.Now()); err != nil {
+		log.Printf("Failed to label near miss %s: %v", id, err)
+	}
+	s.reviews.Label(id, fraud, time.Now())
+	return response
+}
+
+// feedbackBatchHandler labels the transactions of a CSV or JSON Lines label
+// file, such as an issuer's daily chargeback file, sent as the body. With a
+// location, the file is read from s3:// or gs:// in a background job instead.
+// Rows naming a transaction without a decision are reported, not applied;
+// with dry_run=true nothing is labeled.
+func (s *Server) feedbackBatchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format != "" && format != labels.FormatCSV && format != labels.FormatJSONL {
+		apierror.Write(w, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	dryRun := query.Get("dry_run") == "true"
+
+	if location := query.Get("location"); location != "" {
+		if !objectstore.IsObject(location) {
+			apierror.Write(w, "location must be an s3:// or gs:// URL", http.StatusBadRequest)
+			return
+		}
+		s.enqueueJob(w, jobLabelImport, LabelImport{Location: location, Format: format, DryRun: dryRun})
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLabelFileBytes))
+	if err != nil {
+		apierror.Write(w, "label file too large or unreadable: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if format == "" {
+		format = labels.Format(r.Header.Get("Content-Type"), "", data)
+	}
+	response, err := s.applyLabels(data, format, dryRun)
+	switch {
+	case errors.Is(err, labels.ErrTooManyRows):
+		apierror.Write(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding feedback batch response: %v", err)
+	}
+}
+
+// importLabels reads a label file from object storage and applies it
+func (s *Server) importLabels(ctx context.Context, req LabelImport) (FeedbackBatchResponse, error) {
+	data, err := s.artifacts.store.Get(ctx, req.Location)
+	if err != nil {
+		return FeedbackBatchResponse{}, err
+	}
+	format := req.Format
+	if format == "" {
+		format = labels.Format("", req.Location, data)
+	}
+	response, err := s.applyLabels(data, format, req.DryRun)
+	if err != nil {
+		return FeedbackBatchResponse{}, jobs.Permanent(err)
+	}
+	return response, nil
+}
+
+// applyLabels labels the transactions of a label file that have a decision,
+// in the order of the file
+func (s *Server) applyLabels(data []byte, format string, dryRun bool) (FeedbackBatchResponse, error) {
+	parsed, rejected, err := labels.Parse(data, format, maxLabelRows)
+	if err != nil {
+		return FeedbackBatchResponse{}, err
+	}
+	response := FeedbackBatchResponse{Rows: len(parsed) + len(rejected), Invalid: len(rejected), DryRun: dryRun}
+	for _, label := range parsed {
+		records, err := s.auditStore.Search(audit.Query{TransactionID: label.TransactionID, Limit: 1})
+		if err != nil {
+			return FeedbackBatchResponse{}, err
+		}
+		if len(records) == 0 {
+			rejected = append(rejected, labels.RowError{Line: label.Line, TransactionID: label.TransactionID, Error: "no decision found for transaction"})
+			response.Unmatched++
+			continue
+		}
+		if !dryRun {
+			s.label(&records[0], label.Fraud)
+		}
+		response.Labeled++
+		if label.Fraud {
+			response.Fraud++
+		} else {
+			response.Legitimate++
+		}
+	}
+	sort.Slice(rejected, func(i, j int) bool { return rejected[i].Line < rejected[j].Line })
+	if rejected == nil {
+		rejected = []labels.RowError{}
+	}
+	response.Rejected = rejected
+	if !dryRun {
+		log.Printf("Label file applied: %d of %d rows labeled, %d unmatched, %d invalid", response.Labeled, response.Rows, response.Unmatched, response.Invalid)
+	}
+	return response, nil
+}
+
+// corridorsHandler lists the configured and labeled country corridors,
+// riskiest first
+func (s *Server) corridorsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CorridorsResponse{Corridors: s.fraudDetector.Corridors()}); err != nil {
+		log.Printf("Error encoding corridors: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/flags"
+)
+
+type FeatureFlags struct {
+	Flags []flags.Flag `json:"flags"`
+}
+
+// featureGate rolls the detector features out per tenant of the merchant
+// and per account, so an account keeps its answer across transactions
+type featureGate struct {
+	registry *flags.Registry
+	layers   *config.Store
+}
+
+func (g featureGate) FeatureEnabled(feature string, tx *detector.Transaction) bool {
+	layer, _ := g.layers.Merchant(tx.MerchantID)
+	key := tx.AccountID
+	if key == "" {
+		key = tx.ID
+	}
+	return g.registry.Enabled(feature, layer.Tenant, key)
+}
+
+// featureFlags returns the registry of the detector features. Every feature
+// is on for everyone unless FEATURE_FLAGS_FILE rolls it out otherwise.
+func featureFlags() *flags.Registry {
+	var defaults []flags.Flag
+	for name, description := range detector.Features() {
+		defaults = append(defaults, flags.Flag{Name: name, Description: description, Percentage: 100})
+	}
+	registry := flags.NewRegistry(defaults...)
+
+	if path := os.Getenv("FEATURE_FLAGS_FILE"); path != "" {
+		configured, err := flags.LoadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load feature flags: %v", err)
+		}
+		if err := registry.Set(configured); err != nil {
+			log.Fatalf("Invalid feature flags: %v", err)
+		}
+		log.Printf("Loaded %d feature flags", len(configured))
+	}
+	return registry
+}
+
+// featureFlagsHandler lists the rollout of every feature
+func (s *Server) featureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	writeFeatureFlags(w, FeatureFlags{Flags: s.features.Flags()})
+}
+
+// putFeatureFlagsHandler replaces the configured flags. Features left out
+// fall back to their default rollout.
+func (s *Server) putFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	var req FeatureFlags
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.features.Set(req.Flags); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Feature flags replaced: %d flags", len(req.Flags))
+	writeFeatureFlags(w, FeatureFlags{Flags: s.features.Flags()})
+}
+
+func writeFeatureFlags(w http.ResponseWriter, featureFlags FeatureFlags) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(featureFlags); err != nil {
+		log.Printf("Error encoding feature flags: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/gateway"
+)
+
+// gatewayDispatcher returns the payment gateway integrations configured in
+// GATEWAY_INTEGRATIONS_FILE, delivering with the DECISION_WEBHOOK_* retry and
+// queue settings
+func gatewayDispatcher() *gateway.Dispatcher {
+	path := os.Getenv("GATEWAY_INTEGRATIONS_FILE")
+	if path == "" {
+		return nil
+	}
+	integrations, err := gateway.LoadIntegrationsFile(path)
+	if err != nil {
+		log.Fatalf("Failed to load gateway integrations: %v", err)
+	}
+	dispatcher, err := gateway.NewDispatcher(integrations, webhookDelivery())
+	if err != nil {
+		log.Fatalf("Failed to configure gateway integrations: %v", err)
+	}
+	log.Printf("Acting on decisions in payment gateways: %v", dispatcher.Names())
+	return dispatcher
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/nearmiss"
+)
+
+// Job types run by the background job queue
+const (
+	jobTrain        = "train"
+	jobDecisionDiff = "decision_diff"
+	jobRuleMining   = "rule_mining"
+	// jobWebhookReplay redelivers the decision events of a time range
+	jobWebhookReplay = "webhook_replay"
+	// jobLabelImport applies a label file kept in object storage
+	jobLabelImport = "label_import"
+)
+
+type JobsResponse struct {
+	Jobs []jobs.Job `json:"jobs"`
+}
+
+// jobQueue returns the background job queue, kept in JOBS_DIR so that
+// queued and interrupted jobs survive restarts, or in memory when unset
+func jobQueue() *jobs.Queue {
+	var store jobs.Store = jobs.NewMemoryStore()
+	if dir := os.Getenv("JOBS_DIR"); dir != "" {
+		fileStore, err := jobs.OpenFileStore(dir)
+		if err != nil {
+			log.Fatalf("Failed to open job store: %v", err)
+		}
+		store = fileStore
+		log.Printf("Keeping background jobs in %s", dir)
+	}
+	queue, err := jobs.New(store, getEnvInt("JOBS_HISTORY", 1000))
+	if err != nil {
+		log.Fatalf("Failed to load background jobs: %v", err)
+	}
+	return queue
+}
+
+// jobType returns the retry policy and concurrency limit of a job type,
+// from JOB_MAX_ATTEMPTS, JOB_RETRY_BACKOFF and JOB_CONCURRENCY
+func jobType(handler jobs.Handler) jobs.Type {
+	t := jobs.DefaultType(handler)
+	t.MaxAttempts = getEnvInt("JOB_MAX_ATTEMPTS", t.MaxAttempts)
+	t.Backoff = getEnvDuration("JOB_RETRY_BACKOFF", t.Backoff)
+	t.Concurrency = getEnvInt("JOB_CONCURRENCY", t.Concurrency)
+	return t
+}
+
+// registerJobs registers the handlers of the job types the server runs
+func (s *Server) registerJobs() {
+	s.jobs.Register(jobTrain, jobType(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		if err := s.mlEngine.TrainModel(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"model_version": s.mlEngine.GetModelInfo()["version"]}, nil
+	}))
+	s.jobs.Register(jobDecisionDiff, jobType(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var req DecisionDiffRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		// A configuration deleted since the job was queued will not come back
+		baseline, candidate, err := s.diffScorers(req)
+		if err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		return s.decisionDiff(req, baseline, candidate)
+	}))
+	s.jobs.Register(jobRuleMining, jobType(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var config nearmiss.MiningConfig
+		if err := json.Unmarshal(payload, &config); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		return nearmiss.Mine(s.nearMisses.Entries(true, 0), config), nil
+	}))
+	s.jobs.Register(jobWebhookReplay, jobType(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var req WebhookReplayRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		return s.replayWebhook(ctx, req)
+	}))
+	s.jobs.Register(jobBatch, s.batchJobType())
+	s.jobs.Register(jobLabelImport, jobType(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var req LabelImport
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		return s.importLabels(ctx, req)
+	}))
+}
+
+// enqueueJob queues a background job and responds with it
+func (s *Server) enqueueJob(w http.ResponseWriter, jobType string, payload interface{}) {
+	job, err := s.jobs.Enqueue(jobType, payload)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJob(w, http.StatusAccepted, job)
+}
+
+// jobsHandler lists the kept jobs, most recently created first, filtered by
+// status and type
+func (s *Server) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			apierror.Write(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(JobsResponse{
+		Jobs: s.jobs.List(query.Get("status"), query.Get("type"), limit),
+	}); err != nil {
+		log.Printf("Error encoding jobs: %v", err)
+	}
+}
+
+// jobHandler returns a job with its attempts and result
+func (s *Server) jobHandler(w http.ResponseWriter, r *http.Request) {
+	job, exists := s.jobs.Get(r.PathValue("id"))
+	if !exists {
+		apierror.Write(w, jobs.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+// cancelJobHandler cancels a queued or running job
+func (s *Server) cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		apierror.Write(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+func writeJob(w http.ResponseWriter, status int, job jobs.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Error encoding job: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type AmountLimits struct {
+	Limits []detector.AmountLimit `json:"limits"`
+}
+
+// amountLimitsHandler lists the cumulative amount limits of the accounts
+func (s *Server) amountLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	writeAmountLimits(w, AmountLimits{Limits: s.amountLimits.Limits()})
+}
+
+// putAmountLimitsHandler replaces the amount limits. Accounts keep what they
+// spent against limits of the same period and product.
+func (s *Server) putAmountLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	var req AmountLimits
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.amountLimits.Set(req.Limits); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Amount limits replaced: %d limits", len(req.Limits))
+	writeAmountLimits(w, AmountLimits{Limits: s.amountLimits.Limits()})
+}
+
+func writeAmountLimits(w http.ResponseWriter, limits AmountLimits) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(limits); err != nil {
+		log.Printf("Error encoding amount limits: %v", err)
+	}
+}
+
+// addLimitMetadata reports what the account has left of its amount limits,
+// the least of them as remaining_limit for issuers to show customers
+func addLimitMetadata(response *FraudResponse, result *detector.FraudScore) {
+	remaining, limited := detector.RemainingLimit(result.AmountLimits)
+	if !limited {
+		return
+	}
+	if response.Metadata == nil {
+		response.Metadata = make(map[string]interface{})
+	}
+	response.Metadata["remaining_limit"] = remaining
+	response.Metadata["amount_limits"] = result.AmountLimits
+}
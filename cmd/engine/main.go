@@ -3,34 +3,205 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/josuebarros1995/golang-fraud-detection/internal/annotation"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/bundle"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/chaos"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
 	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/fairness"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/flags"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/gateway"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/inflight"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/metrics"
 	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/nearmiss"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/network"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/partition"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/persist"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/quota"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/recording"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/replication"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/report"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stats"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/throttle"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/wasm"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
 )
 
 type Server struct {
 	fraudDetector *detector.FraudDetector
 	mlEngine      *ml.MLEngine
+	scorer        *decision.Scorer
+	auditStore    audit.Store
+	// sealedAudit is the audit store when sealed under per-tenant keys
+	sealedAudit  *audit.SealedStore
+	configs      *decision.Registry
+	addressRisk  *detector.AddressRiskList
+	asns         *detector.ASNTable
+	amounts      detector.AmountPatternConfig
+	merchants    *detector.MerchantRegistry
+	calendar     *detector.Calendar
+	amountLimits *detector.AmountLimits
+	lists        *detector.Lists
+	chaos        *chaos.Injector
+	webhook      *webhook.Sender
+	metrics      *metrics.Engine
+	// stats counts every decision for /fraud/stats
+	stats        *stats.Collector
+	analyzeMode  string
+	fullScoring  *fullScoring
+	bundleKey    []byte
+	bundleSource string
+	bundles      *bundle.History
+	ruleHistory  *ruleset.History
+	overrides    *config.Store
+	features     *flags.Registry
+	decisionTTL  time.Duration
+	recorder     *recording.Recorder
+	// timeline holds the configurations run, for as-of scoring, which
+	// replays the decisions audited within asOfWindow before the time
+	timeline   *bundle.Timeline
+	asOfWindow time.Duration
+	// verbosity is the default shape of scoring responses
+	verbosity verbosity
+	// brandings shape the scoring responses of white-label tenants
+	brandings Brandings
+	// batchAsyncThreshold is the batch size above which async=true
+	// analyzes batches in the background
+	batchAsyncThreshold int
+	// merchantWebhooks deliver decision events to the webhooks merchants
+	// register themselves
+	merchantWebhooks *webhook.Router
+	// gateways flag or hold declined and reviewed payments in the payment
+	// gateways, nil when none is configured
+	gateways *gateway.Dispatcher
+	// fairness compares decline and false-positive rates across segments
+	fairness *fairness.Monitor
+	// reports generates the daily and weekly fraud reports
+	reports *report.Generator
+	// jobs runs training and replays in the background
+	jobs *jobs.Queue
+	// nearMisses keeps the transactions that scored just below a threshold,
+	// to mine for new rules
+	nearMisses *nearmiss.Dataset
+	// annotations holds the notes, tags and attachments of analysts on
+	// decisions
+	annotations *annotation.Store
+	// reviews queues REVIEW decisions for analysts under the SLA of their
+	// tenant
+	reviews *review.Queue
+	// throttle adds friction to, then throttles, merchants whose decline
+	// rate spikes, nil unless enabled
+	throttle *throttle.Limiter
+	// network alerts on accounts and devices risky at many merchants, and
+	// networkAlerts delivers the alerts, both nil unless enabled
+	network       *network.Correlator
+	networkAlerts *alertSender
+	// scenarios evaluates the alert rules on aggregate decisions, and
+	// scenarioAlerts delivers their alerts, nil without a webhook
+	scenarios      *stats.Scenarios
+	scenarioAlerts *alertSender
+	// quotas meters the analyses of callers against their daily and monthly
+	// quotas, nil when none are configured
+	quotas *quota.Meter
+	// ruleApprovals holds the rule changes of tenants that require sign-off,
+	// and approvalNotifier tells their approvers
+	ruleApprovals    *ruleset.Approvals
+	approvalNotifier *approvalNotifier
+	// artifacts reads model artifacts from disk or object storage
+	artifacts *modelArtifacts
+	// rulesMu serializes rule and bundle imports
+	rulesMu sync.Mutex
+	// inflight coalesces concurrent analyses of the same transaction
+	inflight inflight.Group[scoredTransaction]
+	// sandbox decides the transactions of sandbox credentials
+	sandbox *decision.Sandbox
+	// replication ships lists, rules and profile aggregates to the other
+	// regions, nil outside active-active deployments; replicationSecret
+	// signs the deltas between regions
+	replication       *replication.Node
+	replicationSecret string
+	// partition forwards analyses to the replica owning their account, nil
+	// when state is not sharded
+	partition *partition.Forwarder
+}
+
+// scoredTransaction is a transaction as scored, with its outcome
+type scoredTransaction struct {
+	transaction *detector.Transaction
+	outcome     *decision.Outcome
 }
 
 type TransactionRequest struct {
-	ID                string                 `json:"id"`
-	Amount            float64                `json:"amount"`
-	Currency          string                 `json:"currency"`
-	MerchantID        string                 `json:"merchant_id"`
-	CustomerID        string                 `json:"customer_id"`
-	PaymentMethod     string                 `json:"payment_method"`
-	Location          Location               `json:"location"`
-	DeviceInfo        DeviceInfo             `json:"device_info"`
-	Timestamp         time.Time              `json:"timestamp"`
-	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	ID            string                 `json:"id" openapi:"required,minLength=1"`
+	Amount        float64                `json:"amount" openapi:"required,exclusiveMinimum=0"`
+	Currency      string                 `json:"currency"`
+	MerchantID    string                 `json:"merchant_id"`
+	CustomerID    string                 `json:"customer_id"`
+	PaymentMethod string                 `json:"payment_method"`
+	Location      Location               `json:"location"`
+	DeviceInfo    DeviceInfo             `json:"device_info"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+
+	// TransactionType overrides the payment method as the transaction type,
+	// e.g. "refund" or "return"
+	TransactionType    string      `json:"transaction_type,omitempty" doc:"Overrides payment_method as the transaction type, e.g. refund"`
+	RefundDestination  string      `json:"refund_destination,omitempty" doc:"Card token, wallet or address a refund is sent to"`
+	Crypto             *CryptoInfo `json:"crypto,omitempty"`
+	AccountCreatedAt   time.Time   `json:"account_created_at,omitempty" doc:"When the customer account was opened"`
+	MerchantCountry    string      `json:"merchant_country,omitempty" doc:"Defaults to the country of the merchant profile"`
+	MCC                string      `json:"mcc,omitempty" doc:"Merchant category code; defaults to that of the merchant profile"`
+	MandateID          string      `json:"mandate_id,omitempty" doc:"Standing order or recurring payment mandate the payment belongs to"`
+	Destination        string      `json:"destination,omitempty" doc:"Payee account of a transfer or standing order"`
+	InstrumentID       string      `json:"instrument_id,omitempty" doc:"Token or hash of the card or other payment instrument, never the raw card number"`
+	BeneficiaryAddedAt time.Time   `json:"beneficiary_added_at,omitempty" doc:"When the customer added the destination as a beneficiary"`
+	IssuerCountry      string      `json:"issuer_country,omitempty" doc:"Country of the card issuer, e.g. from the BIN"`
+	CardBrand          string      `json:"card_brand,omitempty" doc:"Card network, e.g. visa or mastercard"`
+
+	// Clearing is set for ACH and SEPA transfers, sent with payment_method
+	// ach or sepa
+	Clearing *ClearingInfo `json:"clearing,omitempty"`
+
+	// Fee, Tax and Shipping break down the amount; Items are the basket
+	Fee      float64        `json:"fee,omitempty" openapi:"minimum=0" doc:"Part of the amount that is fees"`
+	Tax      float64        `json:"tax,omitempty" openapi:"minimum=0" doc:"Part of the amount that is tax"`
+	Shipping float64        `json:"shipping,omitempty" openapi:"minimum=0" doc:"Part of the amount that is shipping"`
+	Items    []LineItemInfo `json:"items,omitempty" openapi:"maxItems=500" doc:"Line items of the basket"`
+
+	BillingAddress  *AddressInfo `json:"billing_address,omitempty"`
+	ShippingAddress *AddressInfo `json:"shipping_address,omitempty" doc:"Where the goods are sent, matched against FREIGHT_FORWARDERS_FILE"`
+
+	// Splits are the sub-merchant legs of a marketplace payment
+	Splits []SplitInfo `json:"splits,omitempty" openapi:"maxItems=100" doc:"Sub-merchant legs of a marketplace payment, each assessed on its own"`
+}
+
+type CryptoInfo struct {
+	WalletAddress string `json:"wallet_address" openapi:"required"`
+	Chain         string `json:"chain" openapi:"required"`
+	Exchange      string `json:"exchange,omitempty"`
+}
+
+type ClearingInfo struct {
+	AccountHash    string    `json:"account_hash" openapi:"required,minLength=1" doc:"Hash of the payee IBAN, or of its routing and account numbers; never the raw numbers"`
+	Scheme         string    `json:"scheme,omitempty" doc:"SEPA scheme (SCT, SCT_INST, SDD_CORE, SDD_B2B) or ACH SEC code (PPD, CCD, WEB)"`
+	SettlementDate time.Time `json:"settlement_date,omitempty" doc:"Requested settlement date, the submission day when unset"`
 }
 
 type Location struct {
@@ -39,6 +210,8 @@ type Location struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	IPAddress string  `json:"ip_address"`
+	IPCountry string  `json:"ip_country,omitempty"`
+	ASN       uint32  `json:"asn,omitempty" doc:"Autonomous system announcing the IP address, looked up from ASN_TABLE_FILE when not sent"`
 }
 
 type DeviceInfo struct {
@@ -49,55 +222,371 @@ type DeviceInfo struct {
 }
 
 type FraudResponse struct {
-	TransactionID string                 `json:"transaction_id"`
-	RiskScore     float64                `json:"risk_score"`
-	Decision      string                 `json:"decision"` // APPROVE, DECLINE, REVIEW
-	Reasons       []string               `json:"reasons,omitempty"`
-	Confidence    float64                `json:"confidence"`
-	ProcessingTime string                `json:"processing_time"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	TransactionID  string                   `json:"transaction_id"`
+	RiskScore      float64                  `json:"risk_score"`
+	Decision       string                   `json:"decision"` // APPROVE, DECLINE, SOFT_DECLINE, REVIEW
+	Retry          string                   `json:"retry,omitempty" doc:"How to retry a SOFT_DECLINE: retry_with_3ds or retry_after_step_up"`
+	Reasons        []string                 `json:"reasons,omitempty"`
+	ReasonCodes    []string                 `json:"reason_codes,omitempty"`
+	Confidence     float64                  `json:"confidence"`
+	ExpiresAt      time.Time                `json:"expires_at" doc:"Captures after this time must call /fraud/revalidate first"`
+	ProcessingTime string                   `json:"processing_time"`
+	Metadata       map[string]interface{}   `json:"metadata,omitempty"`
+	Features       map[string]float64       `json:"features,omitempty" doc:"Model feature values; verbosity=full only"`
+	Entities       []EntityLink             `json:"entities,omitempty" doc:"Links to the entities of the transaction; verbosity=full only"`
+	Splits         []SplitResult            `json:"splits,omitempty" doc:"Decisions on the legs of a split payment; the decision is no more lenient than any of them"`
+	Explanation    *ml.Explanation          `json:"explanation,omitempty" doc:"Features that moved the ML score most, all of them at verbosity=full"`
+	Counterfactual *decision.Counterfactual `json:"counterfactual,omitempty" doc:"Fewest score components without which the decision would have been more lenient; verbosity=full only"`
+}
+
+type RuleRequest struct {
+	ID          string  `json:"id" openapi:"required,minLength=1"`
+	Name        string  `json:"name"`
+	Description string  `json:"description" doc:"Reason reported when the rule matches"`
+	Expression  string  `json:"expression" openapi:"required,minLength=1" doc:"Rule expression, e.g. tx.amount > 3 * profile(tx.account_id).avg_amount"`
+	Score       float64 `json:"score" openapi:"exclusiveMinimum=0"`
+	Action      string  `json:"action"`
+}
+
+type RuleInfo struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Expression  string  `json:"expression,omitempty"`
+	Score       float64 `json:"score"`
+	Action      string  `json:"action"`
+	// Health is set once the rule condition panicked or overran its budget
+	Health *detector.RuleHealth `json:"health,omitempty"`
 }
 
 type BatchRequest struct {
-	Transactions []TransactionRequest `json:"transactions"`
+	Transactions []TransactionRequest `json:"transactions" openapi:"required,minItems=1,maxItems=1000"`
 }
 
 type BatchResponse struct {
 	Results []FraudResponse `json:"results"`
+	Errors  []BatchError    `json:"errors,omitempty" doc:"Transactions not analyzed, answered with a 207"`
 	Summary BatchSummary    `json:"summary"`
 }
 
 type BatchSummary struct {
-	Total         int     `json:"total"`
-	Approved      int     `json:"approved"`
-	Declined      int     `json:"declined"`
-	RequireReview int     `json:"require_review"`
-	AvgRiskScore  float64 `json:"avg_risk_score"`
-	ProcessingTime string `json:"processing_time"`
+	Total          int     `json:"total"`
+	Approved       int     `json:"approved"`
+	Declined       int     `json:"declined"`
+	SoftDeclined   int     `json:"soft_declined"`
+	RequireReview  int     `json:"require_review"`
+	Failed         int     `json:"failed" doc:"Transactions not analyzed"`
+	AvgRiskScore   float64 `json:"avg_risk_score" doc:"Of the analyzed transactions"`
+	ProcessingTime string  `json:"processing_time"`
 }
 
 func main() {
 	port := getEnv("PORT", "8080")
 
 	// Initialize fraud detection components
-	fraudDetector := detector.NewFraudDetector()
+	detectorConfig := detector.DefaultConfig()
+	detectorConfig.Quarantine = ruleQuarantineConfig()
+	detectorConfig.Basket = basketConfig()
+	detectorConfig.Address = detector.DefaultAddressConfig()
+	detectorConfig.Address.DistanceKm = getEnvFloat("ADDRESS_DISTANCE_KM", detectorConfig.Address.DistanceKm)
+	detectorConfig.Geo.ClockSkew = getEnvDuration("GEO_CLOCK_SKEW", detector.DefaultGeoConfig().ClockSkew)
+	detectorConfig.Amounts = detector.DefaultAmountPatternConfig()
+	if path := os.Getenv("CURRENCY_AMOUNTS_FILE"); path != "" {
+		currencies, err := detector.LoadCurrencyAmountsFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load currency amounts: %v", err)
+		}
+		detectorConfig.Amounts = detectorConfig.Amounts.WithCurrencies(currencies)
+		log.Printf("Loaded amount patterns of %d currencies", len(currencies))
+	}
+	fraudDetector := detector.NewFraudDetectorWithConfig(detectorConfig)
 	mlEngine := ml.NewMLEngine()
+	mlEngine.Features().SetBudget(getEnvDuration("ML_FEATURE_BUDGET", 0))
+	artifacts := newModelArtifacts()
+	loadActiveModel(artifacts, mlEngine)
+	enableOnlineLearning(mlEngine)
+
+	var addressRisk *detector.AddressRiskList
+	if path := os.Getenv("CRYPTO_ADDRESS_RISK_FILE"); path != "" {
+		list, err := detector.LoadAddressRiskListFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load crypto address risk list: %v", err)
+		}
+		fraudDetector.SetAddressRiskList(list)
+		addressRisk = list
+		log.Printf("Loaded %d flagged crypto addresses", list.Size())
+	}
+
+	if path := os.Getenv("FREIGHT_FORWARDERS_FILE"); path != "" {
+		list, err := detector.LoadForwarderListFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load freight forwarder list: %v", err)
+		}
+		fraudDetector.SetForwarderList(list)
+		log.Printf("Loaded %d freight forwarder addresses", list.Size())
+	}
+
+	var asns *detector.ASNTable
+	if path := os.Getenv("ASN_TABLE_FILE"); path != "" {
+		table, err := detector.LoadASNTableFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load ASN table: %v", err)
+		}
+		fraudDetector.SetASNTable(table)
+		asns = table
+		log.Printf("Loaded %d ASN prefixes", table.Size())
+	}
+
+	lists := detector.NewLists()
+	if path := os.Getenv("RULE_LISTS_FILE"); path != "" {
+		loaded, err := detector.LoadListsFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load rule lists: %v", err)
+		}
+		fraudDetector.SetLists(loaded)
+		lists = loaded
+		log.Printf("Loaded rule lists: %v", loaded.Names())
+	}
+
+	merchants := detector.NewMerchantRegistry()
+	if path := os.Getenv("MERCHANT_PROFILES_FILE"); path != "" {
+		registry, err := detector.LoadMerchantRegistryFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load merchant profiles: %v", err)
+		}
+		merchants = registry
+		log.Printf("Loaded %d merchant profiles", registry.Size())
+	}
+	fraudDetector.SetMerchantRegistry(merchants)
+
+	calendar := detector.NewCalendar()
+	if path := os.Getenv("CALENDAR_FILE"); path != "" {
+		loaded, err := detector.LoadCalendarFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load calendar: %v", err)
+		}
+		calendar = loaded
+		log.Printf("Loaded %d calendar events", len(loaded.Events()))
+	}
+	fraudDetector.SetCalendar(calendar)
+
+	amountLimits := detector.NewAmountLimits()
+	if path := os.Getenv("AMOUNT_LIMITS_FILE"); path != "" {
+		loaded, err := detector.LoadAmountLimitsFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load amount limits: %v", err)
+		}
+		amountLimits = loaded
+		log.Printf("Loaded %d amount limits", len(loaded.Limits()))
+	}
+	fraudDetector.SetAmountLimits(amountLimits)
+
+	if path := os.Getenv("CORRIDOR_RISK_FILE"); path != "" {
+		matrix, err := detector.LoadCorridorMatrixFile(path)
+		if err == nil {
+			err = fraudDetector.SetCorridorMatrix(matrix)
+		}
+		if err != nil {
+			log.Fatalf("Failed to load corridor risk matrix: %v", err)
+		}
+		log.Printf("Loaded %d corridor risks", len(matrix))
+	}
+
+	if path := os.Getenv("PROMO_CAMPAIGNS_FILE"); path != "" {
+		campaigns, err := detector.LoadCampaignsFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load promotion campaigns: %v", err)
+		}
+		fraudDetector.SetPromoCampaigns(campaigns)
+		log.Printf("Loaded limits of %d promotion campaigns", len(campaigns))
+	}
+
+	overrides := config.NewStore(config.Hierarchy{})
+	if path := os.Getenv("CONFIG_LAYERS_FILE"); path != "" {
+		hierarchy, err := config.LoadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load configuration layers: %v", err)
+		}
+		overrides = config.NewStore(hierarchy)
+		log.Printf("Loaded configuration layers: %d tenants, %d merchants", len(hierarchy.Tenants), len(hierarchy.Merchants))
+	}
+	fraudDetector.SetOverrideResolver(overrides)
+	features := featureFlags()
+	fraudDetector.SetFeatureGate(featureGate{registry: features, layers: overrides})
+
+	var scoringModules []*wasm.Module
+	if dir := os.Getenv("SCORER_MODULES_DIR"); dir != "" {
+		modules, err := wasm.LoadDir(context.Background(), dir, wasm.Limits{
+			Timeout:     getEnvDuration("SCORER_MODULE_TIMEOUT", 20*time.Millisecond),
+			MemoryBytes: uint32(getEnvInt("SCORER_MODULE_MEMORY_MB", 16)) << 20,
+			Instances:   getEnvInt("SCORER_MODULE_INSTANCES", 4),
+		})
+		if err != nil {
+			log.Fatalf("Failed to load scoring modules: %v", err)
+		}
+		names := make([]string, 0, len(modules))
+		for _, module := range modules {
+			fraudDetector.AddExternalScorer(module)
+			names = append(names, module.Name())
+		}
+		scoringModules = modules
+		log.Printf("Loaded %d scoring modules: %v", len(modules), names)
+	}
+
+	// Profiles keep the slot of each region from the restored state on
+	if region := os.Getenv("REPLICATION_REGION"); region != "" {
+		fraudDetector.SetRegion(region)
+	}
+	var stateLogs detector.StateLogs
+	var stateStore *persist.Store
+	stopPersistence := make(chan struct{})
+	if dir := os.Getenv("STATE_DIR"); dir != "" {
+		// With STATE_WARM_ACCOUNTS, only the accounts most recently active are
+		// restored before serving and the others right after
+		store, replayed, err := persist.OpenWarm(dir, fraudDetector, getEnvInt("STATE_WARM_ACCOUNTS", 0))
+		if err != nil {
+			log.Fatalf("Failed to restore detector state: %v", err)
+		}
+		stateLogs = append(stateLogs, store)
+		go store.Run(fraudDetector, getEnvDuration("STATE_SYNC_INTERVAL", time.Second), getEnvDuration("STATE_SNAPSHOT_INTERVAL", 5*time.Minute), stopPersistence)
+		stateStore = store
+		log.Printf("Restored detector state from %s, replayed %d logged updates", dir, replayed)
+		if cold := store.Cold(); cold > 0 {
+			go func() {
+				start := time.Now()
+				restored := store.RestoreCold()
+				log.Printf("Restored %d more accounts in the background in %s", restored, time.Since(start).Round(time.Millisecond))
+			}()
+			log.Printf("Restoring %d less active accounts in the background", cold)
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	engineMetrics := metrics.NewEngine(registry)
+	fraudDetector.SetRuleObserver(engineMetrics)
+	fraudDetector.SetQuarantineObserver(engineMetrics)
+	mlEngine.SetPredictionObserver(engineMetrics)
+
+	auditStore, sealedAudit := auditStorage(overrides)
+	injector := chaosInjector()
+	if injector != nil {
+		mlEngine.SetFaultHook(injector.MLFault)
+		auditStore = chaos.WrapStore(auditStore, injector)
+	}
+	bufferedAudit := auditWriter(auditStore, engineMetrics)
+	if bufferedAudit != nil {
+		auditStore = bufferedAudit
+	}
 
 	server := &Server{
 		fraudDetector: fraudDetector,
 		mlEngine:      mlEngine,
+		scorer:        decision.NewScorer(fraudDetector, mlEngine, decision.DefaultPolicy()),
+		auditStore:    auditStore,
+		sealedAudit:   sealedAudit,
+		configs:       decision.NewRegistry(decision.DefaultConfiguration()),
+		addressRisk:   addressRisk,
+		asns:          asns,
+		amounts:       detectorConfig.Amounts,
+		merchants:     merchants,
+		calendar:      calendar,
+		amountLimits:  amountLimits,
+		lists:         lists,
+		chaos:         injector,
+		webhook:       decisionWebhook(),
+		metrics:       engineMetrics,
+		stats:         stats.NewCollector(),
+		analyzeMode:   getEnv("ANALYZE_MODE", modeFull),
+		bundleKey:     []byte(os.Getenv("BUNDLE_SIGNING_KEY")),
+		bundleSource:  getEnv("BUNDLE_ENVIRONMENT", "local"),
+		bundles:       bundle.NewHistory(getEnvInt("BUNDLE_HISTORY_SIZE", 10)),
+		ruleHistory:   ruleset.NewHistory(),
+		timeline:      bundle.NewTimeline(getEnvInt("AS_OF_HISTORY_SIZE", 1000)),
+		asOfWindow:    getEnvDuration("AS_OF_STATE_WINDOW", 24*time.Hour),
+		overrides:     overrides,
+		features:      features,
+		decisionTTL:   getEnvDuration("DECISION_TTL", time.Hour),
+		recorder:      recorder(),
+		verbosity: verbosity{
+			Level:           getEnv("RESPONSE_VERBOSITY", verbosityStandard),
+			MaxReasons:      getEnvInt("RESPONSE_MAX_REASONS", 0),
+			MaxAttributions: getEnvInt("RESPONSE_MAX_ATTRIBUTIONS", 5),
+		},
+		brandings:        responseBrandings(),
+		merchantWebhooks: merchantWebhooks(),
+		gateways:         gatewayDispatcher(),
+		fairness:         fairnessMonitor(auditStore),
+		reports:          reportGenerator(auditStore),
+		jobs:             jobQueue(),
+		nearMisses:       nearMissDataset(),
+		annotations:      annotationStore(),
+		reviews:          reviewQueue(overrides, engineMetrics),
+		throttle:         merchantLimiter(),
+		quotas:           quotaMeter(),
+		artifacts:        artifacts,
+		ruleApprovals:    ruleset.NewApprovals(),
+		approvalNotifier: ruleApprovalNotifier(),
+		sandbox:          sandboxScorer(),
+	}
+	server.partition = partitioner()
+	server.replicationSecret = os.Getenv("REPLICATION_SECRET")
+	server.batchAsyncThreshold = getEnvInt("BATCH_ASYNC_THRESHOLD", 100)
+	server.network, server.networkAlerts = server.networkCorrelator()
+	server.scenarios, server.scenarioAlerts = scenarioAlerting()
+	server.replication = server.replicationNode()
+	stopReplication := make(chan struct{})
+	replicationStopped := make(chan struct{})
+	if server.replication != nil {
+		stateLogs = append(stateLogs, server.replication)
+		go func() {
+			server.replication.Run(stopReplication)
+			close(replicationStopped)
+		}()
+	} else {
+		close(replicationStopped)
+	}
+	if len(stateLogs) > 0 {
+		fraudDetector.SetStateLog(stateLogs)
+	}
+	server.scorer.SetPolicyResolver(overrides)
+	server.recordVersion()
+	server.ruleHistory.Record(ruleset.FromRules(fraudDetector.GetActiveRules()), "system", "startup", time.Now())
+	if server.analyzeMode != modeFull && server.analyzeMode != modeTwoPhase {
+		log.Fatalf("Invalid ANALYZE_MODE %q: must be %s or %s", server.analyzeMode, modeFull, modeTwoPhase)
 	}
+	if err := server.verbosity.validate(); err != nil {
+		log.Fatalf("Invalid RESPONSE_VERBOSITY or RESPONSE_MAX_REASONS: %v", err)
+	}
+	server.startFullScoring(getEnvInt("FULL_SCORING_WORKERS", 4), getEnvInt("FULL_SCORING_QUEUE_SIZE", 1000))
+	stopFairness := make(chan struct{})
+	go server.fairness.Start(getEnvDuration("FAIRNESS_INTERVAL", time.Hour), stopFairness)
+	stopReports := make(chan struct{})
+	go server.reports.Start(stopReports)
+	stopReviews := make(chan struct{})
+	stopQuotas := make(chan struct{})
+	quotasStopped := make(chan struct{})
+	go func() {
+		if server.quotas != nil {
+			server.quotas.Start(getEnvDuration("QUOTA_USAGE_SAVE_INTERVAL", time.Minute), stopQuotas)
+		}
+		close(quotasStopped)
+	}()
+	go server.reviews.Start(getEnvDuration("REVIEW_SLA_CHECK_INTERVAL", time.Minute), server.publishReviews, stopReviews)
+	stopScenarios := make(chan struct{})
+	go server.scenarios.Start(getEnvDuration("SCENARIO_EVALUATION_INTERVAL", 30*time.Second), server.notifyScenarios, stopScenarios)
+	server.registerJobs()
+	stopJobs := make(chan struct{})
+	jobsStopped := make(chan struct{})
+	go func() {
+		server.jobs.Start(stopJobs)
+		close(jobsStopped)
+	}()
 
-	// Setup HTTP routes
-	http.HandleFunc("/health", server.healthHandler)
-	http.HandleFunc("/fraud/analyze", server.analyzeTransactionHandler)
-	http.HandleFunc("/fraud/batch", server.batchAnalysisHandler)
-	http.HandleFunc("/fraud/train", server.trainModelHandler)
-	http.HandleFunc("/fraud/stats", server.statisticsHandler)
-	http.HandleFunc("/fraud/rules", server.rulesHandler)
+	spec := apiDocument()
 
 	srv := &http.Server{
 		Addr:         ":" + port,
+		Handler:      server.routes(spec, registry),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 	}
@@ -121,6 +610,55 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
+	server.stopFullScoring()
+	close(stopFairness)
+	close(stopReports)
+	close(stopReviews)
+	close(stopScenarios)
+	// The usage of the last analyses is saved for billing
+	close(stopQuotas)
+	<-quotasStopped
+	// Running jobs are interrupted and queued again for the next start
+	close(stopJobs)
+	<-jobsStopped
+	// The last changes reach the other regions before the state is saved
+	close(stopReplication)
+	<-replicationStopped
+	if stateStore != nil {
+		close(stopPersistence)
+		if err := stateStore.Checkpoint(fraudDetector); err != nil {
+			log.Printf("Final state snapshot failed: %v", err)
+		}
+		if err := stateStore.Close(); err != nil {
+			log.Printf("Closing the state log failed: %v", err)
+		}
+	}
+	for _, module := range scoringModules {
+		module.Close(context.Background())
+	}
+	if server.webhook != nil {
+		server.webhook.Close()
+	}
+	server.merchantWebhooks.Close()
+	if server.networkAlerts != nil {
+		server.networkAlerts.Close()
+	}
+	if server.scenarioAlerts != nil {
+		server.scenarioAlerts.Close()
+	}
+	if server.gateways != nil {
+		server.gateways.Close()
+	}
+	if err := server.nearMisses.Close(); err != nil {
+		log.Printf("Closing the near-miss file failed: %v", err)
+	}
+	if err := server.annotations.Close(); err != nil {
+		log.Printf("Closing the annotation file failed: %v", err)
+	}
+	// The queued decisions are written before exit
+	if bufferedAudit != nil {
+		bufferedAudit.Close()
+	}
 
 	log.Println("Server stopped")
 }
@@ -129,198 +667,195 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "healthy",
+		"status":          "healthy",
 		"ml_engine_ready": s.mlEngine.IsReady(),
 		"detector_active": true,
-		"timestamp": time.Now(),
+		"timestamp":       time.Now(),
 	}); err != nil {
 		log.Printf("Error encoding health response: %v", err)
 	}
 }
 
 func (s *Server) analyzeTransactionHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req TransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	if req.ID == "" {
-		http.Error(w, "transaction ID is required", http.StatusBadRequest)
+		apierror.WriteCode(w, http.StatusBadRequest, apierror.InvalidTransaction, "transaction ID is required")
 		return
 	}
 
 	if req.Amount <= 0 {
-		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		apierror.WriteCode(w, http.StatusBadRequest, apierror.InvalidTransaction, "amount must be positive")
+		return
+	}
+
+	if err := validateSplits(req); err != nil {
+		apierror.WriteCode(w, http.StatusBadRequest, apierror.InvalidTransaction, err.Error())
+		return
+	}
+	if err := validateBasket(req); err != nil {
+		apierror.WriteCode(w, http.StatusBadRequest, apierror.InvalidTransaction, err.Error())
 		return
 	}
 
 	start := time.Now()
+	v, err := s.responseVerbosity(r)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sandboxCaller(r) {
+		s.analyzeSandbox(w, req, v, s.responseBranding(r), start)
+		return
+	}
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		s.analyzeAsOf(w, req, asOf, v, s.responseBranding(r), start)
+		return
+	}
+
+	mode := s.analyzeMode
+	if value := r.URL.Query().Get("mode"); value != "" {
+		mode = value
+	}
+	if mode != modeFull && mode != modeTwoPhase {
+		apierror.Write(w, "mode must be full or two_phase", http.StatusBadRequest)
+		return
+	}
 
 	// Convert to internal transaction format
 	transaction := convertToInternalTransaction(req)
-
-	// Analyze transaction for fraud
-	result, err := s.fraudDetector.AnalyzeTransaction(transaction)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !s.allowMerchants(w, transaction) || !s.allowQuota(w, r, 1) {
 		return
 	}
 
-	// Get ML prediction
-	mlScore, confidence, err := s.mlEngine.PredictFraud(transaction)
-	if err != nil {
-		log.Printf("ML prediction failed: %v", err)
-		mlScore = result.Score // Fallback to rule-based score
-		confidence = 0.5
+	// Analyze transaction for fraud and decide. In two-phase mode the fast
+	// pre-score is returned and the full analysis completes in the background.
+	phase := phaseFull
+	var outcome *decision.Outcome
+	if mode == modeTwoPhase {
+		outcome, err = s.scorer.PreScore(transaction)
+		if err == nil {
+			if s.enqueueFullScore(transaction) {
+				phase = phasePreAuth
+			} else {
+				log.Printf("Full scoring queue is full, analyzing %s synchronously", transaction.ID)
+				outcome, err = s.score(transaction)
+			}
+		}
+	} else {
+		outcome, err = s.score(transaction)
 	}
-
-	// Combine rule-based and ML scores
-	finalScore := (result.Score + mlScore) / 2
-	
-	// Determine decision based on final score
-	decision := "APPROVE"
-	if finalScore >= 0.8 {
-		decision = "DECLINE"
-	} else if finalScore >= 0.5 {
-		decision = "REVIEW"
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	result := outcome.Detection
 
 	response := FraudResponse{
 		TransactionID:  req.ID,
-		RiskScore:      finalScore,
-		Decision:       decision,
+		RiskScore:      outcome.FinalScore,
+		Decision:       outcome.Decision,
+		Retry:          outcome.Retry,
 		Reasons:        result.Reasons,
-		Confidence:     confidence,
+		ReasonCodes:    result.ReasonCodes,
+		Confidence:     outcome.Confidence,
+		ExpiresAt:      s.expiresAt(outcome),
 		ProcessingTime: time.Since(start).String(),
+		Splits:         splitResults(outcome),
+		Explanation:    outcome.Explanation,
 		Metadata: map[string]interface{}{
 			"rule_score": result.Score,
-			"ml_score":   mlScore,
-			"version":    "v1.0.0",
+			"ml_score":   outcome.MLScore,
+			"version":    engineVersion,
+			"phase":      phase,
 		},
 	}
+	if result.MuleScore > 0 {
+		response.Metadata["mule_score"] = result.MuleScore
+	}
+	if outcome.FeatureTier != "" {
+		response.Metadata["feature_tier"] = outcome.FeatureTier
+	}
+	if outcome.ConfidenceGated {
+		response.Metadata["confidence_gated"] = true
+	}
+	addLimitMetadata(&response, result)
+	if v.Level == verbosityFull {
+		response.Counterfactual = s.scorer.Counterfactual(transaction, outcome)
+	}
+	s.applyObserveOnly(transaction.MerchantID, &response)
+	v.apply(&response, transaction)
+	s.responseBranding(r).apply(&response)
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := json.NewEncoder(w).Encode(v.body(response)); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
 }
 
 func (s *Server) batchAnalysisHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req BatchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	if len(req.Transactions) == 0 {
-		http.Error(w, "transactions array cannot be empty", http.StatusBadRequest)
+		apierror.Write(w, "transactions array cannot be empty", http.StatusBadRequest)
 		return
 	}
 
 	if len(req.Transactions) > 1000 {
-		http.Error(w, "maximum 1000 transactions per batch", http.StatusBadRequest)
+		apierror.Write(w, "maximum 1000 transactions per batch", http.StatusBadRequest)
 		return
 	}
 
-	start := time.Now()
-	results := make([]FraudResponse, len(req.Transactions))
-	summary := BatchSummary{}
-
-	for i, txn := range req.Transactions {
-		// Convert to internal format
-		transaction := convertToInternalTransaction(txn)
+	v, err := s.responseVerbosity(r)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	branding := s.responseBranding(r)
 
-		// Analyze transaction
-		result, err := s.fraudDetector.AnalyzeTransaction(transaction)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Transaction %s analysis failed: %v", txn.ID, err), http.StatusInternalServerError)
+	// Transactions failing validation are reported in the errors of a 207
+	// while the others are analyzed
+	transactions, errs := prepareBatch(req)
+	sandbox := sandboxCaller(r)
+	if !sandbox {
+		valid := analyzed(transactions)
+		if !s.allowMerchants(w, valid...) || !s.allowQuota(w, r, len(valid)) {
 			return
 		}
-
-		// Get ML prediction
-		mlScore, confidence, _ := s.mlEngine.PredictFraud(transaction)
-		finalScore := (result.Score + mlScore) / 2
-
-		// Determine decision
-		decision := "APPROVE"
-		if finalScore >= 0.8 {
-			decision = "DECLINE"
-			summary.Declined++
-		} else if finalScore >= 0.5 {
-			decision = "REVIEW"
-			summary.RequireReview++
-		} else {
-			summary.Approved++
-		}
-
-		results[i] = FraudResponse{
-			TransactionID:  txn.ID,
-			RiskScore:      finalScore,
-			Decision:       decision,
-			Reasons:        result.Reasons,
-			Confidence:     confidence,
-			ProcessingTime: "batch",
+		// Large batches may be analyzed in the background
+		if r.URL.Query().Get("async") == "true" && len(req.Transactions) > s.batchAsyncThreshold {
+			s.enqueueBatch(w, r, req, v, branding)
+			return
 		}
-
-		summary.AvgRiskScore += finalScore
-	}
-
-	summary.Total = len(req.Transactions)
-	summary.AvgRiskScore /= float64(summary.Total)
-	summary.ProcessingTime = time.Since(start).String()
-
-	response := BatchResponse{
-		Results: results,
-		Summary: summary,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response: %v", err)
-	}
-}
-
-func (s *Server) trainModelHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Trigger ML model retraining
-	err := s.mlEngine.TrainModel()
+	response, err := s.decideBatch(req, transactions, errs, v, branding, sandbox)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	writeBatch(w, v, response)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "training_started",
-		"timestamp": time.Now(),
-	}); err != nil {
-		log.Printf("Error encoding training response: %v", err)
-	}
+func (s *Server) trainModelHandler(w http.ResponseWriter, r *http.Request) {
+	// Queue ML model retraining as a background job
+	s.enqueueJob(w, jobTrain, nil)
 }
 
+// statisticsHandler serves the detector settings and a snapshot of the
+// decisions counted since startup
 func (s *Server) statisticsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	stats := s.fraudDetector.GetStatistics()
-	
+	stats["decisions"] = s.stats.Snapshot()
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(stats); err != nil {
 		log.Printf("Error encoding stats: %v", err)
@@ -331,24 +866,102 @@ func (s *Server) rulesHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		// Return rule summary without function pointers
+		rules := s.fraudDetector.GetActiveRules()
+		health := make(map[string]*detector.RuleHealth)
+		for _, record := range s.fraudDetector.GetRuleHealth() {
+			health[record.RuleID] = &record
+		}
+		infos := make([]RuleInfo, len(rules))
+		for i, rule := range rules {
+			infos[i] = RuleInfo{
+				ID:          rule.ID,
+				Name:        rule.Name,
+				Description: rule.Description,
+				Expression:  rule.Expression,
+				Score:       rule.Score,
+				Action:      rule.Action,
+				Health:      health[rule.ID],
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"total_rules": len(s.fraudDetector.GetActiveRules()),
-			"status": "active",
+			"total_rules": len(rules),
+			"status":      "active",
+			"rules":       infos,
 		}); err != nil {
 			log.Printf("Error encoding rules summary: %v", err)
 		}
 	case http.MethodPost:
-		// Add new rule (implementation would depend on rule structure)
+		var req RuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		rule := detector.Rule{
+			ID:          req.ID,
+			Name:        req.Name,
+			Description: req.Description,
+			Expression:  req.Expression,
+			Score:       req.Score,
+			Action:      req.Action,
+		}
+		if rule.Description == "" {
+			rule.Description = "Rule " + rule.ID + " matched"
+		}
+		s.rulesMu.Lock()
+		defer s.rulesMu.Unlock()
+		spec := ruleset.Spec{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Description: rule.Description,
+			Expression:  rule.Expression,
+			Score:       rule.Score,
+			Action:      rule.Action,
+		}
+		if s.submitRuleChange(w, r, ruleset.Proposal{Source: "api", Set: []ruleset.Spec{spec}}) {
+			return
+		}
+		if err := s.fraudDetector.AddExpressionRule(rule); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.recordRuleChanges(r, "api")
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(map[string]string{"status": "rule_added"}); err != nil {
 			log.Printf("Error encoding rule added response: %v", err)
 		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ruleQuarantineHandler takes a rule out of quarantine, forgetting how it
+// misbehaved
+func (s *Server) ruleQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.PathValue("id")
+	record, exists := s.fraudDetector.ReleaseRule(ruleID)
+	if !exists {
+		apierror.Write(w, "rule has not misbehaved: "+ruleID, http.StatusNotFound)
+		return
+	}
+	log.Printf("Rule %s released from quarantine", ruleID)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(record); err != nil {
+		log.Printf("Error encoding rule health: %v", err)
 	}
 }
 
+// ruleQuarantineConfig reads the RULE_* quarantine settings
+func ruleQuarantineConfig() detector.QuarantineConfig {
+	config := detector.DefaultQuarantineConfig()
+	config.PanicLimit = getEnvInt("RULE_PANIC_LIMIT", config.PanicLimit)
+	config.Budget = getEnvDuration("RULE_BUDGET", config.Budget)
+	config.OverrunLimit = getEnvInt("RULE_OVERRUN_LIMIT", config.OverrunLimit)
+	config.OverrunWindow = getEnvDuration("RULE_OVERRUN_WINDOW", config.OverrunWindow)
+	return config
+}
+
 func convertToInternalTransaction(req TransactionRequest) *detector.Transaction {
 	transaction := &detector.Transaction{
 		ID:         req.ID,
@@ -366,6 +979,48 @@ func convertToInternalTransaction(req TransactionRequest) *detector.Transaction
 		Type:      req.PaymentMethod,
 		DeviceID:  req.DeviceInfo.DeviceID,
 		IPAddress: req.Location.IPAddress,
+
+		RefundDestination:  req.RefundDestination,
+		AccountCreatedAt:   req.AccountCreatedAt,
+		MandateID:          req.MandateID,
+		Destination:        req.Destination,
+		InstrumentID:       req.InstrumentID,
+		BeneficiaryAddedAt: req.BeneficiaryAddedAt,
+		MerchantCountry:    req.MerchantCountry,
+		MCC:                req.MCC,
+		IPCountry:          req.Location.IPCountry,
+		ASN:                req.Location.ASN,
+		IssuerCountry:      req.IssuerCountry,
+		CardBrand:          req.CardBrand,
+	}
+
+	if req.TransactionType != "" {
+		transaction.Type = req.TransactionType
+	}
+	if campaignID, ok := req.Metadata["campaign_id"].(string); ok {
+		transaction.CampaignID = campaignID
+	}
+
+	if req.Crypto != nil {
+		transaction.Crypto = &detector.CryptoDetails{
+			WalletAddress: req.Crypto.WalletAddress,
+			Chain:         req.Crypto.Chain,
+			Exchange:      req.Crypto.Exchange,
+		}
+	}
+	transaction.Splits = convertSplits(req.Splits)
+	transaction.Fee = req.Fee
+	transaction.Tax = req.Tax
+	transaction.Shipping = req.Shipping
+	transaction.Items = convertItems(req.Items)
+	transaction.BillingAddress = convertAddress(req.BillingAddress)
+	transaction.ShippingAddress = convertAddress(req.ShippingAddress)
+	if req.Clearing != nil {
+		transaction.Clearing = &detector.ClearingDetails{
+			AccountHash:    req.Clearing.AccountHash,
+			Scheme:         req.Clearing.Scheme,
+			SettlementDate: req.Clearing.SettlementDate,
+		}
 	}
 
 	// Set timestamp if not provided
@@ -376,9 +1031,139 @@ func convertToInternalTransaction(req TransactionRequest) *detector.Transaction
 	return transaction
 }
 
+// score runs the scoring pipeline on a transaction and audits the decision.
+// Concurrent analyses of the same transaction, such as duplicate webhook
+// deliveries, share one scoring so that velocity and profiles count it once;
+// the transaction is then replaced with the one scored.
+func (s *Server) score(transaction *detector.Transaction) (*decision.Outcome, error) {
+	scored, _, err := s.inflight.Do(transaction.MerchantID+"/"+transaction.ID, func() (scoredTransaction, error) {
+		start := time.Now()
+		outcome, err := s.scorer.Score(transaction)
+		if err != nil {
+			return scoredTransaction{}, err
+		}
+		s.applyMerchantFriction(transaction, outcome)
+		s.applyNetworkEscalation(transaction, outcome)
+		s.record(transaction, outcome, time.Since(start))
+		return scoredTransaction{transaction: transaction, outcome: outcome}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if scored.transaction != transaction {
+		log.Printf("Analysis of %s coalesced onto the one in flight", transaction.ID)
+		s.metrics.ObserveCoalesced()
+		*transaction = *scored.transaction
+	}
+	return scored.outcome, nil
+}
+
+// scoreBatch scores and audits a batch of transactions
+func (s *Server) scoreBatch(transactions []*detector.Transaction) ([]*decision.Outcome, error) {
+	start := time.Now()
+	outcomes, err := s.scorer.ScoreBatch(transactions)
+	if err != nil {
+		return nil, err
+	}
+	if len(outcomes) == 0 {
+		return outcomes, nil
+	}
+	// Metrics get the mean latency of the batch
+	elapsed := time.Since(start) / time.Duration(len(transactions))
+	for i, outcome := range outcomes {
+		s.applyMerchantFriction(transactions[i], outcome)
+		s.applyNetworkEscalation(transactions[i], outcome)
+		s.record(transactions[i], outcome, elapsed)
+	}
+	return outcomes, nil
+}
+
+// record logs ML failures, updates the decision metrics and saves the
+// decision to the audit store. Clean approvals are saved at the merchant's
+// audit sample rate; the metrics and the webhook still see every decision.
+func (s *Server) record(transaction *detector.Transaction, outcome *decision.Outcome, elapsed time.Duration) {
+	if outcome.MLError != nil {
+		log.Printf("ML prediction failed: %v", outcome.MLError)
+	}
+	s.metrics.ObserveDecision(outcome.Decision, s.mlEngine.ActiveVersion(), outcome.FinalScore, elapsed)
+	s.stats.Record(transaction.ID, outcome.Decision, outcome.FinalScore, outcome.Detection.ReasonCodes)
+	s.recordScenarios(transaction, outcome)
+
+	record := audit.Record{
+		Transaction: *transaction,
+		Decision:    outcome.Decision,
+		Retry:       outcome.Retry,
+		RiskScore:   outcome.FinalScore,
+		RuleScore:   outcome.Detection.Score,
+		MLScore:     outcome.MLScore,
+		Confidence:  outcome.Confidence,
+		Reasons:     outcome.Detection.Reasons,
+		ReasonCodes: outcome.Detection.ReasonCodes,
+		DecidedAt:   outcome.DecidedAt,
+		ExpiresAt:   s.expiresAt(outcome),
+		ObserveOnly: s.overrides.ObserveOnly(transaction.MerchantID),
+	}
+	rate := s.overrides.AuditSampleRate(transaction.MerchantID)
+	clean := record.Decision == decision.Approve && len(record.ReasonCodes) == 0
+	if clean && rate < 1 {
+		record.SampleRate = rate
+	}
+	if clean && !audit.Sampled(transaction.ID, rate) {
+		s.metrics.ObserveSampledOut()
+	} else if err := s.auditStore.Save(record); err != nil && !errors.Is(err, audit.ErrQueueFull) {
+		log.Printf("Failed to audit decision for %s: %v", transaction.ID, err)
+	}
+	s.recordNearMiss(transaction, outcome)
+	s.enqueueReview(record)
+	s.publish(record)
+}
+
+// publish sends the decision event of a record to the webhooks and the
+// payment gateways
+func (s *Server) publish(record audit.Record) {
+	transaction := &record.Transaction
+	event := decisionEvent(record)
+	if s.webhook != nil && !s.webhook.Send(event) {
+		log.Printf("Webhook queue is full, dropped the decision event of %s", transaction.ID)
+	}
+	if !s.merchantWebhooks.Send(transaction.MerchantID, event) {
+		log.Printf("Webhook queue of merchant %s is full, dropped the decision event of %s", transaction.MerchantID, transaction.ID)
+	}
+	// Observe-only decisions are not acted on
+	if s.gateways != nil && !record.ObserveOnly {
+		for _, name := range s.gateways.Send(event) {
+			log.Printf("Queue of gateway integration %s is full, dropped the decision of %s", name, transaction.ID)
+		}
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
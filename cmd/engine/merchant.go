@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// merchantPath prefixes the self-service API merchant credentials are
+// confined to
+const merchantPath = "/fraud/merchant/"
+
+type TrustedCustomersRequest struct {
+	Customers []string `json:"customers" doc:"Account IDs; replaces the whole list"`
+}
+
+type TrustedCustomersResponse struct {
+	MerchantID string   `json:"merchant_id"`
+	Customers  []string `json:"customers"`
+}
+
+type MerchantWebhookRequest struct {
+	URL           string `json:"url" openapi:"required,minLength=1"`
+	EncryptionKey string `json:"encryption_key,omitempty" doc:"PEM public key (RSA or EC P-256) to encrypt deliveries to as a JWE"`
+}
+
+type MerchantWebhookResponse struct {
+	MerchantID string `json:"merchant_id"`
+	URL        string `json:"url"`
+	Secret     string `json:"secret,omitempty" doc:"Signing secret for X-Fraud-Signature, only returned when the webhook is set"`
+	Encrypted  bool   `json:"encrypted,omitempty"`
+}
+
+type MerchantStatsResponse struct {
+	MerchantID string    `json:"merchant_id"`
+	Since      time.Time `json:"since"`
+	audit.Summary
+}
+
+// webhookDelivery returns the DECISION_WEBHOOK_* retry and queue settings
+func webhookDelivery() webhook.Config {
+	config := webhook.DefaultConfig()
+	config.MaxAttempts = getEnvInt("DECISION_WEBHOOK_MAX_ATTEMPTS", config.MaxAttempts)
+	config.QueueSize = getEnvInt("DECISION_WEBHOOK_QUEUE_SIZE", config.QueueSize)
+	config.LogSize = getEnvInt("DECISION_WEBHOOK_LOG_SIZE", config.LogSize)
+	return config
+}
+
+// merchantWebhooks returns the router of merchant webhooks, delivering with
+// the DECISION_WEBHOOK_* retry and queue settings
+func merchantWebhooks() *webhook.Router {
+	return webhook.NewRouter(webhookDelivery())
+}
+
+// merchantScope returns the merchant a request acts for: that of merchant
+// credentials, or the merchant_id parameter for other callers. The merchant
+// must have a configuration layer, within the tenant of the caller when the
+// caller has one.
+func (s *Server) merchantScope(w http.ResponseWriter, r *http.Request) (string, bool) {
+	merchantID := r.URL.Query().Get("merchant_id")
+	principal, authenticated := auth.FromContext(r.Context())
+	if authenticated && principal.Merchant != "" {
+		if merchantID != "" && merchantID != principal.Merchant {
+			apierror.Write(w, "Forbidden: merchant credentials only reach their own merchant", http.StatusForbidden)
+			return "", false
+		}
+		merchantID = principal.Merchant
+	}
+	if merchantID == "" {
+		apierror.Write(w, "merchant_id is required", http.StatusBadRequest)
+		return "", false
+	}
+
+	layer, exists := s.overrides.Merchant(merchantID)
+	if !exists {
+		apierror.Write(w, "unknown merchant: "+merchantID, http.StatusNotFound)
+		return "", false
+	}
+	if authenticated && principal.Tenant != "" && layer.Tenant != principal.Tenant {
+		apierror.Write(w, "Forbidden: merchant belongs to another tenant", http.StatusForbidden)
+		return "", false
+	}
+	return merchantID, true
+}
+
+// merchantTrustedCustomersHandler serves and replaces the accounts a
+// merchant trusts, kept as the trusted_customers list of its layer
+func (s *Server) merchantTrustedCustomersHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID, ok := s.merchantScope(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		layer, _ := s.overrides.Merchant(merchantID)
+		customers := layer.Lists[detector.TrustedCustomersList]
+		if customers == nil {
+			customers = []string{}
+		}
+		writeMerchant(w, TrustedCustomersResponse{MerchantID: merchantID, Customers: customers})
+	case http.MethodPut:
+		var req TrustedCustomersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Customers == nil {
+			req.Customers = []string{}
+		}
+		err := s.overrides.SetMerchantList(merchantID, detector.TrustedCustomersList, req.Customers)
+		if errors.Is(err, config.ErrUnknownMerchant) {
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.recordVersion()
+		log.Printf("Merchant %s trusts %d customers", merchantID, len(req.Customers))
+		writeMerchant(w, TrustedCustomersResponse{MerchantID: merchantID, Customers: req.Customers})
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// merchantWebhookHandler serves, sets and removes the webhook a merchant's
+// decision events are delivered to. Setting it returns a new signing
+// secret.
+func (s *Server) merchantWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID, ok := s.merchantScope(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		url, exists := s.merchantWebhooks.URL(merchantID)
+		if !exists {
+			apierror.Write(w, "no webhook for merchant: "+merchantID, http.StatusNotFound)
+			return
+		}
+		writeMerchant(w, MerchantWebhookResponse{MerchantID: merchantID, URL: url, Encrypted: s.merchantWebhooks.Encrypted(merchantID)})
+	case http.MethodPut:
+		var req MerchantWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		var key crypto.PublicKey
+		if req.EncryptionKey != "" {
+			var err error
+			if key, err = events.ParsePublicKey([]byte(req.EncryptionKey)); err != nil {
+				apierror.Write(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			apierror.Write(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := MerchantWebhookResponse{MerchantID: merchantID, URL: req.URL, Secret: hex.EncodeToString(secret), Encrypted: key != nil}
+		if err := s.merchantWebhooks.Set(merchantID, req.URL, response.Secret, key); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Delivering the decision events of merchant %s to %s", merchantID, req.URL)
+		writeMerchant(w, response)
+	case http.MethodDelete:
+		url, exists := s.merchantWebhooks.URL(merchantID)
+		if !exists || !s.merchantWebhooks.Remove(merchantID) {
+			apierror.Write(w, "no webhook for merchant: "+merchantID, http.StatusNotFound)
+			return
+		}
+		log.Printf("Merchant %s webhook removed", merchantID)
+		writeMerchant(w, MerchantWebhookResponse{MerchantID: merchantID, URL: url})
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// merchantDecisionsHandler searches the audited decisions of the merchant,
+// taking the /fraud/search parameters except merchant
+func (s *Server) merchantDecisionsHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID, ok := s.merchantScope(w, r)
+	if !ok {
+		return
+	}
+
+	query, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.MerchantID = merchantID
+
+	records, err := s.auditStore.Search(query)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMerchant(w, SearchResponse{Count: len(records), Records: records})
+}
+
+// merchantStatsHandler aggregates the audited decisions of the merchant
+// since a time, the last 24 hours by default
+func (s *Server) merchantStatsHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID, ok := s.merchantScope(w, r)
+	if !ok {
+		return
+	}
+
+	since, err := statsSince(r)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.auditStore.Since(since)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var own []audit.Record
+	for _, record := range records {
+		if record.Transaction.MerchantID == merchantID {
+			own = append(own, record)
+		}
+	}
+	writeMerchant(w, MerchantStatsResponse{MerchantID: merchantID, Since: since, Summary: audit.Summarize(own)})
+}
+
+// statsSince returns the since parameter of a stats request, 24 hours ago
+// when it is not given
+func statsSince(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		return time.Now().Add(-24 * time.Hour), nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("since must be an RFC 3339 time")
+	}
+	return since, nil
+}
+
+func writeMerchant(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding merchant response: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type MerchantProfileRequest struct {
+	Country        string  `json:"country"`
+	MCC            string  `json:"mcc,omitempty" doc:"ISO 18245 merchant category code, 4 digits"`
+	RiskTier       string  `json:"risk_tier,omitempty" openapi:"enum=low|medium|high"`
+	ExpectedTicket float64 `json:"expected_ticket,omitempty" openapi:"minimum=0" doc:"Typical purchase amount at the merchant"`
+}
+
+type MerchantsResponse struct {
+	Merchants []detector.MerchantProfile `json:"merchants"`
+}
+
+// merchantsHandler lists the merchant profiles transactions are enriched with
+func (s *Server) merchantsHandler(w http.ResponseWriter, r *http.Request) {
+	writeMerchant(w, MerchantsResponse{Merchants: s.merchants.List()})
+}
+
+// merchantProfileHandler returns a merchant profile
+func (s *Server) merchantProfileHandler(w http.ResponseWriter, r *http.Request) {
+	profile, exists := s.merchants.Get(r.PathValue("id"))
+	if !exists {
+		apierror.Write(w, "merchant not found: "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+	writeMerchant(w, profile)
+}
+
+// putMerchantHandler creates or replaces a merchant profile. Transactions
+// scored from then on are enriched with it.
+func (s *Server) putMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	var req MerchantProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	profile := detector.MerchantProfile{
+		MerchantID:     r.PathValue("id"),
+		Country:        req.Country,
+		MCC:            req.MCC,
+		RiskTier:       req.RiskTier,
+		ExpectedTicket: req.ExpectedTicket,
+	}
+	if err := profile.Validate(); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.merchants.Set(profile)
+
+	profile, _ = s.merchants.Get(profile.MerchantID)
+	log.Printf("Merchant profile %s set: mcc=%s tier=%s expected_ticket=%.2f", profile.MerchantID, profile.MCC, profile.RiskTier, profile.ExpectedTicket)
+	writeMerchant(w, profile)
+}
+
+// deleteMerchantHandler removes a merchant profile and returns it
+func (s *Server) deleteMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	profile, exists := s.merchants.Get(r.PathValue("id"))
+	if !exists || !s.merchants.Delete(profile.MerchantID) {
+		apierror.Write(w, "merchant not found: "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+	log.Printf("Merchant profile %s deleted", profile.MerchantID)
+	writeMerchant(w, profile)
+}
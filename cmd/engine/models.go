@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/synthetic"
+)
+
+type CanaryRequest struct {
+	ModelPath       string  `json:"model_path" openapi:"required,minLength=1" doc:"Path of the candidate model artifact on the server, or its s3:// or gs:// URL"`
+	Checksum        string  `json:"checksum,omitempty" doc:"Hex SHA-256 of the stored artifact, verified when set"`
+	Percent         float64 `json:"percent" openapi:"exclusiveMinimum=0,maximum=100" doc:"Share of live traffic shadow scored by the candidate"`
+	SoakPeriod      string  `json:"soak_period" doc:"Duration before promotion, e.g. 2h"`
+	MinSamples      int     `json:"min_samples"`
+	MaxErrorRate    float64 `json:"max_error_rate"`
+	MaxLatencyRatio float64 `json:"max_latency_ratio" doc:"Rollback when candidate mean latency exceeds the active one by this factor"`
+}
+
+type FeatureImportanceResponse struct {
+	Version  string                 `json:"version"`
+	Active   bool                   `json:"active"`
+	Features []ml.FeatureImportance `json:"features" doc:"Most important first"`
+}
+
+// canaryHandler starts, reports on and aborts candidate model canaries
+func (s *Server) canaryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status, exists := s.mlEngine.CanaryStatus()
+		if !exists {
+			apierror.Write(w, "no canary has run", http.StatusNotFound)
+			return
+		}
+		writeCanaryStatus(w, http.StatusOK, status)
+	case http.MethodPost:
+		var req CanaryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		config, err := req.config()
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		model, err := s.artifacts.load(r.Context(), s.mlEngine, req.ModelPath, req.Checksum)
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, err := s.mlEngine.StartCanary(model, config)
+		if errors.Is(err, ml.ErrNotReady) {
+			writeMLError(w, err)
+			return
+		}
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeCanaryStatus(w, http.StatusAccepted, status)
+	case http.MethodDelete:
+		status, err := s.mlEngine.AbortCanary()
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeCanaryStatus(w, http.StatusOK, status)
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (req CanaryRequest) config() (ml.CanaryConfig, error) {
+	config := ml.CanaryConfig{
+		Percent:         req.Percent,
+		MinSamples:      req.MinSamples,
+		MaxErrorRate:    req.MaxErrorRate,
+		MaxLatencyRatio: req.MaxLatencyRatio,
+	}
+	if req.SoakPeriod != "" {
+		period, err := time.ParseDuration(req.SoakPeriod)
+		if err != nil {
+			return config, fmt.Errorf("invalid soak period %q: %w", req.SoakPeriod, err)
+		}
+		config.SoakPeriod = period
+	}
+	return config, nil
+}
+
+// enableOnlineLearning makes an online model learning from feedback labels
+// the active model when ML_ONLINE_LEARNING is set
+func enableOnlineLearning(engine *ml.MLEngine) {
+	if enabled, _ := strconv.ParseBool(os.Getenv("ML_ONLINE_LEARNING")); !enabled {
+		return
+	}
+	config := ml.DefaultOnlineConfig()
+	config.EvalWindow = getEnvInt("ML_ONLINE_EVAL_WINDOW", config.EvalWindow)
+	config.CheckpointEvery = getEnvInt("ML_ONLINE_CHECKPOINT_EVERY", config.CheckpointEvery)
+	engine.EnableOnlineLearning(config)
+	log.Printf("Online learning enabled, checkpointing every %d labels", config.CheckpointEvery)
+
+	if warmup := getEnvInt("ML_ONLINE_SYNTHETIC_WARMUP", 0); warmup > 0 {
+		learned := warmUpOnlineModel(engine, synthetic.New(synthetic.DefaultConfig()).Dataset(warmup))
+		log.Printf("Online model warmed up on %d synthetic labels", learned)
+	}
+}
+
+// warmUpOnlineModel teaches the online model the labels of synthetic
+// transactions, for a start better than the built-in weights while real
+// labels are scarce
+func warmUpOnlineModel(engine *ml.MLEngine, records []synthetic.Record) int {
+	learned := 0
+	for _, record := range records {
+		// synthetic transactions are shaped like analyze requests
+		body, err := json.Marshal(record.Transaction)
+		if err != nil {
+			continue
+		}
+		var req TransactionRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			continue
+		}
+		if engine.Learn(convertToInternalTransaction(req), record.Fraud) {
+			learned++
+		}
+	}
+	return learned
+}
+
+// onlineModelHandler reports the state of the online model
+func (s *Server) onlineModelHandler(w http.ResponseWriter, r *http.Request) {
+	status, enabled := s.mlEngine.OnlineStatus()
+	if !enabled {
+		apierror.Write(w, "online learning is disabled; set ML_ONLINE_LEARNING=true", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Error encoding online model status: %v", err)
+	}
+}
+
+// featureImportanceHandler ranks the features of a model version by the
+// share of the total absolute weight they carry
+func (s *Server) featureImportanceHandler(w http.ResponseWriter, r *http.Request) {
+	version := r.PathValue("version")
+	features, err := s.mlEngine.FeatureImportance(version)
+	if errors.Is(err, ml.ErrUnknownModel) {
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(FeatureImportanceResponse{
+		Version:  version,
+		Active:   version == s.mlEngine.ActiveVersion(),
+		Features: features,
+	}); err != nil {
+		log.Printf("Error encoding feature importance: %v", err)
+	}
+}
+
+// writeMLError reports an ML engine failure, as ML_UNAVAILABLE while no model
+// is loaded
+func writeMLError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ml.ErrNotReady) {
+		apierror.WriteCode(w, http.StatusServiceUnavailable, apierror.MLUnavailable, err.Error())
+		return
+	}
+	apierror.Write(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeCanaryStatus(w http.ResponseWriter, status int, canary ml.CanaryStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(canary); err != nil {
+		log.Printf("Error encoding canary status: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/nearmiss"
+)
+
+type NearMissesResponse struct {
+	NearMisses []nearmiss.Entry `json:"near_misses"`
+}
+
+// nearMissDataset returns the dataset of transactions scoring within
+// NEAR_MISS_BAND below a threshold, appended to NEAR_MISS_FILE when set
+func nearMissDataset() *nearmiss.Dataset {
+	config := nearmiss.DefaultConfig()
+	if value, err := strconv.ParseFloat(os.Getenv("NEAR_MISS_BAND"), 64); err == nil && value > 0 {
+		config.Band = value
+	}
+	config.History = getEnvInt("NEAR_MISS_HISTORY", config.History)
+	config.Path = os.Getenv("NEAR_MISS_FILE")
+
+	dataset, err := nearmiss.Open(config)
+	if err != nil {
+		log.Fatalf("Failed to load near misses: %v", err)
+	}
+	if config.Path != "" {
+		log.Printf("Loaded %d near misses from %s", dataset.Len(), config.Path)
+	}
+	return dataset
+}
+
+// recordNearMiss keeps a transaction that scored just below a threshold of
+// the policy in effect for its merchant
+func (s *Server) recordNearMiss(transaction *detector.Transaction, outcome *decision.Outcome) {
+	policy := s.scorer.PolicyFor(transaction.MerchantID)
+	threshold, gap, near := s.nearMisses.Near(outcome.Decision, outcome.FinalScore, policy.ReviewThreshold, policy.DeclineThreshold)
+	if !near {
+		return
+	}
+	err := s.nearMisses.Add(nearmiss.Entry{
+		Transaction: *transaction,
+		Decision:    outcome.Decision,
+		RiskScore:   outcome.FinalScore,
+		Threshold:   threshold,
+		Gap:         gap,
+		ReasonCodes: outcome.Detection.ReasonCodes,
+		DecidedAt:   outcome.DecidedAt,
+	})
+	if err != nil {
+		log.Printf("Failed to keep near miss %s: %v", transaction.ID, err)
+	}
+}
+
+// nearMissesHandler lists the near misses, newest first, only the labeled
+// ones with labeled=true
+func (s *Server) nearMissesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			apierror.Write(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(NearMissesResponse{
+		NearMisses: s.nearMisses.Entries(query.Get("labeled") == "true", limit),
+	}); err != nil {
+		log.Printf("Error encoding near misses: %v", err)
+	}
+}
+
+// mineNearMissesHandler queues the mining of the labeled near misses for
+// rule proposals as a background job
+func (s *Server) mineNearMissesHandler(w http.ResponseWriter, r *http.Request) {
+	var req nearmiss.MiningConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.enqueueJob(w, jobRuleMining, req)
+}
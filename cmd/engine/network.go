@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/network"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// reasonNetworkAlert is the reason code of approvals sent to review while a
+// network alert escalates their account or device
+const reasonNetworkAlert = "NETWORK_ALERT"
+
+type NetworkAlertsResponse struct {
+	Alerts []network.Alert `json:"alerts" doc:"The most recent first"`
+}
+
+// networkCorrelator returns the correlator of risky decisions across
+// merchants and the sender of its alerts to NETWORK_ALERT_WEBHOOK_URL, nil
+// unless NETWORK_ALERTS_ENABLED is set
+func (s *Server) networkCorrelator() (*network.Correlator, *alertSender) {
+	if enabled, _ := strconv.ParseBool(os.Getenv("NETWORK_ALERTS_ENABLED")); !enabled {
+		return nil, nil
+	}
+	config := network.DefaultConfig()
+	config.Window = getEnvDuration("NETWORK_ALERT_WINDOW", config.Window)
+	config.MinMerchants = getEnvInt("NETWORK_ALERT_MIN_MERCHANTS", config.MinMerchants)
+	config.EscalateFor = getEnvDuration("NETWORK_ALERT_ESCALATE_FOR", config.EscalateFor)
+
+	correlator, err := network.New(config)
+	if err != nil {
+		log.Fatalf("Invalid network alert settings: %v", err)
+	}
+	var sender *alertSender
+	if url := os.Getenv("NETWORK_ALERT_WEBHOOK_URL"); url != "" {
+		sender = newAlertSender(url, os.Getenv("NETWORK_ALERT_WEBHOOK_SECRET"))
+	}
+	correlator.OnAlert(func(alert network.Alert) {
+		log.Printf("ALERT: %s was sent to review or declined at %d merchants within %s", alert.Entity, len(alert.Merchants), config.Window)
+		kind, _, _ := strings.Cut(alert.Entity, ":")
+		s.metrics.ObserveNetworkAlert(kind)
+		if sender != nil {
+			sender.Send(alert.Entity, networkAlertEvent(alert))
+		}
+	})
+	log.Printf("Alerting on accounts and devices risky at %d merchants within %s", config.MinMerchants, config.Window)
+	return correlator, sender
+}
+
+// networkEntities returns the account and device of a transaction, the
+// entities correlated across merchants. IP addresses are left out: carrier
+// NAT puts many customers behind one.
+func networkEntities(tx *detector.Transaction) []string {
+	var entities []string
+	if tx.AccountID != "" {
+		entities = append(entities, "account:"+tx.AccountID)
+	}
+	if tx.DeviceID != "" {
+		entities = append(entities, "device:"+tx.DeviceID)
+	}
+	return entities
+}
+
+// applyNetworkEscalation counts a REVIEW or decline against the account and
+// device of the transaction and, while a network alert escalates one of
+// them, sends approvals to review. Decisions are counted as scored, so the
+// escalation does not feed the alert. Observe-only merchants are neither
+// counted nor escalated.
+func (s *Server) applyNetworkEscalation(transaction *detector.Transaction, outcome *decision.Outcome) {
+	if s.network == nil || s.overrides.ObserveOnly(transaction.MerchantID) {
+		return
+	}
+	entities := networkEntities(transaction)
+	now := time.Now()
+	risky := outcome.Decision == decision.Review || outcome.Decision == decision.Decline
+	s.network.Observe(entities, transaction.MerchantID, risky, now)
+	if outcome.Decision != decision.Approve {
+		return
+	}
+	alert, escalated := s.network.Escalated(entities, now)
+	if !escalated {
+		return
+	}
+	outcome.Decision = decision.Review
+	outcome.Detection.ReasonCodes = append(outcome.Detection.ReasonCodes, reasonNetworkAlert)
+	outcome.Detection.Reasons = append(outcome.Detection.Reasons,
+		fmt.Sprintf("%s was sent to review or declined at %d merchants", alert.Entity, len(alert.Merchants)))
+	s.metrics.ObserveNetworkEscalation()
+}
+
+// networkAlertsHandler lists the current network alerts. Callers of a tenant
+// only see the alerts involving its merchants, and only those merchants.
+func (s *Server) networkAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.network == nil {
+		apierror.Write(w, "network alerts are not enabled", http.StatusNotFound)
+		return
+	}
+	alerts := s.network.Alerts(time.Now())
+	if _, tenant := caller(r); tenant != "" {
+		visible := []network.Alert{}
+		for _, alert := range alerts {
+			var merchants []string
+			for _, merchantID := range alert.Merchants {
+				if layer, _ := s.overrides.Merchant(merchantID); layer.Tenant == tenant {
+					merchants = append(merchants, merchantID)
+				}
+			}
+			if len(merchants) > 0 {
+				alert.Merchants = merchants
+				visible = append(visible, alert)
+			}
+		}
+		alerts = visible
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(NetworkAlertsResponse{Alerts: alerts}); err != nil {
+		log.Printf("Error encoding network alerts: %v", err)
+	}
+}
+
+// clearNetworkAlertHandler lifts the alert and escalation of an account or
+// device found legitimate. Alerts span tenants, so callers of a tenant
+// cannot clear them.
+func (s *Server) clearNetworkAlertHandler(w http.ResponseWriter, r *http.Request) {
+	if s.network == nil {
+		apierror.Write(w, "network alerts are not enabled", http.StatusNotFound)
+		return
+	}
+	analyst, tenant := caller(r)
+	if tenant != "" {
+		apierror.Write(w, "network alerts span tenants and are cleared by the operator", http.StatusForbidden)
+		return
+	}
+	entity := r.PathValue("entity")
+	alert, cleared := s.network.Clear(entity, time.Now())
+	if !cleared {
+		apierror.Write(w, "no network alert on "+entity, http.StatusNotFound)
+		return
+	}
+	log.Printf("Network alert on %s cleared by %s", entity, analyst)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(alert); err != nil {
+		log.Printf("Error encoding network alert: %v", err)
+	}
+}
+
+// networkAlertEvent returns the event of a network alert
+func networkAlertEvent(alert network.Alert) *events.NetworkAlertEvent {
+	return &events.NetworkAlertEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       alert.Entity + ":" + strconv.FormatInt(alert.RaisedAt.UnixNano(), 10),
+		OccurredAt:    alert.RaisedAt.UTC(),
+		Entity:        alert.Entity,
+		Merchants:     alert.Merchants,
+		Decisions:     alert.Decisions,
+		FirstAt:       alert.FirstAt.UTC(),
+		EscalateUntil: alert.EscalateUntil,
+	}
+}
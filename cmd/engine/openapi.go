@@ -0,0 +1,710 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/annotation"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/bundle"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/fairness"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/nearmiss"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/network"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/openapi"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/replication"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/report"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/throttle"
+)
+
+// apiDocument describes every endpoint of the API. Request bodies are
+// validated against it and it is served at /openapi.json, so new endpoints
+// must be registered here.
+func apiDocument() *openapi.Document {
+	doc := openapi.NewDocument("Fraud Detection Engine API", "v1.0.0")
+
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/health", Summary: "Health check and system status"})
+	doc.Register(openapi.Endpoint{
+		Method:      http.MethodPost,
+		Path:        "/fraud/analyze",
+		Summary:     "Analyze a single transaction; mode=two_phase returns a fast pre-score and completes the full analysis asynchronously, as_of scores it with the configuration and state of a past time",
+		Request:     TransactionRequest{},
+		Response:    FraudResponse{},
+		Query:       []string{"mode", "as_of", "verbosity", "max_reasons"},
+		InvalidCode: apierror.InvalidTransaction,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:      http.MethodPost,
+		Path:        "/fraud/batch",
+		Summary:     "Analyze up to 1000 transactions, answering a 207 with the errors of those failing validation; with async=true, batches over BATCH_ASYNC_THRESHOLD are analyzed in a background job",
+		Request:     BatchEnvelope{},
+		Response:    BatchResponse{},
+		Query:       []string{"verbosity", "max_reasons", "async"},
+		InvalidCode: apierror.InvalidTransaction,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/batch/{job_id}",
+		Summary:  "The status of an asynchronous batch and a page of its results",
+		Response: BatchJobResponse{},
+		Query:    []string{"offset", "limit"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/revalidate",
+		Summary:  "Re-check a decision past its expires_at before capturing the payment; decisions never become more lenient",
+		Request:  RevalidateRequest{},
+		Response: FraudResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/signups",
+		Summary:  "Score an account-creation event for duplicate and serial accounts sharing its device, IP, email or phone",
+		Request:  SignupRequest{},
+		Response: SignupResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/feedback",
+		Summary:  "Label an audited transaction as fraud or legitimate; corridor risks are learned from the labels",
+		Request:  FeedbackRequest{},
+		Response: FeedbackResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/feedback/batch",
+		Summary:  "Label the transactions of a CSV or JSON Lines label file, such as a chargeback file, reporting rows without a decision; location=s3://... or gs://... imports it in a background job",
+		Response: FeedbackBatchResponse{},
+		Query:    []string{"format", "location", "dry_run"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/annotations",
+		Summary:  "Attach a note, tags and attachments to an audited decision, authored by the caller",
+		Request:  annotation.Annotation{},
+		Response: annotation.Annotation{},
+		Status:   http.StatusCreated,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/annotations",
+		Summary:  "Search annotations by transaction, tag, author, text (q) and time, newest first",
+		Response: AnnotationsResponse{},
+		Query:    annotationQueryParams,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/annotations/tags",
+		Summary:  "Annotation tags and how many annotations have each",
+		Response: AnnotationTagsResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:  http.MethodGet,
+		Path:    "/fraud/annotations/{id}/attachments/{name}",
+		Summary: "Content of an uploaded attachment",
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/throttled-merchants",
+		Summary:  "Merchants tracked for decline rate spikes, by mode (normal, friction or throttled), the most limited first",
+		Response: ThrottledMerchantsResponse{},
+		Query:    []string{"mode"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/throttled-merchants/{id}",
+		Summary:  "Return a merchant to normal after a legitimate decline rate spike",
+		Response: throttle.Status{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/network-alerts",
+		Summary:  "Accounts and devices sent to review or declined at many merchants within the window, the most recent first",
+		Response: NetworkAlertsResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/network-alerts/{entity}",
+		Summary:  "Lift the alert and escalation of an account or device found legitimate",
+		Response: network.Alert{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/scenarios",
+		Summary:  "Scenario alert rules on aggregate decisions, with their current values and whether they fire",
+		Response: ScenariosResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/scenarios",
+		Summary:  "Replace the scenario alert rules",
+		Request:  ScenariosRequest{},
+		Response: ScenariosResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/usage",
+		Summary:  "Metered analyses by day, or month with group=month, for billing; format=csv exports CSV",
+		Response: UsageResponse{},
+		Query:    []string{"from", "to", "subject", "tenant", "group", "format"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/quotas",
+		Summary:  "Daily and monthly quotas of API callers and tenants, with their usage today and this month",
+		Response: QuotasResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/reviews",
+		Summary:  "REVIEW decisions queued for analysts by status (open, escalated or resolved) and tenant, ranked by triage score or, with order=oldest, oldest first",
+		Response: ReviewCasesResponse{},
+		Query:    []string{"status", "tenant", "order"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/reviews/sla",
+		Summary:  "Review queue and SLA breaches of each tenant",
+		Response: ReviewSLAResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/reviews/{id}",
+		Summary:  "A review case with its time in queue and SLA",
+		Response: review.Case{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/reviews/{id}/resolve",
+		Summary:  "Approve or decline a review case, publishing the final decision to webhooks and gateways",
+		Request:  ReviewResolutionRequest{},
+		Response: review.Case{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/corridors",
+		Summary:  "Configured and learned issuer, merchant and IP country corridor risks, riskiest first",
+		Response: CorridorsResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/merchants",
+		Summary:  "Merchant profiles transactions are enriched with",
+		Response: MerchantsResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/merchants/{id}",
+		Summary:  "A merchant profile",
+		Response: detector.MerchantProfile{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/merchants/{id}",
+		Summary:  "Create or replace a merchant profile with its MCC, country, risk tier and expected ticket size",
+		Request:  MerchantProfileRequest{},
+		Response: detector.MerchantProfile{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/merchants/{id}",
+		Summary:  "Remove a merchant profile",
+		Response: detector.MerchantProfile{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/calendar",
+		Summary:  "Holidays, shopping peaks and fraud surges that scale amount and velocity thresholds",
+		Response: CalendarEvents{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/calendar",
+		Summary:  "Replace the calendar events",
+		Request:  CalendarEvents{},
+		Response: CalendarEvents{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/feature-flags",
+		Summary:  "Rollout of the detector features per tenant",
+		Response: FeatureFlags{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/feature-flags",
+		Summary:  "Replace the feature flags",
+		Request:  FeatureFlags{},
+		Response: FeatureFlags{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/amount-limits",
+		Summary:  "Daily and weekly cumulative amount limits of the accounts",
+		Response: AmountLimits{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/amount-limits",
+		Summary:  "Replace the amount limits",
+		Request:  AmountLimits{},
+		Response: AmountLimits{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/fairness",
+		Summary:  "Decline and false-positive rates across segments, with the significant disparities",
+		Response: fairness.Report{},
+		Query:    []string{"refresh"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/reports",
+		Summary:  "Kept daily and weekly fraud reports, most recent period first",
+		Response: ReportsResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/reports",
+		Summary:  "Generate the report of the last complete day or week, without delivering it",
+		Request:  ReportRequest{},
+		Response: report.Report{},
+		Status:   http.StatusCreated,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/reports/{id}",
+		Summary:  "A fraud report as JSON, or as HTML or PDF with format=html or format=pdf",
+		Response: report.Report{},
+		Query:    []string{"format"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/train",
+		Summary:  "Queue ML model training as a background job",
+		Response: jobs.Job{},
+		Status:   http.StatusAccepted,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/near-misses",
+		Summary:  "Transactions that scored just below the review or decline threshold, newest first, with their labels",
+		Response: NearMissesResponse{},
+		Query:    []string{"labeled", "limit"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/near-misses/mine",
+		Summary:  "Queue the mining of the labeled near misses for rule proposals as a background job",
+		Request:  nearmiss.MiningConfig{},
+		Response: jobs.Job{},
+		Status:   http.StatusAccepted,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/jobs",
+		Summary:  "Kept background jobs, most recently created first",
+		Response: JobsResponse{},
+		Query:    []string{"status", "type", "limit"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/jobs/{id}",
+		Summary:  "A background job with its attempts and result",
+		Response: jobs.Job{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/jobs/{id}",
+		Summary:  "Cancel a queued or running background job",
+		Response: jobs.Job{},
+	})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/fraud/stats", Summary: "Detection statistics"})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     replication.Path,
+		Summary:  "Apply the list, rule and profile changes of a peer region, signed with the replication secret",
+		Request:  replication.Delta{},
+		Response: ReplicationResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     replication.Path + "/status",
+		Summary:  "Changes pending delivery to each peer region and the last delivery errors",
+		Response: ReplicationStatusResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/admin/tenant-isolation",
+		Summary:  "Check that no audit record opens with the key of another tenant than its own",
+		Response: audit.IsolationReport{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/webhooks/{id}/deliveries",
+		Summary:  "Latest deliveries to a webhook, default or a merchant ID, newest first",
+		Response: WebhookDeliveriesResponse{},
+		Query:    []string{"since", "until", "status", "limit"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/webhooks/{id}/replay",
+		Summary:  "Queue the redelivery of the decision events of a time range to a webhook as a background job",
+		Request:  WebhookReplayRequest{},
+		Response: jobs.Job{},
+		Status:   http.StatusAccepted,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/partition",
+		Summary:  "Replicas account state is sharded across, and the owner of an account_id",
+		Response: PartitionResponse{},
+	})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/fraud/rules", Summary: "Active detection rules"})
+	doc.Register(openapi.Endpoint{
+		Method:  http.MethodPost,
+		Path:    "/fraud/rules",
+		Summary: "Add a rule written in the rule expression language; held for sign-off with 202 when the tenant requires it",
+		Request: RuleRequest{},
+		Status:  http.StatusCreated,
+	})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/fraud/rules/export", Summary: "Export the full rule set as YAML"})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/rules/import",
+		Summary:  "Replace the expression rules with a YAML rule file; dry_run=true only returns the diff",
+		Response: RuleImportResponse{},
+		Query:    []string{"dry_run"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/rules/{id}/quarantine",
+		Summary:  "Release a rule from quarantine after fixing it",
+		Response: detector.RuleHealth{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/rules/{id}/history",
+		Summary:  "Every version of an expression rule, with its author and changes from the version before",
+		Response: RuleHistoryResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/rules/{id}/rollback",
+		Summary:  "Restore an expression rule as of a prior version",
+		Request:  RuleRollbackRequest{},
+		Response: ruleset.RuleVersion{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/rule-changes",
+		Summary:  "Rule changes submitted for sign-off, newest first",
+		Response: RuleChangesResponse{},
+		Query:    []string{"status"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/rule-changes/{id}",
+		Summary:  "A rule change submitted for sign-off",
+		Response: ruleset.Proposal{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/rule-changes/{id}/approve",
+		Summary:  "Sign off a pending rule change and apply it",
+		Request:  RuleReviewRequest{},
+		Response: ruleset.Proposal{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/rule-changes/{id}/reject",
+		Summary:  "Turn down a pending rule change",
+		Request:  RuleReviewRequest{},
+		Response: ruleset.Proposal{},
+	})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/fraud/bundles", Summary: "Applied config bundles, most recent first"})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/bundles/export",
+		Summary:  "Export the rules, thresholds, lists and model version as a signed config bundle",
+		Response: bundle.Signed{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/bundles/import",
+		Summary:  "Verify and apply a signed config bundle; dry_run=true only returns the rule diff",
+		Request:  bundle.Signed{},
+		Response: BundleImportResponse{},
+		Query:    []string{"dry_run"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/bundles/rollback",
+		Summary:  "Re-apply the config bundle applied before the current one",
+		Response: BundleImportResponse{},
+	})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/fraud/configs", Summary: "List named scoring configurations"})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/configs",
+		Summary:  "Register a named scoring configuration",
+		Request:  decision.Configuration{},
+		Response: decision.Configuration{},
+		Status:   http.StatusCreated,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/overrides",
+		Summary:  "Global, tenant, org and merchant configuration layers",
+		Response: config.Hierarchy{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/overrides",
+		Summary:  "Replace the global, tenant, org and merchant configuration layers",
+		Request:  config.Hierarchy{},
+		Response: config.Hierarchy{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/overrides/effective",
+		Summary:  "Thresholds, rule toggles and lists in effect for a merchant, with the layer each comes from",
+		Response: config.Effective{},
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/orgs",
+		Summary:  "Orgs, such as acquirers, with their layers and merchants",
+		Response: OrgsResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/orgs/{id}",
+		Summary:  "Layer and merchants of an org",
+		Response: OrgResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/orgs/{id}",
+		Summary:  "Create or replace the layer of an org, setting thresholds and lists for its whole portfolio",
+		Request:  config.OrgLayer{},
+		Response: OrgResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/orgs/{id}/stats",
+		Summary:  "Decision counts of every merchant of an org since a time (default the last 24 hours), in total and per merchant",
+		Response: OrgStatsResponse{},
+		Query:    []string{"since"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/admin/decision-diff",
+		Summary:  "Diff decisions of recent traffic under two configurations, as a background job with async=true",
+		Request:  DecisionDiffRequest{},
+		Response: DecisionDiffResponse{},
+		Query:    []string{"async"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/admin/chaos",
+		Summary:  "Faults injected in developer mode",
+		Response: ChaosRequest{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/admin/chaos",
+		Summary:  "Set the faults injected in developer mode",
+		Request:  ChaosRequest{},
+		Response: ChaosRequest{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/admin/chaos",
+		Summary:  "Stop injecting faults",
+		Response: ChaosRequest{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/admin/recordings",
+		Summary:  "Request recordings of API keys; with subject, the recording of one key and its sanitized exchanges",
+		Response: RecordingsResponse{},
+		Query:    []string{"subject"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/admin/recordings",
+		Summary:  "Record the sanitized requests and responses of an API key for a time window",
+		Request:  RecordingRequest{},
+		Response: RecordingResponse{},
+		Status:   http.StatusCreated,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/admin/recordings",
+		Summary:  "Stop recording an API key and discard its exchanges",
+		Response: RecordingResponse{},
+		Query:    []string{"subject"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/models/canary",
+		Summary:  "Status of the running or last candidate model canary",
+		Response: ml.CanaryStatus{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/models/canary",
+		Summary:  "Start shadow scoring a candidate model before promotion",
+		Request:  CanaryRequest{},
+		Response: ml.CanaryStatus{},
+		Status:   http.StatusAccepted,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     "/fraud/models/canary",
+		Summary:  "Abort the running canary",
+		Response: ml.CanaryStatus{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/models/online",
+		Summary:  "Weights, log loss and rollbacks of the online learning model",
+		Response: ml.OnlineStatus{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/models/{version}/feature-importance",
+		Summary:  "Features of a model version ranked by their share of its weight",
+		Response: FeatureImportanceResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/customers/{id}",
+		Summary:  "Customer location history",
+		Response: CustomerResponse{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/beneficiaries/{id}",
+		Summary:  "Transfer statistics and fraud labels of a beneficiary",
+		Response: detector.BeneficiaryStats{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     "/fraud/beneficiaries/{id}/labels",
+		Summary:  "Label a beneficiary as having received fraudulent funds",
+		Request:  BeneficiaryLabelRequest{},
+		Response: detector.BeneficiaryStats{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/reputation/{kind}/{id}",
+		Summary:  "Current fraud reputation of a device, ip or merchant",
+		Response: detector.ReputationScore{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     "/fraud/reputation/{kind}/{id}",
+		Summary:  "Grade a gray-area device, ip or merchant with a decaying reputation instead of listing it",
+		Request:  ReputationRequest{},
+		Response: detector.ReputationScore{},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     "/fraud/search",
+		Summary:  "Search audited decisions, newest first, or those annotated with a tag",
+		Response: SearchResponse{},
+		Query:    searchQueryParams,
+	})
+	doc.Register(openapi.Endpoint{
+		Method:  http.MethodGet,
+		Path:    "/fraud/events",
+		Summary: "Decision events since a time (default the last hour), one JSON event per line or length-delimited protobuf",
+		Query:   []string{"since"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:  http.MethodGet,
+		Path:    "/fraud/promotions/decisions",
+		Summary: "Promotion decisions, whether to grant or withhold each redeemed bonus, since a time (default the last hour), one JSON decision per line",
+		Query:   []string{"since", "campaign_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     merchantPath + "trusted-customers",
+		Summary:  "Accounts the merchant trusts, which are not sent to review for their score alone",
+		Response: TrustedCustomersResponse{},
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     merchantPath + "trusted-customers",
+		Summary:  "Replace the accounts the merchant trusts",
+		Request:  TrustedCustomersRequest{},
+		Response: TrustedCustomersResponse{},
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     merchantPath + "webhook",
+		Summary:  "Webhook the merchant's decision events are delivered to",
+		Response: MerchantWebhookResponse{},
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPut,
+		Path:     merchantPath + "webhook",
+		Summary:  "Deliver the merchant's decision events to a webhook, signed with the returned secret",
+		Request:  MerchantWebhookRequest{},
+		Response: MerchantWebhookResponse{},
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodDelete,
+		Path:     merchantPath + "webhook",
+		Summary:  "Stop delivering the merchant's decision events",
+		Response: MerchantWebhookResponse{},
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     merchantPath + "webhook/deliveries",
+		Summary:  "Latest deliveries to the merchant's webhook, newest first",
+		Response: WebhookDeliveriesResponse{},
+		Query:    []string{"merchant_id", "since", "until", "status", "limit"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodPost,
+		Path:     merchantPath + "webhook/replay",
+		Summary:  "Queue the redelivery of the merchant's decision events of a time range as a background job",
+		Request:  WebhookReplayRequest{},
+		Response: jobs.Job{},
+		Status:   http.StatusAccepted,
+		Query:    []string{"merchant_id"},
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     merchantPath + "decisions",
+		Summary:  "Search the merchant's audited decisions, newest first",
+		Response: SearchResponse{},
+		Query:    append([]string{"merchant_id"}, searchQueryParams...),
+	})
+	doc.Register(openapi.Endpoint{
+		Method:   http.MethodGet,
+		Path:     merchantPath + "stats",
+		Summary:  "Decision counts of the merchant since a time (default the last 24 hours)",
+		Response: MerchantStatsResponse{},
+		Query:    []string{"merchant_id", "since"},
+	})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/metrics", Summary: "Prometheus metrics"})
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/openapi.json", Summary: "This document"})
+
+	return doc
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+)
+
+type OrgResponse struct {
+	OrgID     string   `json:"org_id"`
+	Merchants []string `json:"merchants" doc:"Merchants of the org's portfolio, whose layers name it"`
+	config.OrgLayer
+}
+
+type OrgsResponse struct {
+	Orgs []OrgResponse `json:"orgs"`
+}
+
+type OrgStatsResponse struct {
+	OrgID string    `json:"org_id"`
+	Since time.Time `json:"since"`
+	audit.Summary
+	Merchants map[string]audit.Summary `json:"merchants" doc:"The same counts per merchant of the org"`
+}
+
+// orgScope returns the layer of the org a request names, which must be
+// within the tenant of the caller when the caller has one
+func (s *Server) orgScope(w http.ResponseWriter, r *http.Request) (string, config.OrgLayer, bool) {
+	orgID := r.PathValue("id")
+	org, exists := s.overrides.Org(orgID)
+	if !exists {
+		apierror.Write(w, "unknown org: "+orgID, http.StatusNotFound)
+		return "", config.OrgLayer{}, false
+	}
+	if _, tenant := caller(r); tenant != "" && org.Tenant != tenant {
+		apierror.Write(w, "Forbidden: org belongs to another tenant", http.StatusForbidden)
+		return "", config.OrgLayer{}, false
+	}
+	return orgID, org, true
+}
+
+// orgsHandler lists the orgs and their merchants, only those of the
+// caller's tenant when it has one
+func (s *Server) orgsHandler(w http.ResponseWriter, r *http.Request) {
+	_, tenant := caller(r)
+	orgs := []OrgResponse{}
+	for id, org := range s.overrides.Hierarchy().Orgs {
+		if tenant == "" || org.Tenant == tenant {
+			orgs = append(orgs, OrgResponse{OrgID: id, Merchants: s.overrides.OrgMerchants(id), OrgLayer: org})
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].OrgID < orgs[j].OrgID })
+	writeOrg(w, OrgsResponse{Orgs: orgs})
+}
+
+// orgHandler returns the layer of an org and its merchants
+func (s *Server) orgHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, org, ok := s.orgScope(w, r)
+	if !ok {
+		return
+	}
+	writeOrg(w, OrgResponse{OrgID: orgID, Merchants: s.overrides.OrgMerchants(orgID), OrgLayer: org})
+}
+
+// putOrgHandler creates or replaces the layer of an org, setting the
+// thresholds and lists of its whole portfolio. Callers of a tenant manage
+// the orgs of their tenant only.
+func (s *Server) putOrgHandler(w http.ResponseWriter, r *http.Request) {
+	var org config.OrgLayer
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&org); err != nil {
+		apierror.Write(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orgID := r.PathValue("id")
+	if _, tenant := caller(r); tenant != "" {
+		if org.Tenant == "" {
+			org.Tenant = tenant
+		}
+		existing, exists := s.overrides.Org(orgID)
+		if org.Tenant != tenant || (exists && existing.Tenant != tenant) {
+			apierror.Write(w, "Forbidden: org belongs to another tenant", http.StatusForbidden)
+			return
+		}
+	}
+	if err := s.overrides.SetOrg(orgID, org); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.recordVersion()
+
+	merchants := s.overrides.OrgMerchants(orgID)
+	log.Printf("Org %s layer set for %d merchants", orgID, len(merchants))
+	writeOrg(w, OrgResponse{OrgID: orgID, Merchants: merchants, OrgLayer: org})
+}
+
+// orgStatsHandler rolls up the audited decisions of every merchant of an
+// org since a time, the last 24 hours by default
+func (s *Server) orgStatsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := s.orgScope(w, r)
+	if !ok {
+		return
+	}
+	since, err := statsSince(r)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.auditStore.Since(since)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byMerchant := make(map[string][]audit.Record)
+	for _, merchantID := range s.overrides.OrgMerchants(orgID) {
+		byMerchant[merchantID] = nil
+	}
+	var portfolio []audit.Record
+	for _, record := range records {
+		if own, exists := byMerchant[record.Transaction.MerchantID]; exists {
+			byMerchant[record.Transaction.MerchantID] = append(own, record)
+			portfolio = append(portfolio, record)
+		}
+	}
+
+	response := OrgStatsResponse{
+		OrgID:     orgID,
+		Since:     since,
+		Summary:   audit.Summarize(portfolio),
+		Merchants: make(map[string]audit.Summary, len(byMerchant)),
+	}
+	for merchantID, own := range byMerchant {
+		response.Merchants[merchantID] = audit.Summarize(own)
+	}
+	writeOrg(w, response)
+}
+
+func writeOrg(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding org response: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+)
+
+// overridesHandler serves and replaces the global, tenant and merchant
+// configuration layers
+func (s *Server) overridesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeHierarchy(w, s.overrides.Hierarchy())
+	case http.MethodPut:
+		var hierarchy config.Hierarchy
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&hierarchy); err != nil {
+			apierror.Write(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.overrides.Set(hierarchy); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.recordVersion()
+		log.Printf("Configuration layers replaced: %d tenants, %d merchants", len(hierarchy.Tenants), len(hierarchy.Merchants))
+		writeHierarchy(w, hierarchy)
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// effectiveConfigHandler shows the configuration in effect for a merchant
+// and the layer each setting comes from
+func (s *Server) effectiveConfigHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID := r.URL.Query().Get("merchant_id")
+	if merchantID == "" {
+		apierror.Write(w, "merchant_id is required", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.overrides.Resolve(merchantID, s.scorer.Policy())); err != nil {
+		log.Printf("Error encoding effective configuration: %v", err)
+	}
+}
+
+// applyObserveOnly approves the transactions of merchants in observe-only
+// mode. The decision made is still audited and published, and is reported in
+// the metadata so clients can calibrate before enforcement.
+func (s *Server) applyObserveOnly(merchantID string, response *FraudResponse) {
+	if !s.overrides.ObserveOnly(merchantID) {
+		return
+	}
+	if response.Metadata == nil {
+		response.Metadata = make(map[string]interface{})
+	}
+	response.Metadata["observe_only"] = true
+	response.Metadata["observed_decision"] = response.Decision
+	response.Decision = decision.Approve
+	response.Retry = ""
+}
+
+func writeHierarchy(w http.ResponseWriter, hierarchy config.Hierarchy) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hierarchy); err != nil {
+		log.Printf("Error encoding configuration layers: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/partition"
+)
+
+type PartitionResponse struct {
+	Self  string   `json:"self"`
+	Nodes []string `json:"nodes"`
+	// Owner is the replica owning the account_id queried
+	Owner string `json:"owner,omitempty"`
+}
+
+// partitioner returns the forwarder sharding account state across the
+// PARTITION_NODES replicas, nil when they are not set
+func partitioner() *partition.Forwarder {
+	nodes := os.Getenv("PARTITION_NODES")
+	if nodes == "" {
+		return nil
+	}
+	self := os.Getenv("PARTITION_SELF")
+	secret := os.Getenv("PARTITION_SECRET")
+	if self == "" || secret == "" {
+		log.Fatalf("PARTITION_SELF and PARTITION_SECRET are required with PARTITION_NODES")
+	}
+	ring, err := partition.NewRing(strings.Split(nodes, ","), getEnvInt("PARTITION_VIRTUAL_NODES", partition.DefaultVirtualNodes))
+	if err != nil {
+		log.Fatalf("Invalid PARTITION_NODES: %v", err)
+	}
+	found := false
+	for _, node := range ring.Nodes() {
+		found = found || node == self
+	}
+	if !found {
+		log.Fatalf("PARTITION_SELF %s is not one of PARTITION_NODES", self)
+	}
+	log.Printf("Sharding account state across %d replicas as %s", len(ring.Nodes()), self)
+	return partition.NewForwarder(self, ring, secret, getEnvDuration("PARTITION_TIMEOUT", 2*time.Second))
+}
+
+// partitioned routes the requests of a handler to the replica owning their
+// accounts when state is sharded
+func (s *Server) partitioned(keys partition.Keys, handler http.HandlerFunc) http.Handler {
+	if s.partition == nil {
+		return handler
+	}
+	return s.partition.Handler(keys, handler)
+}
+
+// transactionAccount is the partition key of a transaction request
+func transactionAccount(body []byte) []string {
+	var req struct {
+		CustomerID string `json:"customer_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+	return []string{req.CustomerID}
+}
+
+// batchAccounts are the partition keys of a batch request, which is only
+// forwarded when one replica owns all of them
+func batchAccounts(body []byte) []string {
+	var req struct {
+		Transactions []struct {
+			CustomerID string `json:"customer_id"`
+		} `json:"transactions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+	accounts := make([]string, len(req.Transactions))
+	for i, txn := range req.Transactions {
+		accounts[i] = txn.CustomerID
+	}
+	return accounts
+}
+
+// partitionHandler serves the replicas of the ring and the owner of an
+// account_id
+func (s *Server) partitionHandler(w http.ResponseWriter, r *http.Request) {
+	if s.partition == nil {
+		apierror.Write(w, "partitioning is not enabled", http.StatusNotFound)
+		return
+	}
+	response := PartitionResponse{Self: s.partition.Self, Nodes: s.partition.Ring.Nodes()}
+	if account := r.URL.Query().Get("account_id"); account != "" {
+		response.Owner = s.partition.Ring.Owner(account)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding partition response: %v", err)
+	}
+}
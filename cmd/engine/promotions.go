@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+)
+
+// promoDecisionsHandler streams the promotion decisions since a time, oldest
+// first, as JSON lines: the growth team's view of which bonuses to pay out
+func (s *Server) promoDecisionsHandler(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			apierror.Write(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	for _, decision := range s.fraudDetector.PromoDecisions(since, r.URL.Query().Get("campaign_id")) {
+		if err := encoder.Encode(decision); err != nil {
+			log.Printf("Error writing promotion decisions: %v", err)
+			return
+		}
+	}
+}
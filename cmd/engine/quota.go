@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/quota"
+)
+
+type UsageResponse struct {
+	Usage []quota.Record `json:"usage" doc:"By period, tenant and subject"`
+}
+
+type QuotasResponse struct {
+	Quotas []quota.Status `json:"quotas"`
+}
+
+// quotaMeter returns the meter of the quotas in QUOTAS_FILE, saving usage to
+// QUOTA_USAGE_FILE when set, nil when no quotas are configured
+func quotaMeter() *quota.Meter {
+	path := os.Getenv("QUOTAS_FILE")
+	if path == "" {
+		return nil
+	}
+	config, err := quota.LoadConfigFile(path)
+	if err != nil {
+		log.Fatalf("Failed to load quotas: %v", err)
+	}
+	config.Retention = getEnvDuration("QUOTA_USAGE_RETENTION", config.Retention)
+
+	meter, err := quota.Open(config, os.Getenv("QUOTA_USAGE_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load quota usage: %v", err)
+	}
+	log.Printf("Metering analyses against the quotas of %d subjects and %d tenants", len(config.Subjects), len(config.Tenants))
+	return meter
+}
+
+// allowQuota reports whether the caller may have n analyses, metering them.
+// Over a monthly quota it writes a 402 until the next month, over a daily
+// one a 429 with Retry-After until the next day.
+func (s *Server) allowQuota(w http.ResponseWriter, r *http.Request, n int) bool {
+	if s.quotas == nil {
+		return true
+	}
+	subject, tenant := caller(r)
+	now := time.Now()
+	result := s.quotas.Allow(subject, tenant, int64(n), now)
+	if result.Allowed {
+		return true
+	}
+
+	message := fmt.Sprintf("the %s quota of %s %s has %d of %d analyses used, too many for %d more; it resets at %s",
+		result.Period, result.Scope, result.Name, result.Used, result.Limit, n, result.ResetAt.Format(time.RFC3339))
+	if result.Period == quota.PeriodMonthly {
+		apierror.Write(w, message, http.StatusPaymentRequired)
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(result.ResetAt.Sub(now).Seconds())+1))
+	apierror.Write(w, message, http.StatusTooManyRequests)
+	return false
+}
+
+// usageHandler exports the metered usage for billing, by day or with
+// group=month by month, from the first of the month up to today by default.
+// format=csv returns it as CSV.
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) {
+	if s.quotas == nil {
+		apierror.Write(w, "quotas are not enabled", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	for name, value := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := time.Parse(time.DateOnly, raw)
+			if err != nil {
+				apierror.Write(w, name+" must be a date such as 2024-03-01", http.StatusBadRequest)
+				return
+			}
+			*value = parsed
+		}
+	}
+	group := query.Get("group")
+	if group != "" && group != "day" && group != "month" {
+		apierror.Write(w, "group must be day or month", http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		apierror.Write(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	records := s.quotas.Usage(from, to, query.Get("subject"), query.Get("tenant"), group == "month")
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+		out := csv.NewWriter(w)
+		out.Write([]string{"period", "tenant", "subject", "analyses", "rejected"})
+		for _, record := range records {
+			out.Write([]string{record.Period, record.Tenant, record.Subject,
+				strconv.FormatInt(record.Analyses, 10), strconv.FormatInt(record.Rejected, 10)})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			log.Printf("Error writing usage: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(UsageResponse{Usage: records}); err != nil {
+		log.Printf("Error encoding usage: %v", err)
+	}
+}
+
+// quotasHandler lists the quotas of subjects and tenants and their usage
+// this day and month
+func (s *Server) quotasHandler(w http.ResponseWriter, r *http.Request) {
+	if s.quotas == nil {
+		apierror.Write(w, "quotas are not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(QuotasResponse{Quotas: s.quotas.Statuses(time.Now())}); err != nil {
+		log.Printf("Error encoding quotas: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/recording"
+)
+
+// recordingsPath is never recorded itself, so retrieving a recording does
+// not add to it
+const recordingsPath = "/fraud/admin/recordings"
+
+type RecordingRequest struct {
+	Subject string `json:"subject" openapi:"required,minLength=1" doc:"Subject of the API key to record"`
+	Window  string `json:"window" openapi:"required" doc:"How long to record, e.g. 30m; at most RECORDING_MAX_WINDOW"`
+}
+
+type RecordingResponse struct {
+	Session   recording.Session    `json:"session"`
+	Exchanges []recording.Exchange `json:"exchanges,omitempty"`
+}
+
+type RecordingsResponse struct {
+	Recordings []RecordingResponse `json:"recordings" doc:"Exchanges are only listed when a subject is given"`
+}
+
+// recorder returns the request recorder configured by the RECORDING_*
+// variables
+func recorder() *recording.Recorder {
+	return recording.NewRecorder(recording.Config{
+		MaxWindow:    getEnvDuration("RECORDING_MAX_WINDOW", time.Hour),
+		Retention:    getEnvDuration("RECORDING_RETENTION", 24*time.Hour),
+		MaxExchanges: getEnvInt("RECORDING_MAX_EXCHANGES", 500),
+	})
+}
+
+// recordingsHandler starts, lists and discards recordings of the requests of
+// API keys. GET lists the exchanges of a recording when a subject is given.
+func (s *Server) recordingsHandler(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+
+	switch r.Method {
+	case http.MethodGet:
+		response := RecordingsResponse{Recordings: []RecordingResponse{}}
+		if subject == "" {
+			for _, session := range s.recorder.Sessions() {
+				response.Recordings = append(response.Recordings, RecordingResponse{Session: session})
+			}
+			writeRecordings(w, http.StatusOK, response)
+			return
+		}
+		session, exchanges, exists := s.recorder.Exchanges(subject)
+		if !exists {
+			apierror.Write(w, "no recording for subject: "+subject, http.StatusNotFound)
+			return
+		}
+		response.Recordings = append(response.Recordings, RecordingResponse{Session: session, Exchanges: exchanges})
+		writeRecordings(w, http.StatusOK, response)
+	case http.MethodPost:
+		var req RecordingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		window, err := time.ParseDuration(req.Window)
+		if err != nil {
+			apierror.Write(w, fmt.Sprintf("invalid window: %v", err), http.StatusBadRequest)
+			return
+		}
+		session, err := s.recorder.Start(req.Subject, window)
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Recording requests of %s until %s", session.Subject, session.Until.Format(time.RFC3339))
+		writeRecordings(w, http.StatusCreated, RecordingResponse{Session: session})
+	case http.MethodDelete:
+		session, exists := s.recorder.Delete(subject)
+		if !exists {
+			apierror.Write(w, "no recording for subject: "+subject, http.StatusNotFound)
+			return
+		}
+		log.Printf("Recording of %s discarded", subject)
+		writeRecordings(w, http.StatusOK, RecordingResponse{Session: session})
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeRecordings(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding recordings: %v", err)
+	}
+}
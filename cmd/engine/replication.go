@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/replication"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// sourceReplication is the source of rule changes received from another
+// region, which are not replicated again
+const sourceReplication = "replication"
+
+// maxReplicationBytes bounds the deltas received from peers
+const maxReplicationBytes = 16 << 20
+
+type ReplicationResponse struct {
+	Applied int `json:"applied"`
+}
+
+type ReplicationStatusResponse struct {
+	Region string                   `json:"region"`
+	Peers  []replication.PeerStatus `json:"peers"`
+}
+
+// replicationNode returns the node replicating lists, expression rules and
+// profile aggregates to the REPLICATION_PEERS of REPLICATION_REGION, nil when
+// no region is set
+func (s *Server) replicationNode() *replication.Node {
+	region := os.Getenv("REPLICATION_REGION")
+	if region == "" {
+		return nil
+	}
+	if s.replicationSecret == "" {
+		log.Fatalf("REPLICATION_SECRET is required with REPLICATION_REGION")
+	}
+	config := replication.DefaultConfig()
+	config.Region = region
+	config.Interval = getEnvDuration("REPLICATION_INTERVAL", config.Interval)
+	config.Path = os.Getenv("REPLICATION_FILE")
+	if peers := os.Getenv("REPLICATION_PEERS"); peers != "" {
+		config.Peers = strings.Split(peers, ",")
+	}
+
+	transport := replication.NewHTTPTransport(s.replicationSecret, getEnvDuration("REPLICATION_TIMEOUT", 5*time.Second))
+	node, err := replication.New(config, replicationTarget{s}, transport)
+	if err != nil {
+		log.Fatalf("Failed to start replication: %v", err)
+	}
+	log.Printf("Replicating region %s to %d peers", region, len(config.Peers))
+	return node
+}
+
+// replicationTarget applies the changes of other regions to the engine
+type replicationTarget struct {
+	s *Server
+}
+
+func (t replicationTarget) ApplyList(region, name string, values []string) {
+	t.s.rulesMu.Lock()
+	defer t.s.rulesMu.Unlock()
+	t.s.lists.Set(name, values)
+	t.s.fraudDetector.SetLists(t.s.lists)
+	t.s.recordVersion()
+	log.Printf("List %s replicated from %s with %d values", name, region, len(values))
+}
+
+func (t replicationTarget) ApplyRule(region, id string, spec *ruleset.Spec) {
+	t.s.rulesMu.Lock()
+	defer t.s.rulesMu.Unlock()
+
+	current := ruleset.FromRules(t.s.fraudDetector.GetActiveRules())
+	file := ruleset.File{Version: current.Version}
+	for _, rule := range current.Rules {
+		if rule.ID != id {
+			file.Rules = append(file.Rules, rule)
+		}
+	}
+	if spec != nil {
+		file.Rules = append(file.Rules, *spec)
+	}
+	if err := t.s.fraudDetector.ReplaceExpressionRules(file.ExpressionRules()); err != nil {
+		log.Printf("Failed to apply replicated rule %s: %v", id, err)
+		return
+	}
+	t.s.recordVersion()
+	t.s.recordRuleChangesBy(region, sourceReplication)
+}
+
+func (t replicationTarget) LocalProfileSlot(accountID string) (detector.ProfileSlot, bool) {
+	return t.s.fraudDetector.LocalProfileSlot(accountID)
+}
+
+func (t replicationTarget) MergeProfileSlot(accountID, region string, slot detector.ProfileSlot) bool {
+	return t.s.fraudDetector.MergeProfileSlot(accountID, region, slot)
+}
+
+// replicateRule sends a local rule change to the other regions
+func (s *Server) replicateRule(version ruleset.RuleVersion) {
+	if s.replication == nil || version.Source == sourceReplication {
+		return
+	}
+	if err := s.replication.SetRule(version.RuleID, version.Rule); err != nil {
+		log.Printf("Failed to replicate rule %s: %v", version.RuleID, err)
+	}
+}
+
+// replicateLists sends the lists of an applied bundle to the other regions,
+// emptying the lists it dropped
+func (s *Server) replicateLists(previous, lists map[string][]string) {
+	if s.replication == nil {
+		return
+	}
+	for name := range previous {
+		if _, kept := lists[name]; !kept {
+			lists[name] = nil
+		}
+	}
+	for name, values := range lists {
+		if err := s.replication.SetList(name, values); err != nil {
+			log.Printf("Failed to replicate list %s: %v", name, err)
+		}
+	}
+}
+
+// replicationHandler applies a delta signed by a peer region
+func (s *Server) replicationHandler(w http.ResponseWriter, r *http.Request) {
+	if s.replication == nil {
+		apierror.Write(w, "replication is not enabled", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReplicationBytes))
+	if err != nil {
+		apierror.Write(w, "delta too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := events.VerifySignature(s.replicationSecret, r.Header.Get(events.SignatureHeader), body, events.DefaultTolerance, time.Now()); err != nil {
+		apierror.Write(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var delta replication.Delta
+	if err := json.Unmarshal(body, &delta); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	applied, err := s.replication.Receive(delta)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ReplicationResponse{Applied: applied}); err != nil {
+		log.Printf("Error encoding replication response: %v", err)
+	}
+}
+
+// replicationStatusHandler serves the delivery status of each peer region
+func (s *Server) replicationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if s.replication == nil {
+		apierror.Write(w, "replication is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ReplicationStatusResponse{
+		Region: s.replication.Region(),
+		Peers:  s.replication.Status(),
+	}); err != nil {
+		log.Printf("Error encoding replication status: %v", err)
+	}
+}
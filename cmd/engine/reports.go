@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/report"
+)
+
+type ReportRequest struct {
+	Period string `json:"period" openapi:"required,enum=daily|weekly"`
+}
+
+type ReportsResponse struct {
+	Reports []report.Entry `json:"reports"`
+}
+
+// reportGenerator returns the generator of the REPORT_PERIODS reports,
+// delivered to REPORT_WEBHOOK_URL and by email to REPORT_EMAIL_TO when set
+func reportGenerator(store audit.Store) *report.Generator {
+	config := report.DefaultConfig()
+	if value := os.Getenv("REPORT_PERIODS"); value != "" {
+		config.Periods = strings.Split(value, ",")
+	}
+	if value := os.Getenv("REPORT_TIMEZONE"); value != "" {
+		location, err := time.LoadLocation(value)
+		if err != nil {
+			log.Fatalf("Invalid REPORT_TIMEZONE: %v", err)
+		}
+		config.Location = location
+	}
+	config.TopN = getEnvInt("REPORT_TOP_N", config.TopN)
+
+	var deliverers []report.Deliverer
+	if url := os.Getenv("REPORT_WEBHOOK_URL"); url != "" {
+		deliverers = append(deliverers, &report.Webhook{
+			URL:    url,
+			Secret: os.Getenv("REPORT_WEBHOOK_SECRET"),
+			Client: &http.Client{Timeout: 30 * time.Second},
+		})
+		log.Printf("Delivering fraud reports to %s", url)
+	}
+	if to := os.Getenv("REPORT_EMAIL_TO"); to != "" {
+		deliverers = append(deliverers, &report.Email{
+			Addr:     getEnv("REPORT_SMTP_ADDR", "localhost:25"),
+			From:     getEnv("REPORT_EMAIL_FROM", "fraud-reports@localhost"),
+			To:       strings.Split(to, ","),
+			Username: os.Getenv("REPORT_SMTP_USERNAME"),
+			Password: os.Getenv("REPORT_SMTP_PASSWORD"),
+		})
+		log.Printf("Emailing fraud reports to %s", to)
+	}
+
+	generator, err := report.NewGenerator(config, store, deliverers...)
+	if err != nil {
+		log.Fatalf("Failed to configure fraud reports: %v", err)
+	}
+	return generator
+}
+
+// reportsHandler lists the kept reports, most recent period first
+func (s *Server) reportsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ReportsResponse{Reports: s.reports.Reports()}); err != nil {
+		log.Printf("Error encoding reports: %v", err)
+	}
+}
+
+// generateReportHandler generates the report of the last complete period
+// now, without delivering it
+func (s *Server) generateReportHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	generated, err := s.reports.Generate(req.Period, time.Now())
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(generated); err != nil {
+		log.Printf("Error encoding report: %v", err)
+	}
+}
+
+// reportHandler serves a kept report as JSON, or as HTML or PDF with format
+func (s *Server) reportHandler(w http.ResponseWriter, r *http.Request) {
+	kept, exists := s.reports.Get(r.PathValue("id"))
+	if !exists {
+		apierror.Write(w, "report not found: "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(kept); err != nil {
+			log.Printf("Error encoding report: %v", err)
+		}
+	case "html":
+		page, err := report.HTML(kept)
+		if err != nil {
+			apierror.Write(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+kept.ID+`.pdf"`)
+		w.Write(report.PDF(kept))
+	default:
+		apierror.Write(w, "format must be json, html or pdf", http.StatusBadRequest)
+	}
+}
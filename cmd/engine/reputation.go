@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type ReputationRequest struct {
+	Score float64 `json:"score" openapi:"required,minimum=0,maximum=1" doc:"Fraud reputation from 0, clean, to 1; it decays from now on"`
+}
+
+// reputationHandler serves the current reputation of a device, IP or
+// merchant
+func (s *Server) reputationHandler(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	if !detector.ValidEntityKind(kind) {
+		apierror.Write(w, "unknown entity kind: "+kind, http.StatusNotFound)
+		return
+	}
+	writeReputation(w, s.fraudDetector.Reputation(kind, r.PathValue("id")))
+}
+
+// putReputationHandler grades a gray-area device, IP or merchant instead of
+// listing it
+func (s *Server) putReputationHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReputationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	reputation, err := s.fraudDetector.SetReputation(r.PathValue("kind"), r.PathValue("id"), req.Score)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Reputation of %s %s set to %.2f", reputation.Kind, reputation.ID, reputation.Score)
+	writeReputation(w, reputation)
+}
+
+func writeReputation(w http.ResponseWriter, reputation detector.ReputationScore) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reputation); err != nil {
+		log.Printf("Error encoding reputation: %v", err)
+	}
+}
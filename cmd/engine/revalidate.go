@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+)
+
+type RevalidateRequest struct {
+	TransactionID string `json:"transaction_id" openapi:"required,minLength=1"`
+}
+
+// expiresAt returns when a decision must be revalidated before capture
+func (s *Server) expiresAt(outcome *decision.Outcome) time.Time {
+	return outcome.DecidedAt.Add(s.decisionTTL)
+}
+
+// revalidateHandler re-checks a decision before the payment is captured.
+// Decisions within their TTL are returned unchanged; expired ones are
+// re-checked against the current velocity, rules and lists, audited and
+// valid for another TTL.
+func (s *Server) revalidateHandler(w http.ResponseWriter, r *http.Request) {
+	var req RevalidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.auditStore.Search(audit.Query{TransactionID: req.TransactionID, Limit: 1})
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		apierror.Write(w, "no decision found for transaction: "+req.TransactionID, http.StatusNotFound)
+		return
+	}
+	record := records[0]
+
+	start := time.Now()
+	if start.Before(record.ExpiresAt) {
+		response := FraudResponse{
+			TransactionID:  req.TransactionID,
+			RiskScore:      record.RiskScore,
+			Decision:       record.Decision,
+			Retry:          record.Retry,
+			Reasons:        record.Reasons,
+			ReasonCodes:    record.ReasonCodes,
+			Confidence:     record.Confidence,
+			ExpiresAt:      record.ExpiresAt,
+			ProcessingTime: time.Since(start).String(),
+			Metadata: map[string]interface{}{
+				"revalidated": false,
+				"decided_at":  record.DecidedAt,
+			},
+		}
+		s.applyObserveOnly(record.Transaction.MerchantID, &response)
+		s.responseBranding(r).apply(&response)
+		writeRevalidation(w, response)
+		return
+	}
+
+	transaction := record.Transaction
+	outcome, err := s.scorer.Revalidate(&transaction, record.Decision)
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.record(&transaction, outcome, time.Since(start))
+	if outcome.Decision != record.Decision {
+		log.Printf("Revalidation of %s changed the decision from %s to %s", req.TransactionID, record.Decision, outcome.Decision)
+	}
+
+	response := FraudResponse{
+		TransactionID:  req.TransactionID,
+		RiskScore:      outcome.FinalScore,
+		Decision:       outcome.Decision,
+		Retry:          outcome.Retry,
+		Reasons:        outcome.Detection.Reasons,
+		ReasonCodes:    outcome.Detection.ReasonCodes,
+		Confidence:     outcome.Confidence,
+		ExpiresAt:      s.expiresAt(outcome),
+		ProcessingTime: time.Since(start).String(),
+		Splits:         splitResults(outcome),
+		Metadata: map[string]interface{}{
+			"revalidated":       true,
+			"decided_at":        outcome.DecidedAt,
+			"previous_decision": record.Decision,
+		},
+	}
+	s.applyObserveOnly(transaction.MerchantID, &response)
+	s.responseBranding(r).apply(&response)
+	writeRevalidation(w, response)
+}
+
+func writeRevalidation(w http.ResponseWriter, response FraudResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding revalidation: %v", err)
+	}
+}
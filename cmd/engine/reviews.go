@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+)
+
+type ReviewCasesResponse struct {
+	Count int           `json:"count"`
+	Cases []review.Case `json:"cases" doc:"Highest triage score first, or oldest first with order=oldest"`
+}
+
+type ReviewResolutionRequest struct {
+	Decision string `json:"decision" openapi:"required" doc:"APPROVE or DECLINE"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type ReviewSLAResponse struct {
+	Tenants []review.TenantSummary `json:"tenants"`
+}
+
+// reviewQueue returns the queue of REVIEW decisions, keeping up to
+// REVIEW_RETAINED_CASES resolved cases and triaged with the weights of
+// REVIEW_TRIAGE_MODEL_FILE when set
+func reviewQueue(overrides *config.Store, observer review.Observer) *review.Queue {
+	queue := review.NewQueue(overrides.ReviewSLA, getEnvInt("REVIEW_RETAINED_CASES", 10000))
+	queue.SetObserver(observer)
+	if path := os.Getenv("REVIEW_TRIAGE_MODEL_FILE"); path != "" {
+		queue.SetTriager(triageModel(path))
+	}
+	return queue
+}
+
+// triageModel reads the weights of the review triage model, keeping the
+// default ones of the weights left out
+func triageModel(path string) review.TriageModel {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to load the review triage model: %v", err)
+	}
+	model := review.DefaultTriageModel()
+	if err := json.Unmarshal(data, &model); err != nil {
+		log.Fatalf("Invalid REVIEW_TRIAGE_MODEL_FILE: %v", err)
+	}
+	if err := model.Validate(); err != nil {
+		log.Fatalf("Invalid REVIEW_TRIAGE_MODEL_FILE: %v", err)
+	}
+	log.Printf("Triaging review cases with the model of %s", path)
+	return model
+}
+
+// reviewEntities returns the entities of a transaction by which decisions
+// are linked to review cases
+func reviewEntities(tx *detector.Transaction) []string {
+	var entities []string
+	for prefix, value := range map[string]string{"account:": tx.AccountID, "device:": tx.DeviceID, "ip:": tx.IPAddress} {
+		if value != "" {
+			entities = append(entities, prefix+value)
+		}
+	}
+	sort.Strings(entities)
+	return entities
+}
+
+// enqueueReview links a decision to the waiting review cases sharing its
+// account, device or IP address, which the queue triages again, and queues
+// it for analysts when it is a REVIEW. Observe-only decisions are approved
+// regardless, so they are not queued.
+func (s *Server) enqueueReview(record audit.Record) {
+	tx := &record.Transaction
+	entities := reviewEntities(tx)
+	s.reviews.Observe(entities, review.Link{TransactionID: tx.ID, Decision: record.Decision}, record.DecidedAt)
+	if record.Decision != decision.Review || record.ObserveOnly {
+		return
+	}
+	layer, _ := s.overrides.Merchant(tx.MerchantID)
+	s.reviews.Enqueue(review.Case{
+		TransactionID: tx.ID,
+		MerchantID:    tx.MerchantID,
+		Tenant:        layer.Tenant,
+		RiskScore:     record.RiskScore,
+		ReasonCodes:   record.ReasonCodes,
+		EnqueuedAt:    record.DecidedAt,
+		Amount:        tx.Amount,
+		Currency:      tx.Currency,
+		Entities:      entities,
+	}, s.reviewLinks(tx)...)
+}
+
+// reviewLinks returns the audited decisions sharing the account, device or
+// IP address of a transaction, the latest 100 of each
+func (s *Server) reviewLinks(tx *detector.Transaction) []review.Link {
+	var links []review.Link
+	seen := map[string]bool{tx.ID: true}
+	for _, query := range []audit.Query{
+		{AccountID: tx.AccountID, Limit: audit.DefaultSearchLimit},
+		{DeviceID: tx.DeviceID, Limit: audit.DefaultSearchLimit},
+		{IPAddress: tx.IPAddress, Limit: audit.DefaultSearchLimit},
+	} {
+		if query.AccountID == "" && query.DeviceID == "" && query.IPAddress == "" {
+			continue
+		}
+		records, err := s.auditStore.Search(query)
+		if err != nil {
+			log.Printf("Failed to link the decisions related to review %s: %v", tx.ID, err)
+			continue
+		}
+		for _, record := range records {
+			if !seen[record.Transaction.ID] {
+				seen[record.Transaction.ID] = true
+				links = append(links, review.Link{TransactionID: record.Transaction.ID, Decision: record.Decision})
+			}
+		}
+	}
+	return links
+}
+
+// publishReviews sends the decision events of resolved review cases, so the
+// webhooks and payment gateways act on the final decision
+func (s *Server) publishReviews(cases []review.Case) {
+	for _, c := range cases {
+		if c.Resolution == "" {
+			continue
+		}
+		records, err := s.auditStore.Search(audit.Query{TransactionID: c.TransactionID, Limit: 1})
+		if err != nil || len(records) == 0 {
+			log.Printf("No decision found to publish the review resolution of %s", c.TransactionID)
+			continue
+		}
+		record := records[0]
+		record.Decision = c.Resolution
+		record.DecidedAt = *c.ResolvedAt
+		s.publish(record)
+	}
+}
+
+// reviewsHandler lists the review cases, optionally by status and tenant,
+// ranked by triage score or oldest first. Callers of a tenant only see its
+// cases.
+func (s *Server) reviewsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && status != review.StatusOpen && status != review.StatusEscalated && status != review.StatusResolved {
+		apierror.Write(w, "status must be open, escalated or resolved", http.StatusBadRequest)
+		return
+	}
+	tenant := query.Get("tenant")
+	if _, own := caller(r); own != "" {
+		if tenant != "" && tenant != own {
+			apierror.Write(w, "the review queue of tenant "+tenant+" is not accessible", http.StatusForbidden)
+			return
+		}
+		tenant = own
+	}
+	var cases []review.Case
+	switch query.Get("order") {
+	case "", "impact":
+		cases = s.reviews.Ranked(status, tenant, time.Now())
+	case "oldest":
+		cases = s.reviews.List(status, tenant, time.Now())
+	default:
+		apierror.Write(w, "order must be impact or oldest", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ReviewCasesResponse{Count: len(cases), Cases: cases}); err != nil {
+		log.Printf("Error encoding review cases: %v", err)
+	}
+}
+
+// reviewHandler returns a review case
+func (s *Server) reviewHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.reviewCase(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeReviewCase(w, c)
+}
+
+// resolveReviewHandler approves or declines a waiting review case on behalf
+// of the caller and publishes the final decision
+func (s *Server) resolveReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReviewResolutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if _, ok := s.reviewCase(w, r, id); !ok {
+		return
+	}
+	analyst, _ := caller(r)
+	c, err := s.reviews.Resolve(id, req.Decision, analyst, req.Comment, time.Now())
+	switch {
+	case errors.Is(err, review.ErrNotFound):
+		apierror.Write(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, review.ErrInvalidDecision):
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		apierror.Write(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("Review of %s resolved with %s by %s", c.TransactionID, c.Resolution, analyst)
+	s.publishReviews([]review.Case{c})
+	writeReviewCase(w, c)
+}
+
+// reviewCase returns a review case the caller may see, writing a 404 when
+// there is none
+func (s *Server) reviewCase(w http.ResponseWriter, r *http.Request, id string) (review.Case, bool) {
+	c, exists := s.reviews.Get(id, time.Now())
+	if _, tenant := caller(r); exists && tenant != "" && c.Tenant != tenant {
+		exists = false
+	}
+	if !exists {
+		apierror.Write(w, review.ErrNotFound.Error(), http.StatusNotFound)
+		return review.Case{}, false
+	}
+	return c, true
+}
+
+func writeReviewCase(w http.ResponseWriter, c review.Case) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		log.Printf("Error encoding review case: %v", err)
+	}
+}
+
+// reviewSLAHandler reports the review queue and SLA breaches of every
+// tenant, or of the caller's tenant
+func (s *Server) reviewSLAHandler(w http.ResponseWriter, r *http.Request) {
+	var tenants []string
+	for tenant := range s.overrides.Hierarchy().Tenants {
+		tenants = append(tenants, tenant)
+	}
+	summaries := s.reviews.Summary(tenants, time.Now())
+	if _, own := caller(r); own != "" {
+		var filtered []review.TenantSummary
+		for _, summary := range summaries {
+			if summary.Tenant == own {
+				filtered = append(filtered, summary)
+			}
+		}
+		summaries = filtered
+	}
+	if summaries == nil {
+		summaries = []review.TenantSummary{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ReviewSLAResponse{Tenants: summaries}); err != nil {
+		log.Printf("Error encoding review SLA report: %v", err)
+	}
+}
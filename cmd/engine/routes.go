@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/metrics"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/openapi"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/replication"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/router"
+)
+
+// routes registers every API endpoint behind the shared middleware chain:
+// request metrics, panic recovery, the access log when ACCESS_LOG is true,
+// authentication, traffic recording and request validation
+func (s *Server) routes(spec *openapi.Document, registry *metrics.Registry) *router.Router {
+	r := router.New()
+	r.Use(router.Metrics(s.metrics), router.Recover)
+	if os.Getenv("ACCESS_LOG") == "true" {
+		r.Use(router.Logging)
+	}
+	r.Use(
+		withAuth,
+		func(next http.Handler) http.Handler { return s.recorder.Middleware(next, recordingsPath) },
+		spec.Middleware,
+	)
+
+	r.HandleFunc(http.MethodGet, "/health", s.healthHandler)
+	r.Handle(http.MethodPost, "/fraud/analyze", s.partitioned(transactionAccount, s.analyzeTransactionHandler))
+	r.Handle(http.MethodPost, "/fraud/batch", s.partitioned(batchAccounts, s.batchAnalysisHandler))
+	r.HandleFunc(http.MethodGet, "/fraud/batch/{job_id}", s.batchJobHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/revalidate", s.revalidateHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/signups", s.signupHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/feedback", s.feedbackHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/feedback/batch", s.feedbackBatchHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/fairness", s.fairnessHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/corridors", s.corridorsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/merchants", s.merchantsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/merchants/{id}", s.merchantProfileHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/merchants/{id}", s.putMerchantHandler)
+	r.HandleFunc(http.MethodDelete, "/fraud/merchants/{id}", s.deleteMerchantHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/calendar", s.calendarHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/calendar", s.putCalendarHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/feature-flags", s.featureFlagsHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/feature-flags", s.putFeatureFlagsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/amount-limits", s.amountLimitsHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/amount-limits", s.putAmountLimitsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/reports", s.reportsHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/reports", s.generateReportHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/reports/{id}", s.reportHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/train", s.trainModelHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/jobs", s.jobsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/jobs/{id}", s.jobHandler)
+	r.HandleFunc(http.MethodDelete, "/fraud/jobs/{id}", s.cancelJobHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/near-misses", s.nearMissesHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/near-misses/mine", s.mineNearMissesHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/stats", s.statisticsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/scenarios", s.scenariosHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/scenarios", s.scenariosHandler)
+	r.HandleFunc(http.MethodPost, replication.Path, s.replicationHandler)
+	r.HandleFunc(http.MethodGet, replication.Path+"/status", s.replicationStatusHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/partition", s.partitionHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/admin/tenant-isolation", s.tenantIsolationHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/annotations", s.annotateHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/annotations", s.annotationsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/annotations/tags", s.annotationTagsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/annotations/{id}/attachments/{name}", s.annotationAttachmentHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/throttled-merchants", s.throttledMerchantsHandler)
+	r.HandleFunc(http.MethodDelete, "/fraud/throttled-merchants/{id}", s.releaseMerchantHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/network-alerts", s.networkAlertsHandler)
+	r.HandleFunc(http.MethodDelete, "/fraud/network-alerts/{entity}", s.clearNetworkAlertHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/usage", s.usageHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/quotas", s.quotasHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/reviews", s.reviewsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/reviews/sla", s.reviewSLAHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/reviews/{id}", s.reviewHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/reviews/{id}/resolve", s.resolveReviewHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/webhooks/{id}/deliveries", s.webhookDeliveriesHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/webhooks/{id}/replay", s.webhookReplayHandler)
+
+	r.HandleFunc(http.MethodGet, "/fraud/rules", s.rulesHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/rules", s.rulesHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/rules/export", s.rulesExportHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/rules/import", s.rulesImportHandler)
+	r.HandleFunc(http.MethodDelete, "/fraud/rules/{id}/quarantine", s.ruleQuarantineHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/rules/{id}/history", s.ruleHistoryHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/rules/{id}/rollback", s.ruleRollbackHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/rule-changes", s.ruleChangesHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/rule-changes/{id}", s.ruleChangeHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/rule-changes/{id}/approve", s.approveRuleChangeHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/rule-changes/{id}/reject", s.rejectRuleChangeHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/bundles", s.bundlesHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/bundles/export", s.bundleExportHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/bundles/import", s.bundleImportHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/bundles/rollback", s.bundleRollbackHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/configs", s.configsHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/configs", s.configsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/overrides", s.overridesHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/overrides", s.overridesHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/overrides/effective", s.effectiveConfigHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/orgs", s.orgsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/orgs/{id}", s.orgHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/orgs/{id}", s.putOrgHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/orgs/{id}/stats", s.orgStatsHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/admin/decision-diff", s.decisionDiffHandler)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		r.HandleFunc(method, "/fraud/models/canary", s.canaryHandler)
+		r.HandleFunc(method, "/fraud/admin/chaos", s.chaosHandler)
+		r.HandleFunc(method, recordingsPath, s.recordingsHandler)
+	}
+	r.HandleFunc(http.MethodGet, "/fraud/models/online", s.onlineModelHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/models/{version}/feature-importance", s.featureImportanceHandler)
+
+	r.HandleFunc(http.MethodGet, "/fraud/customers/{id}", s.customerHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/beneficiaries/{id}", s.beneficiaryHandler)
+	r.HandleFunc(http.MethodPost, "/fraud/beneficiaries/{id}/labels", s.beneficiaryLabelHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/reputation/{kind}/{id}", s.reputationHandler)
+	r.HandleFunc(http.MethodPut, "/fraud/reputation/{kind}/{id}", s.putReputationHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/search", s.searchHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/events", s.eventsHandler)
+	r.HandleFunc(http.MethodGet, "/fraud/promotions/decisions", s.promoDecisionsHandler)
+
+	r.HandleFunc(http.MethodGet, merchantPath+"trusted-customers", s.merchantTrustedCustomersHandler)
+	r.HandleFunc(http.MethodPut, merchantPath+"trusted-customers", s.merchantTrustedCustomersHandler)
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		r.HandleFunc(method, merchantPath+"webhook", s.merchantWebhookHandler)
+	}
+	r.HandleFunc(http.MethodGet, merchantPath+"webhook/deliveries", s.merchantWebhookDeliveriesHandler)
+	r.HandleFunc(http.MethodPost, merchantPath+"webhook/replay", s.merchantWebhookReplayHandler)
+	r.HandleFunc(http.MethodGet, merchantPath+"decisions", s.merchantDecisionsHandler)
+	r.HandleFunc(http.MethodGet, merchantPath+"stats", s.merchantStatsHandler)
+
+	r.Handle(http.MethodGet, "/metrics", registry)
+	r.Handle(http.MethodGet, "/openapi.json", spec)
+	return r
+}
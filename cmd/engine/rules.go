@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+// maxRuleFileBytes caps the size of an imported rule file
+const maxRuleFileBytes = 1 << 20
+
+type RuleImportResponse struct {
+	DryRun  bool         `json:"dry_run"`
+	Applied bool         `json:"applied"`
+	Rules   int          `json:"rules"`
+	Diff    ruleset.Diff `json:"diff"`
+}
+
+type RuleHistoryResponse struct {
+	RuleID   string                `json:"rule_id"`
+	Versions []ruleset.RuleVersion `json:"versions"`
+}
+
+type RuleRollbackRequest struct {
+	Version int `json:"version" openapi:"required,minimum=1"`
+}
+
+// rulesExportHandler writes the full rule set as YAML
+func (s *Server) rulesExportHandler(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := ruleset.Encode(&buf, ruleset.FromRules(s.fraudDetector.GetActiveRules())); err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Error writing rule export: %v", err)
+	}
+}
+
+// rulesImportHandler replaces the expression rules with those of a YAML rule
+// file. Every rule is validated before any is applied; with dry_run=true the
+// diff is returned and nothing changes.
+func (s *Server) rulesImportHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	file, err := ruleset.Decode(http.MaxBytesReader(w, r.Body, maxRuleFileBytes))
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	current := ruleset.FromRules(s.fraudDetector.GetActiveRules())
+	if err := file.CheckBuiltins(current); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !dryRun && s.submitRuleChange(w, r, ruleset.Proposal{Source: "import", Set: expressionSpecs(file), Replace: true}) {
+		return
+	}
+	rules := file.ExpressionRules()
+	if dryRun {
+		err = s.fraudDetector.CheckExpressionRules(rules)
+	} else {
+		err = s.fraudDetector.ReplaceExpressionRules(rules)
+	}
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := RuleImportResponse{
+		DryRun:  dryRun,
+		Applied: !dryRun,
+		Rules:   len(rules),
+		Diff:    ruleset.Compare(current, file),
+	}
+	if !dryRun {
+		s.recordVersion()
+		s.recordRuleChanges(r, "import")
+		log.Printf("Imported %d expression rules: %d added, %d removed, %d changed",
+			len(rules), len(response.Diff.Added), len(response.Diff.Removed), len(response.Diff.Changed))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding rule import response: %v", err)
+	}
+}
+
+// recordRuleChanges records a version of every expression rule a request
+// created, changed or deleted, authored by the caller
+func (s *Server) recordRuleChanges(r *http.Request, source string) {
+	author, _ := caller(r)
+	s.recordRuleChangesBy(author, source)
+}
+
+// recordRuleChangesBy records a version of every expression rule created,
+// changed or deleted since the last recorded versions
+func (s *Server) recordRuleChangesBy(author, source string) {
+	current := ruleset.FromRules(s.fraudDetector.GetActiveRules())
+	for _, version := range s.ruleHistory.Record(current, author, source, time.Now()) {
+		log.Printf("Rule %s %s by %s through %s (version %d)", version.RuleID, version.Change, author, source, version.Version)
+		s.replicateRule(version)
+	}
+}
+
+// ruleHistoryHandler lists every version of an expression rule, oldest
+// first, each with its changes from the version before
+func (s *Server) ruleHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.PathValue("id")
+	versions, exists := s.ruleHistory.Versions(ruleID)
+	if !exists {
+		apierror.Write(w, "rule has no history: "+ruleID, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(RuleHistoryResponse{RuleID: ruleID, Versions: versions}); err != nil {
+		log.Printf("Error encoding rule history: %v", err)
+	}
+}
+
+// ruleRollbackHandler restores an expression rule as of a version, deleting
+// it when it was deleted in that version. The restore is recorded as a new
+// version.
+func (s *Server) ruleRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.PathValue("id")
+	var req RuleRollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	target, exists := s.ruleHistory.Version(ruleID, req.Version)
+	if !exists {
+		apierror.Write(w, "rule version not found", http.StatusNotFound)
+		return
+	}
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+
+	proposal := ruleset.Proposal{Source: "rollback", Delete: []string{ruleID}}
+	if target.Rule != nil {
+		proposal = ruleset.Proposal{Source: "rollback", Set: []ruleset.Spec{*target.Rule}}
+	}
+	if s.submitRuleChange(w, r, proposal) {
+		return
+	}
+
+	var rules []detector.Rule
+	for _, rule := range ruleset.FromRules(s.fraudDetector.GetActiveRules()).ExpressionRules() {
+		if rule.ID != ruleID {
+			rules = append(rules, rule)
+		}
+	}
+	if target.Rule != nil {
+		rules = append(rules, ruleset.File{Rules: []ruleset.Spec{*target.Rule}}.ExpressionRules()...)
+	}
+	if err := s.fraudDetector.ReplaceExpressionRules(rules); err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.recordVersion()
+	s.recordRuleChanges(r, "rollback")
+
+	versions, _ := s.ruleHistory.Versions(ruleID)
+	log.Printf("Rule %s rolled back to version %d", ruleID, req.Version)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions[len(versions)-1]); err != nil {
+		log.Printf("Error encoding rule rollback: %v", err)
+	}
+}
+
+// expressionSpecs returns the expression rules of a rule file
+func expressionSpecs(file ruleset.File) []ruleset.Spec {
+	var specs []ruleset.Spec
+	for _, spec := range file.Rules {
+		if !spec.Builtin {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// sandboxCaller reports whether a request comes from sandbox credentials
+func sandboxCaller(r *http.Request) bool {
+	principal, authenticated := auth.FromContext(r.Context())
+	return authenticated && principal.Sandbox
+}
+
+// analyzeSandbox answers /fraud/analyze for sandbox credentials. Nothing is
+// audited, published or learned from, and the live state is left untouched.
+func (s *Server) analyzeSandbox(w http.ResponseWriter, req TransactionRequest, v verbosity, b Branding, start time.Time) {
+	outcome := s.sandbox.Score(convertToInternalTransaction(req))
+	response := FraudResponse{
+		TransactionID:  req.ID,
+		RiskScore:      outcome.FinalScore,
+		Decision:       outcome.Decision,
+		Retry:          outcome.Retry,
+		Reasons:        outcome.Detection.Reasons,
+		ReasonCodes:    outcome.Detection.ReasonCodes,
+		Confidence:     outcome.Confidence,
+		ExpiresAt:      s.expiresAt(outcome),
+		ProcessingTime: time.Since(start).String(),
+		Metadata: map[string]interface{}{
+			"rule_score": outcome.Detection.Score,
+			"ml_score":   outcome.MLScore,
+			"version":    engineVersion,
+			"sandbox":    true,
+		},
+	}
+	b.apply(&response)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v.body(response)); err != nil {
+		log.Printf("Error encoding sandbox response: %v", err)
+	}
+}
+
+// sandboxOutcomes decides a batch of sandbox credentials
+func (s *Server) sandboxOutcomes(transactions []*detector.Transaction) []*decision.Outcome {
+	outcomes := make([]*decision.Outcome, len(transactions))
+	for i, transaction := range transactions {
+		outcomes[i] = s.sandbox.Score(transaction)
+	}
+	return outcomes
+}
+
+// sandboxScorer returns the sandbox scorer, seeded with SANDBOX_SEED to vary
+// the scores of sandbox transactions
+func sandboxScorer() *decision.Sandbox {
+	return decision.NewSandbox(uint64(getEnvInt("SANDBOX_SEED", 0)))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stats"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+type ScenariosRequest struct {
+	Scenarios []stats.Scenario `json:"scenarios" doc:"Replaces every scenario"`
+}
+
+type ScenariosResponse struct {
+	Scenarios []stats.ScenarioState `json:"scenarios" doc:"Each with its aggregate of the current window"`
+}
+
+// scenarioAlerting returns the scenario alert rules of SCENARIOS_FILE and the
+// sender of their alerts to SCENARIO_WEBHOOK_URL, nil when no webhook is set
+func scenarioAlerting() (*stats.Scenarios, *alertSender) {
+	var scenarios []stats.Scenario
+	if path := os.Getenv("SCENARIOS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load the scenarios: %v", err)
+		}
+		if err := json.Unmarshal(data, &scenarios); err != nil {
+			log.Fatalf("Invalid SCENARIOS_FILE: %v", err)
+		}
+	}
+	monitor, err := stats.NewScenarios(scenarios)
+	if err != nil {
+		log.Fatalf("Invalid SCENARIOS_FILE: %v", err)
+	}
+	if len(scenarios) > 0 {
+		log.Printf("Loaded %d scenario alert rules", len(scenarios))
+	}
+
+	var sender *alertSender
+	if url := os.Getenv("SCENARIO_WEBHOOK_URL"); url != "" {
+		sender = newAlertSender(url, os.Getenv("SCENARIO_WEBHOOK_SECRET"))
+		log.Printf("Delivering scenario alerts to %s", url)
+	}
+	return monitor, sender
+}
+
+// recordScenarios counts a decision against the scenario alert rules
+func (s *Server) recordScenarios(transaction *detector.Transaction, outcome *decision.Outcome) {
+	s.scenarios.Record(stats.Sample{
+		MerchantID:  transaction.MerchantID,
+		Decision:    outcome.Decision,
+		RiskLevel:   outcome.Detection.Risk,
+		ReasonCodes: outcome.Detection.ReasonCodes,
+		At:          outcome.DecidedAt,
+	})
+}
+
+// notifyScenarios logs, counts and delivers the alerts of scenarios that
+// fired or resolved
+func (s *Server) notifyScenarios(alerts []stats.ScenarioAlert) {
+	for _, alert := range alerts {
+		if alert.Status == stats.StatusFiring {
+			log.Printf("ALERT: scenario %s is firing: %s %.4f over %.4f within %s", alert.Scenario, alert.Aggregate, alert.Value, alert.Threshold, alert.Window)
+		} else {
+			log.Printf("Scenario %s resolved: %s %.4f within %s", alert.Scenario, alert.Aggregate, alert.Value, alert.Window)
+		}
+		s.metrics.ObserveScenarioAlert(alert.Scenario, alert.Status)
+		if s.scenarioAlerts != nil {
+			s.scenarioAlerts.Send("scenario "+alert.Scenario, scenarioAlertEvent(alert))
+		}
+	}
+}
+
+// scenarioAlertEvent returns the event of a scenario alert
+func scenarioAlertEvent(alert stats.ScenarioAlert) *events.ScenarioAlertEvent {
+	return &events.ScenarioAlertEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       alert.Scenario + ":" + alert.Status + ":" + strconv.FormatInt(alert.EvaluatedAt.UnixNano(), 10),
+		OccurredAt:    alert.EvaluatedAt.UTC(),
+		Scenario:      alert.Scenario,
+		Description:   alert.Description,
+		Status:        alert.Status,
+		MerchantID:    alert.MerchantID,
+		Aggregate:     alert.Aggregate,
+		Value:         alert.Value,
+		Threshold:     alert.Threshold,
+		Matched:       alert.Matched,
+		Total:         alert.Total,
+		Window:        alert.Window,
+		FiringSince:   alert.FiringSince,
+	}
+}
+
+// scenariosHandler serves and replaces the scenario alert rules. Callers of a
+// tenant only see the scenarios of its merchants; scenarios watch decisions
+// across tenants, so they are replaced by the operator.
+func (s *Server) scenariosHandler(w http.ResponseWriter, r *http.Request) {
+	_, tenant := caller(r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if tenant != "" {
+			apierror.Write(w, "scenarios span tenants and are set by the operator", http.StatusForbidden)
+			return
+		}
+		var req ScenariosRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			apierror.Write(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.scenarios.Set(req.Scenarios); err != nil {
+			apierror.Write(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Scenario alert rules replaced: %d scenarios", len(req.Scenarios))
+	default:
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	states := s.scenarios.States(time.Now())
+	if tenant != "" {
+		visible := []stats.ScenarioState{}
+		for _, state := range states {
+			if layer, _ := s.overrides.Merchant(state.MerchantID); state.MerchantID != "" && layer.Tenant == tenant {
+				visible = append(visible, state)
+			}
+		}
+		states = visible
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ScenariosResponse{Scenarios: states}); err != nil {
+		log.Printf("Error encoding scenarios: %v", err)
+	}
+}
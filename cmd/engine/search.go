@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+)
+
+type SearchResponse struct {
+	Count   int            `json:"count"`
+	Records []audit.Record `json:"records"`
+}
+
+// searchQueryParams are the query parameters of /fraud/search
+var searchQueryParams = []string{"q", "tx", "account", "ip", "device", "merchant", "code", "decision", "min_amount", "max_amount", "since", "until", "limit", "tag"}
+
+// searchHandler finds audited decisions related to a transaction, IP,
+// device, merchant, amount range or reason code, or annotated with a tag
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var records []audit.Record
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		records, err = s.annotatedRecords(tag, query)
+	} else {
+		records, err = s.auditStore.Search(query)
+	}
+	if err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SearchResponse{
+		Count:   len(records),
+		Records: records,
+	}); err != nil {
+		log.Printf("Error encoding search results: %v", err)
+	}
+}
+
+// parseSearchQuery combines the free-form q parameter with the structured
+// ones, which take precedence
+func parseSearchQuery(params url.Values) (audit.Query, error) {
+	query, err := audit.ParseQuery(params.Get("q"))
+	if err != nil {
+		return query, err
+	}
+
+	for param, field := range map[string]*string{
+		"tx":       &query.TransactionID,
+		"account":  &query.AccountID,
+		"ip":       &query.IPAddress,
+		"device":   &query.DeviceID,
+		"merchant": &query.MerchantID,
+		"code":     &query.ReasonCode,
+		"decision": &query.Decision,
+	} {
+		if value := params.Get(param); value != "" {
+			*field = value
+		}
+	}
+
+	for param, bound := range map[string]**float64{
+		"min_amount": &query.MinAmount,
+		"max_amount": &query.MaxAmount,
+	} {
+		if value := params.Get(param); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s %q", param, value)
+			}
+			*bound = &amount
+		}
+	}
+
+	for param, t := range map[string]*time.Time{
+		"since": &query.Since,
+		"until": &query.Until,
+	} {
+		if value := params.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s %q: must be RFC 3339", param, value)
+			}
+			*t = parsed
+		}
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit %q", value)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
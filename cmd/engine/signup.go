@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+type SignupRequest struct {
+	AccountID string    `json:"account_id" openapi:"required,minLength=1"`
+	DeviceID  string    `json:"device_id"`
+	IPAddress string    `json:"ip_address"`
+	EmailHash string    `json:"email_hash" doc:"Hash of the normalized email address, never the address itself"`
+	PhoneHash string    `json:"phone_hash" doc:"Hash of the normalized phone number, never the number itself"`
+	Timestamp time.Time `json:"timestamp" doc:"When the account was created; defaults to now"`
+}
+
+type SignupResponse struct {
+	AccountID      string                 `json:"account_id"`
+	RiskScore      float64                `json:"risk_score"`
+	Decision       string                 `json:"decision"`
+	Reasons        []string               `json:"reasons,omitempty"`
+	ReasonCodes    []string               `json:"reason_codes,omitempty"`
+	Matches        []detector.SignupMatch `json:"matches,omitempty" doc:"Existing accounts sharing each attribute with the signup"`
+	ProcessingTime string                 `json:"processing_time"`
+}
+
+// signupHandler scores an account-creation event for duplicate and serial
+// accounts before they transact
+func (s *Server) signupHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req SignupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	result := s.fraudDetector.CheckSignup(detector.Signup{
+		AccountID: req.AccountID,
+		DeviceID:  req.DeviceID,
+		IPAddress: req.IPAddress,
+		EmailHash: req.EmailHash,
+		PhoneHash: req.PhoneHash,
+		Timestamp: req.Timestamp,
+	})
+	response := SignupResponse{
+		AccountID:      req.AccountID,
+		RiskScore:      result.Score,
+		Decision:       s.scorer.Policy().Decide(result.Score, &detector.FraudScore{Score: result.Score}),
+		Reasons:        result.Reasons,
+		ReasonCodes:    result.Codes,
+		Matches:        result.Matches,
+		ProcessingTime: time.Since(start).String(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding signup response: %v", err)
+	}
+}
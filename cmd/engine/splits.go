@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// splitTolerance absorbs rounding when comparing leg amounts with the total
+const splitTolerance = 0.01
+
+type SplitInfo struct {
+	MerchantID      string  `json:"merchant_id" openapi:"required,minLength=1" doc:"Sub-merchant paid out the leg"`
+	Amount          float64 `json:"amount" openapi:"required,exclusiveMinimum=0"`
+	MerchantCountry string  `json:"merchant_country,omitempty" doc:"Defaults to the country of the sub-merchant profile"`
+	MCC             string  `json:"mcc,omitempty" doc:"Defaults to the MCC of the sub-merchant profile"`
+}
+
+// SplitResult is the decision on one leg of a split payment
+type SplitResult struct {
+	MerchantID  string   `json:"merchant_id"`
+	Amount      float64  `json:"amount"`
+	RiskScore   float64  `json:"risk_score"`
+	Decision    string   `json:"decision"`
+	Reasons     []string `json:"reasons,omitempty"`
+	ReasonCodes []string `json:"reason_codes,omitempty"`
+}
+
+// validateSplits checks that the legs of a split payment add up to no more
+// than its amount; the rest stays with the marketplace
+func validateSplits(req TransactionRequest) error {
+	total := 0.0
+	for i, split := range req.Splits {
+		if split.MerchantID == "" {
+			return fmt.Errorf("splits[%d]: merchant_id is required", i)
+		}
+		if split.Amount <= 0 {
+			return fmt.Errorf("splits[%d]: amount must be positive", i)
+		}
+		total += split.Amount
+	}
+	if total > req.Amount+splitTolerance {
+		return fmt.Errorf("splits add up to %.2f, more than the amount of %.2f", total, req.Amount)
+	}
+	return nil
+}
+
+func convertSplits(splits []SplitInfo) []detector.Split {
+	if len(splits) == 0 {
+		return nil
+	}
+	converted := make([]detector.Split, len(splits))
+	for i, split := range splits {
+		converted[i] = detector.Split{
+			MerchantID:      split.MerchantID,
+			Amount:          split.Amount,
+			MerchantCountry: split.MerchantCountry,
+			MCC:             split.MCC,
+		}
+	}
+	return converted
+}
+
+// splitResults returns the leg decisions of an outcome
+func splitResults(outcome *decision.Outcome) []SplitResult {
+	if len(outcome.Splits) == 0 {
+		return nil
+	}
+	results := make([]SplitResult, len(outcome.Splits))
+	for i, leg := range outcome.Splits {
+		results[i] = SplitResult{
+			MerchantID:  leg.MerchantID,
+			Amount:      leg.Amount,
+			RiskScore:   leg.Detection.Score,
+			Decision:    leg.Decision,
+			Reasons:     leg.Detection.Reasons,
+			ReasonCodes: leg.Detection.ReasonCodes,
+		}
+	}
+	return results
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/throttle"
+)
+
+// reasonMerchantSpike is the reason code of approvals soft-declined while
+// their merchant's decline rate spikes
+const reasonMerchantSpike = "MERCHANT_DECLINE_SPIKE"
+
+type ThrottledMerchantsResponse struct {
+	Merchants []throttle.Status `json:"merchants" doc:"The most limited first"`
+}
+
+// merchantLimiter returns the limiter of merchants whose decline rate spikes,
+// nil unless MERCHANT_THROTTLE_ENABLED is set
+func merchantLimiter() *throttle.Limiter {
+	if enabled, _ := strconv.ParseBool(os.Getenv("MERCHANT_THROTTLE_ENABLED")); !enabled {
+		return nil
+	}
+	config := throttle.DefaultConfig()
+	config.Window = getEnvDuration("MERCHANT_THROTTLE_WINDOW", config.Window)
+	config.MinDecisions = getEnvInt("MERCHANT_THROTTLE_MIN_DECISIONS", config.MinDecisions)
+	config.FrictionFactor = getEnvFloat("MERCHANT_THROTTLE_FRICTION_FACTOR", config.FrictionFactor)
+	config.ThrottleFactor = getEnvFloat("MERCHANT_THROTTLE_FACTOR", config.ThrottleFactor)
+	config.RelaxFactor = getEnvFloat("MERCHANT_THROTTLE_RELAX_FACTOR", config.RelaxFactor)
+	config.Cooldown = getEnvDuration("MERCHANT_THROTTLE_COOLDOWN", config.Cooldown)
+	config.ThrottleRate = getEnvInt("MERCHANT_THROTTLE_RATE", config.ThrottleRate)
+
+	limiter, err := throttle.New(config)
+	if err != nil {
+		log.Fatalf("Invalid merchant throttling settings: %v", err)
+	}
+	limiter.OnChange(func(merchantID, from, to string) {
+		log.Printf("Merchant %s went from %s to %s on its decline rate", merchantID, from, to)
+	})
+	log.Printf("Limiting merchants whose decline rate reaches %.1fx their baseline", config.FrictionFactor)
+	return limiter
+}
+
+// applyMerchantFriction counts a decision against its merchant's decline
+// rate and, while the rate spikes, soft-declines approvals for step-up
+// authentication. The rate counts the decision as it was scored, so the
+// friction does not feed itself. Observe-only merchants are not limited.
+func (s *Server) applyMerchantFriction(transaction *detector.Transaction, outcome *decision.Outcome) {
+	if s.throttle == nil || s.overrides.ObserveOnly(transaction.MerchantID) {
+		return
+	}
+	declined := outcome.Decision == decision.Decline || outcome.Decision == decision.SoftDecline
+	mode := s.throttle.Observe(transaction.MerchantID, declined, time.Now())
+	if mode == throttle.ModeNormal || outcome.Decision != decision.Approve {
+		return
+	}
+	outcome.Decision = decision.SoftDecline
+	outcome.Retry = decision.RetryAfterStepUp
+	outcome.Detection.ReasonCodes = append(outcome.Detection.ReasonCodes, reasonMerchantSpike)
+	outcome.Detection.Reasons = append(outcome.Detection.Reasons, "Merchant decline rate is spiking above its baseline")
+}
+
+// allowMerchants reports whether the analyses of transactions may proceed,
+// writing a 429 when a throttled merchant has used up its rate
+func (s *Server) allowMerchants(w http.ResponseWriter, transactions ...*detector.Transaction) bool {
+	if s.throttle == nil {
+		return true
+	}
+	counts := make(map[string]int)
+	for _, transaction := range transactions {
+		if s.overrides.ObserveOnly(transaction.MerchantID) {
+			continue
+		}
+		counts[transaction.MerchantID]++
+	}
+	now := time.Now()
+	for merchantID, n := range counts {
+		if _, allowed := s.throttle.Allow(merchantID, n, now); !allowed {
+			retryAfter := s.throttle.RetryAfter(n)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			apierror.Write(w, "merchant "+merchantID+" is throttled while its decline rate spikes", http.StatusTooManyRequests)
+			return false
+		}
+	}
+	return true
+}
+
+// throttledMerchantsHandler lists the merchants the limiter tracks, by mode
+func (s *Server) throttledMerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.throttle == nil {
+		apierror.Write(w, "merchant throttling is not enabled", http.StatusNotFound)
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != throttle.ModeNormal && mode != throttle.ModeFriction && mode != throttle.ModeThrottled {
+		apierror.Write(w, "mode must be normal, friction or throttled", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ThrottledMerchantsResponse{Merchants: s.throttle.List(mode, time.Now())}); err != nil {
+		log.Printf("Error encoding throttled merchants: %v", err)
+	}
+}
+
+// releaseMerchantHandler returns a merchant to normal, as when its spike was
+// found to be legitimate
+func (s *Server) releaseMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	if s.throttle == nil {
+		apierror.Write(w, "merchant throttling is not enabled", http.StatusNotFound)
+		return
+	}
+	merchantID := r.PathValue("id")
+	now := time.Now()
+	if !s.throttle.Reset(merchantID, now) {
+		apierror.Write(w, "unknown merchant: "+merchantID, http.StatusNotFound)
+		return
+	}
+	analyst, _ := caller(r)
+	log.Printf("Merchant %s released from throttling by %s", merchantID, analyst)
+
+	status, _ := s.throttle.Status(merchantID, now)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Error encoding merchant status: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// Analysis modes of /fraud/analyze
+const (
+	modeFull     = "full"
+	modeTwoPhase = "two_phase"
+)
+
+// Scoring phases reported in response metadata
+const (
+	phasePreAuth = "pre_auth"
+	phaseFull    = "full"
+)
+
+// fullScoring completes the full analysis of pre-scored transactions in the
+// background. Results are audited, so they reach /fraud/events and the
+// decision webhook.
+type fullScoring struct {
+	queue chan *detector.Transaction
+	wg    sync.WaitGroup
+}
+
+// startFullScoring starts the background workers
+func (s *Server) startFullScoring(workers, queueSize int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	s.fullScoring = &fullScoring{queue: make(chan *detector.Transaction, queueSize)}
+	for i := 0; i < workers; i++ {
+		s.fullScoring.wg.Add(1)
+		go func() {
+			defer s.fullScoring.wg.Done()
+			for transaction := range s.fullScoring.queue {
+				if _, err := s.score(transaction); err != nil {
+					log.Printf("Full analysis of %s failed: %v", transaction.ID, err)
+				}
+			}
+		}()
+	}
+}
+
+// enqueueFullScore schedules the full analysis of a transaction. It returns
+// false when the queue is full.
+func (s *Server) enqueueFullScore(transaction *detector.Transaction) bool {
+	select {
+	case s.fullScoring.queue <- transaction:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopFullScoring finishes the queued analyses
+func (s *Server) stopFullScoring() {
+	close(s.fullScoring.queue)
+	s.fullScoring.wg.Wait()
+}
+
+// decisionWebhook returns the decision webhook sender when
+// DECISION_WEBHOOK_URL is set
+func decisionWebhook() *webhook.Sender {
+	url := os.Getenv("DECISION_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	config := webhook.DefaultConfig()
+	config.URL = url
+	config.Secret = os.Getenv("DECISION_WEBHOOK_SECRET")
+	config.MaxAttempts = getEnvInt("DECISION_WEBHOOK_MAX_ATTEMPTS", config.MaxAttempts)
+	config.QueueSize = getEnvInt("DECISION_WEBHOOK_QUEUE_SIZE", config.QueueSize)
+	config.LogSize = getEnvInt("DECISION_WEBHOOK_LOG_SIZE", config.LogSize)
+	if path := os.Getenv("DECISION_WEBHOOK_ENCRYPTION_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read the decision webhook encryption key: %v", err)
+		}
+		if config.EncryptionKey, err = events.ParsePublicKey(data); err != nil {
+			log.Fatalf("Failed to configure the decision webhook: %v", err)
+		}
+	}
+
+	sender, err := webhook.NewSender(config)
+	if err != nil {
+		log.Fatalf("Failed to configure the decision webhook: %v", err)
+	}
+	log.Printf("Delivering decision events to %s", url)
+	return sender
+}
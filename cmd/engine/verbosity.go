@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Response verbosity levels
+const (
+	// verbosityMinimal returns the score, decision and reason codes only
+	verbosityMinimal = "minimal"
+	// verbosityStandard adds the reasons, confidence and metadata
+	verbosityStandard = "standard"
+	// verbosityFull adds the model features, links to the entities and every
+	// attribution of the ML score
+	verbosityFull = "full"
+)
+
+// verbosity shapes scoring responses. MaxReasons caps the reasons and
+// reason codes returned, and MaxAttributions the features explaining the ML
+// score below full verbosity, unless zero.
+type verbosity struct {
+	Level           string
+	MaxReasons      int
+	MaxAttributions int
+}
+
+func (v verbosity) validate() error {
+	switch v.Level {
+	case verbosityMinimal, verbosityStandard, verbosityFull:
+	default:
+		return fmt.Errorf("verbosity must be %s, %s or %s", verbosityMinimal, verbosityStandard, verbosityFull)
+	}
+	if v.MaxReasons < 0 {
+		return fmt.Errorf("max_reasons must not be negative")
+	}
+	return nil
+}
+
+// responseVerbosity returns the verbosity of a request: the server default,
+// overridden by the verbosity and max_reasons query parameters
+func (s *Server) responseVerbosity(r *http.Request) (verbosity, error) {
+	v := s.verbosity
+	query := r.URL.Query()
+	if value := query.Get("verbosity"); value != "" {
+		v.Level = value
+	}
+	if value := query.Get("max_reasons"); value != "" {
+		maxReasons, err := strconv.Atoi(value)
+		if err != nil {
+			return v, fmt.Errorf("max_reasons must be an integer")
+		}
+		v.MaxReasons = maxReasons
+	}
+	return v, v.validate()
+}
+
+// MinimalResponse is a scoring response at minimal verbosity
+type MinimalResponse struct {
+	TransactionID string   `json:"transaction_id"`
+	RiskScore     float64  `json:"risk_score"`
+	Decision      string   `json:"decision"`
+	Retry         string   `json:"retry,omitempty"`
+	ReasonCodes   []string `json:"reason_codes,omitempty"`
+}
+
+type MinimalBatchResponse struct {
+	Results []MinimalResponse `json:"results"`
+	Errors  []BatchError      `json:"errors,omitempty"`
+	Summary BatchSummary      `json:"summary"`
+}
+
+// EntityLink points to what the engine knows about an entity of a
+// transaction
+type EntityLink struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Profile   string `json:"profile,omitempty"`
+	Decisions string `json:"decisions,omitempty" doc:"Search for the audited decisions involving the entity"`
+}
+
+// entityLinks returns the links to the account, device, IP address,
+// merchant and beneficiary of a transaction
+func entityLinks(tx *detector.Transaction) []EntityLink {
+	search := func(field, value string) string {
+		return "/fraud/search?q=" + url.QueryEscape(field+":"+value)
+	}
+
+	var links []EntityLink
+	if tx.AccountID != "" {
+		links = append(links, EntityLink{Type: "account", ID: tx.AccountID,
+			Profile: "/fraud/customers/" + url.PathEscape(tx.AccountID), Decisions: search("account", tx.AccountID)})
+	}
+	if tx.DeviceID != "" {
+		links = append(links, EntityLink{Type: "device", ID: tx.DeviceID, Decisions: search("device", tx.DeviceID)})
+	}
+	if tx.IPAddress != "" {
+		links = append(links, EntityLink{Type: "ip", ID: tx.IPAddress, Decisions: search("ip", tx.IPAddress)})
+	}
+	if tx.MerchantID != "" {
+		links = append(links, EntityLink{Type: "merchant", ID: tx.MerchantID, Decisions: search("merchant", tx.MerchantID)})
+	}
+	if tx.Destination != "" {
+		links = append(links, EntityLink{Type: "beneficiary", ID: tx.Destination,
+			Profile: "/fraud/beneficiaries/" + url.PathEscape(tx.Destination)})
+	}
+	return links
+}
+
+// apply caps the reasons and attributions of a response and, at full
+// verbosity, adds the model features and entity links of the transaction
+func (v verbosity) apply(response *FraudResponse, tx *detector.Transaction) {
+	if v.MaxReasons > 0 {
+		omitted := 0
+		if len(response.Reasons) > v.MaxReasons {
+			omitted = len(response.Reasons) - v.MaxReasons
+			response.Reasons = response.Reasons[:v.MaxReasons]
+		}
+		if len(response.ReasonCodes) > v.MaxReasons {
+			response.ReasonCodes = response.ReasonCodes[:v.MaxReasons]
+		}
+		if omitted > 0 && v.Level != verbosityMinimal {
+			if response.Metadata == nil {
+				response.Metadata = map[string]interface{}{}
+			}
+			response.Metadata["reasons_omitted"] = omitted
+		}
+	}
+	if v.Level == verbosityFull {
+		response.Features = tx.Features
+		response.Entities = entityLinks(tx)
+	} else {
+		response.Explanation = response.Explanation.Top(v.MaxAttributions)
+	}
+}
+
+// minimal returns the minimal form of a response
+func minimal(response FraudResponse) MinimalResponse {
+	return MinimalResponse{
+		TransactionID: response.TransactionID,
+		RiskScore:     response.RiskScore,
+		Decision:      response.Decision,
+		Retry:         response.Retry,
+		ReasonCodes:   response.ReasonCodes,
+	}
+}
+
+// body returns what is encoded for a response
+func (v verbosity) body(response FraudResponse) interface{} {
+	if v.Level == verbosityMinimal {
+		return minimal(response)
+	}
+	return response
+}
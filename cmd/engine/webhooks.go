@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+)
+
+// defaultWebhook is the ID of the DECISION_WEBHOOK_URL webhook; merchant
+// webhooks are identified by their merchant
+const defaultWebhook = "default"
+
+type WebhookReplayRequest struct {
+	From time.Time `json:"from" openapi:"required" doc:"Replays the decisions made at or after this time"`
+	To   time.Time `json:"to,omitempty" doc:"Replays the decisions made before this time, now by default"`
+	// Webhook is set from the path
+	Webhook string `json:"webhook,omitempty" openapi:"readOnly"`
+}
+
+type WebhookReplayResult struct {
+	Webhook  string `json:"webhook"`
+	Replayed int    `json:"replayed"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Webhook    string             `json:"webhook"`
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
+// webhookSender returns the sender of a webhook: the decision webhook, or
+// the webhook of a merchant
+func (s *Server) webhookSender(id string) (*webhook.Sender, bool) {
+	if id == defaultWebhook {
+		return s.webhook, s.webhook != nil
+	}
+	return s.merchantWebhooks.Sender(id)
+}
+
+// replayWebhook queues the decision events of a time range for delivery to
+// a webhook again. Merchant webhooks only get the events of their merchant.
+func (s *Server) replayWebhook(ctx context.Context, req WebhookReplayRequest) (WebhookReplayResult, error) {
+	result := WebhookReplayResult{Webhook: req.Webhook}
+	sender, exists := s.webhookSender(req.Webhook)
+	if !exists {
+		return result, jobs.Permanent(fmt.Errorf("no webhook %s", req.Webhook))
+	}
+	records, err := s.auditStore.Since(req.From)
+	if err != nil {
+		return result, err
+	}
+	for _, record := range records {
+		if !record.DecidedAt.Before(req.To) {
+			break
+		}
+		if req.Webhook != defaultWebhook && record.Transaction.MerchantID != req.Webhook {
+			continue
+		}
+		if err := sender.Replay(ctx, decisionEvent(record)); err != nil {
+			return result, err
+		}
+		result.Replayed++
+	}
+	log.Printf("Replayed %d decision events to webhook %s", result.Replayed, req.Webhook)
+	return result, nil
+}
+
+// webhookReplayHandler queues the replay of the decision events of a time
+// range to a webhook as a background job
+func (s *Server) webhookReplayHandler(w http.ResponseWriter, r *http.Request) {
+	s.queueWebhookReplay(w, r, r.PathValue("id"))
+}
+
+// merchantWebhookReplayHandler queues the replay of a merchant's decision
+// events to its webhook
+func (s *Server) merchantWebhookReplayHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID, ok := s.merchantScope(w, r)
+	if !ok {
+		return
+	}
+	s.queueWebhookReplay(w, r, merchantID)
+}
+
+func (s *Server) queueWebhookReplay(w http.ResponseWriter, r *http.Request, id string) {
+	if _, exists := s.webhookSender(id); !exists {
+		apierror.Write(w, "unknown webhook: "+id, http.StatusNotFound)
+		return
+	}
+	var req WebhookReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.From.IsZero() {
+		apierror.Write(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.To.After(req.From) {
+		apierror.Write(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	req.Webhook = id
+	s.enqueueJob(w, jobWebhookReplay, req)
+}
+
+// webhookDeliveriesHandler serves the delivery log of a webhook
+func (s *Server) webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeWebhookDeliveries(w, r, r.PathValue("id"))
+}
+
+// merchantWebhookDeliveriesHandler serves the delivery log of a merchant's
+// webhook
+func (s *Server) merchantWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID, ok := s.merchantScope(w, r)
+	if !ok {
+		return
+	}
+	s.writeWebhookDeliveries(w, r, merchantID)
+}
+
+// writeWebhookDeliveries writes the deliveries of a webhook, newest first,
+// filtered by the since, until, status and limit parameters
+func (s *Server) writeWebhookDeliveries(w http.ResponseWriter, r *http.Request, id string) {
+	sender, exists := s.webhookSender(id)
+	if !exists {
+		apierror.Write(w, "unknown webhook: "+id, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var since, until time.Time
+	for name, bound := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				apierror.Write(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*bound = parsed
+		}
+	}
+	status := query.Get("status")
+	if status != "" && status != webhook.StatusDelivered && status != webhook.StatusFailed && status != webhook.StatusDropped {
+		apierror.Write(w, "status must be delivered, failed or dropped", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			apierror.Write(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(WebhookDeliveriesResponse{
+		Webhook:    id,
+		Deliveries: sender.Deliveries().List(since, until, status, limit),
+	}); err != nil {
+		log.Printf("Error encoding webhook deliveries: %v", err)
+	}
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// health shows whether the engine and its ML model are ready
+func (c client) health(args []string) error {
+	var health struct {
+		Status         string    `json:"status"`
+		MLEngineReady  bool      `json:"ml_engine_ready"`
+		DetectorActive bool      `json:"detector_active"`
+		Timestamp      time.Time `json:"timestamp"`
+	}
+	response, err := c.get("/health", &health)
+	if err != nil {
+		return err
+	}
+	return c.print(response, func(w *tabwriter.Writer) {
+		row(w, "STATUS", "ML READY", "DETECTOR", "TIME")
+		row(w, health.Status, health.MLEngineReady, health.DetectorActive, health.Timestamp)
+	})
+}
+
+// rules lists, exports, imports and rolls back detection rules
+func (c client) rules(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("rules takes list, export, import or rollback")
+	}
+	switch args[0] {
+	case "list":
+		var summary struct {
+			Rules []struct {
+				ID     string  `json:"id"`
+				Name   string  `json:"name"`
+				Score  float64 `json:"score"`
+				Action string  `json:"action"`
+				Health *struct {
+					Quarantined bool `json:"quarantined"`
+				} `json:"health,omitempty"`
+			} `json:"rules"`
+		}
+		response, err := c.get("/fraud/rules", &summary)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			row(w, "ID", "NAME", "SCORE", "ACTION", "HEALTH")
+			for _, rule := range summary.Rules {
+				health := "ok"
+				if rule.Health != nil {
+					health = "degraded"
+					if rule.Health.Quarantined {
+						health = "quarantined"
+					}
+				}
+				row(w, rule.ID, rule.Name, rule.Score, rule.Action, health)
+			}
+		})
+	case "export":
+		flags := flag.NewFlagSet("rules export", flag.ExitOnError)
+		output := flags.String("f", "", "file to write, defaults to stdout")
+		flags.Parse(args[1:])
+
+		body, err := c.do(http.MethodGet, "/fraud/rules/export", nil)
+		if err != nil {
+			return err
+		}
+		if *output == "" {
+			_, err = c.out.Write(body)
+			return err
+		}
+		return os.WriteFile(*output, body, 0o644)
+	case "import":
+		flags := flag.NewFlagSet("rules import", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only show what would change")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			return fmt.Errorf("rules import takes one rule file")
+		}
+		data, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if _, err := ruleset.Decode(bytes.NewReader(data)); err != nil {
+			return err
+		}
+		path := "/fraud/rules/import"
+		if *dryRun {
+			path += "?dry_run=true"
+		}
+		response, err := c.do(http.MethodPost, path, data)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			DryRun bool         `json:"dry_run"`
+			Rules  int          `json:"rules"`
+			Diff   ruleset.Diff `json:"diff"`
+		}
+		if err := json.Unmarshal(response, &result); err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			row(w, "CHANGE", "RULE")
+			for _, id := range result.Diff.Added {
+				row(w, "added", id)
+			}
+			for _, id := range result.Diff.Removed {
+				row(w, "removed", id)
+			}
+			for _, id := range result.Diff.Changed {
+				row(w, "changed", id)
+			}
+			if result.DryRun {
+				fmt.Fprintf(w, "dry run: %d expression rules, nothing applied\n", result.Rules)
+			} else {
+				fmt.Fprintf(w, "imported %d expression rules\n", result.Rules)
+			}
+		})
+	case "rollback":
+		if len(args) != 3 {
+			return fmt.Errorf("rules rollback takes a rule ID and a version")
+		}
+		version, err := strconv.Atoi(args[2])
+		if err != nil || version < 1 {
+			return fmt.Errorf("version must be a positive integer, got %q", args[2])
+		}
+		response, err := c.send(http.MethodPost, "/fraud/rules/"+url.PathEscape(args[1])+"/rollback", map[string]int{"version": version}, nil)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "rule %s rolled back to version %d\n", args[1], version)
+		})
+	}
+	return fmt.Errorf("unknown rules command %q", args[0])
+}
+
+// lists shows and replaces the lists used by in_list in the global, a
+// tenant's or a merchant's configuration layer
+func (c client) lists(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("lists takes show, set or delete")
+	}
+	flags := flag.NewFlagSet("lists "+args[0], flag.ExitOnError)
+	tenant := flags.String("tenant", "", "tenant whose layer to use")
+	merchant := flags.String("merchant", "", "merchant whose layer to use")
+	flags.Parse(args[1:])
+	if *tenant != "" && *merchant != "" {
+		return fmt.Errorf("-tenant and -merchant are exclusive")
+	}
+
+	switch args[0] {
+	case "show":
+		if *merchant != "" {
+			var effective config.Effective
+			response, err := c.get("/fraud/overrides/effective?merchant_id="+url.QueryEscape(*merchant), &effective)
+			if err != nil {
+				return err
+			}
+			return c.print(response, func(w *tabwriter.Writer) {
+				printLists(w, effective.Lists, func(name string) string { return effective.Sources["lists."+name] })
+			})
+		}
+		var hierarchy config.Hierarchy
+		response, err := c.get("/fraud/overrides", &hierarchy)
+		if err != nil {
+			return err
+		}
+		layer := hierarchy.Global
+		source := config.SourceGlobal
+		if *tenant != "" {
+			var exists bool
+			if layer, exists = hierarchy.Tenants[*tenant]; !exists {
+				return fmt.Errorf("unknown tenant %q", *tenant)
+			}
+			source = "tenant"
+		}
+		lists, _ := json.Marshal(map[string]interface{}{"lists": layer.Lists})
+		if c.format == formatJSON {
+			response = lists
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			printLists(w, layer.Lists, func(string) string { return source })
+		})
+	case "set", "delete":
+		if args[0] == "set" && flags.NArg() < 2 {
+			return fmt.Errorf("lists set takes a list name and its values")
+		}
+		if args[0] == "delete" && flags.NArg() != 1 {
+			return fmt.Errorf("lists delete takes a list name")
+		}
+		name := flags.Arg(0)
+		var values []string
+		if args[0] == "set" {
+			values = flags.Args()[1:]
+		}
+
+		// The layers are replaced as a whole, so changes made by others
+		// between the read and the write are lost
+		var hierarchy config.Hierarchy
+		if _, err := c.get("/fraud/overrides", &hierarchy); err != nil {
+			return err
+		}
+		switch {
+		case *merchant != "":
+			layer, exists := hierarchy.Merchants[*merchant]
+			if !exists {
+				return fmt.Errorf("unknown merchant %q", *merchant)
+			}
+			layer.Lists = setList(layer.Lists, name, values)
+			hierarchy.Merchants[*merchant] = layer
+		case *tenant != "":
+			layer, exists := hierarchy.Tenants[*tenant]
+			if !exists {
+				return fmt.Errorf("unknown tenant %q", *tenant)
+			}
+			layer.Lists = setList(layer.Lists, name, values)
+			hierarchy.Tenants[*tenant] = layer
+		default:
+			hierarchy.Global.Lists = setList(hierarchy.Global.Lists, name, values)
+		}
+		response, err := c.send(http.MethodPut, "/fraud/overrides", hierarchy, nil)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			if values == nil {
+				fmt.Fprintf(w, "list %s deleted\n", name)
+			} else {
+				fmt.Fprintf(w, "list %s set to %d values\n", name, len(values))
+			}
+		})
+	}
+	return fmt.Errorf("unknown lists command %q", args[0])
+}
+
+// setList returns lists with name set to values, or removed when values is
+// nil
+func setList(lists map[string][]string, name string, values []string) map[string][]string {
+	if lists == nil {
+		lists = make(map[string][]string)
+	}
+	if values == nil {
+		delete(lists, name)
+	} else {
+		lists[name] = values
+	}
+	return lists
+}
+
+func printLists(w *tabwriter.Writer, lists map[string][]string, source func(name string) string) {
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	row(w, "LIST", "SOURCE", "VALUES")
+	for _, name := range names {
+		row(w, name, source(name), strings.Join(lists[name], ","))
+	}
+}
+
+// config shows and replaces the configuration layers and lists the named
+// configurations decision diffs replay under
+func (c client) config(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("config takes show, set, effective or configurations")
+	}
+	switch args[0] {
+	case "show":
+		var hierarchy config.Hierarchy
+		response, err := c.get("/fraud/overrides", &hierarchy)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			row(w, "LAYER", "TENANT", "REVIEW", "DECLINE", "OBSERVE ONLY", "RULES", "LISTS")
+			printLayer(w, config.SourceGlobal, "", hierarchy.Global)
+			for _, id := range sortedKeys(hierarchy.Tenants) {
+				printLayer(w, "tenant:"+id, id, hierarchy.Tenants[id])
+			}
+			for _, id := range sortedKeys(hierarchy.Merchants) {
+				printLayer(w, "merchant:"+id, hierarchy.Merchants[id].Tenant, hierarchy.Merchants[id].Layer)
+			}
+		})
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("config set takes one JSON file of configuration layers")
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		var hierarchy config.Hierarchy
+		if err := json.Unmarshal(data, &hierarchy); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+		if err := hierarchy.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+		response, err := c.do(http.MethodPut, "/fraud/overrides", data)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "configuration layers replaced: %d tenants, %d merchants\n", len(hierarchy.Tenants), len(hierarchy.Merchants))
+		})
+	case "effective":
+		if len(args) != 2 {
+			return fmt.Errorf("config effective takes a merchant ID")
+		}
+		var effective config.Effective
+		response, err := c.get("/fraud/overrides/effective?merchant_id="+url.QueryEscape(args[1]), &effective)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			row(w, "SETTING", "VALUE", "SOURCE")
+			row(w, "review_threshold", effective.ReviewThreshold, effective.Sources["review_threshold"])
+			row(w, "decline_threshold", effective.DeclineThreshold, effective.Sources["decline_threshold"])
+			row(w, "soft_decline_threshold", effective.SoftDeclineThreshold, effective.Sources["soft_decline_threshold"])
+			row(w, "min_confidence", effective.MinConfidence, effective.Sources["min_confidence"])
+			row(w, "observe_only", effective.ObserveOnly, effective.Sources["observe_only"])
+			row(w, "audit_sample_rate", effective.AuditSampleRate, effective.Sources["audit_sample_rate"])
+			for _, id := range sortedKeys(effective.Rules) {
+				row(w, "rules."+id, effective.Rules[id], effective.Sources["rules."+id])
+			}
+			for _, name := range sortedKeys(effective.Lists) {
+				row(w, "lists."+name, strings.Join(effective.Lists[name], ","), effective.Sources["lists."+name])
+			}
+		})
+	case "configurations":
+		var list struct {
+			Configurations []decision.Configuration `json:"configurations"`
+		}
+		response, err := c.get("/fraud/configs", &list)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			row(w, "NAME", "REVIEW", "DECLINE", "BLOCK", "ML")
+			for _, configuration := range list.Configurations {
+				row(w, configuration.Name, configuration.ReviewThreshold, configuration.DeclineThreshold, configuration.BlockThreshold, configuration.MLEnabled)
+			}
+		})
+	}
+	return fmt.Errorf("unknown config command %q", args[0])
+}
+
+func printLayer(w *tabwriter.Writer, name, tenant string, layer config.Layer) {
+	threshold := func(value *float64) interface{} {
+		if value == nil {
+			return "-"
+		}
+		return *value
+	}
+	observeOnly := "-"
+	if layer.ObserveOnly != nil {
+		observeOnly = strconv.FormatBool(*layer.ObserveOnly)
+	}
+	row(w, name, tenant, threshold(layer.ReviewThreshold), threshold(layer.DeclineThreshold), observeOnly, len(layer.Rules), len(layer.Lists))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// train queues the retraining of the ML model
+func (c client) train(args []string) error {
+	flags := flag.NewFlagSet("train", flag.ExitOnError)
+	wait := flags.Bool("wait", false, "wait for the training to finish")
+	flags.Parse(args)
+	return c.runJob(http.MethodPost, "/fraud/train", nil, *wait)
+}
+
+// replay queues the replay of decision events to a webhook, or replays
+// recent traffic under a candidate configuration and reports the decisions
+// that would change
+func (c client) replay(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("replay takes webhook or diff")
+	}
+	switch args[0] {
+	case "webhook":
+		flags := flag.NewFlagSet("replay webhook", flag.ExitOnError)
+		from := flags.String("from", "", "replay the decisions made at or after this RFC 3339 time, an hour ago by default")
+		to := flags.String("to", "", "replay the decisions made before this RFC 3339 time, now by default")
+		wait := flags.Bool("wait", false, "wait for the replay to finish")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			return fmt.Errorf("replay webhook takes a webhook ID")
+		}
+		req := map[string]time.Time{"from": time.Now().Add(-time.Hour)}
+		for name, value := range map[string]string{"from": *from, "to": *to} {
+			if value == "" {
+				continue
+			}
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("-%s must be an RFC 3339 time, got %q", name, value)
+			}
+			req[name] = at
+		}
+		return c.runJob(http.MethodPost, "/fraud/webhooks/"+url.PathEscape(flags.Arg(0))+"/replay", req, *wait)
+	case "diff":
+		flags := flag.NewFlagSet("replay diff", flag.ExitOnError)
+		baseline := flags.String("baseline", decision.CurrentConfiguration, "configuration to compare against")
+		hours := flags.Float64("hours", 24, "hours of audited traffic to replay")
+		samples := flags.Int("samples", 5, "changed decisions to show")
+		wait := flags.Bool("wait", false, "replay as a background job and wait for it")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			return fmt.Errorf("replay diff takes a candidate configuration")
+		}
+		req := map[string]interface{}{"baseline": *baseline, "candidate": flags.Arg(0), "hours": *hours, "samples": *samples}
+		if *wait {
+			return c.runJob(http.MethodPost, "/fraud/admin/decision-diff?async=true", req, true)
+		}
+		var diff struct {
+			Since  time.Time           `json:"since"`
+			Report decision.DiffReport `json:"report"`
+		}
+		response, err := c.send(http.MethodPost, "/fraud/admin/decision-diff", req, &diff)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "%s -> %s since %s: %d of %d decisions change, %d errors\n",
+				diff.Report.Baseline, diff.Report.Candidate, diff.Since.Local().Format(time.DateTime),
+				diff.Report.Changed, diff.Report.Total, diff.Report.Errors)
+			row(w, "TRANSITION", "COUNT")
+			for _, transition := range sortedKeys(diff.Report.Transitions) {
+				row(w, transition, diff.Report.Transitions[transition])
+			}
+			if len(diff.Report.Samples) > 0 {
+				row(w, "TRANSACTION", "TRANSITION")
+				for _, sample := range diff.Report.Samples {
+					row(w, sample.TransactionID, sample.Transition)
+				}
+			}
+		})
+	}
+	return fmt.Errorf("unknown replay command %q", args[0])
+}
+
+// runJob sends a request queuing a background job and shows the job, once
+// it finished when wait is set
+func (c client) runJob(method, path string, body interface{}, wait bool) error {
+	var job jobs.Job
+	response, err := c.send(method, path, body, &job)
+	if err != nil {
+		return err
+	}
+	for wait && !job.Finished() {
+		time.Sleep(time.Second)
+		if response, err = c.get("/fraud/jobs/"+url.PathEscape(job.ID), &job); err != nil {
+			return err
+		}
+	}
+	if err := c.print(response, func(w *tabwriter.Writer) { printJobs(w, job) }); err != nil {
+		return err
+	}
+	if wait && job.Status != jobs.Succeeded {
+		return fmt.Errorf("job %s %s: %s", job.ID, job.Status, job.Error)
+	}
+	return nil
+}
+
+// jobs lists the background jobs, or shows one
+func (c client) jobs(args []string) error {
+	flags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	status := flags.String("status", "", "only list jobs with this status")
+	jobType := flags.String("type", "", "only list jobs of this type")
+	limit := flags.Int("limit", 20, "most jobs to list")
+	flags.Parse(args)
+
+	if flags.NArg() == 1 {
+		var job jobs.Job
+		response, err := c.get("/fraud/jobs/"+url.PathEscape(flags.Arg(0)), &job)
+		if err != nil {
+			return err
+		}
+		return c.print(response, func(w *tabwriter.Writer) {
+			printJobs(w, job)
+			if len(job.Result) > 0 {
+				fmt.Fprintf(w, "result: %s\n", job.Result)
+			}
+		})
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if *status != "" {
+		query.Set("status", *status)
+	}
+	if *jobType != "" {
+		query.Set("type", *jobType)
+	}
+	var list struct {
+		Jobs []jobs.Job `json:"jobs"`
+	}
+	response, err := c.get("/fraud/jobs?"+query.Encode(), &list)
+	if err != nil {
+		return err
+	}
+	return c.print(response, func(w *tabwriter.Writer) { printJobs(w, list.Jobs...) })
+}
+
+func printJobs(w *tabwriter.Writer, list ...jobs.Job) {
+	row(w, "ID", "TYPE", "STATUS", "ATTEMPTS", "CREATED", "ERROR")
+	for _, job := range list {
+		row(w, job.ID, job.Type, job.Status, fmt.Sprintf("%d/%d", job.Attempts, job.MaxAttempts), job.CreatedAt, job.Error)
+	}
+}
+
+// customer shows what the detector knows about a customer
+func (c client) customer(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("customer takes a customer ID")
+	}
+	var customer struct {
+		CustomerID string                    `json:"customer_id"`
+		Locations  []detector.LocationRecord `json:"locations"`
+	}
+	response, err := c.get("/fraud/customers/"+url.PathEscape(args[0]), &customer)
+	if err != nil {
+		return err
+	}
+	return c.print(response, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "customer %s: %d recent locations\n", customer.CustomerID, len(customer.Locations))
+		row(w, "TIME", "COUNTRY", "CITY", "LATITUDE", "LONGITUDE")
+		for _, record := range customer.Locations {
+			row(w, record.Time, record.Location.Country, record.Location.City, record.Location.Latitude, record.Location.Longitude)
+		}
+	})
+}
+
+// tail polls the decision events and prints them as they are made, until
+// interrupted. Events are printed as JSON lines with -o json.
+func (c client) tail(args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	since := flags.String("since", "", "start from the decisions made at or after this RFC 3339 time, now by default")
+	interval := flags.Duration("interval", 2*time.Second, "how often to poll")
+	flags.Parse(args)
+
+	from := time.Now()
+	if *since != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, *since); err != nil {
+			return fmt.Errorf("-since must be an RFC 3339 time, got %q", *since)
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	// Rows are printed as they come, so the columns have fixed widths
+	const tailRow = "%-19s  %-20s  %-14s  %-14s  %14s  %-12s  %5s  %s\n"
+	if c.format == formatTable {
+		fmt.Fprintf(c.out, tailRow, "TIME", "TRANSACTION", "ACCOUNT", "MERCHANT", "AMOUNT", "DECISION", "SCORE", "REASONS")
+	}
+	// Events at the time polled from were printed by the previous poll
+	seen := make(map[string]bool)
+	for {
+		body, err := c.do(http.MethodGet, "/fraud/events?since="+url.QueryEscape(from.Format(time.RFC3339Nano)), nil)
+		if err != nil {
+			return err
+		}
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var event events.DecisionEvent
+			if err := json.Unmarshal(line, &event); err != nil {
+				return fmt.Errorf("invalid decision event: %w", err)
+			}
+			if event.OccurredAt.Before(from) || seen[event.EventID] {
+				continue
+			}
+			if event.OccurredAt.After(from) {
+				from = event.OccurredAt
+				seen = make(map[string]bool)
+			}
+			seen[event.EventID] = true
+			if c.format == formatJSON {
+				fmt.Fprintf(c.out, "%s\n", bytes.TrimSpace(line))
+				continue
+			}
+			fmt.Fprintf(c.out, tailRow, event.OccurredAt.Local().Format(time.DateTime), event.TransactionID, event.AccountID, event.MerchantID,
+				fmt.Sprintf("%.2f %s", event.Amount, event.Currency), event.Decision, fmt.Sprintf("%.2f", event.RiskScore), strings.Join(event.ReasonCodes, ","))
+		}
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
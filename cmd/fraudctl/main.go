@@ -0,0 +1,236 @@
+// Command fraudctl administers a running engine through its admin API: rules,
+// lists and configuration layers, model training, replays, customers, the
+// decision stream and health.
+//
+// Usage:
+//
+//	fraudctl [-addr URL] [-api-key KEY] [-o table|json] COMMAND [ARGS]
+//
+// Commands:
+//
+//	health
+//	rules list | export [-f FILE] | import [-dry-run] FILE | rollback ID VERSION
+//	lists show [-tenant ID | -merchant ID]
+//	lists set [-tenant ID | -merchant ID] NAME VALUE...
+//	lists delete [-tenant ID | -merchant ID] NAME
+//	config show | set FILE | effective MERCHANT | configurations
+//	train [-wait]
+//	replay webhook [-from TIME] [-to TIME] [-wait] ID
+//	replay diff [-baseline NAME] [-hours N] [-wait] CANDIDATE
+//	jobs [-status STATUS] [-type TYPE] [ID]
+//	customer ID
+//	tail [-since TIME] [-interval DURATION]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+type client struct {
+	addr   string
+	apiKey string
+	format string
+	http   *http.Client
+	out    io.Writer
+}
+
+func main() {
+	log.SetFlags(0)
+
+	addr := flag.String("addr", "http://localhost:8080", "engine base URL")
+	apiKey := flag.String("api-key", os.Getenv("FRAUD_API_KEY"), "API key, defaults to $FRAUD_API_KEY")
+	format := flag.String("o", formatTable, "output format, table or json")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of each request")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if *format != formatTable && *format != formatJSON {
+		log.Fatalf("fraudctl: -o must be table or json, got %q", *format)
+	}
+
+	c := client{
+		addr:   strings.TrimSuffix(*addr, "/"),
+		apiKey: *apiKey,
+		format: *format,
+		http:   &http.Client{Timeout: *timeout},
+		out:    os.Stdout,
+	}
+
+	commands := map[string]func([]string) error{
+		"health":   c.health,
+		"rules":    c.rules,
+		"lists":    c.lists,
+		"config":   c.config,
+		"train":    c.train,
+		"replay":   c.replay,
+		"jobs":     c.jobs,
+		"customer": c.customer,
+		"tail":     c.tail,
+	}
+	command, exists := commands[flag.Arg(0)]
+	if !exists {
+		usage()
+		os.Exit(2)
+	}
+	if err := command(flag.Args()[1:]); err != nil {
+		log.Fatalf("fraudctl: %v", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fraudctl [-addr URL] [-api-key KEY] [-o table|json] COMMAND [ARGS]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, line := range []string{
+		"health",
+		"rules list | export [-f FILE] | import [-dry-run] FILE | rollback ID VERSION",
+		"lists show [-tenant ID | -merchant ID]",
+		"lists set [-tenant ID | -merchant ID] NAME VALUE...",
+		"lists delete [-tenant ID | -merchant ID] NAME",
+		"config show | set FILE | effective MERCHANT | configurations",
+		"train [-wait]",
+		"replay webhook [-from TIME] [-to TIME] [-wait] ID",
+		"replay diff [-baseline NAME] [-hours N] [-wait] CANDIDATE",
+		"jobs [-status STATUS] [-type TYPE] [ID]",
+		"customer ID",
+		"tail [-since TIME] [-interval DURATION]",
+	} {
+		fmt.Fprintln(os.Stderr, "  "+line)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	flag.PrintDefaults()
+}
+
+// do sends a request to the engine and returns the body of a 2xx response.
+// Bodies starting with { or [ are sent as JSON, others as YAML.
+func (c client) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		contentType := "application/yaml"
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set(auth.APIKeyHeader, c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message := strings.TrimSpace(string(data))
+		var failure apierror.ErrorResponse
+		if json.Unmarshal(data, &failure) == nil && failure.Error.Code != "" {
+			message = fmt.Sprintf("%s (%s)", failure.Error.Message, failure.Error.Code)
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, message)
+	}
+	return data, nil
+}
+
+// get decodes the JSON response to a GET into v
+func (c client) get(path string, v interface{}) ([]byte, error) {
+	return c.send(http.MethodGet, path, nil, v)
+}
+
+// send encodes body as JSON, unless it is nil, and decodes the JSON
+// response into v
+func (c client) send(method, path string, body, v interface{}) ([]byte, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	response, err := c.do(method, path, data)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if err := json.Unmarshal(response, v); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return response, nil
+}
+
+// print writes a response as indented JSON with -o json, and as the table
+// built by table otherwise
+func (c client) print(response []byte, table func(w *tabwriter.Writer)) error {
+	if c.format == formatJSON {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, response, "", "  "); err != nil {
+			_, err = c.out.Write(response)
+			return err
+		}
+		indented.WriteByte('\n')
+		_, err := indented.WriteTo(c.out)
+		return err
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes the tab-separated cells of a table row
+func row(w io.Writer, cells ...interface{}) {
+	for i, cell := range cells {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		switch value := cell.(type) {
+		case float64:
+			fmt.Fprintf(w, "%.4g", value)
+		case time.Time:
+			if value.IsZero() {
+				fmt.Fprint(w, "-")
+			} else {
+				fmt.Fprint(w, value.Local().Format(time.DateTime))
+			}
+		case string:
+			if value == "" {
+				value = "-"
+			}
+			fmt.Fprint(w, value)
+		default:
+			fmt.Fprint(w, value)
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// transactionRequest mirrors the engine's /fraud/analyze request body
+type transactionRequest struct {
+	ID              string     `json:"id"`
+	Amount          float64    `json:"amount"`
+	Currency        string     `json:"currency"`
+	MerchantID      string     `json:"merchant_id"`
+	CustomerID      string     `json:"customer_id"`
+	PaymentMethod   string     `json:"payment_method"`
+	Location        location   `json:"location"`
+	DeviceInfo      deviceInfo `json:"device_info"`
+	Timestamp       time.Time  `json:"timestamp"`
+	TransactionType string     `json:"transaction_type,omitempty"`
+}
+
+type location struct {
+	Country   string  `json:"country"`
+	City      string  `json:"city"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	IPAddress string  `json:"ip_address"`
+}
+
+type deviceInfo struct {
+	DeviceID string `json:"device_id"`
+	Platform string `json:"platform"`
+}
+
+type city struct {
+	name    string
+	country string
+	lat     float64
+	lon     float64
+}
+
+var cities = []city{
+	{"New York", "US", 40.7128, -74.0060},
+	{"San Francisco", "US", 37.7749, -122.4194},
+	{"Chicago", "US", 41.8781, -87.6298},
+	{"London", "GB", 51.5074, -0.1278},
+	{"Berlin", "DE", 52.5200, 13.4050},
+	{"São Paulo", "BR", -23.5505, -46.6333},
+	{"Tokyo", "JP", 35.6762, 139.6503},
+	{"Sydney", "AU", -33.8688, 151.2093},
+	{"Lagos", "NG", 6.5244, 3.3792},
+	{"Moscow", "RU", 55.7558, 37.6173},
+}
+
+// generatorConfig tunes the shape of the synthetic traffic
+type generatorConfig struct {
+	Accounts    int
+	Merchants   int
+	HotAccounts float64 // share of accounts that are hot
+	HotTraffic  float64 // share of traffic sent by hot accounts
+	FraudRate   float64 // share of transactions with fraud traits
+	GeoSpread   int     // number of cities accounts travel between
+	Seed        int64
+}
+
+// generator produces a stream of synthetic transactions. It is not safe for
+// concurrent use; each worker owns one.
+type generator struct {
+	config generatorConfig
+	rng    *rand.Rand
+	worker int
+	seq    int
+}
+
+func newGenerator(config generatorConfig, worker int) *generator {
+	if config.GeoSpread <= 0 || config.GeoSpread > len(cities) {
+		config.GeoSpread = len(cities)
+	}
+	return &generator{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed + int64(worker))),
+		worker: worker,
+	}
+}
+
+// Next returns the next transaction and whether it was generated as fraud
+func (g *generator) Next() (transactionRequest, bool) {
+	g.seq++
+	account := g.pickAccount()
+	home := cities[account%g.config.GeoSpread]
+	fraud := g.rng.Float64() < g.config.FraudRate
+
+	tx := transactionRequest{
+		ID:            fmt.Sprintf("lg_%d_%d_%d", time.Now().UnixNano(), g.worker, g.seq),
+		Amount:        g.normalAmount(),
+		Currency:      "USD",
+		MerchantID:    fmt.Sprintf("merchant_%d", g.rng.Intn(g.config.Merchants)),
+		CustomerID:    fmt.Sprintf("acc_%d", account),
+		PaymentMethod: "card",
+		Location: location{
+			Country:   home.country,
+			City:      home.name,
+			Latitude:  home.lat,
+			Longitude: home.lon,
+			IPAddress: fmt.Sprintf("10.%d.%d.%d", account%256, (account/256)%256, g.rng.Intn(256)),
+		},
+		DeviceInfo: deviceInfo{
+			DeviceID: fmt.Sprintf("device_%d", account),
+			Platform: "web",
+		},
+		Timestamp: time.Now().UTC(),
+	}
+
+	if fraud {
+		g.applyFraudTraits(&tx)
+	}
+	return tx, fraud
+}
+
+func (g *generator) pickAccount() int {
+	hot := int(float64(g.config.Accounts) * g.config.HotAccounts)
+	if hot > 0 && g.rng.Float64() < g.config.HotTraffic {
+		return g.rng.Intn(hot)
+	}
+	return g.rng.Intn(g.config.Accounts)
+}
+
+// Log-normal amounts have a median of e^amountMu, about 40, and a long tail
+// of larger purchases
+const (
+	amountMu    = 3.7
+	amountSigma = 1.0
+)
+
+// normalAmount draws a log-normal amount centred around typical card spend
+func (g *generator) normalAmount() float64 {
+	amount := math.Exp(amountMu + amountSigma*g.rng.NormFloat64())
+	if amount < 1 {
+		amount = 1
+	}
+	return float64(int(amount*100)) / 100
+}
+
+func (g *generator) applyFraudTraits(tx *transactionRequest) {
+	switch g.rng.Intn(4) {
+	case 0: // high value
+		tx.Amount = 10000 + float64(g.rng.Intn(90000))
+	case 1: // far away from home
+		away := cities[g.rng.Intn(len(cities))]
+		tx.Location.City = away.name
+		tx.Location.Country = away.country
+		tx.Location.Latitude = away.lat
+		tx.Location.Longitude = away.lon
+	case 2: // round amount, new device
+		tx.Amount = float64(1000 * (2 + g.rng.Intn(9)))
+		tx.DeviceInfo.DeviceID = fmt.Sprintf("device_new_%d", g.rng.Int63())
+	default: // risky payment method
+		tx.PaymentMethod = "cash_advance"
+		tx.Amount = 2000 + float64(g.rng.Intn(8000))
+	}
+}
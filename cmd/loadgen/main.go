@@ -0,0 +1,189 @@
+// Command loadgen drives the fraud detection API with a synthetic transaction
+// stream and reports throughput and latency percentiles.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	target      string
+	apiKey      string
+	duration    time.Duration
+	concurrency int
+	rate        float64
+	interval    time.Duration
+	jsonOutput  bool
+	scenarios   bool
+	generator   generatorConfig
+}
+
+func main() {
+	opts := parseFlags()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.duration)
+	defer cancel()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-quit
+		cancel()
+	}()
+
+	log.Printf("Sending load to %s for %s with %d workers", opts.target, opts.duration, opts.concurrency)
+
+	rec := run(ctx, opts)
+	s := rec.summary()
+	if opts.jsonOutput {
+		if err := s.writeJSON(os.Stdout); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		return
+	}
+	s.writeText(os.Stdout)
+}
+
+func parseFlags() options {
+	var opts options
+	flag.StringVar(&opts.target, "url", "http://localhost:8080/fraud/analyze", "analyze endpoint to load")
+	flag.StringVar(&opts.apiKey, "api-key", os.Getenv("FRAUD_API_KEY"), "API key, defaults to $FRAUD_API_KEY")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "how long to run")
+	flag.IntVar(&opts.concurrency, "concurrency", 16, "number of concurrent workers")
+	flag.Float64Var(&opts.rate, "rate", 0, "target requests per second across all workers (0 = unthrottled)")
+	flag.DurationVar(&opts.interval, "report-interval", 10*time.Second, "interval between progress lines (0 = none)")
+	flag.BoolVar(&opts.jsonOutput, "json", false, "print the final report as JSON")
+	flag.IntVar(&opts.generator.Accounts, "accounts", 10000, "number of distinct accounts")
+	flag.IntVar(&opts.generator.Merchants, "merchants", 500, "number of distinct merchants")
+	flag.Float64Var(&opts.generator.HotAccounts, "hot-accounts", 0.01, "share of accounts that are hot")
+	flag.Float64Var(&opts.generator.HotTraffic, "hot-traffic", 0.2, "share of traffic sent by hot accounts")
+	flag.Float64Var(&opts.generator.FraudRate, "fraud-rate", 0.02, "share of transactions carrying fraud traits")
+	flag.BoolVar(&opts.scenarios, "scenarios", false, "send bust-out, account takeover, card testing and mule flow scenarios instead of independent transactions")
+	flag.IntVar(&opts.generator.GeoSpread, "geo-spread", 0, "number of home cities accounts are spread over (0 = all)")
+	flag.Int64Var(&opts.generator.Seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+	if opts.generator.Accounts < 1 {
+		opts.generator.Accounts = 1
+	}
+	if opts.generator.Merchants < 1 {
+		opts.generator.Merchants = 1
+	}
+	return opts
+}
+
+func run(ctx context.Context, opts options) *recorder {
+	rec := newRecorder()
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.concurrency,
+			MaxIdleConnsPerHost: opts.concurrency,
+		},
+	}
+
+	// A shared ticker paces all workers when a target rate is set
+	var pace <-chan time.Time
+	if opts.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	if opts.interval > 0 {
+		ticker := time.NewTicker(opts.interval)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					rec.tick(os.Stderr)
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			next := newSource(opts, worker)
+			for {
+				if pace != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-pace:
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+
+				tx, fraud := next()
+				latency, status, decision, err := send(ctx, client, opts.target, opts.apiKey, tx)
+				if ctx.Err() != nil {
+					return
+				}
+				rec.record(latency, status, decision, fraud, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return rec
+}
+
+func send(ctx context.Context, client *http.Client, target, apiKey string, tx interface{}) (time.Duration, int, string, error) {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Decision string `json:"decision"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return time.Since(start), resp.StatusCode, "", nil
+		}
+	} else {
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+
+	return time.Since(start), resp.StatusCode, result.Decision, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogram is a log-linear latency histogram with bounded memory, so that
+// multi-hour runs do not have to keep every sample
+type histogram struct {
+	counts [64 * subBuckets]uint64
+	total  uint64
+	max    time.Duration
+}
+
+const subBuckets = 32
+
+func bucketFor(d time.Duration) int {
+	us := uint64(d / time.Microsecond)
+	if us < subBuckets {
+		return int(us)
+	}
+	exp := 63 - bits.LeadingZeros64(us)
+	shift := exp - 5 // keep 5 significant bits
+	sub := (us >> uint(shift)) & (subBuckets - 1)
+	return (shift+1)*subBuckets + int(sub)
+}
+
+// bucketValue returns the upper bound of a bucket
+func bucketValue(index int) time.Duration {
+	if index < subBuckets {
+		return time.Duration(index) * time.Microsecond
+	}
+	shift := index/subBuckets - 1
+	sub := uint64(index % subBuckets)
+	us := (subBuckets + sub + 1) << uint(shift)
+	return time.Duration(us) * time.Microsecond
+}
+
+func (h *histogram) record(d time.Duration) {
+	h.counts[bucketFor(d)]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(float64(h.total) * p / 100))
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			if v := bucketValue(i); v < h.max {
+				return v
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// recorder aggregates results from all workers
+type recorder struct {
+	mu        sync.Mutex
+	latency   histogram
+	interval  histogram
+	statuses  map[int]uint64
+	decisions map[string]uint64
+	errors    uint64
+	fraudSent uint64
+	started   time.Time
+	lastTick  time.Time
+}
+
+func newRecorder() *recorder {
+	now := time.Now()
+	return &recorder{
+		statuses:  make(map[int]uint64),
+		decisions: make(map[string]uint64),
+		started:   now,
+		lastTick:  now,
+	}
+}
+
+func (r *recorder) record(latency time.Duration, status int, decision string, fraud bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fraud {
+		r.fraudSent++
+	}
+	if err != nil {
+		r.errors++
+		return
+	}
+	r.latency.record(latency)
+	r.interval.record(latency)
+	r.statuses[status]++
+	if decision != "" {
+		r.decisions[decision]++
+	}
+}
+
+// tick prints an interim line covering the samples since the previous tick
+func (r *recorder) tick(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(r.lastTick).Seconds()
+	fmt.Fprintf(w, "[%s] %8.1f req/s  p50=%-9s p99=%-9s max=%-9s errors=%d\n",
+		now.Sub(r.started).Truncate(time.Second),
+		float64(r.interval.total)/elapsed,
+		r.interval.percentile(50), r.interval.percentile(99), r.interval.max, r.errors)
+	r.interval = histogram{}
+	r.lastTick = now
+}
+
+// summary is the final machine-readable report
+type summary struct {
+	Duration   string            `json:"duration"`
+	Requests   uint64            `json:"requests"`
+	Errors     uint64            `json:"errors"`
+	Throughput float64           `json:"throughput_rps"`
+	Latency    map[string]string `json:"latency"`
+	Statuses   map[string]uint64 `json:"statuses"`
+	Decisions  map[string]uint64 `json:"decisions"`
+	FraudSent  uint64            `json:"fraud_sent"`
+}
+
+func (r *recorder) summary() summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := time.Since(r.started)
+	statuses := make(map[string]uint64, len(r.statuses))
+	for code, n := range r.statuses {
+		statuses[fmt.Sprint(code)] = n
+	}
+	decisions := make(map[string]uint64, len(r.decisions))
+	for d, n := range r.decisions {
+		decisions[d] = n
+	}
+
+	return summary{
+		Duration:   elapsed.Truncate(time.Millisecond).String(),
+		Requests:   r.latency.total,
+		Errors:     r.errors,
+		Throughput: float64(r.latency.total) / elapsed.Seconds(),
+		Latency: map[string]string{
+			"p50":  r.latency.percentile(50).String(),
+			"p90":  r.latency.percentile(90).String(),
+			"p95":  r.latency.percentile(95).String(),
+			"p99":  r.latency.percentile(99).String(),
+			"p999": r.latency.percentile(99.9).String(),
+			"max":  r.latency.max.String(),
+		},
+		Statuses:  statuses,
+		Decisions: decisions,
+		FraudSent: r.fraudSent,
+	}
+}
+
+func (s summary) writeText(w io.Writer) {
+	fmt.Fprintf(w, "\nDuration:    %s\n", s.Duration)
+	fmt.Fprintf(w, "Requests:    %d (%d errors)\n", s.Requests, s.Errors)
+	fmt.Fprintf(w, "Throughput:  %.1f req/s\n", s.Throughput)
+	fmt.Fprintf(w, "Fraud sent:  %d\n", s.FraudSent)
+	fmt.Fprintln(w, "Latency:")
+	for _, p := range []string{"p50", "p90", "p95", "p99", "p999", "max"} {
+		fmt.Fprintf(w, "  %-5s %s\n", p, s.Latency[p])
+	}
+	fmt.Fprintln(w, "Statuses:")
+	for _, k := range sortedKeys(s.Statuses) {
+		fmt.Fprintf(w, "  %-5s %d\n", k, s.Statuses[k])
+	}
+	fmt.Fprintln(w, "Decisions:")
+	for _, k := range sortedKeys(s.Decisions) {
+		fmt.Fprintf(w, "  %-8s %d\n", k, s.Decisions[k])
+	}
+}
+
+func (s summary) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/synthetic"
+)
+
+// source returns the next transaction of a worker and whether it was
+// generated as fraud
+type source func() (interface{}, bool)
+
+// newSource creates the transaction source of a worker: independent
+// transactions, or the fraud scenario streams of package synthetic
+func newSource(opts options, worker int) source {
+	if !opts.scenarios {
+		gen := newGenerator(opts.generator, worker)
+		return func() (interface{}, bool) {
+			return gen.Next()
+		}
+	}
+
+	gen := synthetic.New(synthetic.Config{
+		Seed:      opts.generator.Seed + int64(worker),
+		Accounts:  opts.generator.Accounts,
+		Merchants: opts.generator.Merchants,
+		FraudRate: opts.generator.FraudRate,
+		IDPrefix:  fmt.Sprintf("lg_%d_%d", time.Now().UnixNano(), worker),
+	})
+	return func() (interface{}, bool) {
+		record := gen.Next()
+		// The stream's time runs far faster than the load, so transactions are
+		// sent as of now, keeping the age of their accounts and beneficiaries
+		tx := record.Transaction
+		now := time.Now().UTC()
+		if !tx.AccountCreatedAt.IsZero() {
+			tx.AccountCreatedAt = now.Add(tx.AccountCreatedAt.Sub(tx.Timestamp))
+		}
+		if !tx.BeneficiaryAddedAt.IsZero() {
+			tx.BeneficiaryAddedAt = now.Add(tx.BeneficiaryAddedAt.Sub(tx.Timestamp))
+		}
+		tx.Timestamp = now
+		return tx, record.Fraud
+	}
+}
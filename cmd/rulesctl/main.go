@@ -0,0 +1,181 @@
+// Command rulesctl exports and imports the detection rule set of a running
+// engine as YAML.
+//
+// Usage:
+//
+//	rulesctl [-addr URL] [-api-key KEY] export [-o FILE]
+//	rulesctl [-addr URL] [-api-key KEY] import [-dry-run] FILE
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+type client struct {
+	addr   string
+	apiKey string
+	http   *http.Client
+}
+
+func main() {
+	log.SetFlags(0)
+
+	addr := flag.String("addr", "http://localhost:8080", "engine base URL")
+	apiKey := flag.String("api-key", os.Getenv("FRAUD_API_KEY"), "API key, defaults to $FRAUD_API_KEY")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := client{
+		addr:   strings.TrimSuffix(*addr, "/"),
+		apiKey: *apiKey,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "export":
+		err = c.export(flag.Args()[1:])
+	case "import":
+		err = c.importRules(flag.Args()[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("rulesctl: %v", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: rulesctl [-addr URL] [-api-key KEY] export [-o FILE]")
+	fmt.Fprintln(os.Stderr, "       rulesctl [-addr URL] [-api-key KEY] import [-dry-run] FILE")
+	flag.PrintDefaults()
+}
+
+// export writes the engine's rule set to a file or stdout
+func (c client) export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "file to write, defaults to stdout")
+	flags.Parse(args)
+
+	body, err := c.do(http.MethodGet, "/fraud/rules/export", nil)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+	return os.WriteFile(*output, body, 0o644)
+}
+
+// importRules validates a rule file locally, then imports it and prints the
+// diff
+func (c client) importRules(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only show what would change")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import takes one rule file")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := ruleset.Decode(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	path := "/fraud/rules/import"
+	if *dryRun {
+		path += "?dry_run=true"
+	}
+	body, err := c.do(http.MethodPost, path, data)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		DryRun bool         `json:"dry_run"`
+		Rules  int          `json:"rules"`
+		Diff   ruleset.Diff `json:"diff"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	printDiff(os.Stdout, result.Diff)
+	if result.DryRun {
+		fmt.Printf("dry run: %d expression rules, nothing applied\n", result.Rules)
+	} else {
+		fmt.Printf("imported %d expression rules\n", result.Rules)
+	}
+	return nil
+}
+
+func printDiff(w io.Writer, diff ruleset.Diff) {
+	if diff.Empty() {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	for _, id := range diff.Added {
+		fmt.Fprintf(w, "+ %s\n", id)
+	}
+	for _, id := range diff.Removed {
+		fmt.Fprintf(w, "- %s\n", id)
+	}
+	for _, id := range diff.Changed {
+		fmt.Fprintf(w, "~ %s\n", id)
+	}
+}
+
+func (c client) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(auth.APIKeyHeader, c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(data))
+		var failure apierror.ErrorResponse
+		if json.Unmarshal(data, &failure) == nil && failure.Error.Code != "" {
+			message = fmt.Sprintf("%s (%s)", failure.Error.Message, failure.Error.Code)
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, message)
+	}
+	return data, nil
+}
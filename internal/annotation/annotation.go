@@ -0,0 +1,430 @@
+// Package annotation keeps the notes, tags and attachments analysts add to
+// decisions while investigating them, so the context of an investigation
+// lives with the decision.
+//
+// Annotations are append-only: correcting one means adding another.
+package annotation
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of an annotation
+const (
+	MaxNoteLength   = 10000
+	MaxTags         = 20
+	MaxAttachments  = 10
+	DefaultLimit    = 100
+	MaxLimit        = 1000
+	attachmentBytes = 1 << 20
+)
+
+// ErrNotFound is returned for unknown annotations and attachments
+var ErrNotFound = errors.New("annotation not found")
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_:.-]{0,63}$`)
+
+// Annotation is what an analyst noted about a decision
+type Annotation struct {
+	ID            string       `json:"id" openapi:"readOnly"`
+	TransactionID string       `json:"transaction_id" openapi:"required,minLength=1"`
+	Note          string       `json:"note,omitempty"`
+	Tags          []string     `json:"tags,omitempty" doc:"Lowercase labels such as friendly_fraud or case:4821"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	// Author is the subject of the caller
+	Author    string    `json:"author" openapi:"readOnly"`
+	CreatedAt time.Time `json:"created_at" openapi:"readOnly"`
+}
+
+// Attachment is a file attached to an annotation, either uploaded as
+// Content or referenced by URL
+type Attachment struct {
+	Name        string `json:"name" openapi:"required,minLength=1"`
+	ContentType string `json:"content_type,omitempty"`
+	URL         string `json:"url,omitempty" doc:"Where the file is kept, instead of uploading its content"`
+	// Content is the uploaded file, base64 encoded in JSON. It is left out
+	// of listings and served on its own.
+	Content []byte `json:"content,omitempty" doc:"Base64 file content, up to 1 MiB; left out of listings"`
+	Size    int    `json:"size" openapi:"readOnly"`
+	SHA256  string `json:"sha256,omitempty" openapi:"readOnly"`
+}
+
+// Config holds the annotation settings
+type Config struct {
+	// Path is the file annotations are appended to, so they survive
+	// restarts; empty keeps them in memory only
+	Path string
+	// MaxAttachmentBytes caps the size of an uploaded attachment
+	MaxAttachmentBytes int
+}
+
+// DefaultConfig returns the default annotation settings
+func DefaultConfig() Config {
+	return Config{MaxAttachmentBytes: attachmentBytes}
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxAttachmentBytes <= 0 {
+		c.MaxAttachmentBytes = DefaultConfig().MaxAttachmentBytes
+	}
+	return c
+}
+
+// Store holds the annotations, indexed by transaction and tag
+type Store struct {
+	config      Config
+	annotations []Annotation
+	byID        map[string]int
+	// byTransaction and byTag list the annotations in the order added
+	byTransaction map[string][]int
+	byTag         map[string][]int
+	file          *os.File
+	mu            sync.RWMutex
+}
+
+// Open creates a store, loading the annotations of its file when it has one
+func Open(config Config) (*Store, error) {
+	s := &Store{
+		config:        config.withDefaults(),
+		byID:          make(map[string]int),
+		byTransaction: make(map[string][]int),
+		byTag:         make(map[string][]int),
+	}
+	if s.config.Path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate normalizes and checks an annotation about to be added
+func (s *Store) Validate(a *Annotation) error {
+	if a.TransactionID == "" {
+		return errors.New("transaction_id is required")
+	}
+	if len(a.Note) > MaxNoteLength {
+		return fmt.Errorf("note must be at most %d characters", MaxNoteLength)
+	}
+	if len(a.Tags) > MaxTags {
+		return fmt.Errorf("at most %d tags", MaxTags)
+	}
+	seen := make(map[string]bool, len(a.Tags))
+	tags := a.Tags[:0]
+	for _, tag := range a.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: lowercase letters, digits and _:.- only", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	a.Tags = tags
+	if len(a.Attachments) > MaxAttachments {
+		return fmt.Errorf("at most %d attachments", MaxAttachments)
+	}
+	names := make(map[string]bool, len(a.Attachments))
+	for i := range a.Attachments {
+		attachment := &a.Attachments[i]
+		switch {
+		case attachment.Name == "" || strings.ContainsAny(attachment.Name, "/\\"):
+			return fmt.Errorf("attachments[%d]: name is required and must not contain slashes", i)
+		case names[attachment.Name]:
+			return fmt.Errorf("attachments[%d]: duplicate name %s", i, attachment.Name)
+		case (len(attachment.Content) == 0) == (attachment.URL == ""):
+			return fmt.Errorf("attachments[%d]: either content or url is required", i)
+		case len(attachment.Content) > s.config.MaxAttachmentBytes:
+			return fmt.Errorf("attachments[%d]: content must be at most %d bytes", i, s.config.MaxAttachmentBytes)
+		}
+		names[attachment.Name] = true
+		attachment.Size = len(attachment.Content)
+		attachment.SHA256 = ""
+		if attachment.Size > 0 {
+			sum := sha256.Sum256(attachment.Content)
+			attachment.SHA256 = hex.EncodeToString(sum[:])
+		}
+	}
+	if a.Note == "" && len(a.Tags) == 0 && len(a.Attachments) == 0 {
+		return errors.New("an annotation needs a note, tags or attachments")
+	}
+	return nil
+}
+
+// Add validates an annotation, assigns its ID and creation time, and keeps
+// it. The returned annotation leaves out attachment content.
+func (s *Store) Add(a Annotation) (Annotation, error) {
+	if err := s.Validate(&a); err != nil {
+		return Annotation{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Annotation{}, err
+	}
+	a.ID = "ann_" + hex.EncodeToString(id)
+	a.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(a); err != nil {
+		return Annotation{}, err
+	}
+	s.add(a)
+	return withoutContent(a), nil
+}
+
+// add indexes an annotation. Callers must hold the lock.
+func (s *Store) add(a Annotation) {
+	i := len(s.annotations)
+	s.annotations = append(s.annotations, a)
+	s.byID[a.ID] = i
+	s.byTransaction[a.TransactionID] = append(s.byTransaction[a.TransactionID], i)
+	for _, tag := range a.Tags {
+		s.byTag[tag] = append(s.byTag[tag], i)
+	}
+}
+
+// Query selects annotations. Empty fields match everything; all set fields
+// must match.
+type Query struct {
+	TransactionID string
+	Tag           string
+	Author        string
+	// Text matches the notes and attachment names, ignoring case
+	Text  string
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of results, newest first
+	Limit int
+}
+
+// Matches reports whether an annotation satisfies the query
+func (q Query) Matches(a Annotation) bool {
+	if q.TransactionID != "" && a.TransactionID != q.TransactionID ||
+		q.Author != "" && a.Author != q.Author ||
+		!q.Since.IsZero() && a.CreatedAt.Before(q.Since) ||
+		!q.Until.IsZero() && a.CreatedAt.After(q.Until) {
+		return false
+	}
+	if q.Tag != "" && !hasTag(a, strings.ToLower(q.Tag)) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		found := strings.Contains(strings.ToLower(a.Note), text)
+		for _, attachment := range a.Attachments {
+			found = found || strings.Contains(strings.ToLower(attachment.Name), text)
+		}
+		return found
+	}
+	return true
+}
+
+func hasTag(a Annotation, tag string) bool {
+	for _, t := range a.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the annotations matching a query, newest first and
+// without attachment content
+func (s *Store) Search(q Query) []Annotation {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.candidates(q)
+	result := []Annotation{}
+	for i := len(candidates) - 1; i >= 0 && len(result) < limit; i-- {
+		if a := s.annotations[candidates[i]]; q.Matches(a) {
+			result = append(result, withoutContent(a))
+		}
+	}
+	return result
+}
+
+// candidates returns the positions of the annotations that may match a
+// query, ascending. Callers must hold the lock.
+func (s *Store) candidates(q Query) []int {
+	switch {
+	case q.TransactionID != "":
+		return s.byTransaction[q.TransactionID]
+	case q.Tag != "":
+		return s.byTag[strings.ToLower(q.Tag)]
+	}
+	all := make([]int, len(s.annotations))
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// Tags counts the annotations of each tag, most used first
+func (s *Store) Tags() []TagCount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make([]TagCount, 0, len(s.byTag))
+	for tag, annotations := range s.byTag {
+		counts = append(counts, TagCount{Tag: tag, Count: len(annotations)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+	return counts
+}
+
+// TagCount is the number of annotations of a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Attachment returns an attachment of an annotation, with its content
+func (s *Store) Attachment(id, name string) (Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i, exists := s.byID[id]; exists {
+		for _, attachment := range s.annotations[i].Attachments {
+			if attachment.Name == name {
+				return attachment, nil
+			}
+		}
+	}
+	return Attachment{}, ErrNotFound
+}
+
+func withoutContent(a Annotation) Annotation {
+	if len(a.Attachments) == 0 {
+		return a
+	}
+	attachments := make([]Attachment, len(a.Attachments))
+	for i, attachment := range a.Attachments {
+		attachment.Content = nil
+		attachments[i] = attachment
+	}
+	a.Attachments = attachments
+	return a
+}
+
+// load replays the annotation file
+func (s *Store) load() error {
+	f, err := os.Open(s.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var invalid error
+	for line := 1; scanner.Scan(); line++ {
+		if invalid != nil {
+			return invalid
+		}
+		var a Annotation
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			// A crash can leave the last line half-written, which compacting
+			// drops; an invalid line before others is corruption
+			invalid = fmt.Errorf("invalid annotation on line %d: %w", line, err)
+			continue
+		}
+		s.add(a)
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the annotation file with the loaded annotations, then
+// keeps it open for appends
+func (s *Store) compact() error {
+	tmp := s.config.Path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, a := range s.annotations {
+		if err := encoder.Encode(a); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.config.Path); err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(s.config.Path, os.O_APPEND|os.O_WRONLY, 0o600)
+	return err
+}
+
+// append writes an annotation to the file. Callers must hold the lock.
+func (s *Store) append(a Annotation) error {
+	if s.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Len returns the number of annotations
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.annotations)
+}
+
+// Close closes the annotation file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,108 @@
+package annotation_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/annotation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_AddsAndSearches(t *testing.T) {
+	store, err := annotation.Open(annotation.DefaultConfig())
+	require.NoError(t, err)
+
+	first, err := store.Add(annotation.Annotation{TransactionID: "TX-1", Note: "Customer confirmed the purchase", Tags: []string{"Friendly_Fraud", "friendly_fraud"}, Author: "alice"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.ID)
+	assert.False(t, first.CreatedAt.IsZero())
+	assert.Equal(t, []string{"friendly_fraud"}, first.Tags)
+
+	_, err = store.Add(annotation.Annotation{TransactionID: "TX-2", Tags: []string{"case:4821", "friendly_fraud"}, Author: "bob"})
+	require.NoError(t, err)
+	_, err = store.Add(annotation.Annotation{TransactionID: "TX-1", Note: "Chargeback filed anyway", Author: "bob"})
+	require.NoError(t, err)
+
+	byTransaction := store.Search(annotation.Query{TransactionID: "TX-1"})
+	require.Len(t, byTransaction, 2)
+	assert.Equal(t, "Chargeback filed anyway", byTransaction[0].Note, "newest first")
+
+	assert.Len(t, store.Search(annotation.Query{Tag: "FRIENDLY_FRAUD"}), 2)
+	assert.Len(t, store.Search(annotation.Query{Author: "bob"}), 2)
+	assert.Len(t, store.Search(annotation.Query{Text: "chargeback"}), 1)
+	assert.Len(t, store.Search(annotation.Query{Tag: "friendly_fraud", Author: "alice"}), 1)
+	assert.Empty(t, store.Search(annotation.Query{Since: time.Now().Add(time.Minute)}))
+	assert.Len(t, store.Search(annotation.Query{Limit: 1}), 1)
+
+	assert.Equal(t, []annotation.TagCount{{Tag: "friendly_fraud", Count: 2}, {Tag: "case:4821", Count: 1}}, store.Tags())
+}
+
+func TestStore_Validates(t *testing.T) {
+	store, err := annotation.Open(annotation.Config{MaxAttachmentBytes: 4})
+	require.NoError(t, err)
+
+	for name, a := range map[string]annotation.Annotation{
+		"no transaction":  {Note: "note"},
+		"empty":           {TransactionID: "TX-1"},
+		"invalid tag":     {TransactionID: "TX-1", Tags: []string{"two words"}},
+		"no content":      {TransactionID: "TX-1", Attachments: []annotation.Attachment{{Name: "a.png"}}},
+		"content and url": {TransactionID: "TX-1", Attachments: []annotation.Attachment{{Name: "a.png", Content: []byte("a"), URL: "https://files/a.png"}}},
+		"too large":       {TransactionID: "TX-1", Attachments: []annotation.Attachment{{Name: "a.png", Content: []byte("12345")}}},
+		"slash in name":   {TransactionID: "TX-1", Attachments: []annotation.Attachment{{Name: "../a.png", URL: "https://files/a.png"}}},
+		"duplicate names": {TransactionID: "TX-1", Attachments: []annotation.Attachment{{Name: "a", URL: "https://f/1"}, {Name: "a", URL: "https://f/2"}}},
+	} {
+		_, err := store.Add(a)
+		assert.Error(t, err, name)
+	}
+	assert.Zero(t, store.Len())
+}
+
+func TestStore_KeepsAttachments(t *testing.T) {
+	store, err := annotation.Open(annotation.DefaultConfig())
+	require.NoError(t, err)
+
+	added, err := store.Add(annotation.Annotation{TransactionID: "TX-1", Attachments: []annotation.Attachment{
+		{Name: "receipt.txt", ContentType: "text/plain", Content: []byte("paid")},
+		{Name: "ticket", URL: "https://tickets.example.com/4821"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, added.Attachments, 2)
+	assert.Nil(t, added.Attachments[0].Content, "content is served on its own")
+	assert.Equal(t, 4, added.Attachments[0].Size)
+	assert.NotEmpty(t, added.Attachments[0].SHA256)
+	assert.Nil(t, store.Search(annotation.Query{})[0].Attachments[0].Content)
+
+	attachment, err := store.Attachment(added.ID, "receipt.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "paid", string(attachment.Content))
+	_, err = store.Attachment(added.ID, "missing")
+	assert.ErrorIs(t, err, annotation.ErrNotFound)
+}
+
+func TestStore_SurvivesRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.jsonl")
+	store, err := annotation.Open(annotation.Config{Path: path})
+	require.NoError(t, err)
+	added, err := store.Add(annotation.Annotation{TransactionID: "TX-1", Note: "mule", Tags: []string{"mule"}, Attachments: []annotation.Attachment{{Name: "a.txt", Content: []byte("x")}}})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// A crash left half a line behind
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id": "ann_`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	store, err = annotation.Open(annotation.Config{Path: path})
+	require.NoError(t, err)
+	defer store.Close()
+	assert.Equal(t, 1, store.Len())
+	assert.Len(t, store.Search(annotation.Query{Tag: "mule"}), 1)
+	attachment, err := store.Attachment(added.ID, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(attachment.Content))
+}
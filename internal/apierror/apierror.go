@@ -0,0 +1,89 @@
+// Package apierror writes API errors as JSON with a typed code, so that
+// clients can branch on the code instead of parsing messages
+package apierror
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Code identifies the kind of an error. Codes are stable; messages are not.
+type Code string
+
+// Error codes
+const (
+	InvalidRequest     Code = "INVALID_REQUEST"
+	InvalidTransaction Code = "INVALID_TRANSACTION"
+	Unauthenticated    Code = "UNAUTHENTICATED"
+	Forbidden          Code = "FORBIDDEN"
+	NotFound           Code = "NOT_FOUND"
+	MethodNotAllowed   Code = "METHOD_NOT_ALLOWED"
+	Conflict           Code = "CONFLICT"
+	PayloadTooLarge    Code = "PAYLOAD_TOO_LARGE"
+	RateLimited        Code = "RATE_LIMITED"
+	QuotaExceeded      Code = "QUOTA_EXCEEDED"
+	MLUnavailable      Code = "ML_UNAVAILABLE"
+	Unavailable        Code = "UNAVAILABLE"
+	Internal           Code = "INTERNAL"
+)
+
+// Error is the body of an error response
+type Error struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	// Details lists the individual problems, such as each failed validation
+	Details []string `json:"details,omitempty"`
+}
+
+// ErrorResponse wraps an error as it is encoded
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// CodeFor returns the code of errors with an HTTP status that have no more
+// specific one
+func CodeFor(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return InvalidRequest
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusRequestEntityTooLarge:
+		return PayloadTooLarge
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusPaymentRequired:
+		return QuotaExceeded
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 400 && status < 500 {
+		return InvalidRequest
+	}
+	return Internal
+}
+
+// Write writes an error response with the code of its status. It takes the
+// arguments of http.Error.
+func Write(w http.ResponseWriter, message string, status int) {
+	WriteCode(w, status, CodeFor(status), message)
+}
+
+// WriteCode writes an error response with a code
+func WriteCode(w http.ResponseWriter, status int, code Code, message string, details ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: Error{Code: code, Message: message, Details: details}}); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
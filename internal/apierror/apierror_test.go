@@ -0,0 +1,37 @@
+package apierror_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	apierror.Write(rec, "no decision found for transaction: TX-1", http.StatusNotFound)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var response apierror.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, apierror.NotFound, response.Error.Code)
+	assert.Equal(t, "no decision found for transaction: TX-1", response.Error.Message)
+
+	rec = httptest.NewRecorder()
+	apierror.WriteCode(rec, http.StatusServiceUnavailable, apierror.MLUnavailable, "ML engine not ready")
+	assert.JSONEq(t, `{"error":{"code":"ML_UNAVAILABLE","message":"ML engine not ready"}}`, rec.Body.String())
+}
+
+func TestCodeFor(t *testing.T) {
+	assert.Equal(t, apierror.InvalidRequest, apierror.CodeFor(http.StatusBadRequest))
+	assert.Equal(t, apierror.Unauthenticated, apierror.CodeFor(http.StatusUnauthorized))
+	assert.Equal(t, apierror.RateLimited, apierror.CodeFor(http.StatusTooManyRequests))
+	assert.Equal(t, apierror.QuotaExceeded, apierror.CodeFor(http.StatusPaymentRequired))
+	assert.Equal(t, apierror.InvalidRequest, apierror.CodeFor(http.StatusUnprocessableEntity))
+	assert.Equal(t, apierror.Internal, apierror.CodeFor(http.StatusInternalServerError))
+}
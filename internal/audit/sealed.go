@@ -0,0 +1,206 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/tenantkey"
+)
+
+// SealedStore is a bounded Store keeping every record encrypted under the
+// key of its merchant's tenant. Records are decrypted to be read, so Since
+// and Search scan every record without the indexes of MemoryStore.
+type SealedStore struct {
+	keyring *tenantkey.Keyring
+	// tenantOf returns the tenant of a merchant, empty outside any tenant
+	tenantOf func(merchantID string) string
+	rows     []tenantkey.Sealed
+	next     int
+	full     bool
+	mu       sync.RWMutex
+}
+
+// NewSealedStore creates a store holding up to capacity records, sealed
+// under the keys of the tenants tenantOf assigns their merchants to.
+// Merchants outside any tenant are sealed under tenantkey.DefaultTenant.
+func NewSealedStore(capacity int, keyring *tenantkey.Keyring, tenantOf func(merchantID string) string) *SealedStore {
+	if capacity <= 0 {
+		capacity = 100000
+	}
+	return &SealedStore{
+		keyring:  keyring,
+		tenantOf: tenantOf,
+		rows:     make([]tenantkey.Sealed, capacity),
+	}
+}
+
+// Save seals a record, evicting the oldest one when full. The record's
+// tenant is the one of its merchant when saved.
+func (s *SealedStore) Save(record Record) error {
+	_, err := s.SaveBatch([]Record{record})
+	return err
+}
+
+// SaveBatch seals records and appends them under one lock. A record that
+// cannot be sealed stops the batch; those before it are saved.
+func (s *SealedStore) SaveBatch(records []Record) (int, error) {
+	rows := make([]tenantkey.Sealed, 0, len(records))
+	var err error
+	for _, record := range records {
+		var sealed tenantkey.Sealed
+		if sealed, err = s.seal(record); err != nil {
+			break
+		}
+		rows = append(rows, sealed)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sealed := range rows {
+		s.rows[s.next] = sealed
+		s.next = (s.next + 1) % len(s.rows)
+		if s.next == 0 {
+			s.full = true
+		}
+	}
+	return len(rows), err
+}
+
+// seal seals a record under the key of its merchant's tenant
+func (s *SealedStore) seal(record Record) (tenantkey.Sealed, error) {
+	tenant := s.tenantOf(record.Transaction.MerchantID)
+	if tenant == "" {
+		tenant = tenantkey.DefaultTenant
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return tenantkey.Sealed{}, err
+	}
+	return s.keyring.Seal(tenant, data)
+}
+
+// Since returns records decided at or after t, oldest first
+func (s *SealedStore) Since(t time.Time) ([]Record, error) {
+	rows := s.snapshot()
+	result := []Record{}
+	for _, row := range rows {
+		record, err := s.open(row)
+		if err != nil {
+			return nil, err
+		}
+		if !record.DecidedAt.Before(t) {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// Search returns the records matching a query, newest first
+func (s *SealedStore) Search(q Query) ([]Record, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	rows := s.snapshot()
+	result := []Record{}
+	for i := len(rows) - 1; i >= 0 && len(result) < limit; i-- {
+		record, err := s.open(rows[i])
+		if err != nil {
+			return nil, err
+		}
+		if q.Matches(record) {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+func (s *SealedStore) open(row tenantkey.Sealed) (Record, error) {
+	var record Record
+	data, err := s.keyring.Open(row)
+	if err != nil {
+		return record, fmt.Errorf("opening audit record of tenant %s: %w", row.Tenant, err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, err
+	}
+	return record, nil
+}
+
+// snapshot returns the sealed records, oldest first
+func (s *SealedStore) snapshot() []tenantkey.Sealed {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rows []tenantkey.Sealed
+	if s.full {
+		rows = append(rows, s.rows[s.next:]...)
+	}
+	return append(rows, s.rows[:s.next]...)
+}
+
+// IsolationReport is the outcome of checking that no tenant can read the
+// records of another
+type IsolationReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Records   int       `json:"records"`
+	Tenants   []string  `json:"tenants"`
+	// RecordsByTenant counts the records sealed under each tenant's key
+	RecordsByTenant map[string]int `json:"records_by_tenant"`
+	// Attempts counts the reads of a record with another tenant's key,
+	// both as stored and relabeled as that tenant's
+	Attempts int `json:"attempts"`
+	// Violations are the records read with another tenant's key
+	Violations []IsolationViolation `json:"violations"`
+	// Unreadable counts the records that did not open with their own key
+	Unreadable int `json:"unreadable"`
+	// Isolated is set when every record opened with its own key only
+	Isolated bool `json:"isolated"`
+}
+
+// IsolationViolation is a record of Tenant that ReadBy could read
+type IsolationViolation struct {
+	Record int    `json:"record"`
+	Tenant string `json:"tenant"`
+	ReadBy string `json:"read_by"`
+}
+
+// VerifyIsolation tries to read every record with the key of every other
+// tenant, as stored and relabeled as that tenant's, and with its own key
+func (s *SealedStore) VerifyIsolation() IsolationReport {
+	rows := s.snapshot()
+	tenants := s.keyring.Tenants()
+	report := IsolationReport{
+		CheckedAt:       time.Now(),
+		Records:         len(rows),
+		Tenants:         tenants,
+		RecordsByTenant: make(map[string]int, len(tenants)),
+		Violations:      []IsolationViolation{},
+	}
+	for i, row := range rows {
+		report.RecordsByTenant[row.Tenant]++
+		if _, err := s.keyring.Open(row); err != nil {
+			report.Unreadable++
+		}
+		for _, other := range tenants {
+			if other == row.Tenant {
+				continue
+			}
+			relabeled := tenantkey.Sealed{Tenant: other, Data: row.Data}
+			for _, attempt := range []tenantkey.Sealed{row, relabeled} {
+				report.Attempts++
+				if _, err := s.keyring.OpenAs(other, attempt); err == nil {
+					report.Violations = append(report.Violations, IsolationViolation{Record: i, Tenant: row.Tenant, ReadBy: other})
+				}
+			}
+		}
+	}
+	report.Isolated = len(report.Violations) == 0 && report.Unreadable == 0
+	return report
+}
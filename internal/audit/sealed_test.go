@@ -0,0 +1,69 @@
+package audit_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/tenantkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sealedStore(t *testing.T, capacity int) *audit.SealedStore {
+	keyring, err := tenantkey.NewKeyring(map[string][]byte{
+		tenantkey.DefaultTenant: bytes.Repeat([]byte{1}, 32),
+		"bank-a":                bytes.Repeat([]byte{2}, 32),
+		"bank-b":                bytes.Repeat([]byte{3}, 32),
+	})
+	require.NoError(t, err)
+	tenants := map[string]string{"MER-A": "bank-a", "MER-B": "bank-b"}
+	return audit.NewSealedStore(capacity, keyring, func(merchantID string) string { return tenants[merchantID] })
+}
+
+func TestSealedStore_ReadsBack(t *testing.T) {
+	store := sealedStore(t, 3)
+	base := time.Now()
+	for i, merchant := range []string{"MER-A", "MER-B", "MER-C", "MER-A"} {
+		require.NoError(t, store.Save(audit.Record{
+			Transaction: detector.Transaction{ID: string(rune('A' + i)), MerchantID: merchant},
+			Decision:    "APPROVE",
+			DecidedAt:   base.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	records, err := store.Since(base.Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "C", records[0].Transaction.ID)
+
+	found, err := store.Search(audit.Query{MerchantID: "MER-A"})
+	require.NoError(t, err)
+	require.Len(t, found, 1, "the oldest record was evicted")
+	assert.Equal(t, "D", found[0].Transaction.ID)
+}
+
+func TestSealedStore_VerifiesIsolation(t *testing.T) {
+	store := sealedStore(t, 10)
+	for _, merchant := range []string{"MER-A", "MER-B", "MER-C"} {
+		require.NoError(t, store.Save(audit.Record{Transaction: detector.Transaction{ID: "TX-" + merchant, MerchantID: merchant}}))
+	}
+
+	report := store.VerifyIsolation()
+	assert.True(t, report.Isolated)
+	assert.Equal(t, 3, report.Records)
+	assert.Equal(t, map[string]int{"bank-a": 1, "bank-b": 1, tenantkey.DefaultTenant: 1}, report.RecordsByTenant)
+	assert.Equal(t, 3*2*2, report.Attempts)
+	assert.Empty(t, report.Violations)
+}
+
+func TestSealedStore_RejectsTenantsWithoutKeys(t *testing.T) {
+	keyring, err := tenantkey.NewKeyring(map[string][]byte{"bank-a": bytes.Repeat([]byte{2}, 32)})
+	require.NoError(t, err)
+	store := audit.NewSealedStore(10, keyring, func(string) string { return "" })
+
+	err = store.Save(audit.Record{Transaction: detector.Transaction{ID: "TX-1"}})
+	assert.ErrorIs(t, err, tenantkey.ErrNoKey)
+}
@@ -0,0 +1,233 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query selects audit records. Empty fields match everything; all set
+// fields must match.
+type Query struct {
+	TransactionID string
+	AccountID     string
+	IPAddress     string
+	DeviceID      string
+	MerchantID    string
+	ReasonCode    string
+	Decision      string
+	MinAmount     *float64
+	MaxAmount     *float64
+	Since         time.Time
+	Until         time.Time
+	// Terms match any indexed field
+	Terms []string
+	// Limit caps the number of results, newest first
+	Limit int
+}
+
+// Search limits
+const (
+	DefaultSearchLimit = 100
+	MaxSearchLimit     = 1000
+)
+
+// indexed fields, by query prefix
+const (
+	fieldTransaction = "tx"
+	fieldAccount     = "account"
+	fieldIP          = "ip"
+	fieldDevice      = "device"
+	fieldMerchant    = "merchant"
+	fieldCode        = "code"
+)
+
+var indexedFields = []string{fieldTransaction, fieldAccount, fieldIP, fieldDevice, fieldMerchant, fieldCode}
+
+// ParseQuery parses a free-form query of space separated terms. Terms of the
+// form field:value match one field (tx, account, ip, device, merchant, code,
+// decision), amount>N, amount<N and amount:N..M bound the amount, and bare
+// terms match any indexed field.
+func ParseQuery(q string) (Query, error) {
+	var query Query
+	for _, term := range strings.Fields(q) {
+		switch {
+		case strings.HasPrefix(term, "amount>"):
+			min, err := parseAmount(strings.TrimPrefix(term, "amount>"))
+			if err != nil {
+				return query, err
+			}
+			query.MinAmount = &min
+		case strings.HasPrefix(term, "amount<"):
+			max, err := parseAmount(strings.TrimPrefix(term, "amount<"))
+			if err != nil {
+				return query, err
+			}
+			query.MaxAmount = &max
+		case strings.HasPrefix(term, "amount:"):
+			bounds := strings.SplitN(strings.TrimPrefix(term, "amount:"), "..", 2)
+			if len(bounds) != 2 {
+				return query, fmt.Errorf("amount range must look like amount:100..500, got %q", term)
+			}
+			if bounds[0] != "" {
+				min, err := parseAmount(bounds[0])
+				if err != nil {
+					return query, err
+				}
+				query.MinAmount = &min
+			}
+			if bounds[1] != "" {
+				max, err := parseAmount(bounds[1])
+				if err != nil {
+					return query, err
+				}
+				query.MaxAmount = &max
+			}
+		default:
+			field, value, found := strings.Cut(term, ":")
+			if !found {
+				query.Terms = append(query.Terms, term)
+				continue
+			}
+			if err := query.set(field, value); err != nil {
+				return query, err
+			}
+		}
+	}
+	return query, nil
+}
+
+func parseAmount(s string) (float64, error) {
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+// set assigns a field:value term
+func (q *Query) set(field, value string) error {
+	switch field {
+	case fieldTransaction:
+		q.TransactionID = value
+	case fieldAccount:
+		q.AccountID = value
+	case fieldIP:
+		q.IPAddress = value
+	case fieldDevice:
+		q.DeviceID = value
+	case fieldMerchant:
+		q.MerchantID = value
+	case fieldCode:
+		q.ReasonCode = value
+	case "decision":
+		q.Decision = strings.ToUpper(value)
+	default:
+		return fmt.Errorf("unknown search field %q", field)
+	}
+	return nil
+}
+
+// keys returns the index keys a query pins down
+func (q Query) keys() []string {
+	var keys []string
+	add := func(field, value string) {
+		if value != "" {
+			keys = append(keys, indexKey(field, value))
+		}
+	}
+	add(fieldTransaction, q.TransactionID)
+	add(fieldAccount, q.AccountID)
+	add(fieldIP, q.IPAddress)
+	add(fieldDevice, q.DeviceID)
+	add(fieldMerchant, q.MerchantID)
+	add(fieldCode, q.ReasonCode)
+	return keys
+}
+
+// Matches reports whether a record satisfies the query
+func (q Query) Matches(r Record) bool {
+	tx := r.Transaction
+	if !matchField(q.TransactionID, tx.ID) || !matchField(q.AccountID, tx.AccountID) ||
+		!matchField(q.IPAddress, tx.IPAddress) || !matchField(q.DeviceID, tx.DeviceID) ||
+		!matchField(q.MerchantID, tx.MerchantID) || !matchField(q.Decision, r.Decision) {
+		return false
+	}
+	if q.ReasonCode != "" && !hasCode(r, q.ReasonCode) {
+		return false
+	}
+	if q.MinAmount != nil && tx.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && tx.Amount > *q.MaxAmount {
+		return false
+	}
+	if !q.Since.IsZero() && r.DecidedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.DecidedAt.After(q.Until) {
+		return false
+	}
+	for _, term := range q.Terms {
+		if !matchesAnyKey(r, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(want, value string) bool {
+	return want == "" || want == value
+}
+
+func hasCode(r Record, code string) bool {
+	for _, c := range r.ReasonCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyKey(r Record, term string) bool {
+	keys := recordKeys(r)
+	for _, field := range indexedFields {
+		if contains(keys, indexKey(field, term)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func indexKey(field, value string) string {
+	return field + ":" + value
+}
+
+// recordKeys returns the distinct index keys of a record
+func recordKeys(r Record) []string {
+	var keys []string
+	add := func(field, value string) {
+		if key := indexKey(field, value); value != "" && !contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	add(fieldTransaction, r.Transaction.ID)
+	add(fieldAccount, r.Transaction.AccountID)
+	add(fieldIP, r.Transaction.IPAddress)
+	add(fieldDevice, r.Transaction.DeviceID)
+	add(fieldMerchant, r.Transaction.MerchantID)
+	for _, code := range r.ReasonCodes {
+		add(fieldCode, code)
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+package audit_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := audit.ParseQuery("ip:203.0.113.7 code:HIGH_VELOCITY decision:block amount:100..500 DEV-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "203.0.113.7", query.IPAddress)
+	assert.Equal(t, "HIGH_VELOCITY", query.ReasonCode)
+	assert.Equal(t, "BLOCK", query.Decision)
+	require.NotNil(t, query.MinAmount)
+	require.NotNil(t, query.MaxAmount)
+	assert.Equal(t, 100.0, *query.MinAmount)
+	assert.Equal(t, 500.0, *query.MaxAmount)
+	assert.Equal(t, []string{"DEV-1"}, query.Terms)
+
+	query, err = audit.ParseQuery("amount>1000")
+	require.NoError(t, err)
+	require.NotNil(t, query.MinAmount)
+	assert.Nil(t, query.MaxAmount)
+
+	_, err = audit.ParseQuery("color:red")
+	assert.Error(t, err)
+	_, err = audit.ParseQuery("amount:lots")
+	assert.Error(t, err)
+}
+
+func saveSearchRecords(t *testing.T, store *audit.MemoryStore, n int) {
+	base := time.Now()
+	for i := 0; i < n; i++ {
+		record := audit.Record{
+			Transaction: detector.Transaction{
+				ID:         fmt.Sprintf("TX-%d", i),
+				AccountID:  fmt.Sprintf("ACC-%d", i%3),
+				Amount:     float64(100 * (i + 1)),
+				IPAddress:  fmt.Sprintf("10.0.0.%d", i%2),
+				DeviceID:   "DEV-1",
+				MerchantID: "MERCH-1",
+			},
+			Decision:  "ALLOW",
+			DecidedAt: base.Add(time.Duration(i) * time.Second),
+		}
+		if i%4 == 0 {
+			record.Decision = "BLOCK"
+			record.ReasonCodes = []string{"HIGH_VELOCITY"}
+		}
+		require.NoError(t, store.Save(record))
+	}
+}
+
+func TestMemoryStore_Search(t *testing.T) {
+	store := audit.NewMemoryStore(100)
+	saveSearchRecords(t, store, 10)
+
+	records, err := store.Search(audit.Query{IPAddress: "10.0.0.1"})
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	assert.Equal(t, "TX-9", records[0].Transaction.ID, "newest first")
+	assert.Equal(t, "TX-1", records[4].Transaction.ID)
+
+	records, err = store.Search(audit.Query{ReasonCode: "HIGH_VELOCITY", AccountID: "ACC-1"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "TX-4", records[0].Transaction.ID)
+
+	query, err := audit.ParseQuery("ACC-2 amount:200..500")
+	require.NoError(t, err)
+	records, err = store.Search(query)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "TX-2", records[0].Transaction.ID)
+
+	records, err = store.Search(audit.Query{Decision: "BLOCK", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "TX-8", records[0].Transaction.ID)
+	assert.Equal(t, "TX-4", records[1].Transaction.ID)
+
+	records, err = store.Search(audit.Query{DeviceID: "DEV-unknown"})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestMemoryStore_SearchAfterEviction(t *testing.T) {
+	store := audit.NewMemoryStore(4)
+	saveSearchRecords(t, store, 10)
+
+	records, err := store.Search(audit.Query{MerchantID: "MERCH-1"})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "TX-9", records[0].Transaction.ID)
+	assert.Equal(t, "TX-6", records[3].Transaction.ID)
+
+	records, err = store.Search(audit.Query{TransactionID: "TX-0"})
+	require.NoError(t, err)
+	assert.Empty(t, records, "evicted records are no longer indexed")
+
+	records, err = store.Search(audit.Query{Terms: []string{"10.0.0.0"}})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "TX-8", records[0].Transaction.ID)
+}
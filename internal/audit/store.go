@@ -0,0 +1,270 @@
+// Package audit keeps a record of every scored transaction and its decision.
+package audit
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Record is a single audited decision
+type Record struct {
+	Transaction detector.Transaction `json:"transaction"`
+	Decision    string               `json:"decision"`
+	RiskScore   float64              `json:"risk_score"`
+	RuleScore   float64              `json:"rule_score"`
+	MLScore     float64              `json:"ml_score"`
+	Confidence  float64              `json:"confidence"`
+	Reasons     []string             `json:"reasons,omitempty"`
+	ReasonCodes []string             `json:"reason_codes,omitempty"`
+	DecidedAt   time.Time            `json:"decided_at"`
+	// ExpiresAt is when the decision must be revalidated before capture
+	ExpiresAt time.Time `json:"expires_at"`
+	// ObserveOnly is set when the merchant was in observe-only mode, so the
+	// API approved the transaction whatever the decision
+	ObserveOnly bool `json:"observe_only,omitempty"`
+	// SampleRate is set on clean approvals saved under sampling: each stands
+	// for 1/SampleRate approvals, most of them not saved
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// Retry is the retry guidance of a SOFT_DECLINE
+	Retry string `json:"retry,omitempty"`
+}
+
+// Sampled reports whether a transaction falls within a sample rate. The
+// choice is derived from the transaction ID, so retries of a transaction are
+// saved or skipped alike.
+func Sampled(transactionID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(transactionID))
+	return float64(h.Sum64()%10000) < rate*10000
+}
+
+// Store persists audit records
+type Store interface {
+	Save(record Record) error
+	// Since returns records decided at or after the given time, oldest first
+	Since(t time.Time) ([]Record, error)
+	// Search returns the records matching a query, newest first
+	Search(q Query) ([]Record, error)
+}
+
+// MemoryStore is a bounded in-memory Store that keeps the most recent
+// records. Records are indexed by transaction, account, IP, device, merchant
+// and reason code for search.
+type MemoryStore struct {
+	records []Record
+	next    int
+	full    bool
+	// saved counts every record ever saved; record n lives at slot
+	// n % capacity and index postings list record numbers in ascending order
+	saved uint64
+	index map[string][]uint64
+	mu    sync.RWMutex
+}
+
+// NewMemoryStore creates a store holding up to capacity records
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = 100000
+	}
+	return &MemoryStore{
+		records: make([]Record, capacity),
+		index:   make(map[string][]uint64),
+	}
+}
+
+// Save appends a record, evicting the oldest one when full
+func (m *MemoryStore) Save(record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.save(record)
+	return nil
+}
+
+// SaveBatch appends records under one lock, evicting the oldest ones when
+// full
+func (m *MemoryStore) SaveBatch(records []Record) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range records {
+		m.save(record)
+	}
+	return len(records), nil
+}
+
+// save appends a record. Callers must hold the lock.
+func (m *MemoryStore) save(record Record) {
+	if m.full {
+		m.unindex(m.records[m.next], m.saved-uint64(len(m.records)))
+	}
+	m.records[m.next] = record
+	for _, key := range recordKeys(record) {
+		m.index[key] = append(m.index[key], m.saved)
+	}
+	m.saved++
+	m.next = (m.next + 1) % len(m.records)
+	if m.next == 0 {
+		m.full = true
+	}
+}
+
+// Since returns records decided at or after t, oldest first
+func (m *MemoryStore) Since(t time.Time) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []Record{}
+	m.each(func(r Record) {
+		if !r.DecidedAt.Before(t) {
+			result = append(result, r)
+		}
+	})
+	return result, nil
+}
+
+// Search returns the records matching a query, newest first. The most
+// selective indexed field narrows the candidates; without one every record
+// is scanned.
+func (m *MemoryStore) Search(q Query) ([]Record, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []Record{}
+	collect := func(r Record) bool {
+		if q.Matches(r) {
+			result = append(result, r)
+		}
+		return len(result) < limit
+	}
+
+	candidates, indexed := m.candidates(q)
+	if !indexed {
+		m.eachNewest(collect)
+		return result, nil
+	}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if !collect(m.records[candidates[i]%uint64(len(m.records))]) {
+			break
+		}
+	}
+	return result, nil
+}
+
+// candidates returns the record numbers of the smallest posting list that
+// covers the query, ascending. Callers must hold the lock.
+func (m *MemoryStore) candidates(q Query) ([]uint64, bool) {
+	var best []uint64
+	found := false
+	consider := func(postings []uint64) {
+		if !found || len(postings) < len(best) {
+			best = postings
+			found = true
+		}
+	}
+
+	for _, key := range q.keys() {
+		consider(m.index[key])
+	}
+	for _, term := range q.Terms {
+		// A bare term may match any field, so its candidates are the union
+		var union []uint64
+		for _, field := range indexedFields {
+			union = mergePostings(union, m.index[indexKey(field, term)])
+		}
+		consider(union)
+	}
+	return best, found
+}
+
+// mergePostings merges two ascending posting lists without duplicates
+func mergePostings(a, b []uint64) []uint64 {
+	merged := make([]uint64, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			merged = append(merged, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			merged = append(merged, b[j])
+			j++
+		default:
+			merged = append(merged, a[i])
+			i++
+			j++
+		}
+	}
+	return merged
+}
+
+// unindex drops an evicted record from the index. Being the oldest record,
+// it is at the front of its postings. Callers must hold the lock.
+func (m *MemoryStore) unindex(r Record, seq uint64) {
+	for _, key := range recordKeys(r) {
+		postings := m.index[key]
+		if len(postings) > 0 && postings[0] == seq {
+			postings = postings[1:]
+		}
+		if len(postings) == 0 {
+			delete(m.index, key)
+		} else {
+			m.index[key] = postings
+		}
+	}
+}
+
+// Len returns the number of stored records
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.full {
+		return len(m.records)
+	}
+	return m.next
+}
+
+// each visits records oldest first. Callers must hold the lock.
+func (m *MemoryStore) each(fn func(Record)) {
+	if m.full {
+		for _, r := range m.records[m.next:] {
+			fn(r)
+		}
+	}
+	for _, r := range m.records[:m.next] {
+		fn(r)
+	}
+}
+
+// eachNewest visits records newest first until fn returns false. Callers
+// must hold the lock.
+func (m *MemoryStore) eachNewest(fn func(Record) bool) {
+	for i := m.next - 1; i >= 0; i-- {
+		if !fn(m.records[i]) {
+			return
+		}
+	}
+	if m.full {
+		for i := len(m.records) - 1; i >= m.next; i-- {
+			if !fn(m.records[i]) {
+				return
+			}
+		}
+	}
+}
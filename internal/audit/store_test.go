@@ -0,0 +1,83 @@
+package audit_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Since(t *testing.T) {
+	store := audit.NewMemoryStore(10)
+	base := time.Now()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Save(audit.Record{
+			Transaction: detector.Transaction{ID: string(rune('A' + i))},
+			DecidedAt:   base.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	records, err := store.Since(base.Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "C", records[0].Transaction.ID)
+	assert.Equal(t, "E", records[2].Transaction.ID)
+}
+
+func TestMemoryStore_EvictsOldest(t *testing.T) {
+	store := audit.NewMemoryStore(3)
+	base := time.Now()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Save(audit.Record{
+			Transaction: detector.Transaction{ID: string(rune('A' + i))},
+			DecidedAt:   base.Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	assert.Equal(t, 3, store.Len())
+	records, err := store.Since(time.Time{})
+	require.NoError(t, err)
+	ids := []string{}
+	for _, r := range records {
+		ids = append(ids, r.Transaction.ID)
+	}
+	assert.Equal(t, []string{"C", "D", "E"}, ids)
+}
+
+func TestSampled(t *testing.T) {
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("TX%d", i)
+		if audit.Sampled(id, 0.1) {
+			sampled++
+			assert.True(t, audit.Sampled(id, 0.5), "a higher rate keeps every transaction a lower one does")
+		}
+		assert.Equal(t, audit.Sampled(id, 0.1), audit.Sampled(id, 0.1), "the choice is stable")
+	}
+	assert.InDelta(t, 1000, sampled, 150)
+
+	assert.True(t, audit.Sampled("TX1", 1))
+	assert.False(t, audit.Sampled("TX1", 0))
+}
+
+func TestSummarize_WeighsSampledApprovals(t *testing.T) {
+	summary := audit.Summarize([]audit.Record{
+		{Decision: "APPROVE", RiskScore: 0.1, SampleRate: 0.25},
+		{Decision: "APPROVE", RiskScore: 0.1},
+		{Decision: "DECLINE", RiskScore: 0.9, ReasonCodes: []string{"HIGH_AMOUNT", "HIGH_VELOCITY"}},
+	})
+
+	assert.Equal(t, 6, summary.Total)
+	assert.Equal(t, map[string]int{"APPROVE": 5, "DECLINE": 1}, summary.Decisions)
+	assert.Equal(t, 1, summary.ReasonCodes["HIGH_AMOUNT"])
+	assert.InDelta(t, (5*0.1+0.9)/6, summary.AvgRiskScore, 1e-9)
+	assert.True(t, summary.Estimated)
+
+	assert.False(t, audit.Summarize(nil).Estimated)
+}
@@ -0,0 +1,47 @@
+package audit
+
+import "math"
+
+// Summary aggregates audited decisions. Approvals saved under sampling count
+// for 1/SampleRate decisions each, so the figures are estimates when
+// Estimated is set.
+type Summary struct {
+	Total        int            `json:"total"`
+	Decisions    map[string]int `json:"decisions"`
+	ReasonCodes  map[string]int `json:"reason_codes"`
+	AvgRiskScore float64        `json:"avg_risk_score"`
+	Estimated    bool           `json:"estimated,omitempty"`
+}
+
+// Summarize aggregates records
+func Summarize(records []Record) Summary {
+	summary := Summary{
+		Decisions:   map[string]int{},
+		ReasonCodes: map[string]int{},
+	}
+	decisions := map[string]float64{}
+	var total, scores float64
+	for _, record := range records {
+		weight := 1.0
+		if record.SampleRate > 0 && record.SampleRate < 1 {
+			weight = 1 / record.SampleRate
+			summary.Estimated = true
+		}
+		total += weight
+		scores += weight * record.RiskScore
+		decisions[record.Decision] += weight
+		// Only clean approvals are sampled, so records with codes count once
+		for _, code := range record.ReasonCodes {
+			summary.ReasonCodes[code]++
+		}
+	}
+
+	summary.Total = int(math.Round(total))
+	for decision, count := range decisions {
+		summary.Decisions[decision] = int(math.Round(count))
+	}
+	if total > 0 {
+		summary.AvgRiskScore = scores / total
+	}
+	return summary
+}
@@ -0,0 +1,283 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Overflow policies of a writer whose queue is full
+const (
+	// OverflowDrop drops the record, so saving never waits
+	OverflowDrop = "drop"
+	// OverflowBlock waits for room in the queue, so no record is dropped
+	// but saving slows down with the sink
+	OverflowBlock = "block"
+)
+
+// Reasons records are dropped for
+const (
+	DropQueueFull = "queue_full"
+	DropSinkError = "sink_error"
+)
+
+var (
+	// ErrQueueFull is returned for records dropped because the queue is full
+	ErrQueueFull = errors.New("audit write queue is full")
+	// ErrWriterClosed is returned for records saved after Close
+	ErrWriterClosed = errors.New("audit writer is closed")
+)
+
+// Sink persists batches of records. It returns how many records of the
+// batch it saved, in order, so a failed batch is retried from the first
+// record not saved.
+type Sink interface {
+	SaveBatch(records []Record) (int, error)
+}
+
+// StoreSink saves batches to a store without batch writes, one record at a
+// time
+type StoreSink struct {
+	Store Store
+}
+
+func (s StoreSink) SaveBatch(records []Record) (int, error) {
+	for i, record := range records {
+		if err := s.Store.Save(record); err != nil {
+			return i, err
+		}
+	}
+	return len(records), nil
+}
+
+// WriterConfig holds the queueing and batching settings of a writer. A batch
+// is written once it holds BatchSize records or FlushInterval after the
+// last write; a failed batch is retried up to MaxAttempts times, backing off
+// from RetryBackoff, and then dropped.
+type WriterConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxAttempts   int
+	RetryBackoff  time.Duration
+	Overflow      string
+}
+
+// DefaultWriterConfig returns the default writer settings, dropping records
+// while the queue is full
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		QueueSize:     10000,
+		BatchSize:     500,
+		FlushInterval: 100 * time.Millisecond,
+		MaxAttempts:   3,
+		RetryBackoff:  100 * time.Millisecond,
+		Overflow:      OverflowDrop,
+	}
+}
+
+// Validate checks the sizes, intervals and overflow policy
+func (c WriterConfig) Validate() error {
+	switch {
+	case c.QueueSize < 1:
+		return fmt.Errorf("queue size %d must be at least 1", c.QueueSize)
+	case c.BatchSize < 1:
+		return fmt.Errorf("batch size %d must be at least 1", c.BatchSize)
+	case c.FlushInterval <= 0:
+		return fmt.Errorf("flush interval must be positive")
+	case c.MaxAttempts < 1:
+		return fmt.Errorf("max attempts %d must be at least 1", c.MaxAttempts)
+	case c.RetryBackoff < 0:
+		return fmt.Errorf("retry backoff must not be negative")
+	case c.Overflow != OverflowDrop && c.Overflow != OverflowBlock:
+		return fmt.Errorf("unknown overflow policy %q, use %s or %s", c.Overflow, OverflowDrop, OverflowBlock)
+	}
+	return nil
+}
+
+// WriterObserver is told of every batch written and every record dropped
+type WriterObserver interface {
+	// ObserveAuditBatch records a write attempt and the records it saved
+	ObserveAuditBatch(saved int, elapsed time.Duration, err error)
+	// ObserveAuditDropped records records dropped, for DropQueueFull or
+	// DropSinkError
+	ObserveAuditDropped(reason string, records int)
+}
+
+// Writer saves records to a sink in the background, in batches, so saving
+// does not wait for the sink
+type Writer struct {
+	sink     Sink
+	config   WriterConfig
+	queue    chan Record
+	done     chan struct{}
+	observer WriterObserver
+	closed   bool
+	mu       sync.RWMutex
+}
+
+// NewWriter starts a writer to a sink
+func NewWriter(sink Sink, config WriterConfig) (*Writer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		sink:   sink,
+		config: config,
+		queue:  make(chan Record, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// SetObserver sets the observer of batches and dropped records
+func (w *Writer) SetObserver(observer WriterObserver) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.observer = observer
+}
+
+// Save queues a record. Under OverflowDrop it returns ErrQueueFull rather
+// than wait while the queue is full.
+func (w *Writer) Save(record Record) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if w.config.Overflow == OverflowBlock {
+		w.queue <- record
+		return nil
+	}
+	select {
+	case w.queue <- record:
+		return nil
+	default:
+		if w.observer != nil {
+			w.observer.ObserveAuditDropped(DropQueueFull, 1)
+		}
+		return ErrQueueFull
+	}
+}
+
+// Pending returns the number of queued records
+func (w *Writer) Pending() int {
+	return len(w.queue)
+}
+
+// Close writes the queued records and stops
+func (w *Writer) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, w.config.BatchSize)
+	for {
+		select {
+		case record, open := <-w.queue:
+			if !open {
+				w.write(batch)
+				return
+			}
+			if batch = append(batch, record); len(batch) < w.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		w.write(batch)
+		// Sinks may keep the batch, so it is not reused
+		batch = make([]Record, 0, w.config.BatchSize)
+	}
+}
+
+// write saves a batch, retrying the records not saved with backoff and
+// dropping them after the last attempt
+func (w *Writer) write(batch []Record) {
+	w.mu.RLock()
+	observer := w.observer
+	w.mu.RUnlock()
+
+	backoff := w.config.RetryBackoff
+	for attempt := 1; len(batch) > 0; attempt++ {
+		start := time.Now()
+		saved, err := w.sink.SaveBatch(batch)
+		if observer != nil {
+			observer.ObserveAuditBatch(saved, time.Since(start), err)
+		}
+		batch = batch[saved:]
+		if err == nil {
+			return
+		}
+		if attempt == w.config.MaxAttempts {
+			if observer != nil {
+				observer.ObserveAuditDropped(DropSinkError, len(batch))
+			}
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// BufferedStore saves records through a writer to the store it reads them
+// from. Records become readable once written, within the flush interval.
+type BufferedStore struct {
+	store  Store
+	writer *Writer
+}
+
+// NewBufferedStore starts writing to a store in batches. Stores that are not
+// a Sink are written one record at a time.
+func NewBufferedStore(store Store, config WriterConfig) (*BufferedStore, error) {
+	sink, ok := store.(Sink)
+	if !ok {
+		sink = StoreSink{Store: store}
+	}
+	writer, err := NewWriter(sink, config)
+	if err != nil {
+		return nil, err
+	}
+	return &BufferedStore{store: store, writer: writer}, nil
+}
+
+// Writer returns the writer of the store
+func (b *BufferedStore) Writer() *Writer {
+	return b.writer
+}
+
+// Save queues a record for writing
+func (b *BufferedStore) Save(record Record) error {
+	return b.writer.Save(record)
+}
+
+// Since returns the written records decided at or after t, oldest first
+func (b *BufferedStore) Since(t time.Time) ([]Record, error) {
+	return b.store.Since(t)
+}
+
+// Search returns the written records matching a query, newest first
+func (b *BufferedStore) Search(q Query) ([]Record, error) {
+	return b.store.Search(q)
+}
+
+// Close writes the queued records and stops writing
+func (b *BufferedStore) Close() {
+	b.writer.Close()
+}
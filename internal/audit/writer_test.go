@@ -0,0 +1,163 @@
+package audit_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sink records the batches written to it. It fails once broken, after
+// saving the first record of the batch, and waits on gate when set,
+// telling entered.
+type sink struct {
+	batches [][]string
+	broken  bool
+	gate    chan struct{}
+	entered chan struct{}
+	mu      sync.Mutex
+}
+
+func (s *sink) SaveBatch(records []audit.Record) (int, error) {
+	if s.gate != nil {
+		s.entered <- struct{}{}
+		<-s.gate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		s.batches = append(s.batches, []string{records[0].Transaction.ID})
+		return 1, errors.New("sink is down")
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.Transaction.ID)
+	}
+	s.batches = append(s.batches, ids)
+	return len(records), nil
+}
+
+func (s *sink) written() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string{}, s.batches...)
+}
+
+type writerObserver struct {
+	batches int
+	failed  int
+	dropped map[string]int
+	mu      sync.Mutex
+}
+
+func (o *writerObserver) ObserveAuditBatch(saved int, elapsed time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.batches++
+	if err != nil {
+		o.failed++
+	}
+}
+
+func (o *writerObserver) ObserveAuditDropped(reason string, records int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.dropped == nil {
+		o.dropped = make(map[string]int)
+	}
+	o.dropped[reason] += records
+}
+
+func record(id string) audit.Record {
+	return audit.Record{Transaction: detector.Transaction{ID: id}, DecidedAt: time.Now()}
+}
+
+func writer(t *testing.T, s audit.Sink, configure func(*audit.WriterConfig)) *audit.Writer {
+	t.Helper()
+	config := audit.DefaultWriterConfig()
+	config.FlushInterval = time.Hour
+	config.RetryBackoff = 0
+	configure(&config)
+	w, err := audit.NewWriter(s, config)
+	require.NoError(t, err)
+	return w
+}
+
+func TestWriter_BatchesAndFlushesOnClose(t *testing.T) {
+	s := &sink{}
+	w := writer(t, s, func(c *audit.WriterConfig) { c.BatchSize = 3 })
+	for i := 1; i <= 7; i++ {
+		require.NoError(t, w.Save(record(fmt.Sprintf("TX-%d", i))))
+	}
+	w.Close()
+
+	assert.Equal(t, [][]string{{"TX-1", "TX-2", "TX-3"}, {"TX-4", "TX-5", "TX-6"}, {"TX-7"}}, s.written())
+	assert.ErrorIs(t, w.Save(record("TX-8")), audit.ErrWriterClosed)
+	w.Close()
+}
+
+func TestWriter_FlushesOnInterval(t *testing.T) {
+	s := &sink{}
+	w := writer(t, s, func(c *audit.WriterConfig) { c.FlushInterval = 10 * time.Millisecond })
+	defer w.Close()
+
+	require.NoError(t, w.Save(record("TX-1")))
+	assert.Eventually(t, func() bool { return len(s.written()) == 1 }, time.Second, 5*time.Millisecond,
+		"a partial batch is written after the flush interval")
+}
+
+func TestWriter_RetriesThenDropsWhenTheSinkIsDown(t *testing.T) {
+	s := &sink{broken: true}
+	observer := &writerObserver{}
+	w := writer(t, s, func(c *audit.WriterConfig) { c.MaxAttempts = 2 })
+	w.SetObserver(observer)
+	for _, id := range []string{"TX-1", "TX-2", "TX-3"} {
+		require.NoError(t, w.Save(record(id)))
+	}
+	w.Close()
+
+	assert.Equal(t, [][]string{{"TX-1"}, {"TX-2"}}, s.written(), "retries resume after the records saved")
+	assert.Equal(t, 2, observer.failed)
+	assert.Equal(t, map[string]int{audit.DropSinkError: 1}, observer.dropped)
+}
+
+func TestWriter_DropsWhileTheQueueIsFull(t *testing.T) {
+	s := &sink{gate: make(chan struct{}), entered: make(chan struct{}, 2)}
+	observer := &writerObserver{}
+	w := writer(t, s, func(c *audit.WriterConfig) { c.QueueSize, c.BatchSize = 1, 1 })
+	w.SetObserver(observer)
+
+	require.NoError(t, w.Save(record("TX-1")))
+	<-s.entered
+	require.NoError(t, w.Save(record("TX-2")))
+	assert.ErrorIs(t, w.Save(record("TX-3")), audit.ErrQueueFull)
+	assert.Equal(t, 1, w.Pending())
+	assert.Equal(t, map[string]int{audit.DropQueueFull: 1}, observer.dropped)
+
+	close(s.gate)
+	w.Close()
+	assert.Equal(t, [][]string{{"TX-1"}, {"TX-2"}}, s.written())
+}
+
+func TestBufferedStore_ReadsWrittenRecords(t *testing.T) {
+	store, err := audit.NewBufferedStore(audit.NewMemoryStore(10), audit.DefaultWriterConfig())
+	require.NoError(t, err)
+	require.NoError(t, store.Save(record("TX-1")))
+	store.Close()
+
+	records, err := store.Search(audit.Query{TransactionID: "TX-1"})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = audit.NewBufferedStore(audit.NewMemoryStore(10), audit.WriterConfig{})
+	assert.Error(t, err)
+	config := audit.DefaultWriterConfig()
+	config.Overflow = "spill"
+	assert.Error(t, config.Validate())
+}
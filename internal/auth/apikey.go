@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// APIKeyHeader carries API keys
+const APIKeyHeader = "X-API-Key"
+
+// APIKey assigns a principal to a key. Keys naming a merchant are merchant
+// keys; sandbox keys get sandbox decisions.
+type APIKey struct {
+	Key      string `json:"key"`
+	Subject  string `json:"subject"`
+	Tenant   string `json:"tenant,omitempty"`
+	Merchant string `json:"merchant,omitempty"`
+	Role     string `json:"role"`
+	Sandbox  bool   `json:"sandbox,omitempty"`
+}
+
+// APIKeys authenticates requests by their X-API-Key header. Keys are indexed
+// by hash so that lookups never compare the secrets themselves.
+type APIKeys struct {
+	principals map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeys validates and indexes API keys
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	a := &APIKeys{principals: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("api key %d: key is required", i)
+		}
+		role, err := ParseRole(key.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api key %d: %w", i, err)
+		}
+		subject := key.Subject
+		if subject == "" {
+			subject = fmt.Sprintf("api-key-%d", i)
+		}
+		a.principals[sha256.Sum256([]byte(key.Key))] = &Principal{
+			Subject:  subject,
+			Tenant:   key.Tenant,
+			Merchant: key.Merchant,
+			Role:     role,
+			Sandbox:  key.Sandbox,
+		}
+	}
+	return a, nil
+}
+
+// LoadAPIKeys reads a JSON array of API keys
+func LoadAPIKeys(r io.Reader) (*APIKeys, error) {
+	var keys []APIKey
+	if err := json.NewDecoder(r).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("invalid api keys: %w", err)
+	}
+	return NewAPIKeys(keys)
+}
+
+// LoadAPIKeysFile reads API keys from disk
+func LoadAPIKeysFile(path string) (*APIKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadAPIKeys(f)
+}
+
+// Size returns the number of keys
+func (a *APIKeys) Size() int {
+	return len(a.principals)
+}
+
+// Authenticate returns the principal of the request's API key
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	principal, exists := a.principals[sha256.Sum256([]byte(key))]
+	if !exists {
+		return nil, errors.New("invalid api key")
+	}
+	return principal, nil
+}
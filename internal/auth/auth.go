@@ -0,0 +1,234 @@
+// Package auth authenticates API callers and enforces role-based access to
+// the API.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+)
+
+// Role is an access level. Each role includes the permissions of the roles
+// below it.
+type Role string
+
+// Roles from least to most privileged
+const (
+	Viewer     Role = "viewer"
+	Analyst    Role = "analyst"
+	RuleAuthor Role = "rule-author"
+	Admin      Role = "admin"
+)
+
+var roleRanks = map[Role]int{Viewer: 1, Analyst: 2, RuleAuthor: 3, Admin: 4}
+
+// ParseRole validates a role name
+func ParseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	if _, known := roleRanks[role]; !known {
+		return "", fmt.Errorf("unknown role: %s", name)
+	}
+	return role, nil
+}
+
+// Allows reports whether the role grants the required role
+func (r Role) Allows(required Role) bool {
+	rank, known := roleRanks[r]
+	return known && rank >= roleRanks[required]
+}
+
+// Principal is an authenticated caller. Merchant principals act for one
+// merchant and only reach the merchant routes of the policy; sandbox
+// principals only reach its sandbox routes, which decide their transactions
+// predictably and without touching production state.
+type Principal struct {
+	Subject  string `json:"subject"`
+	Tenant   string `json:"tenant,omitempty"`
+	Merchant string `json:"merchant,omitempty"`
+	Role     Role   `json:"role"`
+	Sandbox  bool   `json:"sandbox,omitempty"`
+}
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// none of the credentials it handles
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator identifies the caller of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal of a request, if it was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok
+}
+
+// Policy maps routes to the role they require. Paths ending in "/" match
+// every path below them; the longest matching path wins, and a rule for the
+// request method wins over one for every method.
+type Policy struct {
+	rules    []policyRule
+	public   map[string]bool
+	merchant []string
+	sandbox  []string
+}
+
+type policyRule struct {
+	method string
+	path   string
+	role   Role
+}
+
+// NewPolicy creates a policy in which every route requires the default role
+func NewPolicy(defaultRole Role) *Policy {
+	return &Policy{
+		rules:  []policyRule{{path: "/", role: defaultRole}},
+		public: map[string]bool{},
+	}
+}
+
+// Require sets the role needed to call a route. An empty method matches
+// every method.
+func (p *Policy) Require(method, path string, role Role) *Policy {
+	p.rules = append(p.rules, policyRule{method: method, path: path, role: role})
+	sort.SliceStable(p.rules, func(i, j int) bool {
+		return len(p.rules[i].path) > len(p.rules[j].path)
+	})
+	return p
+}
+
+// Public lets anyone call a path without credentials
+func (p *Policy) Public(path string) *Policy {
+	p.public[path] = true
+	return p
+}
+
+// Merchant lets merchant principals call a path, or every path below it when
+// it ends in "/". They are refused everywhere else.
+func (p *Policy) Merchant(path string) *Policy {
+	p.merchant = append(p.merchant, path)
+	return p
+}
+
+// MerchantAllowed reports whether merchant principals may call a path
+func (p *Policy) MerchantAllowed(path string) bool {
+	for _, pattern := range p.merchant {
+		if matches(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sandbox lets sandbox principals call a path, or every path below it when
+// it ends in "/". They are refused everywhere else.
+func (p *Policy) Sandbox(path string) *Policy {
+	p.sandbox = append(p.sandbox, path)
+	return p
+}
+
+// SandboxAllowed reports whether sandbox principals may call a path
+func (p *Policy) SandboxAllowed(path string) bool {
+	for _, pattern := range p.sandbox {
+		if matches(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleFor returns the role needed to call a route
+func (p *Policy) RoleFor(method, path string) Role {
+	for _, rule := range p.rules {
+		if !matches(rule.path, path) {
+			continue
+		}
+		if rule.method == method {
+			return rule.role
+		}
+		if rule.method == "" && !p.hasMethodRule(rule.path, method) {
+			return rule.role
+		}
+	}
+	return Admin
+}
+
+func (p *Policy) hasMethodRule(path, method string) bool {
+	for _, rule := range p.rules {
+		if rule.path == path && rule.method == method {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return pattern == path
+}
+
+// Middleware authenticates each request with the first authenticator that
+// finds credentials and checks the principal's role against the policy.
+// Requests without valid credentials get a 401, those with too weak a role,
+// and merchant and sandbox principals outside their routes, a 403.
+func Middleware(policy *Policy, authenticators []Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if policy.public[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := Authenticate(authenticators, r)
+		if err != nil {
+			apierror.Write(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if principal.Merchant != "" && !policy.MerchantAllowed(r.URL.Path) {
+			apierror.Write(w, "Forbidden: merchant credentials only reach the merchant API", http.StatusForbidden)
+			return
+		}
+		if principal.Sandbox && !policy.SandboxAllowed(r.URL.Path) {
+			apierror.Write(w, "Forbidden: sandbox credentials only reach the sandbox API", http.StatusForbidden)
+			return
+		}
+		required := policy.RoleFor(r.Method, r.URL.Path)
+		if !principal.Role.Allows(required) {
+			apierror.Write(w, fmt.Sprintf("Forbidden: requires role %s", required), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Authenticate identifies the caller with the first authenticator that finds
+// credentials in the request
+func Authenticate(authenticators []Authenticator, r *http.Request) (*Principal, error) {
+	for _, authenticator := range authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return principal, nil
+	}
+	return nil, ErrNoCredentials
+}
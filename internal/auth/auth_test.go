@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, auth.Admin.Allows(auth.RuleAuthor))
+	assert.True(t, auth.Analyst.Allows(auth.Analyst))
+	assert.False(t, auth.Viewer.Allows(auth.Analyst))
+	assert.False(t, auth.Role("owner").Allows(auth.Viewer))
+
+	role, err := auth.ParseRole(" Rule-Author ")
+	require.NoError(t, err)
+	assert.Equal(t, auth.RuleAuthor, role)
+	_, err = auth.ParseRole("root")
+	assert.Error(t, err)
+}
+
+func TestPolicy_RoleFor(t *testing.T) {
+	policy := auth.NewPolicy(auth.Viewer).
+		Require("", "/admin/", auth.Admin).
+		Require(http.MethodPost, "/rules", auth.RuleAuthor).
+		Require(http.MethodGet, "/admin/report", auth.Analyst)
+
+	assert.Equal(t, auth.Viewer, policy.RoleFor(http.MethodGet, "/rules"))
+	assert.Equal(t, auth.RuleAuthor, policy.RoleFor(http.MethodPost, "/rules"))
+	assert.Equal(t, auth.Admin, policy.RoleFor(http.MethodPost, "/admin/users"))
+	assert.Equal(t, auth.Analyst, policy.RoleFor(http.MethodGet, "/admin/report"))
+	assert.Equal(t, auth.Admin, policy.RoleFor(http.MethodPost, "/admin/report"))
+}
+
+func TestMiddleware(t *testing.T) {
+	keys, err := auth.LoadAPIKeys(strings.NewReader(`[
+		{"key": "contractor-key", "subject": "contractor", "role": "viewer"},
+		{"key": "author-key", "subject": "author", "tenant": "acme", "role": "rule-author"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, keys.Size())
+
+	policy := auth.NewPolicy(auth.Viewer).
+		Public("/health").
+		Require(http.MethodPost, "/fraud/configs", auth.RuleAuthor)
+
+	var seen *auth.Principal
+	handler := auth.Middleware(policy, []auth.Authenticator{keys}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.FromContext(r.Context())
+	}))
+
+	call := func(method, path, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/health", ""))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/fraud/configs", ""))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/fraud/configs", "stolen-key"))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/fraud/configs", "contractor-key"))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/fraud/configs", "contractor-key"))
+
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/fraud/configs", "author-key"))
+	require.NotNil(t, seen)
+	assert.Equal(t, "author", seen.Subject)
+	assert.Equal(t, "acme", seen.Tenant)
+}
+
+func TestMiddleware_MerchantKeys(t *testing.T) {
+	keys, err := auth.LoadAPIKeys(strings.NewReader(`[
+		{"key": "shop-key", "subject": "shop", "tenant": "acme", "merchant": "acme-shop", "role": "analyst"}
+	]`))
+	require.NoError(t, err)
+
+	policy := auth.NewPolicy(auth.Viewer).Merchant("/fraud/merchant/")
+	var seen *auth.Principal
+	handler := auth.Middleware(policy, []auth.Authenticator{keys}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.FromContext(r.Context())
+	}))
+
+	call := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(auth.APIKeyHeader, "shop-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("/fraud/merchant/decisions"))
+	require.NotNil(t, seen)
+	assert.Equal(t, "acme-shop", seen.Merchant)
+	assert.Equal(t, http.StatusForbidden, call("/fraud/search"), "outside the merchant API")
+	assert.Equal(t, http.StatusForbidden, call("/fraud/merchant"))
+}
+
+func TestMiddleware_SandboxKeys(t *testing.T) {
+	keys, err := auth.LoadAPIKeys(strings.NewReader(`[
+		{"key": "test-key", "subject": "integrator", "role": "viewer", "sandbox": true}
+	]`))
+	require.NoError(t, err)
+
+	policy := auth.NewPolicy(auth.Viewer).Sandbox("/fraud/analyze")
+	var seen *auth.Principal
+	handler := auth.Middleware(policy, []auth.Authenticator{keys}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.FromContext(r.Context())
+	}))
+
+	call := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(auth.APIKeyHeader, "test-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("/fraud/analyze"))
+	require.NotNil(t, seen)
+	assert.True(t, seen.Sandbox)
+	assert.Equal(t, http.StatusForbidden, call("/fraud/feedback"), "outside the sandbox API")
+}
+
+func TestLoadAPIKeys_Invalid(t *testing.T) {
+	_, err := auth.LoadAPIKeys(strings.NewReader(`[{"key": "k", "role": "superuser"}]`))
+	assert.Error(t, err)
+	_, err = auth.LoadAPIKeys(strings.NewReader(`[{"role": "admin"}]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTConfig describes the identity provider whose tokens are accepted
+type JWTConfig struct {
+	Issuer   string
+	Audience string
+	JWKSURL  string
+	// RoleClaim, TenantClaim and MerchantClaim name the claims holding the
+	// role, tenant and merchant. Dots address nested claims, e.g.
+	// "realm_access.roles".
+	RoleClaim     string
+	TenantClaim   string
+	MerchantClaim string
+	// Leeway allows for clock skew when checking exp and nbf
+	Leeway time.Duration
+	// RefreshInterval bounds how often the JWKS is fetched again for an
+	// unknown key ID
+	RefreshInterval time.Duration
+}
+
+// DefaultJWTConfig returns the default claim names and timings
+func DefaultJWTConfig() JWTConfig {
+	return JWTConfig{
+		RoleClaim:       "role",
+		TenantClaim:     "tenant",
+		MerchantClaim:   "merchant",
+		Leeway:          time.Minute,
+		RefreshInterval: 5 * time.Minute,
+	}
+}
+
+func (c JWTConfig) withDefaults() JWTConfig {
+	defaults := DefaultJWTConfig()
+	if c.RoleClaim == "" {
+		c.RoleClaim = defaults.RoleClaim
+	}
+	if c.TenantClaim == "" {
+		c.TenantClaim = defaults.TenantClaim
+	}
+	if c.MerchantClaim == "" {
+		c.MerchantClaim = defaults.MerchantClaim
+	}
+	if c.Leeway <= 0 {
+		c.Leeway = defaults.Leeway
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = defaults.RefreshInterval
+	}
+	return c
+}
+
+// JWTAuthenticator authenticates requests by a bearer JWT signed with RS256
+// or ES256 by a key from the provider's JWKS
+type JWTAuthenticator struct {
+	config JWTConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewJWTAuthenticator validates the configuration and fetches the JWKS
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if config.Issuer == "" || config.Audience == "" || config.JWKSURL == "" {
+		return nil, errors.New("issuer, audience and JWKS URL are required")
+	}
+
+	a := &JWTAuthenticator{
+		config: config.withDefaults(),
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   map[string]crypto.PublicKey{},
+	}
+	if err := a.refresh(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authenticate verifies the bearer token of the request and maps its claims
+// to a principal
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	role, err := roleFromClaim(lookupClaim(claims, a.config.RoleClaim))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	subject, _ := claims["sub"].(string)
+	tenant, _ := lookupClaim(claims, a.config.TenantClaim).(string)
+	merchant, _ := lookupClaim(claims, a.config.MerchantClaim).(string)
+
+	return &Principal{Subject: subject, Tenant: tenant, Merchant: merchant, Role: role}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (a *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match algorithm RS256")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature); err != nil {
+			return errors.New("signature verification failed")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("key does not match algorithm ES256")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("signature verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	return nil
+}
+
+func (a *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !hasAudience(claims["aud"], a.config.Audience) {
+		return errors.New("token is not issued for this audience")
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.config.Leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+func hasAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupClaim resolves a dotted claim path
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// roleFromClaim accepts a single role or a list, taking the most privileged
+// known role from a list
+func roleFromClaim(claim interface{}) (Role, error) {
+	switch value := claim.(type) {
+	case string:
+		return ParseRole(value)
+	case []interface{}:
+		var best Role
+		for _, item := range value {
+			name, _ := item.(string)
+			if role, err := ParseRole(name); err == nil && !best.Allows(role) {
+				best = role
+			}
+		}
+		if best != "" {
+			return best, nil
+		}
+	}
+	return "", errors.New("token carries no known role")
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// key returns the verification key for a key ID, fetching the JWKS again
+// when the ID is unknown, e.g. after the provider rotated its keys
+func (a *JWTAuthenticator) key(kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	key, exists := a.keys[kid]
+	stale := time.Since(a.lastRefresh) >= a.config.RefreshInterval
+	a.mu.Unlock()
+
+	if exists {
+		return key, nil
+	}
+	if stale {
+		if err := a.refresh(); err != nil {
+			return nil, err
+		}
+		a.mu.Lock()
+		key, exists = a.keys[kid]
+		a.mu.Unlock()
+		if exists {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+type jwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	} `json:"keys"`
+}
+
+func (a *JWTAuthenticator) refresh() error {
+	resp, err := a.client.Get(a.config.JWKSURL)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: status %d", resp.StatusCode)
+	}
+
+	var set jwks
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				return fmt.Errorf("invalid JWKS: malformed RSA key %q", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				return fmt.Errorf("invalid JWKS: malformed EC key %q", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = keys
+	a.lastRefresh = time.Now()
+	return nil
+}
@@ -0,0 +1,128 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type provider struct {
+	key    *rsa.PrivateKey
+	server *httptest.Server
+}
+
+func newProvider(t *testing.T) *provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &provider{key: key}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *provider) token(t *testing.T, kid string, claims map[string]interface{}) string {
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	p := newProvider(t)
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+		Issuer:    "https://idp.example.com",
+		Audience:  "fraud-engine",
+		JWKSURL:   p.server.URL,
+		RoleClaim: "realm_access.roles",
+	})
+	require.NoError(t, err)
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":          "https://idp.example.com",
+			"aud":          []string{"other", "fraud-engine"},
+			"sub":          "analyst@example.com",
+			"tenant":       "acme",
+			"exp":          time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": []string{"offline_access", "viewer", "analyst"}},
+		}
+	}
+	authenticate := func(token string) (*auth.Principal, error) {
+		req := httptest.NewRequest(http.MethodGet, "/fraud/stats", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return authenticator.Authenticate(req)
+	}
+
+	principal, err := authenticate(p.token(t, "key-1", valid()))
+	require.NoError(t, err)
+	assert.Equal(t, "analyst@example.com", principal.Subject)
+	assert.Equal(t, "acme", principal.Tenant)
+	assert.Equal(t, auth.Analyst, principal.Role)
+
+	_, err = authenticate("")
+	assert.ErrorIs(t, err, auth.ErrNoCredentials)
+
+	tests := map[string]func(map[string]interface{}){
+		"expired":        func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"wrong issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"no role":        func(c map[string]interface{}) { delete(c, "realm_access") },
+		"not yet valid":  func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := valid()
+			mutate(claims)
+			_, err := authenticate(p.token(t, "key-1", claims))
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, auth.ErrNoCredentials)
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		token := p.token(t, "key-1", valid())
+		_, err := authenticate(token[:len(token)-4] + "AAAA")
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := authenticate(p.token(t, "key-2", valid()))
+		assert.Error(t, err)
+	})
+}
+
+func TestNewJWTAuthenticator_RequiresProvider(t *testing.T) {
+	_, err := auth.NewJWTAuthenticator(auth.JWTConfig{Issuer: "https://idp.example.com"})
+	assert.Error(t, err)
+}
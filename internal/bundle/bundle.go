@@ -0,0 +1,134 @@
+// Package bundle packages the scoring configuration of an environment, its
+// rules, decision thresholds, lists and model version, into a signed
+// artifact that can be promoted to another environment.
+package bundle
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+// FormatVersion is the bundle format version
+const FormatVersion = 1
+
+// ErrBadSignature is returned for bundles not signed with the expected key
+var ErrBadSignature = errors.New("bundle signature does not match")
+
+// Bundle is an environment's scoring configuration
+type Bundle struct {
+	FormatVersion int                 `json:"format_version"`
+	ID            string              `json:"id"`
+	Source        string              `json:"source,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	Rules         ruleset.File        `json:"rules"`
+	Thresholds    Thresholds          `json:"thresholds"`
+	Lists         map[string][]string `json:"lists"`
+	// ModelVersion is the version of the active model the configuration was
+	// tuned against. Models are promoted separately; importing a bundle
+	// requires the target to already run this version.
+	ModelVersion string `json:"model_version"`
+}
+
+// Thresholds are the decision policy thresholds
+type Thresholds struct {
+	Review  float64 `json:"review"`
+	Decline float64 `json:"decline"`
+}
+
+// Signed is a bundle and its HMAC-SHA256 signature, hex encoded
+type Signed struct {
+	Bundle    Bundle `json:"bundle"`
+	Signature string `json:"signature"`
+}
+
+// Validate checks the bundle for consistency
+func (b Bundle) Validate() error {
+	if b.FormatVersion != FormatVersion {
+		return fmt.Errorf("unsupported bundle format version %d, want %d", b.FormatVersion, FormatVersion)
+	}
+	if b.ID == "" {
+		return errors.New("bundle id is required")
+	}
+	if err := b.Rules.Validate(); err != nil {
+		return err
+	}
+	if b.Thresholds.Review <= 0 || b.Thresholds.Decline <= 0 {
+		return errors.New("review and decline thresholds must be positive")
+	}
+	if b.Thresholds.Review > b.Thresholds.Decline {
+		return fmt.Errorf("review threshold %.2f exceeds decline threshold %.2f", b.Thresholds.Review, b.Thresholds.Decline)
+	}
+	return nil
+}
+
+// Seal sets the bundle's format version and derives its ID from its
+// configuration, so the same configuration exported from any environment at
+// any time has the same ID
+func (b Bundle) Seal() (Bundle, error) {
+	b.FormatVersion = FormatVersion
+	content := b
+	content.ID, content.Source, content.CreatedAt = "", "", time.Time{}
+	payload, err := json.Marshal(content)
+	if err != nil {
+		return b, err
+	}
+	digest := sha256.Sum256(payload)
+	b.ID = hex.EncodeToString(digest[:6])
+	return b, nil
+}
+
+// Sign seals and signs a bundle
+func Sign(b Bundle, key []byte) (Signed, error) {
+	b, err := b.Seal()
+	if err != nil {
+		return Signed{}, err
+	}
+	signature, err := signature(b, key)
+	if err != nil {
+		return Signed{}, err
+	}
+	return Signed{Bundle: b, Signature: signature}, nil
+}
+
+// Verify checks a signed bundle's signature and content
+func Verify(s Signed, key []byte) (Bundle, error) {
+	expected, err := signature(s.Bundle, key)
+	if err != nil {
+		return Bundle{}, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(s.Signature)) {
+		return Bundle{}, ErrBadSignature
+	}
+	return s.Bundle, s.Bundle.Validate()
+}
+
+// signature signs the bundle's JSON encoding, which is deterministic: struct
+// fields keep their order and map keys are sorted
+func signature(b Bundle, key []byte) (string, error) {
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Read decodes a signed bundle
+func Read(r io.Reader) (Signed, error) {
+	var s Signed
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("invalid bundle: %w", err)
+	}
+	return s, nil
+}
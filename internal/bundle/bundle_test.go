@@ -0,0 +1,153 @@
+package bundle_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/bundle"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+var key = []byte("promotion-key")
+
+func testBundle() bundle.Bundle {
+	return bundle.Bundle{
+		Source:    "staging",
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Rules: ruleset.File{Version: ruleset.Version, Rules: []ruleset.Spec{
+			{ID: "HIGH_AMOUNT", Builtin: true, Score: 0.3},
+			{ID: "BIG", Expression: "tx.amount > 9000", Score: 0.2, Action: "REVIEW"},
+		}},
+		Thresholds:   bundle.Thresholds{Review: 0.5, Decline: 0.8},
+		Lists:        map[string][]string{"bad_ips": {"203.0.113.7"}},
+		ModelVersion: "v1.0.0",
+	}
+}
+
+func TestSignVerify_RoundTrip(t *testing.T) {
+	signed, err := bundle.Sign(testBundle(), key)
+	require.NoError(t, err)
+	assert.Equal(t, bundle.FormatVersion, signed.Bundle.FormatVersion)
+	assert.Len(t, signed.Bundle.ID, 12)
+
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(signed))
+	read, err := bundle.Read(&buf)
+	require.NoError(t, err)
+
+	b, err := bundle.Verify(read, key)
+	require.NoError(t, err)
+	assert.Equal(t, signed.Bundle, b)
+}
+
+func TestVerify_RejectsTamperingAndWrongKey(t *testing.T) {
+	signed, err := bundle.Sign(testBundle(), key)
+	require.NoError(t, err)
+
+	_, err = bundle.Verify(signed, []byte("other-key"))
+	assert.ErrorIs(t, err, bundle.ErrBadSignature)
+
+	tampered := signed
+	tampered.Bundle.Thresholds.Decline = 0.99
+	_, err = bundle.Verify(tampered, key)
+	assert.ErrorIs(t, err, bundle.ErrBadSignature)
+
+	tampered = signed
+	tampered.Bundle.Lists = map[string][]string{}
+	_, err = bundle.Verify(tampered, key)
+	assert.ErrorIs(t, err, bundle.ErrBadSignature)
+}
+
+func TestVerify_ValidatesContent(t *testing.T) {
+	b := testBundle()
+	b.Thresholds = bundle.Thresholds{Review: 0.9, Decline: 0.8}
+	signed, err := bundle.Sign(b, key)
+	require.NoError(t, err)
+
+	_, err = bundle.Verify(signed, key)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds decline threshold")
+}
+
+func TestSeal_IDDependsOnConfigurationOnly(t *testing.T) {
+	a, err := testBundle().Seal()
+	require.NoError(t, err)
+
+	other := testBundle()
+	other.Source = "production"
+	other.CreatedAt = other.CreatedAt.Add(time.Hour)
+	b, err := other.Seal()
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, b.ID)
+
+	other.Thresholds.Review = 0.6
+	c, err := other.Seal()
+	require.NoError(t, err)
+	assert.NotEqual(t, a.ID, c.ID)
+}
+
+func TestHistory_Rollback(t *testing.T) {
+	h := bundle.NewHistory(3)
+	assert.True(t, h.Empty())
+	_, err := h.Previous()
+	assert.ErrorIs(t, err, bundle.ErrNoPrevious)
+
+	now := time.Now()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		h.Push(bundle.Bundle{ID: id}, now)
+	}
+
+	list := h.List()
+	require.Len(t, list, 3)
+	assert.Equal(t, "d", list[0].Bundle.ID)
+	assert.Equal(t, "b", list[2].Bundle.ID)
+
+	previous, err := h.Previous()
+	require.NoError(t, err)
+	assert.Equal(t, "c", previous.ID)
+
+	h.Pop()
+	previous, err = h.Previous()
+	require.NoError(t, err)
+	assert.Equal(t, "b", previous.ID)
+
+	h.Pop()
+	_, err = h.Previous()
+	assert.ErrorIs(t, err, bundle.ErrNoPrevious)
+}
+
+func TestTimeline_At(t *testing.T) {
+	tl := bundle.NewTimeline(3)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	observe := true
+
+	tl.Record(bundle.Bundle{ID: "a"}, config.Hierarchy{}, base)
+	tl.Record(bundle.Bundle{ID: "a"}, config.Hierarchy{}, base.Add(time.Hour))
+	tl.Record(bundle.Bundle{ID: "a"}, config.Hierarchy{Global: config.Layer{ObserveOnly: &observe}}, base.Add(2*time.Hour))
+	tl.Record(bundle.Bundle{ID: "b"}, config.Hierarchy{}, base.Add(3*time.Hour))
+
+	_, exists := tl.At(base.Add(-time.Minute))
+	assert.False(t, exists, "before the first version")
+
+	version, exists := tl.At(base.Add(90 * time.Minute))
+	require.True(t, exists)
+	assert.Equal(t, "a", version.Bundle.ID)
+	assert.Equal(t, base, version.From, "recording the same configuration again is not a new version")
+
+	version, _ = tl.At(base.Add(2 * time.Hour))
+	assert.True(t, *version.Layers.Global.ObserveOnly, "a layer change is a new version")
+
+	version, _ = tl.At(base.Add(48 * time.Hour))
+	assert.Equal(t, "b", version.Bundle.ID)
+
+	tl.Record(bundle.Bundle{ID: "c"}, config.Hierarchy{}, base.Add(4*time.Hour))
+	tl.Record(bundle.Bundle{ID: "d"}, config.Hierarchy{}, base.Add(5*time.Hour))
+	_, exists = tl.At(base.Add(2*time.Hour + time.Minute))
+	assert.False(t, exists, "the oldest versions are dropped")
+}
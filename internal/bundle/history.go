@@ -0,0 +1,83 @@
+package bundle
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoPrevious is returned when rolling back without a previous bundle
+var ErrNoPrevious = errors.New("no previous bundle to roll back to")
+
+// Applied is a bundle and when it was applied
+type Applied struct {
+	Bundle    Bundle    `json:"bundle"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// History keeps the bundles applied to an environment, most recent last, so
+// an import can be rolled back
+type History struct {
+	applied []Applied
+	max     int
+	mu      sync.Mutex
+}
+
+// NewHistory creates a history holding up to max bundles
+func NewHistory(max int) *History {
+	if max < 2 {
+		max = 2
+	}
+	return &History{max: max}
+}
+
+// Push records an applied bundle, dropping the oldest when full
+func (h *History) Push(b Bundle, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.applied = append(h.applied, Applied{Bundle: b, AppliedAt: at})
+	if len(h.applied) > h.max {
+		h.applied = h.applied[len(h.applied)-h.max:]
+	}
+}
+
+// Empty reports whether no bundle has been recorded
+func (h *History) Empty() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.applied) == 0
+}
+
+// Previous returns the bundle applied before the current one
+func (h *History) Previous() (Bundle, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.applied) < 2 {
+		return Bundle{}, ErrNoPrevious
+	}
+	return h.applied[len(h.applied)-2].Bundle, nil
+}
+
+// Pop drops the current bundle after a rollback to the previous one
+func (h *History) Pop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.applied) > 0 {
+		h.applied = h.applied[:len(h.applied)-1]
+	}
+}
+
+// List returns the applied bundles, most recent first
+func (h *History) List() []Applied {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := make([]Applied, len(h.applied))
+	for i, applied := range h.applied {
+		list[len(list)-1-i] = applied
+	}
+	return list
+}
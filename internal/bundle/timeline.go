@@ -0,0 +1,66 @@
+package bundle
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+)
+
+// Version is a scoring configuration, with the configuration layers, and
+// when it took effect
+type Version struct {
+	Bundle Bundle           `json:"bundle"`
+	Layers config.Hierarchy `json:"layers"`
+	From   time.Time        `json:"from"`
+}
+
+// Timeline keeps every configuration an environment has run, oldest first,
+// so a past decision can be re-scored with the configuration of its time.
+// Unlike History it is never rolled back: a rollback is a new version.
+type Timeline struct {
+	versions []Version
+	max      int
+	mu       sync.Mutex
+}
+
+// NewTimeline creates a timeline holding up to max versions
+func NewTimeline(max int) *Timeline {
+	if max < 1 {
+		max = 1
+	}
+	return &Timeline{max: max}
+}
+
+// Record adds the configuration that took effect at a time, unless it is the
+// one already in effect. The oldest version is dropped when full.
+func (t *Timeline) Record(b Bundle, layers config.Hierarchy, from time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n := len(t.versions); n > 0 {
+		last := t.versions[n-1]
+		if last.Bundle.ID == b.ID && reflect.DeepEqual(last.Layers, layers) {
+			return
+		}
+	}
+	t.versions = append(t.versions, Version{Bundle: b, Layers: layers, From: from})
+	if len(t.versions) > t.max {
+		t.versions = t.versions[len(t.versions)-t.max:]
+	}
+}
+
+// At returns the version in effect at a time, or false when the time is
+// before the oldest version kept
+func (t *Timeline) At(at time.Time) (Version, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.versions) - 1; i >= 0; i-- {
+		if !t.versions[i].From.After(at) {
+			return t.versions[i], true
+		}
+	}
+	return Version{}, false
+}
@@ -0,0 +1,141 @@
+// Package chaos injects faults into the engine's dependencies so that failure
+// handling can be exercised end to end. It is meant for development only.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+)
+
+// ErrInjected is wrapped by every injected failure
+var ErrInjected = errors.New("injected fault")
+
+// Faults are the failures to inject
+type Faults struct {
+	// MLLatency is added to every ML prediction
+	MLLatency time.Duration
+	// MLErrorRate is the share of ML predictions that fail
+	MLErrorRate float64
+	// StorageErrorRate is the share of audit store operations that fail
+	StorageErrorRate float64
+}
+
+// Validate checks that rates are between 0 and 1 and latency is not negative
+func (f Faults) Validate() error {
+	if f.MLLatency < 0 {
+		return errors.New("ML latency must not be negative")
+	}
+	if f.MLErrorRate < 0 || f.MLErrorRate > 1 {
+		return errors.New("ML error rate must be between 0 and 1")
+	}
+	if f.StorageErrorRate < 0 || f.StorageErrorRate > 1 {
+		return errors.New("storage error rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// Injector holds the faults currently injected. The zero value injects
+// nothing.
+type Injector struct {
+	faults Faults
+	mu     sync.RWMutex
+}
+
+// NewInjector creates an injector with no faults
+func NewInjector() *Injector {
+	return &Injector{}
+}
+
+// Set replaces the injected faults
+func (i *Injector) Set(faults Faults) error {
+	if err := faults.Validate(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.faults = faults
+	return nil
+}
+
+// Clear stops injecting faults
+func (i *Injector) Clear() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.faults = Faults{}
+}
+
+// Faults returns the injected faults
+func (i *Injector) Faults() Faults {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.faults
+}
+
+// MLFault delays an ML prediction by the injected latency and fails it at the
+// injected error rate
+func (i *Injector) MLFault() error {
+	faults := i.Faults()
+	if faults.MLLatency > 0 {
+		time.Sleep(faults.MLLatency)
+	}
+	if hit(faults.MLErrorRate) {
+		return fmt.Errorf("ML prediction: %w", ErrInjected)
+	}
+	return nil
+}
+
+// StorageFault fails a storage operation at the injected error rate
+func (i *Injector) StorageFault() error {
+	if hit(i.Faults().StorageErrorRate) {
+		return fmt.Errorf("audit store: %w", ErrInjected)
+	}
+	return nil
+}
+
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// Store is an audit store whose operations fail at the injected storage
+// error rate
+type Store struct {
+	store    audit.Store
+	injector *Injector
+}
+
+// WrapStore injects storage faults into an audit store
+func WrapStore(store audit.Store, injector *Injector) *Store {
+	return &Store{store: store, injector: injector}
+}
+
+// Save saves a record unless a fault is injected
+func (s *Store) Save(record audit.Record) error {
+	if err := s.injector.StorageFault(); err != nil {
+		return err
+	}
+	return s.store.Save(record)
+}
+
+// Since returns records decided at or after t unless a fault is injected
+func (s *Store) Since(t time.Time) ([]audit.Record, error) {
+	if err := s.injector.StorageFault(); err != nil {
+		return nil, err
+	}
+	return s.store.Since(t)
+}
+
+// Search returns the records matching a query unless a fault is injected
+func (s *Store) Search(q audit.Query) ([]audit.Record, error) {
+	if err := s.injector.StorageFault(); err != nil {
+		return nil, err
+	}
+	return s.store.Search(q)
+}
@@ -0,0 +1,52 @@
+package chaos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/chaos"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjector_MLFault(t *testing.T) {
+	injector := chaos.NewInjector()
+	assert.NoError(t, injector.MLFault())
+
+	require.NoError(t, injector.Set(chaos.Faults{MLLatency: 20 * time.Millisecond, MLErrorRate: 1}))
+	start := time.Now()
+	err := injector.MLFault()
+	assert.ErrorIs(t, err, chaos.ErrInjected)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	injector.Clear()
+	assert.NoError(t, injector.MLFault())
+	assert.Equal(t, chaos.Faults{}, injector.Faults())
+}
+
+func TestInjector_RejectsInvalidFaults(t *testing.T) {
+	injector := chaos.NewInjector()
+	assert.Error(t, injector.Set(chaos.Faults{MLErrorRate: 1.5}))
+	assert.Error(t, injector.Set(chaos.Faults{StorageErrorRate: -0.1}))
+	assert.Error(t, injector.Set(chaos.Faults{MLLatency: -time.Second}))
+}
+
+func TestStore_InjectsStorageErrors(t *testing.T) {
+	injector := chaos.NewInjector()
+	store := chaos.WrapStore(audit.NewMemoryStore(10), injector)
+	record := audit.Record{Transaction: detector.Transaction{ID: "TX-1"}, DecidedAt: time.Now()}
+
+	require.NoError(t, store.Save(record))
+
+	require.NoError(t, injector.Set(chaos.Faults{StorageErrorRate: 1}))
+	assert.ErrorIs(t, store.Save(record), chaos.ErrInjected)
+	_, err := store.Search(audit.Query{TransactionID: "TX-1"})
+	assert.ErrorIs(t, err, chaos.ErrInjected)
+
+	injector.Clear()
+	records, err := store.Search(audit.Query{TransactionID: "TX-1"})
+	require.NoError(t, err)
+	assert.Len(t, records, 1, "the failed save was not stored")
+}
@@ -0,0 +1,189 @@
+// Package config resolves layered configuration: settings made globally can
+// be overridden per tenant, per org and again per merchant.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+)
+
+// Layer holds the settings one level of the hierarchy overrides. Unset
+// thresholds, and rules and lists it does not name, are inherited.
+type Layer struct {
+	ReviewThreshold  *float64 `json:"review_threshold,omitempty"`
+	DeclineThreshold *float64 `json:"decline_threshold,omitempty"`
+	// SoftDeclineThreshold soft-declines scores from it up to the decline
+	// threshold, with the retry guidance picked by RetryRules; zero
+	// disables soft declines
+	SoftDeclineThreshold *float64             `json:"soft_decline_threshold,omitempty"`
+	RetryRules           []decision.RetryRule `json:"retry_rules,omitempty"`
+	// MinConfidence is the ML confidence below which decisions rest on the
+	// rule score alone; zero always blends in the ML score
+	MinConfidence *float64 `json:"min_confidence,omitempty"`
+	// Rules switches rules on or off by ID
+	Rules map[string]bool `json:"rules,omitempty"`
+	// Lists replace the lists of the same name used by in_list
+	Lists map[string][]string `json:"lists,omitempty"`
+	// ObserveOnly dark-launches the engine: decisions are made, audited and
+	// published as usual, but the API approves everything
+	ObserveOnly *bool `json:"observe_only,omitempty"`
+	// AuditSampleRate is the share of clean approvals, approved without a
+	// reason code, that are saved to the audit store. Reviews, declines and
+	// flagged approvals are always saved.
+	AuditSampleRate *float64 `json:"audit_sample_rate,omitempty"`
+	// RuleApprover is the role that must sign off rule changes submitted
+	// from a tenant, someone other than their author; empty applies changes
+	// immediately. It is set globally or per tenant, not per merchant.
+	RuleApprover *string `json:"rule_approver,omitempty"`
+	// ReviewSLA is how long REVIEW decisions may wait for an analyst and the
+	// action taken when they expire. It is set globally or per tenant, not
+	// per merchant.
+	ReviewSLA *review.Policy `json:"review_sla,omitempty"`
+}
+
+// MerchantLayer is the layer of a merchant, which belongs to a tenant and
+// to an org within it
+type MerchantLayer struct {
+	Tenant string `json:"tenant,omitempty"`
+	Org    string `json:"org,omitempty"`
+	Layer
+}
+
+// OrgLayer is the layer of an org, such as an acquirer, shared by the
+// merchants of its portfolio. An org belongs to a tenant, and its merchants
+// to the same tenant.
+type OrgLayer struct {
+	Tenant string `json:"tenant,omitempty"`
+	Layer
+}
+
+// Hierarchy holds the global layer and the tenant, org and merchant layers
+// by ID
+type Hierarchy struct {
+	Global    Layer                    `json:"global"`
+	Tenants   map[string]Layer         `json:"tenants,omitempty"`
+	Orgs      map[string]OrgLayer      `json:"orgs,omitempty"`
+	Merchants map[string]MerchantLayer `json:"merchants,omitempty"`
+}
+
+// Validate checks every layer's thresholds and that orgs and merchants
+// belong to known tenants and merchants to known orgs of their tenant
+func (h Hierarchy) Validate() error {
+	if err := h.Global.validate(); err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	for id, layer := range h.Tenants {
+		if err := layer.validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+	}
+	for id, layer := range h.Orgs {
+		if layer.Tenant != "" {
+			if _, exists := h.Tenants[layer.Tenant]; !exists {
+				return fmt.Errorf("org %s: unknown tenant %s", id, layer.Tenant)
+			}
+		}
+		if err := layer.validate(); err != nil {
+			return fmt.Errorf("org %s: %w", id, err)
+		}
+		if layer.RuleApprover != nil {
+			return fmt.Errorf("org %s: the rule approver is set per tenant", id)
+		}
+		if layer.ReviewSLA != nil {
+			return fmt.Errorf("org %s: the review SLA is set per tenant", id)
+		}
+	}
+	for id, layer := range h.Merchants {
+		if layer.Tenant != "" {
+			if _, exists := h.Tenants[layer.Tenant]; !exists {
+				return fmt.Errorf("merchant %s: unknown tenant %s", id, layer.Tenant)
+			}
+		}
+		if layer.Org != "" {
+			org, exists := h.Orgs[layer.Org]
+			if !exists {
+				return fmt.Errorf("merchant %s: unknown org %s", id, layer.Org)
+			}
+			if org.Tenant != layer.Tenant {
+				return fmt.Errorf("merchant %s: org %s belongs to another tenant", id, layer.Org)
+			}
+		}
+		if err := layer.validate(); err != nil {
+			return fmt.Errorf("merchant %s: %w", id, err)
+		}
+		if layer.RuleApprover != nil {
+			return fmt.Errorf("merchant %s: the rule approver is set per tenant", id)
+		}
+		if layer.ReviewSLA != nil {
+			return fmt.Errorf("merchant %s: the review SLA is set per tenant", id)
+		}
+	}
+	return nil
+}
+
+func (l Layer) validate() error {
+	for name, threshold := range map[string]*float64{
+		"review threshold":  l.ReviewThreshold,
+		"decline threshold": l.DeclineThreshold,
+	} {
+		if threshold != nil && (*threshold <= 0 || *threshold > 1) {
+			return fmt.Errorf("%s %.2f must be within (0, 1]", name, *threshold)
+		}
+	}
+	if l.ReviewThreshold != nil && l.DeclineThreshold != nil && *l.ReviewThreshold > *l.DeclineThreshold {
+		return fmt.Errorf("review threshold %.2f exceeds decline threshold %.2f", *l.ReviewThreshold, *l.DeclineThreshold)
+	}
+	if l.SoftDeclineThreshold != nil && (*l.SoftDeclineThreshold < 0 || *l.SoftDeclineThreshold > 1) {
+		return fmt.Errorf("soft decline threshold %.2f must be within [0, 1]", *l.SoftDeclineThreshold)
+	}
+	if err := decision.ValidateRetryRules(l.RetryRules); err != nil {
+		return err
+	}
+	if l.MinConfidence != nil && (*l.MinConfidence < 0 || *l.MinConfidence > 1) {
+		return fmt.Errorf("min confidence %.2f must be within [0, 1]", *l.MinConfidence)
+	}
+	if l.AuditSampleRate != nil && (*l.AuditSampleRate < 0 || *l.AuditSampleRate > 1) {
+		return fmt.Errorf("audit sample rate %.2f must be within [0, 1]", *l.AuditSampleRate)
+	}
+	if l.RuleApprover != nil && *l.RuleApprover != "" {
+		if _, err := auth.ParseRole(*l.RuleApprover); err != nil {
+			return fmt.Errorf("rule approver: %w", err)
+		}
+	}
+	if l.ReviewSLA != nil {
+		if err := l.ReviewSLA.Validate(); err != nil {
+			return fmt.Errorf("review SLA: %w", err)
+		}
+	}
+	return nil
+}
+
+// Load reads a JSON hierarchy
+func Load(r io.Reader) (Hierarchy, error) {
+	var hierarchy Hierarchy
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&hierarchy); err != nil {
+		return Hierarchy{}, fmt.Errorf("invalid configuration hierarchy: %w", err)
+	}
+	if err := hierarchy.Validate(); err != nil {
+		return Hierarchy{}, err
+	}
+	return hierarchy, nil
+}
+
+// LoadFile reads a JSON hierarchy from disk
+func LoadFile(path string) (Hierarchy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Hierarchy{}, err
+	}
+	defer f.Close()
+	return Load(f)
+}
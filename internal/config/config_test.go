@@ -0,0 +1,290 @@
+package config_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/config"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hierarchyJSON = `{
+	"global": {"review_threshold": 0.6, "lists": {"bad_ips": ["10.0.0.1"]}},
+	"tenants": {
+		"acme": {"decline_threshold": 0.9, "rules": {"HIGH_AMOUNT": false}}
+	},
+	"merchants": {
+		"acme-shop": {"tenant": "acme", "review_threshold": 0.4, "lists": {"bad_ips": ["10.0.0.2"]}},
+		"acme-travel": {"tenant": "acme", "rules": {"HIGH_AMOUNT": true}}
+	}
+}`
+
+func TestStore_Resolve(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(hierarchyJSON))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+	base := decision.DefaultPolicy()
+
+	effective := store.Resolve("acme-shop", base)
+	assert.Equal(t, "acme", effective.Tenant)
+	assert.Equal(t, 0.4, effective.ReviewThreshold)
+	assert.Equal(t, 0.9, effective.DeclineThreshold)
+	assert.Equal(t, map[string]bool{"HIGH_AMOUNT": false}, effective.Rules)
+	assert.Equal(t, []string{"10.0.0.2"}, effective.Lists["bad_ips"])
+	assert.Equal(t, map[string]string{
+		"review_threshold":       "merchant:acme-shop",
+		"decline_threshold":      "tenant:acme",
+		"soft_decline_threshold": config.SourceDefault,
+		"retry_rules":            config.SourceDefault,
+		"min_confidence":         config.SourceDefault,
+		"rules.HIGH_AMOUNT":      "tenant:acme",
+		"lists.bad_ips":          "merchant:acme-shop",
+		"observe_only":           config.SourceDefault,
+		"audit_sample_rate":      config.SourceDefault,
+	}, effective.Sources)
+
+	// Merchants without a layer get the global settings
+	effective = store.Resolve("elsewhere", base)
+	assert.Empty(t, effective.Tenant)
+	assert.Equal(t, 0.6, effective.ReviewThreshold)
+	assert.Equal(t, base.DeclineThreshold, effective.DeclineThreshold)
+	assert.Equal(t, config.SourceDefault, effective.Sources["decline_threshold"])
+
+	assert.Equal(t, decision.Policy{ReviewThreshold: 0.4, DeclineThreshold: 0.9}, store.Policy("acme-shop", base))
+	assert.True(t, store.Overrides("acme-shop").DisabledRules["HIGH_AMOUNT"])
+	assert.False(t, store.Overrides("acme-travel").DisabledRules["HIGH_AMOUNT"], "the merchant switches it back on")
+}
+
+func TestStore_ObserveOnly(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(`{
+		"tenants": {"acme": {"observe_only": true}},
+		"merchants": {
+			"acme-shop": {"tenant": "acme"},
+			"acme-travel": {"tenant": "acme", "observe_only": false}
+		}
+	}`))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+
+	assert.True(t, store.ObserveOnly("acme-shop"), "inherited from the tenant")
+	assert.False(t, store.ObserveOnly("acme-travel"), "the merchant enforces decisions")
+	assert.False(t, store.ObserveOnly("elsewhere"))
+
+	effective := store.Resolve("acme-shop", decision.DefaultPolicy())
+	assert.True(t, effective.ObserveOnly)
+	assert.Equal(t, "tenant:acme", effective.Sources["observe_only"])
+}
+
+func TestStore_AuditSampleRate(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(`{
+		"global": {"audit_sample_rate": 0.5},
+		"tenants": {"acme": {"audit_sample_rate": 0.1}},
+		"merchants": {
+			"acme-shop": {"tenant": "acme"},
+			"acme-travel": {"tenant": "acme", "audit_sample_rate": 1}
+		}
+	}`))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+
+	assert.Equal(t, 0.1, store.AuditSampleRate("acme-shop"), "inherited from the tenant")
+	assert.Equal(t, 1.0, store.AuditSampleRate("acme-travel"))
+	assert.Equal(t, 0.5, store.AuditSampleRate("elsewhere"))
+	assert.Equal(t, 1.0, config.NewStore(config.Hierarchy{}).AuditSampleRate("elsewhere"), "everything is audited by default")
+
+	effective := store.Resolve("acme-shop", decision.DefaultPolicy())
+	assert.Equal(t, 0.1, effective.AuditSampleRate)
+	assert.Equal(t, "tenant:acme", effective.Sources["audit_sample_rate"])
+}
+
+func TestStore_RuleApprover(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(`{
+		"global": {"rule_approver": "rule-author"},
+		"tenants": {"acme": {"rule_approver": "admin"}, "sandbox": {"rule_approver": ""}, "other": {}}
+	}`))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+
+	assert.Equal(t, "admin", store.RuleApprover("acme"))
+	assert.Empty(t, store.RuleApprover("sandbox"), "the tenant applies changes immediately")
+	assert.Equal(t, "rule-author", store.RuleApprover("other"), "inherited from the global layer")
+	assert.Equal(t, "rule-author", store.RuleApprover(""))
+	assert.Empty(t, config.NewStore(config.Hierarchy{}).RuleApprover("acme"))
+}
+
+func TestStore_ReviewSLA(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(`{
+		"global": {"review_sla": {"resolve_within": "4h"}},
+		"tenants": {"acme": {"review_sla": {"resolve_within": "2h", "on_expiry": "decline"}}, "other": {}}
+	}`))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+
+	assert.Equal(t, 2*time.Hour, store.ReviewSLA("acme").Window())
+	assert.Equal(t, "decline", store.ReviewSLA("acme").OnExpiry)
+	assert.Equal(t, 4*time.Hour, store.ReviewSLA("other").Window(), "inherited from the global layer")
+	assert.Zero(t, config.NewStore(config.Hierarchy{}).ReviewSLA("acme").Window())
+
+	for _, body := range []string{
+		`{"global": {"review_sla": {"resolve_within": "soon"}}}`,
+		`{"tenants": {"acme": {"review_sla": {"resolve_within": "2h", "on_expiry": "ignore"}}}}`,
+		`{"merchants": {"acme-shop": {"review_sla": {"resolve_within": "2h"}}}}`,
+	} {
+		_, err := config.Load(strings.NewReader(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestStore_SoftDecline(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(`{
+		"global": {
+			"soft_decline_threshold": 0.65,
+			"retry_rules": [{"reason_codes": ["NEW_DEVICE"], "retry": "retry_after_step_up"}]
+		},
+		"merchants": {"acme-shop": {"soft_decline_threshold": 0}}
+	}`))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+
+	policy := store.Policy("elsewhere", decision.DefaultPolicy())
+	assert.Equal(t, 0.65, policy.SoftDeclineThreshold)
+	assert.Equal(t, decision.RetryAfterStepUp, policy.Retry(&detector.FraudScore{ReasonCodes: []string{"NEW_DEVICE"}}))
+
+	effective := store.Resolve("acme-shop", decision.DefaultPolicy())
+	assert.Zero(t, effective.SoftDeclineThreshold, "the merchant turns soft declines off")
+	assert.Equal(t, "merchant:acme-shop", effective.Sources["soft_decline_threshold"])
+	assert.Equal(t, config.SourceGlobal, effective.Sources["retry_rules"])
+}
+
+func TestHierarchy_Validate(t *testing.T) {
+	tests := map[string]string{
+		`{"global": {"review_threshold": 1.5}}`:                                                      "within (0, 1]",
+		`{"tenants": {"t": {"review_threshold": 0.9, "decline_threshold": 0.5}}}`:                    "exceeds decline threshold",
+		`{"merchants": {"m": {"tenant": "missing"}}}`:                                                "unknown tenant",
+		`{"global": {"threshold": 0.5}}`:                                                             "unknown field",
+		`{"tenants": {"t": {"audit_sample_rate": 2}}}`:                                               "within [0, 1]",
+		`{"global": {"retry_rules": [{"reason_codes": ["X"]}]}}`:                                     "retry must be",
+		`{"global": {"rule_approver": "owner"}}`:                                                     "unknown role",
+		`{"tenants": {"t": {}}, "merchants": {"m": {"rule_approver": "admin"}}}`:                     "set per tenant",
+		`{"merchants": {"m": {"org": "missing"}}}`:                                                   "unknown org",
+		`{"tenants": {"t": {}}, "orgs": {"o": {}}, "merchants": {"m": {"tenant": "t", "org": "o"}}}`: "another tenant",
+	}
+	for source, message := range tests {
+		_, err := config.Load(strings.NewReader(source))
+		require.Error(t, err, source)
+		assert.Contains(t, err.Error(), message, source)
+	}
+
+	store := config.NewStore(config.Hierarchy{})
+	assert.Error(t, store.Set(config.Hierarchy{Merchants: map[string]config.MerchantLayer{"m": {Tenant: "missing"}}}))
+}
+
+func TestStore_Orgs(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(`{
+		"global": {"review_threshold": 0.6},
+		"tenants": {"acme": {"decline_threshold": 0.9}},
+		"orgs": {"acquirer": {"tenant": "acme", "review_threshold": 0.5, "lists": {"bad_ips": ["10.0.0.3"]}}},
+		"merchants": {
+			"acme-shop": {"tenant": "acme", "org": "acquirer", "review_threshold": 0.4},
+			"acme-travel": {"tenant": "acme", "org": "acquirer"},
+			"acme-books": {"tenant": "acme"}
+		}
+	}`))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+	base := decision.DefaultPolicy()
+
+	effective := store.Resolve("acme-travel", base)
+	assert.Equal(t, "acquirer", effective.Org)
+	assert.Equal(t, 0.5, effective.ReviewThreshold)
+	assert.Equal(t, "org:acquirer", effective.Sources["review_threshold"])
+	assert.Equal(t, "tenant:acme", effective.Sources["decline_threshold"])
+	assert.Equal(t, "org:acquirer", effective.Sources["lists.bad_ips"])
+	assert.Equal(t, 0.4, store.Resolve("acme-shop", base).ReviewThreshold, "the merchant overrides its org")
+	assert.Equal(t, 0.6, store.Resolve("acme-books", base).ReviewThreshold, "outside the org")
+	assert.Equal(t, []string{"acme-shop", "acme-travel"}, store.OrgMerchants("acquirer"))
+	assert.Empty(t, store.OrgMerchants("missing"))
+
+	org, _ := store.Org("acquirer")
+	threshold := 0.3
+	org.ReviewThreshold = &threshold
+	org.Lists = map[string][]string{"bad_ips": {"10.0.0.4"}}
+	assert.True(t, store.Overrides("acme-travel").Lists.Contains("bad_ips", "10.0.0.3"))
+	require.NoError(t, store.SetOrg("acquirer", org))
+	assert.Equal(t, 0.3, store.Policy("acme-travel", base).ReviewThreshold)
+	assert.True(t, store.Overrides("acme-travel").Lists.Contains("bad_ips", "10.0.0.4"), "cached overrides are dropped")
+	assert.Equal(t, 0.5, *hierarchy.Orgs["acquirer"].ReviewThreshold, "earlier copies are not changed")
+
+	assert.Error(t, store.SetOrg("acquirer", config.OrgLayer{}), "its merchants belong to acme")
+	require.NoError(t, store.SetOrg("portfolio", config.OrgLayer{}))
+	_, exists := store.Org("portfolio")
+	assert.True(t, exists)
+}
+
+func TestStore_SetMerchantList(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(hierarchyJSON))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+	before := store.Hierarchy()
+
+	require.NoError(t, store.SetMerchantList("acme-shop", detector.TrustedCustomersList, []string{"ACC-1"}))
+	assert.ErrorIs(t, store.SetMerchantList("elsewhere", detector.TrustedCustomersList, nil), config.ErrUnknownMerchant)
+
+	merchant, exists := store.Merchant("acme-shop")
+	require.True(t, exists)
+	assert.Equal(t, []string{"ACC-1"}, merchant.Lists[detector.TrustedCustomersList])
+	assert.Equal(t, []string{"10.0.0.2"}, merchant.Lists["bad_ips"], "other lists are kept")
+	assert.NotContains(t, before.Merchants["acme-shop"].Lists, detector.TrustedCustomersList, "earlier copies are not changed")
+
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.SetOverrideResolver(store)
+	score, err := d.Analyze(context.Background(), &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", MerchantID: "acme-shop", Amount: 50})
+	require.NoError(t, err)
+	assert.True(t, score.Trusted)
+	score, err = d.Analyze(context.Background(), &detector.Transaction{ID: "TXN-2", AccountID: "ACC-1", MerchantID: "acme-travel", Amount: 50})
+	require.NoError(t, err)
+	assert.False(t, score.Trusted, "trusted by another merchant only")
+}
+
+func TestDetector_MerchantOverrides(t *testing.T) {
+	hierarchy, err := config.Load(strings.NewReader(hierarchyJSON))
+	require.NoError(t, err)
+	store := config.NewStore(hierarchy)
+
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.SetOverrideResolver(store)
+	lists := detector.NewLists()
+	lists.Set("bad_ips", []string{"10.0.0.9"})
+	d.SetLists(lists)
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:          "BAD_IP",
+		Description: "IP address on the block list",
+		Expression:  "in_list('bad_ips', tx.ip_address)",
+		Score:       0.2,
+	}))
+
+	analyze := func(merchant, ip string, amount float64) []string {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID: "TXN-1", AccountID: "ACC-" + merchant + ip, MerchantID: merchant, IPAddress: ip, Amount: amount,
+		})
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+
+	assert.Contains(t, analyze("acme-shop", "10.0.0.2", 50), "BAD_IP", "the merchant's list replaces the global one")
+	assert.NotContains(t, analyze("acme-shop", "10.0.0.9", 50), "BAD_IP")
+	assert.Contains(t, analyze("elsewhere", "10.0.0.1", 50), "BAD_IP", "global list")
+	assert.Contains(t, analyze("acme-travel", "10.0.0.1", 50), "BAD_IP", "inherited from the global layer")
+
+	assert.NotContains(t, analyze("acme-shop", "", 20000), "HIGH_AMOUNT")
+	assert.Contains(t, analyze("acme-travel", "", 20000), "HIGH_AMOUNT")
+	assert.Contains(t, analyze("elsewhere", "", 20000), "HIGH_AMOUNT")
+
+	require.NoError(t, store.Set(config.Hierarchy{}))
+	assert.Contains(t, analyze("acme-shop", "10.0.0.9", 50), "BAD_IP", "the detector's list when no layer sets it")
+}
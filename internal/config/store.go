@@ -0,0 +1,389 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+)
+
+// Sources of effective settings other than tenants ("tenant:ID"), orgs
+// ("org:ID") and merchants ("merchant:ID")
+const (
+	SourceDefault = "default"
+	SourceGlobal  = "global"
+)
+
+// ErrUnknownMerchant is returned for merchants without a layer
+var ErrUnknownMerchant = errors.New("unknown merchant")
+
+// Effective is the configuration in effect for a merchant. Sources names the
+// layer each setting comes from, keyed by review_threshold,
+// decline_threshold, soft_decline_threshold, retry_rules, min_confidence,
+// observe_only, audit_sample_rate, rules.ID and lists.NAME.
+type Effective struct {
+	MerchantID           string               `json:"merchant_id"`
+	Tenant               string               `json:"tenant,omitempty"`
+	Org                  string               `json:"org,omitempty"`
+	ReviewThreshold      float64              `json:"review_threshold"`
+	DeclineThreshold     float64              `json:"decline_threshold"`
+	SoftDeclineThreshold float64              `json:"soft_decline_threshold"`
+	RetryRules           []decision.RetryRule `json:"retry_rules,omitempty"`
+	MinConfidence        float64              `json:"min_confidence"`
+	Rules                map[string]bool      `json:"rules,omitempty"`
+	Lists                map[string][]string  `json:"lists,omitempty"`
+	ObserveOnly          bool                 `json:"observe_only"`
+	AuditSampleRate      float64              `json:"audit_sample_rate"`
+	Sources              map[string]string    `json:"sources"`
+}
+
+// Store holds the configuration hierarchy and resolves it for the detector
+// and the decision policy
+type Store struct {
+	hierarchy Hierarchy
+	// overrides caches the detector overrides of merchants with a layer,
+	// and under "" those of every other merchant
+	overrides map[string]*detector.Overrides
+	// version counts replacements, so stale overrides are not cached
+	version int
+	mu      sync.RWMutex
+}
+
+type sourcedLayer struct {
+	source string
+	Layer
+}
+
+func NewStore(hierarchy Hierarchy) *Store {
+	return &Store{
+		hierarchy: hierarchy,
+		overrides: make(map[string]*detector.Overrides),
+	}
+}
+
+// Hierarchy returns the configuration hierarchy
+func (s *Store) Hierarchy() Hierarchy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hierarchy
+}
+
+// Set validates and replaces the configuration hierarchy
+func (s *Store) Set(hierarchy Hierarchy) error {
+	if err := hierarchy.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hierarchy = hierarchy
+	s.overrides = make(map[string]*detector.Overrides)
+	s.version++
+	return nil
+}
+
+// SetMerchantList replaces one list of a merchant's layer, leaving the rest
+// of the hierarchy as it is. The merchant must have a layer.
+func (s *Store) SetMerchantList(merchantID, name string, values []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merchant, exists := s.hierarchy.Merchants[merchantID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownMerchant, merchantID)
+	}
+	// Hierarchies handed out share their maps, so they are copied
+	lists := make(map[string][]string, len(merchant.Lists)+1)
+	for list, listValues := range merchant.Lists {
+		lists[list] = listValues
+	}
+	lists[name] = append([]string{}, values...)
+	merchant.Lists = lists
+
+	merchants := make(map[string]MerchantLayer, len(s.hierarchy.Merchants))
+	for id, layer := range s.hierarchy.Merchants {
+		merchants[id] = layer
+	}
+	merchants[merchantID] = merchant
+	s.hierarchy.Merchants = merchants
+	s.overrides = make(map[string]*detector.Overrides)
+	s.version++
+	return nil
+}
+
+// Merchant returns the layer of a merchant
+func (s *Store) Merchant(merchantID string) (MerchantLayer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	merchant, exists := s.hierarchy.Merchants[merchantID]
+	return merchant, exists
+}
+
+// Org returns the layer of an org
+func (s *Store) Org(orgID string) (OrgLayer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	org, exists := s.hierarchy.Orgs[orgID]
+	return org, exists
+}
+
+// OrgMerchants returns the merchants of an org, sorted
+func (s *Store) OrgMerchants(orgID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	merchants := []string{}
+	for id, layer := range s.hierarchy.Merchants {
+		if layer.Org == orgID {
+			merchants = append(merchants, id)
+		}
+	}
+	sort.Strings(merchants)
+	return merchants
+}
+
+// SetOrg creates or replaces the layer of an org, leaving the rest of the
+// hierarchy as it is. The hierarchy must stay valid, so an org with
+// merchants keeps their tenant.
+func (s *Store) SetOrg(orgID string, org OrgLayer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Hierarchies handed out share their maps, so they are copied
+	orgs := make(map[string]OrgLayer, len(s.hierarchy.Orgs)+1)
+	for id, layer := range s.hierarchy.Orgs {
+		orgs[id] = layer
+	}
+	orgs[orgID] = org
+	hierarchy := s.hierarchy
+	hierarchy.Orgs = orgs
+	if err := hierarchy.Validate(); err != nil {
+		return err
+	}
+	s.hierarchy = hierarchy
+	s.overrides = make(map[string]*detector.Overrides)
+	s.version++
+	return nil
+}
+
+// layers returns the tenant and org of a merchant and the layers that apply
+// to it, from global to merchant. Callers must hold the lock.
+func (s *Store) layers(merchantID string) (string, string, []sourcedLayer) {
+	layers := []sourcedLayer{{SourceGlobal, s.hierarchy.Global}}
+	merchant, exists := s.hierarchy.Merchants[merchantID]
+	if !exists {
+		return "", "", layers
+	}
+	if tenant, exists := s.hierarchy.Tenants[merchant.Tenant]; exists {
+		layers = append(layers, sourcedLayer{"tenant:" + merchant.Tenant, tenant})
+	}
+	if org, exists := s.hierarchy.Orgs[merchant.Org]; exists {
+		layers = append(layers, sourcedLayer{"org:" + merchant.Org, org.Layer})
+	}
+	return merchant.Tenant, merchant.Org, append(layers, sourcedLayer{"merchant:" + merchantID, merchant.Layer})
+}
+
+// Resolve returns the configuration in effect for a merchant. Thresholds no
+// layer sets come from the base policy.
+func (s *Store) Resolve(merchantID string, base decision.Policy) Effective {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenant, org, layers := s.layers(merchantID)
+	effective := Effective{
+		MerchantID:           merchantID,
+		Tenant:               tenant,
+		Org:                  org,
+		ReviewThreshold:      base.ReviewThreshold,
+		DeclineThreshold:     base.DeclineThreshold,
+		SoftDeclineThreshold: base.SoftDeclineThreshold,
+		RetryRules:           base.RetryRules,
+		MinConfidence:        base.MinConfidence,
+		AuditSampleRate:      1,
+		Rules:                make(map[string]bool),
+		Lists:                make(map[string][]string),
+		Sources: map[string]string{
+			"review_threshold":       SourceDefault,
+			"decline_threshold":      SourceDefault,
+			"soft_decline_threshold": SourceDefault,
+			"retry_rules":            SourceDefault,
+			"min_confidence":         SourceDefault,
+			"observe_only":           SourceDefault,
+			"audit_sample_rate":      SourceDefault,
+		},
+	}
+	for _, layer := range layers {
+		if layer.ReviewThreshold != nil {
+			effective.ReviewThreshold = *layer.ReviewThreshold
+			effective.Sources["review_threshold"] = layer.source
+		}
+		if layer.DeclineThreshold != nil {
+			effective.DeclineThreshold = *layer.DeclineThreshold
+			effective.Sources["decline_threshold"] = layer.source
+		}
+		if layer.SoftDeclineThreshold != nil {
+			effective.SoftDeclineThreshold = *layer.SoftDeclineThreshold
+			effective.Sources["soft_decline_threshold"] = layer.source
+		}
+		if layer.RetryRules != nil {
+			effective.RetryRules = layer.RetryRules
+			effective.Sources["retry_rules"] = layer.source
+		}
+		if layer.MinConfidence != nil {
+			effective.MinConfidence = *layer.MinConfidence
+			effective.Sources["min_confidence"] = layer.source
+		}
+		if layer.ObserveOnly != nil {
+			effective.ObserveOnly = *layer.ObserveOnly
+			effective.Sources["observe_only"] = layer.source
+		}
+		if layer.AuditSampleRate != nil {
+			effective.AuditSampleRate = *layer.AuditSampleRate
+			effective.Sources["audit_sample_rate"] = layer.source
+		}
+		for id, enabled := range layer.Rules {
+			effective.Rules[id] = enabled
+			effective.Sources["rules."+id] = layer.source
+		}
+		for name, values := range layer.Lists {
+			effective.Lists[name] = values
+			effective.Sources["lists."+name] = layer.source
+		}
+	}
+	return effective
+}
+
+// Policy returns the decision policy in effect for a merchant
+func (s *Store) Policy(merchantID string, base decision.Policy) decision.Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, _, layers := s.layers(merchantID)
+	for _, layer := range layers {
+		if layer.ReviewThreshold != nil {
+			base.ReviewThreshold = *layer.ReviewThreshold
+		}
+		if layer.DeclineThreshold != nil {
+			base.DeclineThreshold = *layer.DeclineThreshold
+		}
+		if layer.SoftDeclineThreshold != nil {
+			base.SoftDeclineThreshold = *layer.SoftDeclineThreshold
+		}
+		if layer.RetryRules != nil {
+			base.RetryRules = layer.RetryRules
+		}
+		if layer.MinConfidence != nil {
+			base.MinConfidence = *layer.MinConfidence
+		}
+	}
+	return base
+}
+
+// ObserveOnly reports whether a merchant is in observe-only mode
+func (s *Store) ObserveOnly(merchantID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	observeOnly := false
+	_, _, layers := s.layers(merchantID)
+	for _, layer := range layers {
+		if layer.ObserveOnly != nil {
+			observeOnly = *layer.ObserveOnly
+		}
+	}
+	return observeOnly
+}
+
+// AuditSampleRate returns the share of a merchant's clean approvals that are
+// audited, 1 unless a layer sets it
+func (s *Store) AuditSampleRate(merchantID string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rate := 1.0
+	_, _, layers := s.layers(merchantID)
+	for _, layer := range layers {
+		if layer.AuditSampleRate != nil {
+			rate = *layer.AuditSampleRate
+		}
+	}
+	return rate
+}
+
+// RuleApprover returns the role that must sign off the rule changes of a
+// tenant, empty when they apply immediately
+func (s *Store) RuleApprover(tenant string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	approver := ""
+	if s.hierarchy.Global.RuleApprover != nil {
+		approver = *s.hierarchy.Global.RuleApprover
+	}
+	if layer, exists := s.hierarchy.Tenants[tenant]; exists && layer.RuleApprover != nil {
+		approver = *layer.RuleApprover
+	}
+	return approver
+}
+
+// ReviewSLA returns the SLA of the review cases of a tenant, the zero policy
+// when there is none
+func (s *Store) ReviewSLA(tenant string) review.Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var policy review.Policy
+	if s.hierarchy.Global.ReviewSLA != nil {
+		policy = *s.hierarchy.Global.ReviewSLA
+	}
+	if layer, exists := s.hierarchy.Tenants[tenant]; exists && layer.ReviewSLA != nil {
+		policy = *layer.ReviewSLA
+	}
+	return policy
+}
+
+// Overrides returns the rule toggles and lists in effect for a merchant, or
+// nil when no layer sets any
+func (s *Store) Overrides(merchantID string) *detector.Overrides {
+	key := merchantID
+	s.mu.RLock()
+	if _, exists := s.hierarchy.Merchants[merchantID]; !exists {
+		key = ""
+	}
+	overrides, cached := s.overrides[key]
+	version := s.version
+	s.mu.RUnlock()
+	if cached {
+		return overrides
+	}
+
+	effective := s.Resolve(key, decision.Policy{})
+	for id, enabled := range effective.Rules {
+		if enabled {
+			continue
+		}
+		if overrides == nil {
+			overrides = &detector.Overrides{DisabledRules: make(map[string]bool)}
+		}
+		overrides.DisabledRules[id] = true
+	}
+	for name, values := range effective.Lists {
+		if overrides == nil {
+			overrides = &detector.Overrides{}
+		}
+		if overrides.Lists == nil {
+			overrides.Lists = detector.NewLists()
+		}
+		overrides.Lists.Set(name, values)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version == version {
+		s.overrides[key] = overrides
+	}
+	return overrides
+}
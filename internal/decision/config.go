@@ -0,0 +1,167 @@
+package decision
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// CurrentConfiguration is the name of the live configuration
+const CurrentConfiguration = "current"
+
+// Configuration is a named, serializable description of a scoring pipeline
+type Configuration struct {
+	Name              string  `json:"name" openapi:"required,minLength=1"`
+	MaxVelocity       int     `json:"max_velocity"`
+	VelocityWindow    string  `json:"velocity_window"`
+	HighRiskThreshold float64 `json:"high_risk_threshold"`
+	BlockThreshold    float64 `json:"block_threshold"`
+	MLEnabled         bool    `json:"ml_enabled"`
+	DeclineThreshold  float64 `json:"decline_threshold"`
+	ReviewThreshold   float64 `json:"review_threshold"`
+	// SoftDeclineThreshold soft-declines scores from it up to the decline
+	// threshold; zero disables soft declines
+	SoftDeclineThreshold float64     `json:"soft_decline_threshold,omitempty"`
+	RetryRules           []RetryRule `json:"retry_rules,omitempty"`
+	// MinConfidence is the ML confidence below which decisions rest on the
+	// rule score alone; zero always blends in the ML score
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+}
+
+// DefaultConfiguration describes the default detector and policy
+func DefaultConfiguration() Configuration {
+	config := detector.DefaultConfig()
+	policy := DefaultPolicy()
+	return Configuration{
+		Name:              CurrentConfiguration,
+		MaxVelocity:       config.MaxVelocity,
+		VelocityWindow:    config.VelocityWindow.String(),
+		HighRiskThreshold: config.HighRiskThreshold,
+		BlockThreshold:    config.BlockThreshold,
+		MLEnabled:         config.MLEnabled,
+		DeclineThreshold:  policy.DeclineThreshold,
+		ReviewThreshold:   policy.ReviewThreshold,
+	}
+}
+
+// Validate checks the configuration for consistency
+func (c Configuration) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("configuration name is required")
+	}
+	if _, err := c.DetectorConfig(); err != nil {
+		return err
+	}
+	if c.ReviewThreshold <= 0 || c.DeclineThreshold <= 0 {
+		return fmt.Errorf("review and decline thresholds must be positive")
+	}
+	if c.ReviewThreshold > c.DeclineThreshold {
+		return fmt.Errorf("review threshold %.2f exceeds decline threshold %.2f", c.ReviewThreshold, c.DeclineThreshold)
+	}
+	if c.SoftDeclineThreshold != 0 && (c.SoftDeclineThreshold < c.ReviewThreshold || c.SoftDeclineThreshold > c.DeclineThreshold) {
+		return fmt.Errorf("soft decline threshold %.2f must be within the review and decline thresholds", c.SoftDeclineThreshold)
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return fmt.Errorf("min confidence %.2f must be within [0, 1]", c.MinConfidence)
+	}
+	return ValidateRetryRules(c.RetryRules)
+}
+
+// DetectorConfig returns the detector part of the configuration
+func (c Configuration) DetectorConfig() (detector.Config, error) {
+	window, err := time.ParseDuration(c.VelocityWindow)
+	if err != nil {
+		return detector.Config{}, fmt.Errorf("invalid velocity window %q: %w", c.VelocityWindow, err)
+	}
+	return detector.Config{
+		MaxVelocity:       c.MaxVelocity,
+		VelocityWindow:    window,
+		HighRiskThreshold: c.HighRiskThreshold,
+		BlockThreshold:    c.BlockThreshold,
+		MLEnabled:         c.MLEnabled,
+	}, nil
+}
+
+// Policy returns the decision policy part of the configuration
+func (c Configuration) Policy() Policy {
+	return Policy{
+		DeclineThreshold:     c.DeclineThreshold,
+		ReviewThreshold:      c.ReviewThreshold,
+		SoftDeclineThreshold: c.SoftDeclineThreshold,
+		RetryRules:           c.RetryRules,
+		MinConfidence:        c.MinConfidence,
+	}
+}
+
+// Registry holds named configurations
+type Registry struct {
+	configs map[string]Configuration
+	mu      sync.RWMutex
+}
+
+// NewRegistry creates a registry holding the current configuration
+func NewRegistry(current Configuration) *Registry {
+	current.Name = CurrentConfiguration
+	return &Registry{
+		configs: map[string]Configuration{CurrentConfiguration: current},
+	}
+}
+
+// Get returns a configuration by name
+func (r *Registry) Get(name string) (Configuration, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	config, exists := r.configs[name]
+	if !exists {
+		return Configuration{}, fmt.Errorf("configuration not found: %s", name)
+	}
+	return config, nil
+}
+
+// Put validates and stores a configuration. The current configuration
+// cannot be replaced.
+func (r *Registry) Put(config Configuration) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.Name == CurrentConfiguration {
+		return fmt.Errorf("configuration %q is reserved", CurrentConfiguration)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configs[config.Name] = config
+	return nil
+}
+
+// SetCurrent validates and replaces the current configuration
+func (r *Registry) SetCurrent(config Configuration) error {
+	config.Name = CurrentConfiguration
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configs[CurrentConfiguration] = config
+	return nil
+}
+
+// List returns all configurations sorted by name
+func (r *Registry) List() []Configuration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	configs := make([]Configuration, 0, len(r.configs))
+	for _, config := range r.configs {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Name < configs[j].Name
+	})
+	return configs
+}
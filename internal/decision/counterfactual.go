@@ -0,0 +1,106 @@
+package decision
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Counterfactual is the smallest set of score components without which a
+// transaction would have been decided more leniently
+type Counterfactual struct {
+	Without   []string `json:"without" doc:"Score components, the one lowering the score most first; ml_model is the ML score"`
+	Score     float64  `json:"score" doc:"Final score without them"`
+	Threshold float64  `json:"threshold" doc:"Threshold of the decision made, which the score falls below"`
+	Decision  string   `json:"decision" doc:"Decision without them"`
+	Hint      string   `json:"hint"`
+}
+
+// ComponentModel is the ML score blended into the final score, which
+// counterfactuals may remove like the detector's components
+const ComponentModel = "ml_model"
+
+// Counterfactual finds what pushed a transaction over the threshold of its
+// decision: the fewest score components whose removal decides it more
+// leniently under the same policy. Components are removed in order of how
+// much each lowers the final score on its own; as the detector's add up, the
+// first set that flips the decision is a smallest one. It returns nil for
+// approvals and for decisions no removal flips, such as hard blocks.
+func (s *Scorer) Counterfactual(tx *detector.Transaction, outcome *Outcome) *Counterfactual {
+	if outcome.Decision == Approve || outcome.Detection == nil {
+		return nil
+	}
+	type candidate struct {
+		component string
+		drop      float64
+	}
+	var candidates []candidate
+	for _, contribution := range outcome.Detection.Contributions {
+		if contribution.Score > 0 {
+			trial := s.without(tx, outcome, contribution.Component)
+			candidates = append(candidates, candidate{contribution.Component, outcome.FinalScore - trial.FinalScore})
+		}
+	}
+	if outcome.blended && outcome.MLScore > outcome.Detection.Score {
+		trial := s.without(tx, outcome, ComponentModel)
+		candidates = append(candidates, candidate{ComponentModel, outcome.FinalScore - trial.FinalScore})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].drop > candidates[j].drop })
+
+	without := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		without = append(without, candidate.component)
+		trial := s.without(tx, outcome, without...)
+		if severity[trial.Decision] >= severity[outcome.Decision] {
+			continue
+		}
+
+		name, threshold := s.PolicyFor(tx.MerchantID).threshold(outcome.Decision)
+		return &Counterfactual{
+			Without:   without,
+			Score:     trial.FinalScore,
+			Threshold: threshold,
+			Decision:  trial.Decision,
+			Hint: fmt.Sprintf("score without %s = %.2f < %s threshold %.2f",
+				strings.Join(without, " and "), trial.FinalScore, name, threshold),
+		}
+	}
+	return nil
+}
+
+// without decides an outcome again without some score components
+func (s *Scorer) without(tx *detector.Transaction, outcome *Outcome, components ...string) Outcome {
+	detection := *outcome.Detection
+	detection.Score = detection.ScoreWithout(components...)
+	trial := *outcome
+	trial.Detection = &detection
+	trial.FinalScore = detection.Score
+	if trial.blended && !contains(components, ComponentModel) {
+		trial.FinalScore = (detection.Score + trial.MLScore) / 2
+	}
+	s.decide(tx, &trial, "")
+	return trial
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// threshold returns the name and value of the lowest score a decision is
+// made from
+func (p Policy) threshold(decision string) (string, float64) {
+	switch decision {
+	case Decline:
+		return "decline", p.DeclineThreshold
+	case SoftDecline:
+		return "soft decline", p.SoftDeclineThreshold
+	}
+	return "review", p.ReviewThreshold
+}
@@ -0,0 +1,355 @@
+package decision_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Decide(t *testing.T) {
+	policy := decision.DefaultPolicy()
+
+	assert.Equal(t, decision.Approve, policy.Decide(0.1, &detector.FraudScore{}))
+	assert.Equal(t, decision.Review, policy.Decide(0.5, &detector.FraudScore{}))
+	assert.Equal(t, decision.Decline, policy.Decide(0.8, &detector.FraudScore{}))
+	assert.Equal(t, decision.Review, policy.Decide(0.1, &detector.FraudScore{RequiresReview: true}))
+	assert.Equal(t, decision.Decline, policy.Decide(0.1, &detector.FraudScore{Blocked: true}))
+
+	// Trusted customers skip score-based review only
+	assert.Equal(t, decision.Approve, policy.Decide(0.6, &detector.FraudScore{Trusted: true}))
+	assert.Equal(t, decision.Decline, policy.Decide(0.8, &detector.FraudScore{Trusted: true}))
+	assert.Equal(t, decision.Review, policy.Decide(0.1, &detector.FraudScore{Trusted: true, RequiresReview: true}))
+}
+
+func TestPolicy_SoftDecline(t *testing.T) {
+	policy := decision.DefaultPolicy()
+	policy.SoftDeclineThreshold = 0.65
+	policy.RetryRules = []decision.RetryRule{
+		{ReasonCodes: []string{"NEW_DEVICE", "ACCOUNT_TAKEOVER"}, Retry: decision.RetryAfterStepUp},
+	}
+
+	assert.Equal(t, decision.Review, policy.Decide(0.6, &detector.FraudScore{}))
+	assert.Equal(t, decision.SoftDecline, policy.Decide(0.7, &detector.FraudScore{}))
+	assert.Equal(t, decision.SoftDecline, policy.Decide(0.7, &detector.FraudScore{RequiresReview: true}))
+	assert.Equal(t, decision.Decline, policy.Decide(0.8, &detector.FraudScore{}))
+	assert.Equal(t, decision.Decline, policy.Decide(0.7, &detector.FraudScore{Blocked: true}), "hard blocks are not retried")
+	assert.Equal(t, decision.Approve, policy.Decide(0.7, &detector.FraudScore{Trusted: true}))
+
+	assert.Equal(t, decision.RetryAfterStepUp, policy.Retry(&detector.FraudScore{ReasonCodes: []string{"HIGH_AMOUNT", "ACCOUNT_TAKEOVER"}}))
+	assert.Equal(t, decision.RetryWith3DS, policy.Retry(&detector.FraudScore{ReasonCodes: []string{"HIGH_AMOUNT"}}))
+
+	config := decision.DefaultConfiguration()
+	config.SoftDeclineThreshold = 0.4
+	assert.Error(t, config.Validate(), "below the review threshold")
+	config.SoftDeclineThreshold = 0.65
+	config.RetryRules = []decision.RetryRule{{ReasonCodes: []string{"NEW_DEVICE"}, Retry: "retry_later"}}
+	assert.Error(t, config.Validate())
+}
+
+func TestRegistry(t *testing.T) {
+	registry := decision.NewRegistry(decision.DefaultConfiguration())
+
+	current, err := registry.Get(decision.CurrentConfiguration)
+	require.NoError(t, err)
+	assert.Equal(t, 0.8, current.DeclineThreshold)
+
+	strict := current
+	strict.Name = "strict"
+	strict.DeclineThreshold = 0.4
+	strict.ReviewThreshold = 0.2
+	require.NoError(t, registry.Put(strict))
+	assert.Len(t, registry.List(), 2)
+
+	_, err = registry.Get("missing")
+	assert.Error(t, err)
+
+	assert.Error(t, registry.Put(current), "current configuration is reserved")
+
+	invalid := strict
+	invalid.Name = "invalid"
+	invalid.ReviewThreshold = 0.9
+	assert.Error(t, registry.Put(invalid))
+
+	invalid.ReviewThreshold = 0.2
+	invalid.VelocityWindow = "soon"
+	assert.Error(t, registry.Put(invalid))
+}
+
+func scorerFor(t *testing.T, config decision.Configuration) *decision.Scorer {
+	detectorConfig, err := config.DetectorConfig()
+	require.NoError(t, err)
+	return decision.NewScorer(detector.NewFraudDetectorWithConfig(detectorConfig), ml.NewMLEngine(), config.Policy())
+}
+
+func TestDiff(t *testing.T) {
+	current := decision.DefaultConfiguration()
+	strict := current
+	strict.Name = "strict"
+	strict.DeclineThreshold = 0.3
+	strict.ReviewThreshold = 0.1
+
+	past := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	records := []audit.Record{
+		{Transaction: detector.Transaction{ID: "LOW", AccountID: "A1", Amount: 20, Timestamp: past}, Decision: decision.Approve},
+		{Transaction: detector.Transaction{ID: "HIGH", AccountID: "A2", Amount: 60000, Type: "WIRE_TRANSFER", Timestamp: past}, Decision: decision.Review},
+	}
+
+	report := decision.Diff(records, current.Name, scorerFor(t, current), strict.Name, scorerFor(t, strict), 10)
+
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.Changed)
+	require.Len(t, report.Samples, 1)
+	assert.Equal(t, "HIGH", report.Samples[0].TransactionID)
+	assert.Equal(t, decision.Decline, report.Samples[0].Candidate.Decision)
+	assert.Equal(t, decision.Review, report.Samples[0].Recorded)
+}
+
+func TestScorer_ScoreBatch(t *testing.T) {
+	past := time.Now().Add(-48 * time.Hour)
+	txs := func() []*detector.Transaction {
+		return []*detector.Transaction{
+			{ID: "TXN-1", AccountID: "ACC-1", Amount: 42.17, Timestamp: past},
+			{ID: "TXN-2", AccountID: "ACC-2", Amount: 60000, Timestamp: past, Location: detector.Location{Country: "NG"}},
+			{ID: "TXN-3", AccountID: "ACC-1", Amount: 12000, Timestamp: past, Type: "cash_advance"},
+		}
+	}
+
+	batch, err := scorerFor(t, decision.DefaultConfiguration()).ScoreBatch(txs())
+	require.NoError(t, err)
+	require.Len(t, batch, 3)
+
+	single := scorerFor(t, decision.DefaultConfiguration())
+	for i, tx := range txs() {
+		outcome, err := single.Score(tx)
+		require.NoError(t, err)
+		assert.Equal(t, outcome.MLScore, batch[i].MLScore, tx.ID)
+		assert.Equal(t, outcome.FinalScore, batch[i].FinalScore, tx.ID)
+		assert.Equal(t, outcome.Decision, batch[i].Decision, tx.ID)
+	}
+}
+
+func BenchmarkScorer_ScoreBatch(b *testing.B) {
+	config := decision.DefaultConfiguration()
+	detectorConfig, err := config.DetectorConfig()
+	require.NoError(b, err)
+	scorer := decision.NewScorer(detector.NewFraudDetectorWithConfig(detectorConfig), ml.NewMLEngine(), config.Policy())
+
+	batch := make([]*detector.Transaction, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range batch {
+			batch[j] = &detector.Transaction{
+				ID:        fmt.Sprintf("TXN-%d-%d", i, j),
+				AccountID: fmt.Sprintf("ACC-%d", j%200),
+				Amount:    float64(20 + j%400),
+				Timestamp: time.Now(),
+			}
+		}
+		if _, err := scorer.ScoreBatch(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScorer_ConfidenceGating(t *testing.T) {
+	past := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	tx := func() *detector.Transaction {
+		return &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 60000, Timestamp: past, Location: detector.Location{Country: "NG"}}
+	}
+	config := decision.DefaultConfiguration()
+	config.DeclineThreshold = 0.55
+
+	blended, err := scorerFor(t, config).Score(tx())
+	require.NoError(t, err)
+	require.Greater(t, blended.MLScore, blended.Detection.Score)
+	assert.Equal(t, decision.Decline, blended.Decision, "the blended score declines")
+	assert.False(t, blended.ConfidenceGated)
+
+	config.MinConfidence = 0.99
+	require.NoError(t, config.Validate())
+	gated, err := scorerFor(t, config).Score(tx())
+	require.NoError(t, err)
+	assert.True(t, gated.ConfidenceGated)
+	assert.Equal(t, gated.Detection.Score, gated.FinalScore, "the rules decide alone")
+	assert.Equal(t, decision.Review, gated.Decision, "rules alone approve, so the borderline case goes to review")
+
+	clean, err := scorerFor(t, config).Score(&detector.Transaction{ID: "TXN-2", AccountID: "ACC-2", Amount: 20, Timestamp: past})
+	require.NoError(t, err)
+	assert.Equal(t, decision.Approve, clean.Decision)
+
+	preScored, err := scorerFor(t, config).PreScore(tx())
+	require.NoError(t, err)
+	assert.False(t, preScored.ConfidenceGated, "pre-scores have no ML score to gate")
+
+	config.MinConfidence = 1.5
+	assert.Error(t, config.Validate())
+}
+
+func TestScorer_PreScore(t *testing.T) {
+	scorer := scorerFor(t, decision.DefaultConfiguration())
+	tx := &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 60000, Timestamp: time.Now(), Location: detector.Location{Country: "NG"}}
+
+	outcome, err := scorer.PreScore(tx)
+	require.NoError(t, err)
+	assert.Zero(t, outcome.MLScore, "the ML model is not consulted")
+	assert.Equal(t, outcome.Detection.Score, outcome.FinalScore)
+	assert.Equal(t, scorer.Policy().Decide(outcome.FinalScore, outcome.Detection), outcome.Decision)
+	assert.Contains(t, outcome.Detection.ReasonCodes, "HIGH_AMOUNT")
+}
+
+func TestScorer_SetPolicy(t *testing.T) {
+	scorer := scorerFor(t, decision.DefaultConfiguration())
+	tx := &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 60000, Timestamp: time.Now(), Location: detector.Location{Country: "NG"}}
+
+	scorer.SetPolicy(decision.Policy{DeclineThreshold: 0.02, ReviewThreshold: 0.01})
+	outcome, err := scorer.PreScore(tx)
+	require.NoError(t, err)
+	assert.Equal(t, decision.Decline, outcome.Decision)
+}
+
+func TestRegistry_SetCurrent(t *testing.T) {
+	registry := decision.NewRegistry(decision.DefaultConfiguration())
+	config := decision.DefaultConfiguration()
+	config.Name = "ignored"
+	config.ReviewThreshold = 0.4
+	require.NoError(t, registry.SetCurrent(config))
+
+	current, err := registry.Get(decision.CurrentConfiguration)
+	require.NoError(t, err)
+	assert.Equal(t, 0.4, current.ReviewThreshold)
+
+	config.ReviewThreshold = 0.9
+	assert.Error(t, registry.SetCurrent(config))
+}
+
+func TestScorer_Revalidate(t *testing.T) {
+	scorer := scorerFor(t, decision.DefaultConfiguration())
+	tx := &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 60000, Timestamp: time.Now(), Location: detector.Location{Country: "NG"}}
+
+	outcome, err := scorer.Revalidate(tx, decision.Approve)
+	require.NoError(t, err)
+	assert.Zero(t, outcome.MLScore, "the ML model is not consulted")
+	assert.Equal(t, scorer.Policy().Decide(outcome.FinalScore, outcome.Detection), outcome.Decision)
+	assert.Contains(t, outcome.Detection.ReasonCodes, "HIGH_AMOUNT")
+
+	scorer.SetPolicy(decision.Policy{DeclineThreshold: 0.02, ReviewThreshold: 0.01})
+	outcome, err = scorer.Revalidate(tx, decision.Approve)
+	require.NoError(t, err)
+	assert.Equal(t, decision.Decline, outcome.Decision, "stricter after revalidation")
+
+	scorer.SetPolicy(decision.Policy{DeclineThreshold: 1, ReviewThreshold: 1})
+	outcome, err = scorer.Revalidate(tx, decision.Review)
+	require.NoError(t, err)
+	assert.Equal(t, decision.Review, outcome.Decision, "never more lenient than the decision")
+}
+
+func TestScorer_Splits(t *testing.T) {
+	scorer := scorerFor(t, decision.DefaultConfiguration())
+	registry := detector.NewMerchantRegistry()
+	registry.Set(detector.MerchantProfile{MerchantID: "SELLER-SHADY", RiskTier: "high"})
+	scorer.Detector().SetMerchantRegistry(registry)
+	require.NoError(t, scorer.Detector().AddExpressionRule(detector.Rule{
+		ID: "HIGH_RISK_SELLER", Expression: "tx.merchant_risk_tier == 'high'", Score: 0.6,
+	}))
+
+	tx := &detector.Transaction{
+		ID: "TXN-SPLIT", AccountID: "ACC-1", Amount: 100, MerchantID: "MARKETPLACE", Timestamp: time.Now().Add(-48 * time.Hour),
+		Splits: []detector.Split{{MerchantID: "SELLER-OK", Amount: 70}, {MerchantID: "SELLER-SHADY", Amount: 30}},
+	}
+	outcome, err := scorer.Score(tx)
+	require.NoError(t, err)
+	require.Len(t, outcome.Splits, 2)
+	assert.Equal(t, decision.Approve, outcome.Splits[0].Decision)
+	assert.Equal(t, decision.Review, outcome.Splits[1].Decision)
+	assert.Less(t, outcome.FinalScore, 0.5)
+	assert.Equal(t, decision.Review, outcome.Decision, "the payment is decided no more leniently than its legs")
+}
+
+func TestSandbox(t *testing.T) {
+	sandbox := decision.NewSandbox(7)
+	tx := func(id string, amount float64) *detector.Transaction {
+		return &detector.Transaction{ID: id, AccountID: "ACC-1", Amount: amount, Timestamp: time.Now()}
+	}
+
+	for amount, expected := range map[float64]string{
+		6666: decision.Decline,
+		5555: decision.Review,
+		4444: decision.SoftDecline,
+		3333: decision.SoftDecline,
+		25:   decision.Approve,
+		9000: decision.Approve,
+	} {
+		outcome := sandbox.Score(tx("TXN-1", amount))
+		assert.Equal(t, expected, outcome.Decision, "amount %v", amount)
+		if expected != decision.Approve {
+			assert.Equal(t, []string{decision.ReasonSandbox}, outcome.Detection.ReasonCodes)
+		}
+	}
+	assert.Equal(t, decision.RetryWith3DS, sandbox.Score(tx("TXN-1", 4444)).Retry)
+	assert.Equal(t, decision.RetryAfterStepUp, sandbox.Score(tx("TXN-1", 3333)).Retry)
+
+	first := sandbox.Score(tx("TXN-2", 120))
+	assert.Equal(t, first.FinalScore, decision.NewSandbox(7).Score(tx("TXN-2", 120)).FinalScore, "the same request scores the same")
+	assert.Less(t, first.FinalScore, 0.2)
+	assert.NotEqual(t, first.FinalScore, decision.NewSandbox(8).Score(tx("TXN-2", 120)).FinalScore, "the seed varies the score")
+}
+
+func TestScorer_Counterfactual(t *testing.T) {
+	scorer := scorerFor(t, decision.DefaultConfiguration())
+	scorer.SetPolicy(decision.Policy{DeclineThreshold: 0.35, ReviewThreshold: 0.05})
+	tx := &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 60000, Timestamp: time.Now(), Location: detector.Location{Country: "NG"}}
+
+	outcome, err := scorer.PreScore(tx)
+	require.NoError(t, err)
+	require.Equal(t, decision.Decline, outcome.Decision)
+	assert.Equal(t, []detector.Contribution{
+		{Component: detector.ComponentRule + "HIGH_AMOUNT", Score: 0.3},
+		{Component: detector.ComponentPatterns, Score: 0.1},
+	}, outcome.Detection.Contributions)
+
+	counterfactual := scorer.Counterfactual(tx, outcome)
+	require.NotNil(t, counterfactual)
+	assert.Equal(t, []string{"rule:HIGH_AMOUNT"}, counterfactual.Without, "the largest contribution alone flips the decision")
+	assert.Equal(t, decision.Review, counterfactual.Decision)
+	assert.InDelta(t, 0.1, counterfactual.Score, 1e-9)
+	assert.Equal(t, 0.35, counterfactual.Threshold)
+	assert.Equal(t, "score without rule:HIGH_AMOUNT = 0.10 < decline threshold 0.35", counterfactual.Hint)
+
+	scorer.SetPolicy(decision.Policy{DeclineThreshold: 0.8, ReviewThreshold: 0.02})
+	outcome, err = scorer.PreScore(tx)
+	require.NoError(t, err)
+	counterfactual = scorer.Counterfactual(tx, outcome)
+	require.NotNil(t, counterfactual)
+	assert.Equal(t, []string{"rule:HIGH_AMOUNT", "patterns"}, counterfactual.Without)
+	assert.Equal(t, decision.Approve, counterfactual.Decision)
+
+	scorer.SetPolicy(decision.DefaultPolicy())
+	outcome, err = scorer.PreScore(tx)
+	require.NoError(t, err)
+	require.Equal(t, decision.Approve, outcome.Decision)
+	assert.Nil(t, scorer.Counterfactual(tx, outcome), "approvals have nothing to flip")
+
+	// The ML score lowers the blended score most when removed
+	scorer.SetPolicy(decision.Policy{DeclineThreshold: 0.9, ReviewThreshold: 0.3})
+	outcome, err = scorer.Score(tx)
+	require.NoError(t, err)
+	require.Equal(t, decision.Review, outcome.Decision)
+	require.Greater(t, outcome.MLScore, outcome.Detection.Score)
+	counterfactual = scorer.Counterfactual(tx, outcome)
+	require.NotNil(t, counterfactual)
+	assert.Equal(t, decision.ComponentModel, counterfactual.Without[0])
+	assert.Equal(t, decision.Approve, counterfactual.Decision)
+	assert.Less(t, counterfactual.Score, 0.3)
+
+	outcome.Detection.Blocked = true
+	outcome.Decision = decision.Decline
+	assert.Nil(t, scorer.Counterfactual(tx, outcome), "hard blocks decline whatever the score")
+}
@@ -0,0 +1,89 @@
+package decision
+
+import (
+	"sort"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+)
+
+// DiffReport summarizes how decisions change between two configurations
+type DiffReport struct {
+	Baseline    string         `json:"baseline"`
+	Candidate   string         `json:"candidate"`
+	Total       int            `json:"total"`
+	Changed     int            `json:"changed"`
+	Errors      int            `json:"errors"`
+	Transitions map[string]int `json:"transitions"`
+	Samples     []DiffSample   `json:"samples"`
+}
+
+// DiffSample is a transaction whose decision changed
+type DiffSample struct {
+	TransactionID string   `json:"transaction_id"`
+	Transition    string   `json:"transition"`
+	Recorded      string   `json:"recorded_decision"`
+	Baseline      Decision `json:"baseline"`
+	Candidate     Decision `json:"candidate"`
+}
+
+// Decision is a decision with its score and reasons
+type Decision struct {
+	Decision  string   `json:"decision"`
+	RiskScore float64  `json:"risk_score"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+// Diff replays the records, oldest first, through fresh baseline and
+// candidate scorers and reports changed decisions, keeping up to sampleLimit
+// samples per transition. Both scorers must start from empty state so that
+// velocity and geo history are rebuilt identically.
+func Diff(records []audit.Record, baselineName string, baseline *Scorer, candidateName string, candidate *Scorer, sampleLimit int) DiffReport {
+	report := DiffReport{
+		Baseline:    baselineName,
+		Candidate:   candidateName,
+		Transitions: map[string]int{},
+		Samples:     []DiffSample{},
+	}
+	sampled := map[string]int{}
+
+	for _, record := range records {
+		report.Total++
+
+		// Each scorer gets its own copy since analysis may enrich it
+		baseTx, candTx := record.Transaction, record.Transaction
+		base, err := baseline.Score(&baseTx)
+		if err != nil {
+			report.Errors++
+			continue
+		}
+		cand, err := candidate.Score(&candTx)
+		if err != nil {
+			report.Errors++
+			continue
+		}
+
+		if base.Decision == cand.Decision {
+			continue
+		}
+
+		transition := base.Decision + "->" + cand.Decision
+		report.Changed++
+		report.Transitions[transition]++
+
+		if sampled[transition] < sampleLimit {
+			sampled[transition]++
+			report.Samples = append(report.Samples, DiffSample{
+				TransactionID: record.Transaction.ID,
+				Transition:    transition,
+				Recorded:      record.Decision,
+				Baseline:      Decision{base.Decision, base.FinalScore, base.Detection.Reasons},
+				Candidate:     Decision{cand.Decision, cand.FinalScore, cand.Detection.Reasons},
+			})
+		}
+	}
+
+	sort.SliceStable(report.Samples, func(i, j int) bool {
+		return report.Samples[i].Transition < report.Samples[j].Transition
+	})
+	return report
+}
@@ -0,0 +1,112 @@
+// Package decision turns detector and ML scores into APPROVE, REVIEW,
+// SOFT_DECLINE or DECLINE decisions.
+package decision
+
+import (
+	"fmt"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Decisions returned by the engine. A SOFT_DECLINE comes with retry guidance:
+// the issuer may approve a retry with stronger authentication.
+const (
+	Approve     = "APPROVE"
+	Review      = "REVIEW"
+	SoftDecline = "SOFT_DECLINE"
+	Decline     = "DECLINE"
+)
+
+// Retry guidance of soft declines
+const (
+	RetryWith3DS     = "retry_with_3ds"
+	RetryAfterStepUp = "retry_after_step_up"
+)
+
+// RetryRule gives the retry guidance of soft declines with any of its
+// reason codes
+type RetryRule struct {
+	ReasonCodes []string `json:"reason_codes" openapi:"required,minItems=1"`
+	Retry       string   `json:"retry" openapi:"required,enum=retry_with_3ds|retry_after_step_up"`
+}
+
+// ValidateRetryRules checks that every rule names reason codes and a known
+// retry guidance
+func ValidateRetryRules(rules []RetryRule) error {
+	for i, rule := range rules {
+		if len(rule.ReasonCodes) == 0 {
+			return fmt.Errorf("retry rule %d: reason codes are required", i)
+		}
+		if rule.Retry != RetryWith3DS && rule.Retry != RetryAfterStepUp {
+			return fmt.Errorf("retry rule %d: retry must be %s or %s, got %q", i, RetryWith3DS, RetryAfterStepUp, rule.Retry)
+		}
+	}
+	return nil
+}
+
+// Policy maps final risk scores to decisions
+type Policy struct {
+	DeclineThreshold float64
+	ReviewThreshold  float64
+	// SoftDeclineThreshold, when set, soft-declines the scores from it up to
+	// the decline threshold instead of reviewing them
+	SoftDeclineThreshold float64
+	// RetryRules pick the retry guidance of soft declines: the first rule
+	// naming one of their reason codes wins, and the others are retried
+	// with 3DS
+	RetryRules []RetryRule
+	// MinConfidence is the ML confidence below which the ML score has no
+	// say in the decision; zero always blends it in
+	MinConfidence float64
+}
+
+// DefaultPolicy returns the default decision thresholds
+func DefaultPolicy() Policy {
+	return Policy{
+		DeclineThreshold: 0.8,
+		ReviewThreshold:  0.5,
+	}
+}
+
+// Decide maps a final risk score to a decision. Hard blocks always decline
+// and findings that require an analyst escalate an approval to REVIEW.
+// Trusted customers are approved below the decline threshold unless a
+// finding requires an analyst.
+func (p Policy) Decide(finalScore float64, result *detector.FraudScore) string {
+	switch {
+	case finalScore >= p.DeclineThreshold || result.Blocked:
+		return Decline
+	case p.SoftDeclineThreshold > 0 && finalScore >= p.SoftDeclineThreshold && !result.Trusted:
+		return SoftDecline
+	case finalScore >= p.ReviewThreshold && !result.Trusted || result.RequiresReview:
+		return Review
+	default:
+		return Approve
+	}
+}
+
+// Retry returns the retry guidance of a soft decline with the reason codes
+// of result
+func (p Policy) Retry(result *detector.FraudScore) string {
+	for _, rule := range p.RetryRules {
+		for _, code := range rule.ReasonCodes {
+			for _, reason := range result.ReasonCodes {
+				if code == reason {
+					return rule.Retry
+				}
+			}
+		}
+	}
+	return RetryWith3DS
+}
+
+// severity orders decisions from the most lenient to the strictest
+var severity = map[string]int{Approve: 0, Review: 1, SoftDecline: 2, Decline: 3}
+
+// stricter returns the stricter of two decisions
+func stricter(a, b string) string {
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
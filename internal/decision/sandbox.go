@@ -0,0 +1,95 @@
+package decision
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// ReasonSandbox is reported for the decisions a sandbox magic amount forces
+const ReasonSandbox = "SANDBOX_MAGIC_AMOUNT"
+
+// sandboxOutcome is the outcome a magic amount forces
+type sandboxOutcome struct {
+	decision string
+	score    float64
+	retry    string
+}
+
+// sandboxAmounts are the magic amounts the sandbox always decides the same
+// way
+var sandboxAmounts = map[float64]sandboxOutcome{
+	6666: {decision: Decline, score: 0.95},
+	5555: {decision: Review, score: 0.6},
+	4444: {decision: SoftDecline, score: 0.7, retry: RetryWith3DS},
+	3333: {decision: SoftDecline, score: 0.7, retry: RetryAfterStepUp},
+}
+
+// sandboxMaxScore bounds the scores of other amounts, which are approved
+const sandboxMaxScore = 0.2
+
+// Sandbox scores transactions for integration tests without rules, models or
+// state: magic amounts force a decision and every other amount is approved
+// with a score derived from the seed and the transaction, so the same request
+// always gets the same response
+type Sandbox struct {
+	seed uint64
+}
+
+func NewSandbox(seed uint64) *Sandbox {
+	return &Sandbox{seed: seed}
+}
+
+// Score decides a transaction as the sandbox does
+func (s *Sandbox) Score(tx *detector.Transaction) *Outcome {
+	outcome := &Outcome{Decision: Approve, Confidence: 1, DecidedAt: time.Now()}
+	detection := &detector.FraudScore{Reasons: []string{}, Confidence: 1, Timestamp: tx.Timestamp}
+
+	if forced, magic := sandboxAmounts[tx.Amount]; magic {
+		outcome.Decision = forced.decision
+		outcome.Retry = forced.retry
+		outcome.FinalScore = forced.score
+		detection.Reasons = []string{"Sandbox magic amount"}
+		detection.ReasonCodes = []string{ReasonSandbox}
+		detection.ShouldBlock = forced.decision == Decline
+		detection.RequiresReview = forced.decision == Review
+	} else {
+		outcome.FinalScore = s.score(tx)
+	}
+
+	detection.Score = outcome.FinalScore
+	detection.Risk = sandboxRisk(outcome.Decision)
+	outcome.Detection = detection
+	outcome.MLScore = outcome.FinalScore
+	return outcome
+}
+
+// score hashes the seed and the identity of a transaction into [0,
+// sandboxMaxScore)
+func (s *Sandbox) score(tx *detector.Transaction) float64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], s.seed)
+	h.Write(buf[:])
+	h.Write([]byte(tx.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(tx.AccountID))
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(tx.Amount))
+	h.Write(buf[:])
+
+	fraction := float64(h.Sum64()>>11) / (1 << 53)
+	return math.Round(fraction*sandboxMaxScore*1e4) / 1e4
+}
+
+func sandboxRisk(decision string) string {
+	switch decision {
+	case Decline:
+		return "CRITICAL"
+	case Review, SoftDecline:
+		return "HIGH"
+	}
+	return "MINIMAL"
+}
@@ -0,0 +1,292 @@
+package decision
+
+import (
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+)
+
+// Scorer runs the full scoring pipeline: rule-based detection, ML prediction,
+// score blending and the decision policy
+type Scorer struct {
+	detector *detector.FraudDetector
+	mlEngine *ml.MLEngine
+	policy   Policy
+	resolver PolicyResolver
+	mu       sync.RWMutex
+}
+
+// PolicyResolver returns the decision policy in effect for a merchant, given
+// the scorer's own policy
+type PolicyResolver interface {
+	Policy(merchantID string, base Policy) Policy
+}
+
+// Outcome is the result of scoring a transaction
+type Outcome struct {
+	Detection  *detector.FraudScore
+	MLScore    float64
+	Confidence float64
+	FinalScore float64
+	Decision   string
+	// Retry is the retry guidance of a SOFT_DECLINE
+	Retry     string
+	DecidedAt time.Time
+	// FeatureTier is the ML feature tier used, empty when the ML prediction
+	// failed or was not made
+	FeatureTier string
+	// MLError is set when the ML prediction failed and the rule score was
+	// used in its place
+	MLError error
+	// Splits are the decisions on the legs of a split payment
+	Splits []SplitOutcome
+	// ConfidenceGated is set when the ML confidence was below the policy's
+	// floor, so the final score is the rule score alone
+	ConfidenceGated bool
+	// Explanation attributes the ML score to the model features, when the
+	// model explains its prediction
+	Explanation *ml.Explanation
+	// blended is set when the final score blends the ML score into the
+	// detection score
+	blended bool
+}
+
+// SplitOutcome is the decision on one leg of a split payment, made on its
+// detection score under the policy of its sub-merchant
+type SplitOutcome struct {
+	MerchantID string
+	Amount     float64
+	Detection  *detector.FraudScore
+	Decision   string
+}
+
+// NewScorer creates a scorer from its components
+func NewScorer(fraudDetector *detector.FraudDetector, mlEngine *ml.MLEngine, policy Policy) *Scorer {
+	return &Scorer{
+		detector: fraudDetector,
+		mlEngine: mlEngine,
+		policy:   policy,
+	}
+}
+
+// Detector returns the scorer's fraud detector
+func (s *Scorer) Detector() *detector.FraudDetector {
+	return s.detector
+}
+
+// Policy returns the scorer's decision policy
+func (s *Scorer) Policy() Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// SetPolicy replaces the scorer's decision policy
+func (s *Scorer) SetPolicy(policy Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+// SetPolicyResolver sets the source of per-merchant decision policies
+func (s *Scorer) SetPolicyResolver(resolver PolicyResolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolver = resolver
+}
+
+// PolicyFor returns the decision policy in effect for a merchant
+func (s *Scorer) PolicyFor(merchantID string) Policy {
+	s.mu.RLock()
+	policy, resolver := s.policy, s.resolver
+	s.mu.RUnlock()
+	if resolver == nil {
+		return policy
+	}
+	return resolver.Policy(merchantID, policy)
+}
+
+// decide applies the decision policy in effect for a transaction to an
+// outcome, made no more lenient than previous when set. A split payment is
+// decided no more leniently than any of its legs.
+func (s *Scorer) decide(tx *detector.Transaction, outcome *Outcome, previous string) {
+	policy := s.PolicyFor(tx.MerchantID)
+	outcome.Decision = policy.Decide(outcome.FinalScore, outcome.Detection)
+	if outcome.FeatureTier != "" && outcome.Confidence < policy.MinConfidence {
+		// A low-confidence ML score has no say: the rules decide alone, and
+		// the borderline cases the ML score would have decided otherwise go
+		// to review
+		blended := outcome.Decision
+		outcome.FinalScore = outcome.Detection.Score
+		outcome.ConfidenceGated = true
+		outcome.Decision = policy.Decide(outcome.FinalScore, outcome.Detection)
+		if outcome.Decision == Approve && blended != Approve {
+			outcome.Decision = Review
+		}
+	}
+	outcome.Splits = nil
+	for _, leg := range outcome.Detection.Splits {
+		decision := s.PolicyFor(leg.MerchantID).Decide(leg.Detection.Score, leg.Detection)
+		outcome.Splits = append(outcome.Splits, SplitOutcome{
+			MerchantID: leg.MerchantID,
+			Amount:     leg.Amount,
+			Detection:  leg.Detection,
+			Decision:   decision,
+		})
+		outcome.Decision = stricter(outcome.Decision, decision)
+	}
+	if previous != "" {
+		outcome.Decision = stricter(previous, outcome.Decision)
+	}
+	if outcome.Decision == SoftDecline {
+		outcome.Retry = policy.Retry(outcome.Detection)
+	}
+}
+
+// Score analyzes a transaction and decides on it
+func (s *Scorer) Score(tx *detector.Transaction) (*Outcome, error) {
+	result, err := s.detector.AnalyzeTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &Outcome{Detection: result, DecidedAt: time.Now()}
+
+	prediction, err := s.mlEngine.Predict(tx)
+	mlScore, confidence := prediction.Score, prediction.Confidence
+	if err != nil {
+		outcome.MLError = err
+		mlScore = result.Score // Fallback to rule-based score
+		confidence = 0.5
+	}
+	outcome.blended = err == nil
+	outcome.FeatureTier = prediction.Tier
+	outcome.Explanation = prediction.Explanation
+
+	// Combine rule-based and ML scores
+	outcome.MLScore = mlScore
+	outcome.Confidence = confidence
+	outcome.FinalScore = (result.Score + mlScore) / 2
+	s.decide(tx, outcome, "")
+
+	return outcome, nil
+}
+
+// PreScore decides on the fast pre-authorization score of a transaction. The
+// ML model is not consulted and per-account state is not updated, so Score
+// must still run on the transaction.
+func (s *Scorer) PreScore(tx *detector.Transaction) (*Outcome, error) {
+	result, err := s.detector.PreScoreTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &Outcome{
+		Detection:  result,
+		Confidence: 0.5,
+		FinalScore: result.Score,
+		DecidedAt:  time.Now(),
+	}
+	s.decide(tx, outcome, "")
+	return outcome, nil
+}
+
+// Revalidate re-checks a transaction decided earlier, whose decision was
+// previous, before it is captured. Only the quick checks run, so the
+// decision can become stricter but never more lenient than previous.
+func (s *Scorer) Revalidate(tx *detector.Transaction, previous string) (*Outcome, error) {
+	result, err := s.detector.RevalidateTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &Outcome{
+		Detection:  result,
+		Confidence: 0.5,
+		FinalScore: result.Score,
+		DecidedAt:  time.Now(),
+	}
+	s.decide(tx, outcome, previous)
+	return outcome, nil
+}
+
+// ScoreBatch analyzes and decides on a batch of transactions. Detection runs
+// on up to GOMAXPROCS workers, each account's transactions on the same worker
+// in input order, since detection updates per-account state. The ML model
+// scores the whole batch in one call.
+func (s *Scorer) ScoreBatch(txs []*detector.Transaction) ([]*Outcome, error) {
+	outcomes, err := s.analyzeBatch(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	predictions, mlErr := s.mlEngine.PredictBatch(txs)
+	for i, outcome := range outcomes {
+		mlScore, confidence := outcome.Detection.Score, 0.5 // Fallback to rule-based score
+		if mlErr != nil {
+			outcome.MLError = mlErr
+		} else {
+			mlScore, confidence = predictions[i].Score, predictions[i].Confidence
+			outcome.FeatureTier = predictions[i].Tier
+			outcome.Explanation = predictions[i].Explanation
+			outcome.blended = true
+		}
+
+		outcome.MLScore = mlScore
+		outcome.Confidence = confidence
+		outcome.FinalScore = (outcome.Detection.Score + mlScore) / 2
+		s.decide(txs[i], outcome, "")
+	}
+
+	return outcomes, nil
+}
+
+// analyzeBatch runs detection on a batch, sharding the transactions by
+// account across the workers. It returns the first error in input order.
+func (s *Scorer) analyzeBatch(txs []*detector.Transaction) ([]*Outcome, error) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	shards := make([][]int, workers)
+	for i, tx := range txs {
+		shard := 0
+		if workers > 1 {
+			h := fnv.New32a()
+			h.Write([]byte(tx.AccountID))
+			shard = int(h.Sum32() % uint32(workers))
+		}
+		shards[shard] = append(shards[shard], i)
+	}
+
+	outcomes := make([]*Outcome, len(txs))
+	errs := make([]error, len(txs))
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(indices []int) {
+			defer wg.Done()
+			for _, i := range indices {
+				result, err := s.detector.AnalyzeTransaction(txs[i])
+				if err != nil {
+					errs[i] = fmt.Errorf("transaction %s analysis failed: %w", txs[i].ID, err)
+					return
+				}
+				outcomes[i] = &Outcome{Detection: result, DecidedAt: time.Now()}
+			}
+		}(shard)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outcomes, nil
+}
@@ -0,0 +1,155 @@
+package detector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DormancyConfig holds account dormancy and new account settings
+type DormancyConfig struct {
+	DormantAfter     time.Duration
+	DormantAmount    float64
+	NewAccountAge    time.Duration
+	NewAccountAmount float64
+}
+
+// DefaultDormancyConfig returns the default dormancy settings
+func DefaultDormancyConfig() DormancyConfig {
+	return DormancyConfig{
+		DormantAfter:     180 * 24 * time.Hour,
+		DormantAmount:    5000,
+		NewAccountAge:    24 * time.Hour,
+		NewAccountAmount: 2000,
+	}
+}
+
+func (c DormancyConfig) withDefaults() DormancyConfig {
+	defaults := DefaultDormancyConfig()
+	if c.DormantAfter <= 0 {
+		c.DormantAfter = defaults.DormantAfter
+	}
+	if c.DormantAmount <= 0 {
+		c.DormantAmount = defaults.DormantAmount
+	}
+	if c.NewAccountAge <= 0 {
+		c.NewAccountAge = defaults.NewAccountAge
+	}
+	if c.NewAccountAmount <= 0 {
+		c.NewAccountAmount = defaults.NewAccountAmount
+	}
+	return c
+}
+
+// Account activity reason codes
+const (
+	ReasonDormantReactivation = "DORMANT_REACTIVATION"
+	ReasonNewAccountHighValue = "NEW_ACCOUNT_HIGH_AMOUNT"
+)
+
+// ActivityTracker tracks first and last activity per account
+type ActivityTracker struct {
+	config   DormancyConfig
+	accounts map[string]*accountActivity
+	started  time.Time
+	mu       sync.Mutex
+}
+
+type accountActivity struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// ActivityResult is the outcome of the dormancy and new account checks
+type ActivityResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+func NewActivityTracker(config DormancyConfig) *ActivityTracker {
+	return &ActivityTracker{
+		config:   config.withDefaults(),
+		accounts: make(map[string]*accountActivity),
+		started:  SystemClock().Now(),
+	}
+}
+
+// setClock starts the tracker running at the time of a clock, so replays
+// hold back first-seen account ages from the time they replay
+func (a *ActivityTracker) setClock(clock Clock) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.started = clock.Now()
+}
+
+// LastSeen returns the last activity time of an account
+func (a *ActivityTracker) LastSeen(accountID string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	acc, exists := a.accounts[accountID]
+	if !exists {
+		return time.Time{}, false
+	}
+	return acc.lastSeen, true
+}
+
+// Check evaluates the transaction against the account's previous activity
+// and then records it
+func (a *ActivityTracker) Check(tx *Transaction) ActivityResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := ActivityResult{}
+	acc, exists := a.accounts[tx.AccountID]
+
+	if exists && tx.Amount >= a.config.DormantAmount {
+		idle := tx.Timestamp.Sub(acc.lastSeen)
+		if idle > a.config.DormantAfter {
+			result.Score += 0.4
+			result.Codes = append(result.Codes, ReasonDormantReactivation)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Dormant account reactivated with high-value transaction after %.0f days", idle.Hours()/24))
+		}
+	}
+
+	if tx.Amount >= a.config.NewAccountAmount {
+		if age, known := a.accountAge(tx, acc); known && age < a.config.NewAccountAge {
+			result.Score += 0.3
+			result.Codes = append(result.Codes, ReasonNewAccountHighValue)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("High amount from account created %.0f hours ago", age.Hours()))
+		}
+	}
+
+	if !exists {
+		acc = &accountActivity{firstSeen: tx.Timestamp, lastSeen: tx.Timestamp}
+		a.accounts[tx.AccountID] = acc
+	}
+	if tx.Timestamp.After(acc.lastSeen) {
+		acc.lastSeen = tx.Timestamp
+	}
+	if tx.Timestamp.Before(acc.firstSeen) {
+		acc.firstSeen = tx.Timestamp
+	}
+
+	return result
+}
+
+// accountAge prefers the account creation time sent by the client. The first
+// time the tracker saw the account only counts once the tracker has been
+// running for longer than the new account age, otherwise every account would
+// look new right after a restart.
+func (a *ActivityTracker) accountAge(tx *Transaction, acc *accountActivity) (time.Duration, bool) {
+	if !tx.AccountCreatedAt.IsZero() {
+		return tx.Timestamp.Sub(tx.AccountCreatedAt), true
+	}
+	if tx.Timestamp.Sub(a.started) < a.config.NewAccountAge {
+		return 0, false
+	}
+	if acc == nil {
+		return 0, true
+	}
+	return tx.Timestamp.Sub(acc.firstSeen), true
+}
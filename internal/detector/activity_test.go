@@ -0,0 +1,78 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityTracker_DormantReactivation(t *testing.T) {
+	tracker := detector.NewActivityTracker(detector.DormancyConfig{})
+	lastYear := time.Now().Add(-365 * 24 * time.Hour)
+
+	result := tracker.Check(&detector.Transaction{AccountID: "ACC-DORMANT", Amount: 50, Timestamp: lastYear})
+	assert.Empty(t, result.Codes)
+
+	lastSeen, known := tracker.LastSeen("ACC-DORMANT")
+	assert.True(t, known)
+	assert.Equal(t, lastYear, lastSeen)
+
+	t.Run("Small amount is ignored", func(t *testing.T) {
+		tracker := detector.NewActivityTracker(detector.DormancyConfig{})
+		tracker.Check(&detector.Transaction{AccountID: "ACC-1", Amount: 50, Timestamp: lastYear})
+		result := tracker.Check(&detector.Transaction{AccountID: "ACC-1", Amount: 20, Timestamp: time.Now()})
+		assert.Empty(t, result.Codes)
+	})
+
+	result = tracker.Check(&detector.Transaction{AccountID: "ACC-DORMANT", Amount: 9000, Timestamp: time.Now()})
+	assert.Contains(t, result.Codes, detector.ReasonDormantReactivation)
+
+	// The account is active again
+	result = tracker.Check(&detector.Transaction{AccountID: "ACC-DORMANT", Amount: 9000, Timestamp: time.Now()})
+	assert.NotContains(t, result.Codes, detector.ReasonDormantReactivation)
+}
+
+func TestActivityTracker_NewAccountHighAmount(t *testing.T) {
+	tracker := detector.NewActivityTracker(detector.DormancyConfig{})
+	now := time.Now()
+
+	result := tracker.Check(&detector.Transaction{
+		AccountID:        "ACC-NEW",
+		Amount:           2500,
+		Timestamp:        now,
+		AccountCreatedAt: now.Add(-2 * time.Hour),
+	})
+	assert.Contains(t, result.Codes, detector.ReasonNewAccountHighValue)
+
+	result = tracker.Check(&detector.Transaction{
+		AccountID:        "ACC-OLD",
+		Amount:           2500,
+		Timestamp:        now,
+		AccountCreatedAt: now.Add(-30 * 24 * time.Hour),
+	})
+	assert.Empty(t, result.Codes)
+
+	// Without a creation time, a freshly started tracker cannot tell
+	result = tracker.Check(&detector.Transaction{AccountID: "ACC-UNKNOWN", Amount: 2500, Timestamp: now})
+	assert.Empty(t, result.Codes)
+}
+
+func TestDetector_Analyze_NewAccountRequiresReview(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	now := time.Now()
+
+	score, err := d.Analyze(context.Background(), &detector.Transaction{
+		ID:               "TXN-NEW",
+		AccountID:        "ACC-NEW",
+		Amount:           3000.50,
+		Timestamp:        now,
+		AccountCreatedAt: now.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+	assert.True(t, score.RequiresReview)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonNewAccountHighValue)
+}
@@ -0,0 +1,252 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Address is a billing or shipping address. Coordinates, when the client
+// geocodes the address, give the distance between addresses.
+type Address struct {
+	Line1      string  `json:"line1,omitempty"`
+	Line2      string  `json:"line2,omitempty"`
+	City       string  `json:"city,omitempty"`
+	PostalCode string  `json:"postal_code,omitempty"`
+	Country    string  `json:"country,omitempty"`
+	Latitude   float64 `json:"latitude,omitempty"`
+	Longitude  float64 `json:"longitude,omitempty"`
+}
+
+func (a *Address) geocoded() bool {
+	return a != nil && (a.Latitude != 0 || a.Longitude != 0)
+}
+
+func (a *Address) country() string {
+	if a == nil {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(a.Country))
+}
+
+// AddressConfig holds billing and shipping address settings. Shipping more
+// than DistanceKm from the billing address adds DistanceScore; both must be
+// geocoded.
+type AddressConfig struct {
+	CountryMismatchScore float64
+	DistanceKm           float64
+	DistanceScore        float64
+	ForwarderScore       float64
+}
+
+// DefaultAddressConfig returns the default address settings
+func DefaultAddressConfig() AddressConfig {
+	return AddressConfig{
+		CountryMismatchScore: 0.2,
+		DistanceKm:           500,
+		DistanceScore:        0.1,
+		ForwarderScore:       0.3,
+	}
+}
+
+func (c AddressConfig) withDefaults() AddressConfig {
+	defaults := DefaultAddressConfig()
+	if c.CountryMismatchScore <= 0 {
+		c.CountryMismatchScore = defaults.CountryMismatchScore
+	}
+	if c.DistanceKm <= 0 {
+		c.DistanceKm = defaults.DistanceKm
+	}
+	if c.DistanceScore <= 0 {
+		c.DistanceScore = defaults.DistanceScore
+	}
+	if c.ForwarderScore <= 0 {
+		c.ForwarderScore = defaults.ForwarderScore
+	}
+	return c
+}
+
+// Address reason codes. Layers switch them off like rules.
+const (
+	ReasonAddressCountryMismatch = "ADDRESS_COUNTRY_MISMATCH"
+	ReasonAddressDistance        = "ADDRESS_DISTANCE"
+	ReasonAddressForwarder       = "ADDRESS_FREIGHT_FORWARDER"
+)
+
+// AddressFeatures compare the billing and shipping addresses of a
+// transaction. Unknown countries never count as a mismatch.
+type AddressFeatures struct {
+	BillingCountry  string
+	ShippingCountry string
+	CountryMismatch bool
+	// DistanceKm is the distance between the addresses, -1 unless both are
+	// geocoded
+	DistanceKm float64
+	// Forwarder is the freight forwarder the goods are shipped to, empty
+	// when the shipping address is not a listed one
+	Forwarder string
+}
+
+// ExtractAddressFeatures compares the billing and shipping addresses
+func ExtractAddressFeatures(tx *Transaction) AddressFeatures {
+	f := AddressFeatures{
+		BillingCountry:  tx.BillingAddress.country(),
+		ShippingCountry: tx.ShippingAddress.country(),
+		DistanceKm:      -1,
+		Forwarder:       tx.ShippingForwarder,
+	}
+	f.CountryMismatch = f.BillingCountry != "" && f.ShippingCountry != "" && f.BillingCountry != f.ShippingCountry
+	if tx.BillingAddress.geocoded() && tx.ShippingAddress.geocoded() {
+		f.DistanceKm = distanceKm(
+			Location{Latitude: tx.BillingAddress.Latitude, Longitude: tx.BillingAddress.Longitude},
+			Location{Latitude: tx.ShippingAddress.Latitude, Longitude: tx.ShippingAddress.Longitude})
+	}
+	return f
+}
+
+// AddressResult is the outcome of the address checks
+type AddressResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+func checkAddresses(config AddressConfig, tx *Transaction) AddressResult {
+	result := AddressResult{}
+	if tx.ShippingAddress == nil {
+		return result
+	}
+	f := ExtractAddressFeatures(tx)
+	add := func(code string, score float64, reason string) {
+		if tx.overrides.ruleDisabled(code) {
+			return
+		}
+		result.Score += score
+		result.Codes = append(result.Codes, code)
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	if f.CountryMismatch {
+		add(ReasonAddressCountryMismatch, config.CountryMismatchScore,
+			fmt.Sprintf("Shipping to %s, billed to %s", f.ShippingCountry, f.BillingCountry))
+	} else if f.DistanceKm > config.DistanceKm {
+		add(ReasonAddressDistance, config.DistanceScore,
+			fmt.Sprintf("Shipping address %.0f km from the billing address", f.DistanceKm))
+	}
+	if f.Forwarder != "" {
+		add(ReasonAddressForwarder, config.ForwarderScore, "Shipping to freight forwarder "+f.Forwarder)
+	}
+	return result
+}
+
+// Forwarder is a freight forwarder or reshipping address. Entries without a
+// street address match every address of their postal code, such as a
+// forwarder's warehouse district.
+type Forwarder struct {
+	Name       string `json:"name,omitempty"`
+	Line1      string `json:"line1,omitempty"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// ForwarderList is a lookup of freight forwarder addresses
+type ForwarderList struct {
+	streets     map[string]Forwarder
+	postalCodes map[string]Forwarder
+	mu          sync.RWMutex
+}
+
+func NewForwarderList() *ForwarderList {
+	return &ForwarderList{
+		streets:     make(map[string]Forwarder),
+		postalCodes: make(map[string]Forwarder),
+	}
+}
+
+// normalizeAddressPart lower-cases a part of an address and collapses its
+// punctuation and spacing, so "12 Main St." matches "12 main st"
+func normalizeAddressPart(part string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(part), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func postalKey(country, postalCode string) string {
+	return strings.ToUpper(strings.TrimSpace(country)) + ":" + strings.ReplaceAll(normalizeAddressPart(postalCode), " ", "")
+}
+
+// Add lists a forwarder address
+func (l *ForwarderList) Add(forwarder Forwarder) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := postalKey(forwarder.Country, forwarder.PostalCode)
+	if street := normalizeAddressPart(forwarder.Line1); street != "" {
+		l.streets[key+":"+street] = forwarder
+		return
+	}
+	l.postalCodes[key] = forwarder
+}
+
+// Lookup returns the forwarder at an address, if listed
+func (l *ForwarderList) Lookup(address Address) (Forwarder, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	key := postalKey(address.Country, address.PostalCode)
+	if forwarder, listed := l.streets[key+":"+normalizeAddressPart(address.Line1)]; listed {
+		return forwarder, true
+	}
+	forwarder, listed := l.postalCodes[key]
+	return forwarder, listed
+}
+
+// Enrich sets the forwarder the transaction ships to, named by its postal
+// code when it has no name
+func (l *ForwarderList) Enrich(tx *Transaction) {
+	if l == nil || tx.ShippingAddress == nil || tx.ShippingForwarder != "" {
+		return
+	}
+	if forwarder, listed := l.Lookup(*tx.ShippingAddress); listed {
+		tx.ShippingForwarder = forwarder.Name
+		if tx.ShippingForwarder == "" {
+			tx.ShippingForwarder = forwarder.PostalCode
+		}
+	}
+}
+
+// Size returns the number of listed addresses
+func (l *ForwarderList) Size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.streets) + len(l.postalCodes)
+}
+
+// LoadForwarderList reads a JSON array of freight forwarder addresses
+func LoadForwarderList(r io.Reader) (*ForwarderList, error) {
+	var forwarders []Forwarder
+	if err := json.NewDecoder(r).Decode(&forwarders); err != nil {
+		return nil, fmt.Errorf("invalid freight forwarder list: %w", err)
+	}
+
+	list := NewForwarderList()
+	for i, forwarder := range forwarders {
+		if forwarder.Country == "" || forwarder.PostalCode == "" {
+			return nil, fmt.Errorf("freight forwarder %d: country and postal_code are required", i)
+		}
+		list.Add(forwarder)
+	}
+	return list, nil
+}
+
+// LoadForwarderListFile reads a freight forwarder list from disk
+func LoadForwarderListFile(path string) (*ForwarderList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadForwarderList(f)
+}
@@ -0,0 +1,93 @@
+package detector_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shippedOrder(billing, shipping *detector.Address) *detector.Transaction {
+	return &detector.Transaction{
+		ID:              "TX-ORDER",
+		AccountID:       "ACC-1",
+		Amount:          120,
+		Timestamp:       time.Date(2026, 4, 1, 14, 0, 0, 0, time.UTC),
+		BillingAddress:  billing,
+		ShippingAddress: shipping,
+	}
+}
+
+func TestExtractAddressFeatures(t *testing.T) {
+	newYork := &detector.Address{City: "New York", Country: "us", Latitude: 40.7128, Longitude: -74.0060}
+	losAngeles := &detector.Address{City: "Los Angeles", Country: "US", Latitude: 34.0522, Longitude: -118.2437}
+
+	f := detector.ExtractAddressFeatures(shippedOrder(newYork, losAngeles))
+	assert.False(t, f.CountryMismatch)
+	assert.InDelta(t, 3936, f.DistanceKm, 10)
+
+	f = detector.ExtractAddressFeatures(shippedOrder(newYork, &detector.Address{Country: "NG"}))
+	assert.True(t, f.CountryMismatch)
+	assert.Equal(t, -1.0, f.DistanceKm, "the shipping address is not geocoded")
+
+	f = detector.ExtractAddressFeatures(shippedOrder(nil, &detector.Address{Country: "NG"}))
+	assert.False(t, f.CountryMismatch, "unknown countries never count as a mismatch")
+}
+
+func TestForwarderList(t *testing.T) {
+	list, err := detector.LoadForwarderList(strings.NewReader(`[
+		{"name": "ShipFast", "line1": "1200 NW 78th Ave, Suite 100", "postal_code": "33126", "country": "US"},
+		{"name": "Reship Park", "postal_code": "19720", "country": "us"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Size())
+
+	forwarder, listed := list.Lookup(detector.Address{Line1: "1200 nw 78th ave suite 100", PostalCode: "33126", Country: "US"})
+	assert.True(t, listed)
+	assert.Equal(t, "ShipFast", forwarder.Name)
+	_, listed = list.Lookup(detector.Address{Line1: "1300 NW 78th Ave", PostalCode: "33126", Country: "US"})
+	assert.False(t, listed, "other addresses of the postal code")
+	_, listed = list.Lookup(detector.Address{Line1: "5 Any Road", PostalCode: "19720", Country: "US"})
+	assert.True(t, listed, "listings without a street match the whole postal code")
+
+	_, err = detector.LoadForwarderList(strings.NewReader(`[{"name": "No Address"}]`))
+	assert.Error(t, err)
+}
+
+func TestDetector_Analyze_Addresses(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour})
+	list := detector.NewForwarderList()
+	list.Add(detector.Forwarder{Name: "Reship Park", PostalCode: "19720", Country: "US"})
+	d.SetForwarderList(list)
+	analyze := func(tx *detector.Transaction) []string {
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+
+	billing := &detector.Address{Country: "GB", Latitude: 51.5074, Longitude: -0.1278}
+	codes := analyze(shippedOrder(billing, &detector.Address{PostalCode: "19720", Country: "US", Latitude: 39.66, Longitude: -75.56}))
+	assert.Contains(t, codes, detector.ReasonAddressCountryMismatch)
+	assert.Contains(t, codes, detector.ReasonAddressForwarder)
+	assert.NotContains(t, codes, detector.ReasonAddressDistance, "the country mismatch covers the distance")
+
+	codes = analyze(shippedOrder(&detector.Address{Country: "GB", Latitude: 51.5074, Longitude: -0.1278},
+		&detector.Address{Country: "GB", Latitude: 57.1497, Longitude: -2.0943}))
+	assert.Equal(t, []string{detector.ReasonAddressDistance}, filterPrefix(codes, "ADDRESS_"))
+
+	assert.Empty(t, filterPrefix(analyze(shippedOrder(billing, nil)), "ADDRESS_"), "nothing is shipped")
+}
+
+func filterPrefix(codes []string, prefix string) []string {
+	var filtered []string
+	for _, code := range codes {
+		if strings.HasPrefix(code, prefix) {
+			filtered = append(filtered, code)
+		}
+	}
+	return filtered
+}
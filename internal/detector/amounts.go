@@ -0,0 +1,175 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Amount pattern reason codes
+const (
+	ReasonRoundAmount       = "ROUND_AMOUNT"
+	ReasonStructuringAmount = "STRUCTURING_AMOUNT"
+)
+
+// CurrencyAmounts holds the amount patterns of a currency, in its own units.
+// Amounts of MinRound or more are round when they are a multiple of
+// RoundUnit, or a hand-picked looking multiple of a tenth of it such as
+// 1,500, 2,500 or 7,500. Amounts just below ReportingThreshold look
+// structured to stay under it; zero disables the check.
+type CurrencyAmounts struct {
+	RoundUnit          float64 `json:"round_unit"`
+	MinRound           float64 `json:"min_round"`
+	ReportingThreshold float64 `json:"reporting_threshold,omitempty"`
+}
+
+// AmountPatternConfig holds the amount patterns per ISO currency code.
+// Currencies not listed use Default. Amounts within StructuringMargin, a
+// fraction of the reporting threshold, below it look structured.
+type AmountPatternConfig struct {
+	Currencies        map[string]CurrencyAmounts
+	Default           CurrencyAmounts
+	StructuringMargin float64
+}
+
+// DefaultAmountPatternConfig returns the default amount patterns. Zero-decimal
+// and low-value currencies get units worth roughly as much as 1,000 dollars,
+// so everyday amounts in yen or won are not round.
+func DefaultAmountPatternConfig() AmountPatternConfig {
+	return AmountPatternConfig{
+		Currencies: map[string]CurrencyAmounts{
+			"USD": {RoundUnit: 1000, MinRound: 1000, ReportingThreshold: 10000},
+			"EUR": {RoundUnit: 1000, MinRound: 1000, ReportingThreshold: 10000},
+			"GBP": {RoundUnit: 1000, MinRound: 1000, ReportingThreshold: 10000},
+			"BRL": {RoundUnit: 1000, MinRound: 5000, ReportingThreshold: 50000},
+			"INR": {RoundUnit: 10000, MinRound: 50000, ReportingThreshold: 1000000},
+			"JPY": {RoundUnit: 100000, MinRound: 100000, ReportingThreshold: 2000000},
+			"KRW": {RoundUnit: 1000000, MinRound: 1000000, ReportingThreshold: 10000000},
+		},
+		Default:           CurrencyAmounts{RoundUnit: 1000, MinRound: 1000},
+		StructuringMargin: 0.1,
+	}
+}
+
+func (c AmountPatternConfig) withDefaults() AmountPatternConfig {
+	defaults := DefaultAmountPatternConfig()
+	if c.Currencies == nil {
+		c.Currencies = defaults.Currencies
+	}
+	if c.Default.RoundUnit <= 0 {
+		c.Default = defaults.Default
+	}
+	if c.StructuringMargin <= 0 {
+		c.StructuringMargin = defaults.StructuringMargin
+	}
+	return c
+}
+
+// WithCurrencies returns the configuration with currencies added or replaced
+func (c AmountPatternConfig) WithCurrencies(currencies map[string]CurrencyAmounts) AmountPatternConfig {
+	merged := make(map[string]CurrencyAmounts, len(c.Currencies)+len(currencies))
+	for code, amounts := range c.Currencies {
+		merged[code] = amounts
+	}
+	for code, amounts := range currencies {
+		merged[strings.ToUpper(code)] = amounts
+	}
+	c.Currencies = merged
+	return c
+}
+
+// forCurrency returns the amount patterns of a currency
+func (c AmountPatternConfig) forCurrency(currency string) CurrencyAmounts {
+	if amounts, exists := c.Currencies[strings.ToUpper(currency)]; exists {
+		return amounts
+	}
+	return c.Default
+}
+
+// roundAmount reports whether an amount looks picked by hand rather than
+// the result of a purchase
+func (c AmountPatternConfig) roundAmount(tx *Transaction) bool {
+	amounts := c.forCurrency(tx.Currency)
+	if amounts.RoundUnit <= 0 || tx.Amount < amounts.MinRound {
+		return false
+	}
+	if multipleOf(tx.Amount, amounts.RoundUnit) {
+		return true
+	}
+	tenth := amounts.RoundUnit / 10
+	if !multipleOf(tx.Amount, tenth) {
+		return false
+	}
+	digits := math.Round(tx.Amount / tenth)
+	for math.Mod(digits, 10) == 0 {
+		digits /= 10
+	}
+	return digits == 15 || digits == 25 || digits == 75
+}
+
+// structuredAmount reports whether an amount sits just below the reporting
+// threshold of its currency
+func (c AmountPatternConfig) structuredAmount(tx *Transaction) bool {
+	threshold := c.forCurrency(tx.Currency).ReportingThreshold
+	if threshold <= 0 {
+		return false
+	}
+	return tx.Amount < threshold && tx.Amount >= threshold*(1-c.StructuringMargin)
+}
+
+// multipleOf reports whether an amount is a whole multiple of a unit, allowing
+// for the rounding of amounts with decimals
+func multipleOf(amount, unit float64) bool {
+	quotient := amount / unit
+	return math.Abs(quotient-math.Round(quotient)) < 1e-9
+}
+
+// amountPatterns returns the round and structured amount patterns
+func amountPatterns(config AmountPatternConfig) []Pattern {
+	config = config.withDefaults()
+	return []Pattern{
+		{
+			Name:        ReasonRoundAmount,
+			Description: "Suspicious round amount",
+			Matcher:     config.roundAmount,
+			Score:       0.1,
+		},
+		{
+			Name:        ReasonStructuringAmount,
+			Description: "Amount just below the reporting threshold",
+			Matcher:     config.structuredAmount,
+			Score:       0.15,
+		},
+	}
+}
+
+// LoadCurrencyAmounts reads JSON amount patterns per currency:
+// {"JPY": {"round_unit": 100000, "min_round": 100000, "reporting_threshold": 2000000}}
+func LoadCurrencyAmounts(r io.Reader) (map[string]CurrencyAmounts, error) {
+	var currencies map[string]CurrencyAmounts
+	if err := json.NewDecoder(r).Decode(&currencies); err != nil {
+		return nil, fmt.Errorf("invalid currency amounts: %w", err)
+	}
+	for code, amounts := range currencies {
+		if amounts.RoundUnit <= 0 {
+			return nil, fmt.Errorf("currency %s: round unit must be positive", code)
+		}
+		if amounts.MinRound < 0 || amounts.ReportingThreshold < 0 {
+			return nil, fmt.Errorf("currency %s: amounts must not be negative", code)
+		}
+	}
+	return currencies, nil
+}
+
+// LoadCurrencyAmountsFile reads amount patterns per currency from disk
+func LoadCurrencyAmountsFile(path string) (map[string]CurrencyAmounts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCurrencyAmounts(f)
+}
@@ -0,0 +1,81 @@
+package detector_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func amountTx(amount float64, currency string) *detector.Transaction {
+	return &detector.Transaction{
+		ID:        "TXN-AMOUNT",
+		AccountID: "ACC-AMOUNT",
+		Amount:    amount,
+		Currency:  currency,
+		Timestamp: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestPatternMatcher_CurrencyAmounts(t *testing.T) {
+	matcher := detector.NewPatternMatcher()
+
+	tests := []struct {
+		name       string
+		amount     float64
+		currency   string
+		round      bool
+		structured bool
+	}{
+		{"Round dollars", 5000, "USD", true, false},
+		{"Hand-picked dollars", 2500, "USD", true, false},
+		{"Uneven hundreds", 1200, "USD", false, false},
+		{"Dollars with cents", 1234.56, "USD", false, false},
+		{"Lowercase currency", 3000, "eur", true, false},
+		{"Everyday yen", 4000, "JPY", false, false},
+		{"Round yen", 300000, "JPY", true, false},
+		{"Hand-picked won", 1500000, "KRW", true, false},
+		{"Just below the dollar threshold", 9500, "USD", false, true},
+		{"Round below the threshold", 9000, "USD", true, true},
+		{"At the threshold", 10000, "USD", true, false},
+		{"Unknown currency", 2000, "CHF", true, false},
+		{"Unknown currency below 10,000", 9500, "CHF", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, codes := matcher.MatchCodes(amountTx(tt.amount, tt.currency))
+			assert.Equal(t, tt.round, hasCode(codes, detector.ReasonRoundAmount), "round")
+			assert.Equal(t, tt.structured, hasCode(codes, detector.ReasonStructuringAmount), "structured")
+		})
+	}
+}
+
+func TestLoadCurrencyAmounts(t *testing.T) {
+	currencies, err := detector.LoadCurrencyAmounts(strings.NewReader(`{"chf": {"round_unit": 500, "min_round": 500, "reporting_threshold": 15000}}`))
+	require.NoError(t, err)
+
+	config := detector.DefaultAmountPatternConfig().WithCurrencies(currencies)
+	matcher := detector.NewPatternMatcherWithAmounts(config)
+
+	_, _, codes := matcher.MatchCodes(amountTx(1500, "CHF"))
+	assert.Contains(t, codes, detector.ReasonRoundAmount)
+	_, _, codes = matcher.MatchCodes(amountTx(14000, "CHF"))
+	assert.Contains(t, codes, detector.ReasonStructuringAmount)
+	_, _, codes = matcher.MatchCodes(amountTx(5000, "USD"))
+	assert.Contains(t, codes, detector.ReasonRoundAmount, "defaults are kept")
+
+	_, err = detector.LoadCurrencyAmounts(strings.NewReader(`{"CHF": {"round_unit": 0}}`))
+	assert.Error(t, err)
+}
+
+func hasCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
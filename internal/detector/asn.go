@@ -0,0 +1,237 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Network types of an autonomous system. Traffic from hosting and cloud
+// networks rarely comes from a real customer: it is proxies, VPN exits and
+// automation.
+const (
+	NetworkHosting     = "hosting"
+	NetworkResidential = "residential"
+	NetworkMobile      = "mobile"
+	NetworkBusiness    = "business"
+)
+
+// ReasonHostingASN flags transactions from the IP of a hosting or cloud
+// provider
+const ReasonHostingASN = "HOSTING_ASN"
+
+// ASNConfig holds network risk settings
+type ASNConfig struct {
+	HostingScore float64
+}
+
+// DefaultASNConfig returns the default network risk settings
+func DefaultASNConfig() ASNConfig {
+	return ASNConfig{HostingScore: 0.25}
+}
+
+func (c ASNConfig) withDefaults() ASNConfig {
+	if c.HostingScore <= 0 {
+		c.HostingScore = DefaultASNConfig().HostingScore
+	}
+	return c
+}
+
+// ASN is an autonomous system: the network an IP address is announced by
+type ASN struct {
+	Number uint32 `json:"asn"`
+	Org    string `json:"org"`
+	Type   string `json:"type,omitempty"`
+}
+
+// Name returns the number and organization of the system, e.g.
+// "AS16509 AMAZON-02"
+func (a ASN) Name() string {
+	if a.Org == "" {
+		return fmt.Sprintf("AS%d", a.Number)
+	}
+	return fmt.Sprintf("AS%d %s", a.Number, a.Org)
+}
+
+// ASNPrefix is an entry of the ASN table: a routed prefix and the system
+// announcing it
+type ASNPrefix struct {
+	Prefix string `json:"prefix"`
+	ASN
+}
+
+// ASNTable maps IP prefixes to the autonomous systems announcing them, as
+// exported from BGP routing tables. The most specific prefix wins.
+type ASNTable struct {
+	prefixes map[netip.Prefix]ASN
+	// systems holds each system by number, for transactions that come with
+	// their ASN
+	systems map[uint32]ASN
+	// lengths are the prefix lengths in the table, longest first
+	lengths []int
+	mu      sync.RWMutex
+}
+
+func NewASNTable() *ASNTable {
+	return &ASNTable{
+		prefixes: make(map[netip.Prefix]ASN),
+		systems:  make(map[uint32]ASN),
+	}
+}
+
+// Add records the system announcing a prefix
+func (t *ASNTable) Add(prefix string, asn ASN) error {
+	parsed, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return fmt.Errorf("invalid prefix %q: %w", prefix, err)
+	}
+	if asn.Number == 0 {
+		return fmt.Errorf("prefix %s: asn is required", prefix)
+	}
+	switch asn.Type {
+	case "", NetworkHosting, NetworkResidential, NetworkMobile, NetworkBusiness:
+	default:
+		return fmt.Errorf("prefix %s: unknown network type %q", prefix, asn.Type)
+	}
+	parsed = parsed.Masked()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.prefixes[parsed]; !exists {
+		t.addLength(parsed.Bits())
+	}
+	t.prefixes[parsed] = asn
+	t.systems[asn.Number] = asn
+	return nil
+}
+
+// addLength keeps lengths sorted. Callers must hold the lock.
+func (t *ASNTable) addLength(bits int) {
+	i := sort.Search(len(t.lengths), func(i int) bool { return t.lengths[i] <= bits })
+	if i < len(t.lengths) && t.lengths[i] == bits {
+		return
+	}
+	t.lengths = append(t.lengths, 0)
+	copy(t.lengths[i+1:], t.lengths[i:])
+	t.lengths[i] = bits
+}
+
+// Lookup returns the system announcing an IP address
+func (t *ASNTable) Lookup(ip string) (ASN, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ASN{}, false
+	}
+	addr = addr.Unmap()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, bits := range t.lengths {
+		if bits > addr.BitLen() {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if asn, exists := t.prefixes[prefix]; exists {
+			return asn, true
+		}
+	}
+	return ASN{}, false
+}
+
+// System returns a system by number
+func (t *ASNTable) System(number uint32) (ASN, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	asn, exists := t.systems[number]
+	return asn, exists
+}
+
+// Size returns the number of prefixes
+func (t *ASNTable) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.prefixes)
+}
+
+// Enrich fills the network of a transaction from its IP address. An ASN sent
+// by the client wins; its organization and type are filled when known.
+func (t *ASNTable) Enrich(tx *Transaction) {
+	if t == nil {
+		return
+	}
+	asn, exists := ASN{}, false
+	if tx.ASN != 0 {
+		asn, exists = t.System(tx.ASN)
+	} else if tx.IPAddress != "" {
+		asn, exists = t.Lookup(tx.IPAddress)
+	}
+	if !exists {
+		return
+	}
+	tx.ASN = asn.Number
+	if tx.ASNOrg == "" {
+		tx.ASNOrg = asn.Org
+	}
+	if tx.NetworkType == "" {
+		tx.NetworkType = asn.Type
+	}
+}
+
+// ASNResult is the outcome of the network check
+type ASNResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// checkASN scores transactions from hosting and cloud networks. Residential,
+// mobile and business networks add nothing.
+func checkASN(config ASNConfig, tx *Transaction) ASNResult {
+	result := ASNResult{}
+	if tx.NetworkType != NetworkHosting {
+		return result
+	}
+	name := ASN{Number: tx.ASN, Org: tx.ASNOrg}.Name()
+	reason := "Connection from hosting provider " + name
+	if tx.IPAddress != "" {
+		reason = fmt.Sprintf("IP %s belongs to hosting provider %s", tx.IPAddress, name)
+	}
+	result.Score = config.HostingScore
+	result.Codes = append(result.Codes, ReasonHostingASN)
+	result.Reasons = append(result.Reasons, reason)
+	return result
+}
+
+// LoadASNTable reads a JSON array of prefixes:
+// [{"prefix": "3.0.0.0/9", "asn": 16509, "org": "AMAZON-02", "type": "hosting"}]
+func LoadASNTable(r io.Reader) (*ASNTable, error) {
+	var prefixes []ASNPrefix
+	if err := json.NewDecoder(r).Decode(&prefixes); err != nil {
+		return nil, fmt.Errorf("invalid ASN table: %w", err)
+	}
+
+	table := NewASNTable()
+	for i, entry := range prefixes {
+		if err := table.Add(entry.Prefix, entry.ASN); err != nil {
+			return nil, fmt.Errorf("ASN table entry %d: %w", i, err)
+		}
+	}
+	return table, nil
+}
+
+// LoadASNTableFile reads an ASN table from disk
+func LoadASNTableFile(path string) (*ASNTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadASNTable(f)
+}
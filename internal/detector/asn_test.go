@@ -0,0 +1,98 @@
+package detector_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const asnTableJSON = `[
+	{"prefix": "3.0.0.0/9", "asn": 16509, "org": "AMAZON-02", "type": "hosting"},
+	{"prefix": "3.5.0.0/16", "asn": 14618, "org": "AMAZON-AES", "type": "hosting"},
+	{"prefix": "177.0.0.0/12", "asn": 18881, "org": "TELEFONICA BRASIL", "type": "residential"},
+	{"prefix": "2600:1f00::/24", "asn": 16509, "org": "AMAZON-02", "type": "hosting"}
+]`
+
+func TestLoadASNTable(t *testing.T) {
+	table, err := detector.LoadASNTable(strings.NewReader(asnTableJSON))
+	require.NoError(t, err)
+	assert.Equal(t, 4, table.Size())
+
+	asn, found := table.Lookup("3.5.1.2")
+	require.True(t, found)
+	assert.Equal(t, uint32(14618), asn.Number, "the most specific prefix wins")
+
+	asn, found = table.Lookup("3.6.1.2")
+	require.True(t, found)
+	assert.Equal(t, "AS16509 AMAZON-02", asn.Name())
+
+	asn, found = table.Lookup("2600:1f00::1")
+	require.True(t, found)
+	assert.Equal(t, detector.NetworkHosting, asn.Type)
+
+	asn, found = table.Lookup("::ffff:177.1.2.3")
+	require.True(t, found, "IPv4-mapped addresses match IPv4 prefixes")
+	assert.Equal(t, uint32(18881), asn.Number)
+
+	_, found = table.Lookup("8.8.8.8")
+	assert.False(t, found)
+	_, found = table.Lookup("not-an-ip")
+	assert.False(t, found)
+
+	_, err = detector.LoadASNTable(strings.NewReader(`[{"prefix": "10.0.0.0/8", "asn": 1, "type": "satellite"}]`))
+	assert.Error(t, err)
+	_, err = detector.LoadASNTable(strings.NewReader(`[{"prefix": "10.0.0.0/33", "asn": 1}]`))
+	assert.Error(t, err)
+}
+
+func TestDetector_Analyze_HostingASN(t *testing.T) {
+	table, err := detector.LoadASNTable(strings.NewReader(asnTableJSON))
+	require.NoError(t, err)
+
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	d.SetASNTable(table)
+
+	networkTx := func(id, ip string) *detector.Transaction {
+		return &detector.Transaction{
+			ID:        id,
+			AccountID: "ACC-ASN-" + id,
+			Amount:    120.00,
+			Currency:  "USD",
+			Timestamp: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+			IPAddress: ip,
+		}
+	}
+
+	t.Run("Hosting provider is scored and named", func(t *testing.T) {
+		tx := networkTx("N1", "3.6.1.2")
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		assert.Contains(t, score.ReasonCodes, detector.ReasonHostingASN)
+		assert.Contains(t, strings.Join(score.Reasons, "; "), "AS16509 AMAZON-02")
+		assert.InDelta(t, 0.25, score.Score, 0.001)
+		assert.Equal(t, uint32(16509), tx.ASN)
+		assert.Equal(t, detector.NetworkHosting, tx.NetworkType)
+	})
+
+	t.Run("Residential ISP adds nothing", func(t *testing.T) {
+		tx := networkTx("N2", "177.1.2.3")
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		assert.NotContains(t, score.ReasonCodes, detector.ReasonHostingASN)
+		assert.Equal(t, "TELEFONICA BRASIL", tx.ASNOrg)
+	})
+
+	t.Run("ASN sent by the client is completed", func(t *testing.T) {
+		tx := networkTx("N3", "")
+		tx.ASN = 14618
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		assert.Contains(t, score.ReasonCodes, detector.ReasonHostingASN)
+		assert.Equal(t, "AMAZON-AES", tx.ASNOrg)
+	})
+}
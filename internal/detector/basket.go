@@ -0,0 +1,190 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LineItem is an item of the basket a transaction pays for
+type LineItem struct {
+	SKU      string `json:"sku,omitempty"`
+	Quantity int    `json:"quantity"`
+	// Price is the unit price, in the currency of the transaction
+	Price    float64 `json:"price"`
+	Category string  `json:"category,omitempty"`
+}
+
+// Total returns the price of all units of the item
+func (i LineItem) Total() float64 {
+	return i.Price * float64(i.Quantity)
+}
+
+// Item categories scored as high risk by default, being easy to resell
+const (
+	CategoryGiftCard    = "gift_card"
+	CategoryElectronics = "electronics"
+)
+
+// BasketConfig holds basket item settings. Categories scores the high-risk
+// item categories, keyed by lower-case category; a basket scores as its
+// riskiest category. Baskets with at least BulkQuantity units of high-risk
+// categories add BulkScore. A basket of a single unit priced from
+// HighValueItem, bought by an account opened within NewAccountAge, adds
+// HighValueScore; accounts of unknown age are not new. Items, fee, tax and
+// shipping adding up to more than MismatchTolerance of the amount away from
+// it add MismatchScore.
+type BasketConfig struct {
+	Categories        map[string]float64
+	BulkQuantity      int
+	BulkScore         float64
+	HighValueItem     float64
+	NewAccountAge     time.Duration
+	HighValueScore    float64
+	MismatchTolerance float64
+	MismatchScore     float64
+}
+
+// DefaultBasketConfig returns the default basket item settings
+func DefaultBasketConfig() BasketConfig {
+	return BasketConfig{
+		Categories: map[string]float64{
+			CategoryGiftCard:    0.25,
+			CategoryElectronics: 0.1,
+		},
+		BulkQuantity:      5,
+		BulkScore:         0.2,
+		HighValueItem:     2000,
+		NewAccountAge:     7 * 24 * time.Hour,
+		HighValueScore:    0.3,
+		MismatchTolerance: 0.02,
+		MismatchScore:     0.15,
+	}
+}
+
+func (c BasketConfig) withDefaults() BasketConfig {
+	defaults := DefaultBasketConfig()
+	if c.Categories == nil {
+		c.Categories = defaults.Categories
+	}
+	if c.BulkQuantity <= 0 {
+		c.BulkQuantity = defaults.BulkQuantity
+	}
+	if c.BulkScore <= 0 {
+		c.BulkScore = defaults.BulkScore
+	}
+	if c.HighValueItem <= 0 {
+		c.HighValueItem = defaults.HighValueItem
+	}
+	if c.NewAccountAge <= 0 {
+		c.NewAccountAge = defaults.NewAccountAge
+	}
+	if c.HighValueScore <= 0 {
+		c.HighValueScore = defaults.HighValueScore
+	}
+	if c.MismatchTolerance <= 0 {
+		c.MismatchTolerance = defaults.MismatchTolerance
+	}
+	if c.MismatchScore <= 0 {
+		c.MismatchScore = defaults.MismatchScore
+	}
+	return c
+}
+
+// Basket reason codes. Layers switch them off like rules.
+const (
+	ReasonBasketHighRiskCategory = "BASKET_HIGH_RISK_CATEGORY"
+	ReasonBasketBulkHighRisk     = "BASKET_BULK_HIGH_RISK"
+	ReasonBasketHighValueItem    = "BASKET_HIGH_VALUE_ITEM_NEW_ACCOUNT"
+	ReasonBasketAmountMismatch   = "BASKET_AMOUNT_MISMATCH"
+)
+
+// BasketFeatures summarize the basket of a transaction
+type BasketFeatures struct {
+	Items        int
+	Quantity     int
+	Subtotal     float64
+	MaxItemPrice float64
+	// Categories are the distinct lower-case categories, sorted
+	Categories []string
+}
+
+// ExtractBasketFeatures summarizes the line items of a transaction
+func ExtractBasketFeatures(tx *Transaction) BasketFeatures {
+	f := BasketFeatures{Items: len(tx.Items)}
+	seen := make(map[string]bool)
+	for _, item := range tx.Items {
+		f.Quantity += item.Quantity
+		f.Subtotal += item.Total()
+		f.MaxItemPrice = math.Max(f.MaxItemPrice, item.Price)
+		if category := strings.ToLower(strings.TrimSpace(item.Category)); category != "" && !seen[category] {
+			seen[category] = true
+			f.Categories = append(f.Categories, category)
+		}
+	}
+	sort.Strings(f.Categories)
+	return f
+}
+
+// BasketResult is the outcome of the basket checks
+type BasketResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+func checkBasket(config BasketConfig, tx *Transaction) BasketResult {
+	result := BasketResult{}
+	if len(tx.Items) == 0 {
+		return result
+	}
+	f := ExtractBasketFeatures(tx)
+	add := func(code string, score float64, reason string) {
+		if tx.overrides.ruleDisabled(code) {
+			return
+		}
+		result.Score += score
+		result.Codes = append(result.Codes, code)
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	var risky []string
+	riskiest, riskyUnits := 0.0, 0
+	for _, category := range f.Categories {
+		if score := config.Categories[category]; score > 0 {
+			risky = append(risky, category)
+			riskiest = math.Max(riskiest, score)
+		}
+	}
+	if len(risky) > 0 {
+		for _, item := range tx.Items {
+			if config.Categories[strings.ToLower(strings.TrimSpace(item.Category))] > 0 {
+				riskyUnits += item.Quantity
+			}
+		}
+		add(ReasonBasketHighRiskCategory, riskiest, "Basket holds high-risk items: "+strings.Join(risky, ", "))
+		if riskyUnits >= config.BulkQuantity {
+			add(ReasonBasketBulkHighRisk, config.BulkScore, fmt.Sprintf("Basket holds %d units of high-risk items", riskyUnits))
+		}
+	}
+
+	if f.Quantity == 1 && f.MaxItemPrice >= config.HighValueItem && newAccount(tx, config.NewAccountAge) {
+		add(ReasonBasketHighValueItem, config.HighValueScore,
+			fmt.Sprintf("Single item of %.2f bought by an account opened %s ago", f.MaxItemPrice, tx.Timestamp.Sub(tx.AccountCreatedAt).Round(time.Hour)))
+	}
+
+	total := f.Subtotal + tx.Fee + tx.Tax + tx.Shipping
+	if math.Abs(total-tx.Amount) > config.MismatchTolerance*tx.Amount+0.01 {
+		add(ReasonBasketAmountMismatch, config.MismatchScore,
+			fmt.Sprintf("Items, fee, tax and shipping add up to %.2f, not the amount of %.2f", total, tx.Amount))
+	}
+	return result
+}
+
+// newAccount reports whether the account was opened within maxAge of the
+// transaction, false when its opening is unknown
+func newAccount(tx *Transaction, maxAge time.Duration) bool {
+	return !tx.AccountCreatedAt.IsZero() && tx.Timestamp.Sub(tx.AccountCreatedAt) < maxAge
+}
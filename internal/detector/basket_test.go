@@ -0,0 +1,84 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func basketPurchase(amount float64, items ...detector.LineItem) *detector.Transaction {
+	return &detector.Transaction{
+		ID:        "TX-BASKET",
+		AccountID: "ACC-1",
+		Amount:    amount,
+		Currency:  "USD",
+		Timestamp: time.Date(2026, 4, 1, 14, 0, 0, 0, time.UTC),
+		Items:     items,
+	}
+}
+
+func TestExtractBasketFeatures(t *testing.T) {
+	f := detector.ExtractBasketFeatures(basketPurchase(130,
+		detector.LineItem{SKU: "GC-50", Quantity: 2, Price: 50, Category: "Gift_Card"},
+		detector.LineItem{SKU: "CABLE", Quantity: 3, Price: 10, Category: "electronics"},
+		detector.LineItem{SKU: "GC-25", Quantity: 1, Price: 0, Category: "gift_card"},
+	))
+	assert.Equal(t, 3, f.Items)
+	assert.Equal(t, 6, f.Quantity)
+	assert.Equal(t, 130.0, f.Subtotal)
+	assert.Equal(t, 50.0, f.MaxItemPrice)
+	assert.Equal(t, []string{"electronics", "gift_card"}, f.Categories)
+}
+
+func TestDetector_Analyze_Basket(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour})
+	analyze := func(tx *detector.Transaction) []string {
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+
+	codes := analyze(basketPurchase(300, detector.LineItem{Quantity: 6, Price: 50, Category: "gift_card"}))
+	assert.Contains(t, codes, detector.ReasonBasketHighRiskCategory)
+	assert.Contains(t, codes, detector.ReasonBasketBulkHighRisk)
+	assert.NotContains(t, codes, detector.ReasonBasketAmountMismatch)
+
+	codes = analyze(basketPurchase(40, detector.LineItem{Quantity: 2, Price: 20, Category: "books"}))
+	assert.NotContains(t, codes, detector.ReasonBasketHighRiskCategory)
+
+	// Fee, tax and shipping make up the rest of the amount
+	tx := basketPurchase(130, detector.LineItem{Quantity: 1, Price: 100, Category: "books"})
+	tx.Tax, tx.Shipping = 20, 10
+	assert.NotContains(t, analyze(tx), detector.ReasonBasketAmountMismatch)
+	tx = basketPurchase(500, detector.LineItem{Quantity: 1, Price: 100, Category: "books"})
+	assert.Contains(t, analyze(tx), detector.ReasonBasketAmountMismatch)
+
+	// A single ultra-high-value item is only suspicious from a new account
+	tx = basketPurchase(2500, detector.LineItem{Quantity: 1, Price: 2500, Category: "jewelry"})
+	assert.NotContains(t, analyze(tx), detector.ReasonBasketHighValueItem, "the account age is unknown")
+	tx = basketPurchase(2500, detector.LineItem{Quantity: 1, Price: 2500, Category: "jewelry"})
+	tx.AccountCreatedAt = tx.Timestamp.Add(-48 * time.Hour)
+	assert.Contains(t, analyze(tx), detector.ReasonBasketHighValueItem)
+	tx = basketPurchase(2500, detector.LineItem{Quantity: 1, Price: 2500, Category: "jewelry"})
+	tx.AccountCreatedAt = tx.Timestamp.Add(-90 * 24 * time.Hour)
+	assert.NotContains(t, analyze(tx), detector.ReasonBasketHighValueItem)
+}
+
+func TestDetector_ExpressionRules_Basket(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour})
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "GIFT_CARD_TAXED",
+		Expression: "'gift_card' in tx.basket.categories && tx.basket.tax > 0",
+		Score:      0.1,
+	}))
+
+	tx := basketPurchase(110, detector.LineItem{Quantity: 1, Price: 100, Category: "gift_card"})
+	tx.Tax = 10
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Contains(t, score.ReasonCodes, "GIFT_CARD_TAXED")
+}
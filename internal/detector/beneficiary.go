@@ -0,0 +1,224 @@
+package detector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BeneficiaryConfig holds beneficiary risk settings. A beneficiary is new to
+// a sender for NewWindow after the sender added it, or after their first
+// transfer when the client does not send beneficiary_added_at.
+type BeneficiaryConfig struct {
+	NewWindow   time.Duration
+	LargeAmount float64
+	// MaxSenders is the number of distinct senders a beneficiary may receive
+	// from within SenderWindow
+	MaxSenders   int
+	SenderWindow time.Duration
+	NewScore     float64
+	SendersScore float64
+	// LabeledScore is added for beneficiaries labeled as fraudulent
+	LabeledScore float64
+}
+
+// DefaultBeneficiaryConfig returns the default beneficiary risk settings
+func DefaultBeneficiaryConfig() BeneficiaryConfig {
+	return BeneficiaryConfig{
+		NewWindow:    time.Hour,
+		LargeAmount:  1000,
+		MaxSenders:   5,
+		SenderWindow: 7 * 24 * time.Hour,
+		NewScore:     0.3,
+		SendersScore: 0.3,
+		LabeledScore: 0.6,
+	}
+}
+
+func (c BeneficiaryConfig) withDefaults() BeneficiaryConfig {
+	defaults := DefaultBeneficiaryConfig()
+	if c.NewWindow <= 0 {
+		c.NewWindow = defaults.NewWindow
+	}
+	if c.LargeAmount <= 0 {
+		c.LargeAmount = defaults.LargeAmount
+	}
+	if c.MaxSenders <= 0 {
+		c.MaxSenders = defaults.MaxSenders
+	}
+	if c.SenderWindow <= 0 {
+		c.SenderWindow = defaults.SenderWindow
+	}
+	if c.NewScore <= 0 {
+		c.NewScore = defaults.NewScore
+	}
+	if c.SendersScore <= 0 {
+		c.SendersScore = defaults.SendersScore
+	}
+	if c.LabeledScore <= 0 {
+		c.LabeledScore = defaults.LabeledScore
+	}
+	return c
+}
+
+// Beneficiary reason codes
+const (
+	ReasonNewBeneficiaryLargeTransfer = "NEW_BENEFICIARY_LARGE_TRANSFER"
+	ReasonBeneficiaryManySenders      = "BENEFICIARY_MANY_SENDERS"
+	ReasonBeneficiaryFraudLabel       = "BENEFICIARY_FRAUD_LABEL"
+)
+
+// BeneficiaryStats summarizes the transfers a beneficiary received
+type BeneficiaryStats struct {
+	BeneficiaryID string    `json:"beneficiary_id"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	Transfers     int       `json:"transfers"`
+	TotalReceived float64   `json:"total_received"`
+	// DistinctSenders counts the senders within the sender window
+	DistinctSenders int      `json:"distinct_senders"`
+	FraudLabels     int      `json:"fraud_labels"`
+	LabelReasons    []string `json:"label_reasons,omitempty"`
+}
+
+// BeneficiaryResult is the outcome of the beneficiary checks
+type BeneficiaryResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// BeneficiaryTracker keeps per-beneficiary statistics of transfers: who sent
+// to them and when, and fraud labels set by analysts
+type BeneficiaryTracker struct {
+	config        BeneficiaryConfig
+	beneficiaries map[string]*beneficiary
+	mu            sync.RWMutex
+}
+
+type beneficiary struct {
+	stats BeneficiaryStats
+	// senders holds when each sender first and last sent to the beneficiary
+	senders map[string]senderHistory
+}
+
+type senderHistory struct {
+	first, last time.Time
+}
+
+func NewBeneficiaryTracker(config BeneficiaryConfig) *BeneficiaryTracker {
+	return &BeneficiaryTracker{
+		config:        config.withDefaults(),
+		beneficiaries: make(map[string]*beneficiary),
+	}
+}
+
+// Check evaluates a transfer against its beneficiary's history, then records
+// it. Transactions that are not transfers to a destination are ignored.
+func (b *BeneficiaryTracker) Check(tx *Transaction) BeneficiaryResult {
+	result := BeneficiaryResult{}
+	if !IsTransfer(tx) || tx.Destination == "" {
+		return result
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ben, exists := b.beneficiaries[tx.Destination]
+	if !exists {
+		ben = &beneficiary{
+			stats:   BeneficiaryStats{BeneficiaryID: tx.Destination, FirstSeen: tx.Timestamp},
+			senders: make(map[string]senderHistory),
+		}
+		b.beneficiaries[tx.Destination] = ben
+	}
+
+	sender, known := ben.senders[tx.AccountID]
+	if !known {
+		sender.first = tx.Timestamp
+	}
+	sender.last = tx.Timestamp
+	ben.senders[tx.AccountID] = sender
+
+	ben.stats.LastSeen = tx.Timestamp
+	ben.stats.Transfers++
+	ben.stats.TotalReceived += tx.Amount
+	ben.stats.DistinctSenders = b.activeSenders(ben, tx.Timestamp)
+
+	addedAt := sender.first
+	if !tx.BeneficiaryAddedAt.IsZero() {
+		addedAt = tx.BeneficiaryAddedAt
+	}
+	if age := tx.Timestamp.Sub(addedAt); age < b.config.NewWindow && tx.Amount >= b.config.LargeAmount {
+		result.Score += b.config.NewScore
+		result.Codes = append(result.Codes, ReasonNewBeneficiaryLargeTransfer)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Transfer of %.2f to a beneficiary added %s ago", tx.Amount, age.Round(time.Minute)))
+	}
+
+	if ben.stats.DistinctSenders > b.config.MaxSenders {
+		result.Score += b.config.SendersScore
+		result.Codes = append(result.Codes, ReasonBeneficiaryManySenders)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Beneficiary received from %d senders within %s", ben.stats.DistinctSenders, b.config.SenderWindow))
+	}
+
+	if ben.stats.FraudLabels > 0 {
+		result.Score += b.config.LabeledScore
+		result.Codes = append(result.Codes, ReasonBeneficiaryFraudLabel)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Beneficiary labeled as fraudulent %d times", ben.stats.FraudLabels))
+	}
+	return result
+}
+
+// activeSenders counts the senders within the sender window and forgets
+// older ones. Callers must hold the lock.
+func (b *BeneficiaryTracker) activeSenders(ben *beneficiary, now time.Time) int {
+	cutoff := now.Add(-b.config.SenderWindow)
+	for id, sender := range ben.senders {
+		if sender.last.Before(cutoff) {
+			delete(ben.senders, id)
+		}
+	}
+	return len(ben.senders)
+}
+
+// Label records that a beneficiary received fraudulent funds, e.g. after a
+// confirmed scam report. Later transfers to it are flagged.
+func (b *BeneficiaryTracker) Label(beneficiaryID, reason string) BeneficiaryStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ben, exists := b.beneficiaries[beneficiaryID]
+	if !exists {
+		ben = &beneficiary{
+			stats:   BeneficiaryStats{BeneficiaryID: beneficiaryID},
+			senders: make(map[string]senderHistory),
+		}
+		b.beneficiaries[beneficiaryID] = ben
+	}
+	ben.stats.FraudLabels++
+	if reason != "" {
+		ben.stats.LabelReasons = append(ben.stats.LabelReasons, reason)
+	}
+	return ben.copyStats()
+}
+
+// Stats returns the statistics of a beneficiary
+func (b *BeneficiaryTracker) Stats(beneficiaryID string) (BeneficiaryStats, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ben, exists := b.beneficiaries[beneficiaryID]
+	if !exists {
+		return BeneficiaryStats{BeneficiaryID: beneficiaryID}, false
+	}
+	return ben.copyStats(), true
+}
+
+func (ben *beneficiary) copyStats() BeneficiaryStats {
+	stats := ben.stats
+	stats.LabelReasons = append([]string(nil), ben.stats.LabelReasons...)
+	return stats
+}
@@ -0,0 +1,78 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeneficiaryTracker_NewBeneficiaryLargeTransfer(t *testing.T) {
+	tracker := detector.NewBeneficiaryTracker(detector.DefaultBeneficiaryConfig())
+	now := time.Date(2026, 4, 1, 15, 0, 0, 0, time.UTC)
+
+	result := tracker.Check(transfer("ACC-1", "transfer", "IBAN-NEW", 5000, now))
+	assert.Equal(t, []string{detector.ReasonNewBeneficiaryLargeTransfer}, result.Codes)
+
+	assert.Empty(t, tracker.Check(transfer("ACC-1", "transfer", "IBAN-SMALL", 50, now)).Codes, "small amounts are fine")
+	assert.Empty(t, tracker.Check(transfer("ACC-1", "transfer", "IBAN-NEW", 5000, now.Add(2*time.Hour))).Codes, "no longer new")
+
+	// The client's own record of when the beneficiary was added wins
+	tx := transfer("ACC-2", "transfer", "IBAN-OLD", 5000, now)
+	tx.BeneficiaryAddedAt = now.Add(-30 * 24 * time.Hour)
+	assert.Empty(t, tracker.Check(tx).Codes)
+	tx = transfer("ACC-3", "transfer", "IBAN-OLD", 5000, now.Add(3*time.Hour))
+	tx.BeneficiaryAddedAt = now.Add(3*time.Hour - 10*time.Minute)
+	assert.Equal(t, []string{detector.ReasonNewBeneficiaryLargeTransfer}, tracker.Check(tx).Codes)
+
+	assert.Empty(t, tracker.Check(transfer("ACC-1", "card", "IBAN-NEW2", 5000, now)).Codes, "only transfers")
+}
+
+func TestBeneficiaryTracker_ManySendersAndLabels(t *testing.T) {
+	tracker := detector.NewBeneficiaryTracker(detector.DefaultBeneficiaryConfig())
+	now := time.Date(2026, 4, 1, 15, 0, 0, 0, time.UTC)
+
+	var result detector.BeneficiaryResult
+	for i := 1; i <= 6; i++ {
+		result = tracker.Check(transfer(fmt.Sprintf("VICTIM-%d", i), "transfer", "IBAN-MULE", 200, now.Add(time.Duration(i)*time.Hour)))
+	}
+	assert.Equal(t, []string{detector.ReasonBeneficiaryManySenders}, result.Codes)
+
+	stats, exists := tracker.Stats("IBAN-MULE")
+	require.True(t, exists)
+	assert.Equal(t, 6, stats.Transfers)
+	assert.Equal(t, 6, stats.DistinctSenders)
+	assert.InDelta(t, 1200, stats.TotalReceived, 0.001)
+	assert.Equal(t, now.Add(time.Hour), stats.FirstSeen)
+
+	stats = tracker.Label("IBAN-SCAM", "confirmed scam report")
+	assert.Equal(t, 1, stats.FraudLabels)
+	tracker.Check(transfer("ACC-1", "transfer", "IBAN-SCAM", 20, now))
+	result = tracker.Check(transfer("ACC-1", "transfer", "IBAN-SCAM", 20, now.Add(time.Hour)))
+	assert.Equal(t, []string{detector.ReasonBeneficiaryFraudLabel}, result.Codes)
+	assert.Greater(t, result.Score, 0.5)
+}
+
+func TestDetector_BeneficiaryExpression(t *testing.T) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:          "LABELED_PAYEE",
+		Description: "Transfer to a labeled beneficiary",
+		Expression:  "beneficiary(tx.destination).fraud_labels > 0",
+		Score:       0.2,
+	}))
+	d.LabelBeneficiary("IBAN-SCAM", "")
+
+	score, err := d.Analyze(context.Background(), transfer("ACC-1", "transfer", "IBAN-SCAM", 20, time.Now()))
+	require.NoError(t, err)
+	assert.Contains(t, score.ReasonCodes, "LABELED_PAYEE")
+	assert.Contains(t, score.ReasonCodes, detector.ReasonBeneficiaryFraudLabel)
+
+	score, err = d.Analyze(context.Background(), transfer("ACC-1", "transfer", "IBAN-UNKNOWN", 20, time.Now()))
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, "LABELED_PAYEE", "unknown beneficiaries are null")
+}
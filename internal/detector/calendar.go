@@ -0,0 +1,189 @@
+package detector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CalendarEvent is a holiday, shopping festival or known fraud surge in some
+// countries. While it runs, the high amount and velocity thresholds of their
+// transactions are multiplied by its factors: above 1 to relax them during
+// shopping peaks, below 1 to tighten them during fraud surges.
+type CalendarEvent struct {
+	Name string `json:"name"`
+	// Countries are matched against the transaction location, or the
+	// merchant country when the location has none. Empty for every country.
+	Countries      []string  `json:"countries,omitempty"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	AmountFactor   float64   `json:"amount_factor,omitempty"`
+	VelocityFactor float64   `json:"velocity_factor,omitempty"`
+	// AllowNight keeps the unusual time rule from firing, for events with
+	// night-time sales
+	AllowNight bool `json:"allow_night,omitempty"`
+}
+
+// Validate checks the name, period and factors of an event
+func (e CalendarEvent) Validate() error {
+	if e.Name == "" {
+		return errors.New("name is required")
+	}
+	if e.Start.IsZero() || !e.End.After(e.Start) {
+		return fmt.Errorf("event %s: end must be after start", e.Name)
+	}
+	if e.AmountFactor < 0 || e.VelocityFactor < 0 {
+		return fmt.Errorf("event %s: factors must not be negative", e.Name)
+	}
+	return nil
+}
+
+// covers reports whether the event runs for a country at a time
+func (e CalendarEvent) covers(country string, t time.Time) bool {
+	if t.Before(e.Start) || !t.Before(e.End) {
+		return false
+	}
+	if len(e.Countries) == 0 {
+		return true
+	}
+	for _, c := range e.Countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// CalendarEffect combines the events running for a transaction. The factors
+// of overlapping events are multiplied.
+type CalendarEffect struct {
+	Events         []string `json:"events"`
+	AmountFactor   float64  `json:"amount_factor"`
+	VelocityFactor float64  `json:"velocity_factor"`
+	AllowNight     bool     `json:"allow_night,omitempty"`
+}
+
+func (e *CalendarEffect) amountFactor() float64 {
+	if e == nil {
+		return 1
+	}
+	return e.AmountFactor
+}
+
+func (e *CalendarEffect) allowNight() bool {
+	return e != nil && e.AllowNight
+}
+
+// velocityLimit scales a velocity limit, keeping it at least 1
+func (e *CalendarEffect) velocityLimit(limit int) int {
+	if e == nil {
+		return limit
+	}
+	return int(math.Max(1, math.Round(float64(limit)*e.VelocityFactor)))
+}
+
+// eventNames exposes the running events to expressions
+func (e *CalendarEffect) eventNames() []interface{} {
+	names := make([]interface{}, 0)
+	if e != nil {
+		for _, name := range e.Events {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Calendar holds the events that scale detection thresholds
+type Calendar struct {
+	events []CalendarEvent
+	mu     sync.RWMutex
+}
+
+func NewCalendar() *Calendar {
+	return &Calendar{}
+}
+
+// Set validates and replaces the events
+func (c *Calendar) Set(events []CalendarEvent) error {
+	for _, event := range events {
+		if err := event.Validate(); err != nil {
+			return err
+		}
+	}
+	sorted := append([]CalendarEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = sorted
+	return nil
+}
+
+// Events returns the events, earliest first
+func (c *Calendar) Events() []CalendarEvent {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]CalendarEvent{}, c.events...)
+}
+
+// Effect returns the combined effect of the events running for a
+// transaction, or nil when none is
+func (c *Calendar) Effect(tx *Transaction) *CalendarEffect {
+	country := tx.Location.Country
+	if country == "" {
+		country = tx.MerchantCountry
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var effect *CalendarEffect
+	for _, event := range c.events {
+		if !event.covers(country, tx.Timestamp) {
+			continue
+		}
+		if effect == nil {
+			effect = &CalendarEffect{AmountFactor: 1, VelocityFactor: 1}
+		}
+		effect.Events = append(effect.Events, event.Name)
+		if event.AmountFactor > 0 {
+			effect.AmountFactor *= event.AmountFactor
+		}
+		if event.VelocityFactor > 0 {
+			effect.VelocityFactor *= event.VelocityFactor
+		}
+		effect.AllowNight = effect.AllowNight || event.AllowNight
+	}
+	return effect
+}
+
+// LoadCalendar reads calendar events as a JSON array:
+// [{"name": "black_friday", "countries": ["US"], "start": "2024-11-29T00:00:00-05:00", ...}]
+func LoadCalendar(r io.Reader) (*Calendar, error) {
+	var events []CalendarEvent
+	if err := json.NewDecoder(r).Decode(&events); err != nil {
+		return nil, fmt.Errorf("invalid calendar: %w", err)
+	}
+	calendar := NewCalendar()
+	if err := calendar.Set(events); err != nil {
+		return nil, fmt.Errorf("invalid calendar: %w", err)
+	}
+	return calendar, nil
+}
+
+// LoadCalendarFile reads calendar events from disk
+func LoadCalendarFile(path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCalendar(f)
+}
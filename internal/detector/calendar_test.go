@@ -0,0 +1,91 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var blackFriday = time.Date(2024, 11, 29, 3, 0, 0, 0, time.UTC)
+
+func TestCalendar_Effect(t *testing.T) {
+	calendar, err := detector.LoadCalendar(strings.NewReader(`[
+		{"name": "black_friday", "countries": ["US", "CA"], "start": "2024-11-29T00:00:00Z", "end": "2024-12-03T00:00:00Z",
+		 "amount_factor": 2, "velocity_factor": 1.5, "allow_night": true},
+		{"name": "card_testing_wave", "start": "2024-11-28T00:00:00Z", "end": "2024-11-30T00:00:00Z", "velocity_factor": 0.5}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, calendar.Events(), 2)
+	assert.Equal(t, "card_testing_wave", calendar.Events()[0].Name, "earliest first")
+
+	effect := calendar.Effect(&detector.Transaction{Timestamp: blackFriday, Location: detector.Location{Country: "us"}})
+	require.NotNil(t, effect)
+	assert.Equal(t, []string{"card_testing_wave", "black_friday"}, effect.Events)
+	assert.Equal(t, 2.0, effect.AmountFactor)
+	assert.Equal(t, 0.75, effect.VelocityFactor)
+	assert.True(t, effect.AllowNight)
+
+	// The merchant country stands in for a missing location
+	effect = calendar.Effect(&detector.Transaction{Timestamp: blackFriday, MerchantCountry: "BR"})
+	require.NotNil(t, effect)
+	assert.Equal(t, []string{"card_testing_wave"}, effect.Events)
+	assert.False(t, effect.AllowNight)
+
+	assert.Nil(t, calendar.Effect(&detector.Transaction{Timestamp: blackFriday.AddDate(0, 0, 4), Location: newYork}), "end is exclusive")
+
+	_, err = detector.LoadCalendar(strings.NewReader(`[{"name": "backwards", "start": "2024-11-29T00:00:00Z", "end": "2024-11-28T00:00:00Z"}]`))
+	assert.Error(t, err)
+	assert.Error(t, detector.NewCalendar().Set([]detector.CalendarEvent{{Start: blackFriday, End: blackFriday.Add(time.Hour)}}), "name is required")
+}
+
+func TestDetector_Analyze_CalendarEvents(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 4, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	now := time.Now()
+	calendar := detector.NewCalendar()
+	require.NoError(t, calendar.Set([]detector.CalendarEvent{
+		{Name: "black_friday", Countries: []string{"US"}, Start: blackFriday.Add(-3 * time.Hour), End: blackFriday.Add(21 * time.Hour), AmountFactor: 2, AllowNight: true},
+		{Name: "surge", Countries: []string{"GB"}, Start: now.Add(-time.Hour), End: now.Add(time.Hour), VelocityFactor: 0.5},
+	}))
+	d.SetCalendar(calendar)
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "DURING_BLACK_FRIDAY",
+		Expression: "'black_friday' in tx.calendar_events",
+		Score:      0.05,
+	}))
+
+	analyze := func(id string, at time.Time, amount float64, location detector.Location) *detector.FraudScore {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID:        id,
+			AccountID: "ACC-" + location.Country,
+			Amount:    amount,
+			Timestamp: at,
+			Location:  location,
+		})
+		require.NoError(t, err)
+		return score
+	}
+
+	// Amounts and night-time shopping are relaxed during the peak
+	score := analyze("TXN-1", blackFriday, 15000.5, newYork)
+	assert.NotContains(t, score.ReasonCodes, "HIGH_AMOUNT")
+	assert.NotContains(t, score.ReasonCodes, "UNUSUAL_TIME")
+	assert.Contains(t, score.ReasonCodes, "DURING_BLACK_FRIDAY")
+	assert.Contains(t, analyze("TXN-2", blackFriday.Add(time.Minute), 25000.5, newYork).ReasonCodes, "HIGH_AMOUNT")
+	assert.Contains(t, analyze("TXN-3", blackFriday.AddDate(0, 0, 7), 100.5, newYork).ReasonCodes, "UNUSUAL_TIME",
+		"after the peak")
+
+	// The velocity limit is tightened from 4 to 2 during the surge
+	london := detector.Location{Latitude: 51.5074, Longitude: -0.1278, Country: "GB", City: "London"}
+	for i := 0; i < 2; i++ {
+		assert.NotContains(t, analyze(fmt.Sprintf("TXN-GB-%d", i), now, 50.5, london).ReasonCodes, "HIGH_VELOCITY")
+	}
+	score = analyze("TXN-GB-2", now, 50.5, london)
+	assert.Contains(t, score.ReasonCodes, "HIGH_VELOCITY")
+	assert.NotContains(t, score.ReasonCodes, "DURING_BLACK_FRIDAY")
+}
@@ -0,0 +1,236 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clearing transaction types
+const (
+	TypeACH  = "ACH"
+	TypeSEPA = "SEPA"
+)
+
+// ClearingDetails holds the bank clearing information of ACH and SEPA
+// transfers
+type ClearingDetails struct {
+	// AccountHash identifies the payee bank account by a hash of its IBAN, or
+	// of its routing and account numbers; never the raw numbers
+	AccountHash string `json:"account_hash"`
+	// Scheme is the SEPA scheme (SCT, SCT_INST, SDD_CORE, SDD_B2B) or the
+	// ACH SEC code (PPD, CCD, WEB)
+	Scheme string `json:"scheme,omitempty"`
+	// SettlementDate is the requested settlement date, the submission day
+	// when unset
+	SettlementDate time.Time `json:"settlement_date,omitempty"`
+}
+
+// ClearingConfig holds ACH and SEPA transfer settings. Cutoffs is the daily
+// submission cutoff of each clearing type as the time since midnight UTC;
+// transfers settling the same day and submitted within CutoffWindow before it
+// are near the cutoff. Instant schemes have no cutoff. More than BatchSize
+// transfers of round amounts, multiples of RoundUnit, from one sender to
+// distinct accounts within BatchWindow look like a salary batch.
+type ClearingConfig struct {
+	Cutoffs      map[string]time.Duration
+	CutoffWindow time.Duration
+	// LargeAmount is the amount from which a first transfer to an account
+	// is flagged
+	LargeAmount         float64
+	BatchWindow         time.Duration
+	BatchSize           int
+	RoundUnit           float64
+	NewBeneficiaryScore float64
+	CutoffScore         float64
+	BatchScore          float64
+}
+
+// DefaultClearingConfig returns the default ACH and SEPA transfer settings
+func DefaultClearingConfig() ClearingConfig {
+	return ClearingConfig{
+		Cutoffs: map[string]time.Duration{
+			TypeACH:  20*time.Hour + 45*time.Minute,
+			TypeSEPA: 15 * time.Hour,
+		},
+		CutoffWindow:        30 * time.Minute,
+		LargeAmount:         1000,
+		BatchWindow:         time.Hour,
+		BatchSize:           5,
+		RoundUnit:           100,
+		NewBeneficiaryScore: 0.2,
+		CutoffScore:         0.15,
+		BatchScore:          0.4,
+	}
+}
+
+func (c ClearingConfig) withDefaults() ClearingConfig {
+	defaults := DefaultClearingConfig()
+	if c.Cutoffs == nil {
+		c.Cutoffs = defaults.Cutoffs
+	}
+	if c.CutoffWindow <= 0 {
+		c.CutoffWindow = defaults.CutoffWindow
+	}
+	if c.LargeAmount <= 0 {
+		c.LargeAmount = defaults.LargeAmount
+	}
+	if c.BatchWindow <= 0 {
+		c.BatchWindow = defaults.BatchWindow
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaults.BatchSize
+	}
+	if c.RoundUnit <= 0 {
+		c.RoundUnit = defaults.RoundUnit
+	}
+	if c.NewBeneficiaryScore <= 0 {
+		c.NewBeneficiaryScore = defaults.NewBeneficiaryScore
+	}
+	if c.CutoffScore <= 0 {
+		c.CutoffScore = defaults.CutoffScore
+	}
+	if c.BatchScore <= 0 {
+		c.BatchScore = defaults.BatchScore
+	}
+	return c
+}
+
+// Clearing reason codes. Layers switch them off like rules.
+const (
+	ReasonClearingNewBeneficiary = "CLEARING_NEW_BENEFICIARY"
+	ReasonClearingNearCutoff     = "CLEARING_NEAR_CUTOFF"
+	ReasonClearingSalaryBatch    = "CLEARING_SALARY_BATCH"
+)
+
+// IsClearing reports whether the transaction is an ACH or SEPA transfer
+func IsClearing(tx *Transaction) bool {
+	switch strings.ToUpper(tx.Type) {
+	case TypeACH, TypeSEPA:
+		return tx.Clearing != nil && tx.Clearing.AccountHash != ""
+	}
+	return false
+}
+
+// ClearingResult is the outcome of the clearing checks
+type ClearingResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+	// Review is set when a salary-like batch was found
+	Review bool
+}
+
+// ClearingTracker keeps, per sender, the bank accounts paid before and the
+// recent round-amount transfers
+type ClearingTracker struct {
+	config  ClearingConfig
+	senders map[string]*clearingSender
+	mu      sync.Mutex
+}
+
+type clearingSender struct {
+	payees map[string]bool
+	round  []roundTransfer
+}
+
+type roundTransfer struct {
+	at      time.Time
+	account string
+}
+
+func NewClearingTracker(config ClearingConfig) *ClearingTracker {
+	return &ClearingTracker{
+		config:  config.withDefaults(),
+		senders: make(map[string]*clearingSender),
+	}
+}
+
+// Check evaluates an ACH or SEPA transfer against the sender's history, then
+// records it. Other transactions are ignored.
+func (c *ClearingTracker) Check(tx *Transaction) ClearingResult {
+	result := ClearingResult{}
+	if !IsClearing(tx) {
+		return result
+	}
+	flag := func(code string, score float64, reason string) {
+		if tx.overrides.ruleDisabled(code) {
+			return
+		}
+		result.Score += score
+		result.Codes = append(result.Codes, code)
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	if c.nearCutoff(tx) {
+		flag(ReasonClearingNearCutoff, c.config.CutoffScore,
+			fmt.Sprintf("%s transfer submitted within %s of the clearing cutoff", strings.ToUpper(tx.Type), c.config.CutoffWindow))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sender, exists := c.senders[tx.AccountID]
+	if !exists {
+		sender = &clearingSender{payees: make(map[string]bool)}
+		c.senders[tx.AccountID] = sender
+	}
+	account := tx.Clearing.AccountHash
+	if !sender.payees[account] && tx.Amount >= c.config.LargeAmount {
+		flag(ReasonClearingNewBeneficiary, c.config.NewBeneficiaryScore,
+			fmt.Sprintf("First %s transfer of %.2f to this bank account", strings.ToUpper(tx.Type), tx.Amount))
+	}
+	sender.payees[account] = true
+
+	if isRoundAmount(tx.Amount, c.config.RoundUnit) {
+		cutoff := tx.Timestamp.Add(-c.config.BatchWindow)
+		recent := sender.round[:0]
+		for _, transfer := range sender.round {
+			if !transfer.at.Before(cutoff) {
+				recent = append(recent, transfer)
+			}
+		}
+		sender.round = append(recent, roundTransfer{at: tx.Timestamp, account: account})
+
+		accounts := make(map[string]bool)
+		for _, transfer := range sender.round {
+			accounts[transfer.account] = true
+		}
+		if len(accounts) > c.config.BatchSize {
+			before := len(result.Codes)
+			flag(ReasonClearingSalaryBatch, c.config.BatchScore,
+				fmt.Sprintf("%d round-amount transfers to distinct accounts within %s", len(accounts), c.config.BatchWindow))
+			result.Review = len(result.Codes) > before
+		}
+	}
+	return result
+}
+
+// nearCutoff reports whether a transfer settling the day it is submitted was
+// submitted just before its clearing type's cutoff
+func (c *ClearingTracker) nearCutoff(tx *Transaction) bool {
+	if strings.HasSuffix(strings.ToUpper(tx.Clearing.Scheme), "_INST") {
+		return false
+	}
+	cutoff, exists := c.config.Cutoffs[strings.ToUpper(tx.Type)]
+	if !exists {
+		return false
+	}
+
+	submitted := tx.Timestamp.UTC()
+	day := time.Date(submitted.Year(), submitted.Month(), submitted.Day(), 0, 0, 0, 0, time.UTC)
+	if settlement := tx.Clearing.SettlementDate; !settlement.IsZero() {
+		settlement = settlement.UTC()
+		if settlement.Year() != day.Year() || settlement.YearDay() != day.YearDay() {
+			return false
+		}
+	}
+	untilCutoff := day.Add(cutoff).Sub(submitted)
+	return untilCutoff > 0 && untilCutoff <= c.config.CutoffWindow
+}
+
+func isRoundAmount(amount, unit float64) bool {
+	return amount >= unit && math.Mod(amount, unit) == 0
+}
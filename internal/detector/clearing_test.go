@@ -0,0 +1,95 @@
+package detector_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clearingTransfer(sender, kind, account string, amount float64, at time.Time) *detector.Transaction {
+	return &detector.Transaction{
+		ID:        fmt.Sprintf("%s-%s-%d", sender, account, at.UnixNano()),
+		AccountID: sender,
+		Amount:    amount,
+		Type:      kind,
+		Timestamp: at,
+		Clearing:  &detector.ClearingDetails{AccountHash: account, Scheme: "SCT"},
+	}
+}
+
+func TestClearingTracker_FirstTransferToAccount(t *testing.T) {
+	tracker := detector.NewClearingTracker(detector.DefaultClearingConfig())
+	morning := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	result := tracker.Check(clearingTransfer("ACC-1", "sepa", "HASH-A", 2500, morning))
+	assert.Equal(t, []string{detector.ReasonClearingNewBeneficiary}, result.Codes)
+	assert.Empty(t, tracker.Check(clearingTransfer("ACC-1", "sepa", "HASH-A", 2500, morning.Add(time.Hour))).Codes, "paid before")
+	assert.Empty(t, tracker.Check(clearingTransfer("ACC-1", "ach", "HASH-B", 40, morning)).Codes, "small amounts are fine")
+
+	card := clearingTransfer("ACC-1", "card", "HASH-C", 2500, morning)
+	assert.Empty(t, tracker.Check(card).Codes, "only ACH and SEPA")
+}
+
+func TestClearingTracker_NearCutoff(t *testing.T) {
+	tracker := detector.NewClearingTracker(detector.DefaultClearingConfig())
+	beforeCutoff := time.Date(2026, 4, 1, 14, 45, 0, 0, time.UTC)
+
+	tx := clearingTransfer("ACC-1", "sepa", "HASH-A", 50, beforeCutoff)
+	assert.Equal(t, []string{detector.ReasonClearingNearCutoff}, tracker.Check(tx).Codes)
+
+	tx = clearingTransfer("ACC-1", "sepa", "HASH-A", 50, beforeCutoff)
+	tx.Clearing.SettlementDate = beforeCutoff.Add(24 * time.Hour)
+	assert.Empty(t, tracker.Check(tx).Codes, "settles another day")
+
+	tx = clearingTransfer("ACC-1", "sepa", "HASH-A", 50, beforeCutoff)
+	tx.Clearing.Scheme = "SCT_INST"
+	assert.Empty(t, tracker.Check(tx).Codes, "instant schemes have no cutoff")
+
+	assert.Empty(t, tracker.Check(clearingTransfer("ACC-1", "sepa", "HASH-A", 50, beforeCutoff.Add(time.Hour))).Codes, "after the cutoff")
+	assert.Equal(t, []string{detector.ReasonClearingNearCutoff},
+		tracker.Check(clearingTransfer("ACC-1", "ach", "HASH-A", 50, time.Date(2026, 4, 1, 20, 30, 0, 0, time.UTC))).Codes)
+}
+
+func TestClearingTracker_SalaryBatch(t *testing.T) {
+	config := detector.DefaultClearingConfig()
+	tracker := detector.NewClearingTracker(config)
+	morning := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	var result detector.ClearingResult
+	for i := 0; i <= config.BatchSize; i++ {
+		result = tracker.Check(clearingTransfer("PAYROLL", "ach", fmt.Sprintf("HASH-%d", i), 900, morning.Add(time.Duration(i)*time.Minute)))
+	}
+	assert.Equal(t, []string{detector.ReasonClearingSalaryBatch}, result.Codes)
+	assert.True(t, result.Review)
+
+	result = tracker.Check(clearingTransfer("PAYROLL", "ach", "HASH-X", 912.37, morning.Add(10*time.Minute)))
+	assert.Empty(t, result.Codes, "only round amounts")
+	result = tracker.Check(clearingTransfer("PAYROLL", "ach", "HASH-Y", 900, morning.Add(3*time.Hour)))
+	assert.Empty(t, result.Codes, "the batch window has passed")
+}
+
+type resolverFunc func(merchantID string) *detector.Overrides
+
+func (f resolverFunc) Overrides(merchantID string) *detector.Overrides {
+	return f(merchantID)
+}
+
+func TestDetector_ClearingCodesDisabledByOverrides(t *testing.T) {
+	at := time.Date(2026, 4, 1, 14, 45, 0, 0, time.UTC)
+	fd := detector.NewFraudDetector()
+	score, err := fd.AnalyzeTransaction(clearingTransfer("ACC-1", "sepa", "HASH-A", 50, at))
+	require.NoError(t, err)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonClearingNearCutoff)
+
+	fd.SetOverrideResolver(resolverFunc(func(merchantID string) *detector.Overrides {
+		return &detector.Overrides{DisabledRules: map[string]bool{detector.ReasonClearingNearCutoff: true}}
+	}))
+
+	score, err = fd.AnalyzeTransaction(clearingTransfer("ACC-2", "sepa", "HASH-A", 50, at))
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonClearingNearCutoff)
+}
@@ -0,0 +1,86 @@
+package detector
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the time-based checks, such as velocity windows,
+// travel speed and reputation decay, so they can run on another time than
+// the wall clock's
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock returns the wall clock
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// ManualClock is a clock that only moves when told to, for tests
+type ManualClock struct {
+	now time.Time
+	mu  sync.RWMutex
+}
+
+// NewManualClock returns a clock stopped at a time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Set stops the clock at a time
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// ReplayClock tells the time of the latest transaction the detector
+// analyzed, for replays and backtests of past transactions. It never goes
+// backwards, so a transaction arriving out of order does not rewind the
+// windows of the others.
+type ReplayClock struct {
+	ManualClock
+}
+
+// NewReplayClock returns a clock starting at a time, usually the start of
+// the replayed period; from the zero time it starts at the first
+// transaction
+func NewReplayClock(start time.Time) *ReplayClock {
+	return &ReplayClock{ManualClock{now: start}}
+}
+
+// Observe moves the clock forward to the time of a transaction
+func (c *ReplayClock) Observe(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if at.After(c.now) {
+		c.now = at
+	}
+}
+
+// observeTime moves a replay clock to the time of a transaction
+func (d *Detector) observeTime(tx *Transaction) {
+	if clock, replaying := d.clock.(*ReplayClock); replaying && !tx.Timestamp.IsZero() {
+		clock.Observe(tx.Timestamp)
+	}
+}
@@ -0,0 +1,92 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector_ManualClock(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := detector.NewManualClock(start)
+	velocity := detector.NewVelocityTracker(time.Hour)
+	d := detector.NewDetectorWith(
+		detector.Config{MaxVelocity: 2, VelocityWindow: time.Hour},
+		detector.Components{Velocity: velocity, Clock: clock})
+
+	analyze := func() *detector.FraudScore {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID:        "TX-CLOCK",
+			AccountID: "ACC-1",
+			Amount:    25,
+			Currency:  "USD",
+			Timestamp: clock.Now(),
+		})
+		require.NoError(t, err)
+		return score
+	}
+
+	analyze()
+	analyze()
+	score := analyze()
+	assert.Contains(t, score.ReasonCodes, "HIGH_VELOCITY")
+	assert.Equal(t, start, score.Timestamp)
+
+	clock.Advance(2 * time.Hour)
+	assert.Zero(t, velocity.GetCount("ACC-1"), "the window moves with the clock")
+	assert.NotContains(t, analyze().ReasonCodes, "HIGH_VELOCITY")
+}
+
+func TestDetector_ReplayClock(t *testing.T) {
+	clock := detector.NewReplayClock(time.Time{})
+	velocity := detector.NewVelocityTracker(time.Hour)
+	d := detector.NewDetectorWith(
+		detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour},
+		detector.Components{Velocity: velocity, Clock: clock})
+
+	// Replayed transactions from years ago still count within their window
+	at := time.Date(2023, 5, 10, 9, 0, 0, 0, time.UTC)
+	newYork := detector.Location{Latitude: 40.71, Longitude: -74.01, Country: "US"}
+	tokyo := detector.Location{Latitude: 35.68, Longitude: 139.69, Country: "JP"}
+	for i, tx := range []*detector.Transaction{
+		{ID: "TX-1", AccountID: "ACC-R", Amount: 30, Currency: "USD", Timestamp: at, Location: newYork},
+		{ID: "TX-2", AccountID: "ACC-R", Amount: 30, Currency: "USD", Timestamp: at.Add(30 * time.Minute), Location: tokyo},
+	} {
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		if i == 1 {
+			assert.Contains(t, score.ReasonCodes, detector.ReasonImpossibleTravel)
+		}
+	}
+	assert.Equal(t, at.Add(30*time.Minute), clock.Now())
+	assert.Equal(t, 2, velocity.GetCount("ACC-R"))
+
+	// An out-of-order transaction does not rewind the clock
+	clock.Observe(at)
+	assert.Equal(t, at.Add(30*time.Minute), clock.Now())
+}
+
+func TestDetector_ClockStampsSignupsAndPromos(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := detector.NewManualClock(start)
+	d := detector.NewDetectorWith(
+		detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour},
+		detector.Components{Clock: clock})
+
+	assert.Empty(t, d.CheckSignup(detector.Signup{AccountID: "ACC-1", EmailHash: "h1"}).Matches)
+	clock.Advance(31 * 24 * time.Hour)
+	assert.Empty(t, d.CheckSignup(detector.Signup{AccountID: "ACC-2", EmailHash: "h1"}).Matches,
+		"signups without a timestamp are stamped by the clock, so the first left the window")
+
+	_, err := d.Analyze(context.Background(), &detector.Transaction{
+		ID: "TX-PROMO", AccountID: "ACC-2", Amount: 10, Currency: "USD", Timestamp: clock.Now(), CampaignID: "WELCOME",
+	})
+	require.NoError(t, err)
+	decisions := d.PromoDecisions(time.Time{}, "WELCOME")
+	require.Len(t, decisions, 1)
+	assert.Equal(t, clock.Now(), decisions[0].DecidedAt)
+}
@@ -6,53 +6,83 @@ import (
 	"time"
 )
 
-// VelocityTracker tracks transaction velocity
+// VelocityTracker tracks transaction velocity. Each key counts its
+// transactions in a ring of velocityBuckets buckets spanning the window, so
+// tracking and counting take constant time and memory per key is bounded
+// however many transactions it makes.
 type VelocityTracker struct {
-	window   time.Duration
+	window time.Duration
+	// width is the span of time a bucket counts
+	width    time.Duration
 	accounts map[string]*accountVelocity
+	clock    Clock
 	mu       sync.RWMutex
 }
 
+// velocityBuckets is the number of buckets a window is split into: per-second
+// buckets for the default one-minute window. Counts are exact to a bucket's
+// width.
+const velocityBuckets = 60
+
+// accountVelocity counts the transactions of a key. A slot numbers a span of
+// bucket width since the epoch; bucket slot%velocityBuckets holds the count of
+// that slot, and a bucket holding an older slot is stale.
 type accountVelocity struct {
-	transactions []time.Time
-	mu          sync.Mutex
+	slots  [velocityBuckets]int64
+	counts [velocityBuckets]int
+	mu     sync.Mutex
 }
 
 func NewVelocityTracker(window time.Duration) *VelocityTracker {
+	width := window / velocityBuckets
+	if width <= 0 {
+		width = 1
+	}
 	return &VelocityTracker{
 		window:   window,
+		width:    width,
 		accounts: make(map[string]*accountVelocity),
+		clock:    SystemClock(),
 	}
 }
 
 func (v *VelocityTracker) Track(tx *Transaction) {
-	v.mu.Lock()
-	if _, exists := v.accounts[tx.AccountID]; !exists {
-		v.accounts[tx.AccountID] = &accountVelocity{
-			transactions: []time.Time{},
-		}
+	v.TrackKey(tx.AccountID, tx.Timestamp)
+}
+
+// TrackKey records a transaction at the given time under any key, such as a
+// payment instrument. Transactions older than the window are not counted and
+// ones stamped in the future count as now.
+func (v *VelocityTracker) TrackKey(key string, at time.Time) {
+	now := v.slot(v.clock.Now())
+	slot := v.slot(at)
+	if slot > now {
+		slot = now
+	}
+	if slot <= now-velocityBuckets {
+		return
 	}
-	v.mu.Unlock()
 
 	v.mu.RLock()
-	acc := v.accounts[tx.AccountID]
+	acc, exists := v.accounts[key]
 	v.mu.RUnlock()
-
-	acc.mu.Lock()
-	defer acc.mu.Unlock()
-
-	// Clean old transactions
-	cutoff := time.Now().Add(-v.window)
-	newTxs := []time.Time{}
-	for _, t := range acc.transactions {
-		if t.After(cutoff) {
-			newTxs = append(newTxs, t)
+	if !exists {
+		v.mu.Lock()
+		if acc, exists = v.accounts[key]; !exists {
+			acc = &accountVelocity{}
+			v.accounts[key] = acc
 		}
+		v.mu.Unlock()
 	}
-	acc.transactions = append(newTxs, tx.Timestamp)
+
+	acc.mu.Lock()
+	acc.add(slot)
+	acc.mu.Unlock()
 }
 
-func (v *VelocityTracker) GetCount(accountID string) int {
+// CountSince counts the transactions of an account within a window. Only
+// transactions within the tracker's own window are retained.
+func (v *VelocityTracker) CountSince(accountID string, window time.Duration) int {
 	v.mu.RLock()
 	acc, exists := v.accounts[accountID]
 	v.mu.RUnlock()
@@ -61,33 +91,152 @@ func (v *VelocityTracker) GetCount(accountID string) int {
 		return 0
 	}
 
+	// The window covers the current slot and the ones before it
+	span := int64((window + v.width - 1) / v.width)
+	if span > velocityBuckets {
+		span = velocityBuckets
+	}
+	now := v.slot(v.clock.Now())
+
 	acc.mu.Lock()
 	defer acc.mu.Unlock()
 
-	cutoff := time.Now().Add(-v.window)
 	count := 0
-	for _, t := range acc.transactions {
-		if t.After(cutoff) {
-			count++
+	for i, slot := range acc.slots {
+		if slot > now-span && slot <= now {
+			count += acc.counts[i]
 		}
 	}
 	return count
 }
 
+func (v *VelocityTracker) GetCount(accountID string) int {
+	return v.CountSince(accountID, v.window)
+}
+
+// Snapshot returns the tracked transaction times of every key, oldest first.
+// Times are rounded down to the start of their bucket.
+func (v *VelocityTracker) Snapshot() map[string][]time.Time {
+	now := v.slot(v.clock.Now())
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	snapshot := make(map[string][]time.Time, len(v.accounts))
+	for key, acc := range v.accounts {
+		var times []time.Time
+		acc.mu.Lock()
+		// Walk the ring from the oldest live slot
+		for slot := now - velocityBuckets + 1; slot <= now; slot++ {
+			i := bucketIndex(slot)
+			if acc.slots[i] != slot {
+				continue
+			}
+			at := time.Unix(0, slot*int64(v.width))
+			for n := 0; n < acc.counts[i]; n++ {
+				times = append(times, at)
+			}
+		}
+		acc.mu.Unlock()
+		snapshot[key] = times
+	}
+	return snapshot
+}
+
+// Restore replaces the tracked transaction times. Times older than the
+// window are dropped.
+func (v *VelocityTracker) Restore(snapshot map[string][]time.Time) {
+	accounts := v.velocities(snapshot)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.accounts = accounts
+}
+
+// RestoreKeys replaces the tracked transaction times of the keys of a
+// snapshot, keeping those of the other keys
+func (v *VelocityTracker) RestoreKeys(snapshot map[string][]time.Time) {
+	accounts := v.velocities(snapshot)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for key, acc := range accounts {
+		v.accounts[key] = acc
+	}
+}
+
+// velocities counts the transaction times of a snapshot within the window
+func (v *VelocityTracker) velocities(snapshot map[string][]time.Time) map[string]*accountVelocity {
+	now := v.slot(v.clock.Now())
+	accounts := make(map[string]*accountVelocity, len(snapshot))
+	for key, times := range snapshot {
+		acc := &accountVelocity{}
+		for _, at := range times {
+			slot := v.slot(at)
+			if slot > now {
+				slot = now
+			}
+			if slot > now-velocityBuckets {
+				acc.add(slot)
+			}
+		}
+		accounts[key] = acc
+	}
+	return accounts
+}
+
+// slot returns the bucket-width span of time t falls in
+func (v *VelocityTracker) slot(t time.Time) int64 {
+	return t.UnixNano() / int64(v.width)
+}
+
+// add counts a transaction in a slot, resetting its bucket when it held an
+// older slot. The slot must be within the window. Callers must hold the lock.
+func (a *accountVelocity) add(slot int64) {
+	i := bucketIndex(slot)
+	if a.slots[i] != slot {
+		a.slots[i] = slot
+		a.counts[i] = 0
+	}
+	a.counts[i]++
+}
+
+func bucketIndex(slot int64) int {
+	i := int(slot % velocityBuckets)
+	if i < 0 {
+		i += velocityBuckets
+	}
+	return i
+}
+
 // GeoAnalyzer analyzes geographical patterns
 type GeoAnalyzer struct {
-	lastLocations map[string]*locationData
-	mu           sync.RWMutex
+	history    map[string][]LocationRecord
+	maxHistory int
+	clock      Clock
+	mu         sync.RWMutex
 }
 
-type locationData struct {
-	location Location
-	time     time.Time
+// LocationRecord is a location an account transacted from, at the time of
+// the transaction
+type LocationRecord struct {
+	Location Location  `json:"location"`
+	Time     time.Time `json:"time"`
 }
 
 func NewGeoAnalyzer() *GeoAnalyzer {
+	return NewGeoAnalyzerWithHistory(DefaultGeoConfig().HistorySize)
+}
+
+// NewGeoAnalyzerWithHistory keeps the last size locations of each account
+func NewGeoAnalyzerWithHistory(size int) *GeoAnalyzer {
+	if size < 1 {
+		size = 1
+	}
 	return &GeoAnalyzer{
-		lastLocations: make(map[string]*locationData),
+		history:    make(map[string][]LocationRecord),
+		maxHistory: size,
+		clock:      SystemClock(),
 	}
 }
 
@@ -95,8 +244,9 @@ func (g *GeoAnalyzer) GetLastLocation(accountID string) *Location {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	if data, exists := g.lastLocations[accountID]; exists {
-		return &data.location
+	if history := g.history[accountID]; len(history) > 0 {
+		location := history[len(history)-1].Location
+		return &location
 	}
 	return nil
 }
@@ -105,23 +255,71 @@ func (g *GeoAnalyzer) GetLastTime(accountID string) time.Time {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	if data, exists := g.lastLocations[accountID]; exists {
-		return data.time
+	if history := g.history[accountID]; len(history) > 0 {
+		return history[len(history)-1].Time
 	}
 	return time.Time{}
 }
 
+// History returns the recent locations of an account, oldest first
+func (g *GeoAnalyzer) History(accountID string) []LocationRecord {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	history := make([]LocationRecord, len(g.history[accountID]))
+	copy(history, g.history[accountID])
+	return history
+}
+
+// appendHistory appends the recent locations of an account to dst, so the
+// hot path can copy them into a buffer on the stack
+func (g *GeoAnalyzer) appendHistory(dst []LocationRecord, accountID string) []LocationRecord {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return append(dst, g.history[accountID]...)
+}
+
+// UpdateLocation records a location of an account now
 func (g *GeoAnalyzer) UpdateLocation(accountID string, loc Location) {
+	g.RecordLocation(accountID, loc, g.clock.Now())
+}
+
+// RecordLocation records a location of an account at a time. The history
+// stays in time order, so a late transaction takes its place among the
+// earlier ones; past the history size the oldest location is dropped, which
+// may be the late one itself.
+func (g *GeoAnalyzer) RecordLocation(accountID string, loc Location, at time.Time) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	g.lastLocations[accountID] = &locationData{
-		location: loc,
-		time:     time.Now(),
+	history := g.history[accountID]
+	i := len(history)
+	for i > 0 && history[i-1].Time.After(at) {
+		i--
 	}
+	record := LocationRecord{Location: loc, Time: at}
+	if len(history) == g.maxHistory {
+		if i == 0 {
+			return
+		}
+		// Drop the oldest location to make room
+		copy(history, history[1:i])
+		history[i-1] = record
+		return
+	}
+	history = append(history, LocationRecord{})
+	copy(history[i+1:], history[i:])
+	history[i] = record
+	g.history[accountID] = history
 }
 
 func (g *GeoAnalyzer) CalculateDistance(loc1, loc2 Location) float64 {
+	return distanceKm(loc1, loc2)
+}
+
+// distanceKm returns the great-circle distance between two locations
+func distanceKm(loc1, loc2 Location) float64 {
 	const earthRadius = 6371.0 // km
 
 	lat1Rad := loc1.Latitude * math.Pi / 180
@@ -155,18 +353,34 @@ func NewPatternMatcher() *PatternMatcher {
 	}
 }
 
+// NewPatternMatcherWithAmounts creates a matcher with the given amount
+// patterns per currency
+func NewPatternMatcherWithAmounts(amounts AmountPatternConfig) *PatternMatcher {
+	return &PatternMatcher{
+		patterns: patternsWithAmounts(amounts),
+	}
+}
+
 func (p *PatternMatcher) Match(tx *Transaction) (float64, []string) {
+	totalScore, reasons, _ := p.MatchCodes(tx)
+	return totalScore, reasons
+}
+
+// MatchCodes is like Match but also returns the names of matched patterns
+func (p *PatternMatcher) MatchCodes(tx *Transaction) (float64, []string, []string) {
 	totalScore := 0.0
 	reasons := []string{}
+	codes := []string{}
 
 	for _, pattern := range p.patterns {
 		if pattern.Matcher(tx) {
 			totalScore += pattern.Score
 			reasons = append(reasons, pattern.Description)
+			codes = append(codes, pattern.Name)
 		}
 	}
 
-	return totalScore, reasons
+	return totalScore, reasons, codes
 }
 
 // MLModel represents the machine learning model interface
@@ -224,7 +438,7 @@ func DefaultRules() []Rule {
 			Name:        "High Amount Detection",
 			Description: "Transaction amount exceeds threshold",
 			Condition: func(tx *Transaction) bool {
-				return tx.Amount > 10000
+				return highAmount(tx)
 			},
 			Score:  0.3,
 			Action: "REVIEW",
@@ -235,7 +449,7 @@ func DefaultRules() []Rule {
 			Description: "Transaction at unusual hours",
 			Condition: func(tx *Transaction) bool {
 				hour := tx.Timestamp.Hour()
-				return hour >= 2 && hour <= 5
+				return hour >= 2 && hour <= 5 && !tx.Calendar.allowNight()
 			},
 			Score:  0.2,
 			Action: "FLAG",
@@ -254,9 +468,14 @@ func DefaultRules() []Rule {
 	}
 }
 
-// DefaultPatterns returns default fraud patterns
+// DefaultPatterns returns default fraud patterns, with the default amount
+// patterns of each currency
 func DefaultPatterns() []Pattern {
-	return []Pattern{
+	return patternsWithAmounts(DefaultAmountPatternConfig())
+}
+
+func patternsWithAmounts(amounts AmountPatternConfig) []Pattern {
+	patterns := []Pattern{
 		{
 			Name:        "RAPID_FIRE",
 			Description: "Multiple transactions in rapid succession",
@@ -266,13 +485,6 @@ func DefaultPatterns() []Pattern {
 			},
 			Score: 0.4,
 		},
-		{
-			Name:        "ROUND_AMOUNT",
-			Description: "Suspicious round amount",
-			Matcher: func(tx *Transaction) bool {
-				return tx.Amount == math.Floor(tx.Amount) && tx.Amount > 1000
-			},
-			Score: 0.1,
-		},
 	}
+	return append(patterns, amountPatterns(amounts)...)
 }
\ No newline at end of file
@@ -0,0 +1,79 @@
+package detector
+
+import "math"
+
+// Score components, the checks whose scores add up to a fraud score
+const (
+	// ComponentRule prefixes the ID of a rule, each rule being a component
+	ComponentRule        = "rule:"
+	ComponentVelocity    = "velocity"
+	ComponentSequence    = "sequence"
+	ComponentGeography   = "geography"
+	ComponentInstrument  = "instrument"
+	ComponentPatterns    = "patterns"
+	ComponentRefunds     = "refunds"
+	ComponentActivity    = "activity"
+	ComponentCrossBorder = "cross_border"
+	ComponentNetwork     = "network"
+	ComponentCorridor    = "corridor"
+	ComponentReputation  = "reputation"
+	ComponentRecurring   = "recurring"
+	ComponentMule        = "mule"
+	ComponentBeneficiary = "beneficiary"
+	ComponentPromo       = "promo"
+	ComponentClearing    = "clearing"
+	ComponentBasket      = "basket"
+	ComponentAddress     = "address"
+	ComponentCrypto      = "crypto"
+	ComponentExternal    = "external"
+	// ComponentProfile is the cached profile check of quick scores
+	ComponentProfile = "profile"
+)
+
+// Contribution is what a component added to a score, before the score was
+// blended with the model score and capped to 0-1. Discounts are negative.
+type Contribution struct {
+	Component string  `json:"component"`
+	Score     float64 `json:"score"`
+}
+
+// add adds the score of a component
+func (s *FraudScore) add(component string, score float64) {
+	s.Score += score
+	if score == 0 {
+		return
+	}
+	for i := range s.Contributions {
+		if s.Contributions[i].Component == component {
+			s.Contributions[i].Score += score
+			return
+		}
+	}
+	s.Contributions = append(s.Contributions, Contribution{Component: component, Score: score})
+}
+
+// blend blends the model score into the score, as the detector does when
+// ML is enabled
+func (s *FraudScore) blend(modelScore float64) {
+	s.Score = (s.Score + modelScore) / 2
+	s.modelScore = &modelScore
+}
+
+// ScoreWithout returns the score the transaction would have had without the
+// contributions of some components, blended and capped like the score
+func (s *FraudScore) ScoreWithout(components ...string) float64 {
+	without := make(map[string]bool, len(components))
+	for _, component := range components {
+		without[component] = true
+	}
+	var score float64
+	for _, contribution := range s.Contributions {
+		if !without[contribution.Component] {
+			score += contribution.Score
+		}
+	}
+	if s.modelScore != nil {
+		score = (score + *s.modelScore) / 2
+	}
+	return math.Min(1.0, math.Max(0.0, score))
+}
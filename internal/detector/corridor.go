@@ -0,0 +1,292 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CorridorConfig holds corridor risk settings. A corridor is the card
+// issuer, merchant and IP country triple of a transaction, keyed "US:BR:NG".
+// Its risk is the configured matrix value until MinLabels of its
+// transactions have feedback labels, and the learned fraud rate from then
+// on. Corridors with a risk of at least MinRisk add Score.
+type CorridorConfig struct {
+	MinLabels int
+	MinRisk   float64
+	Score     float64
+}
+
+// DefaultCorridorConfig returns the default corridor risk settings
+func DefaultCorridorConfig() CorridorConfig {
+	return CorridorConfig{
+		MinLabels: 20,
+		MinRisk:   0.1,
+		Score:     0.2,
+	}
+}
+
+func (c CorridorConfig) withDefaults() CorridorConfig {
+	defaults := DefaultCorridorConfig()
+	if c.MinLabels <= 0 {
+		c.MinLabels = defaults.MinLabels
+	}
+	if c.MinRisk <= 0 {
+		c.MinRisk = defaults.MinRisk
+	}
+	if c.Score <= 0 {
+		c.Score = defaults.Score
+	}
+	return c
+}
+
+// ReasonCorridorRisk flags transactions in a high-risk country corridor
+const ReasonCorridorRisk = "CORRIDOR_RISK"
+
+// Sources of a corridor's risk
+const (
+	CorridorSourceNone   = "none"
+	CorridorSourceMatrix = "matrix"
+	CorridorSourceLabels = "labels"
+)
+
+// CorridorStats is the risk of a corridor and the labels learned for it
+type CorridorStats struct {
+	Corridor string  `json:"corridor"`
+	Risk     float64 `json:"risk"`
+	Source   string  `json:"source"`
+	// Matched is the matrix entry the risk comes from, which may contain
+	// wildcards
+	Matched string `json:"matched,omitempty"`
+	Labels  int    `json:"labels"`
+	Frauds  int    `json:"frauds"`
+}
+
+// CorridorResult is the outcome of the corridor check
+type CorridorResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// CorridorTracker combines the configured corridor risk matrix with fraud
+// rates learned from feedback labels
+type CorridorTracker struct {
+	config CorridorConfig
+	// matrix maps corridor keys to risks; any country may be "*"
+	matrix    map[string]float64
+	corridors map[string]*corridorCounts
+	// labels remembers each labeled transaction, so relabeling one moves it
+	// between counts instead of counting it twice
+	labels map[string]corridorLabel
+	mu     sync.RWMutex
+}
+
+type corridorCounts struct {
+	labels, frauds int
+}
+
+type corridorLabel struct {
+	corridor string
+	fraud    bool
+}
+
+func NewCorridorTracker(config CorridorConfig) *CorridorTracker {
+	return &CorridorTracker{
+		config:    config.withDefaults(),
+		matrix:    make(map[string]float64),
+		corridors: make(map[string]*corridorCounts),
+		labels:    make(map[string]corridorLabel),
+	}
+}
+
+// CorridorKey returns the corridor of a transaction. Corridors need all
+// three countries.
+func CorridorKey(tx *Transaction) (string, bool) {
+	issuer := strings.ToUpper(tx.IssuerCountry)
+	merchant := strings.ToUpper(tx.MerchantCountry)
+	ip := strings.ToUpper(tx.IPCountry)
+	if issuer == "" || merchant == "" || ip == "" {
+		return "", false
+	}
+	return issuer + ":" + merchant + ":" + ip, true
+}
+
+// SetMatrix replaces the configured corridor risks
+func (c *CorridorTracker) SetMatrix(matrix map[string]float64) error {
+	normalized := make(map[string]float64, len(matrix))
+	for key, risk := range matrix {
+		parts := strings.Split(strings.ToUpper(key), ":")
+		if len(parts) != 3 {
+			return fmt.Errorf("corridor %q must be ISSUER:MERCHANT:IP", key)
+		}
+		for _, country := range parts {
+			if country == "" {
+				return fmt.Errorf("corridor %q has an empty country; use * to match any", key)
+			}
+		}
+		if risk < 0 || risk > 1 {
+			return fmt.Errorf("corridor %q: risk %.2f must be within [0, 1]", key, risk)
+		}
+		normalized[strings.Join(parts, ":")] = risk
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.matrix = normalized
+	return nil
+}
+
+// matrixCandidates are the matrix entries that may match a corridor, most
+// specific first
+func matrixCandidates(corridor string) []string {
+	parts := strings.Split(corridor, ":")
+	issuer, merchant, ip := parts[0], parts[1], parts[2]
+	return []string{
+		corridor,
+		issuer + ":" + merchant + ":*",
+		issuer + ":*:" + ip,
+		"*:" + merchant + ":" + ip,
+		issuer + ":*:*",
+		"*:" + merchant + ":*",
+		"*:*:" + ip,
+	}
+}
+
+// stats resolves the risk of a corridor. Callers must hold the lock.
+func (c *CorridorTracker) stats(corridor string) CorridorStats {
+	stats := CorridorStats{Corridor: corridor, Source: CorridorSourceNone}
+	if counts, exists := c.corridors[corridor]; exists {
+		stats.Labels, stats.Frauds = counts.labels, counts.frauds
+	}
+	if stats.Labels >= c.config.MinLabels {
+		stats.Risk = float64(stats.Frauds) / float64(stats.Labels)
+		stats.Source = CorridorSourceLabels
+		return stats
+	}
+	for _, candidate := range matrixCandidates(corridor) {
+		if risk, exists := c.matrix[candidate]; exists {
+			stats.Risk, stats.Source, stats.Matched = risk, CorridorSourceMatrix, candidate
+			break
+		}
+	}
+	return stats
+}
+
+// Stats returns the risk of a corridor
+func (c *CorridorTracker) Stats(corridor string) CorridorStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats(strings.ToUpper(corridor))
+}
+
+// Risk returns the risk of a transaction's corridor, 0 when unknown
+func (c *CorridorTracker) Risk(tx *Transaction) float64 {
+	corridor, known := CorridorKey(tx)
+	if !known {
+		return 0
+	}
+	return c.Stats(corridor).Risk
+}
+
+// Check flags transactions in corridors at or above the minimum risk
+func (c *CorridorTracker) Check(tx *Transaction) CorridorResult {
+	result := CorridorResult{}
+	corridor, known := CorridorKey(tx)
+	if !known {
+		return result
+	}
+
+	stats := c.Stats(corridor)
+	if stats.Risk < c.config.MinRisk {
+		return result
+	}
+	result.Score = c.config.Score
+	result.Codes = append(result.Codes, ReasonCorridorRisk)
+	if stats.Source == CorridorSourceLabels {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("High-risk corridor %s (issuer:merchant:IP): %.0f%% fraud over %d labeled transactions", corridor, stats.Risk*100, stats.Labels))
+	} else {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("High-risk corridor %s (issuer:merchant:IP): configured risk %.2f", corridor, stats.Risk))
+	}
+	return result
+}
+
+// Label records the feedback label of a transaction in its corridor. It
+// returns false for transactions without a corridor.
+func (c *CorridorTracker) Label(tx *Transaction, fraud bool) (CorridorStats, bool) {
+	corridor, known := CorridorKey(tx)
+	if !known {
+		return CorridorStats{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if previous, labeled := c.labels[tx.ID]; labeled {
+		counts := c.corridors[previous.corridor]
+		counts.labels--
+		if previous.fraud {
+			counts.frauds--
+		}
+	}
+	counts, exists := c.corridors[corridor]
+	if !exists {
+		counts = &corridorCounts{}
+		c.corridors[corridor] = counts
+	}
+	counts.labels++
+	if fraud {
+		counts.frauds++
+	}
+	c.labels[tx.ID] = corridorLabel{corridor: corridor, fraud: fraud}
+	return c.stats(corridor), true
+}
+
+// All returns every configured or labeled corridor, riskiest first
+func (c *CorridorTracker) All() []CorridorStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	all := make([]CorridorStats, 0, len(c.matrix)+len(c.corridors))
+	for corridor := range c.corridors {
+		all = append(all, c.stats(corridor))
+	}
+	for key, risk := range c.matrix {
+		if _, labeled := c.corridors[key]; !labeled {
+			all = append(all, CorridorStats{Corridor: key, Risk: risk, Source: CorridorSourceMatrix, Matched: key})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Risk != all[j].Risk {
+			return all[i].Risk > all[j].Risk
+		}
+		return all[i].Corridor < all[j].Corridor
+	})
+	return all
+}
+
+// LoadCorridorMatrix reads a JSON corridor risk matrix:
+// {"US:BR:NG": 0.8, "*:*:NG": 0.3}
+func LoadCorridorMatrix(r io.Reader) (map[string]float64, error) {
+	var matrix map[string]float64
+	if err := json.NewDecoder(r).Decode(&matrix); err != nil {
+		return nil, fmt.Errorf("invalid corridor risk matrix: %w", err)
+	}
+	return matrix, nil
+}
+
+// LoadCorridorMatrixFile reads a corridor risk matrix from disk
+func LoadCorridorMatrixFile(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCorridorMatrix(f)
+}
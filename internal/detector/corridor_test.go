@@ -0,0 +1,89 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func corridorTx(id, issuer, merchant, ip string) *detector.Transaction {
+	return &detector.Transaction{ID: id, IssuerCountry: issuer, MerchantCountry: merchant, IPCountry: ip}
+}
+
+func TestCorridorTracker_Matrix(t *testing.T) {
+	tracker := detector.NewCorridorTracker(detector.DefaultCorridorConfig())
+	require.NoError(t, tracker.SetMatrix(map[string]float64{
+		"us:br:ng": 0.8,
+		"*:*:NG":   0.3,
+		"US:BR:*":  0.05,
+	}))
+
+	result := tracker.Check(corridorTx("TXN-1", "US", "BR", "NG"))
+	assert.Equal(t, []string{detector.ReasonCorridorRisk}, result.Codes)
+	assert.Contains(t, result.Reasons[0], "US:BR:NG")
+	assert.Contains(t, result.Reasons[0], "0.80")
+
+	stats := tracker.Stats("GB:FR:NG")
+	assert.Equal(t, 0.3, stats.Risk)
+	assert.Equal(t, "*:*:NG", stats.Matched)
+	assert.Equal(t, 0.05, tracker.Stats("US:BR:US").Risk, "most specific entry wins")
+	assert.Empty(t, tracker.Check(corridorTx("TXN-2", "US", "BR", "US")).Codes, "below the minimum risk")
+	assert.Empty(t, tracker.Check(corridorTx("TXN-3", "US", "BR", "")).Codes, "needs all three countries")
+
+	for _, matrix := range []map[string]float64{{"US:BR": 0.5}, {"US::NG": 0.5}, {"US:BR:NG": 1.5}} {
+		assert.Error(t, tracker.SetMatrix(matrix))
+	}
+	_, err := detector.LoadCorridorMatrix(strings.NewReader(`{"US:BR:NG": "high"}`))
+	assert.Error(t, err)
+}
+
+func TestCorridorTracker_LearnsFromLabels(t *testing.T) {
+	tracker := detector.NewCorridorTracker(detector.CorridorConfig{MinLabels: 10, MinRisk: 0.2, Score: 0.2})
+	require.NoError(t, tracker.SetMatrix(map[string]float64{"CA:US:CA": 0.9}))
+
+	for i := 0; i < 9; i++ {
+		_, ok := tracker.Label(corridorTx(fmt.Sprintf("TXN-%d", i), "CA", "US", "CA"), false)
+		require.True(t, ok)
+	}
+	assert.Equal(t, detector.CorridorSourceMatrix, tracker.Stats("CA:US:CA").Source, "too few labels")
+
+	stats, _ := tracker.Label(corridorTx("TXN-9", "CA", "US", "CA"), false)
+	assert.Equal(t, detector.CorridorSourceLabels, stats.Source)
+	assert.Zero(t, stats.Risk, "the labels overrule the matrix")
+
+	// Relabeling moves a transaction instead of counting it twice
+	for i := 0; i < 3; i++ {
+		stats, _ = tracker.Label(corridorTx(fmt.Sprintf("TXN-%d", i), "CA", "US", "CA"), true)
+	}
+	stats, _ = tracker.Label(corridorTx("TXN-0", "CA", "US", "CA"), true)
+	assert.Equal(t, 10, stats.Labels)
+	assert.Equal(t, 3, stats.Frauds)
+	assert.Contains(t, tracker.Check(corridorTx("TXN-NEW", "CA", "US", "CA")).Reasons[0], "30% fraud over 10 labeled")
+
+	_, ok := tracker.Label(corridorTx("TXN-X", "CA", "", "CA"), true)
+	assert.False(t, ok)
+	assert.Equal(t, "CA:US:CA", tracker.All()[0].Corridor)
+}
+
+func TestDetector_CorridorRiskFeature(t *testing.T) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	require.NoError(t, d.SetCorridorMatrix(map[string]float64{"US:BR:NG": 0.6}))
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "RISKY_CORRIDOR",
+		Expression: "tx.corridor_risk > 0.5 && tx.issuer_country == 'US'",
+		Score:      0.1,
+	}))
+
+	tx := corridorTx("TXN-1", "US", "BR", "NG")
+	tx.AccountID, tx.Amount = "ACC-1", 50
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Equal(t, 0.6, tx.CorridorRisk)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonCorridorRisk)
+	assert.Contains(t, score.ReasonCodes, "RISKY_CORRIDOR")
+}
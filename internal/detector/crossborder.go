@@ -0,0 +1,119 @@
+package detector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CrossBorderConfig holds country mismatch settings. Corridors overrides the
+// customer-to-merchant mismatch score for specific pairs keyed "US:CA"; a zero
+// score marks a corridor as normal traffic.
+type CrossBorderConfig struct {
+	MismatchScore       float64
+	IPMismatchScore     float64
+	TripleMismatchScore float64
+	Corridors           map[string]float64
+}
+
+// DefaultCrossBorderConfig returns the default cross-border settings
+func DefaultCrossBorderConfig() CrossBorderConfig {
+	return CrossBorderConfig{
+		MismatchScore:       0.1,
+		IPMismatchScore:     0.15,
+		TripleMismatchScore: 0.2,
+	}
+}
+
+func (c CrossBorderConfig) withDefaults() CrossBorderConfig {
+	defaults := DefaultCrossBorderConfig()
+	if c.MismatchScore <= 0 {
+		c.MismatchScore = defaults.MismatchScore
+	}
+	if c.IPMismatchScore <= 0 {
+		c.IPMismatchScore = defaults.IPMismatchScore
+	}
+	if c.TripleMismatchScore <= 0 {
+		c.TripleMismatchScore = defaults.TripleMismatchScore
+	}
+	return c
+}
+
+// Cross-border reason codes
+const (
+	ReasonCrossBorder           = "CROSS_BORDER"
+	ReasonIPCountryMismatch     = "IP_COUNTRY_MISMATCH"
+	ReasonTripleCountryMismatch = "TRIPLE_COUNTRY_MISMATCH"
+)
+
+// CountryFeatures are the country mismatch features of a transaction
+type CountryFeatures struct {
+	CustomerCountry string
+	MerchantCountry string
+	IPCountry       string
+	CrossBorder     bool // customer country differs from merchant country
+	IPMismatch      bool // IP country differs from customer country
+	TripleMismatch  bool // all three countries differ
+}
+
+// ExtractCountryFeatures compares the customer (transaction location),
+// merchant and IP countries. Unknown countries never count as a mismatch.
+func ExtractCountryFeatures(tx *Transaction) CountryFeatures {
+	f := CountryFeatures{
+		CustomerCountry: strings.ToUpper(tx.Location.Country),
+		MerchantCountry: strings.ToUpper(tx.MerchantCountry),
+		IPCountry:       strings.ToUpper(tx.IPCountry),
+	}
+	differ := func(a, b string) bool {
+		return a != "" && b != "" && a != b
+	}
+
+	f.CrossBorder = differ(f.CustomerCountry, f.MerchantCountry)
+	f.IPMismatch = differ(f.IPCountry, f.CustomerCountry)
+	f.TripleMismatch = f.CrossBorder && f.IPMismatch && differ(f.IPCountry, f.MerchantCountry)
+	return f
+}
+
+// Corridor returns the customer-to-merchant corridor key, e.g. "US:BR"
+func (f CountryFeatures) Corridor() string {
+	return f.CustomerCountry + ":" + f.MerchantCountry
+}
+
+// CrossBorderResult is the outcome of the country mismatch check
+type CrossBorderResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+func checkCrossBorder(config CrossBorderConfig, tx *Transaction) CrossBorderResult {
+	result := CrossBorderResult{}
+	f := ExtractCountryFeatures(tx)
+
+	if f.CrossBorder {
+		score := config.MismatchScore
+		if override, configured := config.Corridors[f.Corridor()]; configured {
+			score = override
+		}
+		if score > 0 {
+			result.Score += score
+			result.Codes = append(result.Codes, ReasonCrossBorder)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Cross-border transaction: customer in %s, merchant in %s", f.CustomerCountry, f.MerchantCountry))
+		}
+	}
+
+	if f.IPMismatch {
+		result.Score += config.IPMismatchScore
+		result.Codes = append(result.Codes, ReasonIPCountryMismatch)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("IP country %s differs from customer country %s", f.IPCountry, f.CustomerCountry))
+	}
+
+	if f.TripleMismatch {
+		result.Score += config.TripleMismatchScore
+		result.Codes = append(result.Codes, ReasonTripleCountryMismatch)
+		result.Reasons = append(result.Reasons, "Customer, merchant and IP countries all differ")
+	}
+
+	return result
+}
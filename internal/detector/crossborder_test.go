@@ -0,0 +1,101 @@
+package detector_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCountryFeatures(t *testing.T) {
+	f := detector.ExtractCountryFeatures(&detector.Transaction{
+		Location:        detector.Location{Country: "us"},
+		MerchantCountry: "BR",
+		IPCountry:       "NG",
+	})
+	assert.True(t, f.CrossBorder)
+	assert.True(t, f.IPMismatch)
+	assert.True(t, f.TripleMismatch)
+	assert.Equal(t, "US:BR", f.Corridor())
+
+	// Unknown countries never count as a mismatch
+	f = detector.ExtractCountryFeatures(&detector.Transaction{
+		Location:        detector.Location{Country: "US"},
+		MerchantCountry: "US",
+	})
+	assert.False(t, f.CrossBorder)
+	assert.False(t, f.IPMismatch)
+	assert.False(t, f.TripleMismatch)
+}
+
+func TestMerchantRegistry_Load(t *testing.T) {
+	registry, err := detector.LoadMerchantRegistry(strings.NewReader(`[
+		{"merchant_id": "MERCH-1", "country": "br"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, registry.Size())
+
+	tx := &detector.Transaction{MerchantID: "MERCH-1"}
+	registry.Enrich(tx)
+	assert.Equal(t, "BR", tx.MerchantCountry)
+
+	// Client-sent values win
+	tx = &detector.Transaction{MerchantID: "MERCH-1", MerchantCountry: "US"}
+	registry.Enrich(tx)
+	assert.Equal(t, "US", tx.MerchantCountry)
+
+	_, err = detector.LoadMerchantRegistry(strings.NewReader(`[{"country": "US"}]`))
+	assert.Error(t, err)
+}
+
+func TestDetector_Analyze_CrossBorder(t *testing.T) {
+	registry := detector.NewMerchantRegistry()
+	registry.Set(detector.MerchantProfile{MerchantID: "MERCH-BR", Country: "BR"})
+	registry.Set(detector.MerchantProfile{MerchantID: "MERCH-CA", Country: "CA"})
+
+	config := detector.Config{
+		MaxVelocity:    100,
+		VelocityWindow: time.Hour,
+		BlockThreshold: 0.8,
+		CrossBorder: detector.CrossBorderConfig{
+			Corridors: map[string]float64{"US:CA": 0},
+		},
+	}
+	analyze := func(tx *detector.Transaction) *detector.FraudScore {
+		d := detector.NewDetector(config)
+		d.SetMerchantRegistry(registry)
+		tx.ID = "TXN-CB"
+		tx.AccountID = "ACC-CB"
+		tx.Amount = 42.17
+		tx.Timestamp = time.Now().Add(-24 * time.Hour)
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		return score
+	}
+
+	score := analyze(&detector.Transaction{
+		MerchantID: "MERCH-BR",
+		Location:   detector.Location{Country: "US"},
+		IPCountry:  "NG",
+	})
+	assert.Contains(t, score.ReasonCodes, detector.ReasonCrossBorder)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonIPCountryMismatch)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonTripleCountryMismatch)
+
+	// A configured normal corridor is not flagged
+	score = analyze(&detector.Transaction{
+		MerchantID: "MERCH-CA",
+		Location:   detector.Location{Country: "US"},
+	})
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonCrossBorder)
+
+	score = analyze(&detector.Transaction{
+		MerchantID: "MERCH-UNKNOWN",
+		Location:   detector.Location{Country: "US"},
+	})
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonCrossBorder)
+}
@@ -0,0 +1,191 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CryptoDetails holds chain information for cryptocurrency transfers
+type CryptoDetails struct {
+	WalletAddress string `json:"wallet_address"`
+	Chain         string `json:"chain"`
+	Exchange      string `json:"exchange,omitempty"`
+}
+
+// Address risk categories. Blocking categories decline outright.
+const (
+	AddressCategoryMixer      = "mixer"
+	AddressCategorySanctioned = "sanctioned"
+	AddressCategoryDarknet    = "darknet"
+	AddressCategoryScam       = "scam"
+	AddressCategoryHighRisk   = "high_risk"
+)
+
+// Crypto reason codes
+const (
+	ReasonCryptoBlockedAddress = "CRYPTO_BLOCKED_ADDRESS"
+	ReasonCryptoRiskyAddress   = "CRYPTO_RISKY_ADDRESS"
+	ReasonCryptoRiskyExchange  = "CRYPTO_RISKY_EXCHANGE"
+)
+
+// AddressRisk is an entry of the address risk list
+type AddressRisk struct {
+	Chain    string `json:"chain"`
+	Address  string `json:"address"`
+	Category string `json:"category"`
+	Source   string `json:"source,omitempty"`
+}
+
+// Blocking reports whether transfers to the address must be declined
+func (a AddressRisk) Blocking() bool {
+	switch a.Category {
+	case AddressCategoryMixer, AddressCategorySanctioned, AddressCategoryDarknet:
+		return true
+	}
+	return false
+}
+
+// AddressRiskList is a lookup of flagged wallets and risky exchanges
+type AddressRiskList struct {
+	addresses map[string]AddressRisk
+	exchanges map[string]bool
+	mu        sync.RWMutex
+}
+
+func NewAddressRiskList() *AddressRiskList {
+	return &AddressRiskList{
+		addresses: make(map[string]AddressRisk),
+		exchanges: make(map[string]bool),
+	}
+}
+
+// addressKey normalizes chain and address. Hex addresses are case-insensitive,
+// base58/bech32 ones are kept as-is.
+func addressKey(chain, address string) string {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(address, "0x") || strings.HasPrefix(address, "0X") {
+		address = strings.ToLower(address)
+	}
+	return strings.ToUpper(strings.TrimSpace(chain)) + ":" + address
+}
+
+// Add flags an address
+func (l *AddressRiskList) Add(entry AddressRisk) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.addresses[addressKey(entry.Chain, entry.Address)] = entry
+}
+
+// AddExchange flags an exchange (e.g. no-KYC venues)
+func (l *AddressRiskList) AddExchange(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exchanges[strings.ToLower(strings.TrimSpace(name))] = true
+}
+
+// Lookup returns the risk entry for an address, if flagged
+func (l *AddressRiskList) Lookup(chain, address string) (AddressRisk, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entry, exists := l.addresses[addressKey(chain, address)]
+	return entry, exists
+}
+
+// RiskyExchange reports whether the exchange is flagged
+func (l *AddressRiskList) RiskyExchange(name string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.exchanges[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// Size returns the number of flagged addresses
+func (l *AddressRiskList) Size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.addresses)
+}
+
+// addressRiskFile is the on-disk format of the address risk list
+type addressRiskFile struct {
+	Addresses []AddressRisk `json:"addresses"`
+	Exchanges []string      `json:"exchanges"`
+}
+
+// LoadAddressRiskList reads a JSON address risk list, as exported by
+// chain-analytics providers
+func LoadAddressRiskList(r io.Reader) (*AddressRiskList, error) {
+	var file addressRiskFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid address risk list: %w", err)
+	}
+
+	list := NewAddressRiskList()
+	for i, entry := range file.Addresses {
+		if entry.Chain == "" || entry.Address == "" {
+			return nil, fmt.Errorf("address risk entry %d: chain and address are required", i)
+		}
+		list.Add(entry)
+	}
+	for _, exchange := range file.Exchanges {
+		list.AddExchange(exchange)
+	}
+	return list, nil
+}
+
+// LoadAddressRiskListFile reads an address risk list from disk
+func LoadAddressRiskListFile(path string) (*AddressRiskList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadAddressRiskList(f)
+}
+
+// IsCrypto reports whether the transaction is a cryptocurrency transfer
+func IsCrypto(tx *Transaction) bool {
+	return tx.Crypto != nil || strings.EqualFold(tx.Type, "cryptocurrency")
+}
+
+// CryptoResult is the outcome of the crypto risk check
+type CryptoResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+	Block   bool
+}
+
+// checkCrypto scores transfers against the address risk list
+func checkCrypto(list *AddressRiskList, tx *Transaction) CryptoResult {
+	result := CryptoResult{}
+	if list == nil || tx.Crypto == nil {
+		return result
+	}
+
+	if entry, flagged := list.Lookup(tx.Crypto.Chain, tx.Crypto.WalletAddress); flagged {
+		if entry.Blocking() {
+			result.Score += 1.0
+			result.Block = true
+			result.Codes = append(result.Codes, ReasonCryptoBlockedAddress)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Transfer to flagged %s wallet on %s", entry.Category, strings.ToUpper(entry.Chain)))
+		} else {
+			result.Score += 0.5
+			result.Codes = append(result.Codes, ReasonCryptoRiskyAddress)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Transfer to %s wallet on %s", entry.Category, strings.ToUpper(entry.Chain)))
+		}
+	}
+
+	if tx.Crypto.Exchange != "" && list.RiskyExchange(tx.Crypto.Exchange) {
+		result.Score += 0.2
+		result.Codes = append(result.Codes, ReasonCryptoRiskyExchange)
+		result.Reasons = append(result.Reasons, fmt.Sprintf("Transfer via high-risk exchange %s", tx.Crypto.Exchange))
+	}
+
+	return result
+}
@@ -0,0 +1,97 @@
+package detector_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const riskListJSON = `{
+	"addresses": [
+		{"chain": "ETH", "address": "0xAbC0000000000000000000000000000000000001", "category": "mixer", "source": "chainlist"},
+		{"chain": "BTC", "address": "bc1qscamscamscam", "category": "scam"}
+	],
+	"exchanges": ["ShadyEx"]
+}`
+
+func cryptoTx(id, chain, address, exchange string) *detector.Transaction {
+	return &detector.Transaction{
+		ID:        id,
+		AccountID: "ACC-CRYPTO",
+		Amount:    250.00,
+		Currency:  "USD",
+		Timestamp: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+		Type:      "cryptocurrency",
+		Crypto: &detector.CryptoDetails{
+			WalletAddress: address,
+			Chain:         chain,
+			Exchange:      exchange,
+		},
+	}
+}
+
+func TestLoadAddressRiskList(t *testing.T) {
+	list, err := detector.LoadAddressRiskList(strings.NewReader(riskListJSON))
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Size())
+
+	entry, flagged := list.Lookup("eth", "0xabc0000000000000000000000000000000000001")
+	assert.True(t, flagged, "hex addresses match case-insensitively")
+	assert.True(t, entry.Blocking())
+
+	_, flagged = list.Lookup("BTC", "BC1QSCAMSCAMSCAM")
+	assert.False(t, flagged, "non-hex addresses are case-sensitive")
+
+	assert.True(t, list.RiskyExchange("shadyex"))
+
+	_, err = detector.LoadAddressRiskList(strings.NewReader(`{"addresses":[{"chain":"ETH"}]}`))
+	assert.Error(t, err)
+}
+
+func TestDetector_Analyze_CryptoAddressRisk(t *testing.T) {
+	list, err := detector.LoadAddressRiskList(strings.NewReader(riskListJSON))
+	require.NoError(t, err)
+
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	d.SetAddressRiskList(list)
+
+	t.Run("Mixer wallet is blocked", func(t *testing.T) {
+		score, err := d.Analyze(context.Background(), cryptoTx("C1", "ETH", "0xabc0000000000000000000000000000000000001", ""))
+		require.NoError(t, err)
+		assert.True(t, score.Blocked)
+		assert.True(t, score.ShouldBlock)
+		assert.Contains(t, score.ReasonCodes, detector.ReasonCryptoBlockedAddress)
+	})
+
+	t.Run("Scam wallet goes to review", func(t *testing.T) {
+		score, err := d.Analyze(context.Background(), cryptoTx("C2", "BTC", "bc1qscamscamscam", ""))
+		require.NoError(t, err)
+		assert.False(t, score.Blocked)
+		assert.True(t, score.RequiresReview)
+		assert.Contains(t, score.ReasonCodes, detector.ReasonCryptoRiskyAddress)
+	})
+
+	t.Run("Risky exchange", func(t *testing.T) {
+		score, err := d.Analyze(context.Background(), cryptoTx("C3", "BTC", "bc1qclean", "ShadyEx"))
+		require.NoError(t, err)
+		assert.Contains(t, score.ReasonCodes, detector.ReasonCryptoRiskyExchange)
+	})
+
+	t.Run("Clean wallet", func(t *testing.T) {
+		score, err := d.Analyze(context.Background(), cryptoTx("C4", "BTC", "bc1qclean", "Coinbase"))
+		require.NoError(t, err)
+		assert.False(t, score.Blocked)
+		assert.False(t, score.RequiresReview)
+	})
+}
+
+func TestIsCrypto(t *testing.T) {
+	assert.True(t, detector.IsCrypto(&detector.Transaction{Type: "CRYPTOCURRENCY"}))
+	assert.True(t, detector.IsCrypto(&detector.Transaction{Crypto: &detector.CryptoDetails{Chain: "BTC"}}))
+	assert.False(t, detector.IsCrypto(&detector.Transaction{Type: "PURCHASE"}))
+}
@@ -0,0 +1,406 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/expr"
+)
+
+// ExpressionFunctions documents the domain functions rule expressions can
+// call, by signature
+var ExpressionFunctions = map[string]string{
+	"distance(loc1, loc2)":      "Great-circle distance in km between two locations",
+	"velocity(account, window)": "Previous transactions of the account within a window such as '10m' (capped at the velocity window)",
+	"profile(account)":          "Account profile before this transaction: avg_amount, max_amount, total_amount, tx_count",
+	"last_location(account)":    "Last known location of the account, or null",
+	"in_list(name, value)":      "Whether a named list, such as 'bad_ips', holds the value",
+	"hour_local(tx)":            "Hour of the transaction at its location, estimated from the longitude",
+	"beneficiary(id)":           "Beneficiary statistics before this transaction: first_seen, transfers, total_received, distinct_senders, fraud_labels, or null",
+}
+
+// CompileExpression compiles a rule expression into a condition evaluated
+// against the detector's state. The transaction is available as tx, e.g.
+// "tx.amount > 3 * profile(tx.account_id).avg_amount". Conditions that fail
+// to evaluate, e.g. on missing data, do not match, and neither do those still
+// running when the rule runs out of budget.
+func (d *Detector) CompileExpression(expression string) (func(*Transaction) bool, error) {
+	program, err := expr.Compile(expression, d.expressionEnv())
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+
+	return func(tx *Transaction) bool {
+		vars := tx.exprVars
+		if vars == nil {
+			vars = expressionVars(tx)
+		}
+		matched, err := program.EvalBoolBefore(vars, tx.ruleDeadline)
+		if errors.Is(err, expr.ErrDeadlineExceeded) {
+			tx.ruleAborted = true
+		}
+		return err == nil && matched
+	}, nil
+}
+
+// expressionVars exposes a transaction and its overrides to expressions.
+// Building them allocates a map per field group, so rule evaluation builds
+// them once per transaction and shares them between conditions.
+func expressionVars(tx *Transaction) map[string]interface{} {
+	return map[string]interface{}{
+		"tx":         transactionValue(tx),
+		overridesVar: tx.overrides,
+	}
+}
+
+// AddExpressionRule compiles the rule's expression into its condition and
+// adds the rule
+func (d *Detector) AddExpressionRule(rule Rule) error {
+	if rule.ID == "" {
+		return errors.New("rule ID is required")
+	}
+	condition, err := d.CompileExpression(rule.Expression)
+	if err != nil {
+		return err
+	}
+	rule.Condition = condition
+	d.AddRule(rule)
+	return nil
+}
+
+// CheckExpressionRules reports the first rule that would be rejected by
+// ReplaceExpressionRules, without changing the active rules
+func (d *Detector) CheckExpressionRules(rules []Rule) error {
+	_, err := d.compileRules(rules)
+	return err
+}
+
+// ReplaceExpressionRules atomically replaces every expression rule with the
+// given ones. Built-in and custom rules are kept; nothing changes when any
+// rule fails to compile.
+func (d *Detector) ReplaceExpressionRules(rules []Rule) error {
+	compiled, err := d.compileRules(rules)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	kept := make([]Rule, 0, len(d.rules)+len(compiled))
+	for _, rule := range d.rules {
+		if rule.Expression == "" {
+			kept = append(kept, rule)
+		}
+	}
+	d.rules = append(kept, compiled...)
+	for _, rule := range compiled {
+		d.ruleGuard.release(rule.ID)
+	}
+	return nil
+}
+
+// compileRules compiles expression rules, rejecting duplicate IDs and IDs of
+// built-in rules
+func (d *Detector) compileRules(rules []Rule) ([]Rule, error) {
+	seen := make(map[string]bool, len(rules))
+	d.mu.RLock()
+	for _, rule := range d.rules {
+		if rule.Expression == "" {
+			seen[rule.ID] = true
+		}
+	}
+	d.mu.RUnlock()
+
+	compiled := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			return nil, errors.New("rule ID is required")
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %s: duplicate ID", rule.ID)
+		}
+		seen[rule.ID] = true
+		condition, err := d.CompileExpression(rule.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		rule.Condition = condition
+		compiled[i] = rule
+	}
+	return compiled, nil
+}
+
+func (d *Detector) expressionEnv() expr.Env {
+	return expr.Env{
+		Vars: []string{"tx"},
+		Funcs: map[string]expr.Func{
+			"distance": {Args: 2, Call: func(args []interface{}) (interface{}, error) {
+				from, err := locationArg(args[0])
+				if err != nil {
+					return nil, err
+				}
+				to, err := locationArg(args[1])
+				if err != nil {
+					return nil, err
+				}
+				if from == nil || to == nil {
+					return nil, nil
+				}
+				return d.geoAnalyzer.CalculateDistance(*from, *to), nil
+			}},
+			"velocity": {Args: 2, Call: func(args []interface{}) (interface{}, error) {
+				account, ok := args[0].(string)
+				if !ok {
+					return nil, errors.New("account must be a string")
+				}
+				window, err := durationArg(args[1])
+				if err != nil {
+					return nil, err
+				}
+				return float64(d.velocityTracker.CountSince(account, window)), nil
+			}},
+			"profile": {Args: 1, Call: func(args []interface{}) (interface{}, error) {
+				account, ok := args[0].(string)
+				if !ok {
+					return nil, errors.New("account must be a string")
+				}
+				profile, _ := d.profiles.Get(account)
+				var threshold interface{}
+				if value, ok := profile.AmountThreshold(d.config.Spending); ok {
+					threshold = value
+				}
+				return map[string]interface{}{
+					"avg_amount":       profile.AvgAmount(),
+					"max_amount":       profile.MaxAmount,
+					"total_amount":     profile.TotalAmount,
+					"tx_count":         float64(profile.Count),
+					"amount_threshold": threshold,
+				}, nil
+			}},
+			"last_location": {Args: 1, Call: func(args []interface{}) (interface{}, error) {
+				account, ok := args[0].(string)
+				if !ok {
+					return nil, errors.New("account must be a string")
+				}
+				if location := d.geoAnalyzer.GetLastLocation(account); location != nil {
+					return locationValue(*location), nil
+				}
+				return nil, nil
+			}},
+			"in_list": {Args: 2, CallVars: func(vars map[string]interface{}, args []interface{}) (interface{}, error) {
+				name, ok := args[0].(string)
+				if !ok {
+					return nil, errors.New("list name must be a string")
+				}
+				value, ok := args[1].(string)
+				if !ok {
+					return false, nil
+				}
+				overrides, _ := vars[overridesVar].(*Overrides)
+				return overrides.contains(d.lists, name, value), nil
+			}},
+			"beneficiary": {Args: 1, Call: func(args []interface{}) (interface{}, error) {
+				id, ok := args[0].(string)
+				if !ok {
+					return nil, errors.New("beneficiary must be a string")
+				}
+				stats, exists := d.beneficiaries.Stats(id)
+				if !exists {
+					return nil, nil
+				}
+				return map[string]interface{}{
+					"first_seen":       float64(stats.FirstSeen.Unix()),
+					"transfers":        float64(stats.Transfers),
+					"total_received":   stats.TotalReceived,
+					"distinct_senders": float64(stats.DistinctSenders),
+					"fraud_labels":     float64(stats.FraudLabels),
+				}, nil
+			}},
+			"hour_local": {Args: 1, Call: func(args []interface{}) (interface{}, error) {
+				tx, ok := args[0].(map[string]interface{})
+				if !ok {
+					return nil, errors.New("argument must be a transaction")
+				}
+				return tx["hour_local"], nil
+			}},
+		},
+	}
+}
+
+// transactionValue exposes a transaction to expressions
+func transactionValue(tx *Transaction) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                       tx.ID,
+		"account_id":               tx.AccountID,
+		"amount":                   tx.Amount,
+		"currency":                 tx.Currency,
+		"merchant_id":              tx.MerchantID,
+		"merchant_country":         tx.MerchantCountry,
+		"mcc":                      tx.MCC,
+		"merchant_risk_tier":       tx.MerchantRiskTier,
+		"merchant_expected_ticket": optionalAmount(tx.MerchantExpectedTicket),
+		"type":                     tx.Type,
+		"device_id":                tx.DeviceID,
+		"ip_address":               tx.IPAddress,
+		"ip_country":               tx.IPCountry,
+		"asn":                      float64(tx.ASN),
+		"asn_org":                  tx.ASNOrg,
+		"network_type":             tx.NetworkType,
+		"issuer_country":           tx.IssuerCountry,
+		"card_brand":               tx.CardBrand,
+		"corridor_risk":            tx.CorridorRisk,
+		"reputation":               reputationValue(tx.Reputation),
+		"mandate_id":               tx.MandateID,
+		"destination":              tx.Destination,
+		"instrument_id":            tx.InstrumentID,
+		"campaign_id":              tx.CampaignID,
+		"beneficiary_added_at":     optionalTime(tx.BeneficiaryAddedAt),
+		"location":                 locationValue(tx.Location),
+		"timestamp":                float64(tx.Timestamp.Unix()),
+		"hour":                     float64(tx.Timestamp.UTC().Hour()),
+		"hour_local":               float64(localHour(tx)),
+		"sequence":                 sequenceValue(tx.Sequence),
+		"calendar_events":          tx.Calendar.eventNames(),
+		"basket":                   basketValue(tx),
+		"billing_address":          addressValue(tx.BillingAddress),
+		"shipping_address":         addressValue(tx.ShippingAddress),
+		"address":                  addressFeaturesValue(tx),
+	}
+}
+
+// basketValue exposes the basket and the breakdown of the amount; the
+// categories are lower-case
+func basketValue(tx *Transaction) map[string]interface{} {
+	f := ExtractBasketFeatures(tx)
+	categories := make([]interface{}, len(f.Categories))
+	for i, category := range f.Categories {
+		categories[i] = category
+	}
+	return map[string]interface{}{
+		"items":          float64(f.Items),
+		"quantity":       float64(f.Quantity),
+		"subtotal":       f.Subtotal,
+		"max_item_price": f.MaxItemPrice,
+		"categories":     categories,
+		"fee":            tx.Fee,
+		"tax":            tx.Tax,
+		"shipping":       tx.Shipping,
+	}
+}
+
+// optionalAmount exposes an amount, or null when unknown
+func optionalAmount(amount float64) interface{} {
+	if amount <= 0 {
+		return nil
+	}
+	return amount
+}
+
+// optionalTime exposes a time as Unix seconds, or null when unset
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return float64(t.Unix())
+}
+
+// sequenceValue exposes sequence features; the deltas are null for the first
+// transaction of an account
+func sequenceValue(features SequenceFeatures) map[string]interface{} {
+	value := map[string]interface{}{
+		"seconds_since_previous": nil,
+		"amount_delta":           nil,
+		"same_merchant_repeats":  float64(features.SameMerchantRepeats),
+	}
+	if features.HasPrevious {
+		value["seconds_since_previous"] = features.SecondsSincePrevious
+		value["amount_delta"] = features.AmountDelta
+	}
+	return value
+}
+
+func reputationValue(reputation Reputation) map[string]interface{} {
+	return map[string]interface{}{
+		"device":   reputation.Device,
+		"ip":       reputation.IP,
+		"merchant": reputation.Merchant,
+		"max":      reputation.Max(),
+	}
+}
+
+// addressValue exposes an address, or null when it was not sent
+func addressValue(address *Address) interface{} {
+	if address == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"city":        address.City,
+		"postal_code": address.PostalCode,
+		"country":     address.country(),
+	}
+}
+
+// addressFeaturesValue exposes the address comparison; the distance is null
+// unless both addresses are geocoded
+func addressFeaturesValue(tx *Transaction) map[string]interface{} {
+	f := ExtractAddressFeatures(tx)
+	value := map[string]interface{}{
+		"country_mismatch":  f.CountryMismatch,
+		"distance_km":       nil,
+		"freight_forwarder": f.Forwarder != "",
+	}
+	if f.DistanceKm >= 0 {
+		value["distance_km"] = f.DistanceKm
+	}
+	return value
+}
+
+func locationValue(loc Location) map[string]interface{} {
+	return map[string]interface{}{
+		"latitude":  loc.Latitude,
+		"longitude": loc.Longitude,
+		"country":   loc.Country,
+		"city":      loc.City,
+	}
+}
+
+// localHour estimates the hour at the transaction location from its
+// longitude, one hour per 15 degrees, falling back to UTC without coordinates
+func localHour(tx *Transaction) int {
+	hour := tx.Timestamp.UTC().Hour()
+	if tx.Location.Latitude == 0 && tx.Location.Longitude == 0 {
+		return hour
+	}
+	offset := int(math.Round(tx.Location.Longitude / 15))
+	return ((hour+offset)%24 + 24) % 24
+}
+
+func locationArg(value interface{}) (*Location, error) {
+	if value == nil {
+		return nil, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected a location")
+	}
+	lat, latOK := fields["latitude"].(float64)
+	lon, lonOK := fields["longitude"].(float64)
+	if !latOK || !lonOK {
+		return nil, errors.New("location needs latitude and longitude")
+	}
+	return &Location{Latitude: lat, Longitude: lon}, nil
+}
+
+// durationArg accepts a duration string such as "10m" or a number of seconds
+func durationArg(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case string:
+		return time.ParseDuration(v)
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	return 0, errors.New("window must be a duration or a number of seconds")
+}
@@ -0,0 +1,73 @@
+package detector_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector_ExpressionRules(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	lists, err := detector.LoadLists(strings.NewReader(`{"bad_ips": ["203.0.113.7"]}`))
+	require.NoError(t, err)
+	d.SetLists(lists)
+
+	rules := map[string]string{
+		"SPIKE":    "profile(tx.account_id).tx_count >= 2 && tx.amount > 3 * profile(tx.account_id).avg_amount",
+		"BAD_IP":   "in_list('bad_ips', tx.ip_address)",
+		"BURST":    "velocity(tx.account_id, '10m') >= 2",
+		"FAR":      "distance(last_location(tx.account_id), tx.location) > 5000",
+		"NIGHT_HK": "hour_local(tx) == 3",
+	}
+	for id, expression := range rules {
+		require.NoError(t, d.AddExpressionRule(detector.Rule{ID: id, Description: id, Expression: expression, Score: 0.1}))
+	}
+	assert.Error(t, d.AddExpressionRule(detector.Rule{ID: "BROKEN", Expression: "profile()"}))
+
+	now := time.Now()
+	analyze := func(tx detector.Transaction) []string {
+		tx.ID = "TXN-EXPR"
+		tx.AccountID = "ACC-EXPR"
+		if tx.Timestamp.IsZero() {
+			tx.Timestamp = now
+		}
+		score, err := d.Analyze(context.Background(), &tx)
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+
+	codes := analyze(detector.Transaction{Amount: 50, Location: newYork})
+	assert.NotContains(t, codes, "SPIKE")
+	assert.NotContains(t, codes, "FAR", "no previous location")
+
+	codes = analyze(detector.Transaction{Amount: 70, Location: newYork, IPAddress: "203.0.113.7"})
+	assert.Contains(t, codes, "BAD_IP")
+	assert.NotContains(t, codes, "BURST")
+
+	codes = analyze(detector.Transaction{Amount: 900, Location: moscow})
+	assert.Contains(t, codes, "SPIKE")
+	assert.Contains(t, codes, "BURST")
+	assert.Contains(t, codes, "FAR")
+
+	// 19:00 UTC is 03:00 in Hong Kong
+	hongKong := detector.Location{Latitude: 22.3193, Longitude: 114.1694, Country: "HK"}
+	codes = analyze(detector.Transaction{
+		Amount:    60,
+		Location:  hongKong,
+		Timestamp: time.Date(2026, 3, 1, 19, 0, 0, 0, time.UTC),
+	})
+	assert.Contains(t, codes, "NIGHT_HK")
+
+	var expressions int
+	for _, rule := range d.Rules() {
+		if rule.Expression != "" {
+			expressions++
+		}
+	}
+	assert.Equal(t, len(rules), expressions)
+}
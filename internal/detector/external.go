@@ -0,0 +1,49 @@
+package detector
+
+import "context"
+
+// ExternalScorer is a custom scoring module loaded at runtime, such as a
+// WebAssembly module. It sees the enriched transaction.
+type ExternalScorer interface {
+	Name() string
+	Score(ctx context.Context, tx *Transaction) (ExternalResult, error)
+}
+
+// ExternalResult is the outcome of an external scorer. Scores are clamped
+// to [0, 1].
+type ExternalResult struct {
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+	Codes   []string `json:"codes"`
+}
+
+// AddExternalScorer adds a custom scoring module, run after the built-in
+// checks
+func (d *Detector) AddExternalScorer(scorer ExternalScorer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.external = append(d.external, scorer)
+}
+
+// scoreExternal runs the external scorers. Scorers that fail, e.g. by
+// exceeding their limits, add nothing; they report their own errors.
+func (d *Detector) scoreExternal(ctx context.Context, tx *Transaction) ExternalResult {
+	d.mu.RLock()
+	scorers := d.external
+	d.mu.RUnlock()
+
+	total := ExternalResult{}
+	for _, scorer := range scorers {
+		result, err := scorer.Score(ctx, tx)
+		if err != nil || result.Score <= 0 {
+			continue
+		}
+		if result.Score > 1 {
+			result.Score = 1
+		}
+		total.Score += result.Score
+		total.Reasons = append(total.Reasons, result.Reasons...)
+		total.Codes = append(total.Codes, result.Codes...)
+	}
+	return total
+}
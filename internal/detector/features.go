@@ -0,0 +1,44 @@
+package detector
+
+// Features the detector checks with its gate before running them. Each one
+// covers a detection module that is more recent than the core rules.
+const (
+	FeatureMuleDetection    = "mule_detection"
+	FeatureBeneficiaryRisk  = "beneficiary_risk"
+	FeaturePromoAbuse       = "promo_abuse"
+	FeatureClearingChecks   = "clearing_checks"
+	FeatureEntityReputation = "entity_reputation"
+)
+
+// Features describes the gated features by name
+func Features() map[string]string {
+	return map[string]string{
+		FeatureMuleDetection:    "Pass-through funds fanned out to many beneficiaries",
+		FeatureBeneficiaryRisk:  "New, shared and labeled beneficiaries",
+		FeaturePromoAbuse:       "Signup bonuses redeemed by many accounts of a device or IP",
+		FeatureClearingChecks:   "First payments, cutoff timing and salary-like batches of ACH and SEPA transfers",
+		FeatureEntityReputation: "Decaying fraud reputation of devices, IPs and merchants",
+	}
+}
+
+// FeatureGate decides whether a feature is on for a transaction, so modules
+// can ship dark and be rolled out per tenant. A feature that is off neither
+// scores the transaction nor records it.
+type FeatureGate interface {
+	FeatureEnabled(feature string, tx *Transaction) bool
+}
+
+// SetFeatureGate sets the gate of the features. Without one every feature
+// is on.
+func (d *Detector) SetFeatureGate(gate FeatureGate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.features = gate
+}
+
+func (d *Detector) featureEnabled(feature string, tx *Transaction) bool {
+	d.mu.RLock()
+	gate := d.features
+	d.mu.RUnlock()
+	return gate == nil || gate.FeatureEnabled(feature, tx)
+}
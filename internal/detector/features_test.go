@@ -0,0 +1,36 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// darkGate turns the beneficiary checks off for one merchant
+type darkGate struct{}
+
+func (darkGate) FeatureEnabled(feature string, tx *detector.Transaction) bool {
+	return feature != detector.FeatureBeneficiaryRisk || tx.MerchantID != "MERCH-DARK"
+}
+
+func TestDetector_FeatureGate(t *testing.T) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.LabelBeneficiary("IBAN-SCAM", "confirmed scam report")
+	d.SetFeatureGate(darkGate{})
+
+	tx := transfer("ACC-1", "transfer", "IBAN-SCAM", 20, time.Now())
+	tx.MerchantID = "MERCH-DARK"
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonBeneficiaryFraudLabel)
+
+	tx = transfer("ACC-2", "transfer", "IBAN-SCAM", 20, time.Now())
+	tx.MerchantID = "MERCH-LIVE"
+	score, err = d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonBeneficiaryFraudLabel)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +21,103 @@ type Transaction struct {
 	Type          string    `json:"type"`
 	DeviceID      string    `json:"device_id"`
 	IPAddress     string    `json:"ip_address"`
+
+	// RefundDestination is where the funds of a refund are sent (card token,
+	// wallet or address), when it is known
+	RefundDestination string `json:"refund_destination,omitempty"`
+
+	// Crypto is set for cryptocurrency transfers
+	Crypto *CryptoDetails `json:"crypto,omitempty"`
+	// Clearing is set for ACH and SEPA transfers
+	Clearing *ClearingDetails `json:"clearing,omitempty"`
+
+	// AccountCreatedAt is when the account was opened, if the client knows
+	AccountCreatedAt time.Time `json:"account_created_at,omitempty"`
+
+	// MerchantCountry is enriched from the merchant profile when not sent
+	MerchantCountry string `json:"merchant_country,omitempty"`
+	// MCC is the merchant category code, enriched from the merchant profile
+	// when not sent
+	MCC string `json:"mcc,omitempty"`
+	// MerchantRiskTier and MerchantExpectedTicket are enriched from the
+	// merchant profile
+	MerchantRiskTier       string  `json:"merchant_risk_tier,omitempty"`
+	MerchantExpectedTicket float64 `json:"merchant_expected_ticket,omitempty"`
+	// IPCountry is the country the IP address geolocates to
+	IPCountry string `json:"ip_country,omitempty"`
+	// ASN is the autonomous system announcing the IP address, and ASNOrg
+	// and NetworkType its organization and type of network; enriched from
+	// the ASN table when not sent
+	ASN         uint32 `json:"asn,omitempty"`
+	ASNOrg      string `json:"asn_org,omitempty"`
+	NetworkType string `json:"network_type,omitempty"`
+	// IssuerCountry is the country of the card issuer, e.g. from the BIN
+	IssuerCountry string `json:"issuer_country,omitempty"`
+	// CardBrand is the card network, e.g. visa or mastercard
+	CardBrand string `json:"card_brand,omitempty"`
+
+	// MandateID identifies the standing order or recurring payment mandate
+	// the payment belongs to
+	MandateID string `json:"mandate_id,omitempty"`
+	// Destination is the payee account of a transfer or standing order, the
+	// beneficiary whose risk is tracked
+	Destination string `json:"destination,omitempty"`
+	// BeneficiaryAddedAt is when the sender added the beneficiary, if the
+	// client knows
+	BeneficiaryAddedAt time.Time `json:"beneficiary_added_at,omitempty"`
+
+	// InstrumentID identifies the payment instrument, such as a card, by a
+	// token or hash; never the raw card number
+	InstrumentID string `json:"instrument_id,omitempty"`
+
+	// CampaignID is the promotion whose bonus the transaction redeems
+	CampaignID string `json:"campaign_id,omitempty"`
+
+	// Fee, Tax and Shipping are the parts of the amount not paying for the
+	// items, when the client breaks it down
+	Fee      float64 `json:"fee,omitempty"`
+	Tax      float64 `json:"tax,omitempty"`
+	Shipping float64 `json:"shipping,omitempty"`
+	// Items are the line items of the basket the transaction pays for
+	Items []LineItem `json:"items,omitempty"`
+	// BillingAddress and ShippingAddress are the addresses of the order
+	BillingAddress  *Address `json:"billing_address,omitempty"`
+	ShippingAddress *Address `json:"shipping_address,omitempty"`
+	// ShippingForwarder names the freight forwarder the order ships to,
+	// enriched from the forwarder list
+	ShippingForwarder string `json:"shipping_forwarder,omitempty"`
+
+	// Splits are the sub-merchant legs of a marketplace payment, each
+	// assessed on its own
+	Splits []Split `json:"splits,omitempty"`
+
+	// Sequence is computed by the detector from the account history
+	Sequence SequenceFeatures `json:"sequence"`
+	// CorridorRisk is the risk of the issuer, merchant and IP country
+	// corridor, computed by the detector
+	CorridorRisk float64 `json:"corridor_risk,omitempty"`
+	// Reputation is the decayed fraud reputation of the device, IP and
+	// merchant, computed by the detector
+	Reputation Reputation `json:"reputation,omitempty"`
+	// AmountThreshold is the high amount threshold of the account, computed
+	// by the detector from its history; zero until it has enough history
+	AmountThreshold float64 `json:"amount_threshold,omitempty"`
+	// Calendar is the effect of the calendar events running for the
+	// transaction, computed by the detector; nil when none is
+	Calendar *CalendarEffect `json:"calendar,omitempty"`
+	// Features are the registered model features, computed by the ML
+	// feature builder
+	Features map[string]float64 `json:"features,omitempty"`
+
+	// overrides are resolved by the detector from the merchant
+	overrides *Overrides
+	// exprVars are the expression variables shared by the conditions of
+	// one rule evaluation
+	exprVars map[string]interface{}
+	// ruleDeadline is when the rule being evaluated runs out of budget, and
+	// ruleAborted whether its expression was aborted at the deadline
+	ruleDeadline time.Time
+	ruleAborted  bool
 }
 
 // Location represents geographical coordinates
@@ -35,9 +133,38 @@ type FraudScore struct {
 	Score       float64           `json:"score"`
 	Risk        string            `json:"risk"`
 	Reasons     []string          `json:"reasons"`
+	ReasonCodes []string          `json:"reason_codes,omitempty"`
 	Confidence  float64           `json:"confidence"`
 	ShouldBlock bool              `json:"should_block"`
 	Timestamp   time.Time         `json:"timestamp"`
+
+	// RequiresReview is set by detectors whose findings must reach an analyst
+	// regardless of the final score
+	RequiresReview bool `json:"requires_review,omitempty"`
+
+	// Blocked is set when a hard block signal fired (e.g. a sanctioned
+	// wallet), regardless of the score
+	Blocked bool `json:"blocked,omitempty"`
+
+	// MuleScore rates how much the sender of a transfer behaves like a money
+	// mule passing funds through, from 0 to 1
+	MuleScore float64 `json:"mule_score,omitempty"`
+
+	// Trusted is set when the merchant lists the account as a trusted
+	// customer
+	Trusted bool `json:"trusted,omitempty"`
+
+	// AmountLimits are what the account has left of the amount limits
+	// covering the transaction
+	AmountLimits []LimitStatus `json:"amount_limits,omitempty"`
+
+	// Splits are the assessments of the legs of a split payment
+	Splits []SplitScore `json:"splits,omitempty"`
+
+	// Contributions are what each component added to the score
+	Contributions []Contribution `json:"contributions,omitempty"`
+	// modelScore is the model score blended into the score, if any
+	modelScore *float64
 }
 
 // Detector is the main fraud detection engine
@@ -46,8 +173,45 @@ type Detector struct {
 	velocityTracker *VelocityTracker
 	geoAnalyzer     *GeoAnalyzer
 	patternMatcher  *PatternMatcher
+	refundTracker   *RefundTracker
+	addressRisk     *AddressRiskList
+	asns            *ASNTable
+	forwarders      *ForwarderList
+	activity        *ActivityTracker
+	merchants       *MerchantRegistry
+	calendar        *Calendar
+	amountLimits    *AmountLimits
+	limitTracker    *LimitTracker
+	profiles        *ProfileTracker
+	sequences       *SequenceTracker
+	recurring       *RecurringTracker
+	instruments     *InstrumentTracker
+	mules           *MuleTracker
+	beneficiaries   *BeneficiaryTracker
+	corridors       *CorridorTracker
+	reputations     *ReputationTracker
+	signups         *SignupTracker
+	promos          *PromoTracker
+	clearing        *ClearingTracker
+	lists           *Lists
+	enrichers       []Enricher
+	overrides       OverrideResolver
+	features        FeatureGate
 	mlModel         MLModel
+	ruleObserver    RuleObserver
+	ruleGuard       *ruleGuard
+	stateLog        StateLog
+	external        []ExternalScorer
+	clock           Clock
 	mu              sync.RWMutex
+	// stateMu orders velocity and profile updates against checkpoints
+	stateMu sync.RWMutex
+	// replicas holds the profile slots of each region, nil outside
+	// active-active deployments
+	replicas *profileSlots
+	// accountLoader restores the state of accounts kept aside at startup
+	// before their first use, nil once every account is restored
+	accountLoader atomic.Pointer[func(accountID string)]
 	config          Config
 }
 
@@ -59,6 +223,9 @@ type Rule struct {
 	Condition   func(*Transaction) bool
 	Score       float64
 	Action      string
+	// Expression is the source of rules defined in the rule expression
+	// language, empty for built-in rules
+	Expression string
 }
 
 // Config holds detector configuration
@@ -68,60 +235,308 @@ type Config struct {
 	HighRiskThreshold float64
 	BlockThreshold    float64
 	MLEnabled        bool
+
+	Refund      RefundConfig
+	Dormancy    DormancyConfig
+	CrossBorder CrossBorderConfig
+	ASN         ASNConfig
+	Amounts     AmountPatternConfig
+	Geo         GeoConfig
+	PreScore    PreScoreConfig
+	Sequence    SequenceConfig
+	Recurring   RecurringConfig
+	Instrument  InstrumentConfig
+	Mule        MuleConfig
+	Beneficiary BeneficiaryConfig
+	Corridor    CorridorConfig
+	Reputation  ReputationConfig
+	Signup      SignupConfig
+	Promo       PromoConfig
+	Clearing    ClearingConfig
+	Basket      BasketConfig
+	Address     AddressConfig
+	Quarantine  QuarantineConfig
+	Spending    SpendingConfig
 }
 
 // NewDetector creates a new fraud detection engine
 func NewDetector(config Config) *Detector {
+	return NewDetectorWith(config, Components{})
+}
+
+// NewDetectorWith creates a new fraud detection engine from the given
+// components, building those left unset
+func NewDetectorWith(config Config, components Components) *Detector {
+	config.CrossBorder = config.CrossBorder.withDefaults()
+	config.ASN = config.ASN.withDefaults()
+	config.Amounts = config.Amounts.withDefaults()
+	config.Geo = config.Geo.withDefaults()
+	config.PreScore = config.PreScore.withDefaults()
+	config.Sequence = config.Sequence.withDefaults()
+	config.Spending = config.Spending.withDefaults()
+	config.Basket = config.Basket.withDefaults()
+	config.Address = config.Address.withDefaults()
+
+	components = components.withDefaults(config)
 	return &Detector{
-		rules:           DefaultRules(),
-		velocityTracker: NewVelocityTracker(config.VelocityWindow),
-		geoAnalyzer:     NewGeoAnalyzer(),
-		patternMatcher:  NewPatternMatcher(),
-		mlModel:         NewMLModel(),
+		rules:           components.Rules,
+		velocityTracker: components.Velocity,
+		geoAnalyzer:     components.Geo,
+		patternMatcher:  components.Patterns,
+		refundTracker:   components.Refunds,
+		addressRisk:     components.AddressRisk,
+		asns:            components.ASNs,
+		forwarders:      components.Forwarders,
+		activity:        components.Activity,
+		merchants:       components.Merchants,
+		calendar:        components.Calendar,
+		amountLimits:    components.AmountLimits,
+		limitTracker:    components.LimitTracker,
+		profiles:        components.Profiles,
+		sequences:       components.Sequences,
+		recurring:       components.Recurring,
+		instruments:     components.Instruments,
+		mules:           components.Mules,
+		beneficiaries:   components.Beneficiaries,
+		corridors:       components.Corridors,
+		reputations:     components.Reputations,
+		signups:         components.Signups,
+		promos:          components.Promos,
+		clearing:        components.Clearing,
+		lists:           components.Lists,
+		enrichers:       components.Enrichers,
+		overrides:       components.Overrides,
+		features:        components.Features,
+		mlModel:         components.MLModel,
+		ruleObserver:    components.RuleObserver,
+		ruleGuard:       newRuleGuard(config.Quarantine),
+		stateLog:        components.StateLog,
+		external:        components.External,
+		clock:           components.Clock,
 		config:          config,
 	}
 }
 
+// reasonsCapacity covers the reasons of all but the riskiest transactions,
+// so appending them rarely grows the slices
+const reasonsCapacity = 8
+
 // Analyze performs fraud analysis on a transaction
 func (d *Detector) Analyze(ctx context.Context, tx *Transaction) (*FraudScore, error) {
 	if tx == nil {
 		return nil, fmt.Errorf("transaction is nil")
 	}
+	d.loadAccount(tx.AccountID)
+	d.observeTime(tx)
 
 	score := &FraudScore{
-		Score:     0.0,
-		Reasons:   []string{},
-		Timestamp: time.Now(),
+		Score:       0.0,
+		Reasons:     make([]string, 0, reasonsCapacity),
+		ReasonCodes: make([]string, 0, reasonsCapacity),
+		Timestamp:   d.clock.Now(),
 	}
 
+	// Enrich from the merchant profile
+	d.enrich(tx)
+	tx.overrides = d.resolveOverrides(tx.MerchantID)
+	score.Trusted = tx.AccountID != "" && tx.overrides.contains(d.lists, TrustedCustomersList, tx.AccountID)
+	tx.CorridorRisk = d.corridors.Risk(tx)
+	tx.Reputation = d.reputation(tx)
+	tx.AmountThreshold = d.amountThreshold(tx.AccountID)
+	tx.Calendar = d.getCalendar().Effect(tx)
+
+	// Rules and the ML model see the transaction relative to the previous ones
+	tx.Sequence = d.sequences.Observe(tx)
+
 	// Apply rule-based detection
-	ruleScore, reasons := d.applyRules(tx)
-	score.Score += ruleScore
-	score.Reasons = append(score.Reasons, reasons...)
+	d.applyRules(tx, score)
+
+	// Rules see the profile before this transaction, velocity and amount
+	// limits include it
+	score.AmountLimits = d.updateState(tx)
+	if limitReason, exceeded := checkAmountLimits(score.AmountLimits); exceeded {
+		score.Reasons = append(score.Reasons, limitReason)
+		score.ReasonCodes = append(score.ReasonCodes, ReasonAmountLimit)
+		score.RequiresReview = true
+	}
 
 	// Check velocity
 	velocityScore, velocityReason := d.checkVelocity(ctx, tx)
 	if velocityScore > 0 {
-		score.Score += velocityScore
+		score.add(ComponentVelocity, velocityScore)
 		score.Reasons = append(score.Reasons, velocityReason)
+		score.ReasonCodes = append(score.ReasonCodes, "HIGH_VELOCITY")
+	}
+
+	// Rapid repeats at the same merchant
+	if sequenceScore, sequenceReason := checkSequence(d.config.Sequence, tx.Sequence); sequenceScore > 0 {
+		score.add(ComponentSequence, sequenceScore)
+		score.Reasons = append(score.Reasons, sequenceReason)
+		score.ReasonCodes = append(score.ReasonCodes, ReasonSequenceBurst)
 	}
 
 	// Analyze geographical patterns
-	geoScore, geoReason := d.analyzeGeography(ctx, tx)
-	if geoScore > 0 {
-		score.Score += geoScore
-		score.Reasons = append(score.Reasons, geoReason)
+	geo := d.analyzeGeography(ctx, tx)
+	if geo.Score > 0 {
+		score.add(ComponentGeography, geo.Score)
+		score.Reasons = append(score.Reasons, geo.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, geo.Codes...)
+	}
+
+	// The same velocity and geography checks per payment instrument, which
+	// spans accounts
+	instrument := d.instruments.Check(d.config.Geo, tx, geo.Codes)
+	if instrument.Score > 0 {
+		score.add(ComponentInstrument, instrument.Score)
+		score.Reasons = append(score.Reasons, instrument.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, instrument.Codes...)
 	}
 
 	// Pattern matching
-	patternScore, patternReasons := d.matchPatterns(tx)
-	score.Score += patternScore
+	patternScore, patternReasons, patternCodes := d.matchPatterns(tx)
+	score.add(ComponentPatterns, patternScore)
 	score.Reasons = append(score.Reasons, patternReasons...)
+	score.ReasonCodes = append(score.ReasonCodes, patternCodes...)
+
+	// Refund and return abuse
+	refund := d.refundTracker.Check(tx)
+	if refund.Score > 0 {
+		score.add(ComponentRefunds, refund.Score)
+		score.Reasons = append(score.Reasons, refund.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, refund.Codes...)
+		score.RequiresReview = true
+	}
+
+	// Account dormancy and new account checks
+	activity := d.activity.Check(tx)
+	if activity.Score > 0 {
+		score.add(ComponentActivity, activity.Score)
+		score.Reasons = append(score.Reasons, activity.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, activity.Codes...)
+		score.RequiresReview = true
+	}
+
+	// Customer, merchant and IP country mismatches
+	crossBorder := checkCrossBorder(d.config.CrossBorder, tx)
+	if crossBorder.Score > 0 {
+		score.add(ComponentCrossBorder, crossBorder.Score)
+		score.Reasons = append(score.Reasons, crossBorder.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, crossBorder.Codes...)
+	}
+
+	// Connections from hosting and cloud networks
+	network := checkASN(d.config.ASN, tx)
+	if network.Score > 0 {
+		score.add(ComponentNetwork, network.Score)
+		score.Reasons = append(score.Reasons, network.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, network.Codes...)
+	}
+
+	// Issuer, merchant and IP country corridor
+	corridor := d.corridors.Check(tx)
+	if corridor.Score > 0 {
+		score.add(ComponentCorridor, corridor.Score)
+		score.Reasons = append(score.Reasons, corridor.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, corridor.Codes...)
+	}
+
+	// Device, IP and merchant fraud reputation
+	reputation := d.reputations.Check(tx)
+	if reputation.Score > 0 {
+		score.add(ComponentReputation, reputation.Score)
+		score.Reasons = append(score.Reasons, reputation.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, reputation.Codes...)
+	}
+
+	// Recurring payments earn a discount, mandate changes add risk
+	recurring := d.recurring.Check(tx)
+	if len(recurring.Codes) > 0 {
+		score.add(ComponentRecurring, recurring.Score-recurring.Discount)
+		score.Reasons = append(score.Reasons, recurring.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, recurring.Codes...)
+	}
+
+	// Funds passed straight through to many beneficiaries
+	if d.featureEnabled(FeatureMuleDetection, tx) {
+		mule := d.mules.Check(tx)
+		score.MuleScore = mule.MuleScore
+		if mule.Score > 0 {
+			score.add(ComponentMule, mule.Score)
+			score.Reasons = append(score.Reasons, mule.Reasons...)
+			score.ReasonCodes = append(score.ReasonCodes, mule.Codes...)
+			score.RequiresReview = true
+		}
+	}
+
+	// New, shared or labeled beneficiaries
+	if d.featureEnabled(FeatureBeneficiaryRisk, tx) {
+		beneficiary := d.beneficiaries.Check(tx)
+		if beneficiary.Score > 0 {
+			score.add(ComponentBeneficiary, beneficiary.Score)
+			score.Reasons = append(score.Reasons, beneficiary.Reasons...)
+			score.ReasonCodes = append(score.ReasonCodes, beneficiary.Codes...)
+		}
+	}
+
+	// Signup bonuses redeemed by many new accounts of one device or IP
+	if d.featureEnabled(FeaturePromoAbuse, tx) {
+		promo := d.promos.Check(tx)
+		if promo.Score > 0 {
+			score.add(ComponentPromo, promo.Score)
+			score.Reasons = append(score.Reasons, promo.Reasons...)
+			score.ReasonCodes = append(score.ReasonCodes, promo.Codes...)
+		}
+	}
+
+	// First payments, cutoff timing and salary-like batches of ACH and SEPA
+	// transfers
+	if d.featureEnabled(FeatureClearingChecks, tx) {
+		clearing := d.clearing.Check(tx)
+		if clearing.Score > 0 {
+			score.add(ComponentClearing, clearing.Score)
+			score.Reasons = append(score.Reasons, clearing.Reasons...)
+			score.ReasonCodes = append(score.ReasonCodes, clearing.Codes...)
+			score.RequiresReview = score.RequiresReview || clearing.Review
+		}
+	}
+
+	// Billing and shipping address mismatches and freight forwarders
+	address := checkAddresses(d.config.Address, tx)
+	if address.Score > 0 {
+		score.add(ComponentAddress, address.Score)
+		score.Reasons = append(score.Reasons, address.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, address.Codes...)
+	}
+
+	// High-risk items and basket anomalies
+	basket := checkBasket(d.config.Basket, tx)
+	if basket.Score > 0 {
+		score.add(ComponentBasket, basket.Score)
+		score.Reasons = append(score.Reasons, basket.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, basket.Codes...)
+	}
+
+	// Crypto address risk
+	crypto := checkCrypto(d.getAddressRiskList(), tx)
+	if crypto.Score > 0 {
+		score.add(ComponentCrypto, crypto.Score)
+		score.Reasons = append(score.Reasons, crypto.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, crypto.Codes...)
+		score.RequiresReview = true
+		score.Blocked = score.Blocked || crypto.Block
+	}
+
+	// Custom scoring modules
+	if external := d.scoreExternal(ctx, tx); external.Score > 0 {
+		score.add(ComponentExternal, external.Score)
+		score.Reasons = append(score.Reasons, external.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, external.Codes...)
+	}
 
 	// ML model scoring (if enabled)
 	if d.config.MLEnabled {
 		mlScore, confidence := d.mlModel.Predict(tx)
-		score.Score = (score.Score + mlScore) / 2
+		score.blend(mlScore)
 		score.Confidence = confidence
 	}
 
@@ -130,64 +545,84 @@ func (d *Detector) Analyze(ctx context.Context, tx *Transaction) (*FraudScore, e
 
 	// Determine risk level and action
 	score.Risk = d.determineRiskLevel(score.Score)
-	score.ShouldBlock = score.Score >= d.config.BlockThreshold
+	score.ShouldBlock = score.Score >= d.config.BlockThreshold || score.Blocked
+
+	// Marketplace payments are also assessed per sub-merchant
+	score.Splits = d.assessSplits(tx)
 
 	return score, nil
 }
 
-func (d *Detector) applyRules(tx *Transaction) (float64, []string) {
-	totalScore := 0.0
-	reasons := []string{}
-
+func (d *Detector) applyRules(tx *Transaction, score *FraudScore) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	for _, rule := range d.rules {
-		if rule.Condition(tx) {
-			totalScore += rule.Score
-			reasons = append(reasons, rule.Description)
+	evaluateRules(d.rules, tx, d.ruleObserver, d.ruleGuard, score)
+}
+
+// RuleObserver is notified of every rule evaluation of a full analysis. The
+// contribution is the rule score when it matched.
+type RuleObserver interface {
+	ObserveRule(ruleID string, matched bool, contribution float64, elapsed time.Duration)
+}
+
+// SetRuleObserver sets the observer of rule evaluations
+func (d *Detector) SetRuleObserver(observer RuleObserver) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ruleObserver = observer
+}
+
+// evaluateRules adds the scores of the matching rules to score, each rule as
+// its own component. Conditions that panic count as not matching;
+// quarantined rules are skipped.
+func evaluateRules(rules []Rule, tx *Transaction, observer RuleObserver, guard *ruleGuard, score *FraudScore) {
+	// Expression conditions share the variables, built for the first one
+	defer func() { tx.exprVars = nil }()
+	tx.exprVars = nil
+	for _, rule := range rules {
+		if tx.overrides.ruleDisabled(rule.ID) || guard.quarantined(rule.ID) {
+			continue
+		}
+		if rule.Expression != "" && tx.exprVars == nil {
+			tx.exprVars = expressionVars(tx)
+		}
+		start := time.Now()
+		matched, ok := guard.evaluate(rule, tx)
+		if !ok {
+			continue
+		}
+		contribution := 0.0
+		if matched {
+			contribution = rule.Score
+			score.add(ComponentRule+rule.ID, rule.Score)
+			score.Reasons = append(score.Reasons, rule.Description)
+			score.ReasonCodes = append(score.ReasonCodes, rule.ID)
+		}
+		if observer != nil {
+			observer.ObserveRule(rule.ID, matched, contribution, time.Since(start))
 		}
 	}
-
-	return totalScore, reasons
 }
 
 func (d *Detector) checkVelocity(ctx context.Context, tx *Transaction) (float64, string) {
-	// Track the transaction first to include it in the count
-	d.velocityTracker.Track(tx)
-	
-	// Now check the velocity including the current transaction
+	// The count includes the current transaction, tracked by updateState
 	count := d.velocityTracker.GetCount(tx.AccountID)
 	
-	if count > d.config.MaxVelocity {
+	// Calendar events relax or tighten the limit
+	if count > tx.Calendar.velocityLimit(d.config.MaxVelocity) {
 		return 0.3, fmt.Sprintf("High transaction velocity: %d transactions in window", count)
 	}
 	
 	return 0.0, ""
 }
 
-func (d *Detector) analyzeGeography(ctx context.Context, tx *Transaction) (float64, string) {
-	lastLocation := d.geoAnalyzer.GetLastLocation(tx.AccountID)
-	if lastLocation == nil {
-		d.geoAnalyzer.UpdateLocation(tx.AccountID, tx.Location)
-		return 0.0, ""
-	}
-
-	distance := d.geoAnalyzer.CalculateDistance(*lastLocation, tx.Location)
-	timeDiff := time.Since(d.geoAnalyzer.GetLastTime(tx.AccountID))
-
-	// Impossible travel detection
-	maxPossibleDistance := timeDiff.Hours() * 900 // 900 km/h max travel speed
-	if distance > maxPossibleDistance {
-		return 0.5, fmt.Sprintf("Impossible travel detected: %.0f km in %.0f hours", distance, timeDiff.Hours())
-	}
-
-	d.geoAnalyzer.UpdateLocation(tx.AccountID, tx.Location)
-	return 0.0, ""
+func (d *Detector) analyzeGeography(ctx context.Context, tx *Transaction) GeoResult {
+	return checkGeography(d.config.Geo, d.geoAnalyzer, tx)
 }
 
-func (d *Detector) matchPatterns(tx *Transaction) (float64, []string) {
-	return d.patternMatcher.Match(tx)
+func (d *Detector) matchPatterns(tx *Transaction) (float64, []string, []string) {
+	return d.patternMatcher.MatchCodes(tx)
 }
 
 func (d *Detector) determineRiskLevel(score float64) string {
@@ -205,11 +640,194 @@ func (d *Detector) determineRiskLevel(score float64) string {
 	}
 }
 
+// SetAddressRiskList replaces the crypto address risk list
+func (d *Detector) SetAddressRiskList(list *AddressRiskList) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addressRisk = list
+}
+
+func (d *Detector) getAddressRiskList() *AddressRiskList {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.addressRisk
+}
+
+// SetASNTable replaces the table of the networks announcing IP prefixes
+func (d *Detector) SetASNTable(table *ASNTable) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.asns = table
+}
+
+func (d *Detector) getASNTable() *ASNTable {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.asns
+}
+
+// SetForwarderList replaces the list of freight forwarder addresses
+func (d *Detector) SetForwarderList(list *ForwarderList) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.forwarders = list
+}
+
+func (d *Detector) getForwarderList() *ForwarderList {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.forwarders
+}
+
+// LocationHistory returns the recent locations of an account, oldest first
+func (d *Detector) LocationHistory(accountID string) []LocationRecord {
+	return d.geoAnalyzer.History(accountID)
+}
+
+// Beneficiary returns the transfer statistics of a beneficiary
+func (d *Detector) Beneficiary(beneficiaryID string) (BeneficiaryStats, bool) {
+	return d.beneficiaries.Stats(beneficiaryID)
+}
+
+// SetCorridorMatrix replaces the configured corridor risks
+func (d *Detector) SetCorridorMatrix(matrix map[string]float64) error {
+	return d.corridors.SetMatrix(matrix)
+}
+
+// Corridors returns every configured or labeled corridor, riskiest first
+func (d *Detector) Corridors() []CorridorStats {
+	return d.corridors.All()
+}
+
+// LabelTransaction records a feedback label, whether a decided transaction
+// turned out to be fraud, in the components that learn from labels. It
+// returns the updated corridor, if the transaction has one.
+func (d *Detector) LabelTransaction(tx *Transaction, fraud bool) (CorridorStats, bool) {
+	d.reputations.Label(tx, fraud)
+	return d.corridors.Label(tx, fraud)
+}
+
+// Reputation returns the current fraud reputation of a device, IP or
+// merchant
+func (d *Detector) Reputation(kind, id string) ReputationScore {
+	return d.reputations.Get(kind, id, d.clock.Now())
+}
+
+// SetReputation grades a device, IP or merchant, from 0 for a clean entity
+// to 1, in place of listing it. The reputation decays from now on.
+func (d *Detector) SetReputation(kind, id string, score float64) (ReputationScore, error) {
+	return d.reputations.Set(kind, id, score, d.clock.Now())
+}
+
+// reputation returns the reputation of a transaction's entities, zero while
+// the feature is off
+func (d *Detector) reputation(tx *Transaction) Reputation {
+	if !d.featureEnabled(FeatureEntityReputation, tx) {
+		return Reputation{}
+	}
+	return d.reputations.Lookup(tx)
+}
+
+// CheckSignup matches an account-creation event against the accounts
+// created before it, flagging probable duplicate and serial accounts
+func (d *Detector) CheckSignup(signup Signup) SignupResult {
+	return d.signups.Check(signup)
+}
+
+// SetPromoCampaigns replaces the per-campaign promotion abuse limits
+func (d *Detector) SetPromoCampaigns(campaigns map[string]Campaign) {
+	d.promos.SetCampaigns(campaigns)
+}
+
+// PromoDecisions returns the promotion decisions made since a time, oldest
+// first, optionally only those of one campaign
+func (d *Detector) PromoDecisions(since time.Time, campaignID string) []PromoDecision {
+	return d.promos.Decisions(since, campaignID)
+}
+
+// LabelBeneficiary records that a beneficiary received fraudulent funds
+func (d *Detector) LabelBeneficiary(beneficiaryID, reason string) BeneficiaryStats {
+	return d.beneficiaries.Label(beneficiaryID, reason)
+}
+
+// SetLists replaces the named lists used by rule expressions
+func (d *Detector) SetLists(lists *Lists) {
+	d.lists.ReplaceAll(lists)
+}
+
+// SetOverrideResolver sets the source of per-merchant rule toggles and lists
+func (d *Detector) SetOverrideResolver(resolver OverrideResolver) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.overrides = resolver
+}
+
+func (d *Detector) resolveOverrides(merchantID string) *Overrides {
+	d.mu.RLock()
+	resolver := d.overrides
+	d.mu.RUnlock()
+	if resolver == nil {
+		return nil
+	}
+	return resolver.Overrides(merchantID)
+}
+
+// Rules returns the active rules
+func (d *Detector) Rules() []Rule {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rules := make([]Rule, len(d.rules))
+	copy(rules, d.rules)
+	return rules
+}
+
+// SetMerchantRegistry replaces the merchant profiles used for enrichment
+func (d *Detector) SetMerchantRegistry(registry *MerchantRegistry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.merchants = registry
+}
+
+func (d *Detector) getMerchantRegistry() *MerchantRegistry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.merchants
+}
+
+// SetCalendar replaces the calendar events that scale the amount and
+// velocity thresholds
+func (d *Detector) SetCalendar(calendar *Calendar) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calendar = calendar
+}
+
+func (d *Detector) getCalendar() *Calendar {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.calendar
+}
+
+// SetAmountLimits replaces the cumulative amount limits of the accounts
+func (d *Detector) SetAmountLimits(limits *AmountLimits) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.amountLimits = limits
+}
+
+func (d *Detector) getAmountLimits() *AmountLimits {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.amountLimits
+}
+
 // AddRule adds a new detection rule
 func (d *Detector) AddRule(rule Rule) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.rules = append(d.rules, rule)
+	d.ruleGuard.release(rule.ID)
 }
 
 // RemoveRule removes a rule by ID
@@ -220,6 +838,7 @@ func (d *Detector) RemoveRule(ruleID string) error {
 	for i, rule := range d.rules {
 		if rule.ID == ruleID {
 			d.rules = append(d.rules[:i], d.rules[i+1:]...)
+			d.ruleGuard.release(ruleID)
 			return nil
 		}
 	}
@@ -228,8 +847,12 @@ func (d *Detector) RemoveRule(ruleID string) error {
 
 // GetMetrics returns detection metrics
 func (d *Detector) GetMetrics() map[string]interface{} {
+	d.mu.RLock()
+	totalRules := len(d.rules)
+	d.mu.RUnlock()
+
 	return map[string]interface{}{
-		"total_rules":        len(d.rules),
+		"total_rules":        totalRules,
 		"velocity_window":    d.config.VelocityWindow,
 		"high_risk_threshold": d.config.HighRiskThreshold,
 		"ml_enabled":         d.config.MLEnabled,
@@ -10,26 +10,80 @@ type FraudDetector struct {
 	detector *Detector
 }
 
-// NewFraudDetector creates a new fraud detector with default configuration
-func NewFraudDetector() *FraudDetector {
-	config := Config{
+// DefaultConfig returns the default detector configuration
+func DefaultConfig() Config {
+	return Config{
 		MaxVelocity:       5,
 		VelocityWindow:    time.Hour,
 		HighRiskThreshold: 0.6,
 		BlockThreshold:    0.8,
 		MLEnabled:         true,
 	}
+}
+
+// NewFraudDetector creates a new fraud detector with default configuration
+func NewFraudDetector() *FraudDetector {
+	return NewFraudDetectorWithConfig(DefaultConfig())
+}
 
+// NewFraudDetectorWithConfig creates a new fraud detector with the given configuration
+func NewFraudDetectorWithConfig(config Config) *FraudDetector {
 	return &FraudDetector{
 		detector: NewDetector(config),
 	}
 }
 
+// NewFraudDetectorWithComponents creates a new fraud detector from the given
+// configuration and components, building those left unset
+func NewFraudDetectorWithComponents(config Config, components Components) *FraudDetector {
+	return &FraudDetector{
+		detector: NewDetectorWith(config, components),
+	}
+}
+
+// AddEnricher adds an enricher run before every analysis
+func (fd *FraudDetector) AddEnricher(enricher Enricher) {
+	fd.detector.AddEnricher(enricher)
+}
+
 // AnalyzeTransaction analyzes a transaction for fraud
 func (fd *FraudDetector) AnalyzeTransaction(tx *Transaction) (*FraudScore, error) {
 	return fd.detector.Analyze(context.Background(), tx)
 }
 
+// PreScoreTransaction scores a transaction before authorization without
+// updating per-account state
+func (fd *FraudDetector) PreScoreTransaction(tx *Transaction) (*FraudScore, error) {
+	return fd.detector.PreScore(tx)
+}
+
+// RevalidateTransaction re-checks a transaction decided earlier without
+// updating per-account state
+func (fd *FraudDetector) RevalidateTransaction(tx *Transaction) (*FraudScore, error) {
+	return fd.detector.Revalidate(tx)
+}
+
+// SetRuleObserver sets the observer of rule evaluations
+func (fd *FraudDetector) SetRuleObserver(observer RuleObserver) {
+	fd.detector.SetRuleObserver(observer)
+}
+
+// GetRuleHealth returns the rules whose conditions panicked or overran
+// their budget
+func (fd *FraudDetector) GetRuleHealth() []RuleHealth {
+	return fd.detector.RuleHealth()
+}
+
+// ReleaseRule takes a rule out of quarantine
+func (fd *FraudDetector) ReleaseRule(ruleID string) (RuleHealth, bool) {
+	return fd.detector.ReleaseRule(ruleID)
+}
+
+// SetQuarantineObserver sets the observer alerted of quarantined rules
+func (fd *FraudDetector) SetQuarantineObserver(observer QuarantineObserver) {
+	fd.detector.SetQuarantineObserver(observer)
+}
+
 // GetStatistics returns fraud detection statistics
 func (fd *FraudDetector) GetStatistics() map[string]interface{} {
 	return fd.detector.GetMetrics()
@@ -37,9 +91,7 @@ func (fd *FraudDetector) GetStatistics() map[string]interface{} {
 
 // GetActiveRules returns the list of active detection rules
 func (fd *FraudDetector) GetActiveRules() []Rule {
-	// Since rules is private, we need to access it differently
-	// Return the default rules for now
-	return DefaultRules()
+	return fd.detector.Rules()
 }
 
 // AddCustomRule adds a custom fraud detection rule
@@ -47,6 +99,176 @@ func (fd *FraudDetector) AddCustomRule(rule Rule) {
 	fd.detector.AddRule(rule)
 }
 
+// AddExpressionRule adds a rule defined by an expression
+func (fd *FraudDetector) AddExpressionRule(rule Rule) error {
+	return fd.detector.AddExpressionRule(rule)
+}
+
+// CheckExpressionRules validates expression rules without adding them
+func (fd *FraudDetector) CheckExpressionRules(rules []Rule) error {
+	return fd.detector.CheckExpressionRules(rules)
+}
+
+// ReplaceExpressionRules atomically replaces every expression rule
+func (fd *FraudDetector) ReplaceExpressionRules(rules []Rule) error {
+	return fd.detector.ReplaceExpressionRules(rules)
+}
+
+// Beneficiary returns the transfer statistics of a beneficiary
+func (fd *FraudDetector) Beneficiary(beneficiaryID string) (BeneficiaryStats, bool) {
+	return fd.detector.Beneficiary(beneficiaryID)
+}
+
+// SetCorridorMatrix replaces the configured corridor risks
+func (fd *FraudDetector) SetCorridorMatrix(matrix map[string]float64) error {
+	return fd.detector.SetCorridorMatrix(matrix)
+}
+
+// Corridors returns every configured or labeled corridor, riskiest first
+func (fd *FraudDetector) Corridors() []CorridorStats {
+	return fd.detector.Corridors()
+}
+
+// LabelTransaction records whether a decided transaction turned out to be
+// fraud
+func (fd *FraudDetector) LabelTransaction(tx *Transaction, fraud bool) (CorridorStats, bool) {
+	return fd.detector.LabelTransaction(tx, fraud)
+}
+
+// Reputation returns the current fraud reputation of a device, IP or
+// merchant
+func (fd *FraudDetector) Reputation(kind, id string) ReputationScore {
+	return fd.detector.Reputation(kind, id)
+}
+
+// SetReputation grades a device, IP or merchant in place of listing it
+func (fd *FraudDetector) SetReputation(kind, id string, score float64) (ReputationScore, error) {
+	return fd.detector.SetReputation(kind, id, score)
+}
+
+// CheckSignup scores an account-creation event for duplicate accounts
+func (fd *FraudDetector) CheckSignup(signup Signup) SignupResult {
+	return fd.detector.CheckSignup(signup)
+}
+
+// SetPromoCampaigns sets the per-campaign promotion abuse limits
+func (fd *FraudDetector) SetPromoCampaigns(campaigns map[string]Campaign) {
+	fd.detector.SetPromoCampaigns(campaigns)
+}
+
+// PromoDecisions returns the recent promotion decisions
+func (fd *FraudDetector) PromoDecisions(since time.Time, campaignID string) []PromoDecision {
+	return fd.detector.PromoDecisions(since, campaignID)
+}
+
+// LabelBeneficiary records that a beneficiary received fraudulent funds
+func (fd *FraudDetector) LabelBeneficiary(beneficiaryID, reason string) BeneficiaryStats {
+	return fd.detector.LabelBeneficiary(beneficiaryID, reason)
+}
+
+// SetLists sets the named lists used by rule expressions
+func (fd *FraudDetector) SetLists(lists *Lists) {
+	fd.detector.SetLists(lists)
+}
+
+// SetOverrideResolver sets the source of per-merchant rule toggles and lists
+func (fd *FraudDetector) SetOverrideResolver(resolver OverrideResolver) {
+	fd.detector.SetOverrideResolver(resolver)
+}
+
+// SetFeatureGate sets the gate of the features
+func (fd *FraudDetector) SetFeatureGate(gate FeatureGate) {
+	fd.detector.SetFeatureGate(gate)
+}
+
+// SetStateLog sets the log of velocity and profile state updates
+func (fd *FraudDetector) SetStateLog(log StateLog) {
+	fd.detector.SetStateLog(log)
+}
+
+// CheckpointState calls fn with a copy of the velocity and profile state
+// while no transaction updates it
+func (fd *FraudDetector) CheckpointState(fn func(State)) {
+	fd.detector.CheckpointState(fn)
+}
+
+// RestoreState replaces the velocity and profile state
+func (fd *FraudDetector) RestoreState(state State) {
+	fd.detector.RestoreState(state)
+}
+
+// ReplayState applies a logged state update
+func (fd *FraudDetector) ReplayState(entry StateEntry) {
+	fd.detector.ReplayState(entry)
+}
+
+// RestoreAccounts replaces the state of the accounts of a state
+func (fd *FraudDetector) RestoreAccounts(state State) {
+	fd.detector.RestoreAccounts(state)
+}
+
+// SetAccountLoader sets the function restoring accounts kept aside at startup
+func (fd *FraudDetector) SetAccountLoader(load func(accountID string)) {
+	fd.detector.SetAccountLoader(load)
+}
+
+// SetRegion names the region of this engine in an active-active deployment
+func (fd *FraudDetector) SetRegion(region string) {
+	fd.detector.SetRegion(region)
+}
+
+// LocalProfileSlot returns what this region contributed to the profile of
+// an account
+func (fd *FraudDetector) LocalProfileSlot(accountID string) (ProfileSlot, bool) {
+	return fd.detector.LocalProfileSlot(accountID)
+}
+
+// MergeProfileSlot merges the profile slot of another region
+func (fd *FraudDetector) MergeProfileSlot(accountID, region string, slot ProfileSlot) bool {
+	return fd.detector.MergeProfileSlot(accountID, region, slot)
+}
+
+// AddExternalScorer adds a custom scoring module
+func (fd *FraudDetector) AddExternalScorer(scorer ExternalScorer) {
+	fd.detector.AddExternalScorer(scorer)
+}
+
+// SetAddressRiskList sets the list of flagged crypto wallets and exchanges
+func (fd *FraudDetector) SetAddressRiskList(list *AddressRiskList) {
+	fd.detector.SetAddressRiskList(list)
+}
+
+// SetASNTable sets the table of the networks IP addresses belong to
+func (fd *FraudDetector) SetASNTable(table *ASNTable) {
+	fd.detector.SetASNTable(table)
+}
+
+// SetForwarderList sets the freight forwarder addresses shipping addresses
+// are matched against
+func (fd *FraudDetector) SetForwarderList(list *ForwarderList) {
+	fd.detector.SetForwarderList(list)
+}
+
+// LocationHistory returns the recent locations of an account, oldest first
+func (fd *FraudDetector) LocationHistory(accountID string) []LocationRecord {
+	return fd.detector.LocationHistory(accountID)
+}
+
+// SetMerchantRegistry sets the merchant profiles used to enrich transactions
+func (fd *FraudDetector) SetMerchantRegistry(registry *MerchantRegistry) {
+	fd.detector.SetMerchantRegistry(registry)
+}
+
+// SetCalendar sets the calendar events that scale detection thresholds
+func (fd *FraudDetector) SetCalendar(calendar *Calendar) {
+	fd.detector.SetCalendar(calendar)
+}
+
+// SetAmountLimits sets the cumulative amount limits of the accounts
+func (fd *FraudDetector) SetAmountLimits(limits *AmountLimits) {
+	fd.detector.SetAmountLimits(limits)
+}
+
 // UpdateTransaction adds missing fields for API compatibility
 func UpdateTransaction(tx *Transaction, customerID, paymentMethod, country, city, ipAddress, deviceID, userAgent string, metadata map[string]interface{}) {
 	if tx.AccountID == "" && customerID != "" {
@@ -2,12 +2,15 @@ package detector_test
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDetector(t *testing.T) {
@@ -281,6 +284,36 @@ func TestVelocityTracker_WindowExpiry(t *testing.T) {
 	assert.LessOrEqual(t, count, 1) // Old transaction should be expired
 }
 
+func TestVelocityTracker_CountSince(t *testing.T) {
+	tracker := detector.NewVelocityTracker(time.Hour)
+	now := time.Now()
+	for _, age := range []time.Duration{50 * time.Minute, 20 * time.Minute, 5 * time.Minute, time.Second} {
+		tracker.TrackKey("ACC-1", now.Add(-age))
+	}
+	tracker.TrackKey("ACC-1", now.Add(-2*time.Hour))
+	tracker.TrackKey("ACC-1", now.Add(time.Hour))
+
+	assert.Equal(t, 5, tracker.GetCount("ACC-1"), "older transactions are dropped, future ones count as now")
+	assert.Equal(t, 3, tracker.CountSince("ACC-1", 10*time.Minute))
+	assert.Equal(t, 5, tracker.CountSince("ACC-1", 24*time.Hour), "capped at the tracker window")
+}
+
+func TestVelocityTracker_SnapshotRestore(t *testing.T) {
+	tracker := detector.NewVelocityTracker(time.Hour)
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		tracker.TrackKey("ACC-1", now.Add(-time.Duration(i)*time.Second))
+	}
+	snapshot := tracker.Snapshot()
+	require.Len(t, snapshot["ACC-1"], 1000)
+	assert.False(t, snapshot["ACC-1"][0].After(snapshot["ACC-1"][999]), "oldest first")
+
+	restored := detector.NewVelocityTracker(time.Hour)
+	restored.Restore(snapshot)
+	assert.Equal(t, 1000, restored.GetCount("ACC-1"))
+	assert.Equal(t, tracker.CountSince("ACC-1", 10*time.Minute), restored.CountSince("ACC-1", 10*time.Minute))
+}
+
 func TestGeoAnalyzer(t *testing.T) {
 	analyzer := detector.NewGeoAnalyzer()
 	
@@ -523,6 +556,37 @@ func BenchmarkVelocityTracking(b *testing.B) {
 	}
 }
 
+func BenchmarkVelocityTracking_ManyAccounts(b *testing.B) {
+	tracker := detector.NewVelocityTracker(time.Minute)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("ACC-%05d", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := keys[i%len(keys)]
+		tracker.TrackKey(key, time.Now())
+		_ = tracker.GetCount(key)
+	}
+}
+
+func BenchmarkVelocityTracking_Parallel(b *testing.B) {
+	tracker := detector.NewVelocityTracker(time.Minute)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := fmt.Sprintf("ACC-%03d", next.Add(1)%1000)
+			tracker.TrackKey(key, time.Now())
+			_ = tracker.GetCount(key)
+		}
+	})
+}
+
 func BenchmarkGeoCalculation(b *testing.B) {
 	analyzer := detector.NewGeoAnalyzer()
 	
@@ -533,4 +597,105 @@ func BenchmarkGeoCalculation(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_ = analyzer.CalculateDistance(loc1, loc2)
 	}
-}
\ No newline at end of file
+}
+// benchmarkTransactions returns transactions spread over many accounts, as
+// production traffic is, so per-account state stays small
+func benchmarkTransactions(n int) []*detector.Transaction {
+	txs := make([]*detector.Transaction, n)
+	for i := range txs {
+		txs[i] = &detector.Transaction{
+			ID:        fmt.Sprintf("BENCH-%d", i),
+			AccountID: fmt.Sprintf("ACC-%d", i%5000),
+			Amount:    float64(20 + i%400),
+			Currency:  "USD",
+			Location:  newYork,
+			Timestamp: time.Now(),
+			Type:      "PURCHASE",
+			DeviceID:  fmt.Sprintf("DEVICE-%d", i%5000),
+			IPAddress: "192.168.1.1",
+		}
+	}
+	return txs
+}
+
+func benchmarkAnalyze(b *testing.B, d *detector.Detector) {
+	txs := benchmarkTransactions(50000)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Analyze(ctx, txs[i%len(txs)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDetectorAnalyze_ManyAccounts(b *testing.B) {
+	benchmarkAnalyze(b, detector.NewDetector(detector.Config{
+		MaxVelocity:    5,
+		VelocityWindow: time.Minute,
+		BlockThreshold: 0.8,
+		MLEnabled:      true,
+	}))
+}
+
+func BenchmarkDetectorAnalyze_ExpressionRules(b *testing.B) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 5, VelocityWindow: time.Minute, BlockThreshold: 0.8})
+	for i, expression := range []string{
+		"tx.amount > 3 * profile(tx.account_id).avg_amount",
+		"tx.amount > 300 and tx.hour_local < 6",
+		"tx.location.country != tx.merchant_country and tx.amount > 200",
+		"velocity(tx.account_id, '10m') > 3",
+		"tx.sequence.same_merchant_repeats > 2",
+	} {
+		if err := d.AddExpressionRule(detector.Rule{ID: fmt.Sprintf("BENCH_%d", i), Expression: expression, Score: 0.1}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	benchmarkAnalyze(b, d)
+}
+
+func BenchmarkDetectorAnalyze_Parallel(b *testing.B) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 5, VelocityWindow: time.Minute, BlockThreshold: 0.8})
+	txs := benchmarkTransactions(50000)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			// Analyze enriches the transaction, so goroutines each get a copy
+			tx := *txs[int(next.Add(1))%len(txs)]
+			if _, err := d.Analyze(ctx, &tx); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func TestDetector_Analyze_Contributions(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 5, VelocityWindow: time.Minute, BlockThreshold: 0.8, MLEnabled: true})
+	tx := &detector.Transaction{
+		ID:        "TXN-005",
+		AccountID: "ACC-111",
+		Amount:    60000.00,
+		Currency:  "USD",
+		Timestamp: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC),
+	}
+
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	components := make([]string, len(score.Contributions))
+	for i, contribution := range score.Contributions {
+		components[i] = contribution.Component
+	}
+	assert.Contains(t, components, detector.ComponentRule+"HIGH_AMOUNT")
+	assert.Contains(t, components, detector.ComponentRule+"UNUSUAL_TIME")
+
+	assert.InDelta(t, score.Score, score.ScoreWithout(), 1e-9, "nothing removed")
+	withoutAmount := score.ScoreWithout(detector.ComponentRule + "HIGH_AMOUNT")
+	assert.InDelta(t, score.Score-0.15, withoutAmount, 1e-9, "half the rule score, as the model score is blended in")
+	assert.Greater(t, score.ScoreWithout(components...), 0.0, "the model score remains")
+}
@@ -0,0 +1,185 @@
+package detector
+
+import (
+	"fmt"
+	"time"
+)
+
+// GeoConfig holds geographical analysis settings
+type GeoConfig struct {
+	// HistorySize is the number of recent locations kept per account
+	HistorySize int
+	MaxSpeedKmh float64
+	// ClockSkew is how far the clocks stamping transactions may disagree.
+	// It is added to the time between two locations, so near-simultaneous
+	// transactions from sources with skewed clocks are not impossible travel.
+	ClockSkew time.Duration
+	// An account ping-pongs when it switches at least PingPongSwitches times
+	// between two countries PingPongDistanceKm apart within PingPongWindow
+	PingPongWindow     time.Duration
+	PingPongSwitches   int
+	PingPongDistanceKm float64
+}
+
+// DefaultGeoConfig returns the default geographical settings
+func DefaultGeoConfig() GeoConfig {
+	return GeoConfig{
+		HistorySize:        10,
+		MaxSpeedKmh:        900,
+		ClockSkew:          5 * time.Minute,
+		PingPongWindow:     24 * time.Hour,
+		PingPongSwitches:   3,
+		PingPongDistanceKm: 1000,
+	}
+}
+
+func (c GeoConfig) withDefaults() GeoConfig {
+	defaults := DefaultGeoConfig()
+	if c.HistorySize <= 0 {
+		c.HistorySize = defaults.HistorySize
+	}
+	if c.MaxSpeedKmh <= 0 {
+		c.MaxSpeedKmh = defaults.MaxSpeedKmh
+	}
+	if c.ClockSkew <= 0 {
+		c.ClockSkew = defaults.ClockSkew
+	}
+	if c.PingPongWindow <= 0 {
+		c.PingPongWindow = defaults.PingPongWindow
+	}
+	if c.PingPongSwitches <= 0 {
+		c.PingPongSwitches = defaults.PingPongSwitches
+	}
+	if c.PingPongDistanceKm <= 0 {
+		c.PingPongDistanceKm = defaults.PingPongDistanceKm
+	}
+	return c
+}
+
+// Geographical reason codes
+const (
+	ReasonImpossibleTravel = "IMPOSSIBLE_TRAVEL"
+	ReasonGeoPingPong      = "GEO_PING_PONG"
+)
+
+// Scores of the geographical findings
+const (
+	impossibleTravelScore = 0.5
+	pingPongScore         = 0.3
+)
+
+// GeoResult is the outcome of the geographical analysis
+type GeoResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// checkGeography compares a transaction with the recent locations of its
+// account. Travel is impossible when any recent location is too far away to
+// reach in the time between the transactions, which also catches trips spread
+// over several hops. Times are those of the transactions, so late and
+// backfilled ones are compared with the locations around them.
+func checkGeography(config GeoConfig, geo *GeoAnalyzer, tx *Transaction) GeoResult {
+	return checkLocations(config, geo, tx.AccountID, tx)
+}
+
+// checkLocations runs the geographical analysis for the locations recorded
+// under any key and records the transaction's location
+func checkLocations(config GeoConfig, geo *GeoAnalyzer, key string, tx *Transaction) GeoResult {
+	result := GeoResult{}
+	var buffer [historyBufferSize]LocationRecord
+	history := geo.appendHistory(buffer[:0], key)
+	at := transactionTime(config, geo.clock, tx)
+
+	for i := len(history) - 1; i >= 0; i-- {
+		distance := geo.CalculateDistance(history[i].Location, tx.Location)
+		elapsed := at.Sub(history[i].Time)
+		if elapsed < 0 {
+			// The transaction arrived after a later one
+			elapsed = -elapsed
+		}
+		if distance > (elapsed+config.ClockSkew).Hours()*config.MaxSpeedKmh {
+			result.Score += impossibleTravelScore
+			result.Codes = append(result.Codes, ReasonImpossibleTravel)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Impossible travel detected: %.0f km in %.0f hours", distance, elapsed.Hours()))
+			break
+		}
+	}
+
+	if switches, a, b := pingPong(config, geo, history, tx.Location, at); switches >= config.PingPongSwitches {
+		result.Score += pingPongScore
+		result.Codes = append(result.Codes, ReasonGeoPingPong)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Location switched %d times between %s and %s", switches, a, b))
+	}
+
+	geo.RecordLocation(key, tx.Location, at)
+	return result
+}
+
+// transactionTime returns when a transaction happened: its timestamp, or now
+// when it has none or is stamped further in the future than the clock skew
+func transactionTime(config GeoConfig, clock Clock, tx *Transaction) time.Time {
+	now := clock.Now()
+	if tx.Timestamp.IsZero() || tx.Timestamp.After(now.Add(config.ClockSkew)) {
+		return now
+	}
+	return tx.Timestamp
+}
+
+// historyBufferSize covers the default location history, which is copied
+// without allocating
+const historyBufferSize = 16
+
+// pingPong counts far switches between exactly two countries in the recent
+// history plus the current location, which happened at a time and is
+// visited in its place among them
+func pingPong(config GeoConfig, geo *GeoAnalyzer, history []LocationRecord, current Location, at time.Time) (int, string, string) {
+	var first, second string
+	var previous Location
+	switches, seen := 0, 0
+	// visit returns false on a third country
+	visit := func(location Location) bool {
+		switch country := location.Country; {
+		case first == "":
+			first = country
+		case country != first && second == "":
+			second = country
+		case country != first && country != second:
+			return false
+		}
+		if seen > 0 && location.Country != previous.Country &&
+			geo.CalculateDistance(previous, location) >= config.PingPongDistanceKm {
+			switches++
+		}
+		previous = location
+		seen++
+		return true
+	}
+
+	visited := current.Country == ""
+	for _, record := range history {
+		if !visited && record.Time.After(at) {
+			if !visit(current) {
+				return 0, "", ""
+			}
+			visited = true
+		}
+		gap := at.Sub(record.Time)
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap <= config.PingPongWindow && record.Location.Country != "" && !visit(record.Location) {
+			return 0, "", ""
+		}
+	}
+	if !visited && !visit(current) {
+		return 0, "", ""
+	}
+	if second == "" {
+		return 0, "", ""
+	}
+	return switches, first, second
+}
@@ -0,0 +1,130 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	newYork = detector.Location{Latitude: 40.7128, Longitude: -74.0060, Country: "US", City: "New York"}
+	moscow  = detector.Location{Latitude: 55.7558, Longitude: 37.6173, Country: "RU", City: "Moscow"}
+	boston  = detector.Location{Latitude: 42.3601, Longitude: -71.0589, Country: "US", City: "Boston"}
+)
+
+func TestGeoAnalyzer_History(t *testing.T) {
+	analyzer := detector.NewGeoAnalyzerWithHistory(2)
+	analyzer.UpdateLocation("ACC-1", newYork)
+	analyzer.UpdateLocation("ACC-1", moscow)
+	analyzer.UpdateLocation("ACC-1", boston)
+
+	history := analyzer.History("ACC-1")
+	require.Len(t, history, 2)
+	assert.Equal(t, "Moscow", history[0].Location.City)
+	assert.Equal(t, "Boston", history[1].Location.City)
+	assert.Equal(t, "Boston", analyzer.GetLastLocation("ACC-1").City)
+
+	assert.Empty(t, analyzer.History("ACC-999"))
+}
+
+func TestDetector_Analyze_GeoPingPong(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+
+	var score *detector.FraudScore
+	for i, location := range []detector.Location{newYork, moscow, newYork, moscow} {
+		var err error
+		score, err = d.Analyze(context.Background(), &detector.Transaction{
+			ID:        "TXN-PING",
+			AccountID: "ACC-PING",
+			Amount:    42.17,
+			Location:  location,
+			Timestamp: time.Now().Add(-24 * time.Hour),
+		})
+		require.NoError(t, err)
+		if i < 3 {
+			assert.NotContains(t, score.ReasonCodes, detector.ReasonGeoPingPong)
+		}
+	}
+	assert.Contains(t, score.ReasonCodes, detector.ReasonGeoPingPong)
+	assert.Len(t, d.LocationHistory("ACC-PING"), 4)
+}
+
+func TestDetector_Analyze_ImpossibleTravelAcrossHops(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	analyze := func(location detector.Location) *detector.FraudScore {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID:        "TXN-HOP",
+			AccountID: "ACC-HOP",
+			Amount:    42.17,
+			Location:  location,
+			Timestamp: time.Now().Add(-24 * time.Hour),
+		})
+		require.NoError(t, err)
+		return score
+	}
+
+	analyze(moscow)
+	analyze(boston)
+	// Boston to New York is a short hop, but Moscow was moments ago
+	score := analyze(newYork)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonImpossibleTravel)
+}
+
+func TestGeoAnalyzer_RecordLocation_OutOfOrder(t *testing.T) {
+	at := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	analyzer := detector.NewGeoAnalyzerWithHistory(3)
+	analyzer.RecordLocation("ACC-1", newYork, at)
+	analyzer.RecordLocation("ACC-1", boston, at.Add(2*time.Hour))
+	analyzer.RecordLocation("ACC-1", moscow, at.Add(time.Hour))
+
+	history := analyzer.History("ACC-1")
+	require.Len(t, history, 3)
+	assert.Equal(t, []string{"New York", "Moscow", "Boston"},
+		[]string{history[0].Location.City, history[1].Location.City, history[2].Location.City})
+
+	// Past the history size the oldest is dropped, even a late arrival
+	analyzer.RecordLocation("ACC-1", newYork, at.Add(-time.Hour))
+	assert.Equal(t, at, analyzer.History("ACC-1")[0].Time)
+	analyzer.RecordLocation("ACC-1", newYork, at.Add(3*time.Hour))
+	assert.Equal(t, at.Add(time.Hour), analyzer.History("ACC-1")[0].Time)
+}
+
+func TestDetector_Analyze_ImpossibleTravelTransactionTime(t *testing.T) {
+	at := time.Now().Add(-48 * time.Hour)
+	analyze := func(d *detector.Detector, location detector.Location, timestamp time.Time) []string {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID:        "TXN-LATE",
+			AccountID: "ACC-LATE",
+			Amount:    42.17,
+			Location:  location,
+			Timestamp: timestamp,
+		})
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+	config := detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8}
+
+	// Backfilled a day late, Moscow is a day away from New York
+	d := detector.NewDetector(config)
+	analyze(d, newYork, at.Add(24*time.Hour))
+	assert.NotContains(t, analyze(d, moscow, at), detector.ReasonImpossibleTravel)
+
+	// Arriving late but stamped an hour before New York, it is not
+	d = detector.NewDetector(config)
+	analyze(d, newYork, at)
+	assert.Contains(t, analyze(d, moscow, at.Add(-time.Hour)), detector.ReasonImpossibleTravel)
+
+	// Simultaneous transactions 80 km apart are within a wide clock skew
+	trenton := detector.Location{Latitude: 40.2206, Longitude: -74.7597, Country: "US", City: "Trenton"}
+	d = detector.NewDetector(config)
+	analyze(d, newYork, at)
+	assert.Contains(t, analyze(d, trenton, at), detector.ReasonImpossibleTravel)
+	config.Geo.ClockSkew = 15 * time.Minute
+	d = detector.NewDetector(config)
+	analyze(d, newYork, at)
+	assert.NotContains(t, analyze(d, trenton, at), detector.ReasonImpossibleTravel)
+}
@@ -0,0 +1,178 @@
+package detector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// InstrumentConfig holds payment instrument settings. Velocity and geography
+// are tracked per instrument as well as per account, which catches a stolen
+// card spread over many mule accounts.
+type InstrumentConfig struct {
+	// MaxVelocity is the number of uses of an instrument allowed within
+	// VelocityWindow
+	MaxVelocity    int
+	VelocityWindow time.Duration
+	// MaxAccounts is the number of distinct accounts allowed to use an
+	// instrument within AccountWindow
+	MaxAccounts   int
+	AccountWindow time.Duration
+	VelocityScore float64
+	AccountsScore float64
+}
+
+// DefaultInstrumentConfig returns the default payment instrument settings
+func DefaultInstrumentConfig() InstrumentConfig {
+	return InstrumentConfig{
+		MaxVelocity:    5,
+		VelocityWindow: time.Hour,
+		MaxAccounts:    2,
+		AccountWindow:  24 * time.Hour,
+		VelocityScore:  0.3,
+		AccountsScore:  0.4,
+	}
+}
+
+func (c InstrumentConfig) withDefaults() InstrumentConfig {
+	defaults := DefaultInstrumentConfig()
+	if c.MaxVelocity <= 0 {
+		c.MaxVelocity = defaults.MaxVelocity
+	}
+	if c.VelocityWindow <= 0 {
+		c.VelocityWindow = defaults.VelocityWindow
+	}
+	if c.MaxAccounts <= 0 {
+		c.MaxAccounts = defaults.MaxAccounts
+	}
+	if c.AccountWindow <= 0 {
+		c.AccountWindow = defaults.AccountWindow
+	}
+	if c.VelocityScore <= 0 {
+		c.VelocityScore = defaults.VelocityScore
+	}
+	if c.AccountsScore <= 0 {
+		c.AccountsScore = defaults.AccountsScore
+	}
+	return c
+}
+
+// Payment instrument reason codes
+const (
+	ReasonInstrumentVelocity         = "INSTRUMENT_VELOCITY"
+	ReasonInstrumentMultiAccount     = "INSTRUMENT_MULTI_ACCOUNT"
+	ReasonInstrumentImpossibleTravel = "INSTRUMENT_IMPOSSIBLE_TRAVEL"
+	ReasonInstrumentGeoPingPong      = "INSTRUMENT_GEO_PING_PONG"
+)
+
+// instrumentGeoCodes maps account geography codes to instrument ones
+var instrumentGeoCodes = map[string]string{
+	ReasonImpossibleTravel: ReasonInstrumentImpossibleTravel,
+	ReasonGeoPingPong:      ReasonInstrumentGeoPingPong,
+}
+
+// InstrumentResult is the outcome of the payment instrument checks
+type InstrumentResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// InstrumentTracker follows the use of payment instruments, identified by a
+// token or hash, across accounts
+type InstrumentTracker struct {
+	config   InstrumentConfig
+	velocity *VelocityTracker
+	geo      *GeoAnalyzer
+	// accounts holds when each account last used an instrument
+	accounts map[string]map[string]time.Time
+	mu       sync.Mutex
+}
+
+func NewInstrumentTracker(config InstrumentConfig, geoHistory int) *InstrumentTracker {
+	config = config.withDefaults()
+	return &InstrumentTracker{
+		config:   config,
+		velocity: NewVelocityTracker(config.VelocityWindow),
+		geo:      NewGeoAnalyzerWithHistory(geoHistory),
+		accounts: make(map[string]map[string]time.Time),
+	}
+}
+
+// Check records the use of the transaction's instrument and evaluates it.
+// Geography findings already reported for the account, given by their codes,
+// are not repeated for the instrument. Transactions without an instrument
+// are ignored.
+func (t *InstrumentTracker) Check(geoConfig GeoConfig, tx *Transaction, accountCodes []string) InstrumentResult {
+	result := InstrumentResult{}
+	if tx.InstrumentID == "" {
+		return result
+	}
+
+	t.velocity.TrackKey(tx.InstrumentID, tx.Timestamp)
+	if count := t.velocity.GetCount(tx.InstrumentID); count > t.config.MaxVelocity {
+		result.Score += t.config.VelocityScore
+		result.Codes = append(result.Codes, ReasonInstrumentVelocity)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Payment instrument used %d times in window", count))
+	}
+
+	if accounts := t.observeAccount(tx); accounts > t.config.MaxAccounts {
+		result.Score += t.config.AccountsScore
+		result.Codes = append(result.Codes, ReasonInstrumentMultiAccount)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Payment instrument used by %d accounts within %s", accounts, t.config.AccountWindow))
+	}
+
+	geo := checkLocations(geoConfig, t.geo, tx.InstrumentID, tx)
+	for i, code := range geo.Codes {
+		if containsCode(accountCodes, code) {
+			continue
+		}
+		result.Score += geoCodeScore(code)
+		result.Codes = append(result.Codes, instrumentGeoCodes[code])
+		result.Reasons = append(result.Reasons, "Payment instrument: "+geo.Reasons[i])
+	}
+	return result
+}
+
+// observeAccount records the account using the instrument and returns the
+// number of distinct accounts that used it within the account window
+func (t *InstrumentTracker) observeAccount(tx *Transaction) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	accounts, exists := t.accounts[tx.InstrumentID]
+	if !exists {
+		accounts = make(map[string]time.Time)
+		t.accounts[tx.InstrumentID] = accounts
+	}
+	if last, seen := accounts[tx.AccountID]; !seen || tx.Timestamp.After(last) {
+		accounts[tx.AccountID] = tx.Timestamp
+	}
+
+	cutoff := tx.Timestamp.Add(-t.config.AccountWindow)
+	for account, last := range accounts {
+		if last.Before(cutoff) {
+			delete(accounts, account)
+		}
+	}
+	return len(accounts)
+}
+
+// geoCodeScore is the score checkLocations adds for a geography code
+func geoCodeScore(code string) float64 {
+	if code == ReasonImpossibleTravel {
+		return impossibleTravelScore
+	}
+	return pingPongScore
+}
+
+func containsCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
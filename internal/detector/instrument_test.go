@@ -0,0 +1,93 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	saoPaulo = detector.Location{Latitude: -23.55, Longitude: -46.63, Country: "BR", City: "Sao Paulo"}
+	london   = detector.Location{Latitude: 51.51, Longitude: -0.13, Country: "GB", City: "London"}
+)
+
+func cardPayment(account, instrument string, loc detector.Location, at time.Time) *detector.Transaction {
+	return &detector.Transaction{
+		ID:           "TXN-" + account,
+		AccountID:    account,
+		Amount:       120,
+		MerchantID:   "MERCH-1",
+		Timestamp:    at,
+		Location:     loc,
+		InstrumentID: instrument,
+	}
+}
+
+func TestInstrumentTracker_FlagsCardSharedAcrossAccounts(t *testing.T) {
+	tracker := detector.NewInstrumentTracker(detector.DefaultInstrumentConfig(), 10)
+	geo := detector.DefaultGeoConfig()
+	now := time.Now()
+
+	for i := 1; i <= 2; i++ {
+		result := tracker.Check(geo, cardPayment(fmt.Sprintf("MULE-%d", i), "CARD-HASH-1", saoPaulo, now), nil)
+		assert.Empty(t, result.Codes)
+	}
+
+	result := tracker.Check(geo, cardPayment("MULE-3", "CARD-HASH-1", saoPaulo, now), nil)
+	assert.Equal(t, []string{detector.ReasonInstrumentMultiAccount}, result.Codes)
+	assert.Greater(t, result.Score, 0.0)
+
+	// Accounts age out of the window
+	later := now.Add(25 * time.Hour)
+	assert.NotContains(t, tracker.Check(geo, cardPayment("MULE-4", "CARD-HASH-1", saoPaulo, later), nil).Codes,
+		detector.ReasonInstrumentMultiAccount)
+
+	assert.Empty(t, tracker.Check(geo, cardPayment("MULE-5", "", saoPaulo, now), nil).Codes, "no instrument")
+}
+
+func TestInstrumentTracker_Velocity(t *testing.T) {
+	config := detector.DefaultInstrumentConfig()
+	config.MaxAccounts = 100
+	tracker := detector.NewInstrumentTracker(config, 10)
+	geo := detector.DefaultGeoConfig()
+	now := time.Now()
+
+	var result detector.InstrumentResult
+	for i := 0; i <= config.MaxVelocity; i++ {
+		result = tracker.Check(geo, cardPayment(fmt.Sprintf("ACC-%d", i), "CARD-HASH-2", saoPaulo, now), nil)
+	}
+	assert.Contains(t, result.Codes, detector.ReasonInstrumentVelocity)
+}
+
+func TestInstrumentTracker_ImpossibleTravelAcrossAccounts(t *testing.T) {
+	tracker := detector.NewInstrumentTracker(detector.DefaultInstrumentConfig(), 10)
+	geo := detector.DefaultGeoConfig()
+	now := time.Now()
+
+	tracker.Check(geo, cardPayment("ACC-A", "CARD-HASH-3", saoPaulo, now), nil)
+	result := tracker.Check(geo, cardPayment("ACC-B", "CARD-HASH-3", london, now), nil)
+	assert.Equal(t, []string{detector.ReasonInstrumentImpossibleTravel}, result.Codes)
+
+	// Not repeated when the account itself already traveled impossibly
+	tracker.Check(geo, cardPayment("ACC-C", "CARD-HASH-4", saoPaulo, now), nil)
+	result = tracker.Check(geo, cardPayment("ACC-C", "CARD-HASH-4", london, now), []string{detector.ReasonImpossibleTravel})
+	assert.Empty(t, result.Codes)
+}
+
+func TestDetector_InstrumentChecks(t *testing.T) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	now := time.Now()
+
+	var score *detector.FraudScore
+	for i := 1; i <= 3; i++ {
+		var err error
+		score, err = d.Analyze(context.Background(), cardPayment(fmt.Sprintf("MULE-%d", i), "CARD-HASH-5", saoPaulo, now))
+		require.NoError(t, err)
+	}
+	assert.Contains(t, score.ReasonCodes, detector.ReasonInstrumentMultiAccount)
+}
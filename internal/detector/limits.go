@@ -0,0 +1,271 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Amount limit periods
+const (
+	LimitDay  = "day"
+	LimitWeek = "week"
+)
+
+// ReasonAmountLimit is reported for transactions over a cumulative amount
+// limit of their account
+const ReasonAmountLimit = "AMOUNT_LIMIT_EXCEEDED"
+
+// AmountLimit caps the cumulative amount an account spends per day or week.
+// Every account has a token bucket per limit holding up to Amount and
+// refilled evenly over the period. A transaction takes its amount from the
+// bucket; one larger than what the bucket holds exceeds the limit, is
+// escalated to review and is not counted. A limit with a Product only covers
+// transactions of that type, such as a payment method.
+type AmountLimit struct {
+	Period  string  `json:"period" openapi:"required,enum=day|week"`
+	Product string  `json:"product,omitempty"`
+	Amount  float64 `json:"amount" openapi:"required,exclusiveMinimum=0"`
+}
+
+// Validate checks the period and amount of a limit
+func (l AmountLimit) Validate() error {
+	if l.Period != LimitDay && l.Period != LimitWeek {
+		return fmt.Errorf("period must be %s or %s, got %q", LimitDay, LimitWeek, l.Period)
+	}
+	if l.Amount <= 0 {
+		return fmt.Errorf("%s limit: amount must be positive", l.Period)
+	}
+	return nil
+}
+
+func (l AmountLimit) duration() time.Duration {
+	if l.Period == LimitWeek {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// covers reports whether the limit applies to a transaction type
+func (l AmountLimit) covers(txType string) bool {
+	return l.Product == "" || strings.EqualFold(l.Product, txType)
+}
+
+// key identifies the bucket of an account for the limit
+func (l AmountLimit) key(accountID string) string {
+	return accountID + "|" + l.Period + "|" + strings.ToLower(l.Product)
+}
+
+// LimitStatus is what an account has left of a limit after a transaction
+type LimitStatus struct {
+	Period    string  `json:"period"`
+	Product   string  `json:"product,omitempty"`
+	Limit     float64 `json:"limit"`
+	Remaining float64 `json:"remaining"`
+	Exceeded  bool    `json:"exceeded,omitempty"`
+}
+
+// RemainingLimit returns the least an account has left of its limits, or
+// false when no limit covered the transaction
+func RemainingLimit(statuses []LimitStatus) (float64, bool) {
+	if len(statuses) == 0 {
+		return 0, false
+	}
+	remaining := math.Inf(1)
+	for _, status := range statuses {
+		remaining = math.Min(remaining, status.Remaining)
+	}
+	return remaining, true
+}
+
+// AmountLimits holds the cumulative amount limits of every account
+type AmountLimits struct {
+	limits []AmountLimit
+	mu     sync.RWMutex
+}
+
+func NewAmountLimits() *AmountLimits {
+	return &AmountLimits{}
+}
+
+// Set validates and replaces the limits. Each period and product may be
+// limited once.
+func (a *AmountLimits) Set(limits []AmountLimit) error {
+	seen := make(map[string]bool)
+	for _, limit := range limits {
+		if err := limit.Validate(); err != nil {
+			return err
+		}
+		key := limit.key("")
+		if seen[key] {
+			return fmt.Errorf("%s limit of product %q is set twice", limit.Period, limit.Product)
+		}
+		seen[key] = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.limits = append([]AmountLimit(nil), limits...)
+	return nil
+}
+
+// Limits returns the limits
+func (a *AmountLimits) Limits() []AmountLimit {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]AmountLimit{}, a.limits...)
+}
+
+// current returns the limits without copying them; Set replaces rather than
+// modifies them
+func (a *AmountLimits) current() []AmountLimit {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.limits
+}
+
+// LoadAmountLimits reads amount limits as a JSON array:
+// [{"period": "day", "amount": 5000}, {"period": "week", "product": "crypto", "amount": 10000}]
+func LoadAmountLimits(r io.Reader) (*AmountLimits, error) {
+	var limits []AmountLimit
+	if err := json.NewDecoder(r).Decode(&limits); err != nil {
+		return nil, fmt.Errorf("invalid amount limits: %w", err)
+	}
+	amountLimits := NewAmountLimits()
+	if err := amountLimits.Set(limits); err != nil {
+		return nil, fmt.Errorf("invalid amount limits: %w", err)
+	}
+	return amountLimits, nil
+}
+
+// LoadAmountLimitsFile reads amount limits from disk
+func LoadAmountLimitsFile(path string) (*AmountLimits, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadAmountLimits(f)
+}
+
+// LimitBucket is the token bucket of an account for one limit, as of its
+// latest transaction
+type LimitBucket struct {
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// refill returns the bucket at a time. Transactions out of order refill
+// nothing.
+func (b LimitBucket) refill(limit AmountLimit, at time.Time) LimitBucket {
+	if elapsed := at.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens += limit.Amount * float64(elapsed) / float64(limit.duration())
+		b.UpdatedAt = at
+	}
+	b.Tokens = math.Min(b.Tokens, limit.Amount)
+	return b
+}
+
+// LimitTracker holds the token buckets of every account and limit
+type LimitTracker struct {
+	buckets map[string]LimitBucket
+	mu      sync.Mutex
+}
+
+func NewLimitTracker() *LimitTracker {
+	return &LimitTracker{buckets: make(map[string]LimitBucket)}
+}
+
+// Consume takes the amount of a transaction from the buckets of the limits
+// covering it, as of its timestamp, and returns what its account has left
+func (t *LimitTracker) Consume(limits []AmountLimit, tx *Transaction) []LimitStatus {
+	if tx.AccountID == "" || len(limits) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var statuses []LimitStatus
+	for _, limit := range limits {
+		if !limit.covers(tx.Type) {
+			continue
+		}
+		key := limit.key(tx.AccountID)
+		bucket, exists := t.buckets[key]
+		if !exists {
+			bucket = LimitBucket{Tokens: limit.Amount, UpdatedAt: tx.Timestamp}
+		}
+		bucket = bucket.refill(limit, tx.Timestamp)
+
+		status := LimitStatus{Period: limit.Period, Product: limit.Product, Limit: limit.Amount}
+		if tx.Amount > bucket.Tokens {
+			status.Exceeded = true
+		} else {
+			bucket.Tokens -= tx.Amount
+		}
+		status.Remaining = bucket.Tokens
+		t.buckets[key] = bucket
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Snapshot returns the buckets of every account and limit
+func (t *LimitTracker) Snapshot() map[string]LimitBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make(map[string]LimitBucket, len(t.buckets))
+	for key, bucket := range t.buckets {
+		snapshot[key] = bucket
+	}
+	return snapshot
+}
+
+// Restore replaces the buckets
+func (t *LimitTracker) Restore(snapshot map[string]LimitBucket) {
+	buckets := make(map[string]LimitBucket, len(snapshot))
+	for key, bucket := range snapshot {
+		buckets[key] = bucket
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buckets = buckets
+}
+
+// RestoreBuckets replaces the buckets of a snapshot, keeping the others
+func (t *LimitTracker) RestoreBuckets(snapshot map[string]LimitBucket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, bucket := range snapshot {
+		t.buckets[key] = bucket
+	}
+}
+
+// checkAmountLimits reports the first limit a transaction exceeded
+func checkAmountLimits(statuses []LimitStatus) (string, bool) {
+	for _, status := range statuses {
+		if !status.Exceeded {
+			continue
+		}
+		limit := status.Period
+		if status.Product != "" {
+			limit += " " + status.Product
+		}
+		return fmt.Sprintf("Amount exceeds the %s limit of %.2f: %.2f remaining", limit, status.Limit, status.Remaining), true
+	}
+	return "", false
+}
@@ -0,0 +1,128 @@
+package detector_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+func TestAmountLimits_Set(t *testing.T) {
+	limits := detector.NewAmountLimits()
+	assert.Error(t, limits.Set([]detector.AmountLimit{{Period: "month", Amount: 100}}))
+	assert.Error(t, limits.Set([]detector.AmountLimit{{Period: detector.LimitDay}}))
+	assert.Error(t, limits.Set([]detector.AmountLimit{
+		{Period: detector.LimitDay, Product: "crypto", Amount: 100},
+		{Period: detector.LimitDay, Product: "CRYPTO", Amount: 200},
+	}), "each period and product is limited once")
+
+	require.NoError(t, limits.Set([]detector.AmountLimit{
+		{Period: detector.LimitDay, Amount: 1000},
+		{Period: detector.LimitWeek, Amount: 3000},
+	}))
+	assert.Len(t, limits.Limits(), 2)
+
+	loaded, err := detector.LoadAmountLimits(strings.NewReader(`[{"period": "day", "product": "crypto", "amount": 500}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []detector.AmountLimit{{Period: detector.LimitDay, Product: "crypto", Amount: 500}}, loaded.Limits())
+}
+
+func TestLimitTracker_Consume(t *testing.T) {
+	tracker := detector.NewLimitTracker()
+	limits := []detector.AmountLimit{
+		{Period: detector.LimitDay, Amount: 1000},
+		{Period: detector.LimitWeek, Product: "crypto", Amount: 1500},
+	}
+	start := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	tx := func(amount float64, txType string, at time.Time) *detector.Transaction {
+		return &detector.Transaction{AccountID: "ACC-1", Amount: amount, Type: txType, Timestamp: at}
+	}
+
+	statuses := tracker.Consume(limits, tx(600, "card", start))
+	require.Len(t, statuses, 1, "the crypto limit does not cover card payments")
+	assert.Equal(t, 400.0, statuses[0].Remaining)
+	assert.False(t, statuses[0].Exceeded)
+
+	statuses = tracker.Consume(limits, tx(500, "crypto", start.Add(time.Minute)))
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Exceeded)
+	assert.InDelta(t, 400.69, statuses[0].Remaining, 0.01, "an exceeding transaction is not counted")
+	assert.False(t, statuses[1].Exceeded)
+	assert.Equal(t, 1000.0, statuses[1].Remaining)
+
+	// Half a day refills half the daily limit
+	statuses = tracker.Consume(limits, tx(0, "card", start.Add(12*time.Hour)))
+	assert.InDelta(t, 900, statuses[0].Remaining, 0.01)
+	statuses = tracker.Consume(limits, tx(0, "card", start.Add(72*time.Hour)))
+	assert.Equal(t, 1000.0, statuses[0].Remaining, "buckets fill up to the limit")
+
+	assert.Nil(t, tracker.Consume(limits, &detector.Transaction{Amount: 100, Timestamp: start}), "transactions without an account are not limited")
+
+	restored := detector.NewLimitTracker()
+	restored.Restore(tracker.Snapshot())
+	statuses = restored.Consume(limits, tx(0, "crypto", start.Add(time.Hour)))
+	assert.InDelta(t, 1000+1500*59.0/(168*60), statuses[1].Remaining, 0.01)
+}
+
+func TestDetector_AmountLimits(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	limits := detector.NewAmountLimits()
+	require.NoError(t, limits.Set([]detector.AmountLimit{{Period: detector.LimitDay, Amount: 1000}}))
+	d.SetAmountLimits(limits)
+
+	now := time.Now()
+	analyze := func(id string, amount float64) *detector.FraudScore {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID: id, AccountID: "ACC-LIMIT", Amount: amount, Currency: "USD", Timestamp: now,
+		})
+		require.NoError(t, err)
+		return score
+	}
+
+	first := analyze("TXN-1", 700)
+	require.Len(t, first.AmountLimits, 1)
+	assert.Equal(t, 300.0, first.AmountLimits[0].Remaining)
+	assert.NotContains(t, first.ReasonCodes, detector.ReasonAmountLimit)
+
+	second := analyze("TXN-2", 400)
+	assert.Contains(t, second.ReasonCodes, detector.ReasonAmountLimit)
+	assert.True(t, second.RequiresReview)
+	remaining, ok := detector.RemainingLimit(second.AmountLimits)
+	require.True(t, ok)
+	assert.InDelta(t, 300, remaining, 0.01)
+
+	var state detector.State
+	d.CheckpointState(func(copied detector.State) { state = copied })
+	assert.Len(t, state.Limits, 1)
+}
+
+func TestState_SplitByAccount(t *testing.T) {
+	state := detector.State{
+		Profiles: map[string]detector.AccountProfile{"ACC-1": {Count: 2}, "ACC|2": {Count: 1}},
+		Limits: map[string]detector.LimitBucket{
+			"ACC-1|day|":        {Tokens: 100},
+			"ACC|2|week|crypto": {Tokens: 50},
+		},
+		Reputation: []detector.ReputationScore{{}},
+	}
+	kept, rest := state.Split(func(accountID string) bool { return accountID == "ACC-1" })
+
+	assert.Equal(t, 2, kept.Profiles["ACC-1"].Count)
+	assert.Contains(t, kept.Limits, "ACC-1|day|")
+	assert.Len(t, kept.Reputation, 1, "reputations stay with the kept state")
+	require.Len(t, rest, 1)
+	assert.Contains(t, rest["ACC|2"].Limits, "ACC|2|week|crypto", "account IDs may contain the key separator")
+
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.RestoreState(kept)
+	d.RestoreAccounts(rest["ACC|2"])
+	var restored detector.State
+	d.CheckpointState(func(copied detector.State) { restored = copied })
+	assert.Len(t, restored.Profiles, 2)
+	assert.Len(t, restored.Limits, 2)
+}
@@ -0,0 +1,129 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TrustedCustomersList names the accounts a merchant trusts. Their
+// transactions are not sent to review for their score alone.
+const TrustedCustomersList = "trusted_customers"
+
+// Lists holds named sets of values, such as known bad IPs, that rule
+// expressions check with in_list. Values are matched case-insensitively.
+type Lists struct {
+	lists map[string]map[string]bool
+	mu    sync.RWMutex
+}
+
+func NewLists() *Lists {
+	return &Lists{
+		lists: make(map[string]map[string]bool),
+	}
+}
+
+// Set replaces the values of a list
+func (l *Lists) Set(name string, values []string) {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lists[name] = set
+}
+
+// Contains reports whether a list holds a value. Unknown lists hold nothing.
+func (l *Lists) Contains(name, value string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// Lowercasing allocates, and most lookups are of lists never set
+	list := l.lists[name]
+	if len(list) == 0 {
+		return false
+	}
+	return list[strings.ToLower(value)]
+}
+
+// Has reports whether a list exists, even empty
+func (l *Lists) Has(name string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, exists := l.lists[name]
+	return exists
+}
+
+// ReplaceAll replaces every list with those of another
+func (l *Lists) ReplaceAll(other *Lists) {
+	other.mu.RLock()
+	lists := make(map[string]map[string]bool, len(other.lists))
+	for name, set := range other.lists {
+		lists[name] = set
+	}
+	other.mu.RUnlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lists = lists
+}
+
+// Names returns the list names, sorted
+func (l *Lists) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := make([]string, 0, len(l.lists))
+	for name := range l.lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values returns every list's values, sorted
+func (l *Lists) Values() map[string][]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	values := make(map[string][]string, len(l.lists))
+	for name, set := range l.lists {
+		list := make([]string, 0, len(set))
+		for value := range set {
+			list = append(list, value)
+		}
+		sort.Strings(list)
+		values[name] = list
+	}
+	return values
+}
+
+// LoadLists reads a JSON object mapping list names to their values
+func LoadLists(r io.Reader) (*Lists, error) {
+	var raw map[string][]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid lists: %w", err)
+	}
+
+	lists := NewLists()
+	for name, values := range raw {
+		lists.Set(name, values)
+	}
+	return lists, nil
+}
+
+// LoadListsFile reads lists from disk
+func LoadListsFile(path string) (*Lists, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadLists(f)
+}
@@ -0,0 +1,154 @@
+package detector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Merchant risk tiers
+const (
+	MerchantRiskLow    = "low"
+	MerchantRiskMedium = "medium"
+	MerchantRiskHigh   = "high"
+)
+
+// MerchantProfile holds what is known about a merchant
+type MerchantProfile struct {
+	MerchantID string `json:"merchant_id"`
+	Country    string `json:"country"`
+	// MCC is the ISO 18245 merchant category code, e.g. 5411 for grocery
+	// stores
+	MCC      string `json:"mcc,omitempty"`
+	RiskTier string `json:"risk_tier,omitempty"`
+	// ExpectedTicket is the typical amount of a purchase at the merchant
+	ExpectedTicket float64 `json:"expected_ticket,omitempty"`
+}
+
+// Validate checks the merchant ID, MCC, risk tier and expected ticket
+func (p MerchantProfile) Validate() error {
+	if p.MerchantID == "" {
+		return errors.New("merchant_id is required")
+	}
+	if p.MCC != "" {
+		if len(p.MCC) != 4 || strings.Trim(p.MCC, "0123456789") != "" {
+			return fmt.Errorf("mcc must be 4 digits, got %q", p.MCC)
+		}
+	}
+	switch strings.ToLower(p.RiskTier) {
+	case "", MerchantRiskLow, MerchantRiskMedium, MerchantRiskHigh:
+	default:
+		return fmt.Errorf("risk_tier must be %s, %s or %s, got %q", MerchantRiskLow, MerchantRiskMedium, MerchantRiskHigh, p.RiskTier)
+	}
+	if p.ExpectedTicket < 0 {
+		return errors.New("expected_ticket must not be negative")
+	}
+	return nil
+}
+
+// MerchantRegistry is an in-memory directory of merchant profiles used to
+// enrich transactions
+type MerchantRegistry struct {
+	merchants map[string]MerchantProfile
+	mu        sync.RWMutex
+}
+
+func NewMerchantRegistry() *MerchantRegistry {
+	return &MerchantRegistry{
+		merchants: make(map[string]MerchantProfile),
+	}
+}
+
+// Set stores a merchant profile
+func (m *MerchantRegistry) Set(profile MerchantProfile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile.Country = strings.ToUpper(profile.Country)
+	profile.RiskTier = strings.ToLower(profile.RiskTier)
+	m.merchants[profile.MerchantID] = profile
+}
+
+// Delete removes a merchant profile, reporting whether it existed
+func (m *MerchantRegistry) Delete(merchantID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, exists := m.merchants[merchantID]
+	delete(m.merchants, merchantID)
+	return exists
+}
+
+// List returns every merchant profile, by merchant ID
+func (m *MerchantRegistry) List() []MerchantProfile {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	profiles := make([]MerchantProfile, 0, len(m.merchants))
+	for _, profile := range m.merchants {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].MerchantID < profiles[j].MerchantID })
+	return profiles
+}
+
+// Get returns a merchant profile
+func (m *MerchantRegistry) Get(merchantID string) (MerchantProfile, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	profile, exists := m.merchants[merchantID]
+	return profile, exists
+}
+
+// Size returns the number of merchants
+func (m *MerchantRegistry) Size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.merchants)
+}
+
+// Enrich fills transaction attributes derived from the merchant profile
+// without overriding values sent by the client
+func (m *MerchantRegistry) Enrich(tx *Transaction) {
+	profile, exists := m.Get(tx.MerchantID)
+	if !exists {
+		return
+	}
+	if tx.MerchantCountry == "" {
+		tx.MerchantCountry = profile.Country
+	}
+	if tx.MCC == "" {
+		tx.MCC = profile.MCC
+	}
+	tx.MerchantRiskTier = profile.RiskTier
+	tx.MerchantExpectedTicket = profile.ExpectedTicket
+}
+
+// LoadMerchantRegistry reads a JSON array of merchant profiles
+func LoadMerchantRegistry(r io.Reader) (*MerchantRegistry, error) {
+	var profiles []MerchantProfile
+	if err := json.NewDecoder(r).Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("invalid merchant profiles: %w", err)
+	}
+
+	registry := NewMerchantRegistry()
+	for i, profile := range profiles {
+		if err := profile.Validate(); err != nil {
+			return nil, fmt.Errorf("merchant profile %d: %w", i, err)
+		}
+		registry.Set(profile)
+	}
+	return registry, nil
+}
+
+// LoadMerchantRegistryFile reads merchant profiles from disk
+func LoadMerchantRegistryFile(path string) (*MerchantRegistry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadMerchantRegistry(f)
+}
@@ -0,0 +1,87 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantProfile_Validate(t *testing.T) {
+	assert.NoError(t, detector.MerchantProfile{MerchantID: "MERCH-1", MCC: "5411", RiskTier: "High", ExpectedTicket: 40}.Validate())
+	assert.NoError(t, detector.MerchantProfile{MerchantID: "MERCH-1"}.Validate())
+
+	assert.Error(t, detector.MerchantProfile{}.Validate())
+	assert.Error(t, detector.MerchantProfile{MerchantID: "MERCH-1", MCC: "541"}.Validate())
+	assert.Error(t, detector.MerchantProfile{MerchantID: "MERCH-1", MCC: "54a1"}.Validate())
+	assert.Error(t, detector.MerchantProfile{MerchantID: "MERCH-1", RiskTier: "extreme"}.Validate())
+	assert.Error(t, detector.MerchantProfile{MerchantID: "MERCH-1", ExpectedTicket: -1}.Validate())
+}
+
+func TestMerchantRegistry_Enrich(t *testing.T) {
+	registry := detector.NewMerchantRegistry()
+	registry.Set(detector.MerchantProfile{MerchantID: "MERCH-2", Country: "us", MCC: "5411", RiskTier: "HIGH", ExpectedTicket: 40})
+	registry.Set(detector.MerchantProfile{MerchantID: "MERCH-1", Country: "br"})
+
+	tx := &detector.Transaction{MerchantID: "MERCH-2"}
+	registry.Enrich(tx)
+	assert.Equal(t, "US", tx.MerchantCountry)
+	assert.Equal(t, "5411", tx.MCC)
+	assert.Equal(t, detector.MerchantRiskHigh, tx.MerchantRiskTier)
+	assert.Equal(t, 40.0, tx.MerchantExpectedTicket)
+
+	// A client-sent MCC wins
+	tx = &detector.Transaction{MerchantID: "MERCH-2", MCC: "5999"}
+	registry.Enrich(tx)
+	assert.Equal(t, "5999", tx.MCC)
+
+	profiles := registry.List()
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "MERCH-1", profiles[0].MerchantID)
+
+	assert.True(t, registry.Delete("MERCH-2"))
+	assert.False(t, registry.Delete("MERCH-2"))
+	tx = &detector.Transaction{MerchantID: "MERCH-2"}
+	registry.Enrich(tx)
+	assert.Empty(t, tx.MCC)
+}
+
+func TestDetector_ExpressionRules_MerchantProfile(t *testing.T) {
+	registry := detector.NewMerchantRegistry()
+	registry.Set(detector.MerchantProfile{MerchantID: "MERCH-GROCERY", MCC: "5411", RiskTier: detector.MerchantRiskLow, ExpectedTicket: 40})
+	registry.Set(detector.MerchantProfile{MerchantID: "MERCH-JEWELRY", MCC: "5944", RiskTier: detector.MerchantRiskHigh})
+
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	d.SetMerchantRegistry(registry)
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "ABOVE_TICKET",
+		Expression: "tx.amount > 5 * tx.merchant_expected_ticket",
+		Score:      0.1,
+	}))
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "HIGH_RISK_JEWELRY",
+		Expression: "tx.merchant_risk_tier == 'high' && tx.mcc == '5944'",
+		Score:      0.1,
+	}))
+
+	analyze := func(merchantID string, amount float64) []string {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID:         "TXN-MERCH",
+			AccountID:  "ACC-MERCH-" + merchantID,
+			MerchantID: merchantID,
+			Amount:     amount,
+			Timestamp:  time.Now(),
+		})
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+
+	assert.NotContains(t, analyze("MERCH-GROCERY", 150), "ABOVE_TICKET")
+	assert.Contains(t, analyze("MERCH-GROCERY", 250), "ABOVE_TICKET")
+	assert.NotContains(t, analyze("MERCH-JEWELRY", 250), "ABOVE_TICKET", "no expected ticket")
+	assert.Contains(t, analyze("MERCH-JEWELRY", 250), "HIGH_RISK_JEWELRY")
+	assert.NotContains(t, analyze("MERCH-UNKNOWN", 250), "ABOVE_TICKET")
+}
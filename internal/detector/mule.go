@@ -0,0 +1,216 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MuleConfig holds money mule settings. Within Window, an account passes
+// funds through when its outbound transfers reach PassThroughRatio of its
+// inbound ones, and fans out when they go to at least MinBeneficiaries
+// distinct beneficiaries.
+type MuleConfig struct {
+	Window           time.Duration
+	MinInbound       float64
+	PassThroughRatio float64
+	MinBeneficiaries int
+	// Threshold is the money-mule score from which transfers are flagged
+	Threshold float64
+	// Score is added to the transaction score of flagged transfers
+	Score float64
+}
+
+// DefaultMuleConfig returns the default money mule settings
+func DefaultMuleConfig() MuleConfig {
+	return MuleConfig{
+		Window:           24 * time.Hour,
+		MinInbound:       500,
+		PassThroughRatio: 0.8,
+		MinBeneficiaries: 3,
+		Threshold:        0.7,
+		Score:            0.4,
+	}
+}
+
+func (c MuleConfig) withDefaults() MuleConfig {
+	defaults := DefaultMuleConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.MinInbound <= 0 {
+		c.MinInbound = defaults.MinInbound
+	}
+	if c.PassThroughRatio <= 0 {
+		c.PassThroughRatio = defaults.PassThroughRatio
+	}
+	if c.MinBeneficiaries <= 0 {
+		c.MinBeneficiaries = defaults.MinBeneficiaries
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = defaults.Threshold
+	}
+	if c.Score <= 0 {
+		c.Score = defaults.Score
+	}
+	return c
+}
+
+// Money mule reason codes
+const (
+	ReasonMulePassThrough = "MULE_PASS_THROUGH"
+	ReasonMuleFanOut      = "MULE_FAN_OUT"
+)
+
+// IsTransfer reports whether a transaction sends funds to another account
+func IsTransfer(tx *Transaction) bool {
+	switch strings.ToUpper(tx.Type) {
+	case "TRANSFER", "TRANSFER_OUT", "WIRE", "P2P":
+		return true
+	}
+	return false
+}
+
+// IsInbound reports whether a transaction credits the account
+func IsInbound(tx *Transaction) bool {
+	switch strings.ToUpper(tx.Type) {
+	case "TRANSFER_IN", "DEPOSIT", "CREDIT":
+		return true
+	}
+	return false
+}
+
+// MuleResult is the outcome of the money mule check. MuleScore in [0, 1]
+// rates how much the account behaves like a pass-through.
+type MuleResult struct {
+	Score     float64
+	MuleScore float64
+	Reasons   []string
+	Codes     []string
+}
+
+// MuleTracker follows the inbound and outbound transfer flows of accounts.
+// A transfer is inbound for its destination as well as outbound for its
+// sender, so flows between accounts the engine scores are seen on both ends.
+type MuleTracker struct {
+	config MuleConfig
+	flows  map[string][]flow
+	mu     sync.Mutex
+}
+
+type flow struct {
+	at          time.Time
+	amount      float64
+	inbound     bool
+	beneficiary string
+}
+
+func NewMuleTracker(config MuleConfig) *MuleTracker {
+	return &MuleTracker{
+		config: config.withDefaults(),
+		flows:  make(map[string][]flow),
+	}
+}
+
+// Check records the transaction's flows and evaluates outbound transfers.
+// Other transactions are ignored.
+func (m *MuleTracker) Check(tx *Transaction) MuleResult {
+	result := MuleResult{}
+	inbound, outbound := IsInbound(tx), IsTransfer(tx)
+	if !inbound && !outbound {
+		return result
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if inbound {
+		m.record(tx.AccountID, flow{at: tx.Timestamp, amount: tx.Amount, inbound: true})
+		return result
+	}
+	m.record(tx.AccountID, flow{at: tx.Timestamp, amount: tx.Amount, beneficiary: tx.Destination})
+	if tx.Destination != "" {
+		m.record(tx.Destination, flow{at: tx.Timestamp, amount: tx.Amount, inbound: true})
+	}
+
+	stats := m.stats(tx.AccountID)
+	if stats.inbound < m.config.MinInbound {
+		return result
+	}
+
+	ratio := math.Min(1, stats.outbound/stats.inbound)
+	fanOut := math.Min(1, float64(stats.beneficiaries)/float64(m.config.MinBeneficiaries))
+	// Funds that leave soon after they arrive score higher
+	speed := 1 - math.Min(1, stats.dwell.Hours()/m.config.Window.Hours())
+	result.MuleScore = 0.5*ratio + 0.3*fanOut + 0.2*speed
+	if result.MuleScore < m.config.Threshold {
+		return result
+	}
+
+	result.Score = m.config.Score
+	if ratio >= m.config.PassThroughRatio {
+		result.Codes = append(result.Codes, ReasonMulePassThrough)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Account passed %.0f%% of %.2f received through within %s", 100*stats.outbound/stats.inbound, stats.inbound, stats.dwell.Round(time.Minute)))
+	}
+	if stats.beneficiaries >= m.config.MinBeneficiaries {
+		result.Codes = append(result.Codes, ReasonMuleFanOut)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Funds sent to %d beneficiaries within %s", stats.beneficiaries, m.config.Window))
+	}
+	if len(result.Codes) == 0 {
+		result.Score = 0
+	}
+	return result
+}
+
+// record appends a flow and drops flows older than the window. Callers must
+// hold the lock.
+func (m *MuleTracker) record(account string, f flow) {
+	cutoff := f.at.Add(-m.config.Window)
+	kept := m.flows[account][:0]
+	for _, existing := range m.flows[account] {
+		if !existing.at.Before(cutoff) {
+			kept = append(kept, existing)
+		}
+	}
+	m.flows[account] = append(kept, f)
+}
+
+type flowStats struct {
+	inbound, outbound float64
+	beneficiaries     int
+	// dwell is the time from the first inbound flow to the last outbound one
+	dwell time.Duration
+}
+
+// stats summarizes the flows of an account within the window. Callers must
+// hold the lock.
+func (m *MuleTracker) stats(account string) flowStats {
+	var stats flowStats
+	var firstIn, lastOut time.Time
+	beneficiaries := map[string]bool{}
+	for _, f := range m.flows[account] {
+		if f.inbound {
+			stats.inbound += f.amount
+			if firstIn.IsZero() || f.at.Before(firstIn) {
+				firstIn = f.at
+			}
+			continue
+		}
+		stats.outbound += f.amount
+		if f.at.After(lastOut) {
+			lastOut = f.at
+		}
+		if f.beneficiary != "" {
+			beneficiaries[f.beneficiary] = true
+		}
+	}
+	stats.beneficiaries = len(beneficiaries)
+	if !firstIn.IsZero() && lastOut.After(firstIn) {
+		stats.dwell = lastOut.Sub(firstIn)
+	}
+	return stats
+}
@@ -0,0 +1,77 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transfer(account, kind, destination string, amount float64, at time.Time) *detector.Transaction {
+	return &detector.Transaction{
+		ID:          "TXN-" + account,
+		AccountID:   account,
+		Amount:      amount,
+		Type:        kind,
+		Destination: destination,
+		Timestamp:   at,
+	}
+}
+
+func TestMuleTracker_FlagsPassThroughToManyBeneficiaries(t *testing.T) {
+	tracker := detector.NewMuleTracker(detector.DefaultMuleConfig())
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, tracker.Check(transfer("MULE", "transfer_in", "", 3000, start)).Codes)
+
+	var result detector.MuleResult
+	for i := 1; i <= 3; i++ {
+		result = tracker.Check(transfer("MULE", "transfer", fmt.Sprintf("BENEFICIARY-%d", i), 950, start.Add(time.Duration(i)*10*time.Minute)))
+	}
+	assert.ElementsMatch(t, []string{detector.ReasonMulePassThrough, detector.ReasonMuleFanOut}, result.Codes)
+	assert.Greater(t, result.MuleScore, 0.9)
+	assert.Greater(t, result.Score, 0.0)
+}
+
+func TestMuleTracker_IgnoresOrdinarySpending(t *testing.T) {
+	tracker := detector.NewMuleTracker(detector.DefaultMuleConfig())
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	tracker.Check(transfer("SALARY", "deposit", "", 4000, start))
+	result := tracker.Check(transfer("SALARY", "transfer", "LANDLORD", 1200, start.Add(20*time.Hour)))
+	assert.Empty(t, result.Codes)
+	assert.Less(t, result.MuleScore, detector.DefaultMuleConfig().Threshold)
+
+	// Card payments are not flows
+	assert.Zero(t, tracker.Check(transfer("SALARY", "card", "", 2500, start)).MuleScore)
+
+	// Funds that arrived before the window do not count
+	later := start.Add(48 * time.Hour)
+	for i := 1; i <= 3; i++ {
+		result = tracker.Check(transfer("SALARY", "transfer", fmt.Sprintf("B-%d", i), 900, later))
+	}
+	assert.Empty(t, result.Codes)
+}
+
+func TestDetector_MuleFromInternalTransfers(t *testing.T) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	now := time.Now()
+
+	// The victim's transfer is the mule's inbound flow
+	_, err := d.Analyze(context.Background(), transfer("VICTIM", "transfer", "MULE", 2000, now))
+	require.NoError(t, err)
+
+	var score *detector.FraudScore
+	for i := 1; i <= 3; i++ {
+		score, err = d.Analyze(context.Background(), transfer("MULE", "p2p", fmt.Sprintf("CASHOUT-%d", i), 640, now.Add(time.Duration(i)*time.Minute)))
+		require.NoError(t, err)
+	}
+	assert.Contains(t, score.ReasonCodes, detector.ReasonMulePassThrough)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonMuleFanOut)
+	assert.True(t, score.RequiresReview)
+	assert.Greater(t, score.MuleScore, 0.0)
+}
@@ -0,0 +1,31 @@
+package detector
+
+// Overrides are settings that replace the detector's for the transactions of
+// a merchant: rules switched off and lists replacing those of the same name
+type Overrides struct {
+	DisabledRules map[string]bool
+	Lists         *Lists
+}
+
+// OverrideResolver returns the overrides in effect for a merchant, or nil
+// when there are none
+type OverrideResolver interface {
+	Overrides(merchantID string) *Overrides
+}
+
+// overridesVar passes the transaction's overrides to expression functions.
+// Expressions cannot name it.
+const overridesVar = "$overrides"
+
+func (o *Overrides) ruleDisabled(ruleID string) bool {
+	return o != nil && o.DisabledRules[ruleID]
+}
+
+// contains checks the overriding list of that name, if any, and otherwise
+// the detector's
+func (o *Overrides) contains(lists *Lists, name, value string) bool {
+	if o != nil && o.Lists != nil && o.Lists.Has(name) {
+		return o.Lists.Contains(name, value)
+	}
+	return lists.Contains(name, value)
+}
@@ -0,0 +1,23 @@
+package detector
+
+import (
+	"log"
+	"time"
+)
+
+// recordPanic counts a panic of a rule condition, quarantining the rule once
+// it reaches the panic limit
+func (g *ruleGuard) recordPanic(ruleID, message string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	health := g.get(ruleID)
+	now := time.Now()
+	health.Panics++
+	health.LastError = message
+	health.LastPanic = &now
+	log.Printf("Rule %s panicked (%d/%d): %s", ruleID, health.Panics, g.config.PanicLimit, message)
+	if health.Panics >= g.config.PanicLimit {
+		g.quarantine(health, QuarantinePanics, now)
+	}
+}
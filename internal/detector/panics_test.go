@@ -0,0 +1,46 @@
+package detector_test
+
+import (
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector_RulePanicIsolation(t *testing.T) {
+	d, alerts := newQuarantineDetector(detector.QuarantineConfig{PanicLimit: 2})
+	evaluations := 0
+	d.AddRule(detector.Rule{
+		ID:          "BROKEN",
+		Description: "Broken rule",
+		Score:       0.5,
+		Condition: func(tx *detector.Transaction) bool {
+			evaluations++
+			var profile *detector.Transaction
+			return profile.Amount > tx.Amount
+		},
+	})
+
+	assert.Contains(t, analyzeCodes(t, d), "ALWAYS", "the other rules still run")
+	assert.NotContains(t, analyzeCodes(t, d), "BROKEN")
+	analyzeCodes(t, d)
+	assert.Equal(t, 2, evaluations, "the rule is quarantined once it reaches the limit")
+	assert.Equal(t, map[string]string{"BROKEN": detector.QuarantinePanics}, alerts.reasons)
+
+	health := d.RuleHealth()
+	require.Len(t, health, 1)
+	assert.Equal(t, "BROKEN", health[0].RuleID)
+	assert.Equal(t, 2, health[0].Panics)
+	assert.True(t, health[0].Quarantined)
+	assert.Contains(t, health[0].LastError, "nil pointer")
+
+	released, exists := d.ReleaseRule("BROKEN")
+	assert.True(t, exists)
+	assert.Equal(t, 2, released.Panics)
+	analyzeCodes(t, d)
+	assert.Equal(t, 3, evaluations, "releasing the rule evaluates it again")
+
+	_, exists = d.ReleaseRule("ALWAYS")
+	assert.False(t, exists)
+}
@@ -0,0 +1,202 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// PreScoreConfig holds the settings of the pre-authorization score. Amounts
+// above ProfileMultiple times the account average score ProfileScore once the
+// account has ProfileMinTransactions transactions, or above the account's
+// adaptive threshold once it has one (see SpendingConfig).
+type PreScoreConfig struct {
+	ProfileMultiple        float64
+	ProfileMinTransactions int
+	ProfileScore           float64
+}
+
+// DefaultPreScoreConfig returns the default pre-authorization settings
+func DefaultPreScoreConfig() PreScoreConfig {
+	return PreScoreConfig{
+		ProfileMultiple:        5,
+		ProfileMinTransactions: 3,
+		ProfileScore:           0.3,
+	}
+}
+
+func (c PreScoreConfig) withDefaults() PreScoreConfig {
+	defaults := DefaultPreScoreConfig()
+	if c.ProfileMultiple <= 0 {
+		c.ProfileMultiple = defaults.ProfileMultiple
+	}
+	if c.ProfileMinTransactions <= 0 {
+		c.ProfileMinTransactions = defaults.ProfileMinTransactions
+	}
+	if c.ProfileScore <= 0 {
+		c.ProfileScore = defaults.ProfileScore
+	}
+	return c
+}
+
+// ReasonAmountAboveProfile flags pre-scored amounts far above the account
+// average
+const ReasonAmountAboveProfile = "AMOUNT_ABOVE_PROFILE"
+
+// PreScore quickly scores a transaction before authorization from the rules,
+// lists and stateless checks, and the account state held so far. It reads but
+// never updates per-account state, so the full analysis must still run.
+func (d *Detector) PreScore(tx *Transaction) (*FraudScore, error) {
+	if tx == nil {
+		return nil, fmt.Errorf("transaction is nil")
+	}
+	d.loadAccount(tx.AccountID)
+	d.observeTime(tx)
+
+	d.enrich(tx)
+	tx.overrides = d.resolveOverrides(tx.MerchantID)
+	tx.CorridorRisk = d.corridors.Risk(tx)
+	tx.Reputation = d.reputation(tx)
+	tx.AmountThreshold = d.amountThreshold(tx.AccountID)
+	tx.Calendar = d.getCalendar().Effect(tx)
+	tx.Sequence = d.sequences.Features(tx)
+
+	score := d.quickScore(tx)
+	d.finishQuickScore(score)
+	score.Splits = d.assessSplits(tx)
+	return score, nil
+}
+
+// Revalidate re-checks a transaction decided earlier before it is captured:
+// the pre-authorization checks against the current rules, lists and cached
+// profile, plus the account velocity now. Like PreScore it never updates
+// per-account state. The sequence features recorded at decision time are
+// kept, since the transaction is already part of the sequence history.
+func (d *Detector) Revalidate(tx *Transaction) (*FraudScore, error) {
+	if tx == nil {
+		return nil, fmt.Errorf("transaction is nil")
+	}
+	d.loadAccount(tx.AccountID)
+	d.observeTime(tx)
+
+	d.enrich(tx)
+	tx.overrides = d.resolveOverrides(tx.MerchantID)
+	tx.CorridorRisk = d.corridors.Risk(tx)
+	tx.Reputation = d.reputation(tx)
+	tx.AmountThreshold = d.amountThreshold(tx.AccountID)
+	tx.Calendar = d.getCalendar().Effect(tx)
+
+	score := d.quickScore(tx)
+	velocityScore, velocityReason := d.checkVelocity(context.Background(), tx)
+	if velocityScore > 0 {
+		score.add(ComponentVelocity, velocityScore)
+		score.Reasons = append(score.Reasons, velocityReason)
+		score.ReasonCodes = append(score.ReasonCodes, "HIGH_VELOCITY")
+	}
+	d.finishQuickScore(score)
+	score.Splits = d.assessSplits(tx)
+	return score, nil
+}
+
+// quickScore runs the checks shared by PreScore and Revalidate
+func (d *Detector) quickScore(tx *Transaction) *FraudScore {
+	score := &FraudScore{
+		Score:     0.0,
+		Reasons:   []string{},
+		Timestamp: d.clock.Now(),
+	}
+
+	// Rule observers only see full analyses
+	d.mu.RLock()
+	evaluateRules(d.rules, tx, nil, d.ruleGuard, score)
+	d.mu.RUnlock()
+
+	// The cached profile stands in for the velocity and ML checks. Accounts
+	// with enough history are held to their adaptive threshold instead of a
+	// multiple of their average.
+	config := d.config.PreScore
+	factor := tx.Calendar.amountFactor()
+	if tx.AmountThreshold > 0 {
+		if threshold := tx.AmountThreshold * factor; tx.Amount > threshold {
+			score.add(ComponentProfile, config.ProfileScore)
+			score.Reasons = append(score.Reasons, fmt.Sprintf("Amount above the account threshold of %.2f", threshold))
+			score.ReasonCodes = append(score.ReasonCodes, ReasonAmountAboveProfile)
+		}
+	} else if profile, exists := d.profiles.Get(tx.AccountID); exists && profile.Count >= config.ProfileMinTransactions {
+		if avg := profile.AvgAmount(); avg > 0 && tx.Amount > factor*config.ProfileMultiple*avg {
+			score.add(ComponentProfile, config.ProfileScore)
+			score.Reasons = append(score.Reasons, fmt.Sprintf("Amount %.0fx the account average", tx.Amount/avg))
+			score.ReasonCodes = append(score.ReasonCodes, ReasonAmountAboveProfile)
+		}
+	}
+
+	if sequenceScore, sequenceReason := checkSequence(d.config.Sequence, tx.Sequence); sequenceScore > 0 {
+		score.add(ComponentSequence, sequenceScore)
+		score.Reasons = append(score.Reasons, sequenceReason)
+		score.ReasonCodes = append(score.ReasonCodes, ReasonSequenceBurst)
+	}
+
+	patternScore, patternReasons, patternCodes := d.matchPatterns(tx)
+	score.add(ComponentPatterns, patternScore)
+	score.Reasons = append(score.Reasons, patternReasons...)
+	score.ReasonCodes = append(score.ReasonCodes, patternCodes...)
+
+	crossBorder := checkCrossBorder(d.config.CrossBorder, tx)
+	if crossBorder.Score > 0 {
+		score.add(ComponentCrossBorder, crossBorder.Score)
+		score.Reasons = append(score.Reasons, crossBorder.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, crossBorder.Codes...)
+	}
+
+	network := checkASN(d.config.ASN, tx)
+	if network.Score > 0 {
+		score.add(ComponentNetwork, network.Score)
+		score.Reasons = append(score.Reasons, network.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, network.Codes...)
+	}
+
+	corridor := d.corridors.Check(tx)
+	if corridor.Score > 0 {
+		score.add(ComponentCorridor, corridor.Score)
+		score.Reasons = append(score.Reasons, corridor.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, corridor.Codes...)
+	}
+
+	reputation := d.reputations.Check(tx)
+	if reputation.Score > 0 {
+		score.add(ComponentReputation, reputation.Score)
+		score.Reasons = append(score.Reasons, reputation.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, reputation.Codes...)
+	}
+
+	address := checkAddresses(d.config.Address, tx)
+	if address.Score > 0 {
+		score.add(ComponentAddress, address.Score)
+		score.Reasons = append(score.Reasons, address.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, address.Codes...)
+	}
+
+	basket := checkBasket(d.config.Basket, tx)
+	if basket.Score > 0 {
+		score.add(ComponentBasket, basket.Score)
+		score.Reasons = append(score.Reasons, basket.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, basket.Codes...)
+	}
+
+	crypto := checkCrypto(d.getAddressRiskList(), tx)
+	if crypto.Score > 0 {
+		score.add(ComponentCrypto, crypto.Score)
+		score.Reasons = append(score.Reasons, crypto.Reasons...)
+		score.ReasonCodes = append(score.ReasonCodes, crypto.Codes...)
+		score.RequiresReview = true
+		score.Blocked = score.Blocked || crypto.Block
+	}
+	return score
+}
+
+// finishQuickScore normalizes a quick score and sets its risk level
+func (d *Detector) finishQuickScore(score *FraudScore) {
+	score.Score = math.Min(1.0, math.Max(0.0, score.Score))
+	score.Risk = d.determineRiskLevel(score.Score)
+	score.ShouldBlock = score.Score >= d.config.BlockThreshold || score.Blocked
+}
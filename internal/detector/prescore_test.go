@@ -0,0 +1,89 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector_PreScore(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "THREE_SEEN",
+		Expression: "profile(tx.account_id).tx_count == 3",
+		Score:      0.1,
+	}))
+
+	now := time.Now()
+	tx := func(amount float64) *detector.Transaction {
+		return &detector.Transaction{ID: "TXN-PRE", AccountID: "ACC-PRE", Amount: amount, Timestamp: now, Location: newYork}
+	}
+
+	score, err := d.PreScore(tx(1000))
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonAmountAboveProfile, "no profile yet")
+
+	for i := 0; i < 3; i++ {
+		_, err := d.Analyze(context.Background(), tx(100))
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 5; i++ {
+		score, err = d.PreScore(tx(1000))
+		require.NoError(t, err)
+		assert.Contains(t, score.ReasonCodes, detector.ReasonAmountAboveProfile)
+		assert.Contains(t, score.ReasonCodes, "THREE_SEEN", "pre-scoring must not update the profile")
+	}
+
+	score, err = d.PreScore(tx(400))
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonAmountAboveProfile)
+
+	_, err = d.PreScore(nil)
+	assert.Error(t, err)
+}
+
+func TestDetector_Revalidate(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 2, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "BAD_DEVICE",
+		Expression: "in_list('bad_devices', tx.device_id)",
+		Score:      0.2,
+	}))
+
+	now := time.Now()
+	decided := &detector.Transaction{ID: "TXN-1", AccountID: "ACC-REV", Amount: 50, Timestamp: now, DeviceID: "DEV-1", Location: newYork}
+	_, err := d.Analyze(context.Background(), decided)
+	require.NoError(t, err)
+
+	score, err := d.Revalidate(decided)
+	require.NoError(t, err)
+	assert.Empty(t, score.ReasonCodes)
+
+	// The account bursts and the device is blocked after the decision
+	for i := 2; i <= 3; i++ {
+		_, err := d.Analyze(context.Background(), &detector.Transaction{ID: fmt.Sprintf("TXN-%d", i), AccountID: "ACC-REV", Amount: 50, Timestamp: now, Location: newYork})
+		require.NoError(t, err)
+	}
+	lists := detector.NewLists()
+	lists.Set("bad_devices", []string{"DEV-1"})
+	d.SetLists(lists)
+
+	for i := 0; i < 3; i++ {
+		score, err = d.Revalidate(decided)
+		require.NoError(t, err)
+		assert.Contains(t, score.ReasonCodes, "HIGH_VELOCITY")
+		assert.Contains(t, score.ReasonCodes, "BAD_DEVICE")
+	}
+	d.CheckpointState(func(state detector.State) {
+		assert.Len(t, state.Velocity["ACC-REV"], 3, "revalidation must not update velocity")
+	})
+
+	_, err = d.Revalidate(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package detector
+
+import (
+	"sync"
+	"time"
+)
+
+// AccountProfile summarizes the transaction history of an account
+type AccountProfile struct {
+	AccountID   string    `json:"account_id"`
+	Count       int       `json:"tx_count"`
+	TotalAmount float64   `json:"total_amount"`
+	MaxAmount   float64   `json:"max_amount"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	// RecentAmounts are the amounts of the last transactions, oldest first
+	RecentAmounts []float64 `json:"recent_amounts,omitempty"`
+}
+
+// AvgAmount returns the mean transaction amount, or 0 for unknown accounts
+func (p AccountProfile) AvgAmount() float64 {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.TotalAmount / float64(p.Count)
+}
+
+// ProfileTracker keeps a running profile per account
+type ProfileTracker struct {
+	profiles   map[string]*AccountProfile
+	maxHistory int
+	mu         sync.RWMutex
+}
+
+func NewProfileTracker() *ProfileTracker {
+	return NewProfileTrackerWithHistory(DefaultSpendingConfig().HistorySize)
+}
+
+// NewProfileTrackerWithHistory keeps the last size amounts of each account
+func NewProfileTrackerWithHistory(size int) *ProfileTracker {
+	if size < 1 {
+		size = 1
+	}
+	return &ProfileTracker{
+		profiles:   make(map[string]*AccountProfile),
+		maxHistory: size,
+	}
+}
+
+// Update adds a transaction to its account profile
+func (p *ProfileTracker) Update(tx *Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profile, exists := p.profiles[tx.AccountID]
+	if !exists {
+		profile = &AccountProfile{AccountID: tx.AccountID, FirstSeen: tx.Timestamp}
+		p.profiles[tx.AccountID] = profile
+	}
+	profile.Count++
+	profile.TotalAmount += tx.Amount
+	if tx.Amount > profile.MaxAmount {
+		profile.MaxAmount = tx.Amount
+	}
+	if tx.Timestamp.After(profile.LastSeen) {
+		profile.LastSeen = tx.Timestamp
+	}
+	profile.RecentAmounts = append(profile.RecentAmounts, tx.Amount)
+	if excess := len(profile.RecentAmounts) - p.maxHistory; excess > 0 {
+		profile.RecentAmounts = append([]float64(nil), profile.RecentAmounts[excess:]...)
+	}
+}
+
+// Merge adds transactions seen elsewhere, such as in another region, to an
+// account profile. They do not enter its recent amounts.
+func (p *ProfileTracker) Merge(accountID string, slot ProfileSlot) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profile, exists := p.profiles[accountID]
+	if !exists {
+		profile = &AccountProfile{AccountID: accountID, FirstSeen: slot.FirstSeen}
+		p.profiles[accountID] = profile
+	}
+	profile.Count += slot.Count
+	profile.TotalAmount += slot.TotalAmount
+	if slot.MaxAmount > profile.MaxAmount {
+		profile.MaxAmount = slot.MaxAmount
+	}
+	if !slot.FirstSeen.IsZero() && slot.FirstSeen.Before(profile.FirstSeen) {
+		profile.FirstSeen = slot.FirstSeen
+	}
+	if slot.LastSeen.After(profile.LastSeen) {
+		profile.LastSeen = slot.LastSeen
+	}
+}
+
+// Get returns the profile of an account
+func (p *ProfileTracker) Get(accountID string) (AccountProfile, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	profile, exists := p.profiles[accountID]
+	if !exists {
+		return AccountProfile{AccountID: accountID}, false
+	}
+	copied := *profile
+	copied.RecentAmounts = append([]float64(nil), profile.RecentAmounts...)
+	return copied, true
+}
+
+// AmountThreshold returns the adaptive high amount threshold of an account
+// without copying its profile
+func (p *ProfileTracker) AmountThreshold(accountID string, config SpendingConfig) (float64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	profile, exists := p.profiles[accountID]
+	if !exists {
+		return 0, false
+	}
+	return profile.AmountThreshold(config)
+}
+
+// Snapshot returns every account profile
+func (p *ProfileTracker) Snapshot() map[string]AccountProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := make(map[string]AccountProfile, len(p.profiles))
+	for accountID, profile := range p.profiles {
+		copied := *profile
+		copied.RecentAmounts = append([]float64(nil), profile.RecentAmounts...)
+		snapshot[accountID] = copied
+	}
+	return snapshot
+}
+
+// Restore replaces every account profile
+func (p *ProfileTracker) Restore(snapshot map[string]AccountProfile) {
+	profiles := make(map[string]*AccountProfile, len(snapshot))
+	for accountID, profile := range snapshot {
+		profile := profile
+		profiles[accountID] = &profile
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profiles = profiles
+}
+
+// RestoreAccounts replaces the profiles of the accounts of a snapshot,
+// keeping the others
+func (p *ProfileTracker) RestoreAccounts(snapshot map[string]AccountProfile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for accountID, profile := range snapshot {
+		profile := profile
+		p.profiles[accountID] = &profile
+	}
+}
@@ -0,0 +1,338 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// PromoConfig holds promotion abuse settings. Transactions with a campaign
+// ID redeem its bonus. Redemptions by more than MaxAccountsPerDevice new
+// accounts from one device, or MaxAccountsPerIP from one IP address, within
+// Window are abuse, as are accounts redeeming more than MaxRedemptions times.
+// Accounts count as new until NewAccountAge, or always when their creation
+// time is unknown.
+type PromoConfig struct {
+	Window               time.Duration
+	NewAccountAge        time.Duration
+	MaxAccountsPerDevice int
+	MaxAccountsPerIP     int
+	MaxRedemptions       int
+	DeviceScore          float64
+	IPScore              float64
+	RepeatScore          float64
+	// HistorySize is the number of promotion decisions kept for the
+	// decision stream
+	HistorySize int
+}
+
+// DefaultPromoConfig returns the default promotion abuse settings
+func DefaultPromoConfig() PromoConfig {
+	return PromoConfig{
+		Window:               30 * 24 * time.Hour,
+		NewAccountAge:        7 * 24 * time.Hour,
+		MaxAccountsPerDevice: 1,
+		MaxAccountsPerIP:     3,
+		MaxRedemptions:       1,
+		DeviceScore:          0.3,
+		IPScore:              0.2,
+		RepeatScore:          0.2,
+		HistorySize:          10000,
+	}
+}
+
+func (c PromoConfig) withDefaults() PromoConfig {
+	defaults := DefaultPromoConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.NewAccountAge <= 0 {
+		c.NewAccountAge = defaults.NewAccountAge
+	}
+	if c.MaxAccountsPerDevice <= 0 {
+		c.MaxAccountsPerDevice = defaults.MaxAccountsPerDevice
+	}
+	if c.MaxAccountsPerIP <= 0 {
+		c.MaxAccountsPerIP = defaults.MaxAccountsPerIP
+	}
+	if c.MaxRedemptions <= 0 {
+		c.MaxRedemptions = defaults.MaxRedemptions
+	}
+	if c.DeviceScore <= 0 {
+		c.DeviceScore = defaults.DeviceScore
+	}
+	if c.IPScore <= 0 {
+		c.IPScore = defaults.IPScore
+	}
+	if c.RepeatScore <= 0 {
+		c.RepeatScore = defaults.RepeatScore
+	}
+	if c.HistorySize <= 0 {
+		c.HistorySize = defaults.HistorySize
+	}
+	return c
+}
+
+// Campaign overrides the promotion abuse limits of one campaign. Unset
+// limits keep the defaults.
+type Campaign struct {
+	MaxAccountsPerDevice int `json:"max_accounts_per_device,omitempty"`
+	MaxAccountsPerIP     int `json:"max_accounts_per_ip,omitempty"`
+	MaxRedemptions       int `json:"max_redemptions,omitempty"`
+	WindowDays           int `json:"window_days,omitempty"`
+	NewAccountDays       int `json:"new_account_days,omitempty"`
+}
+
+// apply returns the settings of a campaign
+func (c Campaign) apply(config PromoConfig) PromoConfig {
+	if c.MaxAccountsPerDevice > 0 {
+		config.MaxAccountsPerDevice = c.MaxAccountsPerDevice
+	}
+	if c.MaxAccountsPerIP > 0 {
+		config.MaxAccountsPerIP = c.MaxAccountsPerIP
+	}
+	if c.MaxRedemptions > 0 {
+		config.MaxRedemptions = c.MaxRedemptions
+	}
+	if c.WindowDays > 0 {
+		config.Window = time.Duration(c.WindowDays) * 24 * time.Hour
+	}
+	if c.NewAccountDays > 0 {
+		config.NewAccountAge = time.Duration(c.NewAccountDays) * 24 * time.Hour
+	}
+	return config
+}
+
+// Promotion abuse reason codes
+const (
+	ReasonPromoDeviceAbuse = "PROMO_DEVICE_ABUSE"
+	ReasonPromoIPAbuse     = "PROMO_IP_ABUSE"
+	ReasonPromoRepeat      = "PROMO_REPEAT_REDEMPTION"
+)
+
+// Promotion decisions: whether the bonus of a redemption should be paid out
+const (
+	PromoGrant    = "GRANT"
+	PromoWithhold = "WITHHOLD"
+)
+
+// PromoDecision is the promotion abuse finding on one redemption, published
+// in the promotion decision stream
+type PromoDecision struct {
+	TransactionID string   `json:"transaction_id"`
+	CampaignID    string   `json:"campaign_id"`
+	AccountID     string   `json:"account_id,omitempty"`
+	Decision      string   `json:"decision"`
+	ReasonCodes   []string `json:"reason_codes,omitempty"`
+	Reasons       []string `json:"reasons,omitempty"`
+	// DeviceAccounts and IPAccounts count the new accounts that redeemed the
+	// campaign from the same device and IP address
+	DeviceAccounts int       `json:"device_accounts"`
+	IPAccounts     int       `json:"ip_accounts"`
+	Redemptions    int       `json:"redemptions"`
+	DecidedAt      time.Time `json:"decided_at"`
+}
+
+// PromoResult is the outcome of the promotion abuse check
+type PromoResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// PromoTracker follows campaign redemptions by device, IP address and account
+type PromoTracker struct {
+	config    PromoConfig
+	campaigns map[string]Campaign
+	redeemed  map[string]*campaignRedemptions
+	// history is a ring of the latest decisions; next is the slot written
+	// next
+	history []PromoDecision
+	next    int
+	clock   Clock
+	mu      sync.Mutex
+}
+
+type campaignRedemptions struct {
+	// devices and ips map to the new accounts that redeemed from them and
+	// when they last did
+	devices map[string]map[string]time.Time
+	ips     map[string]map[string]time.Time
+	// accounts holds the redemption times of each account
+	accounts map[string][]time.Time
+}
+
+func NewPromoTracker(config PromoConfig) *PromoTracker {
+	return &PromoTracker{
+		config:    config.withDefaults(),
+		campaigns: make(map[string]Campaign),
+		redeemed:  make(map[string]*campaignRedemptions),
+		clock:     SystemClock(),
+	}
+}
+
+// SetCampaigns replaces the per-campaign limits
+func (t *PromoTracker) SetCampaigns(campaigns map[string]Campaign) {
+	copied := make(map[string]Campaign, len(campaigns))
+	for id, campaign := range campaigns {
+		copied[id] = campaign
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.campaigns = copied
+}
+
+// Check records a campaign redemption and evaluates it. Transactions without
+// a campaign ID are ignored.
+func (t *PromoTracker) Check(tx *Transaction) PromoResult {
+	result := PromoResult{}
+	if tx.CampaignID == "" {
+		return result
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	config := t.campaigns[tx.CampaignID].apply(t.config)
+	redeemed, exists := t.redeemed[tx.CampaignID]
+	if !exists {
+		redeemed = &campaignRedemptions{
+			devices:  make(map[string]map[string]time.Time),
+			ips:      make(map[string]map[string]time.Time),
+			accounts: make(map[string][]time.Time),
+		}
+		t.redeemed[tx.CampaignID] = redeemed
+	}
+	cutoff := tx.Timestamp.Add(-config.Window)
+	newAccount := tx.AccountCreatedAt.IsZero() || tx.Timestamp.Sub(tx.AccountCreatedAt) <= config.NewAccountAge
+
+	decision := PromoDecision{
+		TransactionID: tx.ID,
+		CampaignID:    tx.CampaignID,
+		AccountID:     tx.AccountID,
+		Decision:      PromoGrant,
+		DecidedAt:     t.clock.Now(),
+	}
+
+	if tx.DeviceID != "" && newAccount {
+		decision.DeviceAccounts = observePromoAccount(redeemed.devices, tx.DeviceID, tx, cutoff)
+		if decision.DeviceAccounts > config.MaxAccountsPerDevice {
+			result.Score += config.DeviceScore
+			result.Codes = append(result.Codes, ReasonPromoDeviceAbuse)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Campaign %s redeemed by %d new accounts from one device", tx.CampaignID, decision.DeviceAccounts))
+		}
+	}
+	if tx.IPAddress != "" && newAccount {
+		decision.IPAccounts = observePromoAccount(redeemed.ips, tx.IPAddress, tx, cutoff)
+		if decision.IPAccounts > config.MaxAccountsPerIP {
+			result.Score += config.IPScore
+			result.Codes = append(result.Codes, ReasonPromoIPAbuse)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Campaign %s redeemed by %d new accounts from one IP address", tx.CampaignID, decision.IPAccounts))
+		}
+	}
+	if tx.AccountID != "" {
+		times := append(pruneTimes(redeemed.accounts[tx.AccountID], cutoff), tx.Timestamp)
+		redeemed.accounts[tx.AccountID] = times
+		decision.Redemptions = len(times)
+		if decision.Redemptions > config.MaxRedemptions {
+			result.Score += config.RepeatScore
+			result.Codes = append(result.Codes, ReasonPromoRepeat)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Campaign %s redeemed %d times by the account", tx.CampaignID, decision.Redemptions))
+		}
+	}
+
+	if len(result.Codes) > 0 {
+		decision.Decision = PromoWithhold
+		decision.ReasonCodes = result.Codes
+		decision.Reasons = result.Reasons
+	}
+	t.remember(decision)
+	return result
+}
+
+// observePromoAccount records the account redeeming from a device or IP
+// address and returns the number of accounts that did within the window
+func observePromoAccount(index map[string]map[string]time.Time, key string, tx *Transaction, cutoff time.Time) int {
+	accounts, exists := index[key]
+	if !exists {
+		accounts = make(map[string]time.Time)
+		index[key] = accounts
+	}
+	account := tx.AccountID
+	if account == "" {
+		account = tx.ID
+	}
+	if last, seen := accounts[account]; !seen || tx.Timestamp.After(last) {
+		accounts[account] = tx.Timestamp
+	}
+	for account, last := range accounts {
+		if last.Before(cutoff) {
+			delete(accounts, account)
+		}
+	}
+	return len(accounts)
+}
+
+func pruneTimes(times []time.Time, cutoff time.Time) []time.Time {
+	kept := times[:0]
+	for _, t := range times {
+		if !t.Before(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// remember adds a decision to the history. Callers must hold the lock.
+func (t *PromoTracker) remember(decision PromoDecision) {
+	if len(t.history) < t.config.HistorySize {
+		t.history = append(t.history, decision)
+		return
+	}
+	t.history[t.next] = decision
+	t.next = (t.next + 1) % len(t.history)
+}
+
+// Decisions returns the kept promotion decisions made at or after since,
+// oldest first, optionally only those of one campaign
+func (t *PromoTracker) Decisions(since time.Time, campaignID string) []PromoDecision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	decisions := make([]PromoDecision, 0)
+	for i := range t.history {
+		decision := t.history[(t.next+i)%len(t.history)]
+		if decision.DecidedAt.Before(since) || (campaignID != "" && decision.CampaignID != campaignID) {
+			continue
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions
+}
+
+// LoadCampaigns reads per-campaign limits as a JSON object keyed by
+// campaign ID: {"SPRING24": {"max_accounts_per_device": 1}}
+func LoadCampaigns(r io.Reader) (map[string]Campaign, error) {
+	var campaigns map[string]Campaign
+	if err := json.NewDecoder(r).Decode(&campaigns); err != nil {
+		return nil, fmt.Errorf("invalid promotion campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// LoadCampaignsFile reads per-campaign limits from disk
+func LoadCampaignsFile(path string) (map[string]Campaign, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCampaigns(f)
+}
@@ -0,0 +1,75 @@
+package detector_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func redemption(i int, campaign, device, ip string) *detector.Transaction {
+	return &detector.Transaction{
+		ID:         fmt.Sprintf("TXN-%d", i),
+		AccountID:  fmt.Sprintf("ACC-%d", i),
+		DeviceID:   device,
+		IPAddress:  ip,
+		CampaignID: campaign,
+		Timestamp:  time.Now(),
+	}
+}
+
+func TestPromoTracker_DeviceAndIPAbuse(t *testing.T) {
+	tracker := detector.NewPromoTracker(detector.DefaultPromoConfig())
+	start := time.Now()
+
+	assert.Empty(t, tracker.Check(redemption(1, "SPRING", "DEV-1", "203.0.113.7")).Codes)
+	second := tracker.Check(redemption(2, "SPRING", "DEV-1", "203.0.113.7"))
+	assert.Equal(t, []string{detector.ReasonPromoDeviceAbuse}, second.Codes)
+
+	for i := 3; i <= 4; i++ {
+		tracker.Check(redemption(i, "SPRING", fmt.Sprintf("DEV-%d", i), "203.0.113.7"))
+	}
+	assert.Equal(t, []string{detector.ReasonPromoIPAbuse}, tracker.Check(redemption(5, "SPRING", "DEV-5", "203.0.113.7")).Codes)
+
+	established := redemption(6, "SPRING", "DEV-1", "203.0.113.7")
+	established.AccountCreatedAt = time.Now().Add(-365 * 24 * time.Hour)
+	assert.Empty(t, tracker.Check(established).Codes, "established accounts are not counted")
+	assert.Empty(t, tracker.Check(redemption(7, "SUMMER", "DEV-1", "203.0.113.7")).Codes, "campaigns are tracked apart")
+	assert.Empty(t, tracker.Check(&detector.Transaction{ID: "TXN-8", AccountID: "ACC-1", DeviceID: "DEV-1"}).Codes, "no campaign")
+
+	decisions := tracker.Decisions(start, "SPRING")
+	require.Len(t, decisions, 6)
+	assert.Equal(t, detector.PromoGrant, decisions[0].Decision)
+	assert.Equal(t, detector.PromoWithhold, decisions[1].Decision)
+	assert.Equal(t, 2, decisions[1].DeviceAccounts)
+	assert.Equal(t, 5, decisions[4].IPAccounts)
+	assert.Len(t, tracker.Decisions(start, ""), 7)
+	assert.Empty(t, tracker.Decisions(time.Now().Add(time.Minute), ""))
+}
+
+func TestPromoTracker_Campaigns(t *testing.T) {
+	tracker := detector.NewPromoTracker(detector.PromoConfig{HistorySize: 2})
+	campaigns, err := detector.LoadCampaigns(strings.NewReader(`{"VIP": {"max_accounts_per_device": 3, "max_redemptions": 2}}`))
+	require.NoError(t, err)
+	tracker.SetCampaigns(campaigns)
+
+	for i := 1; i <= 3; i++ {
+		assert.Empty(t, tracker.Check(redemption(i, "VIP", "DEV-1", "")).Codes)
+	}
+	assert.Equal(t, []string{detector.ReasonPromoDeviceAbuse}, tracker.Check(redemption(4, "VIP", "DEV-1", "")).Codes)
+
+	repeat := redemption(1, "VIP", "", "")
+	assert.Empty(t, tracker.Check(repeat).Codes, "second redemption allowed")
+	assert.Equal(t, []string{detector.ReasonPromoRepeat}, tracker.Check(repeat).Codes)
+
+	decisions := tracker.Decisions(time.Time{}, "")
+	require.Len(t, decisions, 2, "history is bounded")
+	assert.Equal(t, 3, decisions[1].Redemptions)
+
+	_, err = detector.LoadCampaigns(strings.NewReader(`[]`))
+	assert.Error(t, err)
+}
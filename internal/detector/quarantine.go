@@ -0,0 +1,205 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reasons a rule is quarantined
+const (
+	QuarantinePanics   = "panics"
+	QuarantineOverruns = "overruns"
+)
+
+// QuarantineConfig sets when a misbehaving rule is quarantined: after
+// PanicLimit panics of its condition, or after OverrunLimit evaluations
+// longer than Budget within OverrunWindow. Expression conditions are aborted
+// once they run out of budget; Go conditions cannot be interrupted, so their
+// budget is checked once they return.
+type QuarantineConfig struct {
+	PanicLimit    int
+	Budget        time.Duration
+	OverrunLimit  int
+	OverrunWindow time.Duration
+}
+
+// DefaultQuarantineConfig returns the default quarantine settings
+func DefaultQuarantineConfig() QuarantineConfig {
+	return QuarantineConfig{
+		PanicLimit:    3,
+		Budget:        10 * time.Millisecond,
+		OverrunLimit:  5,
+		OverrunWindow: time.Minute,
+	}
+}
+
+func (c QuarantineConfig) withDefaults() QuarantineConfig {
+	defaults := DefaultQuarantineConfig()
+	if c.PanicLimit <= 0 {
+		c.PanicLimit = defaults.PanicLimit
+	}
+	if c.Budget <= 0 {
+		c.Budget = defaults.Budget
+	}
+	if c.OverrunLimit <= 0 {
+		c.OverrunLimit = defaults.OverrunLimit
+	}
+	if c.OverrunWindow <= 0 {
+		c.OverrunWindow = defaults.OverrunWindow
+	}
+	return c
+}
+
+// RuleHealth records how a rule condition misbehaved. A quarantined rule is
+// skipped until it is released or replaced.
+type RuleHealth struct {
+	RuleID        string     `json:"rule_id"`
+	Panics        int        `json:"panics"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastPanic     *time.Time `json:"last_panic,omitempty"`
+	Overruns      int        `json:"overruns" doc:"Evaluations over budget in the current window"`
+	LastOverrunMs float64    `json:"last_overrun_ms,omitempty"`
+	Quarantined   bool       `json:"quarantined"`
+	Reason        string     `json:"reason,omitempty" doc:"panics or overruns"`
+	QuarantinedAt *time.Time `json:"quarantined_at,omitempty"`
+
+	overrunsSince time.Time
+}
+
+// QuarantineObserver is alerted when a rule is quarantined
+type QuarantineObserver interface {
+	ObserveQuarantine(ruleID, reason string)
+}
+
+// ruleGuard isolates rule conditions that panic or overrun their budget, so
+// one misbehaving rule only loses its own contribution
+type ruleGuard struct {
+	mu       sync.Mutex
+	config   QuarantineConfig
+	health   map[string]*RuleHealth
+	observer QuarantineObserver
+}
+
+func newRuleGuard(config QuarantineConfig) *ruleGuard {
+	return &ruleGuard{config: config.withDefaults(), health: make(map[string]*RuleHealth)}
+}
+
+func (g *ruleGuard) setObserver(observer QuarantineObserver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.observer = observer
+}
+
+func (g *ruleGuard) quarantined(ruleID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	health, exists := g.health[ruleID]
+	return exists && health.Quarantined
+}
+
+// evaluate runs a rule condition, reporting whether it matched and whether
+// it returned a result at all: conditions that panic or are aborted at the
+// deadline of the budget do not
+func (g *ruleGuard) evaluate(rule Rule, tx *Transaction) (matched, ok bool) {
+	start := time.Now()
+	tx.ruleDeadline, tx.ruleAborted = start.Add(g.config.Budget), false
+	defer func() {
+		aborted := tx.ruleAborted
+		tx.ruleDeadline, tx.ruleAborted = time.Time{}, false
+		if recovered := recover(); recovered != nil {
+			g.recordPanic(rule.ID, fmt.Sprint(recovered))
+			matched, ok = false, false
+			return
+		}
+		if elapsed := time.Since(start); aborted || elapsed > g.config.Budget {
+			g.recordOverrun(rule.ID, elapsed)
+		}
+		if aborted {
+			matched, ok = false, false
+		}
+	}()
+	return rule.Condition(tx), true
+}
+
+func (g *ruleGuard) recordOverrun(ruleID string, elapsed time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	health := g.get(ruleID)
+	now := time.Now()
+	if now.Sub(health.overrunsSince) > g.config.OverrunWindow {
+		health.Overruns = 0
+		health.overrunsSince = now
+	}
+	health.Overruns++
+	health.LastOverrunMs = float64(elapsed) / float64(time.Millisecond)
+	log.Printf("Rule %s took %s, over its %s budget (%d/%d)", ruleID, elapsed, g.config.Budget, health.Overruns, g.config.OverrunLimit)
+	if health.Overruns >= g.config.OverrunLimit {
+		g.quarantine(health, QuarantineOverruns, now)
+	}
+}
+
+func (g *ruleGuard) get(ruleID string) *RuleHealth {
+	health, exists := g.health[ruleID]
+	if !exists {
+		health = &RuleHealth{RuleID: ruleID}
+		g.health[ruleID] = health
+	}
+	return health
+}
+
+func (g *ruleGuard) quarantine(health *RuleHealth, reason string, now time.Time) {
+	if health.Quarantined {
+		return
+	}
+	health.Quarantined = true
+	health.Reason = reason
+	health.QuarantinedAt = &now
+	log.Printf("ALERT: rule %s quarantined after repeated %s", health.RuleID, reason)
+	if g.observer != nil {
+		g.observer.ObserveQuarantine(health.RuleID, reason)
+	}
+}
+
+// release forgets how a rule misbehaved, returning the record
+func (g *ruleGuard) release(ruleID string) (RuleHealth, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	health, exists := g.health[ruleID]
+	if !exists {
+		return RuleHealth{}, false
+	}
+	delete(g.health, ruleID)
+	return *health, true
+}
+
+func (g *ruleGuard) list() []RuleHealth {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	records := make([]RuleHealth, 0, len(g.health))
+	for _, health := range g.health {
+		records = append(records, *health)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].RuleID < records[j].RuleID })
+	return records
+}
+
+// RuleHealth returns the rules whose conditions panicked or overran their
+// budget, by rule ID
+func (d *Detector) RuleHealth() []RuleHealth {
+	return d.ruleGuard.list()
+}
+
+// ReleaseRule takes a rule out of quarantine and forgets how it misbehaved
+func (d *Detector) ReleaseRule(ruleID string) (RuleHealth, bool) {
+	return d.ruleGuard.release(ruleID)
+}
+
+// SetQuarantineObserver sets the observer alerted of quarantined rules
+func (d *Detector) SetQuarantineObserver(observer QuarantineObserver) {
+	d.ruleGuard.setObserver(observer)
+}
@@ -0,0 +1,79 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type quarantineAlerts struct {
+	reasons map[string]string
+}
+
+func (a *quarantineAlerts) ObserveQuarantine(ruleID, reason string) {
+	a.reasons[ruleID] = reason
+}
+
+func newQuarantineDetector(quarantine detector.QuarantineConfig) (*detector.Detector, *quarantineAlerts) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8, Quarantine: quarantine})
+	d.AddRule(detector.Rule{
+		ID:          "ALWAYS",
+		Description: "Always matches",
+		Score:       0.1,
+		Condition:   func(*detector.Transaction) bool { return true },
+	})
+	alerts := &quarantineAlerts{reasons: make(map[string]string)}
+	d.SetQuarantineObserver(alerts)
+	return d, alerts
+}
+
+func analyzeCodes(t *testing.T, d *detector.Detector) []string {
+	t.Helper()
+	score, err := d.Analyze(context.Background(), &detector.Transaction{ID: "TXN-Q", AccountID: "ACC-Q", Amount: 10, Timestamp: time.Now()})
+	require.NoError(t, err)
+	return score.ReasonCodes
+}
+
+func TestDetector_RuleOverrunQuarantine(t *testing.T) {
+	d, alerts := newQuarantineDetector(detector.QuarantineConfig{Budget: time.Millisecond, OverrunLimit: 2, OverrunWindow: time.Minute})
+	d.AddRule(detector.Rule{
+		ID:          "SLOW",
+		Description: "Slow rule",
+		Score:       0.5,
+		Condition: func(*detector.Transaction) bool {
+			time.Sleep(3 * time.Millisecond)
+			return true
+		},
+	})
+
+	assert.Contains(t, analyzeCodes(t, d), "SLOW", "an overrun still counts the result")
+	assert.Contains(t, analyzeCodes(t, d), "SLOW")
+	codes := analyzeCodes(t, d)
+	assert.NotContains(t, codes, "SLOW", "the rule is quarantined after repeated overruns")
+	assert.Contains(t, codes, "ALWAYS")
+	assert.Equal(t, map[string]string{"SLOW": detector.QuarantineOverruns}, alerts.reasons)
+
+	health := d.RuleHealth()
+	require.Len(t, health, 1)
+	assert.Equal(t, 2, health[0].Overruns)
+	assert.Greater(t, health[0].LastOverrunMs, 1.0)
+	assert.Equal(t, detector.QuarantineOverruns, health[0].Reason)
+}
+
+func TestDetector_ExpressionAbortedAtBudget(t *testing.T) {
+	d, alerts := newQuarantineDetector(detector.QuarantineConfig{Budget: time.Nanosecond, OverrunLimit: 2, OverrunWindow: time.Minute})
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:          "EXPR",
+		Description: "Expression rule",
+		Score:       0.5,
+		Expression:  "tx.amount > 0",
+	}))
+
+	assert.NotContains(t, analyzeCodes(t, d), "EXPR", "an aborted expression does not match")
+	analyzeCodes(t, d)
+	assert.Equal(t, detector.QuarantineOverruns, alerts.reasons["EXPR"])
+}
@@ -0,0 +1,162 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RecurringConfig holds recurring payment settings. A payment is recognized
+// as recurring once MinOccurrences earlier payments of the same series
+// arrived Period apart, give or take PeriodTolerance, for amounts within
+// AmountTolerance (a fraction) of each other.
+type RecurringConfig struct {
+	Period          time.Duration
+	PeriodTolerance time.Duration
+	AmountTolerance float64
+	MinOccurrences  int
+	// Discount is subtracted from the score of recognized recurring payments
+	Discount float64
+	// ChangeScore is added when a mandate changes amount or destination
+	ChangeScore float64
+}
+
+// DefaultRecurringConfig returns the default recurring payment settings
+func DefaultRecurringConfig() RecurringConfig {
+	return RecurringConfig{
+		Period:          30 * 24 * time.Hour,
+		PeriodTolerance: 4 * 24 * time.Hour,
+		AmountTolerance: 0.05,
+		MinOccurrences:  2,
+		Discount:        0.15,
+		ChangeScore:     0.3,
+	}
+}
+
+func (c RecurringConfig) withDefaults() RecurringConfig {
+	defaults := DefaultRecurringConfig()
+	if c.Period <= 0 {
+		c.Period = defaults.Period
+	}
+	if c.PeriodTolerance <= 0 {
+		c.PeriodTolerance = defaults.PeriodTolerance
+	}
+	if c.AmountTolerance <= 0 {
+		c.AmountTolerance = defaults.AmountTolerance
+	}
+	if c.MinOccurrences <= 0 {
+		c.MinOccurrences = defaults.MinOccurrences
+	}
+	if c.Discount <= 0 {
+		c.Discount = defaults.Discount
+	}
+	if c.ChangeScore <= 0 {
+		c.ChangeScore = defaults.ChangeScore
+	}
+	return c
+}
+
+// Recurring payment reason codes
+const (
+	ReasonRecurringPayment           = "RECURRING_PAYMENT"
+	ReasonRecurringAmountChange      = "RECURRING_AMOUNT_CHANGE"
+	ReasonRecurringDestinationChange = "RECURRING_DESTINATION_CHANGE"
+)
+
+// RecurringTracker follows series of recurring payments: the payments of a
+// mandate or, without one, of an account at a merchant
+type RecurringTracker struct {
+	config RecurringConfig
+	series map[string]*paymentSeries
+	mu     sync.Mutex
+}
+
+type paymentSeries struct {
+	amount      float64
+	destination string
+	last        time.Time
+	// occurrences counts the on-schedule payments of the current amount
+	occurrences int
+}
+
+// RecurringResult is the outcome of a recurring payment check. Discount is
+// subtracted from the transaction score.
+type RecurringResult struct {
+	Score    float64
+	Discount float64
+	Reasons  []string
+	Codes    []string
+}
+
+func NewRecurringTracker(config RecurringConfig) *RecurringTracker {
+	return &RecurringTracker{
+		config: config.withDefaults(),
+		series: make(map[string]*paymentSeries),
+	}
+}
+
+func seriesKey(tx *Transaction) string {
+	if tx.MandateID != "" {
+		return "mandate:" + tx.MandateID
+	}
+	return "merchant:" + tx.AccountID + ":" + tx.MerchantID
+}
+
+// Check records the payment in its series and evaluates it. Refunds are
+// ignored.
+func (r *RecurringTracker) Check(tx *Transaction) RecurringResult {
+	result := RecurringResult{}
+	if IsRefund(tx) || (tx.MandateID == "" && tx.MerchantID == "") {
+		return result
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey(tx)
+	series, exists := r.series[key]
+	if !exists {
+		r.series[key] = &paymentSeries{amount: tx.Amount, destination: tx.Destination, last: tx.Timestamp, occurrences: 1}
+		return result
+	}
+
+	sameAmount := math.Abs(tx.Amount-series.amount) <= r.config.AmountTolerance*series.amount
+	sameDestination := tx.Destination == "" || series.destination == "" || tx.Destination == series.destination
+	elapsed := tx.Timestamp.Sub(series.last)
+	onSchedule := elapsed >= r.config.Period-r.config.PeriodTolerance && elapsed <= r.config.Period+r.config.PeriodTolerance
+
+	// Only declared mandates have terms that can change
+	if tx.MandateID != "" {
+		if !sameAmount {
+			result.Score += r.config.ChangeScore
+			result.Codes = append(result.Codes, ReasonRecurringAmountChange)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Recurring mandate amount changed from %.2f to %.2f", series.amount, tx.Amount))
+		}
+		if !sameDestination {
+			result.Score += r.config.ChangeScore
+			result.Codes = append(result.Codes, ReasonRecurringDestinationChange)
+			result.Reasons = append(result.Reasons, "Recurring mandate paid to a new destination")
+		}
+	}
+
+	if sameAmount && sameDestination && onSchedule {
+		if series.occurrences >= r.config.MinOccurrences {
+			result.Discount = r.config.Discount
+			result.Codes = append(result.Codes, ReasonRecurringPayment)
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("Recognized recurring payment, %d previous on schedule", series.occurrences))
+		}
+		series.occurrences++
+	} else if !sameAmount || !sameDestination {
+		series.occurrences = 1
+	}
+
+	series.amount = tx.Amount
+	if tx.Destination != "" {
+		series.destination = tx.Destination
+	}
+	series.last = tx.Timestamp
+	return result
+}
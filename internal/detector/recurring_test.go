@@ -0,0 +1,80 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const month = 30 * 24 * time.Hour
+
+func payment(mandate, destination string, amount float64, at time.Time) *detector.Transaction {
+	return &detector.Transaction{
+		ID:          "TXN-REC",
+		AccountID:   "ACC-REC",
+		Amount:      amount,
+		MerchantID:  "MERCH-GYM",
+		Timestamp:   at,
+		MandateID:   mandate,
+		Destination: destination,
+	}
+}
+
+func TestRecurringTracker_RecognizesMonthlyPayments(t *testing.T) {
+	tracker := detector.NewRecurringTracker(detector.DefaultRecurringConfig())
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, tracker.Check(payment("", "", 49.90, start)).Codes)
+	assert.Empty(t, tracker.Check(payment("", "", 49.90, start.Add(month+24*time.Hour))).Codes, "one previous payment is not enough")
+
+	result := tracker.Check(payment("", "", 50.10, start.Add(2*month)))
+	assert.Equal(t, []string{detector.ReasonRecurringPayment}, result.Codes)
+	assert.Greater(t, result.Discount, 0.0)
+
+	result = tracker.Check(payment("", "", 49.90, start.Add(2*month+10*24*time.Hour)))
+	assert.Empty(t, result.Codes, "off schedule")
+}
+
+func TestRecurringTracker_FlagsMandateChanges(t *testing.T) {
+	tracker := detector.NewRecurringTracker(detector.DefaultRecurringConfig())
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	tracker.Check(payment("MANDATE-1", "IBAN-A", 800, start))
+	tracker.Check(payment("MANDATE-1", "IBAN-A", 800, start.Add(month)))
+
+	result := tracker.Check(payment("MANDATE-1", "IBAN-B", 800, start.Add(2*month)))
+	assert.Equal(t, []string{detector.ReasonRecurringDestinationChange}, result.Codes)
+	assert.Zero(t, result.Discount)
+
+	result = tracker.Check(payment("MANDATE-1", "IBAN-B", 2400, start.Add(3*month)))
+	assert.Equal(t, []string{detector.ReasonRecurringAmountChange}, result.Codes)
+	assert.Greater(t, result.Score, 0.0)
+
+	// Without a mandate an amount change only restarts the series
+	tracker.Check(payment("", "", 30, start))
+	assert.Empty(t, tracker.Check(payment("", "", 90, start.Add(month))).Codes)
+}
+
+func TestDetector_RecurringDiscount(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	var score *detector.FraudScore
+	var err error
+	for i := 0; i < 3; i++ {
+		// Round amounts over 1000 score as suspicious
+		score, err = d.Analyze(context.Background(), payment("", "", 2000, start.Add(time.Duration(i)*month)))
+		require.NoError(t, err)
+	}
+	assert.Contains(t, score.ReasonCodes, detector.ReasonRecurringPayment)
+
+	first, err := d.Analyze(context.Background(), &detector.Transaction{
+		ID: "TXN-NEW", AccountID: "ACC-OTHER", MerchantID: "MERCH-GYM", Amount: 2000, Timestamp: start.Add(2 * month),
+	})
+	require.NoError(t, err)
+	assert.Less(t, score.Score, first.Score)
+}
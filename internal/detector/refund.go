@@ -0,0 +1,168 @@
+package detector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RefundConfig holds refund and return abuse detection settings
+type RefundConfig struct {
+	Window             time.Duration
+	MaxRefunds         int
+	MaxRefundRatio     float64
+	MinPurchases       int
+	MaxMerchantRefunds int
+}
+
+// DefaultRefundConfig returns the default refund abuse settings
+func DefaultRefundConfig() RefundConfig {
+	return RefundConfig{
+		Window:             30 * 24 * time.Hour,
+		MaxRefunds:         3,
+		MaxRefundRatio:     0.5,
+		MinPurchases:       4,
+		MaxMerchantRefunds: 2,
+	}
+}
+
+func (c RefundConfig) withDefaults() RefundConfig {
+	defaults := DefaultRefundConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.MaxRefunds <= 0 {
+		c.MaxRefunds = defaults.MaxRefunds
+	}
+	if c.MaxRefundRatio <= 0 {
+		c.MaxRefundRatio = defaults.MaxRefundRatio
+	}
+	if c.MinPurchases <= 0 {
+		c.MinPurchases = defaults.MinPurchases
+	}
+	if c.MaxMerchantRefunds <= 0 {
+		c.MaxMerchantRefunds = defaults.MaxMerchantRefunds
+	}
+	return c
+}
+
+// Refund abuse reason codes
+const (
+	ReasonRefundFrequency      = "REFUND_FREQUENCY"
+	ReasonRefundRatio          = "REFUND_RATIO"
+	ReasonRefundNewDestination = "REFUND_NEW_DESTINATION"
+	ReasonSerialReturner       = "SERIAL_RETURNER"
+)
+
+// IsRefund reports whether the transaction is a refund or a return
+func IsRefund(tx *Transaction) bool {
+	switch strings.ToUpper(tx.Type) {
+	case "REFUND", "RETURN":
+		return true
+	}
+	return false
+}
+
+// RefundTracker tracks refund and return behaviour per account and merchant
+type RefundTracker struct {
+	config   RefundConfig
+	accounts map[string]*accountRefunds
+	mu       sync.Mutex
+}
+
+type accountRefunds struct {
+	purchases    []time.Time
+	refunds      []time.Time
+	merchants    map[string][]time.Time
+	destinations map[string]bool
+}
+
+// RefundResult is the outcome of a refund abuse check
+type RefundResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+func NewRefundTracker(config RefundConfig) *RefundTracker {
+	return &RefundTracker{
+		config:   config.withDefaults(),
+		accounts: make(map[string]*accountRefunds),
+	}
+}
+
+// Check records the transaction and evaluates refund abuse signals for it.
+// Purchases only contribute to the refund ratio; signals fire on refunds.
+func (r *RefundTracker) Check(tx *Transaction) RefundResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	acc, exists := r.accounts[tx.AccountID]
+	if !exists {
+		acc = &accountRefunds{
+			merchants:    make(map[string][]time.Time),
+			destinations: make(map[string]bool),
+		}
+		r.accounts[tx.AccountID] = acc
+	}
+
+	cutoff := tx.Timestamp.Add(-r.config.Window)
+	acc.purchases = pruneBefore(acc.purchases, cutoff)
+	acc.refunds = pruneBefore(acc.refunds, cutoff)
+
+	result := RefundResult{}
+	if !IsRefund(tx) {
+		acc.purchases = append(acc.purchases, tx.Timestamp)
+		return result
+	}
+
+	acc.refunds = append(acc.refunds, tx.Timestamp)
+	merchantRefunds := append(pruneBefore(acc.merchants[tx.MerchantID], cutoff), tx.Timestamp)
+	acc.merchants[tx.MerchantID] = merchantRefunds
+
+	if count := len(acc.refunds); count > r.config.MaxRefunds {
+		result.add(0.3, ReasonRefundFrequency,
+			fmt.Sprintf("High refund frequency: %d refunds in window", count))
+	}
+
+	if purchases := len(acc.purchases); purchases >= r.config.MinPurchases {
+		ratio := float64(len(acc.refunds)) / float64(purchases)
+		if ratio > r.config.MaxRefundRatio {
+			result.add(0.2, ReasonRefundRatio,
+				fmt.Sprintf("High refund ratio: %.0f%% of purchases refunded", ratio*100))
+		}
+	}
+
+	if count := len(merchantRefunds); count > r.config.MaxMerchantRefunds {
+		result.add(0.3, ReasonSerialReturner,
+			fmt.Sprintf("Serial returner: %d refunds at merchant %s", count, tx.MerchantID))
+	}
+
+	if dest := tx.RefundDestination; dest != "" {
+		// The first destination becomes the account's baseline
+		if len(acc.destinations) > 0 && !acc.destinations[dest] {
+			result.add(0.2, ReasonRefundNewDestination, "Refund sent to a previously unseen destination")
+		}
+		acc.destinations[dest] = true
+	}
+
+	return result
+}
+
+func (r *RefundResult) add(score float64, code, reason string) {
+	r.Score += score
+	r.Codes = append(r.Codes, code)
+	r.Reasons = append(r.Reasons, reason)
+}
+
+// pruneBefore drops timestamps at or before the cutoff, reusing the slice
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	kept := times[:0]
+	for _, t := range times {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
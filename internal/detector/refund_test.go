@@ -0,0 +1,116 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+)
+
+func refundTx(id, account, merchant, destination string, at time.Time) *detector.Transaction {
+	return &detector.Transaction{
+		ID:                id,
+		AccountID:         account,
+		Amount:            120.00,
+		Currency:          "USD",
+		MerchantID:        merchant,
+		Timestamp:         at,
+		Type:              "REFUND",
+		RefundDestination: destination,
+	}
+}
+
+func TestIsRefund(t *testing.T) {
+	assert.True(t, detector.IsRefund(&detector.Transaction{Type: "refund"}))
+	assert.True(t, detector.IsRefund(&detector.Transaction{Type: "RETURN"}))
+	assert.False(t, detector.IsRefund(&detector.Transaction{Type: "PURCHASE"}))
+}
+
+func TestRefundTracker_Frequency(t *testing.T) {
+	tracker := detector.NewRefundTracker(detector.RefundConfig{MaxRefunds: 2, MaxMerchantRefunds: 10})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		result := tracker.Check(refundTx("R", "ACC-1", "M-"+string(rune('A'+i)), "", now))
+		assert.NotContains(t, result.Codes, detector.ReasonRefundFrequency)
+	}
+
+	result := tracker.Check(refundTx("R", "ACC-1", "M-C", "", now))
+	assert.Contains(t, result.Codes, detector.ReasonRefundFrequency)
+	assert.Greater(t, result.Score, 0.0)
+}
+
+func TestRefundTracker_WindowExpiry(t *testing.T) {
+	tracker := detector.NewRefundTracker(detector.RefundConfig{Window: time.Hour, MaxRefunds: 1})
+	old := time.Now().Add(-2 * time.Hour)
+
+	tracker.Check(refundTx("R1", "ACC-1", "M-1", "", old))
+	result := tracker.Check(refundTx("R2", "ACC-1", "M-1", "", time.Now()))
+
+	assert.Empty(t, result.Codes)
+}
+
+func TestRefundTracker_SerialReturner(t *testing.T) {
+	tracker := detector.NewRefundTracker(detector.RefundConfig{MaxRefunds: 100, MaxMerchantRefunds: 2})
+	now := time.Now()
+
+	tracker.Check(refundTx("R1", "ACC-1", "M-1", "", now))
+	tracker.Check(refundTx("R2", "ACC-1", "M-1", "", now))
+	result := tracker.Check(refundTx("R3", "ACC-1", "M-1", "", now))
+
+	assert.Contains(t, result.Codes, detector.ReasonSerialReturner)
+}
+
+func TestRefundTracker_RefundRatio(t *testing.T) {
+	tracker := detector.NewRefundTracker(detector.RefundConfig{
+		MaxRefunds:         100,
+		MaxMerchantRefunds: 100,
+		MinPurchases:       2,
+		MaxRefundRatio:     0.5,
+	})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		tracker.Check(&detector.Transaction{AccountID: "ACC-1", Type: "PURCHASE", Timestamp: now})
+	}
+	result := tracker.Check(refundTx("R1", "ACC-1", "M-1", "", now))
+	assert.NotContains(t, result.Codes, detector.ReasonRefundRatio)
+
+	result = tracker.Check(refundTx("R2", "ACC-1", "M-1", "", now))
+	assert.Contains(t, result.Codes, detector.ReasonRefundRatio)
+}
+
+func TestRefundTracker_NewDestination(t *testing.T) {
+	tracker := detector.NewRefundTracker(detector.RefundConfig{MaxRefunds: 100, MaxMerchantRefunds: 100})
+	now := time.Now()
+
+	result := tracker.Check(refundTx("R1", "ACC-1", "M-1", "card_tok_1", now))
+	assert.NotContains(t, result.Codes, detector.ReasonRefundNewDestination)
+
+	result = tracker.Check(refundTx("R2", "ACC-1", "M-2", "card_tok_1", now))
+	assert.NotContains(t, result.Codes, detector.ReasonRefundNewDestination)
+
+	result = tracker.Check(refundTx("R3", "ACC-1", "M-3", "wallet_999", now))
+	assert.Contains(t, result.Codes, detector.ReasonRefundNewDestination)
+}
+
+func TestDetector_Analyze_RefundAbuseRequiresReview(t *testing.T) {
+	d := detector.NewDetector(detector.Config{
+		MaxVelocity:    100,
+		VelocityWindow: time.Hour,
+		BlockThreshold: 0.8,
+		Refund:         detector.RefundConfig{MaxRefunds: 1},
+	})
+	now := time.Now()
+
+	score, err := d.Analyze(context.Background(), refundTx("R1", "ACC-REFUND", "M-1", "", now))
+	assert.NoError(t, err)
+	assert.False(t, score.RequiresReview)
+
+	score, err = d.Analyze(context.Background(), refundTx("R2", "ACC-REFUND", "M-2", "", now))
+	assert.NoError(t, err)
+	assert.True(t, score.RequiresReview)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonRefundFrequency)
+}
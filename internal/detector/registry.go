@@ -0,0 +1,165 @@
+package detector
+
+// Enricher adds what it knows to a transaction before it is scored, such as
+// a profile looked up by one of its entities
+type Enricher interface {
+	Enrich(tx *Transaction)
+}
+
+// Components are the dependencies a Detector is built from: the stores of
+// per-account and per-entity state, the enrichers and lists, the ML model
+// and the hooks. NewDetectorWith builds those left unset from the
+// configuration, so tests can inject fakes and deployments swap the
+// implementations of some while keeping the rest.
+type Components struct {
+	// Rules are the built-in rules, DefaultRules() when nil
+	Rules []Rule
+
+	Velocity      *VelocityTracker
+	Geo           *GeoAnalyzer
+	Patterns      *PatternMatcher
+	Refunds       *RefundTracker
+	Activity      *ActivityTracker
+	AmountLimits  *AmountLimits
+	LimitTracker  *LimitTracker
+	Profiles      *ProfileTracker
+	Sequences     *SequenceTracker
+	Recurring     *RecurringTracker
+	Instruments   *InstrumentTracker
+	Mules         *MuleTracker
+	Beneficiaries *BeneficiaryTracker
+	Corridors     *CorridorTracker
+	Reputations   *ReputationTracker
+	Signups       *SignupTracker
+	Promos        *PromoTracker
+	Clearing      *ClearingTracker
+
+	Merchants   *MerchantRegistry
+	Calendar    *Calendar
+	Lists       *Lists
+	ASNs        *ASNTable
+	Forwarders  *ForwarderList
+	AddressRisk *AddressRiskList
+	// Enrichers run after the merchant, network and forwarder enrichment,
+	// in order
+	Enrichers []Enricher
+
+	MLModel      MLModel
+	Overrides    OverrideResolver
+	Features     FeatureGate
+	RuleObserver RuleObserver
+	StateLog     StateLog
+	External     []ExternalScorer
+	// Clock drives the velocity windows, travel speeds and reputation decay
+	// of every component, the wall clock when nil
+	Clock Clock
+}
+
+// withDefaults builds the components left unset. The ASN table, freight
+// forwarder and address risk lists stay unset unless loaded; without them
+// nothing is enriched or scored from them.
+func (c Components) withDefaults(config Config) Components {
+	if c.Rules == nil {
+		c.Rules = DefaultRules()
+	}
+	if c.Velocity == nil {
+		c.Velocity = NewVelocityTracker(config.VelocityWindow)
+	}
+	if c.Geo == nil {
+		c.Geo = NewGeoAnalyzerWithHistory(config.Geo.HistorySize)
+	}
+	if c.Patterns == nil {
+		c.Patterns = NewPatternMatcherWithAmounts(config.Amounts)
+	}
+	if c.Refunds == nil {
+		c.Refunds = NewRefundTracker(config.Refund)
+	}
+	if c.Activity == nil {
+		c.Activity = NewActivityTracker(config.Dormancy)
+	}
+	if c.AmountLimits == nil {
+		c.AmountLimits = NewAmountLimits()
+	}
+	if c.LimitTracker == nil {
+		c.LimitTracker = NewLimitTracker()
+	}
+	if c.Profiles == nil {
+		c.Profiles = NewProfileTrackerWithHistory(config.Spending.HistorySize)
+	}
+	if c.Sequences == nil {
+		c.Sequences = NewSequenceTracker(config.Sequence.HistorySize)
+	}
+	if c.Recurring == nil {
+		c.Recurring = NewRecurringTracker(config.Recurring)
+	}
+	if c.Instruments == nil {
+		c.Instruments = NewInstrumentTracker(config.Instrument, config.Geo.HistorySize)
+	}
+	if c.Mules == nil {
+		c.Mules = NewMuleTracker(config.Mule)
+	}
+	if c.Beneficiaries == nil {
+		c.Beneficiaries = NewBeneficiaryTracker(config.Beneficiary)
+	}
+	if c.Corridors == nil {
+		c.Corridors = NewCorridorTracker(config.Corridor)
+	}
+	if c.Reputations == nil {
+		c.Reputations = NewReputationTracker(config.Reputation)
+	}
+	if c.Signups == nil {
+		c.Signups = NewSignupTracker(config.Signup)
+	}
+	if c.Promos == nil {
+		c.Promos = NewPromoTracker(config.Promo)
+	}
+	if c.Clearing == nil {
+		c.Clearing = NewClearingTracker(config.Clearing)
+	}
+	if c.Merchants == nil {
+		c.Merchants = NewMerchantRegistry()
+	}
+	if c.Calendar == nil {
+		c.Calendar = NewCalendar()
+	}
+	if c.Lists == nil {
+		c.Lists = NewLists()
+	}
+	if c.MLModel == nil {
+		c.MLModel = NewMLModel()
+	}
+	if c.Clock == nil {
+		c.Clock = SystemClock()
+	}
+	c.Velocity.clock = c.Clock
+	c.Geo.clock = c.Clock
+	c.Instruments.velocity.clock = c.Clock
+	c.Instruments.geo.clock = c.Clock
+	c.Reputations.clock = c.Clock
+	c.Activity.setClock(c.Clock)
+	c.Signups.clock = c.Clock
+	c.Promos.clock = c.Clock
+	return c
+}
+
+// AddEnricher adds an enricher, run after those already added
+func (d *Detector) AddEnricher(enricher Enricher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.enrichers = append(d.enrichers, enricher)
+}
+
+// enrich adds the merchant profile, announcing network and freight
+// forwarder to a transaction, then runs the added enrichers
+func (d *Detector) enrich(tx *Transaction) {
+	d.getMerchantRegistry().Enrich(tx)
+	d.getASNTable().Enrich(tx)
+	d.getForwarderList().Enrich(tx)
+
+	d.mu.RLock()
+	enrichers := d.enrichers
+	d.mu.RUnlock()
+	for _, enricher := range enrichers {
+		enricher.Enrich(tx)
+	}
+}
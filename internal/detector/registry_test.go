@@ -0,0 +1,72 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedModel struct {
+	score, confidence float64
+}
+
+func (m fixedModel) Predict(*detector.Transaction) (float64, float64) {
+	return m.score, m.confidence
+}
+
+type countryEnricher struct {
+	country string
+}
+
+func (e countryEnricher) Enrich(tx *detector.Transaction) {
+	if tx.MerchantCountry == "" {
+		tx.MerchantCountry = e.country
+	}
+}
+
+func TestNewDetectorWith(t *testing.T) {
+	velocity := detector.NewVelocityTracker(time.Hour)
+	velocity.TrackKey("ACC-1", time.Now().Add(-time.Minute))
+
+	d := detector.NewDetectorWith(
+		detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, MLEnabled: true},
+		detector.Components{
+			Rules:     []detector.Rule{},
+			Velocity:  velocity,
+			MLModel:   fixedModel{score: 0.9, confidence: 0.7},
+			Enrichers: []detector.Enricher{countryEnricher{country: "BR"}},
+		})
+
+	tx := &detector.Transaction{
+		ID:        "TX-DI",
+		AccountID: "ACC-1",
+		Amount:    50,
+		Currency:  "USD",
+		Timestamp: time.Now(),
+	}
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Equal(t, 0.7, score.Confidence, "the injected model scores the transaction")
+	assert.Equal(t, "BR", tx.MerchantCountry, "the injected enricher runs before scoring")
+	assert.Empty(t, d.Rules())
+	assert.Equal(t, 2, velocity.GetCount("ACC-1"), "the injected velocity tracker keeps its state")
+
+	// Unset components are built from the configuration
+	defaults := detector.NewDetectorWith(detector.DefaultConfig(), detector.Components{})
+	assert.Len(t, defaults.Rules(), len(detector.DefaultRules()))
+}
+
+func TestDetector_AddEnricher(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour})
+	d.AddEnricher(countryEnricher{country: "PT"})
+	d.AddEnricher(countryEnricher{country: "ES"})
+
+	tx := &detector.Transaction{ID: "TX-PRE", AccountID: "ACC-2", Amount: 20, Currency: "EUR", Timestamp: time.Now()}
+	_, err := d.PreScore(tx)
+	require.NoError(t, err)
+	assert.Equal(t, "PT", tx.MerchantCountry, "enrichers run in the order they were added")
+}
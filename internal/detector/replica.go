@@ -0,0 +1,126 @@
+package detector
+
+import (
+	"sync"
+	"time"
+)
+
+// ProfileSlot is the part of an account profile contributed by one region
+// of an active-active deployment. A region only grows its own slot, so two
+// copies of a slot merge by keeping the one with more transactions.
+type ProfileSlot struct {
+	Count       int       `json:"tx_count"`
+	TotalAmount float64   `json:"total_amount"`
+	MaxAmount   float64   `json:"max_amount"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+func (s *ProfileSlot) add(amount float64, at time.Time) {
+	if s.Count == 0 || at.Before(s.FirstSeen) {
+		s.FirstSeen = at
+	}
+	if at.After(s.LastSeen) {
+		s.LastSeen = at
+	}
+	s.Count++
+	s.TotalAmount += amount
+	if amount > s.MaxAmount {
+		s.MaxAmount = amount
+	}
+}
+
+// profileSlots holds, per account, the slot of every region merged into its
+// profile
+type profileSlots struct {
+	region string
+	slots  map[string]map[string]ProfileSlot
+	mu     sync.Mutex
+}
+
+func (p *profileSlots) observe(accountID string, amount float64, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	regions, exists := p.slots[accountID]
+	if !exists {
+		regions = make(map[string]ProfileSlot)
+		p.slots[accountID] = regions
+	}
+	slot := regions[p.region]
+	slot.add(amount, at)
+	regions[p.region] = slot
+}
+
+func (p *profileSlots) snapshot() map[string]map[string]ProfileSlot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snapshot := make(map[string]map[string]ProfileSlot, len(p.slots))
+	for accountID, regions := range p.slots {
+		copied := make(map[string]ProfileSlot, len(regions))
+		for region, slot := range regions {
+			copied[region] = slot
+		}
+		snapshot[accountID] = copied
+	}
+	return snapshot
+}
+
+// SetRegion names the region of this engine in an active-active deployment,
+// from then on keeping the profile slot of each region so profiles can be
+// merged with the other regions. Call it before restoring the state.
+func (d *Detector) SetRegion(region string) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	d.replicas = &profileSlots{region: region, slots: make(map[string]map[string]ProfileSlot)}
+}
+
+// LocalProfileSlot returns what this region contributed to the profile of
+// an account
+func (d *Detector) LocalProfileSlot(accountID string) (ProfileSlot, bool) {
+	d.loadAccount(accountID)
+	d.stateMu.RLock()
+	defer d.stateMu.RUnlock()
+	if d.replicas == nil {
+		return ProfileSlot{}, false
+	}
+	d.replicas.mu.Lock()
+	defer d.replicas.mu.Unlock()
+	slot, exists := d.replicas.slots[accountID][d.replicas.region]
+	return slot, exists
+}
+
+// MergeProfileSlot merges the slot of another region into the profile of an
+// account, adding what the region contributed since the copy merged before.
+// Stale and repeated copies are ignored; it reports whether the profile
+// changed.
+func (d *Detector) MergeProfileSlot(accountID, region string, slot ProfileSlot) bool {
+	d.loadAccount(accountID)
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	if d.replicas == nil || region == d.replicas.region {
+		return false
+	}
+
+	d.replicas.mu.Lock()
+	regions, exists := d.replicas.slots[accountID]
+	if !exists {
+		regions = make(map[string]ProfileSlot)
+		d.replicas.slots[accountID] = regions
+	}
+	known := regions[region]
+	if slot.Count <= known.Count {
+		d.replicas.mu.Unlock()
+		return false
+	}
+	regions[region] = slot
+	d.replicas.mu.Unlock()
+
+	d.profiles.Merge(accountID, ProfileSlot{
+		Count:       slot.Count - known.Count,
+		TotalAmount: slot.TotalAmount - known.TotalAmount,
+		MaxAmount:   slot.MaxAmount,
+		FirstSeen:   slot.FirstSeen,
+		LastSeen:    slot.LastSeen,
+	})
+	return true
+}
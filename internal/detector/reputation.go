@@ -0,0 +1,318 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entity kinds with a reputation
+const (
+	EntityDevice   = "device"
+	EntityIP       = "ip"
+	EntityMerchant = "merchant"
+)
+
+// ReasonLowReputation flags transactions from a device, IP or merchant with
+// a fraud reputation
+const ReasonLowReputation = "LOW_REPUTATION"
+
+// ReputationConfig holds entity reputation settings. A reputation is a fraud
+// score from 0 to 1 that halves every HalfLife. Each fraud label moves the
+// reputation of the transaction's device, IP and merchant FraudWeight of the
+// way to 1. Transactions from an entity with a reputation of MinReputation
+// or more add up to MaxScore, scaled by the worst reputation.
+type ReputationConfig struct {
+	HalfLife      time.Duration
+	FraudWeight   float64
+	MinReputation float64
+	MaxScore      float64
+}
+
+// DefaultReputationConfig returns the default entity reputation settings
+func DefaultReputationConfig() ReputationConfig {
+	return ReputationConfig{
+		HalfLife:      30 * 24 * time.Hour,
+		FraudWeight:   0.4,
+		MinReputation: 0.2,
+		MaxScore:      0.4,
+	}
+}
+
+func (c ReputationConfig) withDefaults() ReputationConfig {
+	defaults := DefaultReputationConfig()
+	if c.HalfLife <= 0 {
+		c.HalfLife = defaults.HalfLife
+	}
+	if c.FraudWeight <= 0 || c.FraudWeight > 1 {
+		c.FraudWeight = defaults.FraudWeight
+	}
+	if c.MinReputation <= 0 {
+		c.MinReputation = defaults.MinReputation
+	}
+	if c.MaxScore <= 0 {
+		c.MaxScore = defaults.MaxScore
+	}
+	return c
+}
+
+// Reputation is the fraud reputation of the entities of a transaction, as of
+// its timestamp
+type Reputation struct {
+	Device   float64 `json:"device,omitempty"`
+	IP       float64 `json:"ip,omitempty"`
+	Merchant float64 `json:"merchant,omitempty"`
+}
+
+// Max returns the worst reputation
+func (r Reputation) Max() float64 {
+	return math.Max(r.Device, math.Max(r.IP, r.Merchant))
+}
+
+// ReputationScore is the reputation of an entity as last updated
+type ReputationScore struct {
+	Kind   string  `json:"kind"`
+	ID     string  `json:"id"`
+	Score  float64 `json:"score"`
+	Frauds int     `json:"frauds"`
+	// UpdatedAt is when Score was set; it has decayed since
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReputationResult is the outcome of the reputation check
+type ReputationResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+}
+
+// forgottenReputation is the decayed score below which entities are dropped
+// from snapshots
+const forgottenReputation = 0.01
+
+// ReputationTracker keeps the decaying fraud reputation of devices, IPs and
+// merchants. Unlike a denylist it grades gray-area entities: a reputation
+// rises with each confirmed fraud and fades when none follows.
+type ReputationTracker struct {
+	config ReputationConfig
+	scores map[string]*ReputationScore
+	// labeled remembers the transactions labeled fraud, so a repeated label
+	// does not count twice
+	labeled map[string]bool
+	clock   Clock
+	mu      sync.RWMutex
+}
+
+func NewReputationTracker(config ReputationConfig) *ReputationTracker {
+	return &ReputationTracker{
+		config:  config.withDefaults(),
+		scores:  make(map[string]*ReputationScore),
+		labeled: make(map[string]bool),
+		clock:   SystemClock(),
+	}
+}
+
+func reputationKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// ValidEntityKind reports whether entities of a kind have a reputation
+func ValidEntityKind(kind string) bool {
+	return kind == EntityDevice || kind == EntityIP || kind == EntityMerchant
+}
+
+// entities returns the kinds and IDs of a transaction's entities
+func reputationEntities(tx *Transaction) [][2]string {
+	entities := make([][2]string, 0, 3)
+	if tx.DeviceID != "" {
+		entities = append(entities, [2]string{EntityDevice, tx.DeviceID})
+	}
+	if tx.IPAddress != "" {
+		entities = append(entities, [2]string{EntityIP, tx.IPAddress})
+	}
+	if tx.MerchantID != "" {
+		entities = append(entities, [2]string{EntityMerchant, tx.MerchantID})
+	}
+	return entities
+}
+
+// decayed returns a score as of a time. Callers must hold the lock.
+func (r *ReputationTracker) decayed(score *ReputationScore, at time.Time) float64 {
+	if !at.After(score.UpdatedAt) {
+		return score.Score
+	}
+	return score.Score * math.Exp2(-float64(at.Sub(score.UpdatedAt))/float64(r.config.HalfLife))
+}
+
+func (r *ReputationTracker) reputationTime(tx *Transaction) time.Time {
+	if tx.Timestamp.IsZero() {
+		return r.clock.Now()
+	}
+	return tx.Timestamp
+}
+
+// Get returns the reputation of an entity as of a time
+func (r *ReputationTracker) Get(kind, id string, at time.Time) ReputationScore {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	score, exists := r.scores[reputationKey(kind, id)]
+	if !exists {
+		return ReputationScore{Kind: kind, ID: id, UpdatedAt: at}
+	}
+	current := *score
+	current.Score = r.decayed(score, at)
+	if at.After(current.UpdatedAt) {
+		current.UpdatedAt = at
+	}
+	return current
+}
+
+// Lookup returns the reputation of a transaction's entities
+func (r *ReputationTracker) Lookup(tx *Transaction) Reputation {
+	at := r.reputationTime(tx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var reputation Reputation
+	for _, entity := range reputationEntities(tx) {
+		score, exists := r.scores[reputationKey(entity[0], entity[1])]
+		if !exists {
+			continue
+		}
+		value := r.decayed(score, at)
+		switch entity[0] {
+		case EntityDevice:
+			reputation.Device = value
+		case EntityIP:
+			reputation.IP = value
+		case EntityMerchant:
+			reputation.Merchant = value
+		}
+	}
+	return reputation
+}
+
+// Set replaces the reputation of an entity, e.g. to grade one that would
+// otherwise go on a denylist
+func (r *ReputationTracker) Set(kind, id string, score float64, at time.Time) (ReputationScore, error) {
+	if !ValidEntityKind(kind) {
+		return ReputationScore{}, fmt.Errorf("unknown entity kind %q: must be %s, %s or %s", kind, EntityDevice, EntityIP, EntityMerchant)
+	}
+	if id == "" {
+		return ReputationScore{}, fmt.Errorf("entity id is required")
+	}
+	if score < 0 || score > 1 {
+		return ReputationScore{}, fmt.Errorf("reputation %.2f must be within [0, 1]", score)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := reputationKey(kind, id)
+	entry, exists := r.scores[key]
+	if !exists {
+		entry = &ReputationScore{Kind: kind, ID: id}
+		r.scores[key] = entry
+	}
+	entry.Score = score
+	entry.UpdatedAt = at
+	return *entry, nil
+}
+
+// Label raises the reputation of a fraudulent transaction's entities.
+// Legitimate labels leave reputations to decay.
+func (r *ReputationTracker) Label(tx *Transaction, fraud bool) {
+	if !fraud {
+		return
+	}
+	at := r.reputationTime(tx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.labeled[tx.ID] {
+		return
+	}
+	r.labeled[tx.ID] = true
+
+	for _, entity := range reputationEntities(tx) {
+		key := reputationKey(entity[0], entity[1])
+		entry, exists := r.scores[key]
+		if !exists {
+			entry = &ReputationScore{Kind: entity[0], ID: entity[1], UpdatedAt: at}
+			r.scores[key] = entry
+		}
+		weight := r.config.FraudWeight
+		if at.Before(entry.UpdatedAt) {
+			// A late label counts as it would have since decayed
+			weight *= math.Exp2(-float64(entry.UpdatedAt.Sub(at)) / float64(r.config.HalfLife))
+			at = entry.UpdatedAt
+		}
+		current := r.decayed(entry, at)
+		entry.Score = current + weight*(1-current)
+		entry.Frauds++
+		entry.UpdatedAt = at
+	}
+}
+
+// Check scores transactions by the worst reputation of their entities,
+// naming every entity at or above the minimum reputation
+func (r *ReputationTracker) Check(tx *Transaction) ReputationResult {
+	result := ReputationResult{}
+	worst := tx.Reputation.Max()
+	if worst < r.config.MinReputation {
+		return result
+	}
+
+	for _, entity := range []struct {
+		kind, id string
+		value    float64
+	}{
+		{EntityDevice, tx.DeviceID, tx.Reputation.Device},
+		{EntityIP, tx.IPAddress, tx.Reputation.IP},
+		{EntityMerchant, tx.MerchantID, tx.Reputation.Merchant},
+	} {
+		if entity.value >= r.config.MinReputation {
+			result.Reasons = append(result.Reasons,
+				fmt.Sprintf("%s %s has a fraud reputation of %.2f", strings.ToUpper(entity.kind[:1])+entity.kind[1:], entity.id, entity.value))
+		}
+	}
+	result.Score = r.config.MaxScore * worst
+	result.Codes = append(result.Codes, ReasonLowReputation)
+	return result
+}
+
+// Snapshot returns the reputations not yet decayed away, by key
+func (r *ReputationTracker) Snapshot() []ReputationScore {
+	now := r.clock.Now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make([]ReputationScore, 0, len(r.scores))
+	for _, score := range r.scores {
+		if r.decayed(score, now) >= forgottenReputation {
+			snapshot = append(snapshot, *score)
+		}
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Kind != snapshot[j].Kind {
+			return snapshot[i].Kind < snapshot[j].Kind
+		}
+		return snapshot[i].ID < snapshot[j].ID
+	})
+	return snapshot
+}
+
+// Restore replaces the reputations
+func (r *ReputationTracker) Restore(scores []ReputationScore) {
+	restored := make(map[string]*ReputationScore, len(scores))
+	for _, score := range scores {
+		score := score
+		restored[reputationKey(score.Kind, score.ID)] = &score
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scores = restored
+}
@@ -0,0 +1,88 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reputationTx(id string, at time.Time) *detector.Transaction {
+	return &detector.Transaction{ID: id, DeviceID: "DEV-1", IPAddress: "203.0.113.7", MerchantID: "MER-1", Timestamp: at}
+}
+
+func TestReputationTracker_RisesOnFraudAndDecays(t *testing.T) {
+	tracker := detector.NewReputationTracker(detector.ReputationConfig{HalfLife: 24 * time.Hour, FraudWeight: 0.5})
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.Label(reputationTx("TXN-1", start), true)
+	tracker.Label(reputationTx("TXN-1", start), true)
+	assert.InDelta(t, 0.5, tracker.Get(detector.EntityDevice, "DEV-1", start).Score, 1e-9, "a repeated label counts once")
+	tracker.Label(reputationTx("TXN-2", start), true)
+	tracker.Label(reputationTx("TXN-3", start), false)
+	current := tracker.Get(detector.EntityMerchant, "MER-1", start)
+	assert.InDelta(t, 0.75, current.Score, 1e-9)
+	assert.Equal(t, 2, current.Frauds)
+
+	reputation := tracker.Lookup(reputationTx("TXN-4", start.Add(24*time.Hour)))
+	assert.InDelta(t, 0.375, reputation.Device, 1e-9, "halves every half-life")
+	assert.InDelta(t, 0.375, reputation.IP, 1e-9)
+	assert.InDelta(t, 0.375, reputation.Merchant, 1e-9)
+
+	// A label arriving late counts as it would have since decayed
+	tracker.Label(&detector.Transaction{ID: "TXN-5", DeviceID: "DEV-2", Timestamp: start}, true)
+	tracker.Label(&detector.Transaction{ID: "TXN-6", DeviceID: "DEV-2", Timestamp: start.Add(-24 * time.Hour)}, true)
+	assert.InDelta(t, 0.5+0.25*0.5, tracker.Get(detector.EntityDevice, "DEV-2", start).Score, 1e-9)
+	assert.Zero(t, tracker.Get(detector.EntityIP, "unknown", start).Score)
+}
+
+func TestReputationTracker_SetAndCheck(t *testing.T) {
+	tracker := detector.NewReputationTracker(detector.DefaultReputationConfig())
+	now := time.Now()
+
+	_, err := tracker.Set(detector.EntityIP, "203.0.113.7", 0.5, now)
+	require.NoError(t, err)
+	_, err = tracker.Set("email", "a@example.com", 0.5, now)
+	assert.Error(t, err)
+	_, err = tracker.Set(detector.EntityDevice, "DEV-1", 1.5, now)
+	assert.Error(t, err)
+
+	tx := reputationTx("TXN-1", now)
+	tx.Reputation = tracker.Lookup(tx)
+	result := tracker.Check(tx)
+	assert.Equal(t, []string{detector.ReasonLowReputation}, result.Codes)
+	assert.InDelta(t, 0.2, result.Score, 1e-6)
+	require.Len(t, result.Reasons, 1)
+	assert.Contains(t, result.Reasons[0], "203.0.113.7")
+
+	tx.Reputation = detector.Reputation{Device: 0.1}
+	assert.Empty(t, tracker.Check(tx).Codes, "below the minimum reputation")
+
+	restored := detector.NewReputationTracker(detector.DefaultReputationConfig())
+	restored.Restore(tracker.Snapshot())
+	assert.InDelta(t, 0.5, restored.Get(detector.EntityIP, "203.0.113.7", now).Score, 1e-6)
+}
+
+func TestDetector_ScoresReputation(t *testing.T) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	now := time.Now()
+	for _, id := range []string{"TXN-1", "TXN-2"} {
+		d.LabelTransaction(reputationTx(id, now), true)
+	}
+
+	tx := reputationTx("TXN-3", now)
+	tx.AccountID = "ACC-1"
+	tx.Amount = 50
+	tx.Currency = "USD"
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Contains(t, score.ReasonCodes, detector.ReasonLowReputation)
+	assert.InDelta(t, 0.64, tx.Reputation.Max(), 1e-6)
+
+	var state detector.State
+	d.CheckpointState(func(s detector.State) { state = s })
+	assert.Len(t, state.Reputation, 3)
+}
@@ -0,0 +1,142 @@
+package detector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SequenceConfig holds per-account sequence settings. A transaction at the
+// same merchant as at least RepeatThreshold previous ones in a row, within
+// BurstInterval of the previous one, scores BurstScore.
+type SequenceConfig struct {
+	HistorySize     int
+	BurstInterval   time.Duration
+	RepeatThreshold int
+	BurstScore      float64
+}
+
+// DefaultSequenceConfig returns the default sequence settings
+func DefaultSequenceConfig() SequenceConfig {
+	return SequenceConfig{
+		HistorySize:     20,
+		BurstInterval:   2 * time.Minute,
+		RepeatThreshold: 3,
+		BurstScore:      0.2,
+	}
+}
+
+func (c SequenceConfig) withDefaults() SequenceConfig {
+	defaults := DefaultSequenceConfig()
+	if c.HistorySize <= 0 {
+		c.HistorySize = defaults.HistorySize
+	}
+	if c.BurstInterval <= 0 {
+		c.BurstInterval = defaults.BurstInterval
+	}
+	if c.RepeatThreshold <= 0 {
+		c.RepeatThreshold = defaults.RepeatThreshold
+	}
+	if c.BurstScore <= 0 {
+		c.BurstScore = defaults.BurstScore
+	}
+	return c
+}
+
+// ReasonSequenceBurst flags rapid repeats at the same merchant
+const ReasonSequenceBurst = "SEQUENCE_BURST"
+
+// SequenceFeatures describe a transaction relative to the previous
+// transactions of its account. The delta fields are only meaningful when
+// HasPrevious is set.
+type SequenceFeatures struct {
+	HasPrevious          bool    `json:"has_previous"`
+	SecondsSincePrevious float64 `json:"seconds_since_previous,omitempty"`
+	// AmountDelta is the amount minus the previous amount
+	AmountDelta float64 `json:"amount_delta,omitempty"`
+	// SameMerchantRepeats counts the previous transactions in a row at the
+	// same merchant
+	SameMerchantRepeats int `json:"same_merchant_repeats,omitempty"`
+}
+
+type sequenceEntry struct {
+	timestamp  time.Time
+	amount     float64
+	merchantID string
+}
+
+// SequenceTracker keeps the recent transactions of each account, oldest
+// first
+type SequenceTracker struct {
+	history    map[string][]sequenceEntry
+	maxHistory int
+	mu         sync.RWMutex
+}
+
+// NewSequenceTracker creates a tracker keeping historySize transactions per
+// account
+func NewSequenceTracker(historySize int) *SequenceTracker {
+	if historySize <= 0 {
+		historySize = DefaultSequenceConfig().HistorySize
+	}
+	return &SequenceTracker{
+		history:    make(map[string][]sequenceEntry),
+		maxHistory: historySize,
+	}
+}
+
+// Features computes the sequence features of a transaction without
+// recording it
+func (s *SequenceTracker) Features(tx *Transaction) SequenceFeatures {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sequenceFeatures(s.history[tx.AccountID], tx)
+}
+
+// Observe computes the sequence features of a transaction, then records it
+func (s *SequenceTracker) Observe(tx *Transaction) SequenceFeatures {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.history[tx.AccountID]
+	features := sequenceFeatures(history, tx)
+
+	history = append(history, sequenceEntry{timestamp: tx.Timestamp, amount: tx.Amount, merchantID: tx.MerchantID})
+	if len(history) > s.maxHistory {
+		history = history[len(history)-s.maxHistory:]
+	}
+	s.history[tx.AccountID] = history
+	return features
+}
+
+func sequenceFeatures(history []sequenceEntry, tx *Transaction) SequenceFeatures {
+	if len(history) == 0 {
+		return SequenceFeatures{}
+	}
+
+	previous := history[len(history)-1]
+	features := SequenceFeatures{
+		HasPrevious: true,
+		AmountDelta: tx.Amount - previous.amount,
+	}
+	// Out of order transactions count as immediate
+	if elapsed := tx.Timestamp.Sub(previous.timestamp); elapsed > 0 {
+		features.SecondsSincePrevious = elapsed.Seconds()
+	}
+	if tx.MerchantID != "" {
+		for i := len(history) - 1; i >= 0 && history[i].merchantID == tx.MerchantID; i-- {
+			features.SameMerchantRepeats++
+		}
+	}
+	return features
+}
+
+// checkSequence scores rapid repeats at the same merchant
+func checkSequence(config SequenceConfig, features SequenceFeatures) (float64, string) {
+	if !features.HasPrevious || features.SameMerchantRepeats < config.RepeatThreshold ||
+		features.SecondsSincePrevious > config.BurstInterval.Seconds() {
+		return 0, ""
+	}
+	return config.BurstScore, fmt.Sprintf("Repeated %d times in a row at the same merchant", features.SameMerchantRepeats+1)
+}
@@ -0,0 +1,68 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceTracker_Observe(t *testing.T) {
+	tracker := detector.NewSequenceTracker(10)
+	base := time.Now()
+	tx := func(offset time.Duration, amount float64, merchant string) *detector.Transaction {
+		return &detector.Transaction{AccountID: "ACC-SEQ", Amount: amount, MerchantID: merchant, Timestamp: base.Add(offset)}
+	}
+
+	features := tracker.Observe(tx(0, 100, "M1"))
+	assert.False(t, features.HasPrevious)
+
+	features = tracker.Observe(tx(30*time.Second, 250, "M1"))
+	assert.True(t, features.HasPrevious)
+	assert.Equal(t, 30.0, features.SecondsSincePrevious)
+	assert.Equal(t, 150.0, features.AmountDelta)
+	assert.Equal(t, 1, features.SameMerchantRepeats)
+
+	features = tracker.Observe(tx(time.Minute, 50, "M2"))
+	assert.Equal(t, -200.0, features.AmountDelta)
+	assert.Zero(t, features.SameMerchantRepeats)
+
+	// Features does not record the transaction
+	preview := tracker.Features(tx(2*time.Minute, 50, "M2"))
+	assert.Equal(t, 1, preview.SameMerchantRepeats)
+	assert.Equal(t, preview, tracker.Features(tx(2*time.Minute, 50, "M2")))
+
+	other := tracker.Observe(&detector.Transaction{AccountID: "ACC-OTHER", Timestamp: base})
+	assert.False(t, other.HasPrevious)
+}
+
+func TestDetector_SequenceBurst(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "QUICK_JUMP",
+		Expression: "tx.sequence.seconds_since_previous < 60 && tx.sequence.amount_delta > 500",
+		Score:      0.1,
+	}))
+
+	base := time.Now()
+	analyze := func(i int, amount float64) []string {
+		tx := &detector.Transaction{
+			ID:         "TXN-SEQ",
+			AccountID:  "ACC-SEQ",
+			Amount:     amount,
+			MerchantID: "MERCH-GIFTCARDS",
+			Timestamp:  base.Add(time.Duration(i) * 20 * time.Second),
+		}
+		score, err := d.Analyze(context.Background(), tx)
+		require.NoError(t, err)
+		return score.ReasonCodes
+	}
+
+	assert.NotContains(t, analyze(0, 50), "QUICK_JUMP", "no previous transaction")
+	assert.Contains(t, analyze(1, 700), "QUICK_JUMP")
+	assert.NotContains(t, analyze(2, 50), detector.ReasonSequenceBurst)
+	assert.Contains(t, analyze(3, 50), detector.ReasonSequenceBurst, "fourth in a row at the merchant")
+}
@@ -0,0 +1,212 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signup is an account-creation event. Email addresses and phone numbers
+// are sent as hashes, so the engine never sees them.
+type Signup struct {
+	AccountID string    `json:"account_id"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	EmailHash string    `json:"email_hash,omitempty"`
+	PhoneHash string    `json:"phone_hash,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SignupConfig holds duplicate account settings. A signup sharing an
+// attribute with accounts created within Window adds the attribute's score;
+// one linked to more than SerialAccounts other accounts also adds
+// SerialScore. IP addresses are shared behind NATs and mobile gateways, so
+// they weigh least.
+type SignupConfig struct {
+	Window         time.Duration
+	SerialAccounts int
+	DeviceScore    float64
+	EmailScore     float64
+	PhoneScore     float64
+	IPScore        float64
+	SerialScore    float64
+}
+
+// DefaultSignupConfig returns the default duplicate account settings
+func DefaultSignupConfig() SignupConfig {
+	return SignupConfig{
+		Window:         30 * 24 * time.Hour,
+		SerialAccounts: 3,
+		DeviceScore:    0.4,
+		EmailScore:     0.6,
+		PhoneScore:     0.5,
+		IPScore:        0.1,
+		SerialScore:    0.3,
+	}
+}
+
+func (c SignupConfig) withDefaults() SignupConfig {
+	defaults := DefaultSignupConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.SerialAccounts <= 0 {
+		c.SerialAccounts = defaults.SerialAccounts
+	}
+	if c.DeviceScore <= 0 {
+		c.DeviceScore = defaults.DeviceScore
+	}
+	if c.EmailScore <= 0 {
+		c.EmailScore = defaults.EmailScore
+	}
+	if c.PhoneScore <= 0 {
+		c.PhoneScore = defaults.PhoneScore
+	}
+	if c.IPScore <= 0 {
+		c.IPScore = defaults.IPScore
+	}
+	if c.SerialScore <= 0 {
+		c.SerialScore = defaults.SerialScore
+	}
+	return c
+}
+
+// Duplicate account reason codes
+const (
+	ReasonDuplicateDevice = "DUPLICATE_DEVICE"
+	ReasonDuplicateEmail  = "DUPLICATE_EMAIL"
+	ReasonDuplicatePhone  = "DUPLICATE_PHONE"
+	ReasonSharedSignupIP  = "SHARED_SIGNUP_IP"
+	ReasonSerialSignup    = "SERIAL_SIGNUP"
+)
+
+// Signup attributes matched against existing accounts
+const (
+	SignupDevice = "device_id"
+	SignupEmail  = "email_hash"
+	SignupPhone  = "phone_hash"
+	SignupIP     = "ip_address"
+)
+
+// SignupMatch lists the existing accounts sharing an attribute with a signup
+type SignupMatch struct {
+	Attribute string   `json:"attribute"`
+	Accounts  []string `json:"accounts"`
+}
+
+// SignupResult is the outcome of the duplicate account check
+type SignupResult struct {
+	Score   float64
+	Reasons []string
+	Codes   []string
+	Matches []SignupMatch
+}
+
+// SignupTracker indexes the attributes of recent signups to link new
+// accounts to existing ones
+type SignupTracker struct {
+	config SignupConfig
+	// accounts maps attribute, then value, to the accounts created with it
+	// and when
+	accounts map[string]map[string]map[string]time.Time
+	clock    Clock
+	mu       sync.Mutex
+}
+
+func NewSignupTracker(config SignupConfig) *SignupTracker {
+	return &SignupTracker{
+		config:   config.withDefaults(),
+		accounts: make(map[string]map[string]map[string]time.Time),
+		clock:    SystemClock(),
+	}
+}
+
+// signupAttributes are the attributes of a signup in the order they are
+// reported, with their codes
+func signupAttributes(signup Signup) []struct{ name, value, code string } {
+	return []struct{ name, value, code string }{
+		{SignupEmail, strings.ToLower(strings.TrimSpace(signup.EmailHash)), ReasonDuplicateEmail},
+		{SignupPhone, strings.ToLower(strings.TrimSpace(signup.PhoneHash)), ReasonDuplicatePhone},
+		{SignupDevice, signup.DeviceID, ReasonDuplicateDevice},
+		{SignupIP, signup.IPAddress, ReasonSharedSignupIP},
+	}
+}
+
+func (c SignupConfig) attributeScore(name string) float64 {
+	switch name {
+	case SignupEmail:
+		return c.EmailScore
+	case SignupPhone:
+		return c.PhoneScore
+	case SignupDevice:
+		return c.DeviceScore
+	default:
+		return c.IPScore
+	}
+}
+
+// Check matches a signup against the accounts created within the window,
+// then records it. Registering the same account again does not match it
+// with itself.
+func (t *SignupTracker) Check(signup Signup) SignupResult {
+	result := SignupResult{}
+	if signup.Timestamp.IsZero() {
+		signup.Timestamp = t.clock.Now()
+	}
+	cutoff := signup.Timestamp.Add(-t.config.Window)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	linked := make(map[string]bool)
+	for _, attribute := range signupAttributes(signup) {
+		if attribute.value == "" {
+			continue
+		}
+		values, exists := t.accounts[attribute.name]
+		if !exists {
+			values = make(map[string]map[string]time.Time)
+			t.accounts[attribute.name] = values
+		}
+		accounts, exists := values[attribute.value]
+		if !exists {
+			accounts = make(map[string]time.Time)
+			values[attribute.value] = accounts
+		}
+
+		var matched []string
+		for account, created := range accounts {
+			if created.Before(cutoff) {
+				delete(accounts, account)
+				continue
+			}
+			if account != signup.AccountID {
+				matched = append(matched, account)
+				linked[account] = true
+			}
+		}
+		accounts[signup.AccountID] = signup.Timestamp
+
+		if len(matched) == 0 {
+			continue
+		}
+		sort.Strings(matched)
+		result.Matches = append(result.Matches, SignupMatch{Attribute: attribute.name, Accounts: matched})
+		result.Score += t.config.attributeScore(attribute.name)
+		result.Codes = append(result.Codes, attribute.code)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Signup %s shared with %d existing accounts", attribute.name, len(matched)))
+	}
+
+	if len(linked) > t.config.SerialAccounts {
+		result.Score += t.config.SerialScore
+		result.Codes = append(result.Codes, ReasonSerialSignup)
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("Signup linked to %d accounts created within %s", len(linked), t.config.Window))
+	}
+	result.Score = math.Min(1.0, result.Score)
+	return result
+}
@@ -0,0 +1,51 @@
+package detector_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignupTracker_Duplicates(t *testing.T) {
+	tracker := detector.NewSignupTracker(detector.DefaultSignupConfig())
+	now := time.Now()
+
+	first := tracker.Check(detector.Signup{AccountID: "ACC-1", DeviceID: "DEV-1", IPAddress: "203.0.113.7", EmailHash: "AB12", Timestamp: now})
+	assert.Zero(t, first.Score)
+	assert.Empty(t, first.Matches)
+
+	again := tracker.Check(detector.Signup{AccountID: "ACC-1", DeviceID: "DEV-1", EmailHash: "ab12", Timestamp: now})
+	assert.Empty(t, again.Matches, "an account does not match itself")
+
+	duplicate := tracker.Check(detector.Signup{AccountID: "ACC-2", DeviceID: "DEV-1", IPAddress: "203.0.113.7", EmailHash: " ab12 ", Timestamp: now.Add(time.Hour)})
+	assert.Equal(t, []string{detector.ReasonDuplicateEmail, detector.ReasonDuplicateDevice, detector.ReasonSharedSignupIP}, duplicate.Codes)
+	assert.InDelta(t, 1.0, duplicate.Score, 1e-9, "capped at 1")
+	require.Len(t, duplicate.Matches, 3)
+	assert.Equal(t, detector.SignupMatch{Attribute: detector.SignupEmail, Accounts: []string{"ACC-1"}}, duplicate.Matches[0])
+
+	stale := tracker.Check(detector.Signup{AccountID: "ACC-3", PhoneHash: "cd34", Timestamp: now.Add(-60 * 24 * time.Hour)})
+	assert.Empty(t, stale.Codes)
+	later := tracker.Check(detector.Signup{AccountID: "ACC-4", PhoneHash: "cd34", Timestamp: now})
+	assert.Empty(t, later.Codes, "accounts created before the window are forgotten")
+}
+
+func TestSignupTracker_Serial(t *testing.T) {
+	tracker := detector.NewSignupTracker(detector.DefaultSignupConfig())
+	now := time.Now()
+
+	var result detector.SignupResult
+	for i := 0; i < 5; i++ {
+		result = tracker.Check(detector.Signup{
+			AccountID: fmt.Sprintf("ACC-%d", i),
+			DeviceID:  "DEV-FARM",
+			Timestamp: now.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	assert.Equal(t, []string{detector.ReasonDuplicateDevice, detector.ReasonSerialSignup}, result.Codes)
+	assert.InDelta(t, 0.7, result.Score, 1e-9)
+	assert.Len(t, result.Matches[0].Accounts, 4)
+}
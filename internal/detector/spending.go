@@ -0,0 +1,102 @@
+package detector
+
+import (
+	"math"
+	"sort"
+)
+
+// SpendingConfig holds the per-account amount thresholds. Once an account
+// has MinHistory transactions among its last HistorySize, an amount is high
+// for it above the median of those amounts plus K times their median
+// absolute deviation, and never below MinAmount. Accounts with less history
+// keep the global high amount threshold.
+type SpendingConfig struct {
+	HistorySize int
+	MinHistory  int
+	K           float64
+	MinAmount   float64
+}
+
+// DefaultSpendingConfig returns the default per-account threshold settings
+func DefaultSpendingConfig() SpendingConfig {
+	return SpendingConfig{
+		HistorySize: 50,
+		MinHistory:  10,
+		K:           5,
+		MinAmount:   1000,
+	}
+}
+
+func (c SpendingConfig) withDefaults() SpendingConfig {
+	defaults := DefaultSpendingConfig()
+	if c.HistorySize <= 0 {
+		c.HistorySize = defaults.HistorySize
+	}
+	if c.MinHistory <= 0 {
+		c.MinHistory = defaults.MinHistory
+	}
+	if c.MinHistory > c.HistorySize {
+		c.MinHistory = c.HistorySize
+	}
+	if c.K <= 0 {
+		c.K = defaults.K
+	}
+	if c.MinAmount <= 0 {
+		c.MinAmount = defaults.MinAmount
+	}
+	return c
+}
+
+// HighAmountThreshold is the global amount above which a transaction is high
+// for accounts without an adaptive threshold
+const HighAmountThreshold = 10000
+
+// amountBufferSize covers the default amount history, which is sorted
+// without allocating
+const amountBufferSize = 64
+
+// AmountThreshold returns the adaptive high amount threshold of an account,
+// or false while the profile holds fewer than MinHistory amounts
+func (p AccountProfile) AmountThreshold(config SpendingConfig) (float64, bool) {
+	if len(p.RecentAmounts) < config.MinHistory {
+		return 0, false
+	}
+	var buffer [amountBufferSize]float64
+	amounts := append(buffer[:0], p.RecentAmounts...)
+	center := median(amounts)
+	for i, amount := range amounts {
+		amounts[i] = math.Abs(amount - center)
+	}
+	return math.Max(center+config.K*median(amounts), config.MinAmount), true
+}
+
+// amountThreshold returns the adaptive high amount threshold of an account,
+// or zero while it has too little history
+func (d *Detector) amountThreshold(accountID string) float64 {
+	if accountID == "" {
+		return 0
+	}
+	threshold, _ := d.profiles.AmountThreshold(accountID, d.config.Spending)
+	return threshold
+}
+
+// highAmount reports whether a transaction's amount is high, against the
+// account threshold when the detector set one and the global one otherwise,
+// scaled by the running calendar events
+func highAmount(tx *Transaction) bool {
+	threshold := float64(HighAmountThreshold)
+	if tx.AmountThreshold > 0 {
+		threshold = tx.AmountThreshold
+	}
+	return tx.Amount > threshold*tx.Calendar.amountFactor()
+}
+
+// median sorts values in place and returns their median
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	middle := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[middle]
+	}
+	return (values[middle-1] + values[middle]) / 2
+}
@@ -0,0 +1,94 @@
+package detector_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountProfile_AmountThreshold(t *testing.T) {
+	config := detector.DefaultSpendingConfig()
+	config.MinHistory = 5
+
+	profile := detector.AccountProfile{RecentAmounts: []float64{100, 120, 80, 110, 90}}
+	threshold, ok := profile.AmountThreshold(config)
+	require.True(t, ok)
+	assert.Equal(t, 1000.0, threshold, "small spenders are held to the minimum")
+
+	// Median 20000, absolute deviations 0, 1000, 1000, 2000, 3000
+	profile.RecentAmounts = []float64{20000, 21000, 19000, 22000, 17000}
+	threshold, ok = profile.AmountThreshold(config)
+	require.True(t, ok)
+	assert.Equal(t, 25000.0, threshold)
+
+	profile.RecentAmounts = profile.RecentAmounts[:4]
+	_, ok = profile.AmountThreshold(config)
+	assert.False(t, ok, "too little history")
+}
+
+func TestDetector_Analyze_AdaptiveHighAmount(t *testing.T) {
+	d := detector.NewDetector(detector.Config{
+		MaxVelocity:    1000,
+		VelocityWindow: time.Minute,
+		BlockThreshold: 0.8,
+		Spending:       detector.SpendingConfig{HistorySize: 20, MinHistory: 10, K: 5, MinAmount: 1000},
+	})
+	start := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	analyze := func(account string, i int, amount float64) *detector.FraudScore {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID:        fmt.Sprintf("%s-%d", account, i),
+			AccountID: account,
+			Amount:    amount,
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Location:  newYork,
+		})
+		require.NoError(t, err)
+		return score
+	}
+
+	// Before it has a history, an account is held to the global threshold
+	assert.Contains(t, analyze("ACC-WHALE", 0, 15000.5).ReasonCodes, "HIGH_AMOUNT")
+	for i := 1; i < 12; i++ {
+		analyze("ACC-WHALE", i, 15000.5+float64(i%3)*500)
+	}
+	assert.NotContains(t, analyze("ACC-WHALE", 12, 18000.5).ReasonCodes, "HIGH_AMOUNT",
+		"a usual amount for a high spender")
+	assert.Contains(t, analyze("ACC-WHALE", 13, 40000.5).ReasonCodes, "HIGH_AMOUNT")
+
+	for i := 0; i < 12; i++ {
+		analyze("ACC-SMALL", i, 40.5)
+	}
+	assert.Contains(t, analyze("ACC-SMALL", 12, 5000.5).ReasonCodes, "HIGH_AMOUNT",
+		"a spike well below the global threshold")
+
+	score, err := d.PreScore(&detector.Transaction{ID: "ACC-SMALL-PRE", AccountID: "ACC-SMALL", Amount: 900.5, Timestamp: start, Location: newYork})
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, detector.ReasonAmountAboveProfile, "below the minimum threshold")
+}
+
+func TestDetector_ExpressionAmountThreshold(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 1000, VelocityWindow: time.Minute, BlockThreshold: 0.8})
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID:         "ABOVE_OWN_THRESHOLD",
+		Expression: "tx.amount > profile(tx.account_id).amount_threshold",
+		Score:      0.1,
+	}))
+	analyze := func(i int, amount float64) *detector.FraudScore {
+		score, err := d.Analyze(context.Background(), &detector.Transaction{
+			ID: fmt.Sprintf("TXN-%d", i), AccountID: "ACC-1", Amount: amount, Timestamp: time.Now(), Location: newYork,
+		})
+		require.NoError(t, err)
+		return score
+	}
+
+	assert.NotContains(t, analyze(0, 50000).ReasonCodes, "ABOVE_OWN_THRESHOLD", "null without a history")
+	for i := 1; i < detector.DefaultSpendingConfig().MinHistory; i++ {
+		analyze(i, 40)
+	}
+	assert.Contains(t, analyze(99, 5000).ReasonCodes, "ABOVE_OWN_THRESHOLD")
+}
@@ -0,0 +1,58 @@
+package detector
+
+// Split is the part of a marketplace payment paid out to one sub-merchant.
+// The country and MCC default to those of the sub-merchant's profile.
+type Split struct {
+	MerchantID      string  `json:"merchant_id"`
+	Amount          float64 `json:"amount"`
+	MerchantCountry string  `json:"merchant_country,omitempty"`
+	MCC             string  `json:"mcc,omitempty"`
+}
+
+// SplitScore is the assessment of one leg of a split payment
+type SplitScore struct {
+	MerchantID string      `json:"merchant_id"`
+	Amount     float64     `json:"amount"`
+	Detection  *FraudScore `json:"detection"`
+}
+
+// assessSplits scores every leg of a split payment as a payment of its
+// amount to its sub-merchant, with the rules, lists and overrides of that
+// merchant. Legs get the quick checks only: they read but never update
+// per-account state, which the payment as a whole already did.
+func (d *Detector) assessSplits(tx *Transaction) []SplitScore {
+	if len(tx.Splits) == 0 {
+		return nil
+	}
+
+	legs := make([]SplitScore, 0, len(tx.Splits))
+	for _, split := range tx.Splits {
+		leg := d.splitLeg(tx, split)
+		score := d.quickScore(leg)
+		score.Trusted = leg.AccountID != "" && leg.overrides.contains(d.lists, TrustedCustomersList, leg.AccountID)
+		d.finishQuickScore(score)
+		legs = append(legs, SplitScore{MerchantID: split.MerchantID, Amount: split.Amount, Detection: score})
+	}
+	return legs
+}
+
+// splitLeg returns the payment of one split leg, enriched from the profile
+// of its sub-merchant
+func (d *Detector) splitLeg(tx *Transaction, split Split) *Transaction {
+	leg := *tx
+	leg.Splits = nil
+	leg.Features = nil
+	leg.MerchantID = split.MerchantID
+	leg.Amount = split.Amount
+	leg.MerchantCountry = split.MerchantCountry
+	leg.MCC = split.MCC
+	leg.MerchantRiskTier = ""
+	leg.MerchantExpectedTicket = 0
+
+	d.getMerchantRegistry().Enrich(&leg)
+	leg.overrides = d.resolveOverrides(leg.MerchantID)
+	leg.CorridorRisk = d.corridors.Risk(&leg)
+	leg.Reputation = d.reputation(&leg)
+	leg.Calendar = d.getCalendar().Effect(&leg)
+	return &leg
+}
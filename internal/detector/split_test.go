@@ -0,0 +1,46 @@
+package detector_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+func TestDetector_Splits(t *testing.T) {
+	d := detector.NewDetector(detector.Config{MaxVelocity: 100, VelocityWindow: time.Hour, BlockThreshold: 0.8})
+	registry := detector.NewMerchantRegistry()
+	registry.Set(detector.MerchantProfile{MerchantID: "SELLER-OK", Country: "US", RiskTier: "low"})
+	registry.Set(detector.MerchantProfile{MerchantID: "SELLER-SHADY", Country: "US", RiskTier: "high"})
+	d.SetMerchantRegistry(registry)
+	require.NoError(t, d.AddExpressionRule(detector.Rule{
+		ID: "HIGH_RISK_SELLER", Description: "High-risk seller", Expression: "tx.merchant_risk_tier == 'high'", Score: 0.6,
+	}))
+
+	tx := &detector.Transaction{
+		ID: "TXN-SPLIT", AccountID: "ACC-1", Amount: 100, Currency: "USD", MerchantID: "MARKETPLACE",
+		Timestamp: time.Now(), Location: detector.Location{Country: "US"},
+		Splits: []detector.Split{
+			{MerchantID: "SELLER-OK", Amount: 60},
+			{MerchantID: "SELLER-SHADY", Amount: 30},
+		},
+	}
+	score, err := d.Analyze(context.Background(), tx)
+	require.NoError(t, err)
+	assert.NotContains(t, score.ReasonCodes, "HIGH_RISK_SELLER", "the marketplace itself is not high-risk")
+
+	require.Len(t, score.Splits, 2)
+	assert.Equal(t, "SELLER-OK", score.Splits[0].MerchantID)
+	assert.Equal(t, 60.0, score.Splits[0].Amount)
+	assert.NotContains(t, score.Splits[0].Detection.ReasonCodes, "HIGH_RISK_SELLER")
+	assert.Contains(t, score.Splits[1].Detection.ReasonCodes, "HIGH_RISK_SELLER")
+	assert.Equal(t, "HIGH", score.Splits[1].Detection.Risk)
+
+	var state detector.State
+	d.CheckpointState(func(copied detector.State) { state = copied })
+	assert.Equal(t, 1, state.Profiles["ACC-1"].Count, "legs do not count as transactions")
+}
@@ -0,0 +1,219 @@
+package detector
+
+import (
+	"strings"
+	"time"
+)
+
+// StateEntry is the part of an analyzed transaction that updates the
+// velocity, profile and amount limit state
+type StateEntry struct {
+	AccountID string    `json:"account_id"`
+	Amount    float64   `json:"amount"`
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type,omitempty"`
+}
+
+// StateLog records the state updates of analyzed transactions, such as a
+// write-ahead log
+type StateLog interface {
+	Append(entry StateEntry)
+}
+
+// StateLogs records state updates in several logs, in order
+type StateLogs []StateLog
+
+// Append appends an entry to every log
+func (l StateLogs) Append(entry StateEntry) {
+	for _, log := range l {
+		log.Append(entry)
+	}
+}
+
+// State is the velocity, profile and amount limit state of every account,
+// and the reputation of every device, IP and merchant
+type State struct {
+	Velocity   map[string][]time.Time    `json:"velocity"`
+	Profiles   map[string]AccountProfile `json:"profiles"`
+	Limits     map[string]LimitBucket    `json:"limits,omitempty"`
+	Reputation []ReputationScore         `json:"reputation,omitempty"`
+	// ProfileSlots are the region slots merged into the profiles, by
+	// account and region, in active-active deployments
+	ProfileSlots map[string]map[string]ProfileSlot `json:"profile_slots,omitempty"`
+}
+
+// SetStateLog sets the log of state updates
+func (d *Detector) SetStateLog(log StateLog) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	d.stateLog = log
+}
+
+// updateState adds a transaction to the velocity, profile and amount limit
+// state and logs it, returning what the account has left of its limits
+func (d *Detector) updateState(tx *Transaction) []LimitStatus {
+	d.stateMu.RLock()
+	defer d.stateMu.RUnlock()
+
+	d.profiles.Update(tx)
+	if d.replicas != nil {
+		d.replicas.observe(tx.AccountID, tx.Amount, tx.Timestamp)
+	}
+	d.velocityTracker.Track(tx)
+	limits := d.limitTracker.Consume(d.getAmountLimits().current(), tx)
+	if d.stateLog != nil {
+		d.stateLog.Append(StateEntry{AccountID: tx.AccountID, Amount: tx.Amount, Timestamp: tx.Timestamp, Type: tx.Type})
+	}
+	return limits
+}
+
+// CheckpointState calls fn with a copy of the state while no transaction
+// updates it, so fn can mark the position of the state log the copy covers.
+// fn should return quickly.
+func (d *Detector) CheckpointState(fn func(State)) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	state := State{
+		Velocity:   d.velocityTracker.Snapshot(),
+		Profiles:   d.profiles.Snapshot(),
+		Limits:     d.limitTracker.Snapshot(),
+		Reputation: d.reputations.Snapshot(),
+	}
+	if d.replicas != nil {
+		state.ProfileSlots = d.replicas.snapshot()
+	}
+	fn(state)
+}
+
+// RestoreState replaces the velocity, profile, amount limit and reputation
+// state
+func (d *Detector) RestoreState(state State) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	d.velocityTracker.Restore(state.Velocity)
+	d.profiles.Restore(state.Profiles)
+	d.limitTracker.Restore(state.Limits)
+	d.reputations.Restore(state.Reputation)
+	if d.replicas != nil {
+		slots := state.ProfileSlots
+		if slots == nil {
+			slots = make(map[string]map[string]ProfileSlot)
+		}
+		d.replicas.mu.Lock()
+		d.replicas.slots = slots
+		d.replicas.mu.Unlock()
+	}
+}
+
+// RestoreAccounts replaces the velocity, profile and amount limit state of
+// the accounts of a state, keeping that of the other accounts. Reputations
+// are not per account and are left as they are.
+func (d *Detector) RestoreAccounts(state State) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	d.velocityTracker.RestoreKeys(state.Velocity)
+	d.profiles.RestoreAccounts(state.Profiles)
+	d.limitTracker.RestoreBuckets(state.Limits)
+	if d.replicas != nil {
+		d.replicas.mu.Lock()
+		for accountID, regions := range state.ProfileSlots {
+			d.replicas.slots[accountID] = regions
+		}
+		d.replicas.mu.Unlock()
+	}
+}
+
+// SetAccountLoader sets the function restoring the state of an account kept
+// aside at startup, called before the account is first analyzed, scored or
+// merged with another region. Rule expressions reading other accounts do not
+// load them. A nil loader stops the calls.
+func (d *Detector) SetAccountLoader(load func(accountID string)) {
+	if load == nil {
+		d.accountLoader.Store(nil)
+		return
+	}
+	d.accountLoader.Store(&load)
+}
+
+func (d *Detector) loadAccount(accountID string) {
+	if load := d.accountLoader.Load(); load != nil && accountID != "" {
+		(*load)(accountID)
+	}
+}
+
+// Split divides a state into the accounts keep selects, with the
+// reputations, and the state of each other account
+func (s State) Split(keep func(accountID string) bool) (State, map[string]State) {
+	kept := State{
+		Velocity:   make(map[string][]time.Time),
+		Profiles:   make(map[string]AccountProfile),
+		Limits:     make(map[string]LimitBucket),
+		Reputation: s.Reputation,
+	}
+	if s.ProfileSlots != nil {
+		kept.ProfileSlots = make(map[string]map[string]ProfileSlot)
+	}
+	rest := make(map[string]State)
+	// of returns the state an account goes to
+	of := func(accountID string) *State {
+		if keep(accountID) {
+			return &kept
+		}
+		state, exists := rest[accountID]
+		if !exists {
+			state = State{
+				Velocity: make(map[string][]time.Time),
+				Profiles: make(map[string]AccountProfile),
+				Limits:   make(map[string]LimitBucket),
+			}
+			if s.ProfileSlots != nil {
+				state.ProfileSlots = make(map[string]map[string]ProfileSlot)
+			}
+			rest[accountID] = state
+		}
+		return &state
+	}
+
+	for accountID, times := range s.Velocity {
+		of(accountID).Velocity[accountID] = times
+	}
+	for accountID, profile := range s.Profiles {
+		of(accountID).Profiles[accountID] = profile
+	}
+	for key, bucket := range s.Limits {
+		of(limitAccount(key)).Limits[key] = bucket
+	}
+	for accountID, regions := range s.ProfileSlots {
+		of(accountID).ProfileSlots[accountID] = regions
+	}
+	return kept, rest
+}
+
+// limitAccount returns the account of an amount limit bucket key
+func limitAccount(key string) string {
+	product := strings.LastIndex(key, "|")
+	if product < 0 {
+		return key
+	}
+	if period := strings.LastIndex(key[:product], "|"); period >= 0 {
+		return key[:period]
+	}
+	return key[:product]
+}
+
+// ReplayState applies a logged state update without logging it again
+func (d *Detector) ReplayState(entry StateEntry) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	tx := &Transaction{AccountID: entry.AccountID, Amount: entry.Amount, Timestamp: entry.Timestamp, Type: entry.Type}
+	d.profiles.Update(tx)
+	if d.replicas != nil {
+		d.replicas.observe(tx.AccountID, tx.Amount, tx.Timestamp)
+	}
+	d.velocityTracker.Track(tx)
+	d.limitTracker.Consume(d.getAmountLimits().current(), tx)
+}
@@ -0,0 +1,390 @@
+// Package expr implements the expression language of detection rules.
+//
+// Expressions combine literals (numbers, 'strings', true, false, null and
+// [lists]), variables, field access (tx.location.country) and function calls
+// with the operators || && ! (or also or, and, not), == != < <= > >= in,
+// + - * / and %. Comparisons involving null are false, so rules over missing
+// data do not match.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrDeadlineExceeded is returned by evaluations still running at their
+// deadline
+var ErrDeadlineExceeded = errors.New("expression deadline exceeded")
+
+// deadlineSteps is how many nodes are evaluated between checks of the
+// deadline; function calls, which may be slow, always check it
+const deadlineSteps = 16
+
+// Func is a function callable from expressions
+type Func struct {
+	// Args is the number of arguments, or -1 for any number
+	Args int
+	Call func(args []interface{}) (interface{}, error)
+	// CallVars, when set, is called in place of Call with the variables the
+	// program is evaluated with, including those expressions cannot name
+	CallVars func(vars map[string]interface{}, args []interface{}) (interface{}, error)
+}
+
+// Env declares the variables and functions expressions may use
+type Env struct {
+	Vars  []string
+	Funcs map[string]Func
+}
+
+func (e Env) hasVar(name string) bool {
+	for _, v := range e.Vars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Program is a compiled expression
+type Program struct {
+	source string
+	root   node
+	funcs  map[string]Func
+}
+
+// Compile parses an expression, checking variables, functions and their
+// number of arguments against the environment
+func Compile(source string, env Env) (*Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, env: env}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return &Program{source: source, root: root, funcs: env.Funcs}, nil
+}
+
+// String returns the source of the program
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the program with the given variable values
+func (p *Program) Eval(vars map[string]interface{}) (interface{}, error) {
+	return p.EvalBefore(vars, time.Time{})
+}
+
+// EvalBefore evaluates the program like Eval, aborting with
+// ErrDeadlineExceeded once the deadline passes. A zero deadline never
+// passes. A function call is not interrupted; the deadline is checked before
+// and after it.
+func (p *Program) EvalBefore(vars map[string]interface{}, deadline time.Time) (interface{}, error) {
+	return p.eval(p.root, &evaluation{vars: vars, deadline: deadline})
+}
+
+// EvalBool evaluates the program and requires a boolean result
+func (p *Program) EvalBool(vars map[string]interface{}) (bool, error) {
+	return p.EvalBoolBefore(vars, time.Time{})
+}
+
+// EvalBoolBefore evaluates the program before a deadline, like EvalBefore,
+// and requires a boolean result
+func (p *Program) EvalBoolBefore(vars map[string]interface{}, deadline time.Time) (bool, error) {
+	value, err := p.EvalBefore(vars, deadline)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %s, not a boolean", typeName(value))
+	}
+	return result, nil
+}
+
+// evaluation is the state of one evaluation of a program
+type evaluation struct {
+	vars     map[string]interface{}
+	deadline time.Time
+	steps    int
+}
+
+// expired reports whether the deadline passed, reading the clock every
+// deadlineSteps nodes unless forced
+func (e *evaluation) expired(force bool) bool {
+	if e.deadline.IsZero() {
+		return false
+	}
+	e.steps++
+	if !force && e.steps%deadlineSteps != 1 {
+		return false
+	}
+	return !time.Now().Before(e.deadline)
+}
+
+func (p *Program) eval(n node, e *evaluation) (interface{}, error) {
+	if e.expired(false) {
+		return nil, ErrDeadlineExceeded
+	}
+	switch n := n.(type) {
+	case literalNode:
+		return n.value, nil
+
+	case identNode:
+		return e.vars[n.name], nil
+
+	case memberNode:
+		object, err := p.eval(n.object, e)
+		if err != nil || object == nil {
+			return nil, err
+		}
+		fields, ok := object.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot access field %s of %s", n.name, typeName(object))
+		}
+		return fields[n.name], nil
+
+	case callNode:
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			value, err := p.eval(arg, e)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		if e.expired(true) {
+			return nil, ErrDeadlineExceeded
+		}
+		fn := p.funcs[n.name]
+		var result interface{}
+		var err error
+		if fn.CallVars != nil {
+			result, err = fn.CallVars(e.vars, args)
+		} else {
+			result, err = fn.Call(args)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+		if e.expired(true) {
+			return nil, ErrDeadlineExceeded
+		}
+		return result, nil
+
+	case listNode:
+		items := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			value, err := p.eval(item, e)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+
+	case unaryNode:
+		operand, err := p.eval(n.operand, e)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			b, ok := operand.(bool)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate %s", typeName(operand))
+			}
+			return !b, nil
+		}
+		number, ok := operand.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %s", typeName(operand))
+		}
+		return -number, nil
+
+	case binaryNode:
+		return p.evalBinary(n, e)
+	}
+	return nil, fmt.Errorf("unknown expression node %T", n)
+}
+
+func (p *Program) evalBinary(n binaryNode, e *evaluation) (interface{}, error) {
+	left, err := p.eval(n.left, e)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logical operators short-circuit
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s needs booleans, got %s", n.op, typeName(left))
+		}
+		if (n.op == "&&" && !l) || (n.op == "||" && l) {
+			return l, nil
+		}
+		right, err := p.eval(n.right, e)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s needs booleans, got %s", n.op, typeName(right))
+		}
+		return r, nil
+	}
+
+	right, err := p.eval(n.right, e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return left != nil && right != nil && !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	}
+	return arithmetic(n.op, left, right)
+}
+
+func equal(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return false
+	}
+	switch l := left.(type) {
+	case float64, string, bool:
+		return l == right
+	}
+	return false
+}
+
+func contains(collection, value interface{}) (bool, error) {
+	switch c := collection.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range c {
+			if equal(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		s, ok := value.(string)
+		return ok && strings.Contains(c, s), nil
+	}
+	return false, fmt.Errorf("operator in needs a list or string, got %s", typeName(collection))
+}
+
+func compare(op string, left, right interface{}) (bool, error) {
+	if left == nil || right == nil {
+		return false, nil
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare number with %s", typeName(right))
+		}
+		cmp = compareOrdered(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare string with %s", typeName(right))
+		}
+		cmp = compareOrdered(l, r)
+	default:
+		return false, fmt.Errorf("cannot compare %s", typeName(left))
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func compareOrdered[T float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var errNull = errors.New("arithmetic on null")
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, errNull
+	}
+	if op == "+" {
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s needs numbers, got %s and %s", op, typeName(left), typeName(right))
+	}
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return l / r, nil
+	}
+	if r == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return math.Mod(l, r), nil
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
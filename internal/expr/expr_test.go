@@ -0,0 +1,110 @@
+package expr_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/expr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var env = expr.Env{
+	Vars: []string{"tx"},
+	Funcs: map[string]expr.Func{
+		"double": {Args: 1, Call: func(args []interface{}) (interface{}, error) {
+			return args[0].(float64) * 2, nil
+		}},
+		"fail": {Args: 0, Call: func([]interface{}) (interface{}, error) {
+			return nil, errors.New("boom")
+		}},
+		"slow": {Args: 0, Call: func([]interface{}) (interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return true, nil
+		}},
+	},
+}
+
+var tx = map[string]interface{}{
+	"amount":   1500.0,
+	"currency": "USD",
+	"location": map[string]interface{}{"country": "NG"},
+	"device":   nil,
+}
+
+func eval(t *testing.T, source string) interface{} {
+	program, err := expr.Compile(source, env)
+	require.NoError(t, err, source)
+	value, err := program.Eval(map[string]interface{}{"tx": tx})
+	require.NoError(t, err, source)
+	return value
+}
+
+func TestEval(t *testing.T) {
+	tests := map[string]interface{}{
+		"1 + 2 * 3":            7.0,
+		"(1 + 2) * 3":          9.0,
+		"-tx.amount / 100 % 7": -1.0,
+		"tx.amount > 1000 && tx.currency == 'USD'":  true,
+		"tx.amount >= 2000 || not (tx.amount < 10)": true,
+		"tx.location.country in ['NG', 'RU']":       true,
+		"'SD' in tx.currency":                       true,
+		"double(tx.amount) == 3000":                 true,
+		"tx.device == null":                         false,
+		"tx.device != 'x'":                          false,
+		"tx.missing.field":                          nil,
+		"tx.location.city > 'A'":                    false,
+		"\"a\\\"b\" + 'c'":                          "a\"bc",
+		"1_000 < tx.amount and !false":              true,
+	}
+	for source, expected := range tests {
+		assert.Equal(t, expected, eval(t, source), source)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, source := range []string{
+		"tx.amount >",
+		"unknown(1)",
+		"double(1, 2)",
+		"account.id",
+		"tx.amount # 2",
+		"'unterminated",
+		"(1 + 2",
+		"1 2",
+	} {
+		_, err := expr.Compile(source, env)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestEvalBool_Errors(t *testing.T) {
+	for _, source := range []string{
+		"tx.amount",
+		"tx.amount && true",
+		"fail()",
+		"tx.amount / 0 > 1",
+		"tx.device + 1 > 0",
+	} {
+		program, err := expr.Compile(source, env)
+		require.NoError(t, err, source)
+		_, err = program.EvalBool(map[string]interface{}{"tx": tx})
+		assert.Error(t, err, source)
+	}
+}
+
+func TestEvalBoolBefore_Deadline(t *testing.T) {
+	vars := map[string]interface{}{"tx": tx}
+	program, err := expr.Compile("slow() && tx.amount > 1000", env)
+	require.NoError(t, err)
+
+	matched, err := program.EvalBoolBefore(vars, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	_, err = program.EvalBoolBefore(vars, time.Now().Add(time.Millisecond))
+	assert.ErrorIs(t, err, expr.ErrDeadlineExceeded, "aborted once the slow call returns past the deadline")
+	_, err = program.EvalBoolBefore(vars, time.Now().Add(-time.Second))
+	assert.ErrorIs(t, err, expr.ErrDeadlineExceeded)
+}
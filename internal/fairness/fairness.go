@@ -0,0 +1,393 @@
+// Package fairness compares decline and false-positive rates across segments
+// of the audited transactions, such as countries, card brands and amount
+// bands, and flags the segments treated significantly worse than the rest.
+package fairness
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Segment dimensions
+const (
+	DimensionCountry       = "country"
+	DimensionIssuerCountry = "issuer_country"
+	DimensionCardBrand     = "card_brand"
+	DimensionAmountBand    = "amount_band"
+	DimensionType          = "type"
+	DimensionMerchant      = "merchant"
+)
+
+// Metrics compared across segments
+const (
+	MetricDeclineRate       = "decline_rate"
+	MetricFalsePositiveRate = "false_positive_rate"
+)
+
+// unknownSegment groups the transactions without a value for a dimension
+const unknownSegment = "unknown"
+
+var dimensions = map[string]func(tx *detector.Transaction, bands []float64) string{
+	DimensionCountry:       func(tx *detector.Transaction, _ []float64) string { return strings.ToUpper(tx.Location.Country) },
+	DimensionIssuerCountry: func(tx *detector.Transaction, _ []float64) string { return strings.ToUpper(tx.IssuerCountry) },
+	DimensionCardBrand:     func(tx *detector.Transaction, _ []float64) string { return strings.ToLower(tx.CardBrand) },
+	DimensionAmountBand:    func(tx *detector.Transaction, bands []float64) string { return amountBand(tx.Amount, bands) },
+	DimensionType:          func(tx *detector.Transaction, _ []float64) string { return strings.ToLower(tx.Type) },
+	DimensionMerchant:      func(tx *detector.Transaction, _ []float64) string { return tx.MerchantID },
+}
+
+// Config holds the fairness monitoring settings. A segment is flagged when
+// its rate of a metric exceeds that of the other transactions by at least
+// MinRatio, and the difference is significant: a two-proportion z-test
+// reaching MinZ. Segments need MinDecisions decisions to be compared on
+// decline rate and MinLabeled legitimate labels on false-positive rate.
+type Config struct {
+	Dimensions []string
+	// AmountBands are the upper bounds of the amount bands, ascending, in
+	// the transaction currency
+	AmountBands  []float64
+	Window       time.Duration
+	MinDecisions int
+	MinLabeled   int
+	MinRatio     float64
+	MinZ         float64
+}
+
+// DefaultConfig returns the default fairness monitoring settings
+func DefaultConfig() Config {
+	return Config{
+		Dimensions:   []string{DimensionCountry, DimensionCardBrand, DimensionAmountBand},
+		AmountBands:  []float64{100, 1000, 10000},
+		Window:       7 * 24 * time.Hour,
+		MinDecisions: 100,
+		MinLabeled:   20,
+		MinRatio:     1.25,
+		MinZ:         2.58,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if len(c.Dimensions) == 0 {
+		c.Dimensions = defaults.Dimensions
+	}
+	if len(c.AmountBands) == 0 {
+		c.AmountBands = defaults.AmountBands
+	}
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.MinDecisions <= 0 {
+		c.MinDecisions = defaults.MinDecisions
+	}
+	if c.MinLabeled <= 0 {
+		c.MinLabeled = defaults.MinLabeled
+	}
+	if c.MinRatio <= 0 {
+		c.MinRatio = defaults.MinRatio
+	}
+	if c.MinZ <= 0 {
+		c.MinZ = defaults.MinZ
+	}
+	return c
+}
+
+// Validate checks the dimensions and amount bands
+func (c Config) Validate() error {
+	for _, dimension := range c.Dimensions {
+		if _, exists := dimensions[dimension]; !exists {
+			return fmt.Errorf("unknown segment dimension %q", dimension)
+		}
+	}
+	for i := 1; i < len(c.AmountBands); i++ {
+		if c.AmountBands[i] <= c.AmountBands[i-1] {
+			return fmt.Errorf("amount bands must be ascending")
+		}
+	}
+	return nil
+}
+
+// Rates are the decisions and labels of a set of transactions.
+// FalsePositiveRate is the share of the transactions labeled legitimate that
+// were declined.
+type Rates struct {
+	Decisions         int     `json:"decisions"`
+	Declines          int     `json:"declines"`
+	DeclineRate       float64 `json:"decline_rate"`
+	Legitimate        int     `json:"legitimate"`
+	FalsePositives    int     `json:"false_positives"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+
+	decisions, declines float64
+}
+
+// SegmentStats are the rates of one segment
+type SegmentStats struct {
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+	Rates
+}
+
+// Disparity is a segment whose rate of a metric is significantly above that
+// of the other transactions
+type Disparity struct {
+	Dimension string  `json:"dimension"`
+	Value     string  `json:"value"`
+	Metric    string  `json:"metric"`
+	Rate      float64 `json:"rate"`
+	// Baseline is the rate of the transactions outside the segment
+	Baseline float64 `json:"baseline"`
+	// Ratio is Rate over Baseline, left out when the baseline is zero
+	Ratio float64 `json:"ratio,omitempty"`
+	Z     float64 `json:"z"`
+}
+
+// Report is the outcome of a fairness run
+type Report struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Since       time.Time      `json:"since"`
+	Overall     Rates          `json:"overall"`
+	Segments    []SegmentStats `json:"segments"`
+	Disparities []Disparity    `json:"disparities"`
+	// Estimated is set when sampled approvals were weighed up, so decline
+	// rates are estimates
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Monitor computes fairness reports from the audit store and the feedback
+// labels it is given
+type Monitor struct {
+	config Config
+	store  audit.Store
+	labels map[string]label
+	report *Report
+	mu     sync.Mutex
+}
+
+type label struct {
+	fraud bool
+	at    time.Time
+}
+
+func NewMonitor(config Config, store audit.Store) (*Monitor, error) {
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Monitor{
+		config: config,
+		store:  store,
+		labels: make(map[string]label),
+	}, nil
+}
+
+// Label records whether a transaction turned out to be fraud, replacing an
+// earlier label
+func (m *Monitor) Label(transactionID string, fraud bool, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.labels[transactionID] = label{fraud: fraud, at: at}
+}
+
+// Run computes a report over the decisions of the window before now and
+// keeps it as the latest
+func (m *Monitor) Run(now time.Time) (Report, error) {
+	since := now.Add(-m.config.Window)
+	records, err := m.store.Since(since)
+	if err != nil {
+		return Report{}, err
+	}
+
+	m.mu.Lock()
+	// Labels come after the decisions, so older ones are outside the window
+	for id, l := range m.labels {
+		if l.at.Before(since) {
+			delete(m.labels, id)
+		}
+	}
+	labels := make(map[string]bool, len(m.labels))
+	for id, l := range m.labels {
+		labels[id] = l.fraud
+	}
+	m.mu.Unlock()
+
+	report := m.compute(records, labels, since, now)
+
+	m.mu.Lock()
+	m.report = &report
+	m.mu.Unlock()
+	return report, nil
+}
+
+// Latest returns the last report, if one was computed
+func (m *Monitor) Latest() (Report, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.report == nil {
+		return Report{}, false
+	}
+	return *m.report, true
+}
+
+// Start runs the monitor at the given interval until stop is closed
+func (m *Monitor) Start(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			report, err := m.Run(time.Now())
+			if err != nil {
+				log.Printf("Fairness report failed: %v", err)
+				continue
+			}
+			for _, disparity := range report.Disparities {
+				log.Printf("Fairness disparity: %s %s has a %s of %.4f against %.4f for the rest (z %.2f)",
+					disparity.Dimension, disparity.Value, disparity.Metric, disparity.Rate, disparity.Baseline, disparity.Z)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (m *Monitor) compute(records []audit.Record, labels map[string]bool, since, now time.Time) Report {
+	report := Report{GeneratedAt: now, Since: since, Segments: []SegmentStats{}, Disparities: []Disparity{}}
+	segments := make(map[[2]string]*Rates)
+
+	for i := range records {
+		record := &records[i]
+		weight := 1.0
+		if record.SampleRate > 0 && record.SampleRate < 1 {
+			weight = 1 / record.SampleRate
+			report.Estimated = true
+		}
+		fraud, labeled := labels[record.Transaction.ID]
+
+		add := func(rates *Rates) {
+			rates.decisions += weight
+			if record.Decision == "DECLINE" {
+				rates.declines += weight
+			}
+			if labeled && !fraud {
+				rates.Legitimate++
+				if record.Decision == "DECLINE" {
+					rates.FalsePositives++
+				}
+			}
+		}
+		add(&report.Overall)
+		for _, dimension := range m.config.Dimensions {
+			value := dimensions[dimension](&record.Transaction, m.config.AmountBands)
+			if value == "" {
+				value = unknownSegment
+			}
+			key := [2]string{dimension, value}
+			if segments[key] == nil {
+				segments[key] = &Rates{}
+			}
+			add(segments[key])
+		}
+	}
+
+	report.Overall.finish()
+	for key, rates := range segments {
+		rates.finish()
+		segment := SegmentStats{Dimension: key[0], Value: key[1], Rates: *rates}
+		report.Segments = append(report.Segments, segment)
+
+		if rates.Decisions >= m.config.MinDecisions {
+			if disparity, flagged := m.compare(segment, MetricDeclineRate, rates.declines, rates.decisions,
+				report.Overall.declines-rates.declines, report.Overall.decisions-rates.decisions); flagged {
+				report.Disparities = append(report.Disparities, disparity)
+			}
+		}
+		if rates.Legitimate >= m.config.MinLabeled {
+			if disparity, flagged := m.compare(segment, MetricFalsePositiveRate, float64(rates.FalsePositives), float64(rates.Legitimate),
+				float64(report.Overall.FalsePositives-rates.FalsePositives), float64(report.Overall.Legitimate-rates.Legitimate)); flagged {
+				report.Disparities = append(report.Disparities, disparity)
+			}
+		}
+	}
+
+	sort.Slice(report.Segments, func(i, j int) bool {
+		a, b := report.Segments[i], report.Segments[j]
+		if a.Dimension != b.Dimension {
+			return a.Dimension < b.Dimension
+		}
+		return a.Value < b.Value
+	})
+	sort.Slice(report.Disparities, func(i, j int) bool {
+		return report.Disparities[i].Z > report.Disparities[j].Z
+	})
+	return report
+}
+
+// compare tests the rate of a segment, hits out of n, against that of the
+// other transactions
+func (m *Monitor) compare(segment SegmentStats, metric string, hits, n, otherHits, otherN float64) (Disparity, bool) {
+	if otherN <= 0 {
+		return Disparity{}, false
+	}
+	rate, baseline := hits/n, otherHits/otherN
+	pooled := (hits + otherHits) / (n + otherN)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/n + 1/otherN))
+	if se == 0 || rate <= baseline {
+		return Disparity{}, false
+	}
+
+	disparity := Disparity{
+		Dimension: segment.Dimension,
+		Value:     segment.Value,
+		Metric:    metric,
+		Rate:      rate,
+		Baseline:  baseline,
+		Z:         (rate - baseline) / se,
+	}
+	if baseline > 0 {
+		disparity.Ratio = rate / baseline
+		if disparity.Ratio < m.config.MinRatio {
+			return Disparity{}, false
+		}
+	}
+	return disparity, disparity.Z >= m.config.MinZ
+}
+
+func (r *Rates) finish() {
+	r.Decisions = int(math.Round(r.decisions))
+	r.Declines = int(math.Round(r.declines))
+	if r.decisions > 0 {
+		r.DeclineRate = r.declines / r.decisions
+	}
+	if r.Legitimate > 0 {
+		r.FalsePositiveRate = float64(r.FalsePositives) / float64(r.Legitimate)
+	}
+}
+
+// amountBand names the band of an amount, e.g. "100-1000" or "10000+"
+func amountBand(amount float64, bounds []float64) string {
+	lower := 0.0
+	for _, upper := range bounds {
+		if amount < upper {
+			return formatAmount(lower) + "-" + formatAmount(upper)
+		}
+		lower = upper
+	}
+	return formatAmount(lower) + "+"
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
@@ -0,0 +1,135 @@
+package fairness_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/fairness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func save(t *testing.T, store audit.Store, id, country string, amount float64, decision string, at time.Time) {
+	require.NoError(t, store.Save(audit.Record{
+		Transaction: detector.Transaction{
+			ID:        id,
+			Amount:    amount,
+			Location:  detector.Location{Country: country},
+			CardBrand: "visa",
+		},
+		Decision:  decision,
+		DecidedAt: at,
+	}))
+}
+
+func TestMonitor_FlagsDeclineDisparity(t *testing.T) {
+	store := audit.NewMemoryStore(10000)
+	now := time.Now()
+	for i := 0; i < 500; i++ {
+		decision := "APPROVE"
+		if i%10 == 0 {
+			decision = "DECLINE"
+		}
+		save(t, store, fmt.Sprintf("US-%d", i), "US", 50, decision, now)
+	}
+	for i := 0; i < 200; i++ {
+		decision := "APPROVE"
+		if i%2 == 0 {
+			decision = "DECLINE"
+		}
+		save(t, store, fmt.Sprintf("BR-%d", i), "BR", 50, decision, now)
+	}
+
+	monitor, err := fairness.NewMonitor(fairness.Config{}, store)
+	require.NoError(t, err)
+	report, err := monitor.Run(now.Add(time.Minute))
+	require.NoError(t, err)
+
+	assert.Equal(t, 700, report.Overall.Decisions)
+	assert.Equal(t, 150, report.Overall.Declines)
+	require.Len(t, report.Disparities, 1)
+	disparity := report.Disparities[0]
+	assert.Equal(t, fairness.DimensionCountry, disparity.Dimension)
+	assert.Equal(t, "BR", disparity.Value)
+	assert.Equal(t, fairness.MetricDeclineRate, disparity.Metric)
+	assert.InDelta(t, 0.5, disparity.Rate, 1e-9)
+	assert.InDelta(t, 0.1, disparity.Baseline, 1e-9)
+	assert.InDelta(t, 5, disparity.Ratio, 1e-9)
+
+	// Every transaction is in the same card brand and amount band
+	var brands, bands []string
+	for _, segment := range report.Segments {
+		switch segment.Dimension {
+		case fairness.DimensionCardBrand:
+			brands = append(brands, segment.Value)
+		case fairness.DimensionAmountBand:
+			bands = append(bands, segment.Value)
+		}
+	}
+	assert.Equal(t, []string{"visa"}, brands)
+	assert.Equal(t, []string{"0-100"}, bands)
+
+	latest, exists := monitor.Latest()
+	assert.True(t, exists)
+	assert.Equal(t, report.GeneratedAt, latest.GeneratedAt)
+}
+
+func TestMonitor_FlagsFalsePositiveDisparity(t *testing.T) {
+	store := audit.NewMemoryStore(10000)
+	now := time.Now()
+	monitor, err := fairness.NewMonitor(fairness.Config{
+		Dimensions:   []string{fairness.DimensionAmountBand},
+		MinDecisions: 1000,
+	}, store)
+	require.NoError(t, err)
+
+	// Small payments declined as often as large ones, but wrongly so
+	for i := 0; i < 100; i++ {
+		small, large := fmt.Sprintf("S-%d", i), fmt.Sprintf("L-%d", i)
+		decision := "APPROVE"
+		if i%2 == 0 {
+			decision = "DECLINE"
+		}
+		save(t, store, small, "US", 20, decision, now)
+		save(t, store, large, "US", 20000, decision, now)
+		monitor.Label(small, false, now)
+		monitor.Label(large, i%2 == 0 && i%10 != 0, now)
+	}
+
+	report, err := monitor.Run(now.Add(time.Minute))
+	require.NoError(t, err)
+
+	require.Len(t, report.Disparities, 1)
+	disparity := report.Disparities[0]
+	assert.Equal(t, "0-100", disparity.Value)
+	assert.Equal(t, fairness.MetricFalsePositiveRate, disparity.Metric)
+	assert.InDelta(t, 0.5, disparity.Rate, 1e-9)
+	assert.InDelta(t, 10.0/60, disparity.Baseline, 1e-9)
+}
+
+func TestMonitor_IgnoresSmallSegments(t *testing.T) {
+	store := audit.NewMemoryStore(1000)
+	now := time.Now()
+	for i := 0; i < 200; i++ {
+		save(t, store, fmt.Sprintf("US-%d", i), "US", 50, "APPROVE", now)
+	}
+	for i := 0; i < 10; i++ {
+		save(t, store, fmt.Sprintf("NG-%d", i), "NG", 50, "DECLINE", now)
+	}
+
+	monitor, err := fairness.NewMonitor(fairness.Config{}, store)
+	require.NoError(t, err)
+	report, err := monitor.Run(now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, report.Disparities)
+}
+
+func TestNewMonitor_Validates(t *testing.T) {
+	_, err := fairness.NewMonitor(fairness.Config{Dimensions: []string{"shoe_size"}}, audit.NewMemoryStore(1))
+	assert.Error(t, err)
+	_, err = fairness.NewMonitor(fairness.Config{AmountBands: []float64{100, 10}}, audit.NewMemoryStore(1))
+	assert.Error(t, err)
+}
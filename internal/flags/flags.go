@@ -0,0 +1,172 @@
+// Package flags gates features per tenant with percentage rollouts, so that
+// new detectors ship dark and are switched on client by client. A feature
+// rolled out to a percentage is on for a stable share of the accounts: an
+// account keeps its answer as the percentage grows.
+package flags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Flag is the rollout of a feature: the percentage of accounts it is on for,
+// and the percentages of the tenants that differ
+type Flag struct {
+	Name        string             `json:"name" openapi:"required,minLength=1"`
+	Description string             `json:"description,omitempty"`
+	Percentage  float64            `json:"percentage" openapi:"minimum=0,maximum=100"`
+	Tenants     map[string]float64 `json:"tenants,omitempty" doc:"Percentage per tenant, overriding the flag's own"`
+}
+
+// Validate checks the percentages of a flag
+func (f Flag) Validate() error {
+	if f.Name == "" {
+		return errors.New("flag name is required")
+	}
+	if err := checkPercentage(f.Percentage); err != nil {
+		return fmt.Errorf("flag %s: %w", f.Name, err)
+	}
+	for tenant, percentage := range f.Tenants {
+		if err := checkPercentage(percentage); err != nil {
+			return fmt.Errorf("flag %s, tenant %s: %w", f.Name, tenant, err)
+		}
+	}
+	return nil
+}
+
+func checkPercentage(percentage float64) error {
+	if math.IsNaN(percentage) || percentage < 0 || percentage > 100 {
+		return fmt.Errorf("percentage must be between 0 and 100, got %v", percentage)
+	}
+	return nil
+}
+
+// percentage returns the rollout of a tenant
+func (f Flag) percentage(tenant string) float64 {
+	if percentage, exists := f.Tenants[tenant]; exists && tenant != "" {
+		return percentage
+	}
+	return f.Percentage
+}
+
+// Registry holds the flags of the features. Features declare their default
+// rollout when the registry is created; configured flags replace them.
+type Registry struct {
+	defaults map[string]Flag
+	flags    map[string]Flag
+	mu       sync.RWMutex
+}
+
+func NewRegistry(defaults ...Flag) *Registry {
+	r := &Registry{defaults: make(map[string]Flag, len(defaults)), flags: make(map[string]Flag)}
+	for _, flag := range defaults {
+		r.defaults[flag.Name] = flag
+	}
+	return r
+}
+
+// Set validates and replaces the configured flags. Features without one get
+// their default rollout again.
+func (r *Registry) Set(flags []Flag) error {
+	configured := make(map[string]Flag, len(flags))
+	for _, flag := range flags {
+		if err := flag.Validate(); err != nil {
+			return err
+		}
+		if _, exists := configured[flag.Name]; exists {
+			return fmt.Errorf("flag %s is set twice", flag.Name)
+		}
+		if flag.Description == "" {
+			flag.Description = r.defaults[flag.Name].Description
+		}
+		configured[flag.Name] = flag
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flags = configured
+	return nil
+}
+
+// Flags returns the flag of every feature, configured or default, by name
+func (r *Registry) Flags() []Flag {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	flags := make([]Flag, 0, len(r.defaults)+len(r.flags))
+	for name, flag := range r.defaults {
+		if _, configured := r.flags[name]; !configured {
+			flags = append(flags, flag)
+		}
+	}
+	for _, flag := range r.flags {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// Enabled reports whether a feature is on for an account of a tenant.
+// Features without a flag are off.
+func (r *Registry) Enabled(name, tenant, key string) bool {
+	r.mu.RLock()
+	flag, exists := r.flags[name]
+	if !exists {
+		flag, exists = r.defaults[name]
+	}
+	r.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	percentage := flag.percentage(tenant)
+	switch {
+	case percentage <= 0:
+		return false
+	case percentage >= 100:
+		return true
+	}
+	return bucket(name, key) < percentage*100
+}
+
+// bucket places a key in one of 10000 buckets of a feature, so rollouts move
+// in steps of 0.01%
+func bucket(name, key string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum32() % 10000)
+}
+
+// Load reads flags as a JSON array:
+// [{"name": "mule_detection", "percentage": 100, "tenants": {"acme": 25}}]
+func Load(r io.Reader) ([]Flag, error) {
+	var flags []Flag
+	if err := json.NewDecoder(r).Decode(&flags); err != nil {
+		return nil, fmt.Errorf("invalid feature flags: %w", err)
+	}
+	for _, flag := range flags {
+		if err := flag.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid feature flags: %w", err)
+		}
+	}
+	return flags, nil
+}
+
+// LoadFile reads flags from disk
+func LoadFile(path string) ([]Flag, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,73 @@
+package flags_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/flags"
+)
+
+func enabledShare(r *flags.Registry, name, tenant string) float64 {
+	enabled := 0
+	for i := 0; i < 10000; i++ {
+		if r.Enabled(name, tenant, fmt.Sprintf("ACC-%d", i)) {
+			enabled++
+		}
+	}
+	return float64(enabled) / 10000
+}
+
+func TestRegistry_Rollout(t *testing.T) {
+	r := flags.NewRegistry(flags.Flag{Name: "graph_analysis", Description: "Graph analysis", Percentage: 0})
+	assert.False(t, r.Enabled("graph_analysis", "acme", "ACC-1"), "defaults ship dark")
+	assert.False(t, r.Enabled("unknown", "acme", "ACC-1"), "features without a flag are off")
+
+	require.NoError(t, r.Set([]flags.Flag{{Name: "graph_analysis", Percentage: 10, Tenants: map[string]float64{"acme": 100, "globex": 0}}}))
+	assert.True(t, r.Enabled("graph_analysis", "acme", "ACC-1"))
+	assert.False(t, r.Enabled("graph_analysis", "globex", "ACC-1"))
+	assert.InDelta(t, 0.1, enabledShare(r, "graph_analysis", "initech"), 0.02)
+
+	// Accounts enabled at 10% stay enabled at 50%
+	var enabled []string
+	for i := 0; i < 1000; i++ {
+		if key := fmt.Sprintf("ACC-%d", i); r.Enabled("graph_analysis", "", key) {
+			enabled = append(enabled, key)
+		}
+	}
+	require.NoError(t, r.Set([]flags.Flag{{Name: "graph_analysis", Percentage: 50}}))
+	for _, key := range enabled {
+		assert.True(t, r.Enabled("graph_analysis", "", key), key)
+	}
+	assert.InDelta(t, 0.5, enabledShare(r, "graph_analysis", ""), 0.02)
+
+	flagged := r.Flags()
+	require.Len(t, flagged, 1)
+	assert.Equal(t, "Graph analysis", flagged[0].Description, "configured flags keep the default description")
+
+	// Removing the flag restores the default
+	require.NoError(t, r.Set(nil))
+	assert.False(t, r.Enabled("graph_analysis", "", enabled[0]))
+}
+
+func TestRegistry_SetRejectsInvalidFlags(t *testing.T) {
+	r := flags.NewRegistry()
+	assert.Error(t, r.Set([]flags.Flag{{Name: "x", Percentage: 120}}))
+	assert.Error(t, r.Set([]flags.Flag{{Name: "x", Tenants: map[string]float64{"acme": -1}}}))
+	assert.Error(t, r.Set([]flags.Flag{{Name: "x"}, {Name: "x"}}))
+	assert.Error(t, r.Set([]flags.Flag{{Percentage: 10}}))
+}
+
+func TestLoad(t *testing.T) {
+	loaded, err := flags.Load(strings.NewReader(`[{"name": "ato_module", "percentage": 25, "tenants": {"acme": 100}}]`))
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, 25.0, loaded[0].Percentage)
+	assert.Equal(t, 100.0, loaded[0].Tenants["acme"])
+
+	_, err = flags.Load(strings.NewReader(`[{"name": "ato_module", "percentage": 250}]`))
+	assert.ErrorContains(t, err, "invalid feature flags")
+}
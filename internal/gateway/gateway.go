@@ -0,0 +1,320 @@
+// Package gateway acts on decisions in the payment processor: integrations
+// flag, annotate or hold the declined and reviewed payments at the gateway
+// that processes them. Each integration renders its request from a template,
+// starting from a preset for a common gateway.
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// Templates
+const (
+	// TemplateStripe flags the payment intent with the decision in its
+	// metadata, fraud_review set for reviews, like a Radar review
+	TemplateStripe = "stripe"
+	// TemplateAdyen posts a case note with the decision and reason codes
+	TemplateAdyen = "adyen"
+	// TemplateCustom takes the method, URL, headers and body from the
+	// integration
+	TemplateCustom = "custom"
+)
+
+// Integration configures the requests sent to a gateway, at the URL followed
+// by Path. The path, header values and body are Go templates over the
+// decision Event, the integration URL, and the Credential read from the
+// CredentialEnv environment variable. Transaction IDs are the gateway's
+// payment references.
+type Integration struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	URL      string `json:"url"`
+	// CredentialEnv names the environment variable holding the gateway API
+	// key, so that it stays out of the file
+	CredentialEnv string `json:"credential_env"`
+	// Decisions are acted on, DECLINE and REVIEW when empty
+	Decisions []string `json:"decisions,omitempty"`
+	// Merchants restricts the integration to these merchants, all when empty
+	Merchants []string `json:"merchants,omitempty"`
+	// Method, Path, Headers and Body replace those of the template; headers
+	// are merged
+	Method  string            `json:"method,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// presets are the templates of common gateways
+var presets = map[string]Integration{
+	TemplateStripe: {
+		URL:    "https://api.stripe.com",
+		Method: http.MethodPost,
+		Path:   "/v1/payment_intents/{{path .Event.TransactionID}}",
+		Headers: map[string]string{
+			"Authorization": "Bearer {{.Credential}}",
+			"Content-Type":  "application/x-www-form-urlencoded",
+		},
+		Body: `metadata[fraud_decision]={{query .Event.Decision}}` +
+			`&metadata[fraud_risk_score]={{printf "%.4f" .Event.RiskScore}}` +
+			`&metadata[fraud_reason_codes]={{query (join .Event.ReasonCodes ",")}}` +
+			`&metadata[fraud_review]={{eq .Event.Decision "REVIEW"}}`,
+	},
+	TemplateAdyen: {
+		Method: http.MethodPost,
+		Headers: map[string]string{
+			"X-API-Key":    "{{.Credential}}",
+			"Content-Type": "application/json",
+		},
+		Body: `{"pspReference": {{json .Event.TransactionID}}, "merchantAccount": {{json .Event.MerchantID}}, ` +
+			`"note": {{json (printf "Fraud engine %s, risk score %.2f: %s" .Event.Decision .Event.RiskScore (join .Event.ReasonCodes ", "))}}}`,
+	},
+	TemplateCustom: {Method: http.MethodPost},
+}
+
+var funcs = template.FuncMap{
+	"query": url.QueryEscape,
+	"path":  url.PathEscape,
+	"join":  strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// templateData is what the templates of an integration see
+type templateData struct {
+	Event      *events.DecisionEvent
+	URL        string
+	Credential string
+}
+
+// withPreset fills what the integration leaves unset from its template
+func (i Integration) withPreset() (Integration, error) {
+	preset, exists := presets[i.Template]
+	if !exists {
+		return i, fmt.Errorf("integration %q: unknown template %q, expected %s, %s or %s",
+			i.Name, i.Template, TemplateStripe, TemplateAdyen, TemplateCustom)
+	}
+	if i.URL == "" {
+		i.URL = preset.URL
+	}
+	if i.Method == "" {
+		i.Method = preset.Method
+	}
+	if i.Path == "" {
+		i.Path = preset.Path
+	}
+	if i.Body == "" {
+		i.Body = preset.Body
+	}
+	headers := make(map[string]string)
+	for name, value := range preset.Headers {
+		headers[name] = value
+	}
+	for name, value := range i.Headers {
+		headers[name] = value
+	}
+	i.Headers = headers
+	if len(i.Decisions) == 0 {
+		i.Decisions = []string{"DECLINE", "REVIEW"}
+	}
+	return i, nil
+}
+
+// adapter renders and delivers the requests of an integration
+type adapter struct {
+	name       string
+	method     string
+	target     *template.Template
+	headers    map[string]*template.Template
+	body       *template.Template
+	url        string
+	credential string
+	decisions  map[string]bool
+	merchants  map[string]bool
+	sender     *webhook.Sender
+}
+
+func newAdapter(integration Integration, config webhook.Config) (*adapter, error) {
+	integration, err := integration.withPreset()
+	if err != nil {
+		return nil, err
+	}
+	if integration.Name == "" {
+		return nil, fmt.Errorf("integration name is required")
+	}
+	target, err := url.Parse(integration.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("integration %q: invalid URL %q", integration.Name, integration.URL)
+	}
+
+	parse := func(name, text string) (*template.Template, error) {
+		parsed, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("integration %q: invalid %s template: %w", integration.Name, name, err)
+		}
+		return parsed, nil
+	}
+	a := &adapter{
+		name:       integration.Name,
+		method:     integration.Method,
+		headers:    make(map[string]*template.Template),
+		url:        strings.TrimSuffix(integration.URL, "/"),
+		credential: os.Getenv(integration.CredentialEnv),
+		decisions:  make(map[string]bool),
+		merchants:  make(map[string]bool),
+	}
+	if integration.CredentialEnv != "" && a.credential == "" {
+		return nil, fmt.Errorf("integration %q: %s is not set", integration.Name, integration.CredentialEnv)
+	}
+	if a.target, err = parse("path", "{{.URL}}"+integration.Path); err != nil {
+		return nil, err
+	}
+	if integration.Body != "" {
+		if a.body, err = parse("body", integration.Body); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range integration.Headers {
+		if a.headers[name], err = parse("header "+name, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, decision := range integration.Decisions {
+		a.decisions[strings.ToUpper(decision)] = true
+	}
+	for _, merchantID := range integration.Merchants {
+		a.merchants[merchantID] = true
+	}
+	a.sender = webhook.NewRequestSender(config, a.request)
+	return a, nil
+}
+
+// accepts reports whether the integration acts on an event
+func (a *adapter) accepts(event *events.DecisionEvent) bool {
+	if !a.decisions[event.Decision] {
+		return false
+	}
+	return len(a.merchants) == 0 || a.merchants[event.MerchantID]
+}
+
+// request renders the gateway request acting on an event
+func (a *adapter) request(event *events.DecisionEvent) (*http.Request, error) {
+	data := templateData{Event: event, URL: a.url, Credential: a.credential}
+	render := func(t *template.Template) (string, error) {
+		var out bytes.Buffer
+		if err := t.Execute(&out, data); err != nil {
+			return "", fmt.Errorf("integration %q: %w", a.name, err)
+		}
+		return out.String(), nil
+	}
+
+	target, err := render(a.target)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if a.body != nil {
+		rendered, err := render(a.body)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+	req, err := http.NewRequest(a.method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range a.headers {
+		rendered, err := render(value)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, rendered)
+	}
+	return req, nil
+}
+
+// Dispatcher sends the decisions to every integration that acts on them
+type Dispatcher struct {
+	adapters []*adapter
+}
+
+// NewDispatcher validates the integrations and starts delivering, with the
+// timeout, retry and queue settings of config
+func NewDispatcher(integrations []Integration, config webhook.Config) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	names := make(map[string]bool)
+	for _, integration := range integrations {
+		if names[integration.Name] {
+			d.Close()
+			return nil, fmt.Errorf("duplicate integration %q", integration.Name)
+		}
+		names[integration.Name] = true
+		a, err := newAdapter(integration, config)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.adapters = append(d.adapters, a)
+	}
+	return d, nil
+}
+
+// Send queues an event for the integrations acting on it. It returns the
+// names of those whose queue was full and dropped it.
+func (d *Dispatcher) Send(event *events.DecisionEvent) []string {
+	var dropped []string
+	for _, a := range d.adapters {
+		if a.accepts(event) && !a.sender.Send(event) {
+			dropped = append(dropped, a.name)
+		}
+	}
+	return dropped
+}
+
+// Names returns the names of the integrations
+func (d *Dispatcher) Names() []string {
+	names := make([]string, len(d.adapters))
+	for i, a := range d.adapters {
+		names[i] = a.name
+	}
+	return names
+}
+
+// Close delivers the queued events and stops the integrations
+func (d *Dispatcher) Close() {
+	for _, a := range d.adapters {
+		a.sender.Close()
+	}
+}
+
+// LoadIntegrations reads a JSON array of integrations
+func LoadIntegrations(r io.Reader) ([]Integration, error) {
+	var integrations []Integration
+	if err := json.NewDecoder(r).Decode(&integrations); err != nil {
+		return nil, fmt.Errorf("invalid gateway integrations: %w", err)
+	}
+	return integrations, nil
+}
+
+// LoadIntegrationsFile reads the integrations from disk
+func LoadIntegrationsFile(path string) ([]Integration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadIntegrations(f)
+}
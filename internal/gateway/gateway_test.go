@@ -0,0 +1,123 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/gateway"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type call struct {
+	method, path, auth, apiKey, body string
+}
+
+type processor struct {
+	mu    sync.Mutex
+	calls []call
+}
+
+func (p *processor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call{r.Method, r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("X-API-Key"), string(body)})
+}
+
+func decision(id, merchantID, outcome string) *events.DecisionEvent {
+	return &events.DecisionEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       id + ":1",
+		TransactionID: id,
+		MerchantID:    merchantID,
+		Decision:      outcome,
+		RiskScore:     0.72,
+		ReasonCodes:   []string{"HIGH_AMOUNT", "NEW_DEVICE"},
+	}
+}
+
+func TestDispatcher_Presets(t *testing.T) {
+	p := &processor{}
+	server := httptest.NewServer(p)
+	defer server.Close()
+	t.Setenv("TEST_STRIPE_KEY", "sk_test_1")
+	t.Setenv("TEST_ADYEN_KEY", "adyen-1")
+
+	dispatcher, err := gateway.NewDispatcher([]gateway.Integration{
+		{Name: "stripe", Template: gateway.TemplateStripe, URL: server.URL, CredentialEnv: "TEST_STRIPE_KEY", Merchants: []string{"shop"}},
+		{Name: "adyen", Template: gateway.TemplateAdyen, URL: server.URL + "/notes", CredentialEnv: "TEST_ADYEN_KEY", Decisions: []string{"DECLINE"}},
+	}, webhook.Config{Backoff: time.Millisecond})
+	require.NoError(t, err)
+
+	assert.Empty(t, dispatcher.Send(decision("pi_1", "shop", "REVIEW")))
+	dispatcher.Send(decision("pi_2", "shop", "APPROVE"))
+	dispatcher.Send(decision("pay_3", "travel", "DECLINE"))
+	dispatcher.Close()
+
+	require.Len(t, p.calls, 2)
+	stripe, adyen := p.calls[0], p.calls[1]
+	if stripe.path == "/notes" {
+		stripe, adyen = adyen, stripe
+	}
+
+	assert.Equal(t, "/v1/payment_intents/pi_1", stripe.path)
+	assert.Equal(t, "Bearer sk_test_1", stripe.auth)
+	form, err := url.ParseQuery(stripe.body)
+	require.NoError(t, err)
+	assert.Equal(t, "REVIEW", form.Get("metadata[fraud_decision]"))
+	assert.Equal(t, "true", form.Get("metadata[fraud_review]"))
+	assert.Equal(t, "HIGH_AMOUNT,NEW_DEVICE", form.Get("metadata[fraud_reason_codes]"))
+
+	assert.Equal(t, http.MethodPost, adyen.method)
+	assert.Equal(t, "adyen-1", adyen.apiKey)
+	var note map[string]string
+	require.NoError(t, json.Unmarshal([]byte(adyen.body), &note))
+	assert.Equal(t, "pay_3", note["pspReference"])
+	assert.Equal(t, "Fraud engine DECLINE, risk score 0.72: HIGH_AMOUNT, NEW_DEVICE", note["note"])
+}
+
+func TestDispatcher_Custom(t *testing.T) {
+	p := &processor{}
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	dispatcher, err := gateway.NewDispatcher([]gateway.Integration{{
+		Name:     "hold",
+		Template: gateway.TemplateCustom,
+		URL:      server.URL,
+		Method:   http.MethodPut,
+		Path:     "/payments/{{path .Event.TransactionID}}/hold",
+	}}, webhook.Config{Backoff: time.Millisecond})
+	require.NoError(t, err)
+	dispatcher.Send(decision("tx 1", "", "DECLINE"))
+	dispatcher.Close()
+
+	require.Len(t, p.calls, 1)
+	assert.Equal(t, http.MethodPut, p.calls[0].method)
+	assert.Equal(t, "/payments/tx 1/hold", p.calls[0].path)
+	assert.Empty(t, p.calls[0].body)
+}
+
+func TestNewDispatcher_Invalid(t *testing.T) {
+	config := webhook.DefaultConfig()
+	_, err := gateway.NewDispatcher([]gateway.Integration{{Name: "x", Template: "paypal"}}, config)
+	assert.ErrorContains(t, err, "unknown template")
+
+	_, err = gateway.NewDispatcher([]gateway.Integration{{Name: "x", Template: gateway.TemplateAdyen}}, config)
+	assert.ErrorContains(t, err, "invalid URL")
+
+	_, err = gateway.NewDispatcher([]gateway.Integration{{Name: "x", Template: gateway.TemplateStripe, CredentialEnv: "TEST_UNSET_KEY"}}, config)
+	assert.ErrorContains(t, err, "TEST_UNSET_KEY is not set")
+
+	_, err = gateway.NewDispatcher([]gateway.Integration{{Name: "x", Template: gateway.TemplateCustom, URL: "https://example.com", Body: "{{.Nope"}}, config)
+	assert.ErrorContains(t, err, "invalid body template")
+}
@@ -0,0 +1,60 @@
+// Package inflight coalesces concurrent calls for the same key, so that
+// duplicate requests share one computation instead of repeating it.
+package inflight
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrAborted is returned to the callers sharing a call that panicked
+var ErrAborted = errors.New("in-flight call aborted")
+
+// Group runs one call per key at a time. Callers arriving while a call for
+// their key runs wait for it and share its result. The zero value is ready
+// to use.
+type Group[T any] struct {
+	calls map[string]*call[T]
+	mu    sync.Mutex
+}
+
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+	dups  int
+}
+
+// Do runs fn, unless a call for key is in flight, in which case it waits for
+// that call instead. shared reports whether the result is shared with other
+// callers. Once a call returns, the next call for its key runs fn again.
+func (g *Group[T]) Do(key string, fn func() (T, error)) (value T, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	if c, exists := g.calls[key]; exists {
+		c.dups++
+		g.mu.Unlock()
+		<-c.done
+		return c.value, true, c.err
+	}
+	c := &call[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	returned := false
+	defer func() {
+		if !returned {
+			c.err = ErrAborted
+		}
+		g.mu.Lock()
+		shared = c.dups > 0
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	returned = true
+	return c.value, false, c.err
+}
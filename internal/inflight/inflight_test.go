@@ -0,0 +1,88 @@
+package inflight_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/inflight"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup_Do_CoalescesConcurrentCalls(t *testing.T) {
+	var group inflight.Group[int]
+	var runs atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	leader := make(chan bool)
+	go func() {
+		_, shared, _ := group.Do("TX-1", func() (int, error) {
+			close(started)
+			<-release
+			return int(runs.Add(1)), nil
+		})
+		leader <- shared
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	results := make([]int, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, shared, err := group.Do("TX-1", func() (int, error) {
+				return int(runs.Add(1)), nil
+			})
+			require.NoError(t, err)
+			assert.True(t, shared)
+			results[i] = value
+		}(i)
+	}
+	// Other keys are not held up
+	value, shared, err := group.Do("TX-2", func() (int, error) { return 42, nil })
+	require.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, 42, value)
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.True(t, <-leader)
+	assert.Equal(t, int32(1), runs.Load())
+	assert.Equal(t, []int{1, 1, 1, 1, 1}, results)
+
+	// A finished call is not reused
+	value, shared, err = group.Do("TX-1", func() (int, error) { return int(runs.Add(1)), nil })
+	require.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, 2, value)
+}
+
+func TestGroup_Do_Panic(t *testing.T) {
+	var group inflight.Group[int]
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		group.Do("TX-1", func() (int, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	done := make(chan error)
+	go func() {
+		_, _, err := group.Do("TX-1", func() (int, error) { return 0, nil })
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	assert.ErrorIs(t, <-done, inflight.ErrAborted, "callers waiting on a panicked call are released")
+}
@@ -0,0 +1,477 @@
+// Package jobs runs asynchronous operations, such as model training and
+// traffic replays, from a durable queue. Failed attempts are retried with
+// exponential backoff, each job type runs at most its concurrency limit of
+// jobs at a time, and finished jobs are kept as history.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	Canceled  = "canceled"
+)
+
+var (
+	// ErrUnknownType is returned when enqueuing a job of an unregistered type
+	ErrUnknownType = errors.New("unknown job type")
+	// ErrNotFound is returned for jobs that are not kept
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned when canceling a finished job
+	ErrFinished = errors.New("job already finished")
+)
+
+// Job is an asynchronous operation and its outcome
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	// NextAttemptAt is when a queued job may run, after the backoff of a
+	// failed attempt
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+// Finished reports whether the job will not run again
+func (j Job) Finished() bool {
+	return j.Status == Succeeded || j.Status == Failed || j.Status == Canceled
+}
+
+// Handler runs a job with the payload it was enqueued with and returns its
+// result, encoded as JSON
+type Handler func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+// Type configures how the jobs of a type run
+type Type struct {
+	Handler Handler
+	// Concurrency is the number of jobs of the type run at a time
+	Concurrency int
+	// MaxAttempts is the number of attempts before a job fails
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled after each
+	// failed attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt, unbounded when zero
+	Timeout time.Duration
+}
+
+// DefaultType returns the default concurrency and retry policy of a handler
+func DefaultType(handler Handler) Type {
+	return Type{
+		Handler:     handler,
+		Concurrency: 1,
+		MaxAttempts: 3,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  10 * time.Minute,
+	}
+}
+
+func (t Type) withDefaults() Type {
+	defaults := DefaultType(t.Handler)
+	if t.Concurrency <= 0 {
+		t.Concurrency = defaults.Concurrency
+	}
+	if t.MaxAttempts <= 0 {
+		t.MaxAttempts = defaults.MaxAttempts
+	}
+	if t.Backoff <= 0 {
+		t.Backoff = defaults.Backoff
+	}
+	if t.MaxBackoff < t.Backoff {
+		t.MaxBackoff = t.Backoff
+	}
+	return t
+}
+
+// backoff returns the delay after a job's failed attempt
+func (t Type) backoff(attempts int) time.Duration {
+	delay := t.Backoff
+	for i := 1; i < attempts && delay < t.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > t.MaxBackoff {
+		delay = t.MaxBackoff
+	}
+	return delay
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix, failing the job at once
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Queue runs jobs from a store. Jobs found running when the queue is
+// created were interrupted by a restart and are queued again; the attempt
+// counts, so a job that keeps crashing the engine eventually fails.
+type Queue struct {
+	store   Store
+	history int
+	types   map[string]Type
+	jobs    map[string]*Job
+	running map[string]int
+	cancels map[string]context.CancelFunc
+	// canceled holds the running jobs canceled through Cancel
+	canceled map[string]bool
+	stopping bool
+	wake     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// New loads the jobs of a store, keeping up to history finished jobs
+func New(store Store, history int) (*Queue, error) {
+	stored, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if history <= 0 {
+		history = 1000
+	}
+	q := &Queue{
+		store:    store,
+		history:  history,
+		types:    make(map[string]Type),
+		jobs:     make(map[string]*Job),
+		running:  make(map[string]int),
+		cancels:  make(map[string]context.CancelFunc),
+		canceled: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+	for i := range stored {
+		job := stored[i]
+		if job.Status == Running {
+			job.Status = Queued
+			job.Error = "interrupted by a restart"
+			if job.Attempts >= job.MaxAttempts {
+				job.Status = Failed
+			}
+		}
+		if job.Finished() && job.FinishedAt == nil {
+			finished := time.Now()
+			job.FinishedAt = &finished
+		}
+		if job.Status != stored[i].Status {
+			if err := store.Save(job); err != nil {
+				return nil, err
+			}
+		}
+		q.jobs[job.ID] = &job
+	}
+	q.prune()
+	return q, nil
+}
+
+// Register sets how the jobs of a type run
+func (q *Queue) Register(jobType string, t Type) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.types[jobType] = t.withDefaults()
+	q.notify()
+}
+
+// Enqueue stores a new job of a type with a payload encoded as JSON
+func (q *Queue) Enqueue(jobType string, payload interface{}) (Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, exists := q.types[jobType]
+	if !exists {
+		return Job{}, fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+	now := time.Now()
+	job := &Job{
+		ID:            id,
+		Type:          jobType,
+		Status:        Queued,
+		Payload:       data,
+		MaxAttempts:   t.MaxAttempts,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	if err := q.store.Save(*job); err != nil {
+		return Job{}, err
+	}
+	q.jobs[id] = job
+	q.notify()
+	return *job, nil
+}
+
+// Get returns a job
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, exists := q.jobs[id]
+	if !exists {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns the jobs with a status and type, any when empty, most
+// recently created first, up to limit jobs when positive
+func (q *Queue) List(status, jobType string, limit int) []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if (status == "" || job.Status == status) && (jobType == "" || job.Type == jobType) {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs
+}
+
+// Cancel cancels a queued job, or the context of a running one
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, exists := q.jobs[id]
+	if !exists {
+		return Job{}, ErrNotFound
+	}
+	switch job.Status {
+	case Queued:
+		now := time.Now()
+		job.Status = Canceled
+		job.FinishedAt = &now
+		q.save(job)
+		q.prune()
+	case Running:
+		q.canceled[id] = true
+		q.cancels[id]()
+	default:
+		return *job, ErrFinished
+	}
+	return *job, nil
+}
+
+// Start runs the queued jobs until stop is closed. Running jobs are then
+// canceled and queued again, to resume after a restart.
+func (q *Queue) Start(stop <-chan struct{}) {
+	for {
+		wait := q.dispatch()
+		timer := time.NewTimer(wait)
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			q.shutdown()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// dispatch starts the jobs that are due, oldest first, within the
+// concurrency limit of their type. It returns how long until the next
+// queued job is due.
+func (q *Queue) dispatch() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := make([]*Job, 0)
+	for _, job := range q.jobs {
+		if job.Status == Queued {
+			queued = append(queued, job)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].CreatedAt.Before(queued[j].CreatedAt) })
+
+	now := time.Now()
+	wait := time.Minute
+	for _, job := range queued {
+		t, exists := q.types[job.Type]
+		if !exists {
+			continue
+		}
+		if due := job.NextAttemptAt.Sub(now); due > 0 {
+			if due < wait {
+				wait = due
+			}
+			continue
+		}
+		if q.running[job.Type] < t.Concurrency {
+			q.run(job, t)
+		}
+	}
+	return wait
+}
+
+// run starts an attempt of a job
+func (q *Queue) run(job *Job, t Type) {
+	now := time.Now()
+	job.Status = Running
+	job.Attempts++
+	job.StartedAt = &now
+	q.save(job)
+	q.running[job.Type]++
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), t.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	q.cancels[job.ID] = cancel
+	q.wg.Add(1)
+	go func(id string, payload json.RawMessage) {
+		defer q.wg.Done()
+		defer cancel()
+		result, err := call(ctx, t.Handler, payload)
+		q.finish(id, t, result, err)
+	}(job.ID, job.Payload)
+}
+
+// call runs a handler, turning a panic into a permanent error
+func call(ctx context.Context, handler Handler, payload json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("job panicked: %v", r))
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// finish records the outcome of an attempt
+func (q *Queue) finish(id string, t Type, result interface{}, err error) {
+	var encoded json.RawMessage
+	if err == nil && result != nil {
+		encoded, err = json.Marshal(result)
+		if err != nil {
+			err = Permanent(fmt.Errorf("encoding result: %w", err))
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.jobs[id]
+	q.running[job.Type]--
+	delete(q.cancels, id)
+	canceled := q.canceled[id]
+	delete(q.canceled, id)
+
+	now := time.Now()
+	var permanent permanentError
+	switch {
+	case err == nil:
+		job.Status = Succeeded
+		job.Result = encoded
+		job.Error = ""
+	case canceled:
+		job.Status = Canceled
+		job.Error = err.Error()
+	case q.stopping:
+		// Not the job's fault: the attempt does not count
+		job.Status = Queued
+		job.Attempts--
+		job.Error = "interrupted by shutdown"
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		job.Status = Failed
+		job.Error = err.Error()
+		log.Printf("Job %s (%s) failed after %d attempts: %v", job.ID, job.Type, job.Attempts, err)
+	default:
+		job.Status = Queued
+		job.Error = err.Error()
+		job.NextAttemptAt = now.Add(t.backoff(job.Attempts))
+	}
+	if job.Finished() {
+		job.FinishedAt = &now
+	}
+	q.save(job)
+	q.prune()
+	q.notify()
+}
+
+// shutdown cancels the running jobs and waits for them to return
+func (q *Queue) shutdown() {
+	q.mu.Lock()
+	q.stopping = true
+	for _, cancel := range q.cancels {
+		cancel()
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// save persists a job, logging failures: the job carries on in memory
+func (q *Queue) save(job *Job) {
+	if err := q.store.Save(*job); err != nil {
+		log.Printf("Failed to save job %s: %v", job.ID, err)
+	}
+}
+
+// prune deletes the oldest finished jobs beyond the history size
+func (q *Queue) prune() {
+	finished := make([]*Job, 0)
+	for _, job := range q.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= q.history {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].FinishedAt.After(*finished[j].FinishedAt) })
+	for _, job := range finished[q.history:] {
+		delete(q.jobs, job.ID)
+		if err := q.store.Delete(job.ID); err != nil {
+			log.Printf("Failed to delete job %s: %v", job.ID, err)
+		}
+	}
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return "job-" + hex.EncodeToString(id), nil
+}
@@ -0,0 +1,234 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// start runs a queue until the test ends
+func start(t *testing.T, q *jobs.Queue) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		q.Start(stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+func waitFor(t *testing.T, q *jobs.Queue, id, status string) jobs.Job {
+	var job jobs.Job
+	require.Eventually(t, func() bool {
+		job, _ = q.Get(id)
+		return job.Status == status
+	}, 2*time.Second, 5*time.Millisecond, "job %s never became %s", id, status)
+	return job
+}
+
+func TestQueue_RunsAndRetries(t *testing.T) {
+	q, err := jobs.New(jobs.NewMemoryStore(), 10)
+	require.NoError(t, err)
+
+	var attempts atomic.Int32
+	q.Register("train", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			if attempts.Add(1) < 3 {
+				return nil, errors.New("model not ready")
+			}
+			var req struct{ Epochs int }
+			require.NoError(t, json.Unmarshal(payload, &req))
+			return map[string]int{"epochs": req.Epochs}, nil
+		},
+		MaxAttempts: 3,
+		Backoff:     5 * time.Millisecond,
+	})
+	start(t, q)
+
+	queued, err := q.Enqueue("train", map[string]int{"Epochs": 4})
+	require.NoError(t, err)
+	assert.Equal(t, jobs.Queued, queued.Status)
+
+	job := waitFor(t, q, queued.ID, jobs.Succeeded)
+	assert.Equal(t, 3, job.Attempts)
+	assert.JSONEq(t, `{"epochs": 4}`, string(job.Result))
+	assert.Empty(t, job.Error)
+	assert.NotNil(t, job.FinishedAt)
+
+	_, err = q.Enqueue("export", nil)
+	assert.ErrorIs(t, err, jobs.ErrUnknownType)
+}
+
+func TestQueue_FailsAfterMaxAttempts(t *testing.T) {
+	q, err := jobs.New(jobs.NewMemoryStore(), 10)
+	require.NoError(t, err)
+	q.Register("replay", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			return nil, errors.New("audit store unavailable")
+		},
+		MaxAttempts: 2,
+		Backoff:     5 * time.Millisecond,
+	})
+	q.Register("import", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			return nil, jobs.Permanent(errors.New("invalid rule file"))
+		},
+		MaxAttempts: 5,
+	})
+	start(t, q)
+
+	replay, err := q.Enqueue("replay", nil)
+	require.NoError(t, err)
+	job := waitFor(t, q, replay.ID, jobs.Failed)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "audit store unavailable", job.Error)
+
+	imported, err := q.Enqueue("import", nil)
+	require.NoError(t, err)
+	job = waitFor(t, q, imported.ID, jobs.Failed)
+	assert.Equal(t, 1, job.Attempts, "permanent errors are not retried")
+
+	assert.Len(t, q.List(jobs.Failed, "", 0), 2)
+	assert.Len(t, q.List("", "import", 0), 1)
+}
+
+func TestQueue_ConcurrencyLimit(t *testing.T) {
+	q, err := jobs.New(jobs.NewMemoryStore(), 10)
+	require.NoError(t, err)
+
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	q.Register("train", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			now := running.Add(1)
+			defer running.Add(-1)
+			for {
+				previous := peak.Load()
+				if now <= previous || peak.CompareAndSwap(previous, now) {
+					break
+				}
+			}
+			<-release
+			return nil, nil
+		},
+		Concurrency: 2,
+	})
+	start(t, q)
+
+	ids := make([]string, 5)
+	for i := range ids {
+		job, err := q.Enqueue("train", nil)
+		require.NoError(t, err)
+		ids[i] = job.ID
+	}
+	require.Eventually(t, func() bool { return len(q.List(jobs.Running, "", 0)) == 2 }, time.Second, 5*time.Millisecond)
+	close(release)
+	for _, id := range ids {
+		waitFor(t, q, id, jobs.Succeeded)
+	}
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	q, err := jobs.New(jobs.NewMemoryStore(), 10)
+	require.NoError(t, err)
+	q.Register("replay", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	start(t, q)
+
+	running, err := q.Enqueue("replay", nil)
+	require.NoError(t, err)
+	queued, err := q.Enqueue("replay", nil)
+	require.NoError(t, err)
+	waitFor(t, q, running.ID, jobs.Running)
+
+	job, err := q.Cancel(queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.Canceled, job.Status)
+	_, err = q.Cancel(running.ID)
+	require.NoError(t, err)
+	waitFor(t, q, running.ID, jobs.Canceled)
+
+	_, err = q.Cancel(running.ID)
+	assert.ErrorIs(t, err, jobs.ErrFinished)
+	_, err = q.Cancel("job-missing")
+	assert.ErrorIs(t, err, jobs.ErrNotFound)
+}
+
+func TestQueue_SurvivesRestarts(t *testing.T) {
+	store, err := jobs.OpenFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	q, err := jobs.New(store, 10)
+	require.NoError(t, err)
+	started := make(chan struct{})
+	q.Register("train", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		q.Start(stop)
+		close(done)
+	}()
+	interrupted, err := q.Enqueue("train", nil)
+	require.NoError(t, err)
+	<-started
+	close(stop)
+	<-done
+
+	// The job is queued again, without counting the interrupted attempt
+	restarted, err := jobs.New(store, 10)
+	require.NoError(t, err)
+	job, exists := restarted.Get(interrupted.ID)
+	require.True(t, exists)
+	assert.Equal(t, jobs.Queued, job.Status)
+	assert.Zero(t, job.Attempts)
+
+	restarted.Register("train", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			return "trained", nil
+		},
+	})
+	start(t, restarted)
+	job = waitFor(t, restarted, interrupted.ID, jobs.Succeeded)
+	assert.JSONEq(t, `"trained"`, string(job.Result))
+}
+
+func TestQueue_History(t *testing.T) {
+	q, err := jobs.New(jobs.NewMemoryStore(), 2)
+	require.NoError(t, err)
+	q.Register("train", jobs.Type{
+		Handler: func(ctx context.Context, payload json.RawMessage) (interface{}, error) { return nil, nil },
+	})
+	start(t, q)
+
+	var last string
+	for i := 0; i < 4; i++ {
+		job, err := q.Enqueue("train", nil)
+		require.NoError(t, err)
+		waitFor(t, q, job.ID, jobs.Succeeded)
+		last = job.ID
+	}
+	kept := q.List("", "", 0)
+	require.Len(t, kept, 2, "only the most recent finished jobs are kept")
+	assert.Equal(t, last, kept[0].ID)
+}
@@ -0,0 +1,182 @@
+// Package labels parses label files, such as the chargeback files issuers
+// send daily, into fraud labels of transactions. Files are CSV with a
+// header row or JSON Lines; rows that cannot be read are reported by line
+// rather than failing the whole file.
+package labels
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats of label files
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Label is the fraud label of a transaction read from a line of a file
+type Label struct {
+	Line          int    `json:"line"`
+	TransactionID string `json:"transaction_id"`
+	Fraud         bool   `json:"fraud"`
+}
+
+// RowError is a row of a file that was not applied
+type RowError struct {
+	Line          int    `json:"line"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	Error         string `json:"error"`
+}
+
+// ErrTooManyRows is returned for files with more rows than allowed
+var ErrTooManyRows = errors.New("label file has too many rows")
+
+// Format returns the format of a file from its content type or name, and
+// from its first character otherwise
+func Format(contentType, name string, data []byte) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"), strings.HasSuffix(name, ".csv"):
+		return FormatCSV
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"),
+		strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".ndjson"):
+		return FormatJSONL
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// Parse reads the labels of a file of up to maxRows rows, or any number
+// when zero. A row without a fraud value labels the transaction as fraud,
+// as every row of a chargeback file does.
+func Parse(data []byte, format string, maxRows int) ([]Label, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data, maxRows)
+	case FormatJSONL:
+		return parseJSONL(data, maxRows)
+	}
+	return nil, nil, fmt.Errorf("unknown label file format %q, must be csv or jsonl", format)
+}
+
+// parseCSV reads a CSV file whose header names a transaction_id column and
+// optionally a fraud column
+func parseCSV(data []byte, maxRows int) ([]Label, []RowError, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the header: %w", err)
+	}
+	idColumn, fraudColumn := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "transaction_id":
+			idColumn = i
+		case "fraud":
+			fraudColumn = i
+		}
+	}
+	if idColumn < 0 {
+		return nil, nil, errors.New("the header has no transaction_id column")
+	}
+
+	var parsed []Label
+	var rejected []RowError
+	for rows := 0; ; rows++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if maxRows > 0 && rows >= maxRows {
+			return nil, nil, fmt.Errorf("%w: more than %d", ErrTooManyRows, maxRows)
+		}
+		if err != nil {
+			rejected = append(rejected, RowError{Line: line, Error: err.Error()})
+			continue
+		}
+		if idColumn >= len(fields) || strings.TrimSpace(fields[idColumn]) == "" {
+			rejected = append(rejected, RowError{Line: line, Error: "missing transaction_id"})
+			continue
+		}
+		label := Label{Line: line, TransactionID: strings.TrimSpace(fields[idColumn]), Fraud: true}
+		if fraudColumn >= 0 && fraudColumn < len(fields) && strings.TrimSpace(fields[fraudColumn]) != "" {
+			fraud, err := parseFraud(fields[fraudColumn])
+			if err != nil {
+				rejected = append(rejected, RowError{Line: line, TransactionID: label.TransactionID, Error: err.Error()})
+				continue
+			}
+			label.Fraud = fraud
+		}
+		parsed = append(parsed, label)
+	}
+	return parsed, rejected, nil
+}
+
+// parseJSONL reads a file of one {"transaction_id", "fraud"} object per
+// line. Blank lines are skipped.
+func parseJSONL(data []byte, maxRows int) ([]Label, []RowError, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+
+	var parsed []Label
+	var rejected []RowError
+	rows := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if rows++; maxRows > 0 && rows > maxRows {
+			return nil, nil, fmt.Errorf("%w: more than %d", ErrTooManyRows, maxRows)
+		}
+		var row struct {
+			TransactionID string          `json:"transaction_id"`
+			Fraud         json.RawMessage `json:"fraud"`
+		}
+		if err := json.Unmarshal(text, &row); err != nil {
+			rejected = append(rejected, RowError{Line: line, Error: "invalid JSON"})
+			continue
+		}
+		if strings.TrimSpace(row.TransactionID) == "" {
+			rejected = append(rejected, RowError{Line: line, Error: "missing transaction_id"})
+			continue
+		}
+		label := Label{Line: line, TransactionID: strings.TrimSpace(row.TransactionID), Fraud: true}
+		if len(row.Fraud) > 0 && string(row.Fraud) != "null" {
+			fraud, err := parseFraud(strings.Trim(string(row.Fraud), `"`))
+			if err != nil {
+				rejected = append(rejected, RowError{Line: line, TransactionID: label.TransactionID, Error: err.Error()})
+				continue
+			}
+			label.Fraud = fraud
+		}
+		parsed = append(parsed, label)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return parsed, rejected, nil
+}
+
+// parseFraud reads a fraud value: true or false, 1 or 0, yes or no, or
+// fraud or legitimate
+func parseFraud(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes", "fraud":
+		return true, nil
+	case "false", "0", "no", "legit", "legitimate":
+		return false, nil
+	}
+	return false, fmt.Errorf("fraud must be true or false, got %q", value)
+}
@@ -0,0 +1,72 @@
+package labels_test
+
+import (
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_CSV(t *testing.T) {
+	file := "Transaction_ID,amount,fraud\n" +
+		"TX-1,10.00,true\n" +
+		"TX-2,5.00,legitimate\n" +
+		",3.00,true\n" +
+		"TX-4,1.00,maybe\n" +
+		"TX-5,2.00\n"
+
+	parsed, rejected, err := labels.Parse([]byte(file), labels.FormatCSV, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []labels.Label{
+		{Line: 2, TransactionID: "TX-1", Fraud: true},
+		{Line: 3, TransactionID: "TX-2", Fraud: false},
+		{Line: 6, TransactionID: "TX-5", Fraud: true},
+	}, parsed, "rows without a fraud value are fraud")
+	require.Len(t, rejected, 2)
+	assert.Equal(t, labels.RowError{Line: 4, Error: "missing transaction_id"}, rejected[0])
+	assert.Equal(t, 5, rejected[1].Line)
+	assert.Equal(t, "TX-4", rejected[1].TransactionID)
+
+	_, _, err = labels.Parse([]byte("id,fraud\nTX-1,true\n"), labels.FormatCSV, 0)
+	assert.Error(t, err, "the transaction_id column is required")
+}
+
+func TestParse_JSONL(t *testing.T) {
+	file := `{"transaction_id": "TX-1", "fraud": false}
+{"transaction_id": "TX-2"}
+
+{"transaction_id": "TX-3", "fraud": "yes"}
+not json
+{"fraud": true}
+`
+	parsed, rejected, err := labels.Parse([]byte(file), labels.FormatJSONL, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []labels.Label{
+		{Line: 1, TransactionID: "TX-1", Fraud: false},
+		{Line: 2, TransactionID: "TX-2", Fraud: true},
+		{Line: 4, TransactionID: "TX-3", Fraud: true},
+	}, parsed)
+	assert.Equal(t, []labels.RowError{
+		{Line: 5, Error: "invalid JSON"},
+		{Line: 6, Error: "missing transaction_id"},
+	}, rejected)
+}
+
+func TestParse_MaxRows(t *testing.T) {
+	_, _, err := labels.Parse([]byte("transaction_id\nTX-1\nTX-2\nTX-3\n"), labels.FormatCSV, 2)
+	assert.ErrorIs(t, err, labels.ErrTooManyRows)
+	_, _, err = labels.Parse([]byte("{\"transaction_id\": \"TX-1\"}\n{\"transaction_id\": \"TX-2\"}\n"), labels.FormatJSONL, 2)
+	assert.NoError(t, err)
+
+	_, _, err = labels.Parse(nil, "xml", 0)
+	assert.Error(t, err)
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, labels.FormatCSV, labels.Format("text/csv; charset=utf-8", "", nil))
+	assert.Equal(t, labels.FormatJSONL, labels.Format("application/x-ndjson", "", nil))
+	assert.Equal(t, labels.FormatJSONL, labels.Format("", "s3://bank/chargebacks/2024-03-05.jsonl", nil))
+	assert.Equal(t, labels.FormatJSONL, labels.Format("application/octet-stream", "", []byte(`  {"transaction_id": "TX-1"}`)))
+	assert.Equal(t, labels.FormatCSV, labels.Format("", "", []byte("transaction_id\nTX-1\n")))
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+)
+
+// Engine holds the metrics of the scoring pipeline, labeled by rule ID and
+// model version so a regression can be traced to the rule or model behind it
+type Engine struct {
+	ruleEvaluations  *CounterVec
+	ruleHits         *CounterVec
+	ruleContribution *HistogramVec
+	ruleLatency      *HistogramVec
+
+	modelPredictions *CounterVec
+	modelErrors      *CounterVec
+	modelLatency     *HistogramVec
+	modelScores      *HistogramVec
+
+	decisions      *CounterVec
+	riskScores     *HistogramVec
+	scoringLatency *HistogramVec
+	sampledOut     *CounterVec
+	quarantines    *CounterVec
+	coalesced      *CounterVec
+
+	auditBatches      *CounterVec
+	auditDropped      *CounterVec
+	auditWriteLatency *HistogramVec
+
+	requests       *CounterVec
+	requestLatency *HistogramVec
+
+	reviewResolutions *CounterVec
+	reviewTimeInQueue *HistogramVec
+	reviewBreaches    *CounterVec
+
+	networkAlerts    *CounterVec
+	networkEscalated *CounterVec
+
+	scenarioAlerts *CounterVec
+}
+
+// NewEngine registers the pipeline metrics
+func NewEngine(r *Registry) *Engine {
+	return &Engine{
+		ruleEvaluations: r.NewCounterVec("fraud_rule_evaluations_total",
+			"Rule evaluations by rule ID.", "rule"),
+		ruleHits: r.NewCounterVec("fraud_rule_hits_total",
+			"Rule matches by rule ID.", "rule"),
+		ruleContribution: r.NewHistogramVec("fraud_rule_contribution",
+			"Score added by matching rules.", ScoreBuckets, "rule"),
+		ruleLatency: r.NewHistogramVec("fraud_rule_evaluation_seconds",
+			"Rule evaluation latency.", DefaultLatencyBuckets, "rule"),
+
+		modelPredictions: r.NewCounterVec("fraud_model_predictions_total",
+			"Transactions scored by model version and role (active or shadow).", "model_version", "role"),
+		modelErrors: r.NewCounterVec("fraud_model_errors_total",
+			"Failed model calls by model version and role.", "model_version", "role"),
+		modelLatency: r.NewHistogramVec("fraud_model_prediction_seconds",
+			"Model call latency by model version and role.", DefaultLatencyBuckets, "model_version", "role"),
+		modelScores: r.NewHistogramVec("fraud_model_score",
+			"Model scores by model version and role.", ScoreBuckets, "model_version", "role"),
+
+		decisions: r.NewCounterVec("fraud_decisions_total",
+			"Decisions by outcome and active model version.", "decision", "model_version"),
+		riskScores: r.NewHistogramVec("fraud_risk_score",
+			"Final risk scores by active model version.", ScoreBuckets, "model_version"),
+		scoringLatency: r.NewHistogramVec("fraud_scoring_seconds",
+			"End-to-end scoring latency by active model version.", DefaultLatencyBuckets, "model_version"),
+		sampledOut: r.NewCounterVec("fraud_audit_sampled_out_total",
+			"Clean approvals not saved to the audit store under sampling."),
+		quarantines: r.NewCounterVec("fraud_rule_quarantines_total",
+			"Rules quarantined for repeated panics or budget overruns.", "rule", "reason"),
+		coalesced: r.NewCounterVec("fraud_analyses_coalesced_total",
+			"Analyses that shared the scoring of the same transaction already in flight."),
+
+		auditBatches: r.NewCounterVec("fraud_audit_write_batches_total",
+			"Batched audit writes by result (ok or error).", "result"),
+		auditDropped: r.NewCounterVec("fraud_audit_dropped_records_total",
+			"Audit records dropped by batched writes, by reason (queue_full or sink_error).", "reason"),
+		auditWriteLatency: r.NewHistogramVec("fraud_audit_write_seconds",
+			"Latency of batched audit writes.", DefaultLatencyBuckets),
+
+		requests: r.NewCounterVec("fraud_http_requests_total",
+			"API requests by method, route pattern and status.", "method", "route", "status"),
+		requestLatency: r.NewHistogramVec("fraud_http_request_seconds",
+			"API request latency by method and route pattern.", DefaultLatencyBuckets, "method", "route"),
+
+		reviewResolutions: r.NewCounterVec("fraud_review_resolutions_total",
+			"Review cases resolved by tenant, resolution and resolver (analyst or sla).", "tenant", "resolution", "resolved_by"),
+		reviewTimeInQueue: r.NewHistogramVec("fraud_review_time_in_queue_seconds",
+			"Time review cases waited before they were resolved, by tenant.", QueueBuckets, "tenant"),
+		reviewBreaches: r.NewCounterVec("fraud_review_sla_breaches_total",
+			"Review cases that waited past their SLA, by tenant and expiry action.", "tenant", "action"),
+
+		networkAlerts: r.NewCounterVec("fraud_network_alerts_total",
+			"Accounts and devices risky at many merchants, by entity kind.", "kind"),
+		networkEscalated: r.NewCounterVec("fraud_network_escalations_total",
+			"Transactions escalated for a network alert on their account or device."),
+
+		scenarioAlerts: r.NewCounterVec("fraud_scenario_alerts_total",
+			"Scenario alert rules on aggregate decisions that fired or resolved, by scenario and status.", "scenario", "status"),
+	}
+}
+
+// ObserveRule records a rule evaluation
+func (m *Engine) ObserveRule(ruleID string, matched bool, contribution float64, elapsed time.Duration) {
+	m.ruleEvaluations.With(ruleID).Inc()
+	m.ruleLatency.With(ruleID).Observe(elapsed.Seconds())
+	if matched {
+		m.ruleHits.With(ruleID).Inc()
+		m.ruleContribution.With(ruleID).Observe(contribution)
+	}
+}
+
+// ObservePrediction records a model call
+func (m *Engine) ObservePrediction(version, role string, predictions []ml.Prediction, elapsed time.Duration, err error) {
+	m.modelLatency.With(version, role).Observe(elapsed.Seconds())
+	if err != nil {
+		m.modelErrors.With(version, role).Inc()
+		return
+	}
+	m.modelPredictions.With(version, role).Add(float64(len(predictions)))
+	scores := m.modelScores.With(version, role)
+	for _, prediction := range predictions {
+		scores.Observe(prediction.Score)
+	}
+}
+
+// ObserveDecision records a scored transaction
+func (m *Engine) ObserveDecision(decision, modelVersion string, riskScore float64, elapsed time.Duration) {
+	m.decisions.With(decision, modelVersion).Inc()
+	m.riskScores.With(modelVersion).Observe(riskScore)
+	m.scoringLatency.With(modelVersion).Observe(elapsed.Seconds())
+}
+
+// ObserveRequest records an API request
+func (m *Engine) ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	m.requests.With(method, route, strconv.Itoa(status)).Inc()
+	m.requestLatency.With(method, route).Observe(elapsed.Seconds())
+}
+
+// ObserveQuarantine records a quarantined rule
+func (m *Engine) ObserveQuarantine(ruleID, reason string) {
+	m.quarantines.With(ruleID, reason).Inc()
+}
+
+// ObserveAuditBatch records a batched audit write
+func (m *Engine) ObserveAuditBatch(saved int, elapsed time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.auditBatches.With(result).Inc()
+	m.auditWriteLatency.With().Observe(elapsed.Seconds())
+}
+
+// ObserveAuditDropped records audit records dropped by batched writes
+func (m *Engine) ObserveAuditDropped(reason string, records int) {
+	m.auditDropped.With(reason).Add(float64(records))
+}
+
+// ObserveNetworkAlert records an alert on an account or device, by the kind
+// of entity
+func (m *Engine) ObserveNetworkAlert(kind string) {
+	m.networkAlerts.With(kind).Inc()
+}
+
+// ObserveNetworkEscalation records a transaction escalated for a network
+// alert
+func (m *Engine) ObserveNetworkEscalation() {
+	m.networkEscalated.With().Inc()
+}
+
+// ObserveScenarioAlert records a scenario firing or resolved
+func (m *Engine) ObserveScenarioAlert(scenario, status string) {
+	m.scenarioAlerts.With(scenario, status).Inc()
+}
+
+// ObserveCoalesced records an analysis that shared an in-flight scoring
+func (m *Engine) ObserveCoalesced() {
+	m.coalesced.With().Inc()
+}
+
+// ObserveSampledOut records a decision that was not audited
+func (m *Engine) ObserveSampledOut() {
+	m.sampledOut.With().Inc()
+}
+
+// ObserveReviewResolved records a resolved review case
+func (m *Engine) ObserveReviewResolved(tenant, resolution, resolvedBy string, waited time.Duration) {
+	m.reviewResolutions.With(tenant, resolution, resolvedBy).Inc()
+	m.reviewTimeInQueue.With(tenant).Observe(waited.Seconds())
+}
+
+// ObserveReviewBreach records a review case past its SLA
+func (m *Engine) ObserveReviewBreach(tenant, action string) {
+	m.reviewBreaches.With(tenant, action).Inc()
+}
@@ -0,0 +1,321 @@
+// Package metrics implements labeled counters and histograms exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultLatencyBuckets are histogram buckets in seconds for in-process work
+var DefaultLatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// ScoreBuckets are histogram buckets for scores between 0 and 1
+var ScoreBuckets = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}
+
+// QueueBuckets are histogram buckets in seconds for work waiting on people,
+// from a minute to a day
+var QueueBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400}
+
+// collector is a metric family that can write itself
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry holds metric families and serves them to Prometheus
+type Registry struct {
+	families []collector
+	names    map[string]bool
+	mu       sync.Mutex
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = true
+	r.families = append(r.families, c)
+}
+
+// Write writes every metric family in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]collector(nil), r.families...)
+	r.mu.Unlock()
+
+	for _, family := range families {
+		if err := family.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
+
+// family holds the labeled series of a metric
+type family[T any] struct {
+	name   string
+	help   string
+	labels []string
+	series map[string]*T
+	values map[string][]string
+	create func() *T
+	mu     sync.RWMutex
+}
+
+func newFamily[T any](name, help string, labels []string, create func() *T) *family[T] {
+	return &family[T]{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+		create: create,
+	}
+}
+
+func (f *family[T]) with(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, exists := f.series[key]
+	f.mu.RUnlock()
+	if exists {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, exists := f.series[key]; exists {
+		return s
+	}
+	s = f.create()
+	f.series[key] = s
+	f.values[key] = append([]string(nil), values...)
+	return s
+}
+
+// each visits the series sorted by label values
+func (f *family[T]) each(fn func(labels string, s *T) error) error {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	f.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f.mu.RLock()
+		s, values := f.series[key], f.values[key]
+		f.mu.RUnlock()
+		if err := fn(formatLabels(f.labels, values), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family[T]) header(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, kind)
+	return err
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	bits uint64
+}
+
+// Inc adds one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds a non-negative value
+func (c *Counter) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&c.bits, old, updated) {
+			return
+		}
+	}
+}
+
+// Value returns the current value
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// CounterVec is a counter family partitioned by labels
+type CounterVec struct {
+	family *family[Counter]
+}
+
+// NewCounterVec registers a counter family
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{family: newFamily(name, help, labels, func() *Counter { return &Counter{} })}
+	r.register(name, v)
+	return v
+}
+
+// With returns the counter of the given label values
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.family.with(values)
+}
+
+func (v *CounterVec) write(w io.Writer) error {
+	if err := v.family.header(w, "counter"); err != nil {
+		return err
+	}
+	return v.family.each(func(labels string, c *Counter) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", v.family.name, labels, formatValue(c.Value()))
+		return err
+	})
+}
+
+// Histogram counts observations in buckets. Observations and scrapes only
+// use atomic operations, so scraping never holds up the scoring path.
+type Histogram struct {
+	upperBounds []float64
+	// counts holds the observations of each bucket alone, plus one for
+	// those above every bound; they are made cumulative when written
+	counts  []uint64
+	count   uint64
+	sumBits uint64
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, updated) {
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// histogramSnapshot is a histogram as of a scrape
+type histogramSnapshot struct {
+	cumulative []uint64
+	count      uint64
+	sum        float64
+}
+
+// snapshot reads the buckets. The count is the sum of the buckets read, so
+// the written histogram stays consistent with observations in flight.
+func (h *Histogram) snapshot() histogramSnapshot {
+	snapshot := histogramSnapshot{cumulative: make([]uint64, len(h.upperBounds))}
+	for i := range h.counts {
+		snapshot.count += atomic.LoadUint64(&h.counts[i])
+		if i < len(h.upperBounds) {
+			snapshot.cumulative[i] = snapshot.count
+		}
+	}
+	snapshot.sum = math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+	return snapshot
+}
+
+// HistogramVec is a histogram family partitioned by labels
+type HistogramVec struct {
+	family *family[Histogram]
+}
+
+// NewHistogramVec registers a histogram family with the given bucket upper
+// bounds
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	v := &HistogramVec{family: newFamily(name, help, labels, func() *Histogram {
+		return &Histogram{upperBounds: bounds, counts: make([]uint64, len(bounds)+1)}
+	})}
+	r.register(name, v)
+	return v
+}
+
+// With returns the histogram of the given label values
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.family.with(values)
+}
+
+func (v *HistogramVec) write(w io.Writer) error {
+	if err := v.family.header(w, "histogram"); err != nil {
+		return err
+	}
+	name := v.family.name
+	return v.family.each(func(labels string, h *Histogram) error {
+		snapshot := h.snapshot()
+		for i, bound := range h.upperBounds {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatValue(bound)), snapshot.cumulative[i]); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			name, withLabel(labels, "le", "+Inf"), snapshot.count,
+			name, labels, formatValue(snapshot.sum),
+			name, labels, snapshot.count)
+		return err
+	})
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends a label to formatted labels
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,66 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/metrics"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WritesPrometheusText(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.NewCounterVec("requests_total", "Requests.", "path")
+	histogram := registry.NewHistogramVec("latency_seconds", "Latency.", []float64{0.5, 0.1}, "path")
+
+	counter.With("/a").Inc()
+	counter.With("/a").Add(2)
+	counter.With(`/b"q`).Inc()
+	histogram.With("/a").Observe(0.05)
+	histogram.With("/a").Observe(0.3)
+	histogram.With("/a").Observe(2)
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	text := out.String()
+
+	assert.Contains(t, text, "# TYPE requests_total counter\n")
+	assert.Contains(t, text, `requests_total{path="/a"} 3`+"\n")
+	assert.Contains(t, text, `requests_total{path="/b\"q"} 1`+"\n")
+	assert.Contains(t, text, "# TYPE latency_seconds histogram\n")
+	assert.Contains(t, text, `latency_seconds_bucket{path="/a",le="0.1"} 1`+"\n")
+	assert.Contains(t, text, `latency_seconds_bucket{path="/a",le="0.5"} 2`+"\n")
+	assert.Contains(t, text, `latency_seconds_bucket{path="/a",le="+Inf"} 3`+"\n")
+	assert.Contains(t, text, `latency_seconds_sum{path="/a"} 2.35`+"\n")
+	assert.Contains(t, text, `latency_seconds_count{path="/a"} 3`+"\n")
+
+	assert.Panics(t, func() { counter.With("/a", "extra") })
+	assert.Panics(t, func() { registry.NewCounterVec("requests_total", "Again.") })
+}
+
+func TestEngine_LabelsByRuleAndModelVersion(t *testing.T) {
+	registry := metrics.NewRegistry()
+	engine := metrics.NewEngine(registry)
+
+	engine.ObserveRule("HIGH_AMOUNT", true, 0.3, time.Microsecond)
+	engine.ObserveRule("HIGH_AMOUNT", false, 0, time.Microsecond)
+	engine.ObservePrediction("v2.0.0", ml.RoleShadow, []ml.Prediction{{Score: 0.9}, {Score: 0.1}}, time.Millisecond, nil)
+	engine.ObservePrediction("v1.0.0", ml.RoleActive, nil, time.Millisecond, errors.New("down"))
+	engine.ObserveDecision("DECLINE", "v1.0.0", 0.85, time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	text := recorder.Body.String()
+
+	assert.Contains(t, text, `fraud_rule_evaluations_total{rule="HIGH_AMOUNT"} 2`)
+	assert.Contains(t, text, `fraud_rule_hits_total{rule="HIGH_AMOUNT"} 1`)
+	assert.Contains(t, text, `fraud_rule_contribution_count{rule="HIGH_AMOUNT"} 1`)
+	assert.Contains(t, text, `fraud_model_predictions_total{model_version="v2.0.0",role="shadow"} 2`)
+	assert.Contains(t, text, `fraud_model_errors_total{model_version="v1.0.0",role="active"} 1`)
+	assert.Contains(t, text, `fraud_decisions_total{decision="DECLINE",model_version="v1.0.0"} 1`)
+}
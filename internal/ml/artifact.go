@@ -0,0 +1,106 @@
+package ml
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Model artifact verification errors
+var (
+	ErrArtifactChecksum  = errors.New("model artifact checksum mismatch")
+	ErrArtifactSignature = errors.New("invalid model artifact signature")
+)
+
+// ArtifactKeys verify and decrypt model artifacts. With a SigningKey,
+// artifacts must carry the hex HMAC-SHA256 of their stored bytes. With an
+// EncryptionKey, 32 bytes, artifacts are sealed with AES-256-GCM, the nonce
+// first; the signature and checksum cover the sealed bytes.
+type ArtifactKeys struct {
+	SigningKey    []byte
+	EncryptionKey []byte
+}
+
+// OpenArtifact verifies the stored bytes of a model artifact against an
+// optional hex SHA-256 checksum and the signature, decrypts them, and loads
+// the model. Besides the built-in features, it may weigh the registered
+// features named in extra.
+func OpenArtifact(data []byte, checksum, signature string, keys ArtifactKeys, extra ...string) (*LinearModel, error) {
+	if checksum != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(strings.TrimPrefix(checksum, "sha256:"), hex.EncodeToString(sum[:])) {
+			return nil, ErrArtifactChecksum
+		}
+	}
+	if len(keys.SigningKey) > 0 {
+		if !hmac.Equal([]byte(strings.ToLower(strings.TrimSpace(signature))), []byte(SignArtifact(data, keys.SigningKey))) {
+			return nil, ErrArtifactSignature
+		}
+	}
+	if len(keys.EncryptionKey) > 0 {
+		opened, err := openSealed(data, keys.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		data = opened
+	}
+	return LoadModel(bytes.NewReader(data), extra...)
+}
+
+// SignArtifact returns the signature of the stored bytes of an artifact
+func SignArtifact(data, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SealArtifact encrypts an artifact with AES-256-GCM
+func SealArtifact(data, key []byte) ([]byte, error) {
+	aead, err := artifactCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func openSealed(data, key []byte) ([]byte, error) {
+	aead, err := artifactCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("model artifact is too short to be encrypted")
+	}
+	opened, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting model artifact: %w", err)
+	}
+	return opened, nil
+}
+
+func artifactCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("model encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// OpenArtifact opens a model artifact that may weigh the registered features
+func (e *MLEngine) OpenArtifact(data []byte, checksum, signature string, keys ArtifactKeys) (*LinearModel, error) {
+	return OpenArtifact(data, checksum, signature, keys, e.features.Names()...)
+}
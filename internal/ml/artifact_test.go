@@ -0,0 +1,58 @@
+package ml_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var artifact = []byte(`{"version": "v2.0.0", "bias": 0.05, "weights": {"high_amount": 0.4}}`)
+
+func TestOpenArtifact_Checksum(t *testing.T) {
+	sum := sha256.Sum256(artifact)
+
+	model, err := ml.OpenArtifact(artifact, "sha256:"+hex.EncodeToString(sum[:]), "", ml.ArtifactKeys{})
+	require.NoError(t, err)
+	assert.Equal(t, "v2.0.0", model.Version())
+
+	_, err = ml.OpenArtifact(artifact, hex.EncodeToString(make([]byte, 32)), "", ml.ArtifactKeys{})
+	assert.ErrorIs(t, err, ml.ErrArtifactChecksum)
+}
+
+func TestOpenArtifact_SignedAndEncrypted(t *testing.T) {
+	keys := ml.ArtifactKeys{SigningKey: []byte("signing"), EncryptionKey: make([]byte, 32)}
+	sealed, err := ml.SealArtifact(artifact, keys.EncryptionKey)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "high_amount")
+	signature := ml.SignArtifact(sealed, keys.SigningKey)
+
+	model, err := ml.OpenArtifact(sealed, "", signature+"\n", keys)
+	require.NoError(t, err)
+	assert.Equal(t, "v2.0.0", model.Version())
+
+	_, err = ml.OpenArtifact(sealed, "", ml.SignArtifact(artifact, keys.SigningKey), keys)
+	assert.ErrorIs(t, err, ml.ErrArtifactSignature)
+	_, err = ml.OpenArtifact(artifact, "", ml.SignArtifact(artifact, keys.SigningKey), keys)
+	assert.Error(t, err)
+
+	wrongKey := keys
+	wrongKey.EncryptionKey = append([]byte{1}, make([]byte, 31)...)
+	_, err = ml.OpenArtifact(sealed, "", signature, wrongKey)
+	assert.Error(t, err)
+}
+
+func TestMLEngine_UseModel(t *testing.T) {
+	engine := ml.NewMLEngine()
+	model, err := engine.OpenArtifact(artifact, "", "", ml.ArtifactKeys{})
+	require.NoError(t, err)
+
+	engine.UseModel(model)
+
+	assert.Equal(t, "v2.0.0", engine.ActiveVersion())
+	_, err = engine.FeatureImportance("v2.0.0")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,143 @@
+package ml
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Prediction is the model output for one transaction
+type Prediction struct {
+	Score      float64 `json:"score"`
+	Confidence float64 `json:"confidence"`
+	// Tier is the feature tier the prediction was made with, set by the
+	// engine
+	Tier string `json:"tier,omitempty"`
+	// Explanation attributes the score to the features, when the model
+	// explains its predictions
+	Explanation *Explanation `json:"explanation,omitempty"`
+}
+
+// Feature columns of the model
+const (
+	featureHighAmount = iota
+	featureVeryHighAmount
+	featureHighRiskCountry
+	featureRiskyType
+	featureRecent
+	featureRapidSuccession
+	featureAmountJump
+	featureMerchantRepeat
+	featureCorridorRisk
+	featureReputation
+	numFeatures
+)
+
+// featureWeights are the model coefficients, indexed by feature column
+var featureWeights = [numFeatures]float64{
+	featureHighAmount:      0.3,
+	featureVeryHighAmount:  0.2,
+	featureHighRiskCountry: 0.25,
+	featureRiskyType:       0.2,
+	featureRapidSuccession: 0.1,
+	featureAmountJump:      0.1,
+	featureMerchantRepeat:  0.1,
+	featureCorridorRisk:    0.2,
+	featureReputation:      0.2,
+}
+
+// Sequence feature thresholds
+const (
+	rapidSuccessionSeconds = 60
+	amountJumpFactor       = 3
+	merchantRepeatCap      = 5
+)
+
+// recentJitter bounds the random variance added to recent transactions
+const recentJitter = 0.1
+
+var highRiskCountries = map[string]bool{"NG": true, "CN": true, "RU": true, "PK": true}
+
+// featureMatrix holds the features of a batch in a single row-major slice
+type featureMatrix struct {
+	rows   int
+	values []float64
+}
+
+func (m featureMatrix) row(i int) []float64 {
+	return m.values[i*numFeatures : (i+1)*numFeatures]
+}
+
+// extractFeatures builds the feature matrix of a batch of transactions
+func extractFeatures(transactions []*detector.Transaction) featureMatrix {
+	m := featureMatrix{
+		rows:   len(transactions),
+		values: make([]float64, len(transactions)*numFeatures),
+	}
+	recentAfter := time.Now().Add(-time.Hour)
+
+	for i, tx := range transactions {
+		row := m.row(i)
+		row[featureHighAmount] = indicator(tx.Amount > 10000)
+		row[featureVeryHighAmount] = indicator(tx.Amount > 50000)
+		row[featureHighRiskCountry] = indicator(highRiskCountries[tx.Location.Country])
+		row[featureRiskyType] = indicator(tx.Type == "cash_advance" || detector.IsCrypto(tx))
+		row[featureRecent] = indicator(tx.Timestamp.After(recentAfter))
+		row[featureCorridorRisk] = tx.CorridorRisk
+		row[featureReputation] = tx.Reputation.Max()
+
+		if sequence := tx.Sequence; sequence.HasPrevious {
+			previous := tx.Amount - sequence.AmountDelta
+			row[featureRapidSuccession] = indicator(sequence.SecondsSincePrevious < rapidSuccessionSeconds)
+			row[featureAmountJump] = indicator(previous > 0 && tx.Amount > amountJumpFactor*previous)
+			row[featureMerchantRepeat] = math.Min(float64(sequence.SameMerchantRepeats)/merchantRepeatCap, 1)
+		}
+	}
+	return m
+}
+
+// score applies the built-in model to a row of the matrix, returning the
+// score and the contribution of every feature to it
+func (m featureMatrix) score(i int) (float64, []float64) {
+	row := m.row(i)
+	contributions := make([]float64, numFeatures)
+	score := 0.0
+	for j, weight := range featureWeights {
+		contributions[j] = weight * row[j]
+	}
+	// Recent transaction, add some random variance
+	contributions[featureRecent] = row[featureRecent] * rand.Float64() * recentJitter
+	for _, contribution := range contributions {
+		score += contribution
+	}
+	return clamp(score), contributions
+}
+
+// PredictBatch predicts the fraud probability of a batch of transactions in
+// one model call. Predictions are returned in input order.
+func (e *MLEngine) PredictBatch(transactions []*detector.Transaction) ([]Prediction, error) {
+	if !e.ready {
+		return nil, ErrNotReady
+	}
+	return e.predict(transactions)
+}
+
+func indicator(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// clamp ensures a score is between 0 and 1
+func clamp(score float64) float64 {
+	if score > 1.0 {
+		return 1.0
+	}
+	if score < 0.0 {
+		return 0.0
+	}
+	return score
+}
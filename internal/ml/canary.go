@@ -0,0 +1,310 @@
+package ml
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// CanaryConfig controls how a candidate model is soaked before promotion
+type CanaryConfig struct {
+	// Percent of live predictions also scored by the candidate, 0-100
+	Percent    float64
+	SoakPeriod time.Duration
+	// MinSamples shadow predictions are needed before the candidate is
+	// judged, either way
+	MinSamples      int
+	MaxErrorRate    float64
+	MaxLatencyRatio float64 // candidate over active mean latency
+}
+
+// DefaultCanaryConfig returns the default canary settings
+func DefaultCanaryConfig() CanaryConfig {
+	return CanaryConfig{
+		Percent:         5,
+		SoakPeriod:      time.Hour,
+		MinSamples:      100,
+		MaxErrorRate:    0.01,
+		MaxLatencyRatio: 1.5,
+	}
+}
+
+func (c CanaryConfig) withDefaults() CanaryConfig {
+	defaults := DefaultCanaryConfig()
+	if c.Percent <= 0 {
+		c.Percent = defaults.Percent
+	}
+	if c.Percent > 100 {
+		c.Percent = 100
+	}
+	if c.SoakPeriod <= 0 {
+		c.SoakPeriod = defaults.SoakPeriod
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = defaults.MinSamples
+	}
+	if c.MaxErrorRate <= 0 {
+		c.MaxErrorRate = defaults.MaxErrorRate
+	}
+	if c.MaxLatencyRatio <= 0 {
+		c.MaxLatencyRatio = defaults.MaxLatencyRatio
+	}
+	return c
+}
+
+// Canary states
+const (
+	CanarySoaking    = "soaking"
+	CanaryPromoted   = "promoted"
+	CanaryRolledBack = "rolled_back"
+	CanaryAborted    = "aborted"
+)
+
+// CanaryStatus reports the progress of a candidate model
+type CanaryStatus struct {
+	Version       string     `json:"version"`
+	ActiveVersion string     `json:"active_version"`
+	State         string     `json:"state"`
+	Reason        string     `json:"reason,omitempty"`
+	Percent       float64    `json:"percent"`
+	SoakPeriod    string     `json:"soak_period"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+
+	Samples            int     `json:"samples"`
+	Errors             int     `json:"errors"`
+	ErrorRate          float64 `json:"error_rate"`
+	ActiveLatencyMs    float64 `json:"active_latency_ms"`
+	CandidateLatencyMs float64 `json:"candidate_latency_ms"`
+	// MeanScoreDelta is the mean absolute score difference to the active model
+	MeanScoreDelta float64 `json:"mean_score_delta"`
+}
+
+// shadowSample is a live prediction to replay against the candidate
+type shadowSample struct {
+	transactions []*detector.Transaction
+	active       []Prediction
+	latency      time.Duration
+}
+
+// canary shadow scores sampled live traffic with a candidate model. Shadow
+// predictions run on a background worker and are never served.
+type canary struct {
+	model    Model
+	config   CanaryConfig
+	samples  chan shadowSample
+	done     chan struct{}
+	observer PredictionObserver
+
+	mu               sync.Mutex
+	status           CanaryStatus
+	activeLatency    time.Duration
+	candidateLatency time.Duration
+	scoreDelta       float64
+	compared         int
+}
+
+// offer hands a live prediction to the canary if it is sampled. Samples are
+// dropped rather than slowing down live scoring when the worker lags behind.
+func (c *canary) offer(sample shadowSample) {
+	if rand.Float64()*100 >= c.config.Percent {
+		return
+	}
+	select {
+	case c.samples <- sample:
+	case <-c.done:
+	default:
+	}
+}
+
+// record scores a sample with the candidate and returns the resulting state
+func (c *canary) record(sample shadowSample) (string, string) {
+	start := time.Now()
+	predictions, err := c.model.PredictBatch(sample.transactions)
+	latency := time.Since(start)
+	if c.observer != nil {
+		c.observer.ObservePrediction(c.model.Version(), RoleShadow, predictions, latency, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Samples++
+	c.activeLatency += sample.latency
+	c.candidateLatency += latency
+	if err == nil && len(predictions) != len(sample.active) {
+		err = fmt.Errorf("candidate returned %d predictions for %d transactions", len(predictions), len(sample.active))
+	}
+	if err != nil {
+		c.status.Errors++
+	} else {
+		for i, prediction := range predictions {
+			c.scoreDelta += math.Abs(prediction.Score - sample.active[i].Score)
+			c.compared++
+		}
+	}
+	c.refresh()
+
+	if c.status.Samples < c.config.MinSamples {
+		return CanarySoaking, ""
+	}
+	if c.status.ErrorRate > c.config.MaxErrorRate {
+		return CanaryRolledBack, fmt.Sprintf("error rate %.4f exceeds %.4f", c.status.ErrorRate, c.config.MaxErrorRate)
+	}
+	if c.activeLatency > 0 {
+		if ratio := float64(c.candidateLatency) / float64(c.activeLatency); ratio > c.config.MaxLatencyRatio {
+			return CanaryRolledBack, fmt.Sprintf("latency ratio %.2f exceeds %.2f", ratio, c.config.MaxLatencyRatio)
+		}
+	}
+	if time.Since(c.status.StartedAt) >= c.config.SoakPeriod {
+		return CanaryPromoted, ""
+	}
+	return CanarySoaking, ""
+}
+
+// refresh recomputes the derived status fields. Callers hold c.mu.
+func (c *canary) refresh() {
+	samples := float64(c.status.Samples)
+	if samples == 0 {
+		return
+	}
+	c.status.ErrorRate = float64(c.status.Errors) / samples
+	c.status.ActiveLatencyMs = float64(c.activeLatency) / samples / float64(time.Millisecond)
+	c.status.CandidateLatencyMs = float64(c.candidateLatency) / samples / float64(time.Millisecond)
+	if c.compared > 0 {
+		c.status.MeanScoreDelta = c.scoreDelta / float64(c.compared)
+	}
+}
+
+func (c *canary) snapshot() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// finish stops the worker and returns the final status
+func (c *canary) finish(state, reason string) CanaryStatus {
+	close(c.done)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.State = state
+	c.status.Reason = reason
+	now := time.Now()
+	c.status.FinishedAt = &now
+	return c.status
+}
+
+// StartCanary loads a candidate model next to the active one. A share of
+// live predictions is shadow scored by the candidate; after the soak period
+// it is promoted, or rolled back early if its error rate or latency regress.
+func (e *MLEngine) StartCanary(model Model, config CanaryConfig) (CanaryStatus, error) {
+	if !e.ready {
+		return CanaryStatus{}, ErrNotReady
+	}
+	if model == nil {
+		return CanaryStatus{}, errors.New("candidate model is required")
+	}
+	config = config.withDefaults()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.canary != nil {
+		return CanaryStatus{}, fmt.Errorf("canary for model %s is already running", e.canary.model.Version())
+	}
+	if model.Version() == e.active.Version() {
+		return CanaryStatus{}, fmt.Errorf("model %s is already active", model.Version())
+	}
+
+	c := &canary{
+		model:    model,
+		config:   config,
+		samples:  make(chan shadowSample, 64),
+		done:     make(chan struct{}),
+		observer: e.observer,
+		status: CanaryStatus{
+			Version:       model.Version(),
+			ActiveVersion: e.active.Version(),
+			State:         CanarySoaking,
+			Percent:       config.Percent,
+			SoakPeriod:    config.SoakPeriod.String(),
+			StartedAt:     time.Now(),
+		},
+	}
+	e.canary = c
+	e.models[model.Version()] = model
+	go e.runCanary(c)
+
+	log.Printf("Canary started for model %s at %.1f%% of traffic", model.Version(), config.Percent)
+	return c.snapshot(), nil
+}
+
+// CanaryStatus returns the running canary, or the last one to finish
+func (e *MLEngine) CanaryStatus() (CanaryStatus, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.canary != nil {
+		return e.canary.snapshot(), true
+	}
+	if e.lastCanary != nil {
+		return *e.lastCanary, true
+	}
+	return CanaryStatus{}, false
+}
+
+// AbortCanary stops the running canary without promoting it
+func (e *MLEngine) AbortCanary() (CanaryStatus, error) {
+	e.mu.RLock()
+	c := e.canary
+	e.mu.RUnlock()
+
+	if c == nil {
+		return CanaryStatus{}, errors.New("no canary is running")
+	}
+	status, _ := e.finishCanary(c, CanaryAborted, "aborted by operator")
+	return status, nil
+}
+
+func (e *MLEngine) runCanary(c *canary) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case sample := <-c.samples:
+			if state, reason := c.record(sample); state != CanarySoaking {
+				e.finishCanary(c, state, reason)
+				return
+			}
+		}
+	}
+}
+
+// finishCanary ends a canary, promoting its model when the state says so.
+// It reports false when the canary had already finished.
+func (e *MLEngine) finishCanary(c *canary, state, reason string) (CanaryStatus, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.canary != c {
+		return c.snapshot(), false
+	}
+	if state == CanaryPromoted {
+		e.active = c.model
+		e.lastUpdate = time.Now()
+	}
+	status := c.finish(state, reason)
+	e.canary = nil
+	e.lastCanary = &status
+
+	log.Printf("Canary for model %s %s after %d samples (error rate %.4f, mean score delta %.4f) %s",
+		status.Version, state, status.Samples, status.ErrorRate, status.MeanScoreDelta, reason)
+	return status, true
+}
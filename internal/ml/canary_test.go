@@ -0,0 +1,138 @@
+package ml_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingModel struct{}
+
+func (failingModel) Version() string { return "v-broken" }
+
+func (failingModel) PredictBatch([]*detector.Transaction) ([]ml.Prediction, error) {
+	return nil, errors.New("model crashed")
+}
+
+func candidate(t *testing.T) *ml.LinearModel {
+	model, err := ml.LoadModel(strings.NewReader(`{
+		"version": "v2.0.0",
+		"bias": 0.05,
+		"weights": {"high_amount": 0.4, "high_risk_country": 0.3}
+	}`))
+	require.NoError(t, err)
+	return model
+}
+
+func transaction() *detector.Transaction {
+	return &detector.Transaction{
+		ID:        "TXN-1",
+		Amount:    12000,
+		Location:  detector.Location{Country: "NG"},
+		Timestamp: time.Now().Add(-24 * time.Hour),
+	}
+}
+
+func TestLoadModel(t *testing.T) {
+	model := candidate(t)
+	assert.Equal(t, "v2.0.0", model.Version())
+
+	predictions, err := model.PredictBatch([]*detector.Transaction{transaction()})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.75, predictions[0].Score, 1e-9)
+
+	_, err = ml.LoadModel(strings.NewReader(`{"version": "v3", "weights": {"shoe_size": 1}}`))
+	assert.Error(t, err)
+	_, err = ml.LoadModel(strings.NewReader(`{"weights": {}}`))
+	assert.Error(t, err)
+}
+
+func TestCanary_Promotes(t *testing.T) {
+	engine := ml.NewMLEngine()
+	_, err := engine.StartCanary(candidate(t), ml.CanaryConfig{
+		Percent:         100,
+		SoakPeriod:      time.Nanosecond,
+		MinSamples:      3,
+		MaxLatencyRatio: 1e6,
+	})
+	require.NoError(t, err)
+
+	_, err = engine.StartCanary(candidate(t), ml.CanaryConfig{})
+	assert.Error(t, err, "only one canary runs at a time")
+
+	assert.Eventually(t, func() bool {
+		score, _, err := engine.PredictFraud(transaction())
+		if err != nil {
+			return false
+		}
+		status, _ := engine.CanaryStatus()
+		return status.State == ml.CanaryPromoted && score == 0.75
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Equal(t, "v2.0.0", engine.GetModelInfo()["version"])
+}
+
+func TestCanary_RollsBackOnErrors(t *testing.T) {
+	engine := ml.NewMLEngine()
+	_, err := engine.StartCanary(failingModel{}, ml.CanaryConfig{
+		Percent:    100,
+		SoakPeriod: time.Hour,
+		MinSamples: 3,
+	})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		// Candidate failures are never served
+		if _, _, err := engine.PredictFraud(transaction()); err != nil {
+			return false
+		}
+		status, _ := engine.CanaryStatus()
+		return status.State == ml.CanaryRolledBack
+	}, 5*time.Second, time.Millisecond)
+
+	status, _ := engine.CanaryStatus()
+	assert.Equal(t, status.Samples, status.Errors)
+	assert.Equal(t, ml.BuiltinVersion, engine.GetModelInfo()["version"])
+}
+
+func TestCanary_Abort(t *testing.T) {
+	engine := ml.NewMLEngine()
+	_, err := engine.AbortCanary()
+	assert.Error(t, err)
+
+	_, err = engine.StartCanary(candidate(t), ml.CanaryConfig{})
+	require.NoError(t, err)
+
+	status, err := engine.AbortCanary()
+	require.NoError(t, err)
+	assert.Equal(t, ml.CanaryAborted, status.State)
+	assert.Equal(t, ml.BuiltinVersion, engine.GetModelInfo()["version"])
+}
+
+func TestLinearModel_SequenceFeatures(t *testing.T) {
+	model, err := ml.LoadModel(strings.NewReader(`{
+		"version": "v2.1.0",
+		"weights": {"rapid_succession": 0.3, "amount_jump": 0.2, "merchant_repeat": 0.5}
+	}`))
+	require.NoError(t, err)
+
+	first := transaction()
+	burst := transaction()
+	burst.Sequence = detector.SequenceFeatures{
+		HasPrevious:          true,
+		SecondsSincePrevious: 10,
+		AmountDelta:          9000, // previous amount was 3000
+		SameMerchantRepeats:  2,
+	}
+
+	predictions, err := model.PredictBatch([]*detector.Transaction{first, burst})
+	require.NoError(t, err)
+	assert.Zero(t, predictions[0].Score)
+	assert.InDelta(t, 0.7, predictions[1].Score, 1e-9)
+}
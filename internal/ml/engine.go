@@ -2,17 +2,45 @@ package ml
 
 import (
 	"errors"
-	"math/rand"
+	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
 )
 
+// ErrNotReady is returned while the ML engine has no model loaded
+var ErrNotReady = errors.New("ML engine not ready")
+
 // MLEngine represents the machine learning engine for fraud detection
 type MLEngine struct {
 	ready      bool
 	modelPath  string
 	lastUpdate time.Time
+
+	active     Model
+	canary     *canary
+	lastCanary *CanaryStatus
+	faultHook  func() error
+	observer   PredictionObserver
+	features   *FeatureBuilder
+	online     *OnlineModel
+	// models holds every model loaded, by version
+	models map[string]Model
+	mu     sync.RWMutex
+}
+
+// Roles of a model in predictions
+const (
+	RoleActive = "active"
+	RoleShadow = "shadow"
+)
+
+// PredictionObserver is notified of every model call, with the predictions
+// or the error. Shadow predictions of a canary are reported as RoleShadow.
+type PredictionObserver interface {
+	ObservePrediction(version, role string, predictions []Prediction, elapsed time.Duration, err error)
 }
 
 // NewMLEngine creates a new ML engine instance
@@ -21,6 +49,9 @@ func NewMLEngine() *MLEngine {
 		ready:      true, // Simulate ready state
 		modelPath:  "/tmp/fraud_model.bin",
 		lastUpdate: time.Now(),
+		active:     builtinModel{},
+		features:   NewFeatureBuilder(0),
+		models:     map[string]Model{BuiltinVersion: builtinModel{}},
 	}
 }
 
@@ -31,78 +62,193 @@ func (e *MLEngine) IsReady() bool {
 
 // PredictFraud predicts the fraud probability for a transaction
 func (e *MLEngine) PredictFraud(transaction *detector.Transaction) (float64, float64, error) {
-	if !e.ready {
-		return 0, 0, errors.New("ML engine not ready")
+	prediction, err := e.Predict(transaction)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	// Simulate ML prediction based on transaction features
-	score := e.calculateMLScore(transaction)
-	confidence := 0.85 + rand.Float64()*0.1 // 85-95% confidence
-
-	return score, confidence, nil
+	return prediction.Score, prediction.Confidence, nil
 }
 
-// TrainModel triggers model retraining
-func (e *MLEngine) TrainModel() error {
+// Predict scores a transaction
+func (e *MLEngine) Predict(transaction *detector.Transaction) (Prediction, error) {
 	if !e.ready {
-		return errors.New("ML engine not ready")
+		return Prediction{}, ErrNotReady
 	}
 
-	// Simulate training process
-	e.lastUpdate = time.Now()
-	return nil
-}
+	predictions, err := e.predict([]*detector.Transaction{transaction})
+	if err != nil {
+		return Prediction{}, err
+	}
 
-// calculateMLScore simulates ML-based fraud scoring
-func (e *MLEngine) calculateMLScore(transaction *detector.Transaction) float64 {
-	score := 0.0
+	return predictions[0], nil
+}
 
-	// Simulate feature-based scoring
-	if transaction.Amount > 10000 {
-		score += 0.3
+// predict builds the registered features, scores transactions with the
+// active model and offers the prediction to the canary, if one is running
+func (e *MLEngine) predict(transactions []*detector.Transaction) ([]Prediction, error) {
+	e.mu.RLock()
+	active, candidate, faultHook, observer := e.active, e.canary, e.faultHook, e.observer
+	e.mu.RUnlock()
+
+	start := time.Now()
+	tier := e.features.Build(transactions)
+	var predictions []Prediction
+	var err error
+	if faultHook != nil {
+		err = faultHook()
 	}
-	if transaction.Amount > 50000 {
-		score += 0.2
+	if err == nil {
+		predictions, err = active.PredictBatch(transactions)
 	}
-
-	// High-risk countries
-	highRiskCountries := []string{"NG", "CN", "RU", "PK"}
-	for _, country := range highRiskCountries {
-		if transaction.Location.Country == country {
-			score += 0.25
-			break
+	if err == nil && len(predictions) != len(transactions) {
+		err = fmt.Errorf("model %s returned %d predictions for %d transactions", active.Version(), len(predictions), len(transactions))
+	}
+	if observer != nil {
+		observer.ObservePrediction(active.Version(), RoleActive, predictions, time.Since(start), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range predictions {
+		predictions[i].Tier = tier
+		if predictions[i].Explanation != nil {
+			predictions[i].Explanation.Version = active.Version()
 		}
 	}
 
-	// Unusual transaction types
-	if transaction.Type == "cash_advance" || transaction.Type == "cryptocurrency" {
-		score += 0.2
+	if candidate != nil {
+		candidate.offer(shadowSample{
+			transactions: transactions,
+			active:       predictions,
+			latency:      time.Since(start),
+		})
 	}
+	return predictions, nil
+}
 
-	// Time-based features (simulate velocity checks)
-	now := time.Now()
-	if transaction.Timestamp.After(now.Add(-time.Hour)) {
-		// Recent transaction, add some random variance
-		score += rand.Float64() * 0.1
+// SetFaultHook sets a function run before every prediction, failing the
+// prediction when it returns an error. It is used for fault injection.
+func (e *MLEngine) SetFaultHook(hook func() error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.faultHook = hook
+}
+
+// ActiveVersion returns the version of the model serving predictions
+func (e *MLEngine) ActiveVersion() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.active.Version()
+}
+
+// UseModel makes a model the active one, without a canary
+func (e *MLEngine) UseModel(model Model) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.active = model
+	e.models[model.Version()] = model
+	e.lastUpdate = time.Now()
+}
+
+// Features returns the builder of the registered model features
+func (e *MLEngine) Features() *FeatureBuilder {
+	return e.features
+}
+
+// LoadModelFile reads a linear model artifact that may weigh the registered
+// features
+func (e *MLEngine) LoadModelFile(path string) (*LinearModel, error) {
+	return LoadModelFile(path, e.features.Names()...)
+}
+
+// SetPredictionObserver sets the observer of model calls
+func (e *MLEngine) SetPredictionObserver(observer PredictionObserver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.observer = observer
+}
+
+// EnableOnlineLearning makes an online model, learning from the labels
+// passed to Learn, the active model
+func (e *MLEngine) EnableOnlineLearning(config OnlineConfig) *OnlineModel {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.online = NewOnlineModel(config)
+	e.active = e.online
+	e.models[OnlineVersion] = e.online
+	e.lastUpdate = time.Now()
+	return e.online
+}
+
+// Learn updates the online model, if enabled, from the label of a
+// transaction. It reports whether the model learned the label.
+func (e *MLEngine) Learn(transaction *detector.Transaction, fraud bool) bool {
+	e.mu.RLock()
+	online := e.online
+	e.mu.RUnlock()
+
+	if online == nil {
+		return false
+	}
+	if online.Learn(transaction, fraud) {
+		status := online.Status()
+		log.Printf("Online model log loss regressed, rolled back to the checkpoint of %s (rollback %d)", status.LastCheckpoint.Format(time.RFC3339), status.Rollbacks)
 	}
 
-	// Ensure score is between 0 and 1
-	if score > 1.0 {
-		score = 1.0
+	e.mu.Lock()
+	e.lastUpdate = time.Now()
+	e.mu.Unlock()
+	return true
+}
+
+// OnlineStatus returns the state of the online model, if enabled
+func (e *MLEngine) OnlineStatus() (OnlineStatus, bool) {
+	e.mu.RLock()
+	online := e.online
+	e.mu.RUnlock()
+
+	if online == nil {
+		return OnlineStatus{}, false
 	}
-	if score < 0.0 {
-		score = 0.0
+	return online.Status(), true
+}
+
+// TrainModel triggers model retraining
+func (e *MLEngine) TrainModel() error {
+	if !e.ready {
+		return ErrNotReady
 	}
 
-	return score
+	// Simulate training process
+	e.mu.Lock()
+	e.lastUpdate = time.Now()
+	e.mu.Unlock()
+	return nil
 }
 
 // GetModelInfo returns information about the current model
 func (e *MLEngine) GetModelInfo() map[string]interface{} {
-	return map[string]interface{}{
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	info := map[string]interface{}{
 		"ready":       e.ready,
 		"model_path":  e.modelPath,
 		"last_update": e.lastUpdate,
-		"version":     "v1.0.0",
+		"version":     e.active.Version(),
+		"features":    e.features.Estimates(),
+	}
+	if e.canary != nil {
+		info["canary"] = e.canary.snapshot()
+	}
+	if e.online != nil {
+		info["online"] = e.online.Status()
 	}
+	return info
 }
\ No newline at end of file
@@ -0,0 +1,84 @@
+package ml
+
+import (
+	"math"
+	"sort"
+)
+
+// Feature directions of attributions
+const (
+	DirectionIncreases = "increases_risk"
+	DirectionDecreases = "decreases_risk"
+)
+
+// Attribution is how much a feature moved the score of a prediction from
+// the model's baseline
+type Attribution struct {
+	Feature      string  `json:"feature"`
+	Value        float64 `json:"value"`
+	Contribution float64 `json:"contribution" doc:"Score moved by the feature; the contributions add up to the score less the baseline"`
+	Direction    string  `json:"direction" doc:"increases_risk or decreases_risk"`
+}
+
+// Explanation attributes a prediction to the model features
+type Explanation struct {
+	// Version is the model version, set by the engine
+	Version  string  `json:"model_version"`
+	Baseline float64 `json:"baseline" doc:"Score of a transaction with every feature at zero"`
+	// Attributions are the features that moved the score, largest first
+	Attributions []Attribution `json:"attributions"`
+}
+
+// Top returns the explanation with its n largest attributions, or all of
+// them unless n is positive
+func (e *Explanation) Top(n int) *Explanation {
+	if e == nil || n <= 0 || len(e.Attributions) <= n {
+		return e
+	}
+	top := *e
+	top.Attributions = e.Attributions[:n]
+	return &top
+}
+
+// explain attributes score, less baseline, to the features given their
+// values and their contributions in the model's own units. Every feature
+// ranges from 0 to 1 with 0 as the baseline, so a linear model contributes
+// its weight times the value. Nonlinear links, such as the logistic one or
+// clamping, are accounted for by rescaling the contributions to add up to
+// the score moved.
+func explain(names []string, values, contributions []float64, baseline, score float64) *Explanation {
+	total := 0.0
+	for _, contribution := range contributions {
+		total += contribution
+	}
+	scale := 1.0
+	if total != 0 {
+		scale = (score - baseline) / total
+	}
+
+	explanation := &Explanation{Baseline: baseline, Attributions: []Attribution{}}
+	for j, contribution := range contributions {
+		contribution *= scale
+		if math.Abs(contribution) < 1e-9 {
+			continue
+		}
+		direction := DirectionIncreases
+		if contribution < 0 {
+			direction = DirectionDecreases
+		}
+		explanation.Attributions = append(explanation.Attributions, Attribution{
+			Feature:      names[j],
+			Value:        values[j],
+			Contribution: contribution,
+			Direction:    direction,
+		})
+	}
+	sort.Slice(explanation.Attributions, func(i, j int) bool {
+		a, b := explanation.Attributions[i], explanation.Attributions[j]
+		if math.Abs(a.Contribution) != math.Abs(b.Contribution) {
+			return math.Abs(a.Contribution) > math.Abs(b.Contribution)
+		}
+		return a.Feature < b.Feature
+	})
+	return explanation
+}
@@ -0,0 +1,83 @@
+package ml_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func explain(t *testing.T, model ml.Model, tx *detector.Transaction) (float64, *ml.Explanation) {
+	predictions, err := model.PredictBatch([]*detector.Transaction{tx})
+	require.NoError(t, err)
+	require.NotNil(t, predictions[0].Explanation)
+	return predictions[0].Score, predictions[0].Explanation
+}
+
+func sum(explanation *ml.Explanation) float64 {
+	total := explanation.Baseline
+	for _, attribution := range explanation.Attributions {
+		total += attribution.Contribution
+	}
+	return total
+}
+
+func TestLinearModel_Explains(t *testing.T) {
+	score, explanation := explain(t, candidate(t), transaction())
+
+	assert.InDelta(t, 0.05, explanation.Baseline, 1e-9)
+	assert.InDelta(t, score, sum(explanation), 1e-9)
+	require.Len(t, explanation.Attributions, 2)
+	assert.Equal(t, ml.Attribution{Feature: "high_amount", Value: 1, Contribution: 0.4, Direction: ml.DirectionIncreases}, explanation.Attributions[0])
+	assert.Equal(t, "high_risk_country", explanation.Attributions[1].Feature)
+	assert.Len(t, explanation.Top(1).Attributions, 1)
+	assert.Len(t, explanation.Top(0).Attributions, 2)
+}
+
+func TestLinearModel_ExplainsNegativeAndClampedScores(t *testing.T) {
+	model, err := ml.LoadModel(strings.NewReader(`{
+		"version": "v2.1.0",
+		"bias": 0.5,
+		"weights": {"high_amount": 0.6, "high_risk_country": 0.3, "corridor_risk": -0.2}
+	}`))
+	require.NoError(t, err)
+	tx := transaction()
+	tx.CorridorRisk = 1
+
+	score, explanation := explain(t, model, tx)
+	assert.Equal(t, 1.0, score)
+	assert.InDelta(t, score, sum(explanation), 1e-9)
+	require.Len(t, explanation.Attributions, 3)
+	assert.Equal(t, "high_amount", explanation.Attributions[0].Feature)
+	last := explanation.Attributions[2]
+	assert.Equal(t, "corridor_risk", last.Feature)
+	assert.Equal(t, ml.DirectionDecreases, last.Direction)
+	assert.Negative(t, last.Contribution)
+}
+
+func TestOnlineModel_Explains(t *testing.T) {
+	model := ml.NewOnlineModel(ml.DefaultOnlineConfig())
+
+	score, explanation := explain(t, model, transaction())
+	assert.InDelta(t, 0.05, explanation.Baseline, 1e-9)
+	assert.InDelta(t, score, sum(explanation), 1e-9)
+	require.NotEmpty(t, explanation.Attributions)
+	assert.Equal(t, "high_amount", explanation.Attributions[0].Feature)
+
+	_, explanation = explain(t, model, lowRisk())
+	assert.Empty(t, explanation.Attributions)
+}
+
+func TestMLEngine_ExplainsWithVersion(t *testing.T) {
+	engine := ml.NewMLEngine()
+	prediction, err := engine.Predict(transaction())
+	require.NoError(t, err)
+
+	require.NotNil(t, prediction.Explanation)
+	assert.Equal(t, ml.BuiltinVersion, prediction.Explanation.Version)
+	assert.InDelta(t, prediction.Score, sum(prediction.Explanation), 1e-9)
+	assert.Equal(t, "high_amount", prediction.Explanation.Attributions[0].Feature)
+}
@@ -0,0 +1,213 @@
+package ml
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Cost is how expensive a feature is to compute
+type Cost int
+
+// Feature cost classes, from the cheapest
+const (
+	// CostMemory features come from the transaction or in-memory state
+	CostMemory Cost = iota
+	// CostStore features are looked up in a feature store
+	CostStore
+	// CostExternal features are fetched from an external service
+	CostExternal
+	numCosts
+)
+
+func (c Cost) String() string {
+	switch c {
+	case CostMemory:
+		return "memory"
+	case CostStore:
+		return "store"
+	case CostExternal:
+		return "external"
+	default:
+		return fmt.Sprintf("cost(%d)", int(c))
+	}
+}
+
+// Feature tiers reported with predictions: every feature, no external calls,
+// or in-memory features only
+const (
+	TierFull    = "full"
+	TierReduced = "reduced"
+	TierMinimal = "minimal"
+)
+
+// tiers maps the most expensive cost class included to its tier
+var tiers = [numCosts]string{
+	CostMemory:   TierMinimal,
+	CostStore:    TierReduced,
+	CostExternal: TierFull,
+}
+
+// Feature is a model feature beyond the built-in ones, such as a value looked
+// up in a feature store. Models weigh it by name; it is missing, and weighs
+// nothing, when its tier was not used or Compute failed.
+type Feature struct {
+	Name    string
+	Cost    Cost
+	Compute func(ctx context.Context, tx *detector.Transaction) (float64, error)
+}
+
+// FeatureBuilder computes the registered features of a prediction within a
+// latency budget. It keeps a moving average of how long each cost class
+// takes and leaves out the most expensive classes when they would exceed the
+// budget. A class still running at the deadline is charged twice the budget.
+// The averages of classes left out decay, so they are tried again once the
+// pressure eases.
+type FeatureBuilder struct {
+	budget   time.Duration
+	features [numCosts][]Feature
+	names    map[string]bool
+	// estimates are the average build times by cost class
+	estimates [numCosts]time.Duration
+	mu        sync.RWMutex
+}
+
+// Moving average weight of the latest build time, and the decay of the
+// estimates of classes left out
+const (
+	estimateWeight = 0.3
+	estimateDecay  = 0.9
+)
+
+// NewFeatureBuilder creates a builder with a latency budget per prediction
+// call; without one every feature is always computed
+func NewFeatureBuilder(budget time.Duration) *FeatureBuilder {
+	builtins := make(map[string]bool, numFeatures)
+	for _, name := range featureNames {
+		builtins[name] = true
+	}
+	return &FeatureBuilder{budget: budget, names: builtins}
+}
+
+// Add registers a feature
+func (b *FeatureBuilder) Add(feature Feature) error {
+	if feature.Name == "" || feature.Compute == nil {
+		return fmt.Errorf("feature name and compute function are required")
+	}
+	if feature.Cost < CostMemory || feature.Cost >= numCosts {
+		return fmt.Errorf("feature %s: unknown cost %s", feature.Name, feature.Cost)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.names[feature.Name] {
+		return fmt.Errorf("feature %s already exists", feature.Name)
+	}
+	b.names[feature.Name] = true
+	b.features[feature.Cost] = append(b.features[feature.Cost], feature)
+	return nil
+}
+
+// Names returns the names of the registered features
+func (b *FeatureBuilder) Names() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var names []string
+	for _, features := range b.features {
+		for _, feature := range features {
+			names = append(names, feature.Name)
+		}
+	}
+	return names
+}
+
+// SetBudget replaces the latency budget; zero disables it
+func (b *FeatureBuilder) SetBudget(budget time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.budget = budget
+}
+
+// tier returns the most expensive cost class that fits in the budget.
+// Callers must hold the lock.
+func (b *FeatureBuilder) tier() Cost {
+	if b.budget <= 0 {
+		return CostExternal
+	}
+	total := b.estimates[CostMemory]
+	for cost := CostStore; cost < numCosts; cost++ {
+		total += b.estimates[cost]
+		if total > b.budget {
+			return cost - 1
+		}
+	}
+	return CostExternal
+}
+
+// Build computes the features of a batch of transactions into their
+// Features and returns the tier used
+func (b *FeatureBuilder) Build(transactions []*detector.Transaction) string {
+	b.mu.RLock()
+	budget, maxCost, features := b.budget, b.tier(), b.features
+	b.mu.RUnlock()
+
+	ctx := context.Background()
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	var elapsed [numCosts]time.Duration
+	ran := CostMemory - 1
+	for cost := CostMemory; cost <= maxCost && ctx.Err() == nil; cost++ {
+		ran = cost
+		if len(features[cost]) == 0 {
+			continue
+		}
+		start := time.Now()
+		for _, tx := range transactions {
+			for _, feature := range features[cost] {
+				value, err := feature.Compute(ctx, tx)
+				if err != nil {
+					continue
+				}
+				if tx.Features == nil {
+					tx.Features = make(map[string]float64)
+				}
+				tx.Features[feature.Name] = value
+			}
+		}
+		elapsed[cost] = time.Since(start)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for cost := CostMemory; cost < numCosts; cost++ {
+		switch {
+		case cost == ran && ctx.Err() != nil:
+			b.estimates[cost] = max(b.estimates[cost], 2*budget)
+		case cost <= ran:
+			b.estimates[cost] = time.Duration((1-estimateWeight)*float64(b.estimates[cost]) + estimateWeight*float64(elapsed[cost]))
+		case cost > maxCost:
+			b.estimates[cost] = time.Duration(estimateDecay * float64(b.estimates[cost]))
+		}
+	}
+	return tiers[maxCost]
+}
+
+// Estimates returns the average build time of each cost class
+func (b *FeatureBuilder) Estimates() map[string]time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	estimates := make(map[string]time.Duration, numCosts)
+	for cost := CostMemory; cost < numCosts; cost++ {
+		estimates[cost.String()] = b.estimates[cost]
+	}
+	return estimates
+}
@@ -0,0 +1,85 @@
+package ml_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureBuilder_ReducesUnderPressure(t *testing.T) {
+	builder := ml.NewFeatureBuilder(5 * time.Millisecond)
+	var delay atomic.Int64
+	delay.Store(int64(20 * time.Millisecond))
+
+	require.NoError(t, builder.Add(ml.Feature{
+		Name: "merchant_chargebacks",
+		Cost: ml.CostStore,
+		Compute: func(context.Context, *detector.Transaction) (float64, error) {
+			return 0.5, nil
+		},
+	}))
+	require.NoError(t, builder.Add(ml.Feature{
+		Name: "bureau_score",
+		Cost: ml.CostExternal,
+		Compute: func(ctx context.Context, _ *detector.Transaction) (float64, error) {
+			select {
+			case <-time.After(time.Duration(delay.Load())):
+				return 0.9, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		},
+	}))
+	assert.Error(t, builder.Add(ml.Feature{Name: "high_amount", Compute: func(context.Context, *detector.Transaction) (float64, error) { return 0, nil }}))
+	assert.ElementsMatch(t, []string{"merchant_chargebacks", "bureau_score"}, builder.Names())
+
+	// The external call misses the deadline, so it is left out next time
+	tx := transaction()
+	assert.Equal(t, ml.TierFull, builder.Build([]*detector.Transaction{tx}))
+	assert.NotContains(t, tx.Features, "bureau_score")
+
+	tx = transaction()
+	assert.Equal(t, ml.TierReduced, builder.Build([]*detector.Transaction{tx}))
+	assert.Equal(t, map[string]float64{"merchant_chargebacks": 0.5}, tx.Features)
+
+	// Once the estimate decays, the call is tried again
+	delay.Store(0)
+	tier := ml.TierReduced
+	for i := 0; i < 50 && tier != ml.TierFull; i++ {
+		tx = transaction()
+		tier = builder.Build([]*detector.Transaction{tx})
+	}
+	require.Equal(t, ml.TierFull, tier)
+	assert.Equal(t, 0.9, tx.Features["bureau_score"])
+}
+
+func TestLoadModel_RegisteredFeatures(t *testing.T) {
+	artifact := `{"version": "v3", "weights": {"high_amount": 0.4, "bureau_score": 0.5}}`
+	_, err := ml.LoadModel(strings.NewReader(artifact))
+	assert.Error(t, err, "unregistered features are rejected")
+
+	model, err := ml.LoadModel(strings.NewReader(artifact), "bureau_score")
+	require.NoError(t, err)
+
+	tx := transaction()
+	tx.Features = map[string]float64{"bureau_score": 0.8}
+	missing := transaction()
+	predictions, err := model.PredictBatch([]*detector.Transaction{tx, missing})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.8, predictions[0].Score, 1e-9)
+	assert.InDelta(t, 0.4, predictions[1].Score, 1e-9, "missing features weigh nothing")
+}
+
+func TestMLEngine_ReportsTier(t *testing.T) {
+	engine := ml.NewMLEngine()
+	prediction, err := engine.Predict(transaction())
+	require.NoError(t, err)
+	assert.Equal(t, ml.TierFull, prediction.Tier)
+}
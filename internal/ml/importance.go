@@ -0,0 +1,97 @@
+package ml
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrUnknownModel is returned for model versions the engine never loaded
+var ErrUnknownModel = errors.New("unknown model version")
+
+// WeightedModel is implemented by models that weigh their features
+// linearly. Every feature ranges from 0 to 1, so the absolute weight of a
+// feature is the most it moves the score.
+type WeightedModel interface {
+	Model
+	FeatureWeights() map[string]float64
+}
+
+// FeatureImportance is the weight of a feature in a model and its share of
+// the total absolute weight
+type FeatureImportance struct {
+	Feature    string  `json:"feature"`
+	Weight     float64 `json:"weight"`
+	Importance float64 `json:"importance" doc:"Share of the total absolute weight, summing to 1 over the features"`
+}
+
+// FeatureImportances ranks the features of a model, most important first
+func FeatureImportances(model Model) ([]FeatureImportance, error) {
+	weighted, ok := model.(WeightedModel)
+	if !ok {
+		return nil, fmt.Errorf("model %s does not report feature weights", model.Version())
+	}
+
+	weights := weighted.FeatureWeights()
+	total := 0.0
+	for _, weight := range weights {
+		total += math.Abs(weight)
+	}
+	importances := make([]FeatureImportance, 0, len(weights))
+	for feature, weight := range weights {
+		importance := FeatureImportance{Feature: feature, Weight: weight}
+		if total > 0 {
+			importance.Importance = math.Abs(weight) / total
+		}
+		importances = append(importances, importance)
+	}
+	sort.Slice(importances, func(i, j int) bool {
+		if importances[i].Importance != importances[j].Importance {
+			return importances[i].Importance > importances[j].Importance
+		}
+		return importances[i].Feature < importances[j].Feature
+	})
+	return importances, nil
+}
+
+// FeatureWeights returns the built-in weights. The recent feature weighs
+// the most random variance it adds.
+func (builtinModel) FeatureWeights() map[string]float64 {
+	weights := make(map[string]float64, numFeatures)
+	for j, weight := range featureWeights {
+		weights[featureNames[j]] = weight
+	}
+	weights[featureNames[featureRecent]] = recentJitter
+	return weights
+}
+
+// FeatureWeights returns the weights of the built-in and registered features
+func (m *LinearModel) FeatureWeights() map[string]float64 {
+	weights := make(map[string]float64, numFeatures+len(m.extra))
+	for j, weight := range m.weights {
+		weights[featureNames[j]] = weight
+	}
+	for name, weight := range m.extra {
+		weights[name] = weight
+	}
+	return weights
+}
+
+// FeatureWeights returns the current weights, in log odds
+func (m *OnlineModel) FeatureWeights() map[string]float64 {
+	return m.Status().Weights
+}
+
+// FeatureImportance ranks the features of a model version the engine has
+// loaded: the active one, an earlier one or a canary candidate
+func (e *MLEngine) FeatureImportance(version string) ([]FeatureImportance, error) {
+	e.mu.RLock()
+	model, exists := e.models[version]
+	e.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownModel, version)
+	}
+	return FeatureImportances(model)
+}
@@ -0,0 +1,49 @@
+package ml_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureImportances(t *testing.T) {
+	importances, err := ml.FeatureImportances(candidate(t))
+	require.NoError(t, err)
+
+	require.NotEmpty(t, importances)
+	assert.Equal(t, "high_amount", importances[0].Feature)
+	assert.InDelta(t, 0.4/0.7, importances[0].Importance, 1e-9)
+	assert.Equal(t, "high_risk_country", importances[1].Feature)
+	assert.InDelta(t, 0.3, importances[1].Weight, 1e-9)
+	total := 0.0
+	for _, importance := range importances {
+		total += importance.Importance
+	}
+	assert.InDelta(t, 1, total, 1e-9)
+
+	_, err = ml.FeatureImportances(failingModel{})
+	assert.Error(t, err)
+}
+
+func TestMLEngine_FeatureImportance(t *testing.T) {
+	engine := ml.NewMLEngine()
+
+	importances, err := engine.FeatureImportance(ml.BuiltinVersion)
+	require.NoError(t, err)
+	assert.Equal(t, "high_amount", importances[0].Feature)
+
+	_, err = engine.FeatureImportance("v2.0.0")
+	assert.True(t, errors.Is(err, ml.ErrUnknownModel))
+
+	_, err = engine.StartCanary(candidate(t), ml.CanaryConfig{SoakPeriod: time.Hour})
+	require.NoError(t, err)
+	importances, err = engine.FeatureImportance("v2.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "high_amount", importances[0].Feature)
+	_, err = engine.AbortCanary()
+	require.NoError(t, err)
+}
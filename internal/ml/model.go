@@ -0,0 +1,162 @@
+package ml
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Model scores transactions. Implementations must be safe for concurrent use.
+type Model interface {
+	Version() string
+	PredictBatch(transactions []*detector.Transaction) ([]Prediction, error)
+}
+
+// BuiltinVersion is the version of the built-in model
+const BuiltinVersion = "v1.0.0"
+
+// builtinModel is the hand-tuned model the engine starts with
+type builtinModel struct{}
+
+func (builtinModel) Version() string {
+	return BuiltinVersion
+}
+
+func (builtinModel) PredictBatch(transactions []*detector.Transaction) ([]Prediction, error) {
+	features := extractFeatures(transactions)
+	predictions := make([]Prediction, features.rows)
+	for i := range predictions {
+		score, contributions := features.score(i)
+		predictions[i] = Prediction{
+			Score:       score,
+			Confidence:  0.85 + rand.Float64()*0.1, // 85-95% confidence
+			Explanation: explain(featureNames[:], features.row(i), contributions, 0, score),
+		}
+	}
+	return predictions, nil
+}
+
+// featureNames names the feature columns in model artifacts
+var featureNames = [numFeatures]string{
+	featureHighAmount:      "high_amount",
+	featureVeryHighAmount:  "very_high_amount",
+	featureHighRiskCountry: "high_risk_country",
+	featureRiskyType:       "risky_type",
+	featureRecent:          "recent",
+	featureRapidSuccession: "rapid_succession",
+	featureAmountJump:      "amount_jump",
+	featureMerchantRepeat:  "merchant_repeat",
+	featureCorridorRisk:    "corridor_risk",
+	featureReputation:      "reputation",
+}
+
+// LinearModel is a linear model over the engine features, loaded from a JSON
+// artifact
+type LinearModel struct {
+	ModelVersion string             `json:"version"`
+	Bias         float64            `json:"bias"`
+	Weights      map[string]float64 `json:"weights"`
+
+	weights [numFeatures]float64
+	// extra weighs registered features by name
+	extra map[string]float64
+}
+
+// Version returns the model version
+func (m *LinearModel) Version() string {
+	return m.ModelVersion
+}
+
+// PredictBatch scores a batch of transactions. Confidence grows with the
+// distance of the score from 0.5.
+func (m *LinearModel) PredictBatch(transactions []*detector.Transaction) ([]Prediction, error) {
+	features := extractFeatures(transactions)
+	predictions := make([]Prediction, features.rows)
+	names := m.featureNames()
+	for i := range predictions {
+		values := append(make([]float64, 0, len(names)), features.row(i)...)
+		score := m.Bias
+		contributions := make([]float64, 0, len(names))
+		for j, value := range values {
+			contributions = append(contributions, m.weights[j]*value)
+			score += m.weights[j] * value
+		}
+		for _, name := range names[numFeatures:] {
+			value := transactions[i].Features[name]
+			values = append(values, value)
+			contributions = append(contributions, m.extra[name]*value)
+			score += m.extra[name] * value
+		}
+		score = clamp(score)
+		predictions[i] = Prediction{
+			Score:       score,
+			Confidence:  0.5 + math.Abs(score-0.5),
+			Explanation: explain(names, values, contributions, clamp(m.Bias), score),
+		}
+	}
+	return predictions, nil
+}
+
+// featureNames returns the names of the built-in features, then of the
+// registered ones in name order
+func (m *LinearModel) featureNames() []string {
+	names := append(make([]string, 0, numFeatures+len(m.extra)), featureNames[:]...)
+	extra := make([]string, 0, len(m.extra))
+	for name := range m.extra {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return append(names, extra...)
+}
+
+// LoadModel reads a linear model artifact. Besides the built-in features, it
+// may weigh the registered features named in extra.
+func LoadModel(r io.Reader, extra ...string) (*LinearModel, error) {
+	var model LinearModel
+	if err := json.NewDecoder(r).Decode(&model); err != nil {
+		return nil, fmt.Errorf("invalid model artifact: %w", err)
+	}
+	if model.ModelVersion == "" {
+		return nil, fmt.Errorf("model artifact has no version")
+	}
+
+	known := make(map[string]int, numFeatures)
+	for i, name := range featureNames {
+		known[name] = i
+	}
+	registered := make(map[string]bool, len(extra))
+	for _, name := range extra {
+		registered[name] = true
+	}
+	for name, weight := range model.Weights {
+		i, exists := known[name]
+		switch {
+		case exists:
+			model.weights[i] = weight
+		case registered[name]:
+			if model.extra == nil {
+				model.extra = make(map[string]float64)
+			}
+			model.extra[name] = weight
+		default:
+			return nil, fmt.Errorf("unknown feature in model artifact: %s", name)
+		}
+	}
+	return &model, nil
+}
+
+// LoadModelFile reads a linear model artifact from disk
+func LoadModelFile(path string, extra ...string) (*LinearModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadModel(f, extra...)
+}
@@ -0,0 +1,296 @@
+package ml
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// OnlineVersion is the version of the online learning model
+const OnlineVersion = "online"
+
+// OnlineConfig controls how the online model learns from labels. Each label
+// moves every weight by at most MaxStep, and weights stay within MaxWeight.
+// Every CheckpointEvery labels the log loss of the last EvalWindow
+// predictions, each made before learning its label, is compared with that
+// of the last checkpoint: the weights are rolled back to the checkpoint when
+// it grew by more than MaxRegression, and checkpointed otherwise.
+type OnlineConfig struct {
+	// LearningRate is the initial step size, decayed with the square root of
+	// the number of labels learned
+	LearningRate    float64
+	MaxStep         float64
+	MaxWeight       float64
+	L2              float64
+	EvalWindow      int
+	CheckpointEvery int
+	// MaxRegression is the relative log loss increase tolerated between
+	// checkpoints
+	MaxRegression float64
+}
+
+// DefaultOnlineConfig returns the default online learning settings
+func DefaultOnlineConfig() OnlineConfig {
+	return OnlineConfig{
+		LearningRate:    0.05,
+		MaxStep:         0.1,
+		MaxWeight:       10,
+		L2:              0.0001,
+		EvalWindow:      200,
+		CheckpointEvery: 100,
+		MaxRegression:   0.1,
+	}
+}
+
+func (c OnlineConfig) withDefaults() OnlineConfig {
+	defaults := DefaultOnlineConfig()
+	if c.LearningRate <= 0 {
+		c.LearningRate = defaults.LearningRate
+	}
+	if c.MaxStep <= 0 {
+		c.MaxStep = defaults.MaxStep
+	}
+	if c.MaxWeight <= 0 {
+		c.MaxWeight = defaults.MaxWeight
+	}
+	if c.L2 < 0 {
+		c.L2 = defaults.L2
+	}
+	if c.EvalWindow <= 0 {
+		c.EvalWindow = defaults.EvalWindow
+	}
+	if c.CheckpointEvery <= 0 {
+		c.CheckpointEvery = defaults.CheckpointEvery
+	}
+	if c.MaxRegression <= 0 {
+		c.MaxRegression = defaults.MaxRegression
+	}
+	return c
+}
+
+// Warm start of the online model: the built-in weights are scaled to log
+// odds around a low base rate, so that it scores like the built-in model
+// until labels arrive
+const (
+	onlineBaseRate    = 0.05
+	onlineWeightScale = 5
+)
+
+// OnlineStatus reports the state of the online model
+type OnlineStatus struct {
+	Version   string             `json:"version"`
+	Updates   int                `json:"updates"`
+	Rollbacks int                `json:"rollbacks"`
+	Bias      float64            `json:"bias"`
+	Weights   map[string]float64 `json:"weights"`
+	// LogLoss is that of the last predictions made before learning their
+	// labels
+	LogLoss        float64    `json:"log_loss"`
+	CheckpointLoss float64    `json:"checkpoint_loss,omitempty"`
+	LastCheckpoint *time.Time `json:"last_checkpoint,omitempty"`
+	LastRollback   *time.Time `json:"last_rollback,omitempty"`
+	LearningRate   float64    `json:"learning_rate"`
+}
+
+// OnlineModel is a logistic regression over the built-in engine features,
+// updated by stochastic gradient descent from every label instead of being
+// retrained. The recent feature is left out, as labels arrive long after the
+// transactions.
+type OnlineModel struct {
+	config  OnlineConfig
+	bias    float64
+	weights [numFeatures]float64
+	updates int
+
+	// losses is a ring of the log losses of the last predictions
+	losses []float64
+	next   int
+
+	checkpoint     onlineCheckpoint
+	rollbacks      int
+	lastCheckpoint *time.Time
+	lastRollback   *time.Time
+	mu             sync.RWMutex
+}
+
+type onlineCheckpoint struct {
+	bias    float64
+	weights [numFeatures]float64
+	loss    float64
+	taken   bool
+}
+
+func NewOnlineModel(config OnlineConfig) *OnlineModel {
+	m := &OnlineModel{
+		config: config.withDefaults(),
+		bias:   math.Log(onlineBaseRate / (1 - onlineBaseRate)),
+	}
+	for j, weight := range featureWeights {
+		if j != featureRecent {
+			m.weights[j] = weight * onlineWeightScale
+		}
+	}
+	return m
+}
+
+// Version returns the model version
+func (m *OnlineModel) Version() string {
+	return OnlineVersion
+}
+
+// PredictBatch scores a batch of transactions with the current weights.
+// Confidence grows with the distance of the score from 0.5.
+func (m *OnlineModel) PredictBatch(transactions []*detector.Transaction) ([]Prediction, error) {
+	features := extractFeatures(transactions)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	predictions := make([]Prediction, features.rows)
+	baseline := sigmoid(m.bias)
+	for i := range predictions {
+		row := features.row(i)
+		score := m.probability(row)
+		contributions := make([]float64, numFeatures)
+		for j, value := range row {
+			if j != featureRecent {
+				contributions[j] = m.weights[j] * value
+			}
+		}
+		predictions[i] = Prediction{
+			Score:       score,
+			Confidence:  0.5 + math.Abs(score-0.5),
+			Explanation: explain(featureNames[:], row, contributions, baseline, score),
+		}
+	}
+	return predictions, nil
+}
+
+func (m *OnlineModel) probability(row []float64) float64 {
+	z := m.bias
+	for j, value := range row {
+		if j != featureRecent {
+			z += m.weights[j] * value
+		}
+	}
+	return sigmoid(z)
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+// Learn updates the weights from the label of a transaction. It reports
+// whether the weights were rolled back to the last checkpoint.
+func (m *OnlineModel) Learn(tx *detector.Transaction, fraud bool) bool {
+	row := extractFeatures([]*detector.Transaction{tx}).row(0)
+	label := indicator(fraud)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.probability(row)
+	m.record(logLoss(p, label))
+
+	rate := m.learningRate()
+	gradient := p - label
+	m.bias -= m.step(rate * gradient)
+	for j, value := range row {
+		if j == featureRecent {
+			continue
+		}
+		delta := m.step(rate * (gradient*value + m.config.L2*m.weights[j]))
+		m.weights[j] = math.Max(-m.config.MaxWeight, math.Min(m.weights[j]-delta, m.config.MaxWeight))
+	}
+	m.updates++
+
+	if m.updates%m.config.CheckpointEvery != 0 {
+		return false
+	}
+	return m.evaluate()
+}
+
+// learningRate decays the initial rate with the labels learned
+func (m *OnlineModel) learningRate() float64 {
+	return m.config.LearningRate / math.Sqrt(1+float64(m.updates)/float64(m.config.CheckpointEvery))
+}
+
+// step caps the change of a weight from one label
+func (m *OnlineModel) step(delta float64) float64 {
+	return math.Max(-m.config.MaxStep, math.Min(delta, m.config.MaxStep))
+}
+
+func (m *OnlineModel) record(loss float64) {
+	if len(m.losses) < m.config.EvalWindow {
+		m.losses = append(m.losses, loss)
+		return
+	}
+	m.losses[m.next] = loss
+	m.next = (m.next + 1) % m.config.EvalWindow
+}
+
+// evaluate checkpoints the weights, or rolls back to the last checkpoint
+// when the log loss regressed since
+func (m *OnlineModel) evaluate() bool {
+	loss := m.windowLoss()
+	if m.checkpoint.taken && loss > m.checkpoint.loss*(1+m.config.MaxRegression) {
+		m.bias, m.weights = m.checkpoint.bias, m.checkpoint.weights
+		m.rollbacks++
+		now := time.Now()
+		m.lastRollback = &now
+		// The losses were those of the discarded weights
+		m.losses, m.next = m.losses[:0], 0
+		return true
+	}
+	m.checkpoint = onlineCheckpoint{bias: m.bias, weights: m.weights, loss: loss, taken: true}
+	now := time.Now()
+	m.lastCheckpoint = &now
+	return false
+}
+
+func (m *OnlineModel) windowLoss() float64 {
+	if len(m.losses) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, loss := range m.losses {
+		total += loss
+	}
+	return total / float64(len(m.losses))
+}
+
+// Status returns the state of the model
+func (m *OnlineModel) Status() OnlineStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := OnlineStatus{
+		Version:        OnlineVersion,
+		Updates:        m.updates,
+		Rollbacks:      m.rollbacks,
+		Bias:           m.bias,
+		Weights:        make(map[string]float64),
+		LogLoss:        m.windowLoss(),
+		LastCheckpoint: m.lastCheckpoint,
+		LastRollback:   m.lastRollback,
+		LearningRate:   m.learningRate(),
+	}
+	if m.checkpoint.taken {
+		status.CheckpointLoss = m.checkpoint.loss
+	}
+	for j, weight := range m.weights {
+		if j != featureRecent {
+			status.Weights[featureNames[j]] = weight
+		}
+	}
+	return status
+}
+
+// logLoss bounds the loss of confident mistakes
+func logLoss(p, label float64) float64 {
+	const epsilon = 1e-6
+	p = math.Max(epsilon, math.Min(p, 1-epsilon))
+	return -(label*math.Log(p) + (1-label)*math.Log(1-p))
+}
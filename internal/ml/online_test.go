@@ -0,0 +1,112 @@
+package ml_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lowRisk() *detector.Transaction {
+	return &detector.Transaction{
+		ID:        "TXN-2",
+		Amount:    40,
+		Location:  detector.Location{Country: "US"},
+		Timestamp: time.Now().Add(-24 * time.Hour),
+	}
+}
+
+func score(t *testing.T, model ml.Model, tx *detector.Transaction) float64 {
+	predictions, err := model.PredictBatch([]*detector.Transaction{tx})
+	require.NoError(t, err)
+	return predictions[0].Score
+}
+
+func TestOnlineModel_WarmStart(t *testing.T) {
+	model := ml.NewOnlineModel(ml.DefaultOnlineConfig())
+
+	assert.Equal(t, ml.OnlineVersion, model.Version())
+	assert.InDelta(t, 0.05, score(t, model, lowRisk()), 1e-9)
+	assert.Greater(t, score(t, model, transaction()), 0.3)
+}
+
+func TestOnlineModel_Learns(t *testing.T) {
+	model := ml.NewOnlineModel(ml.OnlineConfig{CheckpointEvery: 1000})
+	risky, safe := score(t, model, transaction()), score(t, model, lowRisk())
+
+	for i := 0; i < 200; i++ {
+		model.Learn(transaction(), false)
+		model.Learn(lowRisk(), true)
+	}
+
+	assert.Less(t, score(t, model, transaction()), risky)
+	assert.Greater(t, score(t, model, lowRisk()), safe)
+	status := model.Status()
+	assert.Equal(t, 400, status.Updates)
+	assert.Less(t, status.LearningRate, ml.DefaultOnlineConfig().LearningRate)
+}
+
+func TestOnlineModel_CapsSteps(t *testing.T) {
+	model := ml.NewOnlineModel(ml.OnlineConfig{LearningRate: 100, MaxStep: 0.01, MaxWeight: 2})
+	before := model.Status()
+
+	model.Learn(transaction(), false)
+
+	after := model.Status()
+	assert.InDelta(t, before.Bias-0.01, after.Bias, 1e-9)
+	assert.InDelta(t, 1.49, after.Weights["high_amount"], 1e-9)
+
+	for i := 0; i < 1000; i++ {
+		model.Learn(transaction(), true)
+	}
+	assert.InDelta(t, 2, model.Status().Weights["high_amount"], 1e-9)
+}
+
+func TestOnlineModel_RollsBackOnRegression(t *testing.T) {
+	model := ml.NewOnlineModel(ml.OnlineConfig{EvalWindow: 20, CheckpointEvery: 20, MaxRegression: 0.05})
+
+	rolledBack := false
+	for i := 0; i < 20; i++ {
+		rolledBack = model.Learn(transaction(), true) || rolledBack
+	}
+	require.False(t, rolledBack)
+	checkpoint := model.Status()
+	require.NotNil(t, checkpoint.LastCheckpoint)
+
+	// Labels contradicting everything learned so far
+	for i := 0; i < 20; i++ {
+		rolledBack = model.Learn(transaction(), false)
+	}
+
+	assert.True(t, rolledBack)
+	status := model.Status()
+	assert.Equal(t, 1, status.Rollbacks)
+	assert.NotNil(t, status.LastRollback)
+	assert.Equal(t, checkpoint.Weights, status.Weights)
+	assert.Equal(t, checkpoint.Bias, status.Bias)
+}
+
+func TestMLEngine_OnlineLearning(t *testing.T) {
+	engine := ml.NewMLEngine()
+	assert.False(t, engine.Learn(transaction(), true))
+	_, enabled := engine.OnlineStatus()
+	assert.False(t, enabled)
+
+	engine.EnableOnlineLearning(ml.DefaultOnlineConfig())
+	assert.Equal(t, ml.OnlineVersion, engine.ActiveVersion())
+
+	before, err := engine.Predict(lowRisk())
+	require.NoError(t, err)
+	assert.True(t, engine.Learn(lowRisk(), true))
+	after, err := engine.Predict(lowRisk())
+	require.NoError(t, err)
+	assert.Greater(t, after.Score, before.Score)
+
+	status, enabled := engine.OnlineStatus()
+	assert.True(t, enabled)
+	assert.Equal(t, 1, status.Updates)
+	assert.Contains(t, engine.GetModelInfo(), "online")
+}
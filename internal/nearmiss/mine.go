@@ -0,0 +1,347 @@
+package nearmiss
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// MiningConfig holds the rule mining settings. Attribute combinations of up
+// to MaxConditions conditions found on at least MinSupport near misses
+// labeled fraud are proposed when at least MinPrecision of the labeled near
+// misses they match are fraud. At most TopN proposals are returned.
+type MiningConfig struct {
+	MinSupport    int     `json:"min_support,omitempty"`
+	MinPrecision  float64 `json:"min_precision,omitempty"`
+	MaxConditions int     `json:"max_conditions,omitempty" openapi:"maximum=4"`
+	TopN          int     `json:"top_n,omitempty"`
+}
+
+// DefaultMiningConfig returns the default rule mining settings
+func DefaultMiningConfig() MiningConfig {
+	return MiningConfig{
+		MinSupport:    5,
+		MinPrecision:  0.6,
+		MaxConditions: 3,
+		TopN:          20,
+	}
+}
+
+func (c MiningConfig) withDefaults() MiningConfig {
+	defaults := DefaultMiningConfig()
+	if c.MinSupport <= 0 {
+		c.MinSupport = defaults.MinSupport
+	}
+	if c.MinPrecision <= 0 {
+		c.MinPrecision = defaults.MinPrecision
+	}
+	if c.MaxConditions <= 0 {
+		c.MaxConditions = defaults.MaxConditions
+	}
+	if c.TopN <= 0 {
+		c.TopN = defaults.TopN
+	}
+	return c
+}
+
+// Validate checks the rule mining settings
+func (c MiningConfig) Validate() error {
+	if c.MinPrecision < 0 || c.MinPrecision > 1 {
+		return fmt.Errorf("min precision %.2f must be within [0, 1]", c.MinPrecision)
+	}
+	if c.MaxConditions > 4 {
+		return fmt.Errorf("max conditions %d exceeds 4", c.MaxConditions)
+	}
+	return nil
+}
+
+// Proposal is a candidate rule mined from the near misses. Expression is in
+// the rule expression language, ready to be registered as a rule. Support is
+// the number of fraud near misses it matches, Precision the share of fraud
+// among the labeled near misses it matches and Lift that share relative to
+// the fraud rate of all labeled near misses.
+type Proposal struct {
+	Conditions []string `json:"conditions"`
+	Expression string   `json:"expression"`
+	Support    int      `json:"support"`
+	Matched    int      `json:"matched"`
+	Precision  float64  `json:"precision"`
+	Lift       float64  `json:"lift"`
+}
+
+// MiningResult holds the proposals of a mining run
+type MiningResult struct {
+	Labeled   int        `json:"labeled"`
+	Fraud     int        `json:"fraud"`
+	Proposals []Proposal `json:"proposals"`
+}
+
+// condition is an attribute value of a transaction, as an expression
+type condition struct {
+	// group keeps conditions on the same attribute out of one proposal
+	group      string
+	expression string
+}
+
+// categorical attributes mined, by expression field
+var categorical = []struct {
+	field string
+	value func(tx *detector.Transaction) string
+}{
+	{"tx.type", func(tx *detector.Transaction) string { return tx.Type }},
+	{"tx.currency", func(tx *detector.Transaction) string { return tx.Currency }},
+	{"tx.merchant_id", func(tx *detector.Transaction) string { return tx.MerchantID }},
+	{"tx.merchant_country", func(tx *detector.Transaction) string { return tx.MerchantCountry }},
+	{"tx.mcc", func(tx *detector.Transaction) string { return tx.MCC }},
+	{"tx.merchant_risk_tier", func(tx *detector.Transaction) string { return tx.MerchantRiskTier }},
+	{"tx.ip_country", func(tx *detector.Transaction) string { return tx.IPCountry }},
+	{"tx.issuer_country", func(tx *detector.Transaction) string { return tx.IssuerCountry }},
+	{"tx.card_brand", func(tx *detector.Transaction) string { return tx.CardBrand }},
+	{"tx.network_type", func(tx *detector.Transaction) string { return tx.NetworkType }},
+	{"tx.location.country", func(tx *detector.Transaction) string { return tx.Location.Country }},
+}
+
+// amountBands are the lower bounds of the amount conditions. A transaction
+// meets every band up to its amount, so the broadest one can win.
+var amountBands = []float64{100, 500, 1000, 5000}
+
+// conditions returns the conditions a transaction meets
+func conditions(tx *detector.Transaction) []condition {
+	var result []condition
+	for _, attribute := range categorical {
+		value := attribute.value(tx)
+		if value == "" || strings.ContainsAny(value, `'\`) {
+			continue
+		}
+		result = append(result, condition{
+			group:      attribute.field,
+			expression: fmt.Sprintf("%s == '%s'", attribute.field, value),
+		})
+	}
+	for _, band := range amountBands {
+		if tx.Amount >= band {
+			result = append(result, condition{group: "tx.amount", expression: fmt.Sprintf("tx.amount >= %g", band)})
+		}
+	}
+	hour := tx.Timestamp.UTC().Hour()
+	if hour < 6 {
+		result = append(result, condition{group: "tx.hour", expression: "tx.hour < 6"})
+	}
+	return result
+}
+
+// candidate counts the matches of a combination of conditions
+type candidate struct {
+	conditions []condition
+	fraud      int
+	matched    int
+}
+
+func (c *candidate) key() string {
+	expressions := make([]string, len(c.conditions))
+	for i, cond := range c.conditions {
+		expressions[i] = cond.expression
+	}
+	return strings.Join(expressions, " && ")
+}
+
+// Mine proposes rules from the labeled near misses: the attribute
+// combinations frequent among fraud, grown one condition at a time from the
+// frequent smaller ones, that separate fraud from legitimate traffic.
+func Mine(entries []Entry, config MiningConfig) MiningResult {
+	config = config.withDefaults()
+
+	type labeledSet struct {
+		fraud bool
+		items map[string]bool
+	}
+	var labeled []labeledSet
+	var fraudConditions [][]condition
+	result := MiningResult{Proposals: []Proposal{}}
+	for i := range entries {
+		isLabeled, fraud := entries[i].Labeled()
+		if !isLabeled {
+			continue
+		}
+		conds := conditions(&entries[i].Transaction)
+		items := make(map[string]bool, len(conds))
+		for _, cond := range conds {
+			items[cond.expression] = true
+		}
+		labeled = append(labeled, labeledSet{fraud: fraud, items: items})
+		result.Labeled++
+		if fraud {
+			result.Fraud++
+			fraudConditions = append(fraudConditions, conds)
+		}
+	}
+	if result.Fraud < config.MinSupport {
+		return result
+	}
+	baseRate := float64(result.Fraud) / float64(result.Labeled)
+
+	// Frequent combinations among fraud, level by level
+	var frequent []*candidate
+	level := map[string]*candidate{}
+	for _, conds := range fraudConditions {
+		for _, cond := range conds {
+			c := &candidate{conditions: []condition{cond}}
+			key := c.key()
+			if existing, exists := level[key]; exists {
+				c = existing
+			} else {
+				level[key] = c
+			}
+			c.fraud++
+		}
+	}
+	for size := 1; len(level) > 0; size++ {
+		var kept []*candidate
+		for _, c := range level {
+			if c.fraud >= config.MinSupport {
+				kept = append(kept, c)
+			}
+		}
+		frequent = append(frequent, kept...)
+		if size == config.MaxConditions {
+			break
+		}
+		level = grow(kept, fraudConditions)
+	}
+
+	// Precision over every labeled near miss
+	for _, c := range frequent {
+		for _, set := range labeled {
+			if meets(set.items, c.conditions) {
+				c.matched++
+			}
+		}
+	}
+
+	for _, c := range frequent {
+		precision := float64(c.fraud) / float64(c.matched)
+		if precision < config.MinPrecision {
+			continue
+		}
+		proposal := Proposal{
+			Expression: c.key(),
+			Support:    c.fraud,
+			Matched:    c.matched,
+			Precision:  precision,
+			Lift:       precision / baseRate,
+		}
+		for _, cond := range c.conditions {
+			proposal.Conditions = append(proposal.Conditions, cond.expression)
+		}
+		result.Proposals = append(result.Proposals, proposal)
+	}
+	result.Proposals = prune(result.Proposals)
+
+	sort.Slice(result.Proposals, func(i, j int) bool {
+		a, b := result.Proposals[i], result.Proposals[j]
+		if a.Precision != b.Precision {
+			return a.Precision > b.Precision
+		}
+		if a.Support != b.Support {
+			return a.Support > b.Support
+		}
+		return a.Expression < b.Expression
+	})
+	if len(result.Proposals) > config.TopN {
+		result.Proposals = result.Proposals[:config.TopN]
+	}
+	return result
+}
+
+// grow extends the frequent combinations by one condition on another
+// attribute, counting the fraud near misses that meet the larger ones
+func grow(frequent []*candidate, fraudConditions [][]condition) map[string]*candidate {
+	next := map[string]*candidate{}
+	for _, conds := range fraudConditions {
+		items := make(map[string]bool, len(conds))
+		for _, cond := range conds {
+			items[cond.expression] = true
+		}
+		seen := map[string]bool{}
+		for _, c := range frequent {
+			if !meets(items, c.conditions) {
+				continue
+			}
+			last := c.conditions[len(c.conditions)-1].expression
+			for _, cond := range conds {
+				// Conditions stay sorted, so each combination is built once
+				if cond.expression <= last || sameGroup(c.conditions, cond.group) {
+					continue
+				}
+				grown := &candidate{conditions: append(append([]condition{}, c.conditions...), cond)}
+				key := grown.key()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				if existing, exists := next[key]; exists {
+					grown = existing
+				} else {
+					next[key] = grown
+				}
+				grown.fraud++
+			}
+		}
+	}
+	return next
+}
+
+func meets(items map[string]bool, conds []condition) bool {
+	for _, cond := range conds {
+		if !items[cond.expression] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameGroup(conds []condition, group string) bool {
+	for _, cond := range conds {
+		if cond.group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// prune drops proposals that add conditions to a smaller proposal without
+// improving its precision, which would only match less fraud
+func prune(proposals []Proposal) []Proposal {
+	kept := make([]Proposal, 0, len(proposals))
+	for _, p := range proposals {
+		redundant := false
+		for _, smaller := range proposals {
+			if len(smaller.Conditions) < len(p.Conditions) && subset(smaller.Conditions, p.Conditions) && smaller.Precision >= p.Precision {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func subset(a, b []string) bool {
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x == y {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
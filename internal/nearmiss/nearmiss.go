@@ -0,0 +1,313 @@
+// Package nearmiss keeps the transactions whose score landed just below a
+// decision threshold, and learns from the ones later confirmed as fraud which
+// attribute combinations the rules are missing.
+package nearmiss
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Thresholds a near miss can fall short of
+const (
+	ThresholdReview  = "review"
+	ThresholdDecline = "decline"
+)
+
+// Config holds the near-miss settings. Approvals scoring within Band below
+// the review threshold, and reviews and soft declines within Band below the
+// decline threshold, are near misses. The most recent History near misses are kept.
+type Config struct {
+	Band    float64
+	History int
+	// Path is the file near misses and their labels are appended to, so the
+	// dataset survives restarts; empty keeps them in memory only
+	Path string
+}
+
+// DefaultConfig returns the default near-miss settings
+func DefaultConfig() Config {
+	return Config{
+		Band:    0.1,
+		History: 50000,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.Band <= 0 {
+		c.Band = defaults.Band
+	}
+	if c.History <= 0 {
+		c.History = defaults.History
+	}
+	return c
+}
+
+// Entry is a near miss: a transaction that scored just below a threshold
+type Entry struct {
+	Transaction detector.Transaction `json:"transaction"`
+	Decision    string               `json:"decision"`
+	RiskScore   float64              `json:"risk_score"`
+	// Threshold is the threshold the transaction fell short of, and Gap by
+	// how much
+	Threshold   string    `json:"threshold"`
+	Gap         float64   `json:"gap"`
+	ReasonCodes []string  `json:"reason_codes,omitempty"`
+	DecidedAt   time.Time `json:"decided_at"`
+	// Fraud is set once the transaction is labeled
+	Fraud     *bool     `json:"fraud,omitempty"`
+	LabeledAt time.Time `json:"labeled_at,omitempty"`
+}
+
+// Labeled reports whether the entry was labeled and, if so, as fraud
+func (e Entry) Labeled() (labeled, fraud bool) {
+	if e.Fraud == nil {
+		return false, false
+	}
+	return true, *e.Fraud
+}
+
+// Near reports which threshold a final score fell short of, and by how much.
+// Only approvals can miss the review threshold, and only reviews and soft
+// declines the decline threshold.
+func (d *Dataset) Near(decided string, score, reviewThreshold, declineThreshold float64) (string, float64, bool) {
+	var threshold string
+	var value float64
+	switch decided {
+	case decision.Approve:
+		threshold, value = ThresholdReview, reviewThreshold
+	case decision.Review, decision.SoftDecline:
+		threshold, value = ThresholdDecline, declineThreshold
+	default:
+		return "", 0, false
+	}
+	gap := value - score
+	if gap <= 0 || gap > d.config.Band {
+		return "", 0, false
+	}
+	return threshold, gap, true
+}
+
+// logLine is a line of the dataset file: a near miss or a label
+type logLine struct {
+	Entry *Entry     `json:"entry,omitempty"`
+	Label *labelLine `json:"label,omitempty"`
+}
+
+type labelLine struct {
+	TransactionID string    `json:"transaction_id"`
+	Fraud         bool      `json:"fraud"`
+	At            time.Time `json:"at"`
+}
+
+// Dataset holds the most recent near misses and their labels
+type Dataset struct {
+	config  Config
+	entries []Entry
+	// byID indexes entries by transaction ID
+	byID map[string]int
+	// first is the index of the oldest entry once entries holds History
+	first int
+	file  *os.File
+	mu    sync.RWMutex
+}
+
+// Open creates a dataset, loading the near misses of its file when it has
+// one. The file is compacted to the kept entries.
+func Open(config Config) (*Dataset, error) {
+	config = config.withDefaults()
+	d := &Dataset{config: config, byID: make(map[string]int)}
+	if config.Path == "" {
+		return d, nil
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load replays the dataset file
+func (d *Dataset) load() error {
+	f, err := os.Open(d.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var invalid error
+	for line := 1; scanner.Scan(); line++ {
+		if invalid != nil {
+			return invalid
+		}
+		var entry logLine
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash can leave the last line half-written, which compacting
+			// drops; an invalid line before others is corruption
+			invalid = fmt.Errorf("invalid near miss on line %d: %w", line, err)
+			continue
+		}
+		switch {
+		case entry.Entry != nil:
+			d.add(*entry.Entry)
+		case entry.Label != nil:
+			d.label(entry.Label.TransactionID, entry.Label.Fraud, entry.Label.At)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the dataset file with the kept entries, then keeps it
+// open for appends
+func (d *Dataset) compact() error {
+	tmp := d.config.Path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range d.ordered() {
+		entry := entry
+		if err := encoder.Encode(logLine{Entry: &entry}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.config.Path); err != nil {
+		return err
+	}
+
+	d.file, err = os.OpenFile(d.config.Path, os.O_APPEND|os.O_WRONLY, 0o644)
+	return err
+}
+
+// append writes a line to the dataset file. Callers must hold the lock.
+func (d *Dataset) append(line logLine) error {
+	if d.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = d.file.Write(append(data, '\n'))
+	return err
+}
+
+// Add records a near miss, replacing an earlier one of the same transaction
+func (d *Dataset) Add(entry Entry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.add(entry)
+	return d.append(logLine{Entry: &entry})
+}
+
+// add records an entry, evicting the oldest when full. Callers must hold the
+// lock.
+func (d *Dataset) add(entry Entry) {
+	if i, exists := d.byID[entry.Transaction.ID]; exists {
+		d.entries[i] = entry
+		return
+	}
+	if len(d.entries) < d.config.History {
+		d.byID[entry.Transaction.ID] = len(d.entries)
+		d.entries = append(d.entries, entry)
+		return
+	}
+	delete(d.byID, d.entries[d.first].Transaction.ID)
+	d.entries[d.first] = entry
+	d.byID[entry.Transaction.ID] = d.first
+	d.first = (d.first + 1) % len(d.entries)
+}
+
+// Label records whether a near miss turned out to be fraud. Transactions that
+// were not near misses are ignored.
+func (d *Dataset) Label(transactionID string, fraud bool, at time.Time) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.label(transactionID, fraud, at) {
+		return false, nil
+	}
+	return true, d.append(logLine{Label: &labelLine{TransactionID: transactionID, Fraud: fraud, At: at}})
+}
+
+// label sets the label of an entry. Callers must hold the lock.
+func (d *Dataset) label(transactionID string, fraud bool, at time.Time) bool {
+	i, exists := d.byID[transactionID]
+	if !exists {
+		return false
+	}
+	d.entries[i].Fraud = &fraud
+	d.entries[i].LabeledAt = at
+	return true
+}
+
+// ordered returns the entries oldest first. Callers must hold the lock.
+func (d *Dataset) ordered() []Entry {
+	ordered := make([]Entry, 0, len(d.entries))
+	ordered = append(ordered, d.entries[d.first:]...)
+	return append(ordered, d.entries[:d.first]...)
+}
+
+// Entries returns the near misses, newest first, optionally only the
+// labeled ones, up to limit when positive
+func (d *Dataset) Entries(labeledOnly bool, limit int) []Entry {
+	d.mu.RLock()
+	ordered := d.ordered()
+	d.mu.RUnlock()
+
+	result := []Entry{}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if labeled, _ := ordered[i].Labeled(); labeledOnly && !labeled {
+			continue
+		}
+		result = append(result, ordered[i])
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result
+}
+
+// Len returns the number of kept near misses
+func (d *Dataset) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.entries)
+}
+
+// Close closes the dataset file
+func (d *Dataset) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
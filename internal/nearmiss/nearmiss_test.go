@@ -0,0 +1,132 @@
+package nearmiss_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/nearmiss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entry(id, country, mcc string, amount float64) nearmiss.Entry {
+	return nearmiss.Entry{
+		Transaction: detector.Transaction{
+			ID:              id,
+			Amount:          amount,
+			Currency:        "USD",
+			MerchantCountry: country,
+			MCC:             mcc,
+			Timestamp:       time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+		},
+		Decision:  "APPROVE",
+		RiskScore: 0.45,
+		Threshold: nearmiss.ThresholdReview,
+		Gap:       0.05,
+	}
+}
+
+func TestDataset_Near(t *testing.T) {
+	dataset, err := nearmiss.Open(nearmiss.Config{Band: 0.1})
+	require.NoError(t, err)
+
+	threshold, gap, near := dataset.Near("APPROVE", 0.45, 0.5, 0.8)
+	assert.True(t, near)
+	assert.Equal(t, nearmiss.ThresholdReview, threshold)
+	assert.InDelta(t, 0.05, gap, 1e-9)
+
+	threshold, _, near = dataset.Near("REVIEW", 0.75, 0.5, 0.8)
+	assert.True(t, near)
+	assert.Equal(t, nearmiss.ThresholdDecline, threshold)
+
+	_, _, near = dataset.Near("APPROVE", 0.3, 0.5, 0.8)
+	assert.False(t, near, "too far below the threshold")
+	_, _, near = dataset.Near("DECLINE", 0.85, 0.5, 0.8)
+	assert.False(t, near)
+}
+
+func TestDataset_PersistsEntriesAndLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "near-misses.jsonl")
+	dataset, err := nearmiss.Open(nearmiss.Config{Path: path, History: 2})
+	require.NoError(t, err)
+
+	require.NoError(t, dataset.Add(entry("T1", "US", "5411", 50)))
+	require.NoError(t, dataset.Add(entry("T2", "US", "5411", 50)))
+	labeled, err := dataset.Label("T2", true, time.Now())
+	require.NoError(t, err)
+	assert.True(t, labeled)
+	labeled, err = dataset.Label("T9", true, time.Now())
+	require.NoError(t, err)
+	assert.False(t, labeled, "transactions that were not near misses are ignored")
+	require.NoError(t, dataset.Add(entry("T3", "US", "5411", 50)))
+	require.NoError(t, dataset.Close())
+
+	// A crash leaves a half-written line
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"entry": {"transac`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := nearmiss.Open(nearmiss.Config{Path: path, History: 2})
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	entries := reopened.Entries(false, 0)
+	require.Len(t, entries, 2, "the oldest entry is evicted")
+	assert.Equal(t, "T3", entries[0].Transaction.ID)
+	assert.Equal(t, "T2", entries[1].Transaction.ID)
+	labeledEntries := reopened.Entries(true, 0)
+	require.Len(t, labeledEntries, 1)
+	_, fraud := labeledEntries[0].Labeled()
+	assert.True(t, fraud)
+}
+
+func TestMine_ProposesFraudCombinations(t *testing.T) {
+	var entries []nearmiss.Entry
+	label := func(e nearmiss.Entry, fraud bool) nearmiss.Entry {
+		e.Fraud = &fraud
+		return e
+	}
+	// Digital goods sold by merchants in NG are mostly fraud
+	for i := 0; i < 8; i++ {
+		entries = append(entries, label(entry(fmt.Sprintf("F%d", i), "NG", "5816", 700), true))
+	}
+	entries = append(entries, label(entry("L0", "NG", "5816", 700), false))
+	// Groceries in NG and digital goods elsewhere are mostly legitimate
+	for i := 0; i < 10; i++ {
+		entries = append(entries, label(entry(fmt.Sprintf("G%d", i), "NG", "5411", 700), false))
+		entries = append(entries, label(entry(fmt.Sprintf("D%d", i), "US", "5816", 700), false))
+	}
+	entries = append(entries, entry("U0", "NG", "5816", 700))
+
+	result := nearmiss.Mine(entries, nearmiss.MiningConfig{MinSupport: 5, MinPrecision: 0.8})
+	assert.Equal(t, 29, result.Labeled, "unlabeled near misses are left out")
+	assert.Equal(t, 8, result.Fraud)
+	require.NotEmpty(t, result.Proposals)
+
+	best := result.Proposals[0]
+	assert.Equal(t, "tx.mcc == '5816' && tx.merchant_country == 'NG'", best.Expression)
+	assert.Equal(t, 8, best.Support)
+	assert.Equal(t, 9, best.Matched)
+	assert.InDelta(t, 8.0/9.0, best.Precision, 1e-9)
+	assert.Greater(t, best.Lift, 1.0)
+	for _, proposal := range result.Proposals {
+		assert.GreaterOrEqual(t, proposal.Precision, 0.8)
+		assert.NotEqual(t, []string{"tx.merchant_country == 'NG'"}, proposal.Conditions, "NG alone is not precise")
+	}
+}
+
+func TestMine_NotEnoughFraud(t *testing.T) {
+	fraud := true
+	e := entry("F1", "NG", "5816", 700)
+	e.Fraud = &fraud
+
+	result := nearmiss.Mine([]nearmiss.Entry{e}, nearmiss.MiningConfig{})
+	assert.Empty(t, result.Proposals)
+	assert.Equal(t, 1, result.Fraud)
+}
@@ -0,0 +1,256 @@
+// Package network correlates risky decisions across merchants. An account or
+// device sent to review or declined at many different merchants within a
+// window is likely working through a list of targets, such as with stolen
+// credentials, so the engine raises a network-level alert on it and may
+// escalate its next transactions everywhere for a while.
+package network
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config holds the correlation settings. An entity alerts once its risky
+// decisions of the last Window span at least MinMerchants merchants; with
+// EscalateFor set, its transactions are escalated for that long after.
+type Config struct {
+	Window       time.Duration
+	MinMerchants int
+	EscalateFor  time.Duration
+}
+
+// DefaultConfig returns the default correlation settings, alerting without
+// escalating
+func DefaultConfig() Config {
+	return Config{
+		Window:       time.Hour,
+		MinMerchants: 3,
+	}
+}
+
+// Validate checks the window and the merchant count
+func (c Config) Validate() error {
+	switch {
+	case c.Window <= 0:
+		return fmt.Errorf("window must be positive")
+	case c.MinMerchants < 2:
+		return fmt.Errorf("min merchants %d must be at least 2", c.MinMerchants)
+	case c.EscalateFor < 0:
+		return fmt.Errorf("escalation period must not be negative")
+	}
+	return nil
+}
+
+// Alert is raised on an entity, such as "account:ACC-1" or "device:DEV-1",
+// risky at many merchants
+type Alert struct {
+	Entity string `json:"entity"`
+	// Merchants are those that sent the entity to review or declined it
+	// within the window, and Decisions counts those decisions
+	Merchants []string  `json:"merchants"`
+	Decisions int       `json:"decisions"`
+	FirstAt   time.Time `json:"first_at" doc:"The earliest risky decision of the window"`
+	RaisedAt  time.Time `json:"raised_at"`
+	// EscalateUntil is when the escalation of the entity's transactions
+	// ends, nil when they are not escalated
+	EscalateUntil *time.Time `json:"escalate_until,omitempty"`
+}
+
+// Escalated reports whether the transactions of the alert's entity are
+// escalated at a time
+func (a Alert) Escalated(at time.Time) bool {
+	return a.EscalateUntil != nil && at.Before(*a.EscalateUntil)
+}
+
+// maxSightings caps the risky decisions kept per entity within the window
+const maxSightings = 1000
+
+// sighting is a risky decision of an entity at a merchant
+type sighting struct {
+	merchantID string
+	at         time.Time
+}
+
+type entity struct {
+	sightings []sighting
+	// alert is the latest alert on the entity, nil until one is raised or
+	// once cleared. alerted is set while the entity stays at the merchant
+	// count after an alert, so one run raises one alert.
+	alert   *Alert
+	alerted bool
+}
+
+// Correlator tracks the risky decisions of every entity
+type Correlator struct {
+	config   Config
+	entities map[string]*entity
+	swept    time.Time
+	// onAlert is told of every alert raised
+	onAlert func(Alert)
+	mu      sync.Mutex
+}
+
+// New creates a correlator
+func New(config Config) (*Correlator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Correlator{config: config, entities: make(map[string]*entity)}, nil
+}
+
+// OnAlert sets the function told of every alert raised
+func (c *Correlator) OnAlert(fn func(Alert)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onAlert = fn
+}
+
+// Observe counts a decision of a merchant against its entities, risky being
+// a REVIEW or a decline, and returns the alerts it raised
+func (c *Correlator) Observe(entities []string, merchantID string, risky bool, at time.Time) []Alert {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(at)
+	if !risky || merchantID == "" {
+		return nil
+	}
+	var raised []Alert
+	for _, key := range entities {
+		e := c.entities[key]
+		if e == nil {
+			e = &entity{}
+			c.entities[key] = e
+		}
+		c.expire(e, at)
+		if len(e.sightings) == maxSightings {
+			e.sightings = e.sightings[1:]
+		}
+		e.sightings = append(e.sightings, sighting{merchantID: merchantID, at: at})
+
+		merchants := e.merchants()
+		if len(merchants) < c.config.MinMerchants {
+			e.alerted = false
+			continue
+		}
+		if e.alerted {
+			continue
+		}
+		alert := Alert{
+			Entity:    key,
+			Merchants: merchants,
+			Decisions: len(e.sightings),
+			FirstAt:   e.sightings[0].at,
+			RaisedAt:  at,
+		}
+		if c.config.EscalateFor > 0 {
+			until := at.Add(c.config.EscalateFor)
+			alert.EscalateUntil = &until
+		}
+		e.alert, e.alerted = &alert, true
+		raised = append(raised, alert)
+		if c.onAlert != nil {
+			c.onAlert(alert)
+		}
+	}
+	return raised
+}
+
+// Escalated returns the alert escalating the transactions of one of the
+// entities at a time, if any
+func (c *Correlator) Escalated(entities []string, at time.Time) (Alert, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range entities {
+		if e := c.entities[key]; e != nil && e.alert != nil && e.alert.Escalated(at) {
+			return *e.alert, true
+		}
+	}
+	return Alert{}, false
+}
+
+// Alerts returns the latest alert of every entity raised within the window
+// or still escalated, the most recent first
+func (c *Correlator) Alerts(now time.Time) []Alert {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	alerts := []Alert{}
+	for _, e := range c.entities {
+		if e.alert != nil && c.current(e.alert, now) {
+			alerts = append(alerts, *e.alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].RaisedAt.Equal(alerts[j].RaisedAt) {
+			return alerts[i].RaisedAt.After(alerts[j].RaisedAt)
+		}
+		return alerts[i].Entity < alerts[j].Entity
+	})
+	return alerts
+}
+
+// Clear lifts the alert and escalation of an entity, as when an analyst has
+// found its decisions legitimate, returning the alert lifted. The entity is
+// not alerted again until it falls below the merchant count and reaches it
+// again.
+func (c *Correlator) Clear(key string, now time.Time) (Alert, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entities[key]
+	if e == nil || e.alert == nil || !c.current(e.alert, now) {
+		return Alert{}, false
+	}
+	alert := *e.alert
+	e.alert = nil
+	return alert, true
+}
+
+// current reports whether an alert is within the window or escalating
+func (c *Correlator) current(alert *Alert, now time.Time) bool {
+	return now.Sub(alert.RaisedAt) < c.config.Window || alert.Escalated(now)
+}
+
+// expire drops the sightings of an entity older than the window. Callers
+// must hold the lock.
+func (c *Correlator) expire(e *entity, now time.Time) {
+	cutoff := now.Add(-c.config.Window)
+	drop := 0
+	for drop < len(e.sightings) && !e.sightings[drop].at.After(cutoff) {
+		drop++
+	}
+	e.sightings = e.sightings[drop:]
+}
+
+// sweep forgets the entities with nothing left in the window once per
+// window, so entities seen once do not pile up. Callers must hold the lock.
+func (c *Correlator) sweep(now time.Time) {
+	if now.Sub(c.swept) < c.config.Window {
+		return
+	}
+	c.swept = now
+	for key, e := range c.entities {
+		c.expire(e, now)
+		if len(e.sightings) == 0 && (e.alert == nil || !c.current(e.alert, now)) {
+			delete(c.entities, key)
+		}
+	}
+}
+
+// merchants returns the distinct merchants of the sightings, sorted
+func (e *entity) merchants() []string {
+	seen := make(map[string]bool)
+	var merchants []string
+	for _, s := range e.sightings {
+		if !seen[s.merchantID] {
+			seen[s.merchantID] = true
+			merchants = append(merchants, s.merchantID)
+		}
+	}
+	sort.Strings(merchants)
+	return merchants
+}
@@ -0,0 +1,98 @@
+package network_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+func correlator(t *testing.T, escalateFor time.Duration) *network.Correlator {
+	t.Helper()
+	config := network.DefaultConfig()
+	config.EscalateFor = escalateFor
+	c, err := network.New(config)
+	require.NoError(t, err)
+	return c
+}
+
+func TestCorrelator_AlertsAcrossMerchants(t *testing.T) {
+	c := correlator(t, 0)
+	var told []network.Alert
+	c.OnAlert(func(alert network.Alert) { told = append(told, alert) })
+	device := []string{"device:DEV-1"}
+
+	assert.Empty(t, c.Observe(device, "M1", true, start))
+	assert.Empty(t, c.Observe(device, "M1", true, start.Add(time.Minute)), "one merchant twice is not a network")
+	assert.Empty(t, c.Observe(device, "M2", false, start.Add(2*time.Minute)), "approvals are not counted")
+	assert.Empty(t, c.Observe(device, "M2", true, start.Add(3*time.Minute)))
+	raised := c.Observe(device, "M3", true, start.Add(4*time.Minute))
+	require.Len(t, raised, 1)
+
+	alert := raised[0]
+	assert.Equal(t, "device:DEV-1", alert.Entity)
+	assert.Equal(t, []string{"M1", "M2", "M3"}, alert.Merchants)
+	assert.Equal(t, 4, alert.Decisions)
+	assert.Equal(t, start, alert.FirstAt)
+	assert.Nil(t, alert.EscalateUntil)
+	assert.Equal(t, raised, told)
+
+	assert.Empty(t, c.Observe(device, "M4", true, start.Add(5*time.Minute)), "a run raises one alert")
+	_, escalated := c.Escalated(device, start.Add(5*time.Minute))
+	assert.False(t, escalated, "escalation is off by default")
+	assert.Len(t, c.Alerts(start.Add(10*time.Minute)), 1)
+	assert.Empty(t, c.Alerts(start.Add(2*time.Hour)), "alerts age out with the window")
+}
+
+func TestCorrelator_WindowAndRealert(t *testing.T) {
+	c := correlator(t, 0)
+	account := []string{"account:ACC-1"}
+	c.Observe(account, "M1", true, start)
+	c.Observe(account, "M2", true, start.Add(30*time.Minute))
+	assert.Empty(t, c.Observe(account, "M3", true, start.Add(70*time.Minute)), "M1 fell out of the window")
+	assert.Len(t, c.Observe(account, "M4", true, start.Add(80*time.Minute)), 1)
+
+	// Back below the count after the window, then at it again
+	c.Observe(account, "M5", true, start.Add(4*time.Hour))
+	c.Observe(account, "M6", true, start.Add(4*time.Hour+time.Minute))
+	assert.Len(t, c.Observe(account, "M7", true, start.Add(4*time.Hour+2*time.Minute)), 1)
+}
+
+func TestCorrelator_EscalatesAndClears(t *testing.T) {
+	c := correlator(t, 24*time.Hour)
+	entities := []string{"account:ACC-1", "device:DEV-1"}
+	for i, merchant := range []string{"M1", "M2", "M3"} {
+		c.Observe(entities, merchant, true, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	alert, escalated := c.Escalated([]string{"account:ACC-9", "device:DEV-1"}, start.Add(12*time.Hour))
+	require.True(t, escalated, "any escalated entity escalates the transaction")
+	assert.Equal(t, "device:DEV-1", alert.Entity)
+	require.NotNil(t, alert.EscalateUntil)
+	assert.Equal(t, start.Add(24*time.Hour+2*time.Minute), *alert.EscalateUntil)
+	assert.Len(t, c.Alerts(start.Add(12*time.Hour)), 2, "escalated alerts are listed past the window")
+	_, escalated = c.Escalated(entities, start.Add(27*time.Hour))
+	assert.False(t, escalated)
+
+	cleared, ok := c.Clear("device:DEV-1", start.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, "device:DEV-1", cleared.Entity)
+	_, ok = c.Clear("device:DEV-1", start.Add(time.Hour))
+	assert.False(t, ok)
+	_, ok = c.Clear("device:DEV-9", start.Add(time.Hour))
+	assert.False(t, ok)
+	_, escalated = c.Escalated([]string{"device:DEV-1"}, start.Add(time.Hour))
+	assert.False(t, escalated)
+	assert.Empty(t, c.Observe([]string{"device:DEV-1"}, "M4", true, start.Add(time.Hour)), "a cleared run is not alerted again")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, network.DefaultConfig().Validate())
+	assert.Error(t, network.Config{Window: time.Hour, MinMerchants: 1}.Validate())
+	assert.Error(t, network.Config{MinMerchants: 3}.Validate())
+	assert.Error(t, network.Config{Window: time.Hour, MinMerchants: 3, EscalateFor: -time.Hour}.Validate())
+}
@@ -0,0 +1,247 @@
+// Package objectstore downloads objects from Amazon S3 and Google Cloud
+// Storage over their HTTP APIs. S3 requests are signed with AWS Signature
+// Version 4, so S3 compatible stores work too; GCS requests carry an OAuth
+// 2.0 access token.
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schemes of object locations
+const (
+	SchemeS3  = "s3"
+	SchemeGCS = "gs"
+)
+
+// MaxObjectSize bounds the objects Get reads
+const MaxObjectSize = 64 << 20
+
+// emptyHash is the SHA-256 of an empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Config holds the credentials and endpoints of the object stores
+type Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	// S3Endpoint replaces the AWS endpoint for S3 compatible stores, which
+	// are addressed path-style
+	S3Endpoint string
+	// GCSToken is an OAuth 2.0 access token for Google Cloud Storage
+	GCSToken    string
+	GCSEndpoint string
+	Timeout     time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.GCSEndpoint == "" {
+		c.GCSEndpoint = "https://storage.googleapis.com"
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	return c
+}
+
+// Client downloads objects
+type Client struct {
+	config Config
+	client *http.Client
+}
+
+func NewClient(config Config) *Client {
+	config = config.withDefaults()
+	return &Client{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+// IsObject reports whether a location is an s3:// or gs:// URL
+func IsObject(location string) bool {
+	return strings.HasPrefix(location, SchemeS3+"://") || strings.HasPrefix(location, SchemeGCS+"://")
+}
+
+// Get downloads the object at an s3://bucket/key or gs://bucket/object URL
+func (c *Client) Get(ctx context.Context, location string) ([]byte, error) {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Host == "" || strings.Trim(parsed.Path, "/") == "" {
+		return nil, fmt.Errorf("invalid object location %q", location)
+	}
+	bucket, key := parsed.Host, strings.TrimPrefix(parsed.Path, "/")
+
+	var req *http.Request
+	switch parsed.Scheme {
+	case SchemeS3:
+		req, err = c.s3Request(ctx, bucket, key)
+	case SchemeGCS:
+		req, err = c.gcsRequest(ctx, bucket, key)
+	default:
+		return nil, fmt.Errorf("unsupported object store scheme %q", parsed.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("fetching %s: %s: %s", location, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxObjectSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", location, err)
+	}
+	if len(data) > MaxObjectSize {
+		return nil, fmt.Errorf("object %s is larger than %d bytes", location, MaxObjectSize)
+	}
+	return data, nil
+}
+
+func (c *Client) s3Request(ctx context.Context, bucket, key string) (*http.Request, error) {
+	target := "https://" + bucket + ".s3." + c.config.Region + ".amazonaws.com/" + escapePath(key)
+	if c.config.S3Endpoint != "" {
+		target = strings.TrimSuffix(c.config.S3Endpoint, "/") + "/" + bucket + "/" + escapePath(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.AccessKeyID == "" || c.config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 credentials are not configured")
+	}
+	if c.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.config.SessionToken)
+	}
+	SignV4(req, c.config.AccessKeyID, c.config.SecretAccessKey, c.config.Region, "s3", time.Now())
+	return req, nil
+}
+
+func (c *Client) gcsRequest(ctx context.Context, bucket, key string) (*http.Request, error) {
+	target := strings.TrimSuffix(c.config.GCSEndpoint, "/") + "/" + bucket + "/" + escapePath(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.GCSToken == "" {
+		return nil, fmt.Errorf("GCS access token is not configured")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.GCSToken)
+	return req, nil
+}
+
+// SignV4 signs a request without a body with AWS Signature Version 4. The
+// host, Range and X-Amz-* headers are signed.
+func SignV4(req *http.Request, accessKeyID, secretAccessKey, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		vals := append([]string(nil), values[key]...)
+		sort.Strings(vals)
+		for _, value := range vals {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath escapes each segment of an object key
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
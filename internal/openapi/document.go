@@ -0,0 +1,204 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+)
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+
+	types map[reflect.Type]string
+	mu    sync.RWMutex
+}
+
+// Info describes the API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Components holds reusable schemas
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Operation is a single method on a path
+type Operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+
+	invalidCode apierror.Code
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes a JSON request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Endpoint describes an API endpoint to register
+type Endpoint struct {
+	Method  string
+	Path    string // may contain {param} segments
+	Summary string
+	// Request is a value of the request body type, nil when there is none
+	Request interface{}
+	// Response is a value of the success response type, nil for a bare object
+	Response interface{}
+	// Status is the success status code, 200 when zero
+	Status int
+	// Query lists optional query parameters
+	Query []string
+	// InvalidCode is the error code of request bodies failing validation,
+	// apierror.InvalidRequest when empty
+	InvalidCode apierror.Code
+}
+
+// NewDocument creates an empty document
+func NewDocument(title, version string) *Document {
+	return &Document{
+		OpenAPI:    "3.0.3",
+		Info:       Info{Title: title, Version: version},
+		Paths:      map[string]map[string]*Operation{},
+		Components: Components{Schemas: map[string]*Schema{}},
+		types:      map[reflect.Type]string{},
+	}
+}
+
+// Register adds an endpoint to the document
+func (d *Document) Register(e Endpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	op := &Operation{
+		Summary:     e.Summary,
+		invalidCode: e.InvalidCode,
+		Responses:   map[string]*Response{},
+	}
+
+	for _, segment := range strings.Split(e.Path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     strings.Trim(segment, "{}"),
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	for _, name := range e.Query {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:   name,
+			In:     "query",
+			Schema: &Schema{Type: "string"},
+		})
+	}
+
+	if e.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: d.schemaFor(reflect.TypeOf(e.Request))},
+			},
+		}
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := &Response{Description: http.StatusText(status)}
+	responseSchema := &Schema{Type: "object"}
+	if e.Response != nil {
+		responseSchema = d.schemaFor(reflect.TypeOf(e.Response))
+	}
+	response.Content = map[string]MediaType{"application/json": {Schema: responseSchema}}
+	op.Responses[strconv.Itoa(status)] = response
+	op.Responses["default"] = &Response{
+		Description: "Error",
+		Content: map[string]MediaType{
+			"application/json": {Schema: d.schemaFor(reflect.TypeOf(apierror.ErrorResponse{}))},
+		},
+	}
+
+	if d.Paths[e.Path] == nil {
+		d.Paths[e.Path] = map[string]*Operation{}
+	}
+	d.Paths[e.Path][strings.ToLower(e.Method)] = op
+}
+
+// operation finds the operation matching a request path, treating {param}
+// segments as wildcards
+func (d *Document) operation(method, path string) *Operation {
+	method = strings.ToLower(method)
+	if ops, exists := d.Paths[path]; exists {
+		return ops[method]
+	}
+
+	segments := strings.Split(path, "/")
+	for template, ops := range d.Paths {
+		if matchTemplate(strings.Split(template, "/"), segments) {
+			if op := ops[method]; op != nil {
+				return op
+			}
+		}
+	}
+	return nil
+}
+
+func matchTemplate(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, part := range template {
+		if strings.HasPrefix(part, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve follows a component reference
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
@@ -0,0 +1,145 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	SKU      string  `json:"sku" openapi:"required"`
+	Quantity int     `json:"quantity" openapi:"minimum=1"`
+	Price    float64 `json:"price" openapi:"exclusiveMinimum=0"`
+}
+
+type order struct {
+	ID        string            `json:"id" openapi:"required,minLength=1"`
+	Status    string            `json:"status,omitempty" openapi:"enum=open|closed"`
+	Items     []item            `json:"items" openapi:"required,minItems=1,maxItems=2"`
+	Placed    time.Time         `json:"placed" doc:"When the order was placed"`
+	Note      *string           `json:"note,omitempty"`
+	Total     float64           `json:"total" openapi:"readOnly"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Internal  string            `json:"-"`
+	unexposed string
+}
+
+type Audit struct {
+	CreatedBy string `json:"created_by" openapi:"required"`
+}
+
+type receipt struct {
+	OrderID string `json:"order_id"`
+	Audit
+}
+
+func newDocument() *openapi.Document {
+	doc := openapi.NewDocument("Test", "v1")
+	doc.Register(openapi.Endpoint{Method: http.MethodPost, Path: "/orders", Request: order{}, Status: http.StatusCreated})
+	doc.Register(openapi.Endpoint{Method: http.MethodPut, Path: "/orders/{id}", Request: order{}})
+	return doc
+}
+
+func TestDocument_SchemaGeneration(t *testing.T) {
+	doc := newDocument()
+
+	schema := doc.Components.Schemas["order"]
+	require.NotNil(t, schema)
+	assert.Equal(t, []string{"id", "items"}, schema.Required)
+	assert.Equal(t, "date-time", schema.Properties["placed"].Format)
+	assert.Equal(t, "When the order was placed", schema.Properties["placed"].Description)
+	assert.Equal(t, "#/components/schemas/item", schema.Properties["items"].Items.Ref)
+	assert.True(t, schema.Properties["total"].ReadOnly)
+	assert.NotContains(t, schema.Properties, "Internal")
+	assert.NotContains(t, schema.Properties, "unexposed")
+	assert.NotNil(t, doc.Components.Schemas["item"])
+
+	op := doc.Paths["/orders/{id}"]["put"]
+	require.NotNil(t, op)
+	require.Len(t, op.Parameters, 1)
+	assert.Equal(t, "id", op.Parameters[0].Name)
+	assert.Contains(t, doc.Paths["/orders"]["post"].Responses, "201")
+}
+
+func TestDocument_FlattensEmbeddedStructs(t *testing.T) {
+	doc := openapi.NewDocument("Test", "v1")
+	doc.Register(openapi.Endpoint{Method: http.MethodGet, Path: "/receipts", Response: receipt{}})
+
+	schema := doc.Components.Schemas["receipt"]
+	require.NotNil(t, schema)
+	assert.Contains(t, schema.Properties, "order_id")
+	assert.Contains(t, schema.Properties, "created_by")
+	assert.NotContains(t, schema.Properties, "Audit")
+	assert.Equal(t, []string{"created_by"}, schema.Required)
+}
+
+func TestDocument_Validate(t *testing.T) {
+	doc := newDocument()
+	schema := &openapi.Schema{Ref: "#/components/schemas/order"}
+
+	decode := func(body string) interface{} {
+		var v interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &v))
+		return v
+	}
+
+	errs := doc.Validate(schema, decode(`{"id":"o1","items":[{"sku":"A","quantity":1,"price":2.5}],"placed":"2024-01-01T10:00:00Z"}`))
+	assert.Empty(t, errs)
+
+	errs = doc.Validate(schema, decode(`{"items":[]}`))
+	assert.Contains(t, errs, "id: is required")
+	assert.Contains(t, errs, "items: must contain at least 1 items")
+
+	errs = doc.Validate(schema, decode(`{"id":"o1","status":"lost","items":[{"quantity":0.5,"price":0}],"placed":"yesterday","note":null}`))
+	assert.Contains(t, errs, "status: must be one of open, closed")
+	assert.Contains(t, errs, "items[0].sku: is required")
+	assert.Contains(t, errs, "items[0].quantity: expected integer")
+	assert.Contains(t, errs, "items[0].price: must be greater than 0")
+	assert.Contains(t, errs, "placed: must be an RFC 3339 date-time")
+	assert.Len(t, errs, 6)
+
+	errs = doc.Validate(schema, decode(`{"id":7,"items":"none"}`))
+	assert.Contains(t, errs, "id: expected string")
+	assert.Contains(t, errs, "items: expected array")
+}
+
+func TestDocument_Middleware(t *testing.T) {
+	doc := newDocument()
+	var received string
+	handler := doc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var o order
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&o))
+		received = o.ID
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/orders/o9", strings.NewReader(`{"id":"o9","items":[{"sku":"A"}]}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "o9", received, "body is passed on after validation")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"items":[]}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var failure apierror.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failure))
+	assert.Equal(t, apierror.InvalidRequest, failure.Error.Code)
+	assert.Contains(t, failure.Error.Details, "id: is required")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Invalid JSON")
+
+	rec = httptest.NewRecorder()
+	doc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"openapi":"3.0.3"`)
+}
@@ -0,0 +1,210 @@
+// Package openapi builds an OpenAPI 3 document from the API's Go types and
+// validates requests against it, so the published contract and the server
+// cannot drift apart.
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used by the API
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of a Go type, registering named structs as
+// components and referencing them
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Ptr:
+		schema := d.schemaFor(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		// Like encoding/json, null decodes to an empty slice or map
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem()), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: true, Nullable: true}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name, known := d.types[t]
+		if !known {
+			name = t.Name()
+			if _, taken := d.Components.Schemas[name]; taken {
+				// Same name from another package
+				name = pkgName(t) + name
+			}
+			// Register before recursing so self-references terminate
+			d.types[t] = name
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == field.Name && field.Type.Kind() == reflect.Struct {
+			// Embedded structs are flattened, like encoding/json does
+			embedded := d.structSchema(field.Type)
+			for name, prop := range embedded.Properties {
+				schema.Properties[name] = prop
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		prop := d.schemaFor(field.Type)
+		if description := field.Tag.Get("doc"); description != "" {
+			if prop.Ref != "" {
+				// Siblings of $ref are ignored, wrap the reference instead
+				prop = &Schema{Description: description, AllOf: []*Schema{prop}}
+			} else {
+				prop.Description = description
+			}
+		}
+		if applyConstraints(prop, field.Tag.Get("openapi")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = prop
+	}
+	return schema
+}
+
+func pkgName(t reflect.Type) string {
+	path := t.PkgPath()
+	name := path[strings.LastIndex(path, "/")+1:]
+	if name == "" {
+		return ""
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// applyConstraints applies an `openapi:"required,minimum=0,enum=a|b"` tag to
+// a schema and reports whether the field is required
+func applyConstraints(schema *Schema, tag string) bool {
+	required := false
+	if tag == "" {
+		return required
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "required":
+			required = true
+		case "minimum":
+			schema.Minimum = parseFloat(value)
+		case "exclusiveMinimum":
+			schema.Minimum = parseFloat(value)
+			schema.ExclusiveMinimum = true
+		case "maximum":
+			schema.Maximum = parseFloat(value)
+		case "minLength":
+			schema.MinLength = parseInt(value)
+		case "minItems":
+			schema.MinItems = parseInt(value)
+		case "maxItems":
+			schema.MaxItems = parseInt(value)
+		case "enum":
+			schema.Enum = strings.Split(value, "|")
+		case "format":
+			schema.Format = value
+		case "readOnly":
+			schema.ReadOnly = true
+		default:
+			panic(fmt.Sprintf("openapi: unknown constraint %q", key))
+		}
+	}
+	return required
+}
+
+func parseFloat(s string) *float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: invalid number %q", s))
+	}
+	return &v
+}
+
+func parseInt(s string) *int {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: invalid integer %q", s))
+	}
+	return &v
+}
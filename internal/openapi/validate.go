@@ -0,0 +1,209 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+)
+
+// maxBodyBytes bounds request bodies read for validation
+const maxBodyBytes = 10 << 20
+
+// Validate checks a decoded JSON value against a schema and returns one
+// message per violation
+func (d *Document) Validate(schema *Schema, value interface{}) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	errs := []string{}
+	d.validate(schema, value, "", &errs)
+	return errs
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, path string, errs *[]string) {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return
+	}
+	for _, sub := range schema.AllOf {
+		d.validate(sub, value, path, errs)
+	}
+	if value == nil {
+		if schema.Type != "" && !schema.Nullable {
+			*errs = append(*errs, fmt.Sprintf("%s: must not be null", label(path)))
+		}
+		return
+	}
+
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, label(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("expected object")
+			return
+		}
+		for _, name := range schema.Required {
+			if _, present := obj[name]; !present {
+				*errs = append(*errs, fmt.Sprintf("%s: is required", join(path, name)))
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, known := schema.Properties[name]; known {
+				d.validate(prop, obj[name], join(path, name), errs)
+			}
+		}
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("expected array")
+			return
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			fail("must contain at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			fail("must contain at most %d items", *schema.MaxItems)
+		}
+		for i, item := range items {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("expected string")
+			return
+		}
+		if schema.MinLength != nil && len(str) < *schema.MinLength {
+			fail("must be at least %d characters", *schema.MinLength)
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, str) {
+			fail("must be one of %s", strings.Join(schema.Enum, ", "))
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				fail("must be an RFC 3339 date-time")
+			}
+		}
+
+	case "number", "integer":
+		num, ok := value.(float64)
+		if !ok {
+			fail("expected %s", schema.Type)
+			return
+		}
+		if schema.Type == "integer" && num != float64(int64(num)) {
+			fail("expected integer")
+		}
+		if schema.Minimum != nil {
+			if schema.ExclusiveMinimum && num <= *schema.Minimum {
+				fail("must be greater than %v", *schema.Minimum)
+			} else if !schema.ExclusiveMinimum && num < *schema.Minimum {
+				fail("must be at least %v", *schema.Minimum)
+			}
+		}
+		if schema.Maximum != nil && num > *schema.Maximum {
+			fail("must be at most %v", *schema.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected boolean")
+		}
+	}
+}
+
+// Middleware validates JSON request bodies of registered operations before
+// passing the request on
+func (d *Document) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.RLock()
+		op := d.operation(r.Method, r.URL.Path)
+		d.mu.RUnlock()
+
+		if op == nil || op.RequestBody == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			apierror.Write(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			apierror.Write(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if errs := d.Validate(op.RequestBody.Content["application/json"].Schema, value); len(errs) > 0 {
+			code := op.invalidCode
+			if code == "" {
+				code = apierror.InvalidRequest
+			}
+			apierror.WriteCode(w, http.StatusBadRequest, code, "Invalid request: "+strings.Join(errs, "; "), errs...)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP serves the document as JSON
+func (d *Document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		apierror.Write(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func label(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package partition
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// ForwardedHeader names the replica a request was forwarded by. Forwarded
+// requests are signed with the secret the replicas share and always handled
+// where they arrive, so replicas disagreeing on the ring cannot loop.
+const ForwardedHeader = "X-Fraud-Forwarded-By"
+
+// maxBodyBytes bounds the requests read to find their owner
+const maxBodyBytes = 16 << 20
+
+// Keys returns the partition keys of a request body, such as the accounts of
+// the transactions it analyzes
+type Keys func(body []byte) []string
+
+// Forwarder sends requests to the replica owning their keys
+type Forwarder struct {
+	// Self is the node of this replica on the ring
+	Self   string
+	Ring   *Ring
+	Client *http.Client
+	Secret string
+}
+
+// NewForwarder creates the forwarder of the replica self, which must be a
+// node of the ring
+func NewForwarder(self string, ring *Ring, secret string, timeout time.Duration) *Forwarder {
+	return &Forwarder{Self: self, Ring: ring, Client: &http.Client{Timeout: timeout}, Secret: secret}
+}
+
+// Owner returns the node owning every key, or "" when the keys are owned by
+// several nodes or there are none
+func (f *Forwarder) Owner(keys []string) string {
+	owner := ""
+	for _, key := range keys {
+		if key == "" {
+			return ""
+		}
+		node := f.Ring.Owner(key)
+		if owner != "" && node != owner {
+			return ""
+		}
+		owner = node
+	}
+	return owner
+}
+
+// Handler forwards the requests whose keys another replica owns to it and
+// hands the rest to next. Requests without a single owner, and requests
+// whose owner cannot be reached, are handled locally.
+func (f *Forwarder) Handler(keys Keys, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			apierror.Write(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if by := r.Header.Get(ForwardedHeader); by != "" {
+			if err := events.VerifySignature(f.Secret, r.Header.Get(events.SignatureHeader), body, events.DefaultTolerance, time.Now()); err != nil {
+				apierror.Write(w, "invalid forwarded request: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		owner := f.Owner(keys(body))
+		if owner == "" || owner == f.Self {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := f.forward(w, r, owner, body); err != nil {
+			log.Printf("Failed to forward %s to %s, handling locally: %v", r.URL.Path, owner, err)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// forward relays a request to its owner and the response back. It fails
+// only before anything is written, so the caller can fall back.
+func (f *Forwarder) forward(w http.ResponseWriter, r *http.Request, owner string, body []byte) error {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, strings.TrimSuffix(owner, "/")+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Set(ForwardedHeader, f.Self)
+	req.Header.Set(events.SignatureHeader, events.Sign(f.Secret, time.Now(), body))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("Error relaying the response of %s: %v", owner, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package partition_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/partition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "shared-secret"
+
+func accountKeys(body []byte) []string {
+	var req struct {
+		Accounts []string `json:"accounts"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+	return req.Accounts
+}
+
+// replica is a test server answering with its name and the body it got
+type replica struct {
+	name      string
+	server    *httptest.Server
+	forwarder *partition.Forwarder
+}
+
+func newReplicas(t *testing.T) (*replica, *replica) {
+	a, b := &replica{name: "a"}, &replica{name: "b"}
+	for _, r := range []*replica{a, b} {
+		r := r
+		r.server = httptest.NewServer(nil)
+		t.Cleanup(r.server.Close)
+	}
+	ring, err := partition.NewRing([]string{a.server.URL, b.server.URL}, 0)
+	require.NoError(t, err)
+	for _, r := range []*replica{a, b} {
+		r := r
+		r.forwarder = partition.NewForwarder(r.server.URL, ring, secret, time.Second)
+		r.server.Config.Handler = r.forwarder.Handler(accountKeys, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			w.Header().Set("X-Replica", r.name)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}))
+	}
+	return a, b
+}
+
+// accountOwnedBy returns an account the ring places on node
+func accountOwnedBy(t *testing.T, f *partition.Forwarder, node string) string {
+	for i := 0; i < 1000; i++ {
+		if account := fmt.Sprintf("ACC-%d", i); f.Ring.Owner(account) == node {
+			return account
+		}
+	}
+	t.Fatalf("no account owned by %s", node)
+	return ""
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	resp, err := http.Post(url+"/fraud/analyze", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestForwarder_RoutesToOwner(t *testing.T) {
+	a, b := newReplicas(t)
+	account := accountOwnedBy(t, a.forwarder, b.server.URL)
+	body := `{"accounts":["` + account + `"]}`
+
+	resp := post(t, a.server.URL, body)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "b", resp.Header.Get("X-Replica"))
+	relayed, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, body, string(relayed))
+
+	resp = post(t, b.server.URL, body)
+	assert.Equal(t, "b", resp.Header.Get("X-Replica"), "the owner handles its accounts")
+}
+
+func TestForwarder_HandlesMixedOwnersLocally(t *testing.T) {
+	a, b := newReplicas(t)
+	mixed := `{"accounts":["` + accountOwnedBy(t, a.forwarder, a.server.URL) + `","` + accountOwnedBy(t, a.forwarder, b.server.URL) + `"]}`
+	assert.Equal(t, "a", post(t, a.server.URL, mixed).Header.Get("X-Replica"))
+	assert.Equal(t, "a", post(t, a.server.URL, `{}`).Header.Get("X-Replica"))
+}
+
+func TestForwarder_FallsBackWhenOwnerIsDown(t *testing.T) {
+	a, b := newReplicas(t)
+	account := accountOwnedBy(t, a.forwarder, b.server.URL)
+	b.server.Close()
+
+	resp := post(t, a.server.URL, `{"accounts":["`+account+`"]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "a", resp.Header.Get("X-Replica"))
+}
+
+func TestForwarder_RejectsUnsignedForwards(t *testing.T) {
+	a, _ := newReplicas(t)
+	req, err := http.NewRequest(http.MethodPost, a.server.URL+"/fraud/analyze", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	req.Header.Set(partition.ForwardedHeader, "http://elsewhere")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,89 @@
+// Package partition shards the in-memory state of the engine across its
+// replicas. Accounts are placed on a consistent hash ring of the replicas,
+// and a replica receiving the analysis of an account it does not own
+// forwards it to the owner, so the velocity, geo and profile state of every
+// account lives on one replica. Adding or removing a replica only moves the
+// accounts of its share of the ring.
+package partition
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes is the number of points each node has on the ring
+const DefaultVirtualNodes = 128
+
+// Ring places keys on nodes by consistent hashing
+type Ring struct {
+	nodes  []string
+	points []uint64
+	owners map[uint64]string
+}
+
+// NewRing places nodes on a ring with the given virtual nodes each, or
+// DefaultVirtualNodes when not positive
+func NewRing(nodes []string, virtualNodes int) (*Ring, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("a ring needs at least one node")
+	}
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &Ring{owners: make(map[uint64]string, len(nodes)*virtualNodes)}
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if node == "" || seen[node] {
+			return nil, fmt.Errorf("invalid or duplicate node %q", node)
+		}
+		seen[node] = true
+		r.nodes = append(r.nodes, node)
+		for i := 0; i < virtualNodes; i++ {
+			point := hash(node + "#" + strconv.Itoa(i))
+			// Of two nodes colliding on a point, the smaller name keeps it on
+			// every replica whatever the order nodes are listed in
+			if owner, exists := r.owners[point]; exists && owner < node {
+				continue
+			}
+			if _, exists := r.owners[point]; !exists {
+				r.points = append(r.points, point)
+			}
+			r.owners[point] = node
+		}
+	}
+	sort.Strings(r.nodes)
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r, nil
+}
+
+// Nodes returns the nodes of the ring, sorted
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// Owner returns the node owning a key: the first point of the ring at or
+// after the hash of the key
+func (r *Ring) Owner(key string) string {
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// hash is FNV-1a with a final mix, which spreads keys differing only in
+// their last characters, like the virtual nodes of a node, over the ring
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
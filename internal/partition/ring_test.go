@@ -0,0 +1,62 @@
+package partition_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/partition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing_SpreadsKeysEvenly(t *testing.T) {
+	ring, err := partition.NewRing([]string{"http://a:8080", "http://b:8080", "http://c:8080"}, 0)
+	require.NoError(t, err)
+
+	counts := make(map[string]int)
+	for i := 0; i < 30000; i++ {
+		counts[ring.Owner(fmt.Sprintf("ACC-%d", i))]++
+	}
+	require.Len(t, counts, 3)
+	for node, count := range counts {
+		assert.InDelta(t, 10000, count, 1500, node)
+	}
+}
+
+func TestRing_OwnerIndependentOfNodeOrder(t *testing.T) {
+	a, err := partition.NewRing([]string{"a", "b", "c"}, 64)
+	require.NoError(t, err)
+	b, err := partition.NewRing([]string{"c", "a", "b"}, 64)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, b.Nodes())
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("ACC-%d", i)
+		assert.Equal(t, a.Owner(key), b.Owner(key))
+	}
+}
+
+func TestRing_AddingNodeMovesOnlyItsShare(t *testing.T) {
+	before, err := partition.NewRing([]string{"a", "b", "c"}, 0)
+	require.NoError(t, err)
+	after, err := partition.NewRing([]string{"a", "b", "c", "d"}, 0)
+	require.NoError(t, err)
+
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("ACC-%d", i)
+		if owner := after.Owner(key); owner != before.Owner(key) {
+			assert.Equal(t, "d", owner, "keys only move to the new node")
+			moved++
+		}
+	}
+	assert.InDelta(t, 2500, moved, 600)
+}
+
+func TestNewRing_RejectsInvalidNodes(t *testing.T) {
+	_, err := partition.NewRing(nil, 0)
+	assert.Error(t, err)
+	_, err = partition.NewRing([]string{"a", "a"}, 0)
+	assert.Error(t, err)
+	_, err = partition.NewRing([]string{"a", ""}, 0)
+	assert.Error(t, err)
+}
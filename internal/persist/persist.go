@@ -0,0 +1,475 @@
+// Package persist checkpoints the in-memory velocity and profile state of
+// the detector to disk: periodic snapshots plus a write-ahead log of the
+// updates made since, replayed at startup.
+//
+// The log is split into numbered segments (wal-000001.log, ...). A snapshot
+// records the first segment it does not include, so segments it covers can
+// be deleted and a crash at any point replays each update exactly once.
+//
+// Large states can be restored warm first: only the most recently active
+// accounts are restored before serving, and the others when first used or
+// in the background.
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+const (
+	snapshotFile  = "snapshot.json"
+	segmentFormat = "wal-%06d.log"
+)
+
+// ErrClosed is returned when checkpointing a closed store
+var ErrClosed = errors.New("state store is closed")
+
+// Target is the state being persisted, such as a detector.FraudDetector
+type Target interface {
+	CheckpointState(fn func(detector.State))
+	RestoreState(state detector.State)
+	ReplayState(entry detector.StateEntry)
+}
+
+// AccountTarget is a target whose accounts can be restored one at a time,
+// such as a detector.Detector
+type AccountTarget interface {
+	Target
+	RestoreAccounts(state detector.State)
+	SetAccountLoader(load func(accountID string))
+}
+
+// coldBatch is the number of cold accounts RestoreCold restores at a time
+const coldBatch = 256
+
+// coldAccount is the state of an account kept aside at startup, with its
+// logged updates since the snapshot
+type coldAccount struct {
+	state   detector.State
+	entries []detector.StateEntry
+}
+
+type snapshot struct {
+	// Next is the first log segment the state does not include
+	Next      int            `json:"next"`
+	CreatedAt time.Time      `json:"created_at"`
+	State     detector.State `json:"state"`
+}
+
+// Store appends state updates to the log and writes snapshots. Appends are
+// buffered and only durable after Sync, so a crash loses the updates of at
+// most one sync interval.
+type Store struct {
+	dir     string
+	segment int
+	file    *os.File
+	writer  *bufio.Writer
+	// err is the first failed append since the last sync
+	err error
+	mu  sync.Mutex
+	// checkpointMu serializes checkpoints
+	checkpointMu sync.Mutex
+
+	// cold holds the accounts kept aside by OpenWarm until they are restored
+	// into target; warming is set while there are any
+	cold    map[string]*coldAccount
+	target  AccountTarget
+	warming atomic.Bool
+	coldMu  sync.Mutex
+}
+
+// Open restores the target from the snapshot and log segments in dir, then
+// starts a new segment. It returns the number of replayed updates.
+func Open(dir string, target Target) (*Store, int, error) {
+	return open(dir, target, nil, 0)
+}
+
+// OpenWarm restores a target like Open, except that only the warm accounts
+// of the snapshot most recently active, and the reputations, are restored
+// before it returns. The other accounts are restored with their logged
+// updates when the target first uses them, or by RestoreCold.
+func OpenWarm(dir string, target AccountTarget, warm int) (*Store, int, error) {
+	return open(dir, target, target, warm)
+}
+
+func open(dir string, target Target, accounts AccountTarget, warm int) (*Store, int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, 0, err
+	}
+
+	s := &Store{dir: dir}
+	snap := snapshot{Next: 1}
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, 0, fmt.Errorf("invalid snapshot: %w", err)
+		}
+		if accounts != nil && warm > 0 && len(snap.State.Profiles) > warm {
+			hot := hottest(snap.State.Profiles, warm)
+			kept, rest := snap.State.Split(func(accountID string) bool { return hot[accountID] })
+			target.RestoreState(kept)
+			s.cold = make(map[string]*coldAccount, len(rest))
+			for accountID, state := range rest {
+				s.cold[accountID] = &coldAccount{state: state}
+			}
+		} else {
+			target.RestoreState(snap.State)
+		}
+	case !os.IsNotExist(err):
+		return nil, 0, err
+	}
+	// Updates of cold accounts wait for their state
+	replay := target.ReplayState
+	if len(s.cold) > 0 {
+		replay = func(entry detector.StateEntry) {
+			if account, exists := s.cold[entry.AccountID]; exists {
+				account.entries = append(account.entries, entry)
+				return
+			}
+			target.ReplayState(entry)
+		}
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	replayed, next := 0, snap.Next
+	for _, segment := range segments {
+		path := filepath.Join(dir, fmt.Sprintf(segmentFormat, segment))
+		if segment < snap.Next {
+			// Left behind by a crash after the snapshot was written
+			if err := os.Remove(path); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		count, err := replaySegment(path, replay)
+		if err != nil {
+			return nil, 0, err
+		}
+		replayed += count
+		next = segment + 1
+	}
+
+	if err := s.openSegment(next); err != nil {
+		return nil, 0, err
+	}
+	if len(s.cold) > 0 {
+		s.target = accounts
+		s.warming.Store(true)
+		accounts.SetAccountLoader(s.loadCold)
+	}
+	return s, replayed, nil
+}
+
+// hottest returns the n accounts of the profiles seen most recently
+func hottest(profiles map[string]detector.AccountProfile, n int) map[string]bool {
+	ids := make([]string, 0, len(profiles))
+	for accountID := range profiles {
+		ids = append(ids, accountID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := profiles[ids[i]].LastSeen, profiles[ids[j]].LastSeen
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return ids[i] < ids[j]
+	})
+	hot := make(map[string]bool, n)
+	for _, accountID := range ids[:n] {
+		hot[accountID] = true
+	}
+	return hot
+}
+
+// Cold returns the number of accounts not restored yet
+func (s *Store) Cold() int {
+	s.coldMu.Lock()
+	defer s.coldMu.Unlock()
+	return len(s.cold)
+}
+
+// loadCold restores an account kept aside, before the target uses it
+func (s *Store) loadCold(accountID string) {
+	if !s.warming.Load() {
+		return
+	}
+	s.coldMu.Lock()
+	defer s.coldMu.Unlock()
+	s.restoreCold(accountID)
+}
+
+// restoreCold restores an account kept aside, if it still is. Callers must
+// hold coldMu.
+func (s *Store) restoreCold(accountID string) bool {
+	account, exists := s.cold[accountID]
+	if !exists {
+		return false
+	}
+	delete(s.cold, accountID)
+	s.target.RestoreAccounts(account.state)
+	for _, entry := range account.entries {
+		s.target.ReplayState(entry)
+	}
+	if len(s.cold) == 0 {
+		s.warming.Store(false)
+		s.target.SetAccountLoader(nil)
+	}
+	return true
+}
+
+// RestoreCold restores every account kept aside by OpenWarm, a batch at a
+// time so analyses keep going, and returns how many it restored
+func (s *Store) RestoreCold() int {
+	restored := 0
+	for s.warming.Load() {
+		s.coldMu.Lock()
+		batch := 0
+		for accountID := range s.cold {
+			if batch == coldBatch {
+				break
+			}
+			s.restoreCold(accountID)
+			batch++
+		}
+		s.coldMu.Unlock()
+		restored += batch
+		runtime.Gosched()
+	}
+	return restored
+}
+
+// listSegments returns the numbers of the log segments in dir, in order
+func listSegments(dir string) ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]int, 0, len(names))
+	for _, name := range names {
+		var segment int
+		if _, err := fmt.Sscanf(filepath.Base(name), segmentFormat, &segment); err == nil {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// replaySegment applies the updates of a log segment. A torn last line, left
+// by a crash in the middle of a write, is ignored.
+func replaySegment(path string, replay func(detector.StateEntry)) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	count := 0
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var entry detector.StateEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if i == len(lines)-1 {
+				log.Printf("Ignoring torn write at the end of %s", path)
+				break
+			}
+			return count, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		replay(entry)
+		count++
+	}
+	return count, nil
+}
+
+// openSegment starts writing a new log segment. Callers must hold the lock
+// or own the store.
+func (s *Store) openSegment(segment int) error {
+	path := filepath.Join(s.dir, fmt.Sprintf(segmentFormat, segment))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segment, s.file, s.writer = segment, file, bufio.NewWriter(file)
+	return nil
+}
+
+// Append logs a state update
+func (s *Store) Append(entry detector.StateEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return
+	}
+	if _, err := s.writer.Write(append(line, '\n')); err != nil && s.err == nil {
+		s.err = err
+		log.Printf("State log write failed: %v", err)
+	}
+}
+
+// Sync makes the logged updates durable
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return nil
+	}
+
+	err := s.err
+	s.err = nil
+	if flushErr := s.writer.Flush(); err == nil {
+		err = flushErr
+	}
+	if syncErr := s.file.Sync(); err == nil {
+		err = syncErr
+	}
+	return err
+}
+
+// Checkpoint snapshots the target state and deletes the log segments the
+// snapshot covers, first restoring the accounts still kept aside. Analysis
+// pauses only while the state is copied and a new segment is started.
+func (s *Store) Checkpoint(target Target) error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	// The logged updates of cold accounts are in the segments the snapshot
+	// replaces
+	if s.warming.Load() {
+		s.RestoreCold()
+	}
+
+	var state detector.State
+	var previous *os.File
+	var next int
+	var err error
+	target.CheckpointState(func(copied detector.State) {
+		state = copied
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.writer == nil {
+			err = ErrClosed
+			return
+		}
+		if err = s.writer.Flush(); err != nil {
+			return
+		}
+		previous = s.file
+		next = s.segment + 1
+		err = s.openSegment(next)
+	})
+	if err != nil {
+		return err
+	}
+	// The previous segment must be durable before the snapshot replaces it
+	if err := previous.Sync(); err != nil {
+		return err
+	}
+	if err := previous.Close(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot{Next: next, CreatedAt: time.Now().UTC(), State: state})
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(s.dir, snapshotFile), data); err != nil {
+		return err
+	}
+
+	segments, err := listSegments(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment < next {
+			if err := os.Remove(filepath.Join(s.dir, fmt.Sprintf(segmentFormat, segment))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile replaces a file atomically
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Run syncs the log and checkpoints the target at the given intervals until
+// stop is closed
+func (s *Store) Run(target Target, syncInterval, snapshotInterval time.Duration, stop <-chan struct{}) {
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	snapshotTicker := time.NewTicker(snapshotInterval)
+	defer snapshotTicker.Stop()
+
+	for {
+		select {
+		case <-syncTicker.C:
+			if err := s.Sync(); err != nil {
+				log.Printf("State log sync failed: %v", err)
+			}
+		case <-snapshotTicker.C:
+			if err := s.Checkpoint(target); err != nil {
+				log.Printf("State snapshot failed: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close syncs and closes the log. Later updates are not logged.
+func (s *Store) Close() error {
+	err := s.Sync()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return err
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file, s.writer = nil, nil
+	return err
+}
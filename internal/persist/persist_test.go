@@ -0,0 +1,162 @@
+package persist_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func analyze(t *testing.T, d *detector.Detector, account string, amount float64) {
+	_, err := d.Analyze(context.Background(), &detector.Transaction{
+		ID:        fmt.Sprintf("TXN-%s-%.0f", account, amount),
+		AccountID: account,
+		Amount:    amount,
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+}
+
+func state(d *detector.Detector) detector.State {
+	var copied detector.State
+	d.CheckpointState(func(state detector.State) { copied = state })
+	return copied
+}
+
+// open restores a fresh detector from dir and logs its updates there
+func open(t *testing.T, dir string) (*detector.Detector, *persist.Store, int) {
+	d := detector.NewDetector(detector.DefaultConfig())
+	store, replayed, err := persist.Open(dir, d)
+	require.NoError(t, err)
+	d.SetStateLog(store)
+	return d, store, replayed
+}
+
+func TestStore_ReplaysLogAfterSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	d, store, replayed := open(t, dir)
+	assert.Zero(t, replayed)
+	analyze(t, d, "ACC-1", 100)
+	analyze(t, d, "ACC-1", 300)
+	require.NoError(t, store.Checkpoint(d))
+	analyze(t, d, "ACC-1", 200)
+	analyze(t, d, "ACC-2", 50)
+	require.NoError(t, store.Close())
+
+	restored, store, replayed := open(t, dir)
+	defer store.Close()
+	assert.Equal(t, 2, replayed, "only updates after the snapshot are replayed")
+
+	profile := state(restored).Profiles["ACC-1"]
+	assert.Equal(t, 3, profile.Count)
+	assert.Equal(t, 600.0, profile.TotalAmount)
+	assert.Equal(t, 300.0, profile.MaxAmount)
+	assert.Len(t, state(restored).Velocity["ACC-1"], 3)
+	assert.Equal(t, 1, state(restored).Profiles["ACC-2"].Count)
+}
+
+func TestStore_RecoversFromCrashes(t *testing.T) {
+	dir := t.TempDir()
+
+	d, store, _ := open(t, dir)
+	analyze(t, d, "ACC-1", 100)
+	require.NoError(t, store.Checkpoint(d))
+	analyze(t, d, "ACC-1", 200)
+	require.NoError(t, store.Sync())
+
+	// A crash after the snapshot was written but before the segments it
+	// covers were deleted, and in the middle of an append
+	stale := filepath.Join(dir, "wal-000001.log")
+	require.NoError(t, os.WriteFile(stale, []byte(`{"account_id":"ACC-1","amount":100}`+"\n"), 0o644))
+	segments, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	require.NoError(t, err)
+	last, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = last.WriteString(`{"account_id":"ACC-1","amo`)
+	require.NoError(t, err)
+	require.NoError(t, last.Close())
+
+	restored, store, replayed := open(t, dir)
+	defer store.Close()
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, 2, state(restored).Profiles["ACC-1"].Count)
+	assert.NoFileExists(t, stale)
+}
+
+func TestStore_RejectsCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wal-000001.log"), []byte("not json\n{}\n"), 0o644))
+
+	_, _, err := persist.Open(dir, detector.NewDetector(detector.DefaultConfig()))
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestStore_RestoresWarmAccountsFirst(t *testing.T) {
+	dir := t.TempDir()
+
+	d, store, _ := open(t, dir)
+	analyze(t, d, "ACC-OLD", 100)
+	analyze(t, d, "ACC-IDLE", 40)
+	analyze(t, d, "ACC-HOT", 10)
+	require.NoError(t, store.Checkpoint(d))
+	analyze(t, d, "ACC-OLD", 200)
+	require.NoError(t, store.Close())
+
+	restored := detector.NewDetector(detector.DefaultConfig())
+	store, replayed, err := persist.OpenWarm(dir, restored, 1)
+	require.NoError(t, err)
+	defer store.Close()
+	restored.SetStateLog(store)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, 2, store.Cold())
+	assert.Contains(t, state(restored).Profiles, "ACC-HOT", "the most recently active account is restored first")
+	assert.NotContains(t, state(restored).Profiles, "ACC-OLD")
+
+	// An account is restored with its logged updates on first use
+	analyze(t, restored, "ACC-OLD", 300)
+	profile := state(restored).Profiles["ACC-OLD"]
+	assert.Equal(t, 3, profile.Count)
+	assert.Equal(t, 600.0, profile.TotalAmount)
+	assert.Equal(t, 1, store.Cold())
+
+	assert.Equal(t, 1, store.RestoreCold())
+	assert.Zero(t, store.Cold())
+	assert.Equal(t, 1, state(restored).Profiles["ACC-IDLE"].Count)
+	assert.Zero(t, store.RestoreCold())
+}
+
+func TestStore_CheckpointRestoresColdAccounts(t *testing.T) {
+	dir := t.TempDir()
+
+	d, store, _ := open(t, dir)
+	for i := 0; i < 5; i++ {
+		analyze(t, d, fmt.Sprintf("ACC-%d", i), 10)
+	}
+	require.NoError(t, store.Checkpoint(d))
+	analyze(t, d, "ACC-0", 20)
+	require.NoError(t, store.Close())
+
+	restored := detector.NewDetector(detector.DefaultConfig())
+	store, _, err := persist.OpenWarm(dir, restored, 2)
+	require.NoError(t, err)
+	restored.SetStateLog(store)
+	assert.Equal(t, 3, store.Cold())
+	require.NoError(t, store.Checkpoint(restored))
+	assert.Zero(t, store.Cold())
+	require.NoError(t, store.Close())
+
+	// The snapshot written while warming up holds every account
+	reopened, store, replayed := open(t, dir)
+	defer store.Close()
+	assert.Zero(t, replayed)
+	assert.Len(t, state(reopened).Profiles, 5)
+	assert.Equal(t, 2, state(reopened).Profiles["ACC-0"].Count)
+}
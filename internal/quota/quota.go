@@ -0,0 +1,461 @@
+// Package quota meters the analyses of API callers against daily and monthly
+// quotas, per caller and per tenant, and keeps the daily usage billing is
+// exported from. A caller over its monthly quota is out of paid volume until
+// the next month; one over its daily quota is rate limited until the next
+// day. Days and months are UTC.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Periods of a quota
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// Scopes a quota applies to
+const (
+	ScopeSubject = "subject"
+	ScopeTenant  = "tenant"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// Limits are the analyses allowed per period, zero for unlimited
+type Limits struct {
+	Daily   int64 `json:"daily,omitempty"`
+	Monthly int64 `json:"monthly,omitempty"`
+}
+
+// Config sets the quotas. A caller is held to the limits of its subject, or
+// the default ones when its subject has none, and to those of its tenant.
+type Config struct {
+	Default  Limits            `json:"default"`
+	Subjects map[string]Limits `json:"subjects,omitempty"`
+	Tenants  map[string]Limits `json:"tenants,omitempty"`
+	// Retention is how long daily usage is kept, at least the current and
+	// previous months for billing
+	Retention time.Duration `json:"-"`
+}
+
+// DefaultConfig returns unlimited quotas, keeping usage for 13 months
+func DefaultConfig() Config {
+	return Config{Retention: 396 * 24 * time.Hour}
+}
+
+// Validate checks that limits are not negative
+func (c Config) Validate() error {
+	check := func(name string, limits Limits) error {
+		if limits.Daily < 0 || limits.Monthly < 0 {
+			return fmt.Errorf("%s: limits must not be negative", name)
+		}
+		return nil
+	}
+	if err := check("default", c.Default); err != nil {
+		return err
+	}
+	for subject, limits := range c.Subjects {
+		if err := check("subject "+subject, limits); err != nil {
+			return err
+		}
+	}
+	for tenant, limits := range c.Tenants {
+		if err := check("tenant "+tenant, limits); err != nil {
+			return err
+		}
+	}
+	if c.Retention < 62*24*time.Hour {
+		return errors.New("retention must cover the current and previous months")
+	}
+	return nil
+}
+
+// LoadConfig reads the quotas from JSON, keeping the default retention
+func LoadConfig(r io.Reader) (Config, error) {
+	config := DefaultConfig()
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("invalid quotas: %w", err)
+	}
+	return config, config.Validate()
+}
+
+// LoadConfigFile reads the quotas from disk
+func LoadConfigFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	return LoadConfig(f)
+}
+
+// Record is the usage of a caller on a day, or a month when grouped by month
+type Record struct {
+	Subject  string `json:"subject"`
+	Tenant   string `json:"tenant,omitempty"`
+	Period   string `json:"period" doc:"Day (2006-01-02) or month (2006-01)"`
+	Analyses int64  `json:"analyses" doc:"Analyses metered against the quotas"`
+	Rejected int64  `json:"rejected" doc:"Analyses rejected over a quota, not metered"`
+}
+
+// Result is whether analyses were allowed and, when they were not, the
+// quota they would have exceeded
+type Result struct {
+	Allowed bool
+	Scope   string
+	Name    string
+	Period  string
+	Limit   int64
+	Used    int64
+	// ResetAt is when the exceeded quota starts over
+	ResetAt time.Time
+}
+
+// Status is the usage of a subject or tenant against its quotas in the
+// current day and month
+type Status struct {
+	Scope   string `json:"scope"`
+	Name    string `json:"name"`
+	Limits  Limits `json:"limits"`
+	Daily   int64  `json:"daily" doc:"Analyses today"`
+	Monthly int64  `json:"monthly" doc:"Analyses this month"`
+}
+
+type key struct {
+	subject, tenant, day string
+}
+
+// usage counts the analyses of a subject or tenant in the current day and
+// month
+type usage struct {
+	day, month             string
+	dailyUnits, monthUnits int64
+}
+
+// Meter enforces the quotas and records usage, saving it to a file when it
+// has a path
+type Meter struct {
+	mu      sync.Mutex
+	config  Config
+	path    string
+	records map[key]*Record
+	usage   map[[2]string]*usage
+	dirty   bool
+}
+
+// Open returns a meter loading the usage saved at path, empty when there is
+// none. Usage is kept in memory only when path is empty.
+func Open(config Config, path string) (*Meter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Meter{
+		config:  config,
+		path:    path,
+		records: make(map[key]*Record),
+		usage:   make(map[[2]string]*usage),
+	}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid usage file %s: %w", path, err)
+	}
+	for i := range records {
+		record := records[i]
+		m.records[key{record.Subject, record.Tenant, record.Period}] = &record
+	}
+	return m, nil
+}
+
+// Allow meters units analyses of a subject of a tenant at now. They are
+// allowed only when all of them fit the quotas of both the subject and the
+// tenant; monthly quotas are checked before daily ones. Rejected analyses
+// are recorded but do not count against the quotas.
+func (m *Meter) Allow(subject, tenant string, units int64, now time.Time) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now = now.UTC()
+	subjectUsage := m.usageOf(ScopeSubject, subject, now)
+	var tenantUsage *usage
+	if tenant != "" {
+		tenantUsage = m.usageOf(ScopeTenant, tenant, now)
+	}
+
+	record := m.record(subject, tenant, now)
+	m.dirty = true
+	for _, period := range []string{PeriodMonthly, PeriodDaily} {
+		if result := exceeds(ScopeSubject, subject, m.limitsOf(ScopeSubject, subject), subjectUsage, period, units, now); !result.Allowed {
+			record.Rejected += units
+			return result
+		}
+		if tenantUsage == nil {
+			continue
+		}
+		if result := exceeds(ScopeTenant, tenant, m.limitsOf(ScopeTenant, tenant), tenantUsage, period, units, now); !result.Allowed {
+			record.Rejected += units
+			return result
+		}
+	}
+
+	record.Analyses += units
+	subjectUsage.add(units)
+	if tenantUsage != nil {
+		tenantUsage.add(units)
+	}
+	return Result{Allowed: true}
+}
+
+// exceeds checks units against the quota of a period
+func exceeds(scope, name string, limits Limits, u *usage, period string, units int64, now time.Time) Result {
+	limit, used := limits.Daily, u.dailyUnits
+	resetAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if period == PeriodMonthly {
+		limit, used = limits.Monthly, u.monthUnits
+		resetAt = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if limit == 0 || used+units <= limit {
+		return Result{Allowed: true}
+	}
+	return Result{Scope: scope, Name: name, Period: period, Limit: limit, Used: used, ResetAt: resetAt}
+}
+
+func (u *usage) add(units int64) {
+	u.dailyUnits += units
+	u.monthUnits += units
+}
+
+// limitsOf returns the limits of a subject or tenant
+func (m *Meter) limitsOf(scope, name string) Limits {
+	if scope == ScopeTenant {
+		return m.config.Tenants[name]
+	}
+	if limits, exists := m.config.Subjects[name]; exists {
+		return limits
+	}
+	return m.config.Default
+}
+
+// usageOf returns the usage of a subject or tenant in the day and month of
+// now, summed from the records when it is first needed or a period starts.
+// Callers must hold mu.
+func (m *Meter) usageOf(scope, name string, now time.Time) *usage {
+	day, month := now.Format(dayLayout), now.Format(monthLayout)
+	u, exists := m.usage[[2]string{scope, name}]
+	if exists && u.day == day {
+		return u
+	}
+	if exists && u.month == month {
+		u.day, u.dailyUnits = day, 0
+		return u
+	}
+
+	u = &usage{day: day, month: month}
+	for k, record := range m.records {
+		if (scope == ScopeSubject && k.subject != name) || (scope == ScopeTenant && k.tenant != name) {
+			continue
+		}
+		if k.day == day {
+			u.dailyUnits += record.Analyses
+		}
+		if k.day[:len(monthLayout)] == month {
+			u.monthUnits += record.Analyses
+		}
+	}
+	m.usage[[2]string{scope, name}] = u
+	return u
+}
+
+// record returns the record of a subject of a tenant on the day of now.
+// Callers must hold mu.
+func (m *Meter) record(subject, tenant string, now time.Time) *Record {
+	k := key{subject, tenant, now.Format(dayLayout)}
+	record, exists := m.records[k]
+	if !exists {
+		record = &Record{Subject: subject, Tenant: tenant, Period: k.day}
+		m.records[k] = record
+	}
+	return record
+}
+
+// Usage returns the usage of the days from from to to, inclusive, by
+// subject, tenant and day or, when monthly, by month; only that of a subject
+// or tenant when they are set
+func (m *Meter) Usage(from, to time.Time, subject, tenant string, monthly bool) []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	first, last := from.UTC().Format(dayLayout), to.UTC().Format(dayLayout)
+	grouped := make(map[key]*Record)
+	for k, record := range m.records {
+		if k.day < first || k.day > last || (subject != "" && k.subject != subject) || (tenant != "" && k.tenant != tenant) {
+			continue
+		}
+		if monthly {
+			k.day = k.day[:len(monthLayout)]
+		}
+		sum, exists := grouped[k]
+		if !exists {
+			sum = &Record{Subject: k.subject, Tenant: k.tenant, Period: k.day}
+			grouped[k] = sum
+		}
+		sum.Analyses += record.Analyses
+		sum.Rejected += record.Rejected
+	}
+
+	records := make([]Record, 0, len(grouped))
+	for _, record := range grouped {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Subject < b.Subject
+	})
+	return records
+}
+
+// Statuses returns the usage of the subjects and tenants that have quotas or
+// were metered this month against their quotas, by scope and name
+func (m *Meter) Statuses(now time.Time) []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now = now.UTC()
+	month := now.Format(monthLayout)
+	names := make(map[[2]string]bool)
+	for subject := range m.config.Subjects {
+		names[[2]string{ScopeSubject, subject}] = true
+	}
+	for tenant := range m.config.Tenants {
+		names[[2]string{ScopeTenant, tenant}] = true
+	}
+	for k := range m.records {
+		if k.day[:len(monthLayout)] != month {
+			continue
+		}
+		names[[2]string{ScopeSubject, k.subject}] = true
+		if k.tenant != "" {
+			names[[2]string{ScopeTenant, k.tenant}] = true
+		}
+	}
+
+	statuses := make([]Status, 0, len(names))
+	for name := range names {
+		u := m.usageOf(name[0], name[1], now)
+		statuses = append(statuses, Status{
+			Scope:   name[0],
+			Name:    name[1],
+			Limits:  m.limitsOf(name[0], name[1]),
+			Daily:   u.dailyUnits,
+			Monthly: u.monthUnits,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Scope != statuses[j].Scope {
+			return statuses[i].Scope < statuses[j].Scope
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Save writes the usage to the meter's file, dropping the days past the
+// retention. It does nothing without a path or when usage has not changed.
+func (m *Meter) Save(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.path == "" || !m.dirty {
+		return nil
+	}
+	oldest := now.UTC().Add(-m.config.Retention).Format(dayLayout)
+	records := make([]Record, 0, len(m.records))
+	for k, record := range m.records {
+		if k.day < oldest {
+			delete(m.records, k)
+			continue
+		}
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Period != records[j].Period {
+			return records[i].Period < records[j].Period
+		}
+		return records[i].Subject+"\x00"+records[i].Tenant < records[j].Subject+"\x00"+records[j].Tenant
+	})
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	tmp := m.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+// Start saves the usage at the given interval until stop is closed, and a
+// last time then
+func (m *Meter) Start(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Save(time.Now()); err != nil {
+				log.Printf("Saving quota usage failed: %v", err)
+			}
+		case <-stop:
+			if err := m.Save(time.Now()); err != nil {
+				log.Printf("Saving quota usage failed: %v", err)
+			}
+			return
+		}
+	}
+}
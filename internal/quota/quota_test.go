@@ -0,0 +1,101 @@
+package quota_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/quota"
+)
+
+var quotaStart = time.Date(2024, 3, 30, 22, 0, 0, 0, time.UTC)
+
+func quotas() quota.Config {
+	config := quota.DefaultConfig()
+	config.Default = quota.Limits{Daily: 5, Monthly: 8}
+	config.Subjects = map[string]quota.Limits{"reseller": {}}
+	config.Tenants = map[string]quota.Limits{"acme": {Monthly: 12}}
+	return config
+}
+
+func TestMeter_Allow(t *testing.T) {
+	meter, err := quota.Open(quotas(), "")
+	require.NoError(t, err)
+
+	assert.True(t, meter.Allow("key-1", "", 4, quotaStart).Allowed)
+	daily := meter.Allow("key-1", "", 2, quotaStart)
+	assert.False(t, daily.Allowed, "a batch is allowed only when all of it fits")
+	assert.Equal(t, quota.ScopeSubject, daily.Scope)
+	assert.Equal(t, quota.PeriodDaily, daily.Period)
+	assert.Equal(t, int64(4), daily.Used)
+	assert.Equal(t, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), daily.ResetAt)
+	assert.True(t, meter.Allow("key-1", "", 1, quotaStart).Allowed)
+
+	// The next day the daily quota starts over but the monthly one does not
+	tomorrow := quotaStart.Add(4 * time.Hour)
+	assert.True(t, meter.Allow("key-1", "", 3, tomorrow).Allowed)
+	monthly := meter.Allow("key-1", "", 1, tomorrow)
+	assert.False(t, monthly.Allowed)
+	assert.Equal(t, quota.PeriodMonthly, monthly.Period)
+	assert.Equal(t, int64(8), monthly.Limit)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), monthly.ResetAt)
+
+	assert.True(t, meter.Allow("key-1", "", 5, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)).Allowed, "months start over")
+}
+
+func TestMeter_Allow_TenantQuota(t *testing.T) {
+	meter, err := quota.Open(quotas(), "")
+	require.NoError(t, err)
+
+	assert.True(t, meter.Allow("reseller", "acme", 10, quotaStart).Allowed, "subjects with their own limits skip the default")
+	result := meter.Allow("key-2", "acme", 3, quotaStart)
+	assert.False(t, result.Allowed, "the keys of a tenant share its quota")
+	assert.Equal(t, quota.ScopeTenant, result.Scope)
+	assert.Equal(t, "acme", result.Name)
+	assert.True(t, meter.Allow("key-2", "acme", 2, quotaStart).Allowed)
+
+	statuses := meter.Statuses(quotaStart)
+	assert.Contains(t, statuses, quota.Status{Scope: quota.ScopeTenant, Name: "acme", Limits: quota.Limits{Monthly: 12}, Daily: 12, Monthly: 12})
+	assert.Contains(t, statuses, quota.Status{Scope: quota.ScopeSubject, Name: "key-2", Limits: quota.Limits{Daily: 5, Monthly: 8}, Daily: 2, Monthly: 2})
+}
+
+func TestMeter_Usage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	meter, err := quota.Open(quotas(), path)
+	require.NoError(t, err)
+
+	meter.Allow("key-1", "acme", 4, quotaStart)
+	meter.Allow("key-1", "acme", 4, quotaStart)
+	meter.Allow("key-1", "acme", 2, quotaStart.Add(4*time.Hour))
+	meter.Allow("key-3", "", 1, quotaStart.Add(4*time.Hour))
+	require.NoError(t, meter.Save(quotaStart))
+
+	// Usage survives a restart, and so do the quotas it counts against
+	reopened, err := quota.Open(quotas(), path)
+	require.NoError(t, err)
+	assert.False(t, reopened.Allow("key-1", "acme", 3, quotaStart.Add(5*time.Hour)).Allowed)
+
+	from, to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []quota.Record{
+		{Subject: "key-1", Tenant: "acme", Period: "2024-03-30", Analyses: 4, Rejected: 4},
+		{Subject: "key-3", Period: "2024-03-31", Analyses: 1},
+		{Subject: "key-1", Tenant: "acme", Period: "2024-03-31", Analyses: 2, Rejected: 3},
+	}, reopened.Usage(from, to, "", "", false))
+	assert.Equal(t, []quota.Record{
+		{Subject: "key-1", Tenant: "acme", Period: "2024-03", Analyses: 6, Rejected: 7},
+	}, reopened.Usage(from, to, "", "acme", true))
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := quota.LoadConfig(strings.NewReader(`{"default": {"daily": 100}, "tenants": {"acme": {"monthly": 5000}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), config.Default.Daily)
+	assert.Equal(t, int64(5000), config.Tenants["acme"].Monthly)
+
+	_, err = quota.LoadConfig(strings.NewReader(`{"subjects": {"key-1": {"daily": -1}}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,451 @@
+// Package recording captures the requests and responses of chosen API
+// callers for a limited time, so support engineers can debug a merchant
+// integration without packet captures. Bodies are sanitized before they are
+// kept: personal data is masked and anything that cannot be inspected is
+// left out.
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+)
+
+// Config bounds recordings
+type Config struct {
+	// MaxWindow is the longest a recording may run
+	MaxWindow time.Duration
+	// Retention is how long exchanges are kept after a recording ends
+	Retention time.Duration
+	// MaxExchanges caps the exchanges kept per recording
+	MaxExchanges int
+	// MaxBodyBytes caps each recorded body; longer bodies are left out
+	MaxBodyBytes int
+}
+
+// DefaultConfig returns the default recording bounds
+func DefaultConfig() Config {
+	return Config{
+		MaxWindow:    time.Hour,
+		Retention:    24 * time.Hour,
+		MaxExchanges: 500,
+		MaxBodyBytes: 64 << 10,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.MaxWindow <= 0 {
+		c.MaxWindow = defaults.MaxWindow
+	}
+	if c.Retention <= 0 {
+		c.Retention = defaults.Retention
+	}
+	if c.MaxExchanges <= 0 {
+		c.MaxExchanges = defaults.MaxExchanges
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = defaults.MaxBodyBytes
+	}
+	return c
+}
+
+// Session is the recording of one caller
+type Session struct {
+	Subject   string    `json:"subject"`
+	StartedAt time.Time `json:"started_at"`
+	Until     time.Time `json:"until"`
+	Active    bool      `json:"active"`
+	Recorded  int       `json:"recorded"`
+	// Dropped counts exchanges not kept because the recording was full
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// Exchange is a recorded request and its response. Bodies are JSON with
+// personal data masked, plain text, or a note saying why they were left out.
+type Exchange struct {
+	RecordedAt time.Time       `json:"recorded_at"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Query      string          `json:"query,omitempty"`
+	Status     int             `json:"status"`
+	Duration   string          `json:"duration"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	Response   json.RawMessage `json:"response,omitempty"`
+}
+
+type recording struct {
+	session   Session
+	exchanges []Exchange
+}
+
+// Recorder holds the recordings by caller subject
+type Recorder struct {
+	config     Config
+	recordings map[string]*recording
+	mu         sync.Mutex
+}
+
+// NewRecorder creates a recorder without recordings
+func NewRecorder(config Config) *Recorder {
+	return &Recorder{
+		config:     config.withDefaults(),
+		recordings: make(map[string]*recording),
+	}
+}
+
+// Start records the caller for the window, replacing any earlier recording
+// of it
+func (r *Recorder) Start(subject string, window time.Duration) (Session, error) {
+	if subject == "" {
+		return Session{}, fmt.Errorf("subject is required")
+	}
+	if window <= 0 || window > r.config.MaxWindow {
+		return Session{}, fmt.Errorf("window must be positive and at most %s", r.config.MaxWindow)
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge(now)
+
+	rec := &recording{session: Session{Subject: subject, StartedAt: now, Until: now.Add(window)}}
+	r.recordings[subject] = rec
+	return rec.snapshot(now), nil
+}
+
+// Delete ends the recording of a caller and discards its exchanges
+func (r *Recorder) Delete(subject string) (Session, bool) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, exists := r.recordings[subject]
+	if !exists {
+		return Session{}, false
+	}
+	delete(r.recordings, subject)
+	session := rec.snapshot(now)
+	session.Active = false
+	return session, true
+}
+
+// Sessions returns every retained recording, by subject
+func (r *Recorder) Sessions() []Session {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge(now)
+
+	sessions := make([]Session, 0, len(r.recordings))
+	for _, rec := range r.recordings {
+		sessions = append(sessions, rec.snapshot(now))
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Subject < sessions[j].Subject })
+	return sessions
+}
+
+// Exchanges returns the recording of a caller, oldest exchange first
+func (r *Recorder) Exchanges(subject string) (Session, []Exchange, bool) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge(now)
+
+	rec, exists := r.recordings[subject]
+	if !exists {
+		return Session{}, nil, false
+	}
+	return rec.snapshot(now), append([]Exchange(nil), rec.exchanges...), true
+}
+
+// active reports whether a caller is being recorded
+func (r *Recorder) active(subject string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, exists := r.recordings[subject]
+	return exists && now.Before(rec.session.Until)
+}
+
+func (r *Recorder) add(subject string, exchange Exchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, exists := r.recordings[subject]
+	if !exists || !exchange.RecordedAt.Before(rec.session.Until) {
+		return
+	}
+	if len(rec.exchanges) >= r.config.MaxExchanges {
+		rec.session.Dropped++
+		return
+	}
+	rec.exchanges = append(rec.exchanges, exchange)
+	rec.session.Recorded++
+}
+
+// purge discards recordings that ended more than the retention ago. Callers
+// must hold the lock.
+func (r *Recorder) purge(now time.Time) {
+	for subject, rec := range r.recordings {
+		if now.Sub(rec.session.Until) > r.config.Retention {
+			delete(r.recordings, subject)
+		}
+	}
+}
+
+func (rec *recording) snapshot(now time.Time) Session {
+	session := rec.session
+	session.Active = now.Before(session.Until)
+	return session
+}
+
+// Middleware records the exchanges of callers being recorded. It must run
+// after authentication, since callers are identified by their principal;
+// skip lists path prefixes never recorded, such as the recording endpoints
+// themselves.
+func (r *Recorder) Middleware(next http.Handler, skip ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		principal, authenticated := auth.FromContext(req.Context())
+		start := time.Now()
+		if !authenticated || !r.active(principal.Subject, start) || skipped(req.URL.Path, skip) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		request := &capture{limit: r.config.MaxBodyBytes}
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(req.Body, request), req.Body}
+		response := &responseRecorder{ResponseWriter: w, status: http.StatusOK, body: capture{limit: r.config.MaxBodyBytes}}
+
+		next.ServeHTTP(response, req)
+
+		r.add(principal.Subject, Exchange{
+			RecordedAt: start,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			Query:      sanitizeQuery(req.URL.RawQuery),
+			Status:     response.status,
+			Duration:   time.Since(start).String(),
+			Request:    request.sanitized(req.Header.Get("Content-Type")),
+			Response:   response.body.sanitized(response.Header().Get("Content-Type")),
+		})
+	})
+}
+
+func skipped(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// capture keeps the first limit bytes written to it and counts the rest
+type capture struct {
+	limit int
+	data  []byte
+	size  int
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	c.size += len(p)
+	if room := c.limit - len(c.data); room > 0 {
+		c.data = append(c.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// sanitized returns the body as it is recorded
+func (c *capture) sanitized(contentType string) json.RawMessage {
+	if c.size == 0 {
+		return nil
+	}
+	if c.size > c.limit {
+		return note(fmt.Sprintf("%d bytes, over the recording limit", c.size))
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(c.data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		if masked, err := json.Marshal(mask("", value)); err == nil {
+			return masked
+		}
+	}
+	switch {
+	case strings.HasPrefix(contentType, "text/plain"):
+		return note(maskCardNumbers(string(c.data)))
+	case strings.Contains(contentType, "json"), contentType == "":
+		// Personal data cannot be masked in what does not parse
+		return note(fmt.Sprintf("%d bytes of invalid JSON not recorded", c.size))
+	default:
+		return note(fmt.Sprintf("%d bytes of %s content not recorded", c.size, contentType))
+	}
+}
+
+func note(text string) json.RawMessage {
+	encoded, _ := json.Marshal(text)
+	return encoded
+}
+
+// responseRecorder captures the status and body of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   capture
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming endpoints working while they are recorded
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// personal are the fields masked wherever they appear in a body or query
+var personal = map[string]bool{
+	"account_id":         true,
+	"customer_id":        true,
+	"name":               true,
+	"email":              true,
+	"phone":              true,
+	"address":            true,
+	"card_number":        true,
+	"pan":                true,
+	"ip_address":         true,
+	"device_id":          true,
+	"fingerprint":        true,
+	"user_agent":         true,
+	"city":               true,
+	"latitude":           true,
+	"longitude":          true,
+	"destination":        true,
+	"refund_destination": true,
+	"wallet_address":     true,
+}
+
+// cardNumber matches digit runs as long as card numbers, with optional
+// separators. Only runs passing the Luhn check are masked, which spares most
+// IDs and timestamps.
+var cardNumber = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// mask replaces personal fields of a decoded JSON value and card numbers in
+// any string
+func mask(key string, value interface{}) interface{} {
+	if personal[strings.ToLower(key)] {
+		return maskValue(value)
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for field, nested := range v {
+			v[field] = mask(field, nested)
+		}
+		return v
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = mask(key, nested)
+		}
+		return v
+	case string:
+		return maskCardNumbers(v)
+	default:
+		return v
+	}
+}
+
+// maskValue hides a personal value, keeping the last four characters of
+// long strings so values can still be told apart
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return v
+		}
+		if len(v) >= 12 {
+			return "****" + v[len(v)-4:]
+		}
+		return "****"
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = maskValue(nested)
+		}
+		return v
+	default:
+		return "****"
+	}
+}
+
+func maskCardNumbers(text string) string {
+	return cardNumber.ReplaceAllStringFunc(text, func(number string) string {
+		if !luhn(number) {
+			return number
+		}
+		return "****" + number[len(number)-4:]
+	})
+}
+
+// luhn reports whether the digits of a number pass the Luhn checksum
+func luhn(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			continue
+		}
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func sanitizeQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return "[unparseable query not recorded]"
+	}
+	for key, list := range values {
+		for i, value := range list {
+			if personal[strings.ToLower(key)] {
+				list[i] = maskValue(value).(string)
+			} else {
+				list[i] = maskCardNumbers(value)
+			}
+		}
+	}
+	return values.Encode()
+}
@@ -0,0 +1,109 @@
+package recording_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/auth"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/recording"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echo answers with the request body and a result carrying personal data
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !json.Valid(body) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"decision": "APPROVE", "customer_id": "CUST-1234567890"}`))
+})
+
+func serve(t *testing.T, handler http.Handler, subject, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if subject != "" {
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: subject, Role: auth.Viewer}))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRecorder_RecordsSanitizedExchanges(t *testing.T) {
+	recorder := recording.NewRecorder(recording.Config{})
+	handler := recorder.Middleware(echo, "/fraud/admin/recordings")
+	_, err := recorder.Start("merchant-a", time.Minute)
+	require.NoError(t, err)
+
+	w := serve(t, handler, "merchant-a", "/fraud/analyze?account_id=ACC-42&mode=full", `{
+		"id": "TXN-1",
+		"amount": 120.5,
+		"location": {"country": "BR", "ip_address": "203.0.113.7", "latitude": -23.5},
+		"metadata": {"note": "card 4111 1111 1111 1111", "ref": "1760450942760001225"}
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, "the caller's response is unchanged")
+	serve(t, handler, "merchant-a", "/fraud/analyze", `{"id": "TXN-2", "amount": `)
+	serve(t, handler, "merchant-b", "/fraud/analyze", `{"id": "TXN-3"}`)
+	serve(t, handler, "", "/fraud/analyze", `{"id": "TXN-4"}`)
+	serve(t, handler, "merchant-a", "/fraud/admin/recordings", `{}`)
+
+	session, exchanges, exists := recorder.Exchanges("merchant-a")
+	require.True(t, exists)
+	assert.True(t, session.Active)
+	assert.Equal(t, 2, session.Recorded)
+	require.Len(t, exchanges, 2)
+
+	first := exchanges[0]
+	assert.Equal(t, "/fraud/analyze", first.Path)
+	assert.Equal(t, "account_id=%2A%2A%2A%2A&mode=full", first.Query)
+	assert.Equal(t, http.StatusOK, first.Status)
+	assert.JSONEq(t, `{
+		"id": "TXN-1",
+		"amount": 120.5,
+		"location": {"country": "BR", "ip_address": "****", "latitude": "****"},
+		"metadata": {"note": "card ****1111", "ref": "1760450942760001225"}
+	}`, string(first.Request))
+	assert.JSONEq(t, `{"decision": "APPROVE", "customer_id": "****7890"}`, string(first.Response))
+
+	// Invalid JSON cannot be masked, so only its size is kept
+	second := exchanges[1]
+	assert.Equal(t, http.StatusBadRequest, second.Status)
+	assert.JSONEq(t, `"26 bytes of invalid JSON not recorded"`, string(second.Request))
+	assert.JSONEq(t, `"Invalid JSON\n"`, string(second.Response))
+
+	_, _, exists = recorder.Exchanges("merchant-b")
+	assert.False(t, exists)
+}
+
+func TestRecorder_Window(t *testing.T) {
+	recorder := recording.NewRecorder(recording.Config{MaxWindow: time.Minute, MaxExchanges: 1})
+	handler := recorder.Middleware(echo)
+
+	_, err := recorder.Start("merchant-a", time.Hour)
+	assert.Error(t, err, "windows are capped")
+
+	_, err = recorder.Start("merchant-a", 50*time.Millisecond)
+	require.NoError(t, err)
+	serve(t, handler, "merchant-a", "/fraud/analyze", `{"id": "TXN-1"}`)
+	serve(t, handler, "merchant-a", "/fraud/analyze", `{"id": "TXN-2"}`)
+	time.Sleep(60 * time.Millisecond)
+	serve(t, handler, "merchant-a", "/fraud/analyze", `{"id": "TXN-3"}`)
+
+	sessions := recorder.Sessions()
+	require.Len(t, sessions, 1)
+	assert.False(t, sessions[0].Active)
+	assert.Equal(t, 1, sessions[0].Recorded)
+	assert.Equal(t, 1, sessions[0].Dropped)
+
+	_, deleted := recorder.Delete("merchant-a")
+	assert.True(t, deleted)
+	assert.Empty(t, recorder.Sessions())
+}
@@ -0,0 +1,84 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// VectorClock counts the writes of each region a value has seen
+type VectorClock map[string]uint64
+
+// ordering of two vector clocks
+type ordering int
+
+const (
+	equal ordering = iota
+	before
+	after
+	concurrent
+)
+
+func (v VectorClock) compare(other VectorClock) ordering {
+	less, greater := false, false
+	for region, n := range v {
+		if n > other[region] {
+			greater = true
+		} else if n < other[region] {
+			less = true
+		}
+	}
+	for region, n := range other {
+		if _, seen := v[region]; !seen && n > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return concurrent
+	case less:
+		return before
+	case greater:
+		return after
+	}
+	return equal
+}
+
+// next returns the clock of a write by a region that has seen v
+func (v VectorClock) next(region string) VectorClock {
+	next := make(VectorClock, len(v)+1)
+	for r, n := range v {
+		next[r] = n
+	}
+	next[region]++
+	return next
+}
+
+// Register is a replicated value: a list or an expression rule. A write that
+// has seen another replaces it; of two concurrent writes the later one wins,
+// ties going to the greater region name, so every region picks the same one.
+type Register struct {
+	Clock     VectorClock `json:"clock"`
+	WrittenAt time.Time   `json:"written_at"`
+	Region    string      `json:"region"`
+	// Value is the JSON value, null once a rule is deleted
+	Value json.RawMessage `json:"value"`
+}
+
+// supersedes reports whether r replaces other
+func (r Register) supersedes(other Register) bool {
+	switch r.Clock.compare(other.Clock) {
+	case after:
+		return true
+	case before, equal:
+		return false
+	}
+	if !r.WrittenAt.Equal(other.WrittenAt) {
+		return r.WrittenAt.After(other.WrittenAt)
+	}
+	return r.Region > other.Region
+}
+
+func sameValue(a, b json.RawMessage) bool {
+	return bytes.Equal(a, b)
+}
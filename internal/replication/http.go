@@ -0,0 +1,52 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// Path is the endpoint of the engine receiving deltas from its peers
+const Path = "/fraud/replication"
+
+// HTTPTransport posts deltas to the replication endpoint of each peer,
+// signed with the secret the regions share
+type HTTPTransport struct {
+	Client *http.Client
+	Secret string
+}
+
+// NewHTTPTransport creates a transport with a request timeout
+func NewHTTPTransport(secret string, timeout time.Duration) *HTTPTransport {
+	return &HTTPTransport{Client: &http.Client{Timeout: timeout}, Secret: secret}
+}
+
+// Send posts a delta to a peer, given by its base URL
+func (t *HTTPTransport) Send(ctx context.Context, peer string, delta Delta) error {
+	body, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(peer, "/")+Path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.SignatureHeader, events.Sign(t.Secret, time.Now(), body))
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("peer responded %s", resp.Status)
+	}
+	return nil
+}
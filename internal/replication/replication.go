@@ -0,0 +1,385 @@
+// Package replication converges the lists, expression rules and account
+// profile aggregates of engines running active-active in several regions.
+// Changes apply locally first and are shipped to the peer regions in the
+// background, so scoring never waits on another region.
+//
+// Lists and rules are last-write-wins registers ordered by vector clocks.
+// Profile aggregates are per-region slots: each region only grows its own,
+// and a copy is merged by adding what it gained since the last one, so the
+// totals converge whatever the order or repetition of deliveries. Every
+// region sends its own changes to every peer.
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+// Register key prefixes
+const (
+	listPrefix = "list:"
+	rulePrefix = "rule:"
+)
+
+// Config holds the replication settings. Changes are sent to the Peers
+// every Interval.
+type Config struct {
+	Region   string
+	Peers    []string
+	Interval time.Duration
+	// Path is the file the registers are kept in, so their clocks survive
+	// restarts; empty keeps them in memory only
+	Path string
+}
+
+// DefaultConfig returns the default replication settings
+func DefaultConfig() Config {
+	return Config{Interval: time.Second}
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = DefaultConfig().Interval
+	}
+	return c
+}
+
+// Target is the replicated state of an engine
+type Target interface {
+	// ApplyList replaces a list with the values written in another region
+	ApplyList(region, name string, values []string)
+	// ApplyRule creates or replaces an expression rule written in another
+	// region, or deletes it when spec is nil
+	ApplyRule(region, id string, spec *ruleset.Spec)
+	LocalProfileSlot(accountID string) (detector.ProfileSlot, bool)
+	MergeProfileSlot(accountID, region string, slot detector.ProfileSlot) bool
+}
+
+// Transport delivers changes to a peer region
+type Transport interface {
+	Send(ctx context.Context, peer string, delta Delta) error
+}
+
+// Profile is the slot of an account profile contributed by a region
+type Profile struct {
+	AccountID string               `json:"account_id"`
+	Slot      detector.ProfileSlot `json:"slot"`
+}
+
+// Delta is a batch of changes of a region
+type Delta struct {
+	Region    string              `json:"region"`
+	Registers map[string]Register `json:"registers,omitempty"`
+	Profiles  []Profile           `json:"profiles,omitempty"`
+}
+
+// PeerStatus is the replication status of a peer region
+type PeerStatus struct {
+	Peer             string    `json:"peer"`
+	PendingRegisters int       `json:"pending_registers"`
+	PendingProfiles  int       `json:"pending_profiles"`
+	LastSent         time.Time `json:"last_sent,omitempty"`
+	LastError        string    `json:"last_error,omitempty"`
+}
+
+// pending holds the keys changed since the last delivery to a peer
+type pending struct {
+	registers map[string]bool
+	accounts  map[string]bool
+	lastSent  time.Time
+	lastError string
+}
+
+func newPending() *pending {
+	return &pending{registers: make(map[string]bool), accounts: make(map[string]bool)}
+}
+
+// Node replicates the state of the engine of its region
+type Node struct {
+	config    Config
+	target    Target
+	transport Transport
+	registers map[string]Register
+	peers     map[string]*pending
+	mu        sync.Mutex
+	// receiveMu applies received deltas one at a time
+	receiveMu sync.Mutex
+}
+
+// New creates the node of a region, loading its registers from its file
+// when it has one
+func New(config Config, target Target, transport Transport) (*Node, error) {
+	config = config.withDefaults()
+	if config.Region == "" {
+		return nil, fmt.Errorf("replication region is required")
+	}
+	n := &Node{
+		config:    config,
+		target:    target,
+		transport: transport,
+		registers: make(map[string]Register),
+		peers:     make(map[string]*pending),
+	}
+	for _, peer := range config.Peers {
+		n.peers[peer] = newPending()
+	}
+	if config.Path == "" {
+		return n, nil
+	}
+
+	data, err := os.ReadFile(config.Path)
+	if os.IsNotExist(err) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &n.registers); err != nil {
+		return nil, fmt.Errorf("invalid replication registers %s: %w", config.Path, err)
+	}
+	return n, nil
+}
+
+// Region returns the region of the node
+func (n *Node) Region() string {
+	return n.config.Region
+}
+
+// Append marks the profile of an analyzed transaction's account as changed,
+// as a detector.StateLog
+func (n *Node) Append(entry detector.StateEntry) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, p := range n.peers {
+		p.accounts[entry.AccountID] = true
+	}
+}
+
+// SetList records a local write of a list
+func (n *Node) SetList(name string, values []string) error {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return n.write(listPrefix+name, sorted)
+}
+
+// SetRule records a local write of an expression rule, nil once deleted
+func (n *Node) SetRule(id string, spec *ruleset.Spec) error {
+	return n.write(rulePrefix+id, spec)
+}
+
+func (n *Node) write(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	current := n.registers[key]
+	if current.Clock != nil && sameValue(current.Value, data) {
+		return nil
+	}
+	n.registers[key] = Register{
+		Clock:     current.Clock.next(n.config.Region),
+		WrittenAt: time.Now(),
+		Region:    n.config.Region,
+		Value:     data,
+	}
+	for _, p := range n.peers {
+		p.registers[key] = true
+	}
+	return n.save()
+}
+
+// save writes the registers to the file. Callers must hold the lock.
+func (n *Node) save() error {
+	if n.config.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(n.registers)
+	if err != nil {
+		return err
+	}
+	tmp := n.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, n.config.Path)
+}
+
+// Receive applies the changes of another region: the registers they
+// supersede and the profile slots that grew. It returns the number of
+// changes applied.
+func (n *Node) Receive(delta Delta) (int, error) {
+	if delta.Region == "" || delta.Region == n.config.Region {
+		return 0, fmt.Errorf("delta from invalid region %q", delta.Region)
+	}
+	n.receiveMu.Lock()
+	defer n.receiveMu.Unlock()
+
+	applied := 0
+	keys := make([]string, 0, len(delta.Registers))
+	for key := range delta.Registers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		incoming := delta.Registers[key]
+		n.mu.Lock()
+		current := n.registers[key]
+		n.mu.Unlock()
+		if !incoming.supersedes(current) {
+			continue
+		}
+		if err := n.apply(key, incoming); err != nil {
+			return applied, fmt.Errorf("register %s: %w", key, err)
+		}
+
+		n.mu.Lock()
+		latest := n.registers[key]
+		if latest.Region == current.Region && latest.WrittenAt.Equal(current.WrittenAt) || incoming.supersedes(latest) {
+			n.registers[key] = incoming
+			latest = incoming
+		}
+		err := n.save()
+		n.mu.Unlock()
+		if err != nil {
+			return applied, err
+		}
+		if !sameValue(latest.Value, incoming.Value) {
+			// A local write landed while applying and wins
+			if err := n.apply(key, latest); err != nil {
+				return applied, fmt.Errorf("register %s: %w", key, err)
+			}
+			continue
+		}
+		applied++
+	}
+
+	for _, profile := range delta.Profiles {
+		if n.target.MergeProfileSlot(profile.AccountID, delta.Region, profile.Slot) {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// apply hands a register value to the target
+func (n *Node) apply(key string, register Register) error {
+	switch {
+	case strings.HasPrefix(key, listPrefix):
+		var values []string
+		if err := json.Unmarshal(register.Value, &values); err != nil {
+			return err
+		}
+		n.target.ApplyList(register.Region, strings.TrimPrefix(key, listPrefix), values)
+	case strings.HasPrefix(key, rulePrefix):
+		var spec *ruleset.Spec
+		if err := json.Unmarshal(register.Value, &spec); err != nil {
+			return err
+		}
+		n.target.ApplyRule(register.Region, strings.TrimPrefix(key, rulePrefix), spec)
+	default:
+		return fmt.Errorf("unknown register")
+	}
+	return nil
+}
+
+// Flush sends the changes pending for each peer. Changes that fail to be
+// delivered stay pending for the next flush.
+func (n *Node) Flush(ctx context.Context) {
+	n.mu.Lock()
+	peers := make([]string, 0, len(n.peers))
+	for peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	n.mu.Unlock()
+
+	for _, peer := range peers {
+		n.flushPeer(ctx, peer)
+	}
+}
+
+func (n *Node) flushPeer(ctx context.Context, peer string) {
+	n.mu.Lock()
+	p := n.peers[peer]
+	if len(p.registers) == 0 && len(p.accounts) == 0 {
+		n.mu.Unlock()
+		return
+	}
+	sent := &pending{registers: p.registers, accounts: p.accounts}
+	p.registers, p.accounts = make(map[string]bool), make(map[string]bool)
+	delta := Delta{Region: n.config.Region, Registers: make(map[string]Register, len(sent.registers))}
+	for key := range sent.registers {
+		delta.Registers[key] = n.registers[key]
+	}
+	n.mu.Unlock()
+
+	// Slots are read when sent, so each delivery carries the latest ones
+	for accountID := range sent.accounts {
+		if slot, exists := n.target.LocalProfileSlot(accountID); exists {
+			delta.Profiles = append(delta.Profiles, Profile{AccountID: accountID, Slot: slot})
+		}
+	}
+
+	err := n.transport.Send(ctx, peer, delta)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		for key := range sent.registers {
+			p.registers[key] = true
+		}
+		for accountID := range sent.accounts {
+			p.accounts[accountID] = true
+		}
+		p.lastError = err.Error()
+		log.Printf("Failed to replicate %d registers and %d profiles to %s: %v", len(delta.Registers), len(delta.Profiles), peer, err)
+		return
+	}
+	p.lastSent = time.Now()
+	p.lastError = ""
+}
+
+// Run flushes every interval until stop is closed, then flushes once more
+func (n *Node) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(n.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.Flush(context.Background())
+		case <-stop:
+			n.Flush(context.Background())
+			return
+		}
+	}
+}
+
+// Status returns the replication status of each peer, by peer
+func (n *Node) Status() []PeerStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	statuses := make([]PeerStatus, 0, len(n.peers))
+	for peer, p := range n.peers {
+		statuses = append(statuses, PeerStatus{
+			Peer:             peer,
+			PendingRegisters: len(p.registers),
+			PendingProfiles:  len(p.accounts),
+			LastSent:         p.lastSent,
+			LastError:        p.lastError,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Peer < statuses[j].Peer })
+	return statuses
+}
@@ -0,0 +1,233 @@
+package replication_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/replication"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// engine is a replication target keeping lists and rules in maps and
+// profiles in a real detector
+type engine struct {
+	mu       sync.Mutex
+	lists    map[string][]string
+	rules    map[string]ruleset.Spec
+	authors  map[string]string
+	detector *detector.Detector
+}
+
+func newEngine(region string) *engine {
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.SetRegion(region)
+	return &engine{
+		lists:    make(map[string][]string),
+		rules:    make(map[string]ruleset.Spec),
+		authors:  make(map[string]string),
+		detector: d,
+	}
+}
+
+func (e *engine) ApplyList(region, name string, values []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lists[name] = values
+}
+
+func (e *engine) ApplyRule(region, id string, spec *ruleset.Spec) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if spec == nil {
+		delete(e.rules, id)
+		return
+	}
+	e.rules[id] = *spec
+	e.authors[id] = region
+}
+
+func (e *engine) LocalProfileSlot(accountID string) (detector.ProfileSlot, bool) {
+	return e.detector.LocalProfileSlot(accountID)
+}
+
+func (e *engine) MergeProfileSlot(accountID, region string, slot detector.ProfileSlot) bool {
+	return e.detector.MergeProfileSlot(accountID, region, slot)
+}
+
+func (e *engine) profile(t *testing.T, accountID string) detector.AccountProfile {
+	var state detector.State
+	e.detector.CheckpointState(func(s detector.State) { state = s })
+	profile, exists := state.Profiles[accountID]
+	require.True(t, exists, "profile of %s", accountID)
+	return profile
+}
+
+// mesh delivers deltas to the nodes in memory, keeping a copy of each
+type mesh struct {
+	mu        sync.Mutex
+	nodes     map[string]*replication.Node
+	delivered []replication.Delta
+	down      bool
+}
+
+func (m *mesh) Send(ctx context.Context, peer string, delta replication.Delta) error {
+	m.mu.Lock()
+	node, down := m.nodes[peer], m.down
+	if !down {
+		m.delivered = append(m.delivered, delta)
+	}
+	m.mu.Unlock()
+	if down {
+		return errors.New("peer unreachable")
+	}
+	_, err := node.Receive(delta)
+	return err
+}
+
+func pair(t *testing.T) (*mesh, *replication.Node, *engine, *replication.Node, *engine) {
+	m := &mesh{nodes: make(map[string]*replication.Node)}
+	east, west := newEngine("us-east"), newEngine("eu-west")
+	eastNode, err := replication.New(replication.Config{Region: "us-east", Peers: []string{"eu-west"}}, east, m)
+	require.NoError(t, err)
+	westNode, err := replication.New(replication.Config{Region: "eu-west", Peers: []string{"us-east"}}, west, m)
+	require.NoError(t, err)
+	m.nodes["us-east"], m.nodes["eu-west"] = eastNode, westNode
+	return m, eastNode, east, westNode, west
+}
+
+func analyze(t *testing.T, node *replication.Node, e *engine, id string, amount float64, at time.Time) {
+	e.detector.SetStateLog(node)
+	_, err := e.detector.Analyze(context.Background(), &detector.Transaction{
+		ID:        id,
+		AccountID: "ACC-1",
+		Amount:    amount,
+		Currency:  "USD",
+		Timestamp: at,
+	})
+	require.NoError(t, err)
+}
+
+func TestNode_ReplicatesListsAndRules(t *testing.T) {
+	_, eastNode, _, westNode, west := pair(t)
+
+	require.NoError(t, eastNode.SetList("blocked_ips", []string{"203.0.113.9", "198.51.100.2"}))
+	require.NoError(t, eastNode.SetRule("LARGE", &ruleset.Spec{ID: "LARGE", Expression: "tx.amount > 5000", Score: 0.4}))
+	eastNode.Flush(context.Background())
+
+	assert.Equal(t, []string{"198.51.100.2", "203.0.113.9"}, west.lists["blocked_ips"])
+	assert.Equal(t, "tx.amount > 5000", west.rules["LARGE"].Expression)
+	assert.Equal(t, "us-east", west.authors["LARGE"], "applied as written by the origin region")
+
+	// Deleting a rule replicates too
+	require.NoError(t, eastNode.SetRule("LARGE", nil))
+	eastNode.Flush(context.Background())
+	assert.NotContains(t, west.rules, "LARGE")
+
+	// Nothing went back to east
+	assert.Zero(t, westNode.Status()[0].PendingRegisters)
+}
+
+func TestNode_ConcurrentWritesConverge(t *testing.T) {
+	m, eastNode, east, westNode, west := pair(t)
+	m.down = true
+
+	require.NoError(t, eastNode.SetRule("R1", &ruleset.Spec{ID: "R1", Expression: "tx.amount > 100", Score: 0.2}))
+	time.Sleep(time.Millisecond)
+	require.NoError(t, westNode.SetRule("R1", &ruleset.Spec{ID: "R1", Expression: "tx.amount > 200", Score: 0.3}))
+	east.ApplyRule("us-east", "R1", &ruleset.Spec{ID: "R1", Expression: "tx.amount > 100", Score: 0.2})
+	west.ApplyRule("eu-west", "R1", &ruleset.Spec{ID: "R1", Expression: "tx.amount > 200", Score: 0.3})
+
+	eastNode.Flush(context.Background())
+	westNode.Flush(context.Background())
+	assert.Equal(t, "peer unreachable", eastNode.Status()[0].LastError)
+	assert.Equal(t, 1, eastNode.Status()[0].PendingRegisters, "a failed delivery stays pending")
+
+	m.down = false
+	westNode.Flush(context.Background())
+	eastNode.Flush(context.Background())
+
+	// The later of the concurrent writes wins in both regions
+	assert.Equal(t, "tx.amount > 200", east.rules["R1"].Expression)
+	assert.Equal(t, "tx.amount > 200", west.rules["R1"].Expression)
+	assert.Empty(t, eastNode.Status()[0].LastError)
+	assert.Zero(t, eastNode.Status()[0].PendingRegisters)
+
+	// A write that has seen the winner replaces it everywhere
+	require.NoError(t, eastNode.SetRule("R1", &ruleset.Spec{ID: "R1", Expression: "tx.amount > 300", Score: 0.3}))
+	eastNode.Flush(context.Background())
+	assert.Equal(t, "tx.amount > 300", west.rules["R1"].Expression)
+}
+
+func TestNode_MergesProfilesOnce(t *testing.T) {
+	m, eastNode, east, westNode, west := pair(t)
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	analyze(t, eastNode, east, "TXN-1", 100, start)
+	analyze(t, eastNode, east, "TXN-2", 300, start.Add(time.Minute))
+	analyze(t, westNode, west, "TXN-3", 50, start.Add(2*time.Minute))
+	eastNode.Flush(context.Background())
+	westNode.Flush(context.Background())
+
+	for _, e := range []*engine{east, west} {
+		profile := e.profile(t, "ACC-1")
+		assert.Equal(t, 3, profile.Count)
+		assert.InDelta(t, 450, profile.TotalAmount, 1e-9)
+		assert.InDelta(t, 300, profile.MaxAmount, 1e-9)
+		assert.Equal(t, start, profile.FirstSeen)
+		assert.Equal(t, start.Add(2*time.Minute), profile.LastSeen)
+	}
+
+	// Repeated and stale deliveries change nothing
+	for _, delta := range m.delivered {
+		target := westNode
+		if delta.Region == "eu-west" {
+			target = eastNode
+		}
+		applied, err := target.Receive(delta)
+		require.NoError(t, err)
+		assert.Zero(t, applied)
+	}
+	assert.Equal(t, 3, east.profile(t, "ACC-1").Count)
+
+	// Only what east added since is merged
+	analyze(t, eastNode, east, "TXN-4", 25, start.Add(3*time.Minute))
+	eastNode.Flush(context.Background())
+	assert.Equal(t, 4, west.profile(t, "ACC-1").Count)
+	assert.InDelta(t, 475, west.profile(t, "ACC-1").TotalAmount, 1e-9)
+}
+
+func TestNode_RejectsOwnRegion(t *testing.T) {
+	_, eastNode, _, _, _ := pair(t)
+	_, err := eastNode.Receive(replication.Delta{Region: "us-east"})
+	assert.Error(t, err)
+	_, err = eastNode.Receive(replication.Delta{})
+	assert.Error(t, err)
+}
+
+func TestNode_KeepsClocksAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replication.json")
+	config := replication.Config{Region: "us-east", Peers: []string{"eu-west"}, Path: path}
+	m := &mesh{nodes: make(map[string]*replication.Node)}
+	west := newEngine("eu-west")
+	westNode, err := replication.New(replication.Config{Region: "eu-west"}, west, m)
+	require.NoError(t, err)
+	m.nodes["eu-west"] = westNode
+
+	node, err := replication.New(config, newEngine("us-east"), m)
+	require.NoError(t, err)
+	require.NoError(t, node.SetList("vip", []string{"ACC-1"}))
+	node.Flush(context.Background())
+
+	restarted, err := replication.New(config, newEngine("us-east"), m)
+	require.NoError(t, err)
+	require.NoError(t, restarted.SetList("vip", []string{"ACC-2"}))
+	restarted.Flush(context.Background())
+	assert.Equal(t, []string{"ACC-2"}, west.lists["vip"], "the write after the restart supersedes the one before")
+}
@@ -0,0 +1,139 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+)
+
+// Webhook posts reports as JSON, signed like decision event deliveries
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// Deliver posts a report
+func (d *Webhook) Deliver(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.Secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(d.Secret, time.Now(), body))
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("report webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Email sends reports as an HTML message with the PDF attached. Username
+// and Password, when set, authenticate with PLAIN auth, which needs TLS
+// unless the server is local.
+type Email struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+// Deliver sends a report
+func (d *Email) Deliver(ctx context.Context, report Report) error {
+	message, err := d.message(report)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if d.Username != "" {
+		host, _, _ := net.SplitHostPort(d.Addr)
+		auth = smtp.PlainAuth("", d.Username, d.Password, host)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(d.Addr, auth, d.From, d.To, message) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Email) message(report Report) ([]byte, error) {
+	page, err := HTML(report)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	html, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(html, page)
+	pdf, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/pdf"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="` + report.ID + `.pdf"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(pdf, PDF(report))
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", d.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(d.To, ", "))
+	fmt.Fprintf(&message, "Subject: Fraud report %s to %s (%s)\r\n", report.Since.Format("2006-01-02"), report.Until.Format("2006-01-02"), report.Period)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// writeBase64 writes data in base64 lines of 76 characters
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
@@ -0,0 +1,186 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(rate float64) string { return fmt.Sprintf("%.1f%%", rate*100) },
+	"score":   func(score float64) string { return fmt.Sprintf("%.3f", score) },
+	"date":    func(r Report) string { return r.Since.Format("2006-01-02") + " to " + r.Until.Format("2006-01-02") },
+	"sorted":  sortedKeys[int],
+	"amounts": sortedKeys[float64],
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Fraud report {{.ID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #f2f2f2; }
+</style>
+</head>
+<body>
+<h1>Fraud report: {{.Period}}, {{date .}}</h1>
+{{if .Estimated}}<p>Volumes are estimated from sampled approvals.</p>{{end}}
+<h2>Volume</h2>
+<table>
+<tr><th>Transactions</th><td>{{.Volume.Transactions}}</td></tr>
+{{range $decision := sorted .Volume.Decisions}}<tr><th>{{$decision}}</th><td>{{index $.Volume.Decisions $decision}}</td></tr>
+{{end}}{{range $currency := amounts .Volume.Amounts}}<tr><th>Amount {{$currency}}</th><td>{{printf "%.2f" (index $.Volume.Amounts $currency)}}</td></tr>
+{{end}}<tr><th>Average risk score</th><td>{{score .Volume.AvgRiskScore}}</td></tr>
+</table>
+<h2>Labels</h2>
+<table>
+<tr><th>Labeled</th><td>{{.Labels.Labeled}}</td></tr>
+<tr><th>Fraud caught</th><td>{{.Labels.Caught}} of {{.Labels.Fraud}} ({{percent .Labels.CatchRate}})</td></tr>
+<tr><th>False positives</th><td>{{.Labels.FalsePositives}} of {{.Labels.Legitimate}} ({{percent .Labels.FalsePositiveRate}})</td></tr>
+</table>
+<h2>Top rules</h2>
+<table>
+<tr><th>Rule</th><th>Hits</th><th>Share</th></tr>
+{{range .TopRules}}<tr><td>{{.Rule}}</td><td>{{.Hits}}</td><td>{{percent .Share}}</td></tr>
+{{end}}</table>
+<h2>Top risky merchants</h2>
+<table>
+<tr><th>Merchant</th><th>Transactions</th><th>Decline rate</th><th>Average risk score</th><th>Fraud labels</th></tr>
+{{range .TopMerchants}}<tr><td>{{.MerchantID}}</td><td>{{.Transactions}}</td><td>{{percent .DeclineRate}}</td><td>{{score .AvgRiskScore}}</td><td>{{.FraudLabels}}</td></tr>
+{{end}}</table>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</p>
+</body>
+</html>
+`))
+
+// HTML renders a report as an HTML page
+func HTML(r Report) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// textLines lays a report out as plain text, one table row per line
+func textLines(r Report) []string {
+	lines := []string{
+		fmt.Sprintf("Fraud report: %s, %s to %s", r.Period, r.Since.Format("2006-01-02"), r.Until.Format("2006-01-02")),
+		"",
+		"VOLUME",
+		fmt.Sprintf("  Transactions: %d", r.Volume.Transactions),
+	}
+	for _, decision := range sortedKeys(r.Volume.Decisions) {
+		lines = append(lines, fmt.Sprintf("  %s: %d", decision, r.Volume.Decisions[decision]))
+	}
+	for _, currency := range sortedKeys(r.Volume.Amounts) {
+		lines = append(lines, fmt.Sprintf("  Amount %s: %.2f", currency, r.Volume.Amounts[currency]))
+	}
+	lines = append(lines,
+		fmt.Sprintf("  Average risk score: %.3f", r.Volume.AvgRiskScore),
+		"",
+		"LABELS",
+		fmt.Sprintf("  Labeled: %d", r.Labels.Labeled),
+		fmt.Sprintf("  Fraud caught: %d of %d (%.1f%%)", r.Labels.Caught, r.Labels.Fraud, r.Labels.CatchRate*100),
+		fmt.Sprintf("  False positives: %d of %d (%.1f%%)", r.Labels.FalsePositives, r.Labels.Legitimate, r.Labels.FalsePositiveRate*100),
+		"",
+		"TOP RULES",
+	)
+	for _, rule := range r.TopRules {
+		lines = append(lines, fmt.Sprintf("  %-32s %8d hits  %5.1f%%", rule.Rule, rule.Hits, rule.Share*100))
+	}
+	lines = append(lines, "", "TOP RISKY MERCHANTS")
+	for _, merchant := range r.TopMerchants {
+		lines = append(lines, fmt.Sprintf("  %-24s %8d tx  %5.1f%% declined  risk %.3f  %d fraud",
+			merchant.MerchantID, merchant.Transactions, merchant.DeclineRate*100, merchant.AvgRiskScore, merchant.FraudLabels))
+	}
+	if r.Estimated {
+		lines = append(lines, "", "Volumes are estimated from sampled approvals.")
+	}
+	return append(lines, "", "Generated "+r.GeneratedAt.Format("2006-01-02 15:04 MST"))
+}
+
+// PDF lines per A4 page, at 12pt leading
+const pdfLinesPerPage = 60
+
+// PDF renders a report as a plain text PDF in a monospace font
+func PDF(r Report) []byte {
+	lines := textLines(r)
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and its content
+	// stream for each page
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		content.WriteString("BT /F1 10 Tf 12 TL 40 800 Td\n")
+		for _, line := range page {
+			content.WriteString("(" + pdfEscape(line) + ") Tj T*\n")
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfEscape escapes a line for a PDF string, replacing what the standard
+// fonts cannot show
+func pdfEscape(line string) string {
+	var b strings.Builder
+	for _, r := range line {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,444 @@
+// Package report aggregates the audited decisions of a day or a week into a
+// fraud report: volumes, the catch rate of the fraud labeled in the period,
+// the rules that fired most and the riskiest merchants. Reports are kept for
+// retrieval and delivered by email or webhook when scheduled.
+package report
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+)
+
+// Report periods
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// Config holds the reporting settings. Periods end at midnight in Location;
+// weekly reports end on Mondays.
+type Config struct {
+	Periods  []string
+	Location *time.Location
+	// TopN bounds the rules and merchants listed
+	TopN int
+	// MinMerchantTransactions is the volume a merchant needs to be ranked
+	MinMerchantTransactions int
+	// History is the number of reports kept
+	History int
+}
+
+// DefaultConfig returns the default reporting settings
+func DefaultConfig() Config {
+	return Config{
+		Periods:                 []string{Daily, Weekly},
+		Location:                time.UTC,
+		TopN:                    10,
+		MinMerchantTransactions: 10,
+		History:                 90,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if len(c.Periods) == 0 {
+		c.Periods = defaults.Periods
+	}
+	if c.Location == nil {
+		c.Location = defaults.Location
+	}
+	if c.TopN <= 0 {
+		c.TopN = defaults.TopN
+	}
+	if c.MinMerchantTransactions <= 0 {
+		c.MinMerchantTransactions = defaults.MinMerchantTransactions
+	}
+	if c.History <= 0 {
+		c.History = defaults.History
+	}
+	return c
+}
+
+// Validate checks the periods
+func (c Config) Validate() error {
+	for _, period := range c.Periods {
+		if period != Daily && period != Weekly {
+			return fmt.Errorf("unknown report period %q", period)
+		}
+	}
+	return nil
+}
+
+// Volume counts the decisions of a period. Amounts are totals by currency.
+type Volume struct {
+	Transactions int                `json:"transactions"`
+	Decisions    map[string]int     `json:"decisions"`
+	Amounts      map[string]float64 `json:"amounts"`
+	AvgRiskScore float64            `json:"avg_risk_score"`
+}
+
+// LabelStats cover the feedback labels received in a period. Fraud is
+// caught when it was declined or sent to review; a legitimate transaction
+// declined is a false positive.
+type LabelStats struct {
+	Labeled           int     `json:"labeled"`
+	Fraud             int     `json:"fraud"`
+	Caught            int     `json:"caught"`
+	CatchRate         float64 `json:"catch_rate"`
+	Legitimate        int     `json:"legitimate"`
+	FalsePositives    int     `json:"false_positives"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// RuleHits is how often a rule fired; Share is out of all transactions
+type RuleHits struct {
+	Rule  string  `json:"rule"`
+	Hits  int     `json:"hits"`
+	Share float64 `json:"share"`
+}
+
+// MerchantRisk summarizes the decisions of a merchant
+type MerchantRisk struct {
+	MerchantID   string  `json:"merchant_id"`
+	Transactions int     `json:"transactions"`
+	Declines     int     `json:"declines"`
+	DeclineRate  float64 `json:"decline_rate"`
+	AvgRiskScore float64 `json:"avg_risk_score"`
+	FraudLabels  int     `json:"fraud_labels"`
+}
+
+// Report is the fraud report of a period, from Since up to Until
+type Report struct {
+	ID           string         `json:"id" doc:"The period and its first day, e.g. daily-2024-03-01"`
+	Period       string         `json:"period"`
+	Since        time.Time      `json:"since"`
+	Until        time.Time      `json:"until"`
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Volume       Volume         `json:"volume"`
+	Labels       LabelStats     `json:"labels"`
+	TopRules     []RuleHits     `json:"top_rules"`
+	TopMerchants []MerchantRisk `json:"top_merchants" doc:"Merchants with the highest average risk score"`
+	// Estimated is set when sampled approvals were weighed up
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Entry identifies a kept report
+type Entry struct {
+	ID          string    `json:"id"`
+	Period      string    `json:"period"`
+	Since       time.Time `json:"since"`
+	Until       time.Time `json:"until"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Deliverer sends a scheduled report somewhere
+type Deliverer interface {
+	Deliver(ctx context.Context, report Report) error
+}
+
+// Generator computes reports from the audit store and the feedback labels
+// it is given
+type Generator struct {
+	config     Config
+	store      audit.Store
+	deliverers []Deliverer
+	labels     map[string]label
+	reports    map[string]Report
+	mu         sync.Mutex
+}
+
+type label struct {
+	fraud bool
+	at    time.Time
+}
+
+// labelRetention covers the last complete week at any time of the next one
+const labelRetention = 14 * 24 * time.Hour
+
+func NewGenerator(config Config, store audit.Store, deliverers ...Deliverer) (*Generator, error) {
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Generator{
+		config:     config,
+		store:      store,
+		deliverers: deliverers,
+		labels:     make(map[string]label),
+		reports:    make(map[string]Report),
+	}, nil
+}
+
+// Label records whether a transaction turned out to be fraud, replacing an
+// earlier label
+func (g *Generator) Label(transactionID string, fraud bool, at time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.labels[transactionID] = label{fraud: fraud, at: at}
+}
+
+// Bounds returns the last complete period before now
+func (g *Generator) Bounds(period string, now time.Time) (since, until time.Time, err error) {
+	local := now.In(g.config.Location)
+	until = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, g.config.Location)
+	switch period {
+	case Daily:
+		return until.AddDate(0, 0, -1), until, nil
+	case Weekly:
+		until = until.AddDate(0, 0, -int((until.Weekday()+6)%7))
+		return until.AddDate(0, 0, -7), until, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown report period %q", period)
+	}
+}
+
+// Generate computes the report of the last complete period before now, and
+// keeps it in place of an earlier report of the same period
+func (g *Generator) Generate(period string, now time.Time) (Report, error) {
+	since, until, err := g.Bounds(period, now)
+	if err != nil {
+		return Report{}, err
+	}
+	records, err := g.store.Since(since)
+	if err != nil {
+		return Report{}, err
+	}
+	var inPeriod []audit.Record
+	for _, record := range records {
+		if record.DecidedAt.Before(until) {
+			inPeriod = append(inPeriod, record)
+		}
+	}
+
+	g.mu.Lock()
+	for id, l := range g.labels {
+		if l.at.Before(now.Add(-labelRetention)) {
+			delete(g.labels, id)
+		}
+	}
+	labels := make(map[string]bool)
+	for id, l := range g.labels {
+		if !l.at.Before(since) && l.at.Before(until) {
+			labels[id] = l.fraud
+		}
+	}
+	g.mu.Unlock()
+
+	report := Report{
+		ID:          period + "-" + since.Format("2006-01-02"),
+		Period:      period,
+		Since:       since,
+		Until:       until,
+		GeneratedAt: now,
+	}
+	report.Labels, err = g.labelStats(labels)
+	if err != nil {
+		return Report{}, err
+	}
+	g.aggregate(&report, inPeriod, labels)
+
+	g.mu.Lock()
+	g.reports[report.ID] = report
+	g.prune()
+	g.mu.Unlock()
+	return report, nil
+}
+
+// labelStats looks up the decisions of the labeled transactions, which may
+// predate the period
+func (g *Generator) labelStats(labels map[string]bool) (LabelStats, error) {
+	var stats LabelStats
+	for id, fraud := range labels {
+		records, err := g.store.Search(audit.Query{TransactionID: id, Limit: 1})
+		if err != nil {
+			return stats, err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		stats.Labeled++
+		if fraud {
+			stats.Fraud++
+			if records[0].Decision != decision.Approve {
+				stats.Caught++
+			}
+		} else {
+			stats.Legitimate++
+			if records[0].Decision == decision.Decline {
+				stats.FalsePositives++
+			}
+		}
+	}
+	if stats.Fraud > 0 {
+		stats.CatchRate = float64(stats.Caught) / float64(stats.Fraud)
+	}
+	if stats.Legitimate > 0 {
+		stats.FalsePositiveRate = float64(stats.FalsePositives) / float64(stats.Legitimate)
+	}
+	return stats, nil
+}
+
+func (g *Generator) aggregate(report *Report, records []audit.Record, labels map[string]bool) {
+	summary := audit.Summarize(records)
+	report.Estimated = summary.Estimated
+	report.Volume = Volume{
+		Transactions: summary.Total,
+		Decisions:    summary.Decisions,
+		Amounts:      map[string]float64{},
+		AvgRiskScore: summary.AvgRiskScore,
+	}
+
+	byMerchant := make(map[string][]audit.Record)
+	for _, record := range records {
+		weight := 1.0
+		if record.SampleRate > 0 && record.SampleRate < 1 {
+			weight = 1 / record.SampleRate
+		}
+		report.Volume.Amounts[record.Transaction.Currency] += weight * record.Transaction.Amount
+		if record.Transaction.MerchantID != "" {
+			byMerchant[record.Transaction.MerchantID] = append(byMerchant[record.Transaction.MerchantID], record)
+		}
+	}
+	for currency, amount := range report.Volume.Amounts {
+		report.Volume.Amounts[currency] = math.Round(amount*100) / 100
+	}
+
+	report.TopRules = []RuleHits{}
+	for rule, hits := range summary.ReasonCodes {
+		report.TopRules = append(report.TopRules, RuleHits{Rule: rule, Hits: hits, Share: float64(hits) / float64(summary.Total)})
+	}
+	sort.Slice(report.TopRules, func(i, j int) bool {
+		a, b := report.TopRules[i], report.TopRules[j]
+		if a.Hits != b.Hits {
+			return a.Hits > b.Hits
+		}
+		return a.Rule < b.Rule
+	})
+	if len(report.TopRules) > g.config.TopN {
+		report.TopRules = report.TopRules[:g.config.TopN]
+	}
+
+	report.TopMerchants = []MerchantRisk{}
+	for merchantID, own := range byMerchant {
+		merchant := audit.Summarize(own)
+		if merchant.Total < g.config.MinMerchantTransactions {
+			continue
+		}
+		risk := MerchantRisk{
+			MerchantID:   merchantID,
+			Transactions: merchant.Total,
+			Declines:     merchant.Decisions[decision.Decline],
+			DeclineRate:  float64(merchant.Decisions[decision.Decline]) / float64(merchant.Total),
+			AvgRiskScore: merchant.AvgRiskScore,
+		}
+		for _, record := range own {
+			if labels[record.Transaction.ID] {
+				risk.FraudLabels++
+			}
+		}
+		report.TopMerchants = append(report.TopMerchants, risk)
+	}
+	sort.Slice(report.TopMerchants, func(i, j int) bool {
+		a, b := report.TopMerchants[i], report.TopMerchants[j]
+		if a.AvgRiskScore != b.AvgRiskScore {
+			return a.AvgRiskScore > b.AvgRiskScore
+		}
+		return a.MerchantID < b.MerchantID
+	})
+	if len(report.TopMerchants) > g.config.TopN {
+		report.TopMerchants = report.TopMerchants[:g.config.TopN]
+	}
+}
+
+// prune drops the oldest reports beyond the history
+func (g *Generator) prune() {
+	if len(g.reports) <= g.config.History {
+		return
+	}
+	entries := g.entries()
+	for _, entry := range entries[g.config.History:] {
+		delete(g.reports, entry.ID)
+	}
+}
+
+// Reports lists the kept reports, most recent period first
+func (g *Generator) Reports() []Entry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.entries()
+}
+
+func (g *Generator) entries() []Entry {
+	entries := make([]Entry, 0, len(g.reports))
+	for _, report := range g.reports {
+		entries = append(entries, Entry{
+			ID:          report.ID,
+			Period:      report.Period,
+			Since:       report.Since,
+			Until:       report.Until,
+			GeneratedAt: report.GeneratedAt,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Until.Equal(entries[j].Until) {
+			return entries[i].Until.After(entries[j].Until)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Get returns a kept report
+func (g *Generator) Get(id string) (Report, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	report, exists := g.reports[id]
+	return report, exists
+}
+
+// Start generates and delivers the reports of the configured periods as
+// each ends, until stop is closed
+func (g *Generator) Start(stop <-chan struct{}) {
+	for {
+		now := time.Now()
+		_, next, _ := g.Bounds(Daily, now)
+		timer := time.NewTimer(next.AddDate(0, 0, 1).Sub(now))
+		select {
+		case fired := <-timer.C:
+			g.runScheduled(fired)
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (g *Generator) runScheduled(now time.Time) {
+	for _, period := range g.config.Periods {
+		if period == Weekly && now.In(g.config.Location).Weekday() != time.Monday {
+			continue
+		}
+		report, err := g.Generate(period, now)
+		if err != nil {
+			log.Printf("Generating the %s report failed: %v", period, err)
+			continue
+		}
+		log.Printf("Generated report %s: %d transactions", report.ID, report.Volume.Transactions)
+		for _, deliverer := range g.deliverers {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := deliverer.Deliver(ctx, report); err != nil {
+				log.Printf("Delivering report %s failed: %v", report.ID, err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package report_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/audit"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/report"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Wednesday
+var now = time.Date(2024, 3, 6, 9, 30, 0, 0, time.UTC)
+
+func newGenerator(t *testing.T) (*report.Generator, *audit.MemoryStore) {
+	store := audit.NewMemoryStore(1000)
+	generator, err := report.NewGenerator(report.Config{TopN: 2, MinMerchantTransactions: 3}, store)
+	require.NoError(t, err)
+	return generator, store
+}
+
+func save(t *testing.T, store *audit.MemoryStore, id, merchant, decision string, score float64, at time.Time, codes ...string) {
+	require.NoError(t, store.Save(audit.Record{
+		Transaction: detector.Transaction{ID: id, MerchantID: merchant, Amount: 100, Currency: "USD"},
+		Decision:    decision,
+		RiskScore:   score,
+		ReasonCodes: codes,
+		DecidedAt:   at,
+	}))
+}
+
+func TestGenerator_Bounds(t *testing.T) {
+	generator, _ := newGenerator(t)
+
+	since, until, err := generator.Bounds(report.Daily, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), since)
+	assert.Equal(t, time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC), until)
+
+	since, until, err = generator.Bounds(report.Weekly, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), since, "weeks start on Mondays")
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), until)
+
+	_, _, err = generator.Bounds("monthly", now)
+	assert.Error(t, err)
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	generator, store := newGenerator(t)
+	yesterday := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		save(t, store, fmt.Sprintf("risky-%d", i), "m-risky", "DECLINE", 0.9, yesterday, "HIGH_AMOUNT", "NEW_DEVICE")
+		save(t, store, fmt.Sprintf("safe-%d", i), "m-safe", "APPROVE", 0.1, yesterday)
+	}
+	save(t, store, "small-0", "m-small", "REVIEW", 0.95, yesterday, "HIGH_AMOUNT", "UNUSUAL_TIME")
+	save(t, store, "today", "m-safe", "APPROVE", 0.1, now)
+	save(t, store, "missed", "m-safe", "APPROVE", 0.2, yesterday.Add(-48*time.Hour))
+
+	generator.Label("risky-0", true, yesterday.Add(time.Hour))
+	generator.Label("missed", true, yesterday.Add(time.Hour))
+	generator.Label("small-0", true, yesterday.Add(time.Hour))
+	generator.Label("risky-1", false, yesterday.Add(time.Hour))
+	generator.Label("safe-0", false, now)
+
+	daily, err := generator.Generate(report.Daily, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "daily-2024-03-05", daily.ID)
+	assert.Equal(t, 7, daily.Volume.Transactions, "today's decision is outside the period")
+	assert.Equal(t, map[string]int{"APPROVE": 3, "DECLINE": 3, "REVIEW": 1}, daily.Volume.Decisions)
+	assert.Equal(t, map[string]float64{"USD": 700}, daily.Volume.Amounts)
+
+	assert.Equal(t, report.LabelStats{
+		Labeled:           4,
+		Fraud:             3,
+		Caught:            2,
+		CatchRate:         2.0 / 3,
+		Legitimate:        1,
+		FalsePositives:    1,
+		FalsePositiveRate: 1,
+	}, daily.Labels, "labels received in the period count, whenever the decision was made")
+
+	require.Len(t, daily.TopRules, 2)
+	assert.Equal(t, report.RuleHits{Rule: "HIGH_AMOUNT", Hits: 4, Share: 4.0 / 7}, daily.TopRules[0])
+	assert.Equal(t, "NEW_DEVICE", daily.TopRules[1].Rule)
+
+	require.Len(t, daily.TopMerchants, 2, "m-small is below the minimum volume")
+	assert.Equal(t, report.MerchantRisk{
+		MerchantID:   "m-risky",
+		Transactions: 3,
+		Declines:     3,
+		DeclineRate:  1,
+		AvgRiskScore: 0.9,
+		FraudLabels:  1,
+	}, daily.TopMerchants[0])
+	assert.Equal(t, "m-safe", daily.TopMerchants[1].MerchantID)
+
+	kept, exists := generator.Get(daily.ID)
+	assert.True(t, exists)
+	assert.Equal(t, daily.Volume, kept.Volume)
+
+	weekly, err := generator.Generate(report.Weekly, now)
+	require.NoError(t, err)
+	assert.Equal(t, "weekly-2024-02-26", weekly.ID)
+	assert.Equal(t, 1, weekly.Volume.Transactions)
+
+	entries := generator.Reports()
+	require.Len(t, entries, 2)
+	assert.Equal(t, daily.ID, entries[0].ID, "the most recent period comes first")
+}
+
+func TestRender(t *testing.T) {
+	generator, store := newGenerator(t)
+	save(t, store, "tx-1", "<script>", "DECLINE", 0.9, time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC), "HIGH_AMOUNT")
+	r, err := generator.Generate(report.Daily, now)
+	require.NoError(t, err)
+
+	html, err := report.HTML(r)
+	require.NoError(t, err)
+	assert.Contains(t, string(html), "HIGH_AMOUNT")
+	assert.Contains(t, string(html), "2024-03-05 to 2024-03-06")
+
+	pdf := report.PDF(r)
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.Contains(t, string(pdf), "(  HIGH_AMOUNT")
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+}
+
+func TestWebhook_Deliver(t *testing.T) {
+	var received report.Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.NoError(t, events.VerifySignature("secret", r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()))
+		require.NoError(t, json.Unmarshal(body, &received))
+	}))
+	defer server.Close()
+
+	deliverer := &report.Webhook{URL: server.URL, Secret: "secret"}
+	require.NoError(t, deliverer.Deliver(context.Background(), report.Report{ID: "daily-2024-03-05"}))
+	assert.Equal(t, "daily-2024-03-05", received.ID)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	assert.Error(t, (&report.Webhook{URL: failing.URL}).Deliver(context.Background(), report.Report{}))
+}
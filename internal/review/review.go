@@ -0,0 +1,483 @@
+// Package review holds the queue of REVIEW decisions waiting for an analyst
+// and enforces the service levels tenants set on resolving them: a case not
+// resolved in time breaches its SLA and is escalated, or approved or
+// declined on the analyst's behalf. A secondary model triages the cases by
+// their expected loss, ranking them again as linked decisions and feedback
+// labels arrive.
+package review
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+)
+
+// Actions taken on a case when its SLA expires
+const (
+	ActionEscalate = "escalate"
+	ActionApprove  = "approve"
+	ActionDecline  = "decline"
+)
+
+// Statuses of a case
+const (
+	StatusOpen      = "open"
+	StatusEscalated = "escalated"
+	StatusResolved  = "resolved"
+)
+
+// ResolvedBySLA is the resolver of the cases approved or declined when their
+// SLA expired
+const ResolvedBySLA = "sla"
+
+// Errors returned when resolving a case
+var (
+	ErrNotFound        = errors.New("review case not found")
+	ErrResolved        = errors.New("review case was already resolved")
+	ErrInvalidDecision = errors.New("review cases are resolved with APPROVE or DECLINE")
+)
+
+// Policy is the SLA of a tenant's review cases
+type Policy struct {
+	// ResolveWithin is how long a case may wait for an analyst, e.g. "2h";
+	// empty sets no SLA
+	ResolveWithin string `json:"resolve_within"`
+	// OnExpiry is the action taken on cases still waiting when it expires:
+	// escalate (the default), approve or decline
+	OnExpiry string `json:"on_expiry,omitempty"`
+}
+
+// Validate checks the window and the expiry action
+func (p Policy) Validate() error {
+	if p.ResolveWithin != "" {
+		window, err := time.ParseDuration(p.ResolveWithin)
+		if err != nil {
+			return fmt.Errorf("invalid resolve_within %q: %w", p.ResolveWithin, err)
+		}
+		if window <= 0 {
+			return fmt.Errorf("resolve_within %s must be positive", p.ResolveWithin)
+		}
+	}
+	switch p.OnExpiry {
+	case "", ActionEscalate, ActionApprove, ActionDecline:
+		return nil
+	}
+	return fmt.Errorf("on_expiry %q must be escalate, approve or decline", p.OnExpiry)
+}
+
+// Window returns how long cases may wait, zero when there is no SLA
+func (p Policy) Window() time.Duration {
+	window, err := time.ParseDuration(p.ResolveWithin)
+	if err != nil || window < 0 {
+		return 0
+	}
+	return window
+}
+
+func (p Policy) action() string {
+	if p.OnExpiry == "" {
+		return ActionEscalate
+	}
+	return p.OnExpiry
+}
+
+// Case is a REVIEW decision in the queue
+type Case struct {
+	TransactionID string    `json:"transaction_id"`
+	MerchantID    string    `json:"merchant_id,omitempty"`
+	Tenant        string    `json:"tenant,omitempty"`
+	RiskScore     float64   `json:"risk_score"`
+	ReasonCodes   []string  `json:"reason_codes,omitempty"`
+	Status        string    `json:"status"`
+	EnqueuedAt    time.Time `json:"enqueued_at"`
+	// Amount and Currency are those of the transaction, and Entities its
+	// account, device and IP address as "account:<id>", "device:<id>" and
+	// "ip:<address>", by which other decisions are linked to the case
+	Amount   float64  `json:"amount"`
+	Currency string   `json:"currency,omitempty"`
+	Entities []string `json:"entities,omitempty"`
+	// FraudProbability is the triage model's estimate that the case is fraud
+	// and TriageScore the expected loss, the probability times the amount,
+	// by which the queue is ranked. Both are computed again when evidence
+	// arrives, at TriagedAt.
+	FraudProbability float64    `json:"fraud_probability"`
+	TriageScore      float64    `json:"triage_score"`
+	TriagedAt        *time.Time `json:"triaged_at,omitempty"`
+	Evidence         Evidence   `json:"evidence"`
+	// DueAt is when the SLA expires, nil when the tenant has none, and
+	// OnExpiry the action then taken
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	OnExpiry string     `json:"on_expiry,omitempty"`
+	// Breached is set once the case has waited past its SLA
+	Breached    bool       `json:"breached"`
+	EscalatedAt *time.Time `json:"escalated_at,omitempty"`
+	// Resolution is the APPROVE or DECLINE the case was resolved with, by an
+	// analyst or, on SLA expiry, by "sla"
+	Resolution string     `json:"resolution,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	// TimeInQueue is how long the case waited, in seconds, until it was
+	// resolved or until now
+	TimeInQueue float64 `json:"time_in_queue_seconds"`
+}
+
+func (c *Case) waited(now time.Time) time.Duration {
+	if c.ResolvedAt != nil {
+		return c.ResolvedAt.Sub(c.EnqueuedAt)
+	}
+	return now.Sub(c.EnqueuedAt)
+}
+
+// TenantSummary is the state of the review queue of a tenant. Counts of
+// resolutions and breaches cover every case since the engine started.
+type TenantSummary struct {
+	Tenant string  `json:"tenant"`
+	Policy *Policy `json:"policy,omitempty"`
+	// Open counts the cases waiting, Escalated those of them escalated and
+	// Overdue those past their SLA
+	Open      int `json:"open"`
+	Escalated int `json:"escalated"`
+	Overdue   int `json:"overdue"`
+	// OldestWait is the time in queue of the oldest waiting case, in seconds
+	OldestWait float64 `json:"oldest_wait_seconds"`
+	Resolved   int     `json:"resolved"`
+	// ResolvedWithinSLA counts the cases an analyst resolved before their
+	// SLA expired
+	ResolvedWithinSLA int `json:"resolved_within_sla"`
+	Breaches          int `json:"breaches"`
+	// MeanTimeToResolve is the mean time in queue of resolved cases, in
+	// seconds
+	MeanTimeToResolve float64 `json:"mean_time_to_resolve_seconds"`
+}
+
+// Observer is told of resolutions and SLA breaches
+type Observer interface {
+	// ObserveReviewResolved records a resolved case, resolvedBy being
+	// "analyst" or "sla"
+	ObserveReviewResolved(tenant, resolution, resolvedBy string, waited time.Duration)
+	ObserveReviewBreach(tenant, action string)
+}
+
+type tally struct {
+	resolved  int
+	withinSLA int
+	breaches  int
+	waited    time.Duration
+}
+
+// Queue holds the review cases. Resolved cases are kept up to a limit,
+// dropping the oldest resolved first.
+type Queue struct {
+	policy   func(tenant string) Policy
+	retain   int
+	cases    map[string]*Case
+	resolved []string
+	tallies  map[string]*tally
+	observer Observer
+	triager  Triager
+	// entities are the waiting cases by entity and links their linked
+	// decisions, by case
+	entities map[string]map[string]bool
+	links    map[string]map[string]*linkState
+	mu       sync.Mutex
+}
+
+// NewQueue creates a queue reading the SLA of each tenant from policy and
+// keeping up to retain resolved cases
+func NewQueue(policy func(tenant string) Policy, retain int) *Queue {
+	if retain <= 0 {
+		retain = 10000
+	}
+	return &Queue{
+		policy:   policy,
+		retain:   retain,
+		cases:    make(map[string]*Case),
+		tallies:  make(map[string]*tally),
+		triager:  DefaultTriageModel(),
+		entities: make(map[string]map[string]bool),
+		links:    make(map[string]map[string]*linkState),
+	}
+}
+
+// SetObserver sets the observer of resolutions and breaches
+func (q *Queue) SetObserver(observer Observer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.observer = observer
+}
+
+// Enqueue adds an open case, due within the SLA its tenant has at the time
+// it was enqueued and triaged with the decisions already linked to it. A
+// transaction reviewed again replaces its open case.
+func (q *Queue) Enqueue(c Case, links ...Link) Case {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if existing, exists := q.cases[c.TransactionID]; exists && existing.Status == StatusResolved {
+		q.forget(c.TransactionID)
+	} else if exists {
+		q.unindex(existing)
+	}
+	c.Status = StatusOpen
+	c.DueAt, c.OnExpiry = nil, ""
+	c.Breached, c.EscalatedAt = false, nil
+	c.Resolution, c.ResolvedBy, c.ResolvedAt, c.Comment = "", "", nil, ""
+	policy := q.policy(c.Tenant)
+	if window := policy.Window(); window > 0 {
+		due := c.EnqueuedAt.Add(window)
+		c.DueAt = &due
+		c.OnExpiry = policy.action()
+	}
+	c.Evidence = Evidence{}
+	q.index(&c, links)
+	q.triage(&c, c.EnqueuedAt)
+	q.cases[c.TransactionID] = &c
+	return c
+}
+
+// Get returns a case as of now
+func (q *Queue) Get(id string, now time.Time) (Case, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c, exists := q.cases[id]
+	if !exists {
+		return Case{}, false
+	}
+	return snapshot(c, now), true
+}
+
+// List returns the cases with a status, or every case when it is empty, of
+// a tenant, or of every tenant when it is empty, oldest first
+func (q *Queue) List(status, tenant string, now time.Time) []Case {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cases := []Case{}
+	for _, c := range q.cases {
+		if status != "" && c.Status != status {
+			continue
+		}
+		if tenant != "" && c.Tenant != tenant {
+			continue
+		}
+		cases = append(cases, snapshot(c, now))
+	}
+	sort.Slice(cases, func(i, j int) bool {
+		if !cases[i].EnqueuedAt.Equal(cases[j].EnqueuedAt) {
+			return cases[i].EnqueuedAt.Before(cases[j].EnqueuedAt)
+		}
+		return cases[i].TransactionID < cases[j].TransactionID
+	})
+	return cases
+}
+
+// Resolve approves or declines a waiting case on an analyst's behalf
+func (q *Queue) Resolve(id, resolution, analyst, comment string, at time.Time) (Case, error) {
+	if resolution != decision.Approve && resolution != decision.Decline {
+		return Case{}, ErrInvalidDecision
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c, exists := q.cases[id]
+	switch {
+	case !exists:
+		return Case{}, ErrNotFound
+	case c.Status == StatusResolved:
+		return Case{}, ErrResolved
+	}
+	if c.DueAt != nil && !at.Before(*c.DueAt) && !c.Breached {
+		q.breach(c)
+	}
+	q.resolve(c, resolution, analyst, at)
+	c.Comment = comment
+	return snapshot(c, at), nil
+}
+
+// Expire acts on the waiting cases whose SLA expired by now, returning them
+// as changed. Each case breaches its SLA once; escalated cases stay in the
+// queue for an analyst.
+func (q *Queue) Expire(now time.Time) []Case {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var expired []Case
+	for _, c := range q.cases {
+		if c.Status == StatusResolved || c.Breached || c.DueAt == nil || now.Before(*c.DueAt) {
+			continue
+		}
+		q.breach(c)
+		switch c.OnExpiry {
+		case ActionApprove:
+			q.resolve(c, decision.Approve, ResolvedBySLA, *c.DueAt)
+		case ActionDecline:
+			q.resolve(c, decision.Decline, ResolvedBySLA, *c.DueAt)
+		default:
+			at := *c.DueAt
+			c.Status = StatusEscalated
+			c.EscalatedAt = &at
+		}
+		expired = append(expired, snapshot(c, now))
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].DueAt.Before(*expired[j].DueAt)
+	})
+	return expired
+}
+
+// Summary returns the state of the queue of every tenant with cases or an
+// SLA, by tenant
+func (q *Queue) Summary(tenants []string, now time.Time) []TenantSummary {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	summaries := make(map[string]*TenantSummary)
+	get := func(tenant string) *TenantSummary {
+		if summaries[tenant] == nil {
+			summaries[tenant] = &TenantSummary{Tenant: tenant}
+			if policy := q.policy(tenant); policy.Window() > 0 {
+				summaries[tenant].Policy = &policy
+			}
+		}
+		return summaries[tenant]
+	}
+	for _, tenant := range tenants {
+		get(tenant)
+	}
+	for _, c := range q.cases {
+		if c.Status == StatusResolved {
+			continue
+		}
+		summary := get(c.Tenant)
+		summary.Open++
+		if c.Status == StatusEscalated {
+			summary.Escalated++
+		}
+		if c.DueAt != nil && !now.Before(*c.DueAt) {
+			summary.Overdue++
+		}
+		if waited := c.waited(now).Seconds(); waited > summary.OldestWait {
+			summary.OldestWait = waited
+		}
+	}
+	for tenant, t := range q.tallies {
+		summary := get(tenant)
+		summary.Resolved = t.resolved
+		summary.ResolvedWithinSLA = t.withinSLA
+		summary.Breaches = t.breaches
+		if t.resolved > 0 {
+			summary.MeanTimeToResolve = t.waited.Seconds() / float64(t.resolved)
+		}
+	}
+
+	list := make([]TenantSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, *summary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tenant < list[j].Tenant })
+	return list
+}
+
+// Start expires cases at the given interval until stop is closed, passing
+// the cases changed to onExpire
+func (q *Queue) Start(interval time.Duration, onExpire func([]Case), stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			expired := q.Expire(time.Now())
+			for _, c := range expired {
+				log.Printf("Review of %s breached its SLA due at %s and was %s", c.TransactionID, c.DueAt.Format(time.RFC3339), expiryOutcome(c))
+			}
+			if len(expired) > 0 {
+				onExpire(expired)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func expiryOutcome(c Case) string {
+	switch c.Resolution {
+	case decision.Approve:
+		return "approved"
+	case decision.Decline:
+		return "declined"
+	}
+	return "escalated"
+}
+
+// breach marks a case past its SLA. Callers must hold the lock.
+func (q *Queue) breach(c *Case) {
+	c.Breached = true
+	q.tally(c.Tenant).breaches++
+	if q.observer != nil {
+		q.observer.ObserveReviewBreach(c.Tenant, c.OnExpiry)
+	}
+}
+
+// resolve closes a case and drops the oldest resolved cases beyond the limit.
+// Callers must hold the lock.
+func (q *Queue) resolve(c *Case, resolution, by string, at time.Time) {
+	c.Status = StatusResolved
+	c.Resolution = resolution
+	c.ResolvedBy = by
+	c.ResolvedAt = &at
+	q.unindex(c)
+
+	waited := c.waited(at)
+	t := q.tally(c.Tenant)
+	t.resolved++
+	t.waited += waited
+	if !c.Breached {
+		t.withinSLA++
+	}
+	if q.observer != nil {
+		resolvedBy := "analyst"
+		if by == ResolvedBySLA {
+			resolvedBy = ResolvedBySLA
+		}
+		q.observer.ObserveReviewResolved(c.Tenant, resolution, resolvedBy, waited)
+	}
+
+	q.resolved = append(q.resolved, c.TransactionID)
+	for len(q.resolved) > q.retain {
+		delete(q.cases, q.resolved[0])
+		q.resolved = q.resolved[1:]
+	}
+}
+
+// forget drops a resolved case from the retained ones. Callers must hold the
+// lock.
+func (q *Queue) forget(id string) {
+	for i, resolved := range q.resolved {
+		if resolved == id {
+			q.resolved = append(q.resolved[:i], q.resolved[i+1:]...)
+			break
+		}
+	}
+	delete(q.cases, id)
+}
+
+func (q *Queue) tally(tenant string) *tally {
+	if q.tallies[tenant] == nil {
+		q.tallies[tenant] = &tally{}
+	}
+	return q.tallies[tenant]
+}
+
+func snapshot(c *Case, now time.Time) Case {
+	snapshot := *c
+	snapshot.TimeInQueue = c.waited(now).Seconds()
+	return snapshot
+}
@@ -0,0 +1,175 @@
+package review_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+func policies(tenant string) review.Policy {
+	switch tenant {
+	case "acme":
+		return review.Policy{ResolveWithin: "2h", OnExpiry: review.ActionDecline}
+	case "globex":
+		return review.Policy{ResolveWithin: "30m"}
+	}
+	return review.Policy{}
+}
+
+type observer struct {
+	resolved []string
+	breaches []string
+}
+
+func (o *observer) ObserveReviewResolved(tenant, resolution, resolvedBy string, waited time.Duration) {
+	o.resolved = append(o.resolved, tenant+"/"+resolution+"/"+resolvedBy)
+}
+
+func (o *observer) ObserveReviewBreach(tenant, action string) {
+	o.breaches = append(o.breaches, tenant+"/"+action)
+}
+
+func TestQueue_ResolvesWithinSLA(t *testing.T) {
+	queue := review.NewQueue(policies, 0)
+	o := &observer{}
+	queue.SetObserver(o)
+
+	enqueued := queue.Enqueue(review.Case{TransactionID: "TX-1", Tenant: "acme", EnqueuedAt: start})
+	assert.Equal(t, review.StatusOpen, enqueued.Status)
+	require.NotNil(t, enqueued.DueAt)
+	assert.Equal(t, start.Add(2*time.Hour), *enqueued.DueAt)
+	assert.Equal(t, review.ActionDecline, enqueued.OnExpiry)
+
+	_, err := queue.Resolve("TX-1", "REVIEW", "alice", "", start)
+	assert.ErrorIs(t, err, review.ErrInvalidDecision)
+	_, err = queue.Resolve("missing", "APPROVE", "alice", "", start)
+	assert.ErrorIs(t, err, review.ErrNotFound)
+
+	resolved, err := queue.Resolve("TX-1", "APPROVE", "alice", "customer confirmed", start.Add(45*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, review.StatusResolved, resolved.Status)
+	assert.Equal(t, "alice", resolved.ResolvedBy)
+	assert.False(t, resolved.Breached)
+	assert.Equal(t, (45 * time.Minute).Seconds(), resolved.TimeInQueue)
+
+	_, err = queue.Resolve("TX-1", "DECLINE", "bob", "", start.Add(time.Hour))
+	assert.ErrorIs(t, err, review.ErrResolved)
+	assert.Empty(t, queue.Expire(start.Add(3*time.Hour)), "resolved cases do not expire")
+	assert.Equal(t, []string{"acme/APPROVE/analyst"}, o.resolved)
+	assert.Empty(t, o.breaches)
+}
+
+func TestQueue_ExpiresBySLAAction(t *testing.T) {
+	queue := review.NewQueue(policies, 0)
+	o := &observer{}
+	queue.SetObserver(o)
+	queue.Enqueue(review.Case{TransactionID: "TX-1", Tenant: "acme", EnqueuedAt: start})
+	queue.Enqueue(review.Case{TransactionID: "TX-2", Tenant: "globex", EnqueuedAt: start})
+	queue.Enqueue(review.Case{TransactionID: "TX-3", Tenant: "initech", EnqueuedAt: start})
+
+	assert.Empty(t, queue.Expire(start.Add(29*time.Minute)))
+	expired := queue.Expire(start.Add(3 * time.Hour))
+	require.Len(t, expired, 2, "cases without an SLA never expire")
+
+	assert.Equal(t, "TX-2", expired[0].TransactionID)
+	assert.Equal(t, review.StatusEscalated, expired[0].Status, "escalation is the default action")
+	require.NotNil(t, expired[0].EscalatedAt)
+	assert.Equal(t, start.Add(30*time.Minute), *expired[0].EscalatedAt)
+
+	assert.Equal(t, "TX-1", expired[1].TransactionID)
+	assert.Equal(t, review.StatusResolved, expired[1].Status)
+	assert.Equal(t, "DECLINE", expired[1].Resolution)
+	assert.Equal(t, review.ResolvedBySLA, expired[1].ResolvedBy)
+	assert.True(t, expired[1].Breached)
+
+	assert.Empty(t, queue.Expire(start.Add(4*time.Hour)), "a case breaches once")
+	escalated, err := queue.Resolve("TX-2", "APPROVE", "bob", "", start.Add(4*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, escalated.Breached)
+
+	assert.Equal(t, []string{"acme/decline", "globex/escalate"}, sorted(o.breaches))
+	assert.Equal(t, []string{"acme/DECLINE/sla", "globex/APPROVE/analyst"}, sorted(o.resolved))
+	assert.Equal(t, []string{"TX-3"}, ids(queue.List(review.StatusOpen, "", start)))
+}
+
+func TestQueue_SummarizesByTenant(t *testing.T) {
+	queue := review.NewQueue(policies, 0)
+	queue.Enqueue(review.Case{TransactionID: "TX-1", Tenant: "acme", EnqueuedAt: start})
+	queue.Enqueue(review.Case{TransactionID: "TX-2", Tenant: "acme", EnqueuedAt: start.Add(time.Hour)})
+	queue.Enqueue(review.Case{TransactionID: "TX-3", Tenant: "globex", EnqueuedAt: start})
+	_, err := queue.Resolve("TX-2", "APPROVE", "alice", "", start.Add(90*time.Minute))
+	require.NoError(t, err)
+	queue.Expire(start.Add(time.Hour))
+
+	summaries := queue.Summary([]string{"acme", "globex", "initech"}, start.Add(time.Hour))
+	require.Len(t, summaries, 3)
+	acme, globex, initech := summaries[0], summaries[1], summaries[2]
+
+	assert.Equal(t, "acme", acme.Tenant)
+	require.NotNil(t, acme.Policy)
+	assert.Equal(t, 1, acme.Open)
+	assert.Zero(t, acme.Overdue)
+	assert.Equal(t, time.Hour.Seconds(), acme.OldestWait)
+	assert.Equal(t, 1, acme.Resolved)
+	assert.Equal(t, 1, acme.ResolvedWithinSLA)
+	assert.Equal(t, (30 * time.Minute).Seconds(), acme.MeanTimeToResolve)
+
+	assert.Equal(t, 1, globex.Open)
+	assert.Equal(t, 1, globex.Escalated)
+	assert.Equal(t, 1, globex.Overdue)
+	assert.Equal(t, 1, globex.Breaches)
+
+	assert.Equal(t, "initech", initech.Tenant)
+	assert.Nil(t, initech.Policy)
+	assert.Zero(t, initech.Open)
+}
+
+func TestQueue_ListsAndRetains(t *testing.T) {
+	queue := review.NewQueue(policies, 1)
+	queue.Enqueue(review.Case{TransactionID: "TX-2", Tenant: "acme", EnqueuedAt: start.Add(time.Minute)})
+	queue.Enqueue(review.Case{TransactionID: "TX-1", Tenant: "globex", EnqueuedAt: start})
+	queue.Enqueue(review.Case{TransactionID: "TX-3", Tenant: "acme", EnqueuedAt: start.Add(2 * time.Minute)})
+
+	assert.Equal(t, []string{"TX-1", "TX-2", "TX-3"}, ids(queue.List("", "", start)), "oldest first")
+	assert.Equal(t, []string{"TX-2", "TX-3"}, ids(queue.List("", "acme", start)))
+
+	for _, id := range []string{"TX-2", "TX-3"} {
+		_, err := queue.Resolve(id, "DECLINE", "alice", "", start.Add(time.Hour))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"TX-3"}, ids(queue.List(review.StatusResolved, "", start)), "the oldest resolved case is dropped")
+	_, exists := queue.Get("TX-2", start)
+	assert.False(t, exists)
+
+	requeued := queue.Enqueue(review.Case{TransactionID: "TX-3", Tenant: "acme", EnqueuedAt: start.Add(2 * time.Hour)})
+	assert.Equal(t, review.StatusOpen, requeued.Status)
+	assert.Empty(t, requeued.Resolution)
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	assert.NoError(t, review.Policy{}.Validate())
+	assert.NoError(t, review.Policy{ResolveWithin: "2h", OnExpiry: review.ActionApprove}.Validate())
+	assert.Error(t, review.Policy{ResolveWithin: "-1h"}.Validate())
+	assert.Error(t, review.Policy{ResolveWithin: "2 hours"}.Validate())
+	assert.Error(t, review.Policy{ResolveWithin: "2h", OnExpiry: "ignore"}.Validate())
+}
+
+func ids(cases []review.Case) []string {
+	ids := []string{}
+	for _, c := range cases {
+		ids = append(ids, c.TransactionID)
+	}
+	return ids
+}
+
+func sorted(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,262 @@
+package review
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/decision"
+)
+
+// maxLinks caps the linked decisions kept per case, so a busy IP address
+// does not grow a case without bound
+const maxLinks = 1000
+
+// Link is another decision sharing an account, device or IP address with a
+// case
+type Link struct {
+	TransactionID string
+	Decision      string
+}
+
+// Evidence is what is known of a case beyond its own decision: the linked
+// decisions and the feedback labels on them and on the case
+type Evidence struct {
+	// Linked counts the decisions sharing an entity with the case and
+	// LinkedDeclines those of them declined
+	Linked         int `json:"linked"`
+	LinkedDeclines int `json:"linked_declines"`
+	// LinkedFraud and LinkedLegitimate count the linked transactions labeled
+	// through feedback
+	LinkedFraud      int `json:"linked_fraud"`
+	LinkedLegitimate int `json:"linked_legitimate"`
+	// Fraud is the label of the case's own transaction, nil until labeled
+	Fraud *bool `json:"fraud,omitempty"`
+}
+
+// Triager is the secondary model ranking review cases: it estimates the
+// probability that a case is fraud from its decision and evidence
+type Triager interface {
+	FraudProbability(c Case) float64
+}
+
+// TriageModel is a logistic model of the probability that a review case is
+// fraud. Each weight multiplies its feature; counts of linked decisions are
+// capped at 10.
+type TriageModel struct {
+	Bias             float64 `json:"bias"`
+	RiskScore        float64 `json:"risk_score"`
+	ReasonCodes      float64 `json:"reason_codes"`
+	Linked           float64 `json:"linked"`
+	LinkedDeclines   float64 `json:"linked_declines"`
+	LinkedFraud      float64 `json:"linked_fraud"`
+	LinkedLegitimate float64 `json:"linked_legitimate"`
+}
+
+// DefaultTriageModel returns weights putting a case at the middle of the
+// review band near even odds, raised by declined and fraudulent links
+func DefaultTriageModel() TriageModel {
+	return TriageModel{
+		Bias:             -4,
+		RiskScore:        6,
+		ReasonCodes:      0.15,
+		Linked:           0.05,
+		LinkedDeclines:   0.6,
+		LinkedFraud:      1.5,
+		LinkedLegitimate: -0.8,
+	}
+}
+
+// Validate checks the weights are numbers
+func (m TriageModel) Validate() error {
+	for name, weight := range map[string]float64{
+		"bias":              m.Bias,
+		"risk_score":        m.RiskScore,
+		"reason_codes":      m.ReasonCodes,
+		"linked":            m.Linked,
+		"linked_declines":   m.LinkedDeclines,
+		"linked_fraud":      m.LinkedFraud,
+		"linked_legitimate": m.LinkedLegitimate,
+	} {
+		if math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fmt.Errorf("triage weight %s must be a number", name)
+		}
+	}
+	return nil
+}
+
+func (m TriageModel) FraudProbability(c Case) float64 {
+	count := func(n int) float64 { return float64(min(n, 10)) }
+	z := m.Bias +
+		m.RiskScore*c.RiskScore +
+		m.ReasonCodes*count(len(c.ReasonCodes)) +
+		m.Linked*count(c.Evidence.Linked) +
+		m.LinkedDeclines*count(c.Evidence.LinkedDeclines) +
+		m.LinkedFraud*count(c.Evidence.LinkedFraud) +
+		m.LinkedLegitimate*count(c.Evidence.LinkedLegitimate)
+	return 1 / (1 + math.Exp(-z))
+}
+
+// linkState is a linked decision and its feedback label, nil until labeled
+type linkState struct {
+	decision string
+	fraud    *bool
+}
+
+// SetTriager sets the model ranking the cases enqueued from now on
+func (q *Queue) SetTriager(triager Triager) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.triager = triager
+}
+
+// Observe links a decision to the waiting cases sharing one of its
+// entities and ranks them again, returning them as changed
+func (q *Queue) Observe(entities []string, link Link, at time.Time) []Case {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	linked := make(map[string]bool)
+	for _, entity := range entities {
+		for id := range q.entities[entity] {
+			if id != link.TransactionID {
+				linked[id] = true
+			}
+		}
+	}
+	var changed []Case
+	for id := range linked {
+		c := q.cases[id]
+		if !q.link(id, link) {
+			continue
+		}
+		q.triage(c, at)
+		changed = append(changed, snapshot(c, at))
+	}
+	sortByImpact(changed)
+	return changed
+}
+
+// Label records the feedback label of a transaction on its own waiting case
+// and on the waiting cases it is linked to, ranking them again and returning
+// them as changed
+func (q *Queue) Label(transactionID string, fraud bool, at time.Time) []Case {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var changed []Case
+	if c, exists := q.cases[transactionID]; exists && c.Status != StatusResolved {
+		c.Evidence.Fraud = &fraud
+		q.triage(c, at)
+		changed = append(changed, snapshot(c, at))
+	}
+	for id, links := range q.links {
+		if l, linked := links[transactionID]; linked {
+			l.fraud = &fraud
+			c := q.cases[id]
+			q.triage(c, at)
+			changed = append(changed, snapshot(c, at))
+		}
+	}
+	sortByImpact(changed)
+	return changed
+}
+
+// Ranked returns the cases like List, ordered by triage score, highest
+// first, and oldest first among equal scores
+func (q *Queue) Ranked(status, tenant string, now time.Time) []Case {
+	cases := q.List(status, tenant, now)
+	sortByImpact(cases)
+	return cases
+}
+
+// sortByImpact orders cases by triage score, highest first, keeping the
+// order of equal ones
+func sortByImpact(cases []Case) {
+	sort.SliceStable(cases, func(i, j int) bool {
+		return cases[i].TriageScore > cases[j].TriageScore
+	})
+}
+
+// index links the entities of a waiting case to it. Callers must hold the
+// lock.
+func (q *Queue) index(c *Case, links []Link) {
+	for _, entity := range c.Entities {
+		if q.entities[entity] == nil {
+			q.entities[entity] = make(map[string]bool)
+		}
+		q.entities[entity][c.TransactionID] = true
+	}
+	for _, link := range links {
+		if link.TransactionID != c.TransactionID {
+			q.link(c.TransactionID, link)
+		}
+	}
+}
+
+// unindex drops the entities and links of a case. Callers must hold the
+// lock.
+func (q *Queue) unindex(c *Case) {
+	for _, entity := range c.Entities {
+		delete(q.entities[entity], c.TransactionID)
+		if len(q.entities[entity]) == 0 {
+			delete(q.entities, entity)
+		}
+	}
+	delete(q.links, c.TransactionID)
+}
+
+// link records a linked decision of a case, reporting whether it was new or
+// changed. Callers must hold the lock.
+func (q *Queue) link(id string, link Link) bool {
+	links := q.links[id]
+	if links == nil {
+		links = make(map[string]*linkState)
+		q.links[id] = links
+	}
+	if l, exists := links[link.TransactionID]; exists {
+		if l.decision == link.Decision {
+			return false
+		}
+		l.decision = link.Decision
+		return true
+	}
+	if len(links) >= maxLinks {
+		return false
+	}
+	links[link.TransactionID] = &linkState{decision: link.Decision}
+	return true
+}
+
+// triage counts the evidence of a case and scores it. A labeled case is
+// fraud or not for certain; the triage score is the expected loss, the fraud
+// probability times the amount. Callers must hold the lock.
+func (q *Queue) triage(c *Case, at time.Time) {
+	evidence := Evidence{Fraud: c.Evidence.Fraud}
+	for _, l := range q.links[c.TransactionID] {
+		evidence.Linked++
+		if l.decision == decision.Decline {
+			evidence.LinkedDeclines++
+		}
+		switch {
+		case l.fraud == nil:
+		case *l.fraud:
+			evidence.LinkedFraud++
+		default:
+			evidence.LinkedLegitimate++
+		}
+	}
+	c.Evidence = evidence
+
+	switch {
+	case evidence.Fraud == nil:
+		c.FraudProbability = q.triager.FraudProbability(*c)
+	case *evidence.Fraud:
+		c.FraudProbability = 1
+	default:
+		c.FraudProbability = 0
+	}
+	c.TriageScore = c.FraudProbability * c.Amount
+	c.TriagedAt = &at
+}
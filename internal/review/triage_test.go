@@ -0,0 +1,71 @@
+package review_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/review"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue_RanksByExpectedLoss(t *testing.T) {
+	queue := review.NewQueue(policies, 0)
+	queue.Enqueue(review.Case{TransactionID: "TX-1", RiskScore: 0.6, Amount: 50, EnqueuedAt: start})
+	queue.Enqueue(review.Case{TransactionID: "TX-2", RiskScore: 0.6, Amount: 5000, EnqueuedAt: start.Add(time.Minute)})
+	queue.Enqueue(review.Case{TransactionID: "TX-3", RiskScore: 0.9, Amount: 50, EnqueuedAt: start.Add(2 * time.Minute)})
+
+	ranked := queue.Ranked(review.StatusOpen, "", start)
+	assert.Equal(t, []string{"TX-2", "TX-3", "TX-1"}, ids(ranked), "a likely small loss ranks below an even bet on a large one")
+	assert.InDelta(t, ranked[0].FraudProbability*5000, ranked[0].TriageScore, 1e-9)
+	require.NotNil(t, ranked[0].TriagedAt)
+	assert.Equal(t, start.Add(time.Minute), *ranked[0].TriagedAt)
+	assert.Equal(t, []string{"TX-1", "TX-2", "TX-3"}, ids(queue.List("", "", start)), "listing stays oldest first")
+}
+
+func TestQueue_TriagesAgainOnEvidence(t *testing.T) {
+	queue := review.NewQueue(policies, 0)
+	enqueued := queue.Enqueue(review.Case{
+		TransactionID: "TX-1",
+		RiskScore:     0.6,
+		Amount:        100,
+		Entities:      []string{"account:ACC-1", "device:DEV-1"},
+		EnqueuedAt:    start,
+	}, review.Link{TransactionID: "TX-0", Decision: "APPROVE"})
+	queue.Enqueue(review.Case{TransactionID: "TX-2", RiskScore: 0.6, Amount: 100, Entities: []string{"account:ACC-2"}, EnqueuedAt: start})
+	assert.Equal(t, 1, enqueued.Evidence.Linked)
+
+	at := start.Add(time.Minute)
+	changed := queue.Observe([]string{"account:ACC-1", "device:DEV-1"}, review.Link{TransactionID: "TX-5", Decision: "DECLINE"}, at)
+	require.Len(t, changed, 1, "only the case sharing an entity is linked")
+	assert.Equal(t, "TX-1", changed[0].TransactionID)
+	assert.Equal(t, review.Evidence{Linked: 2, LinkedDeclines: 1}, changed[0].Evidence)
+	assert.Greater(t, changed[0].FraudProbability, enqueued.FraudProbability)
+	assert.Equal(t, at, *changed[0].TriagedAt)
+	assert.Empty(t, queue.Observe([]string{"device:DEV-1"}, review.Link{TransactionID: "TX-5", Decision: "DECLINE"}, at), "a decision links once")
+
+	declined := changed[0].FraudProbability
+	changed = queue.Label("TX-5", false, at)
+	require.Len(t, changed, 1)
+	assert.Equal(t, 1, changed[0].Evidence.LinkedLegitimate)
+	assert.Less(t, changed[0].FraudProbability, declined)
+
+	changed = queue.Label("TX-2", true, at)
+	require.Len(t, changed, 1)
+	assert.Equal(t, 1.0, changed[0].FraudProbability, "a label on the case settles it")
+	assert.Equal(t, 100.0, changed[0].TriageScore)
+	assert.Equal(t, []string{"TX-2", "TX-1"}, ids(queue.Ranked("", "", at)))
+
+	_, err := queue.Resolve("TX-1", "DECLINE", "alice", "", at)
+	require.NoError(t, err)
+	assert.Empty(t, queue.Observe([]string{"account:ACC-1"}, review.Link{TransactionID: "TX-6"}, at), "resolved cases are not triaged")
+	assert.Empty(t, queue.Label("TX-0", true, at))
+}
+
+func TestTriageModel_Validate(t *testing.T) {
+	assert.NoError(t, review.DefaultTriageModel().Validate())
+	model := review.DefaultTriageModel()
+	model.LinkedFraud = math.Inf(1)
+	assert.Error(t, model.Validate())
+}
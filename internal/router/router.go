@@ -0,0 +1,219 @@
+// Package router routes API requests by method and path pattern, such as
+// GET /fraud/customers/{id}, through a chain of shared middleware. Requests
+// matching no route get JSON errors like every other API error.
+package router
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+)
+
+// Middleware wraps the handling of every request
+type Middleware func(next http.Handler) http.Handler
+
+// Route is a registered method and path pattern
+type Route struct {
+	Method  string
+	Pattern string
+}
+
+// Router dispatches requests to the handler of the route they match. Path
+// parameters are read with r.PathValue.
+type Router struct {
+	mux        *http.ServeMux
+	middleware []Middleware
+	routes     []Route
+}
+
+func New() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Use appends middleware to the chain. The first middleware added sees
+// requests first.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Handle registers the handler of a method and path pattern. A pattern
+// ending in "/" matches every path below it.
+func (r *Router) Handle(method, pattern string, handler http.Handler) {
+	route := Route{Method: method, Pattern: pattern}
+	r.routes = append(r.routes, route)
+	r.mux.Handle(method+" "+pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if matched, ok := req.Context().Value(routeKey{}).(*Route); ok {
+			*matched = route
+		}
+		handler.ServeHTTP(w, req)
+	}))
+}
+
+// HandleFunc registers a handler function of a method and path pattern
+func (r *Router) HandleFunc(method, pattern string, handler http.HandlerFunc) {
+	r.Handle(method, pattern, handler)
+}
+
+// Routes returns the registered routes, in registration order
+func (r *Router) Routes() []Route {
+	return append([]Route(nil), r.routes...)
+}
+
+type routeKey struct{}
+
+// Matched returns the route a request matched once the router has routed
+// it, so that middleware can label requests by route after calling the
+// next handler. Requests matching no route have none.
+func Matched(req *http.Request) (Route, bool) {
+	matched, ok := req.Context().Value(routeKey{}).(*Route)
+	if !ok || matched.Pattern == "" {
+		return Route{}, false
+	}
+	return *matched, true
+}
+
+// ServeHTTP passes a request through the middleware chain to its route
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req = req.WithContext(context.WithValue(req.Context(), routeKey{}, &Route{}))
+
+	var handler http.Handler = http.HandlerFunc(r.dispatch)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	handler.ServeHTTP(w, req)
+}
+
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	handler, pattern := r.mux.Handler(req)
+	if pattern != "" {
+		r.mux.ServeHTTP(w, req)
+		return
+	}
+
+	// The mux answers unknown paths with a 404, unrouted methods with a
+	// 405 and unclean paths with a redirect, in plain text
+	probe := &statusWriter{ResponseWriter: discard{header: make(http.Header)}}
+	handler.ServeHTTP(probe, req)
+	switch probe.Status() {
+	case http.StatusNotFound:
+		apierror.Write(w, "not found: "+req.URL.Path, http.StatusNotFound)
+	case http.StatusMethodNotAllowed:
+		w.Header().Set("Allow", probe.Header().Get("Allow"))
+		apierror.Write(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		r.mux.ServeHTTP(w, req)
+	}
+}
+
+// Logging logs the method, path, route, status and duration of every
+// request
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+
+		route, _ := Matched(req)
+		log.Printf("%s %s %d %s (route %s)", req.Method, req.URL.Path, sw.Status(), time.Since(start), route.Pattern)
+	})
+}
+
+// Recover turns a panicking handler into a 500 INTERNAL error, logging the
+// panic and its stack but never sending either to the caller. Responses
+// already started are cut short instead.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			log.Printf("Panic serving %s %s: %v\n%s", req.Method, req.URL.Path, recovered, debug.Stack())
+			if sw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			apierror.Write(w, "internal error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(sw, req)
+	})
+}
+
+// Observer is notified of every request with the pattern of its route, or
+// "unmatched", its response status and how long it took
+type Observer interface {
+	ObserveRequest(method, route string, status int, elapsed time.Duration)
+}
+
+// Metrics reports every request to an observer
+func Metrics(observer Observer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, req)
+
+			pattern := "unmatched"
+			if route, ok := Matched(req); ok {
+				pattern = route.Pattern
+			}
+			observer.ObserveRequest(req.Method, pattern, sw.Status(), time.Since(start))
+		})
+	}
+}
+
+// statusWriter captures the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Status returns the status written, 200 when the handler wrote none
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Flush keeps streaming endpoints working behind the middleware
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// discard is a ResponseWriter dropping everything but headers
+type discard struct {
+	header http.Header
+}
+
+func (d discard) Header() http.Header         { return d.header }
+func (d discard) Write(p []byte) (int, error) { return len(p), nil }
+func (d discard) WriteHeader(int)             {}
@@ -0,0 +1,155 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/apierror"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRouter() *router.Router {
+	r := router.New()
+	r.HandleFunc(http.MethodGet, "/customers/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.PathValue("id")))
+	})
+	r.HandleFunc(http.MethodPost, "/customers/{id}/labels", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	return r
+}
+
+func TestRouter_PathValues(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/customers/c42", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "c42", rec.Body.String())
+}
+
+func TestRouter_Unmatched(t *testing.T) {
+	r := newRouter()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var failure apierror.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failure), "404s are JSON errors")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/customers/c42", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Contains(t, rec.Header().Get("Allow"), http.MethodGet)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failure), "405s are JSON errors")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/customers/c42/labels", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
+
+func TestRouter_MiddlewareOrder(t *testing.T) {
+	r := newRouter()
+	var order []string
+	for _, name := range []string{"first", "second"} {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, req)
+			})
+		})
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/customers/c42", nil))
+
+	assert.Equal(t, []string{"first", "second"}, order)
+}
+
+type observation struct {
+	method, route string
+	status        int
+}
+
+type recordingObserver struct {
+	observed []observation
+}
+
+func (o *recordingObserver) ObserveRequest(method, route string, status int, _ time.Duration) {
+	o.observed = append(o.observed, observation{method, route, status})
+}
+
+func TestMetrics(t *testing.T) {
+	r := newRouter()
+	observer := &recordingObserver{}
+	r.Use(router.Metrics(observer))
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/customers/c42", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/customers/c42/labels", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	assert.Equal(t, []observation{
+		{http.MethodGet, "/customers/{id}", http.StatusOK},
+		{http.MethodPost, "/customers/{id}/labels", http.StatusCreated},
+		{http.MethodGet, "unmatched", http.StatusNotFound},
+	}, observer.observed, "requests are labeled by route pattern, not path")
+}
+
+func TestMetrics_Flush(t *testing.T) {
+	r := router.New()
+	r.Use(router.Metrics(&recordingObserver{}), router.Logging)
+	r.HandleFunc(http.MethodGet, "/events", func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok, "streaming handlers can flush behind the middleware")
+		w.Write([]byte("data: {}\n\n"))
+		flusher.Flush()
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	assert.True(t, rec.Flushed)
+}
+
+func TestRouter_Routes(t *testing.T) {
+	assert.Equal(t, []router.Route{
+		{Method: http.MethodGet, Pattern: "/customers/{id}"},
+		{Method: http.MethodPost, Pattern: "/customers/{id}/labels"},
+	}, newRouter().Routes())
+}
+
+func TestRecover(t *testing.T) {
+	r := router.New()
+	observer := &recordingObserver{}
+	r.Use(router.Metrics(observer), router.Recover)
+	r.HandleFunc(http.MethodGet, "/panic", func(w http.ResponseWriter, req *http.Request) {
+		panic("secret: database password")
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	var failure apierror.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failure))
+	assert.Equal(t, apierror.Internal, failure.Error.Code)
+	assert.NotContains(t, rec.Body.String(), "secret", "the panic value is only logged")
+	assert.Equal(t, []observation{{http.MethodGet, "/panic", http.StatusInternalServerError}}, observer.observed)
+}
+
+func TestRecover_AfterResponseStarted(t *testing.T) {
+	r := router.New()
+	r.Use(router.Recover)
+	r.HandleFunc(http.MethodGet, "/panic", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("partial"))
+		panic("mid-response")
+	})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	}, "the server aborts the response rather than appending an error to it")
+}
@@ -0,0 +1,174 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Statuses of a proposed rule change
+const (
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalRejected = "rejected"
+)
+
+// Errors returned when reviewing a proposal
+var (
+	ErrProposalNotFound = errors.New("rule change not found")
+	ErrNotPending       = errors.New("rule change was already reviewed")
+	ErrSelfReview       = errors.New("rule changes must be reviewed by someone other than their author")
+)
+
+// Proposal is a rule change waiting for, or given, sign-off. It holds the
+// change rather than the resulting rule set, so changes approved in between
+// are kept.
+type Proposal struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Source is the operation that submitted the change: api, import or
+	// rollback
+	Source string `json:"source"`
+	Author string `json:"author"`
+	Tenant string `json:"tenant,omitempty"`
+	// Approver is the role that must sign the change off
+	Approver string `json:"approver"`
+	// Set adds expression rules, replacing those of the same ID
+	Set []Spec `json:"set,omitempty"`
+	// Delete removes expression rules by ID
+	Delete []string `json:"delete,omitempty"`
+	// Replace removes every expression rule Set does not list, as imports do
+	Replace bool `json:"replace,omitempty"`
+	// Diff is the change against the rules active when it was submitted
+	Diff        Diff       `json:"diff"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	ReviewedBy  string     `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	Comment     string     `json:"comment,omitempty"`
+}
+
+// Apply returns the rule set with the change made. Built-in rules are kept
+// as they are.
+func (p Proposal) Apply(current File) File {
+	deleted := make(map[string]bool)
+	for _, id := range p.Delete {
+		deleted[id] = true
+	}
+	set := make(map[string]bool)
+	for _, spec := range p.Set {
+		set[spec.ID] = true
+	}
+
+	file := File{Version: Version}
+	for _, spec := range current.Rules {
+		if spec.Builtin || !(p.Replace || deleted[spec.ID] || set[spec.ID]) {
+			file.Rules = append(file.Rules, spec)
+		}
+	}
+	file.Rules = append(file.Rules, p.Set...)
+	return file
+}
+
+// Approvals holds the proposed rule changes
+type Approvals struct {
+	proposals map[string]*Proposal
+	next      int
+	mu        sync.RWMutex
+}
+
+func NewApprovals() *Approvals {
+	return &Approvals{proposals: make(map[string]*Proposal)}
+}
+
+// Submit records a pending proposal, assigning its ID
+func (a *Approvals) Submit(proposal Proposal) Proposal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.next++
+	proposal.ID = fmt.Sprintf("change-%d", a.next)
+	proposal.Status = ProposalPending
+	a.proposals[proposal.ID] = &proposal
+	return proposal
+}
+
+// Get returns a proposal
+func (a *Approvals) Get(id string) (Proposal, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	proposal, exists := a.proposals[id]
+	if !exists {
+		return Proposal{}, false
+	}
+	return *proposal, true
+}
+
+// List returns the proposals with a status, or every proposal when it is
+// empty, newest first
+func (a *Approvals) List(status string) []Proposal {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	proposals := []Proposal{}
+	for _, proposal := range a.proposals {
+		if status == "" || proposal.Status == status {
+			proposals = append(proposals, *proposal)
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if !proposals[i].SubmittedAt.Equal(proposals[j].SubmittedAt) {
+			return proposals[i].SubmittedAt.After(proposals[j].SubmittedAt)
+		}
+		return proposals[i].ID > proposals[j].ID
+	})
+	return proposals
+}
+
+// Check returns the pending proposal a reviewer may sign off
+func (a *Approvals) Check(id, reviewer string) (Proposal, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	proposal, err := a.reviewable(id, reviewer)
+	if err != nil {
+		return Proposal{}, err
+	}
+	return *proposal, nil
+}
+
+// Review approves or rejects a pending proposal
+func (a *Approvals) Review(id, reviewer string, approve bool, comment string, at time.Time) (Proposal, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	proposal, err := a.reviewable(id, reviewer)
+	if err != nil {
+		return Proposal{}, err
+	}
+	proposal.Status = ProposalRejected
+	if approve {
+		proposal.Status = ProposalApproved
+	}
+	proposal.ReviewedBy = reviewer
+	proposal.ReviewedAt = &at
+	proposal.Comment = comment
+	return *proposal, nil
+}
+
+// reviewable returns a pending proposal not authored by the reviewer.
+// Callers must hold the lock.
+func (a *Approvals) reviewable(id, reviewer string) (*Proposal, error) {
+	proposal, exists := a.proposals[id]
+	switch {
+	case !exists:
+		return nil, ErrProposalNotFound
+	case proposal.Status != ProposalPending:
+		return nil, ErrNotPending
+	case proposal.Author == reviewer:
+		return nil, ErrSelfReview
+	}
+	return proposal, nil
+}
@@ -0,0 +1,74 @@
+package ruleset_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+func TestProposal_Apply(t *testing.T) {
+	current := ruleset.File{Version: ruleset.Version, Rules: []ruleset.Spec{
+		{ID: "HIGH_AMOUNT", Builtin: true, Score: 0.3},
+		{ID: "BIG", Expression: "tx.amount > 500", Score: 0.2},
+		{ID: "NIGHT", Expression: "tx.hour < 6", Score: 0.1},
+	}}
+	ids := func(file ruleset.File) []string {
+		var ids []string
+		for _, spec := range file.Rules {
+			ids = append(ids, spec.ID)
+		}
+		return ids
+	}
+
+	changed := ruleset.Proposal{Set: []ruleset.Spec{{ID: "BIG", Expression: "tx.amount > 900", Score: 0.2}}}.Apply(current)
+	assert.Equal(t, []string{"HIGH_AMOUNT", "NIGHT", "BIG"}, ids(changed))
+	assert.Equal(t, "tx.amount > 900", changed.Rules[2].Expression)
+
+	assert.Equal(t, []string{"HIGH_AMOUNT", "BIG"}, ids(ruleset.Proposal{Delete: []string{"NIGHT"}}.Apply(current)))
+
+	imported := ruleset.Proposal{Replace: true, Set: []ruleset.Spec{{ID: "NEW", Expression: "tx.amount > 1", Score: 0.1}}}.Apply(current)
+	assert.Equal(t, []string{"HIGH_AMOUNT", "NEW"}, ids(imported), "built-in rules are kept")
+}
+
+func TestApprovals_Review(t *testing.T) {
+	approvals := ruleset.NewApprovals()
+	start := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	first := approvals.Submit(ruleset.Proposal{Source: "api", Author: "alice", SubmittedAt: start})
+	second := approvals.Submit(ruleset.Proposal{Source: "import", Author: "bob", SubmittedAt: start.Add(time.Minute)})
+	assert.Equal(t, ruleset.ProposalPending, first.Status)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	_, err := approvals.Check(first.ID, "alice")
+	assert.ErrorIs(t, err, ruleset.ErrSelfReview)
+	_, err = approvals.Review("missing", "carol", true, "", start)
+	assert.ErrorIs(t, err, ruleset.ErrProposalNotFound)
+
+	reviewed, err := approvals.Review(first.ID, "carol", true, "looks good", start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, ruleset.ProposalApproved, reviewed.Status)
+	assert.Equal(t, "carol", reviewed.ReviewedBy)
+	require.NotNil(t, reviewed.ReviewedAt)
+	assert.Equal(t, start.Add(time.Hour), *reviewed.ReviewedAt)
+
+	_, err = approvals.Review(first.ID, "dave", false, "", start)
+	assert.ErrorIs(t, err, ruleset.ErrNotPending)
+
+	reviewed, err = approvals.Review(second.ID, "alice", false, "too broad", start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, ruleset.ProposalRejected, reviewed.Status)
+
+	all := approvals.List("")
+	require.Len(t, all, 2)
+	assert.Equal(t, second.ID, all[0].ID, "newest first")
+	assert.Empty(t, approvals.List(ruleset.ProposalPending))
+	require.Len(t, approvals.List(ruleset.ProposalApproved), 1)
+
+	proposal, exists := approvals.Get(second.ID)
+	require.True(t, exists)
+	assert.Equal(t, "too broad", proposal.Comment)
+}
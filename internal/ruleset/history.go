@@ -0,0 +1,149 @@
+package ruleset
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of rule changes
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// RuleVersion is a version of an expression rule: who changed it, when,
+// through which operation, and how it differs from the version before
+type RuleVersion struct {
+	RuleID  string `json:"rule_id"`
+	Version int    `json:"version"`
+	Change  string `json:"change"`
+	// Rule is the rule as of this version, nil once it was deleted
+	Rule      *Spec         `json:"rule,omitempty"`
+	Author    string        `json:"author"`
+	Source    string        `json:"source"`
+	ChangedAt time.Time     `json:"changed_at"`
+	Diff      []FieldChange `json:"diff"`
+}
+
+// FieldChange is a rule field that changed between two versions
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// History keeps every version of the expression rules. Built-in rules are
+// implemented in code and have no history.
+type History struct {
+	versions map[string][]RuleVersion
+	mu       sync.RWMutex
+}
+
+func NewHistory() *History {
+	return &History{versions: make(map[string][]RuleVersion)}
+}
+
+// Record compares the expression rules of a rule set with their latest
+// versions and records a new version of every rule created, changed or
+// deleted since. It returns the recorded versions, by rule ID.
+func (h *History) Record(current File, author, source string, at time.Time) []RuleVersion {
+	specs := expressionSpecs(current)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var recorded []RuleVersion
+	record := func(id, change string, previous, next *Spec) {
+		version := RuleVersion{
+			RuleID:    id,
+			Version:   len(h.versions[id]) + 1,
+			Change:    change,
+			Rule:      next,
+			Author:    author,
+			Source:    source,
+			ChangedAt: at,
+			Diff:      diffSpecs(previous, next),
+		}
+		h.versions[id] = append(h.versions[id], version)
+		recorded = append(recorded, version)
+	}
+
+	for id, spec := range specs {
+		spec := spec
+		latest := h.latest(id)
+		switch {
+		case latest == nil || latest.Rule == nil:
+			record(id, ChangeCreated, nil, &spec)
+		case *latest.Rule != spec:
+			record(id, ChangeUpdated, latest.Rule, &spec)
+		}
+	}
+	for id := range h.versions {
+		if _, exists := specs[id]; exists {
+			continue
+		}
+		if latest := h.latest(id); latest.Rule != nil {
+			record(id, ChangeDeleted, latest.Rule, nil)
+		}
+	}
+	sort.Slice(recorded, func(i, j int) bool { return recorded[i].RuleID < recorded[j].RuleID })
+	return recorded
+}
+
+// latest returns the latest version of a rule, or nil. Callers must hold the
+// lock.
+func (h *History) latest(id string) *RuleVersion {
+	versions := h.versions[id]
+	if len(versions) == 0 {
+		return nil
+	}
+	return &versions[len(versions)-1]
+}
+
+// Versions returns every version of a rule, oldest first
+func (h *History) Versions(ruleID string) ([]RuleVersion, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	versions, exists := h.versions[ruleID]
+	return append([]RuleVersion(nil), versions...), exists
+}
+
+// Version returns a version of a rule
+func (h *History) Version(ruleID string, version int) (RuleVersion, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	versions := h.versions[ruleID]
+	if version < 1 || version > len(versions) {
+		return RuleVersion{}, false
+	}
+	return versions[version-1], true
+}
+
+// diffSpecs lists the fields that differ between two versions of a rule,
+// either of which may be missing
+func diffSpecs(previous, next *Spec) []FieldChange {
+	var before, after Spec
+	if previous != nil {
+		before = *previous
+	}
+	if next != nil {
+		after = *next
+	}
+
+	changes := []FieldChange{}
+	add := func(field string, from, to interface{}, changed bool) {
+		if changed {
+			changes = append(changes, FieldChange{Field: field, From: from, To: to})
+		}
+	}
+	add("name", before.Name, after.Name, before.Name != after.Name)
+	add("description", before.Description, after.Description, before.Description != after.Description)
+	add("expression", before.Expression, after.Expression, before.Expression != after.Expression)
+	add("score", before.Score, after.Score, before.Score != after.Score)
+	add("action", before.Action, after.Action, before.Action != after.Action)
+	return changes
+}
@@ -0,0 +1,64 @@
+package ruleset_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+func TestHistory_Record(t *testing.T) {
+	history := ruleset.NewHistory()
+	start := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	file := func(specs ...ruleset.Spec) ruleset.File {
+		builtin := ruleset.Spec{ID: "HIGH_AMOUNT", Builtin: true, Score: 0.3}
+		return ruleset.File{Version: ruleset.Version, Rules: append([]ruleset.Spec{builtin}, specs...)}
+	}
+	big := ruleset.Spec{ID: "BIG", Description: "Big amount", Expression: "tx.amount > 500", Score: 0.2}
+
+	recorded := history.Record(file(big), "alice", "api", start)
+	require.Len(t, recorded, 1, "built-in rules have no history")
+	assert.Equal(t, ruleset.ChangeCreated, recorded[0].Change)
+	assert.Equal(t, 1, recorded[0].Version)
+
+	assert.Empty(t, history.Record(file(big), "bob", "import", start.Add(time.Minute)), "nothing changed")
+
+	changed := big
+	changed.Expression = "tx.amount > 900"
+	changed.Score = 0.3
+	recorded = history.Record(file(changed), "bob", "import", start.Add(time.Hour))
+	require.Len(t, recorded, 1)
+	assert.Equal(t, ruleset.ChangeUpdated, recorded[0].Change)
+	assert.Equal(t, []ruleset.FieldChange{
+		{Field: "expression", From: "tx.amount > 500", To: "tx.amount > 900"},
+		{Field: "score", From: 0.2, To: 0.3},
+	}, recorded[0].Diff)
+
+	recorded = history.Record(file(), "carol", "bundle", start.Add(2*time.Hour))
+	require.Len(t, recorded, 1)
+	assert.Equal(t, ruleset.ChangeDeleted, recorded[0].Change)
+	assert.Nil(t, recorded[0].Rule)
+
+	// A rule created again continues its history
+	recorded = history.Record(file(big), "alice", "rollback", start.Add(3*time.Hour))
+	require.Len(t, recorded, 1)
+	assert.Equal(t, ruleset.ChangeCreated, recorded[0].Change)
+
+	versions, exists := history.Versions("BIG")
+	require.True(t, exists)
+	require.Len(t, versions, 4)
+	assert.Equal(t, []string{"alice", "bob", "carol", "alice"},
+		[]string{versions[0].Author, versions[1].Author, versions[2].Author, versions[3].Author})
+
+	version, exists := history.Version("BIG", 2)
+	require.True(t, exists)
+	assert.Equal(t, "tx.amount > 900", version.Rule.Expression)
+	assert.Equal(t, start.Add(time.Hour), version.ChangedAt)
+	_, exists = history.Version("BIG", 5)
+	assert.False(t, exists)
+	_, exists = history.Versions("HIGH_AMOUNT")
+	assert.False(t, exists)
+}
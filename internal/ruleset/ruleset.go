@@ -0,0 +1,202 @@
+// Package ruleset reads and writes the full detection rule set as YAML, so
+// rules can be reviewed, versioned and moved between environments.
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// Version is the rule file format version
+const Version = 1
+
+// File is a rule set as exported and imported
+type File struct {
+	Version int    `yaml:"version" json:"version"`
+	Rules   []Spec `yaml:"rules" json:"rules"`
+}
+
+// Spec is a single rule. Built-in rules are implemented in code and listed
+// for reference: importing one only checks it exists.
+type Spec struct {
+	ID          string  `yaml:"id" json:"id"`
+	Name        string  `yaml:"name,omitempty" json:"name,omitempty"`
+	Description string  `yaml:"description,omitempty" json:"description,omitempty"`
+	Builtin     bool    `yaml:"builtin,omitempty" json:"builtin,omitempty"`
+	Expression  string  `yaml:"expression,omitempty" json:"expression,omitempty"`
+	Score       float64 `yaml:"score" json:"score"`
+	Action      string  `yaml:"action,omitempty" json:"action,omitempty"`
+}
+
+// FromRules builds a rule file from the active rules
+func FromRules(rules []detector.Rule) File {
+	file := File{Version: Version, Rules: make([]Spec, len(rules))}
+	for i, rule := range rules {
+		file.Rules[i] = Spec{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Description: rule.Description,
+			Builtin:     rule.Expression == "",
+			Expression:  rule.Expression,
+			Score:       rule.Score,
+			Action:      rule.Action,
+		}
+	}
+	return file
+}
+
+// Encode writes a rule file as YAML
+func Encode(w io.Writer, file File) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Decode reads and validates a YAML rule file. Unknown fields are rejected
+// so typos do not silently drop settings.
+func Decode(r io.Reader) (File, error) {
+	var file File
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return file, errors.New("empty rule file")
+		}
+		return file, fmt.Errorf("invalid rule file: %w", err)
+	}
+	return file, file.Validate()
+}
+
+// Validate checks the structure of a rule file. Expressions are compiled by
+// the detector on import.
+func (f File) Validate() error {
+	if f.Version != Version {
+		return fmt.Errorf("unsupported rule file version %d, want %d", f.Version, Version)
+	}
+	seen := make(map[string]bool, len(f.Rules))
+	for i, rule := range f.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule %d: id is required", i+1)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("rule %s: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+		if rule.Builtin {
+			if rule.Expression != "" {
+				return fmt.Errorf("rule %s: built-in rules have no expression", rule.ID)
+			}
+			continue
+		}
+		if rule.Expression == "" {
+			return fmt.Errorf("rule %s: expression is required", rule.ID)
+		}
+		if rule.Score <= 0 {
+			return fmt.Errorf("rule %s: score must be positive", rule.ID)
+		}
+	}
+	return nil
+}
+
+// ExpressionRules returns the file's expression rules as detector rules
+func (f File) ExpressionRules() []detector.Rule {
+	var rules []detector.Rule
+	for _, spec := range f.Rules {
+		if spec.Builtin {
+			continue
+		}
+		rule := detector.Rule{
+			ID:          spec.ID,
+			Name:        spec.Name,
+			Description: spec.Description,
+			Expression:  spec.Expression,
+			Score:       spec.Score,
+			Action:      spec.Action,
+		}
+		if rule.Description == "" {
+			rule.Description = "Rule " + rule.ID + " matched"
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// CheckBuiltins verifies that every built-in rule the file lists exists in
+// the current rule set
+func (f File) CheckBuiltins(current File) error {
+	builtins := make(map[string]bool)
+	for _, rule := range current.Rules {
+		if rule.Builtin {
+			builtins[rule.ID] = true
+		}
+	}
+	for _, rule := range f.Rules {
+		if rule.Builtin && !builtins[rule.ID] {
+			return fmt.Errorf("rule %s: unknown built-in rule", rule.ID)
+		}
+	}
+	return nil
+}
+
+// Diff lists the expression rules an import adds, removes and changes, by ID
+type Diff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// Empty reports whether the import would change nothing
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare diffs the expression rules of the current and proposed rule sets.
+// Built-in rules cannot be changed by an import and are not compared.
+func Compare(current, proposed File) Diff {
+	before := expressionSpecs(current)
+	after := expressionSpecs(proposed)
+
+	diff := Diff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for id, spec := range after {
+		old, exists := before[id]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, id)
+		case old != spec:
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range before {
+		if _, exists := after[id]; !exists {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+func expressionSpecs(f File) map[string]Spec {
+	specs := make(map[string]Spec)
+	for _, rule := range f.ExpressionRules() {
+		specs[rule.ID] = Spec{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Description: rule.Description,
+			Expression:  rule.Expression,
+			Score:       rule.Score,
+			Action:      rule.Action,
+		}
+	}
+	return specs
+}
@@ -0,0 +1,110 @@
+package ruleset_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/ruleset"
+)
+
+func TestRoundTrip(t *testing.T) {
+	fd := detector.NewFraudDetector()
+	require.NoError(t, fd.AddExpressionRule(detector.Rule{
+		ID:          "BIG_NIGHT",
+		Name:        "Big night transfer",
+		Description: "Large amount at night",
+		Expression:  "tx.amount > 5000 && hour_local(tx) < 6",
+		Score:       0.4,
+		Action:      "REVIEW",
+	}))
+
+	exported := ruleset.FromRules(fd.GetActiveRules())
+	var buf bytes.Buffer
+	require.NoError(t, ruleset.Encode(&buf, exported))
+	assert.Contains(t, buf.String(), "expression: tx.amount > 5000 && hour_local(tx) < 6")
+	assert.Contains(t, buf.String(), "builtin: true")
+
+	imported, err := ruleset.Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+	assert.True(t, ruleset.Compare(exported, imported).Empty())
+	assert.NoError(t, imported.CheckBuiltins(exported))
+	assert.NoError(t, fd.ReplaceExpressionRules(imported.ExpressionRules()))
+	assert.Len(t, fd.GetActiveRules(), len(exported.Rules))
+}
+
+func TestDecode_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"empty", "", "empty rule file"},
+		{"version", "version: 2\nrules: []\n", "unsupported rule file version"},
+		{"unknown field", "version: 1\nrules:\n  - id: A\n    expresion: tx.amount > 1\n", "field expresion not found"},
+		{"missing id", "version: 1\nrules:\n  - expression: tx.amount > 1\n    score: 0.1\n", "id is required"},
+		{"duplicate", "version: 1\nrules:\n  - {id: A, expression: tx.amount > 1, score: 0.1}\n  - {id: A, expression: tx.amount > 2, score: 0.1}\n", "duplicate id"},
+		{"missing expression", "version: 1\nrules:\n  - {id: A, score: 0.1}\n", "expression is required"},
+		{"score", "version: 1\nrules:\n  - {id: A, expression: tx.amount > 1}\n", "score must be positive"},
+		{"builtin expression", "version: 1\nrules:\n  - {id: A, builtin: true, expression: tx.amount > 1}\n", "built-in rules have no expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ruleset.Decode(strings.NewReader(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	current := ruleset.File{Version: 1, Rules: []ruleset.Spec{
+		{ID: "HIGH_AMOUNT", Builtin: true, Score: 0.3},
+		{ID: "KEEP", Expression: "tx.amount > 1", Score: 0.1},
+		{ID: "EDIT", Expression: "tx.amount > 2", Score: 0.1},
+		{ID: "DROP", Expression: "tx.amount > 3", Score: 0.1},
+	}}
+	proposed := ruleset.File{Version: 1, Rules: []ruleset.Spec{
+		{ID: "KEEP", Expression: "tx.amount > 1", Score: 0.1},
+		{ID: "EDIT", Expression: "tx.amount > 2", Score: 0.2},
+		{ID: "NEW", Expression: "tx.amount > 4", Score: 0.1},
+	}}
+
+	diff := ruleset.Compare(current, proposed)
+	assert.Equal(t, []string{"NEW"}, diff.Added)
+	assert.Equal(t, []string{"DROP"}, diff.Removed)
+	assert.Equal(t, []string{"EDIT"}, diff.Changed)
+
+	unknown := ruleset.File{Version: 1, Rules: []ruleset.Spec{{ID: "MISSING", Builtin: true}}}
+	assert.Error(t, unknown.CheckBuiltins(current))
+}
+
+func TestReplaceExpressionRules_Atomic(t *testing.T) {
+	fd := detector.NewFraudDetector()
+	require.NoError(t, fd.AddExpressionRule(detector.Rule{ID: "OLD", Expression: "tx.amount > 1", Score: 0.1}))
+	before := fd.GetActiveRules()
+
+	err := fd.ReplaceExpressionRules([]detector.Rule{
+		{ID: "GOOD", Expression: "tx.amount > 1", Score: 0.1},
+		{ID: "BAD", Expression: "tx.amount >", Score: 0.1},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rule BAD")
+	assert.Len(t, fd.GetActiveRules(), len(before))
+
+	require.NoError(t, fd.ReplaceExpressionRules([]detector.Rule{{ID: "NEW", Expression: "tx.amount > 2", Score: 0.2}}))
+	var ids []string
+	for _, rule := range fd.GetActiveRules() {
+		if rule.Expression != "" {
+			ids = append(ids, rule.ID)
+		}
+	}
+	assert.Equal(t, []string{"NEW"}, ids)
+
+	assert.Error(t, fd.ReplaceExpressionRules([]detector.Rule{{ID: "HIGH_AMOUNT", Expression: "tx.amount > 2", Score: 0.2}}))
+}
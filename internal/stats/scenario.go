@@ -0,0 +1,355 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Aggregates of scenarios
+const (
+	// AggregateCount counts the matching decisions of the window
+	AggregateCount = "count"
+	// AggregateRate is the share of the decisions in scope that match
+	AggregateRate = "rate"
+)
+
+// Statuses of scenario alerts
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// scenarioBuckets is the number of slots a scenario's window is counted in,
+// so windows slide in steps of a sixtieth
+const scenarioBuckets = 60
+
+// Scenario is an alert rule on aggregate decisions rather than a single
+// transaction, such as the decline rate of a merchant over 10 minutes. It
+// fires while its aggregate of the decisions within Window exceeds
+// Threshold.
+type Scenario struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	// MerchantID confines the scenario to the decisions of one merchant;
+	// empty watches all of them
+	MerchantID string `json:"merchant_id,omitempty"`
+	// Decision, RiskLevel and ReasonCode select the decisions that match;
+	// those left empty match any
+	Decision   string `json:"decision,omitempty"`
+	RiskLevel  string `json:"risk_level,omitempty"`
+	ReasonCode string `json:"reason_code,omitempty"`
+	// Aggregate is count or rate, Threshold a count or a share within [0, 1)
+	Aggregate string  `json:"aggregate"`
+	Threshold float64 `json:"threshold"`
+	// Window is how far back decisions are aggregated, e.g. "10m"
+	Window string `json:"window"`
+	// MinVolume is the number of decisions in scope below which a rate
+	// scenario does not fire, so a handful of declines is not a rate
+	MinVolume int `json:"min_volume,omitempty"`
+}
+
+// Validate checks the ID, the aggregate, the threshold and the window
+func (s Scenario) Validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("scenario id is required")
+	}
+	window, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return fmt.Errorf("scenario %s: invalid window %q: %w", s.ID, s.Window, err)
+	}
+	if window < time.Minute {
+		return fmt.Errorf("scenario %s: window must be at least a minute", s.ID)
+	}
+	switch s.Aggregate {
+	case AggregateCount:
+		if s.Threshold < 0 {
+			return fmt.Errorf("scenario %s: threshold must not be negative", s.ID)
+		}
+	case AggregateRate:
+		if s.Threshold < 0 || s.Threshold >= 1 {
+			return fmt.Errorf("scenario %s: rate threshold %.2f must be within [0, 1)", s.ID, s.Threshold)
+		}
+	default:
+		return fmt.Errorf("scenario %s: unknown aggregate %q, use %s or %s", s.ID, s.Aggregate, AggregateCount, AggregateRate)
+	}
+	if s.MinVolume < 0 {
+		return fmt.Errorf("scenario %s: min volume must not be negative", s.ID)
+	}
+	return nil
+}
+
+// Sample is a decision as scenarios see it
+type Sample struct {
+	MerchantID  string
+	Decision    string
+	RiskLevel   string
+	ReasonCodes []string
+	At          time.Time
+}
+
+// matches reports whether a sample is in the scope of a scenario and whether
+// it matches it
+func (s Scenario) matches(sample Sample) (inScope, matched bool) {
+	if s.MerchantID != "" && sample.MerchantID != s.MerchantID {
+		return false, false
+	}
+	if (s.Decision != "" && sample.Decision != s.Decision) || (s.RiskLevel != "" && sample.RiskLevel != s.RiskLevel) {
+		return true, false
+	}
+	if s.ReasonCode == "" {
+		return true, true
+	}
+	for _, code := range sample.ReasonCodes {
+		if code == s.ReasonCode {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// ScenarioAlert is raised when a scenario starts firing and again when it
+// resolves
+type ScenarioAlert struct {
+	Scenario   string  `json:"scenario"`
+	Status     string  `json:"status" openapi:"enum=firing|resolved"`
+	MerchantID string  `json:"merchant_id,omitempty"`
+	Aggregate  string  `json:"aggregate"`
+	Value      float64 `json:"value"`
+	Threshold  float64 `json:"threshold"`
+	// Matched counts the matching decisions of the window and Total those in
+	// scope
+	Matched     uint64     `json:"matched"`
+	Total       uint64     `json:"total"`
+	Window      string     `json:"window"`
+	FiringSince *time.Time `json:"firing_since,omitempty"`
+	EvaluatedAt time.Time  `json:"evaluated_at"`
+	Description string     `json:"description,omitempty"`
+}
+
+// ScenarioState is a scenario with its aggregate as of a time
+type ScenarioState struct {
+	Scenario
+	Value       float64    `json:"value"`
+	Matched     uint64     `json:"matched"`
+	Total       uint64     `json:"total"`
+	Firing      bool       `json:"firing"`
+	FiringSince *time.Time `json:"firing_since,omitempty"`
+}
+
+// watch counts the decisions of a scenario in slots of a sixtieth of its
+// window. slots holds the number of the slot each bucket counts, so buckets
+// of slots past are reset when reused.
+type watch struct {
+	scenario Scenario
+	width    time.Duration
+	slots    [scenarioBuckets]int64
+	total    [scenarioBuckets]uint64
+	matched  [scenarioBuckets]uint64
+	// firingSince is when the scenario started firing, nil while it is not
+	firingSince *time.Time
+	mu          sync.Mutex
+}
+
+func newWatch(scenario Scenario) *watch {
+	window, _ := time.ParseDuration(scenario.Window)
+	w := &watch{scenario: scenario, width: window / scenarioBuckets}
+	for i := range w.slots {
+		w.slots[i] = -1
+	}
+	return w
+}
+
+func (w *watch) record(sample Sample) {
+	inScope, matched := w.scenario.matches(sample)
+	if !inScope {
+		return
+	}
+	slot := int64(sample.At.UnixNano() / int64(w.width))
+	i := slot % scenarioBuckets
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.slots[i] < slot:
+		w.slots[i], w.total[i], w.matched[i] = slot, 0, 0
+	case w.slots[i] > slot:
+		// Older than the window the bucket now counts
+		return
+	}
+	w.total[i]++
+	if matched {
+		w.matched[i]++
+	}
+}
+
+// state aggregates the window ending at now. Callers must hold the lock.
+func (w *watch) state(now time.Time) ScenarioState {
+	slot := int64(now.UnixNano() / int64(w.width))
+	state := ScenarioState{Scenario: w.scenario, Firing: w.firingSince != nil, FiringSince: w.firingSince}
+	for i := range w.slots {
+		if w.slots[i] > slot-scenarioBuckets && w.slots[i] <= slot {
+			state.Total += w.total[i]
+			state.Matched += w.matched[i]
+		}
+	}
+	switch w.scenario.Aggregate {
+	case AggregateCount:
+		state.Value = float64(state.Matched)
+	case AggregateRate:
+		if state.Total > 0 {
+			state.Value = float64(state.Matched) / float64(state.Total)
+		}
+	}
+	return state
+}
+
+// breached reports whether a state is over its threshold
+func (s ScenarioState) breached() bool {
+	if s.Aggregate == AggregateRate && s.Total < uint64(max(s.MinVolume, 1)) {
+		return false
+	}
+	return s.Value > s.Threshold
+}
+
+func (s ScenarioState) alert(status string, now time.Time) ScenarioAlert {
+	return ScenarioAlert{
+		Scenario:    s.ID,
+		Status:      status,
+		MerchantID:  s.MerchantID,
+		Aggregate:   s.Aggregate,
+		Value:       s.Value,
+		Threshold:   s.Threshold,
+		Matched:     s.Matched,
+		Total:       s.Total,
+		Window:      s.Window,
+		FiringSince: s.FiringSince,
+		EvaluatedAt: now,
+		Description: s.Description,
+	}
+}
+
+// Scenarios counts decisions against scenario alert rules and evaluates them
+type Scenarios struct {
+	watches []*watch
+	mu      sync.RWMutex
+}
+
+// NewScenarios validates scenarios and starts counting against them
+func NewScenarios(scenarios []Scenario) (*Scenarios, error) {
+	s := &Scenarios{}
+	if err := s.Set(scenarios); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Set validates and replaces the scenarios. Scenarios kept unchanged keep
+// their counts and whether they fire.
+func (s *Scenarios) Set(scenarios []Scenario) error {
+	seen := make(map[string]bool)
+	for _, scenario := range scenarios {
+		if err := scenario.Validate(); err != nil {
+			return err
+		}
+		if seen[scenario.ID] {
+			return fmt.Errorf("duplicate scenario %s", scenario.ID)
+		}
+		seen[scenario.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make(map[Scenario]*watch, len(s.watches))
+	for _, w := range s.watches {
+		kept[w.scenario] = w
+	}
+	watches := make([]*watch, 0, len(scenarios))
+	for _, scenario := range scenarios {
+		w, exists := kept[scenario]
+		if !exists {
+			w = newWatch(scenario)
+		}
+		watches = append(watches, w)
+	}
+	s.watches = watches
+	return nil
+}
+
+// List returns the scenarios
+func (s *Scenarios) List() []Scenario {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scenarios := make([]Scenario, 0, len(s.watches))
+	for _, w := range s.watches {
+		scenarios = append(scenarios, w.scenario)
+	}
+	return scenarios
+}
+
+// Record counts a decision against every scenario
+func (s *Scenarios) Record(sample Sample) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, w := range s.watches {
+		w.record(sample)
+	}
+}
+
+// States returns every scenario with its aggregate as of now, sorted by ID
+func (s *Scenarios) States(now time.Time) []ScenarioState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	states := make([]ScenarioState, 0, len(s.watches))
+	for _, w := range s.watches {
+		w.mu.Lock()
+		states = append(states, w.state(now))
+		w.mu.Unlock()
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+	return states
+}
+
+// Evaluate checks every scenario as of now and returns the alerts of those
+// that started firing or resolved since the last evaluation
+func (s *Scenarios) Evaluate(now time.Time) []ScenarioAlert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var alerts []ScenarioAlert
+	for _, w := range s.watches {
+		w.mu.Lock()
+		state := w.state(now)
+		switch breached := state.breached(); {
+		case breached && w.firingSince == nil:
+			since := now
+			w.firingSince = &since
+			state.Firing, state.FiringSince = true, &since
+			alerts = append(alerts, state.alert(StatusFiring, now))
+		case !breached && w.firingSince != nil:
+			alerts = append(alerts, state.alert(StatusResolved, now))
+			w.firingSince = nil
+		}
+		w.mu.Unlock()
+	}
+	return alerts
+}
+
+// Start evaluates the scenarios every interval until stop is closed, telling
+// notify of every alert
+func (s *Scenarios) Start(interval time.Duration, notify func([]ScenarioAlert), stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if alerts := s.Evaluate(now); len(alerts) > 0 {
+				notify(alerts)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
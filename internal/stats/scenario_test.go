@@ -0,0 +1,103 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+func TestScenarios_DeclineRateOfAMerchant(t *testing.T) {
+	scenarios, err := stats.NewScenarios([]stats.Scenario{{
+		ID:         "m1-declines",
+		MerchantID: "M1",
+		Decision:   "DECLINE",
+		Aggregate:  stats.AggregateRate,
+		Threshold:  0.2,
+		Window:     "10m",
+		MinVolume:  5,
+	}})
+	require.NoError(t, err)
+
+	record := func(merchant, decision string, at time.Time) {
+		scenarios.Record(stats.Sample{MerchantID: merchant, Decision: decision, At: at})
+	}
+	record("M1", "DECLINE", start)
+	record("M1", "DECLINE", start)
+	record("M1", "APPROVE", start)
+	assert.Empty(t, scenarios.Evaluate(start.Add(time.Minute)), "below the minimum volume")
+
+	for i := 0; i < 5; i++ {
+		record("M1", "APPROVE", start.Add(time.Minute))
+		record("M2", "DECLINE", start.Add(time.Minute))
+	}
+	alerts := scenarios.Evaluate(start.Add(2 * time.Minute))
+	require.Len(t, alerts, 1, "other merchants are out of scope")
+	assert.Equal(t, stats.StatusFiring, alerts[0].Status)
+	assert.Equal(t, uint64(2), alerts[0].Matched)
+	assert.Equal(t, uint64(8), alerts[0].Total)
+	assert.InDelta(t, 0.25, alerts[0].Value, 1e-9)
+	assert.Empty(t, scenarios.Evaluate(start.Add(3*time.Minute)), "a firing scenario alerts once")
+
+	states := scenarios.States(start.Add(3 * time.Minute))
+	require.Len(t, states, 1)
+	assert.True(t, states[0].Firing)
+	assert.Equal(t, start.Add(2*time.Minute), *states[0].FiringSince)
+
+	// The declines at the start leave the window after 10 minutes
+	alerts = scenarios.Evaluate(start.Add(10*time.Minute + 30*time.Second))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, stats.StatusResolved, alerts[0].Status)
+	assert.Equal(t, uint64(5), alerts[0].Total)
+	assert.False(t, scenarios.States(start.Add(11 * time.Minute))[0].Firing)
+}
+
+func TestScenarios_GlobalCountOfRiskLevel(t *testing.T) {
+	scenarios, err := stats.NewScenarios([]stats.Scenario{
+		{ID: "critical", RiskLevel: "CRITICAL", Aggregate: stats.AggregateCount, Threshold: 2, Window: "1h"},
+		{ID: "velocity", ReasonCode: "VELOCITY", Aggregate: stats.AggregateCount, Threshold: 0, Window: "1h"},
+	})
+	require.NoError(t, err)
+	for i, merchant := range []string{"M1", "M2", "M3"} {
+		scenarios.Record(stats.Sample{MerchantID: merchant, RiskLevel: "CRITICAL", At: start.Add(time.Duration(i) * time.Minute)})
+	}
+	scenarios.Record(stats.Sample{MerchantID: "M1", RiskLevel: "LOW", ReasonCodes: []string{"NEW_DEVICE", "VELOCITY"}, At: start})
+
+	alerts := scenarios.Evaluate(start.Add(5 * time.Minute))
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "critical", alerts[0].Scenario)
+	assert.Equal(t, 3.0, alerts[0].Value)
+	assert.Equal(t, "velocity", alerts[1].Scenario)
+
+	// Unchanged scenarios keep firing across a replacement; changed ones
+	// start over
+	require.NoError(t, scenarios.Set([]stats.Scenario{
+		{ID: "critical", RiskLevel: "CRITICAL", Aggregate: stats.AggregateCount, Threshold: 2, Window: "1h"},
+		{ID: "velocity", ReasonCode: "VELOCITY", Aggregate: stats.AggregateCount, Threshold: 5, Window: "1h"},
+	}))
+	assert.Empty(t, scenarios.Evaluate(start.Add(6*time.Minute)))
+	assert.Equal(t, 0.0, scenarios.States(start.Add(6 * time.Minute))[1].Value)
+}
+
+func TestScenario_Validate(t *testing.T) {
+	valid := stats.Scenario{ID: "s", Aggregate: stats.AggregateRate, Threshold: 0.2, Window: "10m"}
+	assert.NoError(t, valid.Validate())
+
+	for name, change := range map[string]func(*stats.Scenario){
+		"no id":          func(s *stats.Scenario) { s.ID = "" },
+		"bad window":     func(s *stats.Scenario) { s.Window = "soon" },
+		"short window":   func(s *stats.Scenario) { s.Window = "10s" },
+		"rate above one": func(s *stats.Scenario) { s.Threshold = 1.5 },
+		"aggregate":      func(s *stats.Scenario) { s.Aggregate = "sum" },
+	} {
+		scenario := valid
+		change(&scenario)
+		assert.Error(t, scenario.Validate(), name)
+	}
+	_, err := stats.NewScenarios([]stats.Scenario{valid, valid})
+	assert.Error(t, err, "duplicate IDs")
+}
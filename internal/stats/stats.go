@@ -0,0 +1,126 @@
+// Package stats counts scoring outcomes with sharded atomic counters, so that
+// reading the statistics never blocks or slows down the scoring that updates
+// them.
+package stats
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// numShards is the number of shards of a counter, a power of two
+const numShards = 16
+
+// shard is a counter cell padded to its own cache line, so increments of
+// different shards do not invalidate each other
+type shard struct {
+	n uint64
+	_ [56]byte
+}
+
+// Counter is a sharded counter. Concurrent increments with different hints
+// land on different cache lines; reads sum the shards.
+type Counter struct {
+	shards [numShards]shard
+}
+
+// Add adds n to the shard picked by hint
+func (c *Counter) Add(hint uint32, n uint64) {
+	atomic.AddUint64(&c.shards[hint&(numShards-1)].n, n)
+}
+
+// Load returns the sum of the shards
+func (c *Counter) Load() uint64 {
+	var total uint64
+	for i := range c.shards {
+		total += atomic.LoadUint64(&c.shards[i].n)
+	}
+	return total
+}
+
+// scoreUnit is the resolution scores are summed at
+const scoreUnit = 1e6
+
+// Collector counts the scored transactions, their decisions and reason codes
+// and sums their scores
+type Collector struct {
+	since    time.Time
+	analyzed Counter
+	// scores sums the final scores in millionths
+	scores Counter
+	// decisions and reasons hold a *Counter per decision and reason code.
+	// New keys are rare after warm-up, so lookups are lock-free reads.
+	decisions sync.Map
+	reasons   sync.Map
+}
+
+func NewCollector() *Collector {
+	return &Collector{since: time.Now()}
+}
+
+// hint spreads transactions over the shards by ID, FNV-1a without
+// allocating
+func hint(id string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func counter(m *sync.Map, key string) *Counter {
+	if c, exists := m.Load(key); exists {
+		return c.(*Counter)
+	}
+	c, _ := m.LoadOrStore(key, &Counter{})
+	return c.(*Counter)
+}
+
+// Record counts a scored transaction
+func (c *Collector) Record(transactionID, decision string, score float64, reasonCodes []string) {
+	h := hint(transactionID)
+	c.analyzed.Add(h, 1)
+	c.scores.Add(h, uint64(math.Round(math.Max(score, 0)*scoreUnit)))
+	counter(&c.decisions, decision).Add(h, 1)
+	for _, code := range reasonCodes {
+		counter(&c.reasons, code).Add(h, 1)
+	}
+}
+
+// Snapshot is the point-in-time statistics of the scored transactions
+type Snapshot struct {
+	Since        time.Time         `json:"since"`
+	At           time.Time         `json:"at"`
+	Analyzed     uint64            `json:"analyzed"`
+	AverageScore float64           `json:"average_score"`
+	Decisions    map[string]uint64 `json:"decisions"`
+	ReasonCodes  map[string]uint64 `json:"reason_codes"`
+}
+
+// Snapshot reads the counters without stopping the scoring. Each count is
+// exact as of its read; transactions being recorded meanwhile may show in
+// some counts and not yet in others.
+func (c *Collector) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		Since:       c.since,
+		At:          time.Now(),
+		Analyzed:    c.analyzed.Load(),
+		Decisions:   make(map[string]uint64),
+		ReasonCodes: make(map[string]uint64),
+	}
+	if snapshot.Analyzed > 0 {
+		snapshot.AverageScore = float64(c.scores.Load()) / scoreUnit / float64(snapshot.Analyzed)
+	}
+	c.decisions.Range(func(key, value interface{}) bool {
+		snapshot.Decisions[key.(string)] = value.(*Counter).Load()
+		return true
+	})
+	c.reasons.Range(func(key, value interface{}) bool {
+		snapshot.ReasonCodes[key.(string)] = value.(*Counter).Load()
+		return true
+	})
+	return snapshot
+}
@@ -0,0 +1,64 @@
+package stats_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector_CountsDecisionsAndReasons(t *testing.T) {
+	collector := stats.NewCollector()
+	collector.Record("TXN-1", "APPROVE", 0.1, nil)
+	collector.Record("TXN-2", "DECLINE", 0.9, []string{"HIGH_AMOUNT", "VELOCITY"})
+	collector.Record("TXN-3", "DECLINE", 0.8, []string{"HIGH_AMOUNT"})
+
+	snapshot := collector.Snapshot()
+	assert.Equal(t, uint64(3), snapshot.Analyzed)
+	assert.InDelta(t, 0.6, snapshot.AverageScore, 1e-6)
+	assert.Equal(t, map[string]uint64{"APPROVE": 1, "DECLINE": 2}, snapshot.Decisions)
+	assert.Equal(t, map[string]uint64{"HIGH_AMOUNT": 2, "VELOCITY": 1}, snapshot.ReasonCodes)
+	assert.False(t, snapshot.At.Before(snapshot.Since))
+}
+
+func TestCollector_ConcurrentRecordsAndSnapshots(t *testing.T) {
+	collector := stats.NewCollector()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				collector.Record(fmt.Sprintf("TXN-%d-%d", g, i), "APPROVE", 0.5, []string{"ROUND_AMOUNT"})
+			}
+		}(g)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var last uint64
+		for i := 0; i < 100; i++ {
+			snapshot := collector.Snapshot()
+			assert.GreaterOrEqual(t, snapshot.Analyzed, last, "counts never go back")
+			last = snapshot.Analyzed
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	snapshot := collector.Snapshot()
+	assert.Equal(t, uint64(8000), snapshot.Analyzed)
+	assert.Equal(t, uint64(8000), snapshot.Decisions["APPROVE"])
+	assert.Equal(t, uint64(8000), snapshot.ReasonCodes["ROUND_AMOUNT"])
+	assert.InDelta(t, 0.5, snapshot.AverageScore, 1e-6)
+}
+
+func TestCounter_SumsShards(t *testing.T) {
+	var counter stats.Counter
+	for hint := uint32(0); hint < 40; hint++ {
+		counter.Add(hint, 2)
+	}
+	assert.Equal(t, uint64(80), counter.Load())
+}
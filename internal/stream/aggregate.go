@@ -0,0 +1,391 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event is a value an entity, such as a merchant or an account, contributes
+// to its windowed aggregates, like the amount of a transaction
+type Event struct {
+	Entity string
+	Value  float64
+	At     time.Time
+}
+
+// Extractor derives the events of a message. Messages that cannot be
+// decoded should return a Poison error.
+type Extractor func(msg Message) ([]Event, error)
+
+// Aggregate is the count and sum of the events of an entity over a span
+type Aggregate struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+}
+
+// Bucket aggregates the events of a slice of the window
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+	Sum   float64   `json:"sum"`
+}
+
+// Checkpoint is the aggregation state of a partition. Every message before
+// Offset is counted, as are the Applied ones after it, and no other.
+type Checkpoint struct {
+	Topic     string              `json:"topic"`
+	Partition int32               `json:"partition"`
+	Offset    int64               `json:"offset"`
+	Applied   []int64             `json:"applied,omitempty"`
+	Entities  map[string][]Bucket `json:"entities"`
+	SavedAt   time.Time           `json:"saved_at"`
+}
+
+// CheckpointStore persists the checkpoints of partitions, so that whichever
+// consumer is assigned a partition after a rebalance resumes its state
+type CheckpointStore interface {
+	Load(topic string, partition int32) (Checkpoint, bool, error)
+	Save(checkpoint Checkpoint) error
+}
+
+// AggregateConfig holds the aggregation settings
+type AggregateConfig struct {
+	// Window is how long events count; they are bucketed by Slice
+	Window time.Duration
+	Slice  time.Duration
+}
+
+// DefaultAggregateConfig returns the default aggregation settings
+func DefaultAggregateConfig() AggregateConfig {
+	return AggregateConfig{Window: time.Hour, Slice: time.Minute}
+}
+
+func (c AggregateConfig) withDefaults() AggregateConfig {
+	defaults := DefaultAggregateConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.Slice <= 0 || c.Slice > c.Window {
+		c.Slice = c.Window / 60
+	}
+	return c
+}
+
+// AggregateStats counts what an aggregator did
+type AggregateStats struct {
+	Partitions  int `json:"partitions"`
+	Entities    int `json:"entities"`
+	Applied     int `json:"applied"`
+	Skipped     int `json:"skipped" doc:"Redelivered messages already counted"`
+	Checkpoints int `json:"checkpoints"`
+}
+
+// Aggregator is a stateful stage keeping windowed counts and sums per
+// entity with exactly-once semantics over the at-least-once consumer. The
+// state of each partition records which offsets it counted and is
+// checkpointed before each commit, so a message redelivered after a restart
+// or a rebalance is not counted twice, and one committed is never lost.
+type Aggregator struct {
+	extract Extractor
+	store   CheckpointStore
+	config  AggregateConfig
+
+	mu         sync.Mutex
+	partitions map[partitionKey]*aggregateState
+	stats      AggregateStats
+}
+
+type aggregateState struct {
+	offset   int64
+	applied  map[int64]bool
+	entities map[string][]Bucket
+}
+
+func NewAggregator(extract Extractor, store CheckpointStore, config AggregateConfig) *Aggregator {
+	return &Aggregator{
+		extract:    extract,
+		store:      store,
+		config:     config.withDefaults(),
+		partitions: make(map[partitionKey]*aggregateState),
+	}
+}
+
+// Handle returns a handler counting the events of each message once before
+// passing it to next
+func (a *Aggregator) Handle(next Handler) Handler {
+	return func(ctx context.Context, msg Message) error {
+		if err := a.apply(msg); err != nil {
+			return err
+		}
+		return next(ctx, msg)
+	}
+}
+
+// Broker wraps a broker so that the aggregation state of a partition is
+// checkpointed before each of its commits. A failed checkpoint fails the
+// commit, so the messages are redelivered rather than lost.
+func (a *Aggregator) Broker(broker Broker) Broker {
+	return checkpointingBroker{Broker: broker, aggregator: a}
+}
+
+// Revoke drops the state of a partition assigned to another consumer; it
+// is loaded again from its checkpoint if the partition comes back. Broker
+// clients call it from their rebalance listener.
+func (a *Aggregator) Revoke(topic string, partition int32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.partitions, partitionKey{topic, partition})
+}
+
+// Get returns the aggregate of an entity over the span before now, at most
+// the window
+func (a *Aggregator) Get(entity string, span time.Duration, now time.Time) Aggregate {
+	if span <= 0 || span > a.config.Window {
+		span = a.config.Window
+	}
+	cutoff := now.Add(-span)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var aggregate Aggregate
+	for _, state := range a.partitions {
+		for _, b := range state.entities[entity] {
+			if b.Start.Add(a.config.Slice).After(cutoff) && !b.Start.After(now) {
+				aggregate.Count += b.Count
+				aggregate.Sum += b.Sum
+			}
+		}
+	}
+	return aggregate
+}
+
+// Stats returns what the aggregator did so far
+func (a *Aggregator) Stats() AggregateStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := a.stats
+	stats.Partitions = len(a.partitions)
+	for _, state := range a.partitions {
+		stats.Entities += len(state.entities)
+	}
+	return stats
+}
+
+// apply counts the events of a message unless its partition already did
+func (a *Aggregator) apply(msg Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, err := a.partition(msg.Topic, msg.Partition)
+	if err != nil {
+		return err
+	}
+	if msg.Offset < state.offset || state.applied[msg.Offset] {
+		a.stats.Skipped++
+		return nil
+	}
+	events, err := a.extract(msg)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		state.entities[event.Entity] = a.add(state.entities[event.Entity], event)
+	}
+	state.applied[msg.Offset] = true
+	a.stats.Applied++
+	return nil
+}
+
+// add counts an event in the buckets of its entity, dropping those that
+// fell out of the window of the event
+func (a *Aggregator) add(buckets []Bucket, event Event) []Bucket {
+	start := event.At.Truncate(a.config.Slice)
+	i := sort.Search(len(buckets), func(i int) bool { return !buckets[i].Start.Before(start) })
+	if i == len(buckets) || !buckets[i].Start.Equal(start) {
+		buckets = append(buckets, Bucket{})
+		copy(buckets[i+1:], buckets[i:])
+		buckets[i] = Bucket{Start: start}
+	}
+	buckets[i].Count++
+	buckets[i].Sum += event.Value
+
+	latest := buckets[len(buckets)-1].Start.Add(a.config.Slice)
+	drop := 0
+	for drop < len(buckets) && !buckets[drop].Start.Add(a.config.Slice).After(latest.Add(-a.config.Window)) {
+		drop++
+	}
+	return buckets[drop:]
+}
+
+// partition returns the state of a partition, loading its checkpoint the
+// first time it is seen. Callers must hold the lock.
+func (a *Aggregator) partition(topic string, partition int32) (*aggregateState, error) {
+	key := partitionKey{topic, partition}
+	if state, exists := a.partitions[key]; exists {
+		return state, nil
+	}
+	checkpoint, exists, err := a.store.Load(topic, partition)
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint of %s/%d: %w", topic, partition, err)
+	}
+	state := &aggregateState{applied: make(map[int64]bool), entities: make(map[string][]Bucket)}
+	if exists {
+		state.offset = checkpoint.Offset
+		for _, offset := range checkpoint.Applied {
+			state.applied[offset] = true
+		}
+		for entity, buckets := range checkpoint.Entities {
+			state.entities[entity] = buckets
+		}
+	}
+	a.partitions[key] = state
+	return state, nil
+}
+
+// checkpoint saves the state of a partition whose messages before offset
+// are all processed, as the consumer is about to commit them
+func (a *Aggregator) checkpoint(topic string, partition int32, offset int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, err := a.partition(topic, partition)
+	if err != nil {
+		return err
+	}
+	if offset > state.offset {
+		state.offset = offset
+	}
+	checkpoint := Checkpoint{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    state.offset,
+		Entities:  make(map[string][]Bucket, len(state.entities)),
+		SavedAt:   time.Now(),
+	}
+	for applied := range state.applied {
+		if applied < state.offset {
+			delete(state.applied, applied)
+		} else {
+			checkpoint.Applied = append(checkpoint.Applied, applied)
+		}
+	}
+	sort.Slice(checkpoint.Applied, func(i, j int) bool { return checkpoint.Applied[i] < checkpoint.Applied[j] })
+	for entity, buckets := range state.entities {
+		checkpoint.Entities[entity] = append([]Bucket(nil), buckets...)
+	}
+	if err := a.store.Save(checkpoint); err != nil {
+		return fmt.Errorf("save checkpoint of %s/%d: %w", topic, partition, err)
+	}
+	a.stats.Checkpoints++
+	return nil
+}
+
+type checkpointingBroker struct {
+	Broker
+	aggregator *Aggregator
+}
+
+func (b checkpointingBroker) Commit(ctx context.Context, topic string, partition int32, offset int64) error {
+	if err := b.aggregator.checkpoint(topic, partition, offset); err != nil {
+		return err
+	}
+	return b.Broker.Commit(ctx, topic, partition, offset)
+}
+
+// MemoryCheckpoints keeps checkpoints in memory, for tests and single
+// consumers that rebuild their state from the start of the log
+type MemoryCheckpoints struct {
+	mu          sync.Mutex
+	checkpoints map[partitionKey]Checkpoint
+}
+
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{checkpoints: make(map[partitionKey]Checkpoint)}
+}
+
+// Load returns the checkpoint of a partition
+func (s *MemoryCheckpoints) Load(topic string, partition int32) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoint, exists := s.checkpoints[partitionKey{topic, partition}]
+	return checkpoint, exists, nil
+}
+
+// Save replaces the checkpoint of a partition
+func (s *MemoryCheckpoints) Save(checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[partitionKey{checkpoint.Topic, checkpoint.Partition}] = checkpoint
+	return nil
+}
+
+// FileCheckpoints keeps the checkpoint of each partition as a JSON file in a
+// directory, such as a volume shared by the consumer group, replaced
+// atomically on every save
+type FileCheckpoints struct {
+	dir string
+}
+
+// OpenFileCheckpoints creates the directory of a checkpoint store if needed
+func OpenFileCheckpoints(dir string) (*FileCheckpoints, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileCheckpoints{dir: dir}, nil
+}
+
+// Load reads the checkpoint file of a partition
+func (s *FileCheckpoints) Load(topic string, partition int32) (Checkpoint, bool, error) {
+	data, err := os.ReadFile(s.path(topic, partition))
+	if errors.Is(err, os.ErrNotExist) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return Checkpoint{}, false, err
+	}
+	return checkpoint, true, nil
+}
+
+// Save writes the checkpoint file of a partition
+func (s *FileCheckpoints) Save(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	path := s.path(checkpoint.Topic, checkpoint.Partition)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileCheckpoints) path(topic string, partition int32) string {
+	name := filepath.Base(filepath.Clean("/" + topic))
+	return filepath.Join(s.dir, name+"-"+strconv.Itoa(int(partition))+".json")
+}
@@ -0,0 +1,116 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stream"
+)
+
+var aggregateStart = time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+// amounts extracts an event of the merchant in the key, the amount in the
+// value, a minute after the previous offset
+func amounts(msg stream.Message) ([]stream.Event, error) {
+	if len(msg.Value) == 0 {
+		return nil, stream.Poison(errors.New("empty message"))
+	}
+	at := aggregateStart.Add(time.Duration(msg.Offset) * time.Minute)
+	return []stream.Event{{Entity: string(msg.Key), Value: float64(msg.Value[0]), At: at}}, nil
+}
+
+func payments(partition int32, from, to int) []stream.Message {
+	var msgs []stream.Message
+	for offset := from; offset < to; offset++ {
+		msgs = append(msgs, stream.Message{Topic: "transactions", Partition: partition, Offset: int64(offset), Key: []byte("MER-1"), Value: []byte{10}})
+	}
+	return msgs
+}
+
+func TestAggregator_CountsRedeliveriesOnce(t *testing.T) {
+	store := stream.NewMemoryCheckpoints()
+	aggregator := stream.NewAggregator(amounts, store, stream.AggregateConfig{Window: time.Hour, Slice: time.Minute})
+	broker := newMemoryBroker(payments(0, 0, 5)...)
+	consumer := stream.NewConsumer(aggregator.Broker(broker), aggregator.Handle(func(ctx context.Context, msg stream.Message) error {
+		return nil
+	}), stream.Config{MaxInFlight: 2})
+	run(t, consumer, func() bool { return broker.commitOf(0) == 5 })
+
+	now := aggregateStart.Add(5 * time.Minute)
+	assert.Equal(t, stream.Aggregate{Count: 5, Sum: 50}, aggregator.Get("MER-1", time.Hour, now))
+
+	// A rebalance hands the partition to another consumer, which is
+	// redelivered messages the first one already counted
+	aggregator.Revoke("transactions", 0)
+	next := stream.NewAggregator(amounts, store, stream.AggregateConfig{Window: time.Hour, Slice: time.Minute})
+	broker = newMemoryBroker(payments(0, 3, 8)...)
+	consumer = stream.NewConsumer(next.Broker(broker), next.Handle(func(ctx context.Context, msg stream.Message) error {
+		return nil
+	}), stream.Config{MaxInFlight: 2})
+	run(t, consumer, func() bool { return broker.commitOf(0) == 8 })
+
+	now = aggregateStart.Add(8 * time.Minute)
+	assert.Equal(t, stream.Aggregate{Count: 8, Sum: 80}, next.Get("MER-1", time.Hour, now))
+	assert.Equal(t, stream.Aggregate{Count: 2, Sum: 20}, next.Get("MER-1", 2*time.Minute, now))
+	assert.Zero(t, aggregator.Get("MER-1", time.Hour, now).Count, "revoked partitions are dropped")
+	stats := next.Stats()
+	assert.Equal(t, 3, stats.Applied)
+	assert.Equal(t, 2, stats.Skipped)
+	assert.Equal(t, 1, stats.Entities)
+}
+
+func TestAggregator_RetriesDoNotDoubleCount(t *testing.T) {
+	aggregator := stream.NewAggregator(amounts, stream.NewMemoryCheckpoints(), stream.DefaultAggregateConfig())
+	broker := newMemoryBroker(append(payments(0, 0, 2), stream.Message{Topic: "transactions", Partition: 0, Offset: 2})...)
+	attempts := 0
+	consumer := stream.NewConsumer(aggregator.Broker(broker), aggregator.Handle(func(ctx context.Context, msg stream.Message) error {
+		if msg.Offset == 1 {
+			if attempts++; attempts < 3 {
+				return errors.New("decision store unavailable")
+			}
+		}
+		return nil
+	}), stream.Config{MaxInFlight: 1, Backoff: time.Millisecond})
+	run(t, consumer, func() bool { return broker.commitOf(0) == 3 })
+
+	assert.Equal(t, stream.Aggregate{Count: 2, Sum: 20}, aggregator.Get("MER-1", 0, aggregateStart.Add(2*time.Minute)))
+	assert.Equal(t, 1, consumer.Stats().DeadLettered, "the poison message is not counted")
+}
+
+func TestAggregator_ExpiresEventsOutOfTheWindow(t *testing.T) {
+	aggregator := stream.NewAggregator(amounts, stream.NewMemoryCheckpoints(), stream.AggregateConfig{Window: 10 * time.Minute, Slice: time.Minute})
+	handle := aggregator.Handle(func(ctx context.Context, msg stream.Message) error { return nil })
+	for _, msg := range append(payments(0, 0, 3), payments(0, 20, 22)...) {
+		require.NoError(t, handle(context.Background(), msg))
+	}
+	now := aggregateStart.Add(22 * time.Minute)
+	assert.Equal(t, stream.Aggregate{Count: 2, Sum: 20}, aggregator.Get("MER-1", time.Hour, now), "the span is at most the window")
+	assert.Zero(t, aggregator.Get("MER-2", time.Hour, now))
+}
+
+func TestFileCheckpoints(t *testing.T) {
+	store, err := stream.OpenFileCheckpoints(t.TempDir())
+	require.NoError(t, err)
+	_, exists, err := store.Load("transactions", 3)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	saved := stream.Checkpoint{
+		Topic:     "transactions",
+		Partition: 3,
+		Offset:    42,
+		Applied:   []int64{44},
+		Entities:  map[string][]stream.Bucket{"MER-1": {{Start: aggregateStart, Count: 2, Sum: 35.5}}},
+		SavedAt:   aggregateStart,
+	}
+	require.NoError(t, store.Save(saved))
+	loaded, exists, err := store.Load("transactions", 3)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, saved, loaded)
+}
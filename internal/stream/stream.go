@@ -0,0 +1,362 @@
+// Package stream consumes transactions from a partitioned message log such
+// as a Kafka topic with at-least-once semantics. A message's offset is
+// committed only once its handler has persisted the decision, and only after
+// every earlier message of its partition, so a restart redelivers whatever
+// was not finished. Up to MaxInFlight messages are handled at a time; when
+// the handlers fall behind the consumer pauses fetching until they catch up.
+// Poison messages are published to a dead-letter topic instead of blocking
+// their partition. An Aggregator derives windowed features from the stream
+// on top of the consumer with exactly-once semantics.
+//
+// The package does not bundle a broker client: one is plugged in through the
+// Broker interface.
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrPoison marks handler errors no retry can fix, such as a message that
+// cannot be decoded. Wrap it with Poison.
+var ErrPoison = errors.New("poison message")
+
+// Poison marks an error as permanent, so the message goes to the dead-letter
+// topic without being retried
+func Poison(err error) error {
+	return fmt.Errorf("%w: %w", ErrPoison, err)
+}
+
+// Headers set on dead-lettered messages
+const (
+	HeaderReason    = "dead_letter_reason"
+	HeaderTopic     = "dead_letter_topic"
+	HeaderPartition = "dead_letter_partition"
+	HeaderOffset    = "dead_letter_offset"
+	HeaderAttempts  = "dead_letter_attempts"
+)
+
+// Message is a record of a partition of a topic
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// Broker is the client of the message log
+type Broker interface {
+	// Fetch blocks until the next message of the assigned partitions
+	Fetch(ctx context.Context) (Message, error)
+	// Commit records that the messages of a partition before offset are
+	// processed
+	Commit(ctx context.Context, topic string, partition int32, offset int64) error
+	// Publish appends a message to a topic
+	Publish(ctx context.Context, topic string, msg Message) error
+	// Pause stops fetching from the assigned partitions while staying in the
+	// consumer group, and Resume restarts it
+	Pause()
+	Resume()
+}
+
+// Handler processes a message. It returns once the decision is persisted;
+// an error retries the message unless it is a Poison error.
+type Handler func(ctx context.Context, msg Message) error
+
+// Config holds consumer settings
+type Config struct {
+	// DeadLetterTopic receives the poison messages and the ones still failing
+	// after MaxAttempts
+	DeadLetterTopic string
+	// MaxInFlight bounds the messages handled at a time. Fetching pauses when
+	// it is reached and resumes once no more than ResumeAt are in flight.
+	MaxInFlight int
+	ResumeAt    int
+	// MaxAttempts includes the first attempt
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each retry
+	Backoff time.Duration
+}
+
+// DefaultConfig returns the default consumer settings
+func DefaultConfig() Config {
+	return Config{
+		DeadLetterTopic: "fraud-transactions-dlq",
+		MaxInFlight:     64,
+		ResumeAt:        32,
+		MaxAttempts:     5,
+		Backoff:         100 * time.Millisecond,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.DeadLetterTopic == "" {
+		c.DeadLetterTopic = defaults.DeadLetterTopic
+	}
+	if c.MaxInFlight <= 0 {
+		c.MaxInFlight = defaults.MaxInFlight
+	}
+	if c.ResumeAt < 0 || c.ResumeAt >= c.MaxInFlight {
+		c.ResumeAt = c.MaxInFlight / 2
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaults.MaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaults.Backoff
+	}
+	return c
+}
+
+// Stats counts what a consumer did
+type Stats struct {
+	InFlight     int  `json:"in_flight"`
+	Paused       bool `json:"paused"`
+	Pauses       int  `json:"pauses"`
+	Committed    int  `json:"committed"`
+	Retries      int  `json:"retries"`
+	DeadLettered int  `json:"dead_lettered"`
+}
+
+// Consumer hands the messages of a broker to a handler
+type Consumer struct {
+	broker  Broker
+	handler Handler
+	config  Config
+
+	mu         sync.Mutex
+	inFlight   int
+	paused     bool
+	partitions map[partitionKey]*partition
+	stats      Stats
+	// wake signals the fetch loop that a message finished
+	wake chan struct{}
+	// commitMu keeps the commits of a partition in order
+	commitMu sync.Mutex
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partition tracks the fetched offsets of a partition that are not
+// committed yet, in fetch order
+type partition struct {
+	pending []int64
+	done    map[int64]bool
+}
+
+func NewConsumer(broker Broker, handler Handler, config Config) *Consumer {
+	return &Consumer{
+		broker:     broker,
+		handler:    handler,
+		config:     config.withDefaults(),
+		partitions: make(map[partitionKey]*partition),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Run consumes until the context is canceled or the broker fails, then
+// waits for the messages in flight. Messages not committed by then are
+// redelivered on the next run. It returns nil once the context is canceled.
+func (c *Consumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	for {
+		if err := c.acquire(ctx); err != nil {
+			break
+		}
+		msg, err := c.broker.Fetch(ctx)
+		if err != nil {
+			c.release()
+			cancel(fmt.Errorf("fetch: %w", err))
+			break
+		}
+		c.track(msg)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.release()
+			if err := c.process(ctx, msg); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := context.Cause(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// Stats returns what the consumer did so far
+func (c *Consumer) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.InFlight = c.inFlight
+	stats.Paused = c.paused
+	return stats
+}
+
+// acquire waits for room for another message, pausing the broker while the
+// handlers are saturated
+func (c *Consumer) acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if !c.paused && c.inFlight < c.config.MaxInFlight {
+			c.inFlight++
+			c.mu.Unlock()
+			return nil
+		}
+		if !c.paused {
+			c.paused = true
+			c.stats.Pauses++
+			c.broker.Pause()
+			log.Printf("Stream consumer paused with %d messages in flight", c.inFlight)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the room of a finished message, resuming the broker once
+// the handlers caught up
+func (c *Consumer) release() {
+	c.mu.Lock()
+	c.inFlight--
+	if c.paused && c.inFlight <= c.config.ResumeAt {
+		c.paused = false
+		c.broker.Resume()
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Consumer) track(msg Message) {
+	key := partitionKey{msg.Topic, msg.Partition}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, exists := c.partitions[key]
+	if !exists {
+		p = &partition{done: make(map[int64]bool)}
+		c.partitions[key] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+}
+
+// process handles a message, retrying failures with backoff and
+// dead-lettering poison ones, then commits it. An error means the message
+// was neither handled nor dead-lettered, or its commit failed.
+func (c *Consumer) process(ctx context.Context, msg Message) error {
+	backoff := c.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err := c.handler(ctx, msg)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrPoison) || attempt >= c.config.MaxAttempts {
+			if err := c.deadLetter(ctx, msg, err, attempt); err != nil {
+				return err
+			}
+			break
+		}
+
+		c.mu.Lock()
+		c.stats.Retries++
+		c.mu.Unlock()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+	return c.complete(ctx, msg)
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, cause error, attempts int) error {
+	headers := make(map[string]string, len(msg.Headers)+5)
+	for name, value := range msg.Headers {
+		headers[name] = value
+	}
+	headers[HeaderReason] = cause.Error()
+	headers[HeaderTopic] = msg.Topic
+	headers[HeaderPartition] = strconv.Itoa(int(msg.Partition))
+	headers[HeaderOffset] = strconv.FormatInt(msg.Offset, 10)
+	headers[HeaderAttempts] = strconv.Itoa(attempts)
+
+	letter := msg
+	letter.Topic = c.config.DeadLetterTopic
+	letter.Headers = headers
+	if err := c.broker.Publish(ctx, c.config.DeadLetterTopic, letter); err != nil {
+		return fmt.Errorf("dead-letter %s/%d@%d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+	}
+	log.Printf("Dead-lettered %s/%d@%d after %d attempts: %v", msg.Topic, msg.Partition, msg.Offset, attempts, cause)
+
+	c.mu.Lock()
+	c.stats.DeadLettered++
+	c.mu.Unlock()
+	return nil
+}
+
+// complete marks a message done and commits its partition up to the first
+// message still in flight
+func (c *Consumer) complete(ctx context.Context, msg Message) error {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+
+	c.mu.Lock()
+	p := c.partitions[partitionKey{msg.Topic, msg.Partition}]
+	p.done[msg.Offset] = true
+	committed := 0
+	for len(p.pending) > committed && p.done[p.pending[committed]] {
+		delete(p.done, p.pending[committed])
+		committed++
+	}
+	if committed == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	next := p.pending[committed-1] + 1
+	p.pending = p.pending[committed:]
+	c.mu.Unlock()
+
+	// Finished messages are committed even while shutting down, so they are
+	// not redelivered
+	if err := c.broker.Commit(context.WithoutCancel(ctx), msg.Topic, msg.Partition, next); err != nil {
+		return fmt.Errorf("commit %s/%d@%d: %w", msg.Topic, msg.Partition, next, err)
+	}
+
+	c.mu.Lock()
+	c.stats.Committed += committed
+	c.mu.Unlock()
+	return nil
+}
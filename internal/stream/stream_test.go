@@ -0,0 +1,211 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/stream"
+)
+
+// memoryBroker serves a fixed list of messages and records what the
+// consumer commits, publishes and pauses
+type memoryBroker struct {
+	messages chan stream.Message
+
+	mu        sync.Mutex
+	committed map[int32]int64
+	published []stream.Message
+	pauses    int
+	resumes   int
+}
+
+func newMemoryBroker(messages ...stream.Message) *memoryBroker {
+	b := &memoryBroker{messages: make(chan stream.Message, len(messages)), committed: make(map[int32]int64)}
+	for _, msg := range messages {
+		b.messages <- msg
+	}
+	return b
+}
+
+func (b *memoryBroker) Fetch(ctx context.Context) (stream.Message, error) {
+	select {
+	case msg := <-b.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return stream.Message{}, ctx.Err()
+	}
+}
+
+func (b *memoryBroker) Commit(_ context.Context, _ string, partition int32, offset int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if offset <= b.committed[partition] {
+		return errors.New("commit went backwards")
+	}
+	b.committed[partition] = offset
+	return nil
+}
+
+func (b *memoryBroker) Publish(_ context.Context, _ string, msg stream.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, msg)
+	return nil
+}
+
+func (b *memoryBroker) Pause() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pauses++
+}
+
+func (b *memoryBroker) Resume() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resumes++
+}
+
+func (b *memoryBroker) commitOf(partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[partition]
+}
+
+func messages(partition int32, count int) []stream.Message {
+	var msgs []stream.Message
+	for offset := 0; offset < count; offset++ {
+		msgs = append(msgs, stream.Message{Topic: "transactions", Partition: partition, Offset: int64(offset), Value: []byte{byte(offset)}})
+	}
+	return msgs
+}
+
+// run consumes until the consumer committed what the check expects
+func run(t *testing.T, consumer *stream.Consumer, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- consumer.Run(ctx) }()
+
+	require.Eventually(t, done, 2*time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-result)
+}
+
+func TestConsumer_CommitsInOrderAfterHandling(t *testing.T) {
+	broker := newMemoryBroker(messages(0, 3)...)
+	release := map[int64]chan struct{}{0: make(chan struct{}), 1: make(chan struct{}), 2: make(chan struct{})}
+	handled := make(chan int64, 3)
+	consumer := stream.NewConsumer(broker, func(ctx context.Context, msg stream.Message) error {
+		<-release[msg.Offset]
+		handled <- msg.Offset
+		return nil
+	}, stream.Config{MaxInFlight: 3})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- consumer.Run(ctx) }()
+
+	// A later message finishing first is not committed past an earlier one
+	close(release[2])
+	close(release[1])
+	<-handled
+	<-handled
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int64(0), broker.commitOf(0))
+
+	close(release[0])
+	require.Eventually(t, func() bool { return broker.commitOf(0) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, 3, consumer.Stats().Committed)
+
+	cancel()
+	require.NoError(t, <-result)
+}
+
+func TestConsumer_PausesWhenSaturated(t *testing.T) {
+	broker := newMemoryBroker(messages(0, 8)...)
+	gate := make(chan struct{})
+	consumer := stream.NewConsumer(broker, func(ctx context.Context, msg stream.Message) error {
+		<-gate
+		return nil
+	}, stream.Config{MaxInFlight: 4, ResumeAt: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- consumer.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return consumer.Stats().Paused }, time.Second, time.Millisecond)
+	stats := consumer.Stats()
+	assert.Equal(t, 4, stats.InFlight, "no more than MaxInFlight messages are handled")
+	assert.Equal(t, 1, stats.Pauses)
+
+	close(gate)
+	require.Eventually(t, func() bool { return broker.commitOf(0) == 8 }, time.Second, time.Millisecond)
+	broker.mu.Lock()
+	assert.Equal(t, broker.pauses, broker.resumes)
+	broker.mu.Unlock()
+
+	cancel()
+	require.NoError(t, <-result)
+}
+
+func TestConsumer_DeadLetters(t *testing.T) {
+	broker := newMemoryBroker(messages(1, 3)...)
+	attempts := make(map[int64]int)
+	var mu sync.Mutex
+	consumer := stream.NewConsumer(broker, func(ctx context.Context, msg stream.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[msg.Offset]++
+		switch msg.Offset {
+		case 0:
+			return stream.Poison(errors.New("invalid JSON"))
+		case 1:
+			return errors.New("audit store unavailable")
+		}
+		return nil
+	}, stream.Config{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	run(t, consumer, func() bool { return broker.commitOf(1) == 3 })
+
+	mu.Lock()
+	assert.Equal(t, 1, attempts[0], "poison messages are not retried")
+	assert.Equal(t, 3, attempts[1])
+	mu.Unlock()
+
+	stats := consumer.Stats()
+	assert.Equal(t, 2, stats.DeadLettered)
+	assert.Equal(t, 2, stats.Retries)
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	require.Len(t, broker.published, 2)
+	for _, letter := range broker.published {
+		assert.Equal(t, stream.DefaultConfig().DeadLetterTopic, letter.Topic)
+		assert.Equal(t, "transactions", letter.Headers[stream.HeaderTopic])
+		assert.Equal(t, "1", letter.Headers[stream.HeaderPartition])
+	}
+	assert.Contains(t, broker.published[0].Headers[stream.HeaderReason], "invalid JSON")
+	assert.Equal(t, "3", broker.published[1].Headers[stream.HeaderAttempts])
+}
+
+func TestConsumer_StopsWhenCommitFails(t *testing.T) {
+	broker := &failingBroker{memoryBroker: newMemoryBroker(messages(0, 1)...)}
+	consumer := stream.NewConsumer(broker, func(ctx context.Context, msg stream.Message) error { return nil }, stream.Config{})
+
+	err := consumer.Run(context.Background())
+	assert.ErrorContains(t, err, "commit transactions/0@1")
+}
+
+type failingBroker struct {
+	*memoryBroker
+}
+
+func (b *failingBroker) Commit(context.Context, string, int32, int64) error {
+	return errors.New("coordinator unavailable")
+}
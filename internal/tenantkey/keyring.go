@@ -0,0 +1,124 @@
+// Package tenantkey encrypts tenant data at rest under a key of its own per
+// tenant, so that the data of one tenant cannot be read with the key of
+// another.
+//
+// Data is sealed with AES-256-GCM, the nonce first, and bound to its tenant
+// as additional data: relabeling sealed data as another tenant's fails to
+// open as surely as opening it with another key.
+package tenantkey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// DefaultTenant is the tenant of merchants outside any tenant
+const DefaultTenant = "default"
+
+// Keyring errors
+var (
+	ErrNoKey = errors.New("no encryption key for tenant")
+	// ErrUnreadable is returned when sealed data does not open with a key
+	ErrUnreadable = errors.New("sealed data does not open with the key")
+)
+
+// Sealed is data encrypted under the key of its tenant
+type Sealed struct {
+	Tenant string `json:"tenant"`
+	Data   []byte `json:"data"`
+}
+
+// Keyring holds the keys of the tenants. It is safe for concurrent use.
+type Keyring struct {
+	ciphers map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring of 32-byte keys by tenant
+func NewKeyring(keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{ciphers: make(map[string]cipher.AEAD, len(keys))}
+	for tenant, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key of tenant %s must be 32 bytes, got %d", tenant, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.ciphers[tenant], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// LoadFile reads a keyring from a JSON object of hex keys by tenant
+func LoadFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var encoded map[string]string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("invalid tenant keys: %w", err)
+	}
+	keys := make(map[string][]byte, len(encoded))
+	for tenant, value := range encoded {
+		if keys[tenant], err = hex.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("key of tenant %s is not hex: %w", tenant, err)
+		}
+	}
+	return NewKeyring(keys)
+}
+
+// Tenants returns the tenants with a key, sorted
+func (k *Keyring) Tenants() []string {
+	tenants := make([]string, 0, len(k.ciphers))
+	for tenant := range k.ciphers {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Seal encrypts data under the key of a tenant
+func (k *Keyring) Seal(tenant string, data []byte) (Sealed, error) {
+	aead, exists := k.ciphers[tenant]
+	if !exists {
+		return Sealed{}, fmt.Errorf("%w %s", ErrNoKey, tenant)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Sealed{}, err
+	}
+	return Sealed{Tenant: tenant, Data: aead.Seal(nonce, nonce, data, []byte(tenant))}, nil
+}
+
+// Open decrypts sealed data with the key of its tenant
+func (k *Keyring) Open(sealed Sealed) ([]byte, error) {
+	return k.OpenAs(sealed.Tenant, sealed)
+}
+
+// OpenAs decrypts sealed data with the key of a tenant, which fails with
+// ErrUnreadable unless the data is that tenant's
+func (k *Keyring) OpenAs(tenant string, sealed Sealed) ([]byte, error) {
+	aead, exists := k.ciphers[tenant]
+	if !exists {
+		return nil, fmt.Errorf("%w %s", ErrNoKey, tenant)
+	}
+	if len(sealed.Data) < aead.NonceSize() {
+		return nil, ErrUnreadable
+	}
+	nonce, data := sealed.Data[:aead.NonceSize()], sealed.Data[aead.NonceSize():]
+	opened, err := aead.Open(nil, nonce, data, []byte(sealed.Tenant))
+	if err != nil {
+		return nil, ErrUnreadable
+	}
+	return opened, nil
+}
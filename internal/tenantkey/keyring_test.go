@@ -0,0 +1,56 @@
+package tenantkey_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/tenantkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keyring(t *testing.T) *tenantkey.Keyring {
+	keys, err := tenantkey.NewKeyring(map[string][]byte{
+		"bank-a": bytes.Repeat([]byte{1}, 32),
+		"bank-b": bytes.Repeat([]byte{2}, 32),
+	})
+	require.NoError(t, err)
+	return keys
+}
+
+func TestKeyring_SealsPerTenant(t *testing.T) {
+	keys := keyring(t)
+	sealed, err := keys.Seal("bank-a", []byte("decision"))
+	require.NoError(t, err)
+	assert.Equal(t, "bank-a", sealed.Tenant)
+	assert.NotContains(t, string(sealed.Data), "decision")
+
+	opened, err := keys.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "decision", string(opened))
+
+	_, err = keys.OpenAs("bank-b", sealed)
+	assert.ErrorIs(t, err, tenantkey.ErrUnreadable)
+	_, err = keys.Open(tenantkey.Sealed{Tenant: "bank-b", Data: sealed.Data})
+	assert.ErrorIs(t, err, tenantkey.ErrUnreadable, "relabeled data must not open")
+
+	_, err = keys.Seal("bank-c", []byte("decision"))
+	assert.ErrorIs(t, err, tenantkey.ErrNoKey)
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"default": "0000000000000000000000000000000000000000000000000000000000000000",
+		"bank-a": "1111111111111111111111111111111111111111111111111111111111111111"
+	}`), 0o600))
+	keys, err := tenantkey.LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bank-a", "default"}, keys.Tenants())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"bank-a": "0011"}`), 0o600))
+	_, err = tenantkey.LoadFile(path)
+	assert.Error(t, err)
+}
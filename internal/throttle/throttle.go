@@ -0,0 +1,369 @@
+// Package throttle limits merchants whose decline rate spikes above their
+// baseline, a sign their checkout or credentials may be compromised, such as
+// by a card testing attack. A merchant under a spike first gets friction: its
+// approvals are soft-declined for step-up authentication. A larger spike
+// throttles it: analyses beyond a fixed rate are rejected. Both relax once
+// the decline rate has been back near the baseline for a cooldown.
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Modes of a merchant
+const (
+	ModeNormal    = "normal"
+	ModeFriction  = "friction"
+	ModeThrottled = "throttled"
+)
+
+var severity = map[string]int{ModeNormal: 0, ModeFriction: 1, ModeThrottled: 2}
+
+// Config holds the limiter settings. The recent decline rate is that of the
+// decisions of the last Window, compared once there are MinDecisions of
+// them; the baseline is the decline rate of a merchant's earlier decisions
+// decayed with BaselineHalfLife, and at least BaselineFloor so that
+// merchants without declines are not limited for their first.
+type Config struct {
+	Window           time.Duration
+	MinDecisions     int
+	BaselineHalfLife time.Duration
+	BaselineFloor    float64
+	// FrictionFactor and ThrottleFactor are the multiples of the baseline
+	// the recent rate must reach to add friction or throttle
+	FrictionFactor float64
+	ThrottleFactor float64
+	// RelaxFactor is the multiple of the baseline the recent rate must stay
+	// below for Cooldown before a merchant returns to normal; a throttled
+	// merchant below ThrottleFactor that long steps down to friction
+	RelaxFactor float64
+	Cooldown    time.Duration
+	// ThrottleRate is the analyses per minute a throttled merchant is allowed
+	ThrottleRate int
+}
+
+// DefaultConfig returns the default limiter settings
+func DefaultConfig() Config {
+	return Config{
+		Window:           10 * time.Minute,
+		MinDecisions:     20,
+		BaselineHalfLife: 24 * time.Hour,
+		BaselineFloor:    0.02,
+		FrictionFactor:   3,
+		ThrottleFactor:   6,
+		RelaxFactor:      1.5,
+		Cooldown:         15 * time.Minute,
+		ThrottleRate:     60,
+	}
+}
+
+// Validate checks that the factors escalate from relaxing to throttling
+func (c Config) Validate() error {
+	switch {
+	case c.Window <= 0 || c.BaselineHalfLife <= 0:
+		return fmt.Errorf("window and baseline half-life must be positive")
+	case c.BaselineFloor <= 0 || c.BaselineFloor >= 1:
+		return fmt.Errorf("baseline floor %.2f must be within (0, 1)", c.BaselineFloor)
+	case c.RelaxFactor < 1 || c.FrictionFactor <= c.RelaxFactor || c.ThrottleFactor < c.FrictionFactor:
+		return fmt.Errorf("factors must satisfy 1 <= relax (%.2f) < friction (%.2f) <= throttle (%.2f)", c.RelaxFactor, c.FrictionFactor, c.ThrottleFactor)
+	case c.ThrottleRate <= 0:
+		return fmt.Errorf("throttle rate must be positive")
+	}
+	return nil
+}
+
+// Status is the state of a merchant
+type Status struct {
+	MerchantID string    `json:"merchant_id"`
+	Mode       string    `json:"mode"`
+	Since      time.Time `json:"since" doc:"When the merchant entered the mode"`
+	// Decisions and RecentRate are the decisions of the window and the
+	// share of them declined
+	Decisions  int     `json:"decisions"`
+	RecentRate float64 `json:"recent_rate"`
+	Baseline   float64 `json:"baseline"`
+	// Rejected counts the analyses rejected since the merchant was throttled
+	Rejected int `json:"rejected,omitempty"`
+}
+
+// bucket counts the decisions of a slice of the window
+type bucket struct {
+	start     time.Time
+	decisions int
+	declined  int
+}
+
+type merchant struct {
+	mode    string
+	since   time.Time
+	buckets []bucket
+	// baseDecisions and baseDeclined are the decayed counts of the decisions
+	// before the window, as of baseAt
+	baseDecisions float64
+	baseDeclined  float64
+	baseAt        time.Time
+	// calmSince is when the recent rate last fell below the mode's, zero
+	// while it is not
+	calmSince time.Time
+	tokens    float64
+	tokensAt  time.Time
+	rejected  int
+}
+
+// Limiter tracks the decline rate of every merchant
+type Limiter struct {
+	config    Config
+	slice     time.Duration
+	merchants map[string]*merchant
+	// onChange is told of every change of mode
+	onChange func(merchantID, from, to string)
+	mu       sync.Mutex
+}
+
+// New creates a limiter
+func New(config Config) (*Limiter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Limiter{
+		config:    config,
+		slice:     config.Window / 10,
+		merchants: make(map[string]*merchant),
+	}, nil
+}
+
+// OnChange sets the function told of every change of mode
+func (l *Limiter) OnChange(fn func(merchantID, from, to string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onChange = fn
+}
+
+// Observe counts a decision of a merchant, declined or not, and returns the
+// mode of the merchant after it
+func (l *Limiter) Observe(merchantID string, declined bool, at time.Time) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := l.merchant(merchantID, at)
+	l.roll(m, at)
+	if n := len(m.buckets); n == 0 || !at.Before(m.buckets[n-1].start.Add(l.slice)) {
+		m.buckets = append(m.buckets, bucket{start: at.Truncate(l.slice)})
+	}
+	current := &m.buckets[len(m.buckets)-1]
+	current.decisions++
+	if declined {
+		current.declined++
+	}
+	l.evaluate(merchantID, m, at)
+	return m.mode
+}
+
+// Allow reports whether n analyses of a merchant may proceed now, with its
+// mode. Only throttled merchants are refused, once they have used up their
+// rate.
+func (l *Limiter) Allow(merchantID string, n int, now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, exists := l.merchants[merchantID]
+	if !exists {
+		return ModeNormal, true
+	}
+	l.roll(m, now)
+	l.evaluate(merchantID, m, now)
+	if m.mode != ModeThrottled {
+		return m.mode, true
+	}
+
+	rate := float64(l.config.ThrottleRate)
+	m.tokens = math.Min(rate, m.tokens+now.Sub(m.tokensAt).Minutes()*rate)
+	m.tokensAt = now
+	if m.tokens < float64(n) {
+		m.rejected += n
+		return m.mode, false
+	}
+	m.tokens -= float64(n)
+	return m.mode, true
+}
+
+// RetryAfter is how long a throttled merchant waits for room for n analyses
+func (l *Limiter) RetryAfter(n int) time.Duration {
+	return time.Duration(float64(n) / float64(l.config.ThrottleRate) * float64(time.Minute))
+}
+
+// Status returns the state of a merchant as of now
+func (l *Limiter) Status(merchantID string, now time.Time) (Status, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, exists := l.merchants[merchantID]
+	if !exists {
+		return Status{}, false
+	}
+	l.roll(m, now)
+	l.evaluate(merchantID, m, now)
+	return l.status(merchantID, m, now), true
+}
+
+// List returns the state of the merchants in a mode, or of every merchant
+// when it is empty, the most limited first
+func (l *Limiter) List(mode string, now time.Time) []Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	statuses := []Status{}
+	for id, m := range l.merchants {
+		l.roll(m, now)
+		l.evaluate(id, m, now)
+		if mode == "" || m.mode == mode {
+			statuses = append(statuses, l.status(id, m, now))
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if severity[statuses[i].Mode] != severity[statuses[j].Mode] {
+			return severity[statuses[i].Mode] > severity[statuses[j].Mode]
+		}
+		return statuses[i].MerchantID < statuses[j].MerchantID
+	})
+	return statuses
+}
+
+// Reset returns a merchant to normal, as when an analyst has confirmed the
+// spike is legitimate. The merchant is limited again if the spike goes on.
+func (l *Limiter) Reset(merchantID string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, exists := l.merchants[merchantID]
+	if !exists {
+		return false
+	}
+	m.buckets = nil
+	l.setMode(merchantID, m, ModeNormal, now)
+	return true
+}
+
+// merchant returns the state of a merchant, creating it. Callers must hold
+// the lock.
+func (l *Limiter) merchant(merchantID string, now time.Time) *merchant {
+	m, exists := l.merchants[merchantID]
+	if !exists {
+		m = &merchant{mode: ModeNormal, since: now, baseAt: now}
+		l.merchants[merchantID] = m
+	}
+	return m
+}
+
+// roll moves the buckets that fell out of the window into the baseline, so
+// a spike only weighs on the baseline once it is past. Callers must hold the
+// lock.
+func (l *Limiter) roll(m *merchant, now time.Time) {
+	cutoff := now.Add(-l.config.Window)
+	drop := 0
+	for drop < len(m.buckets) && !m.buckets[drop].start.Add(l.slice).After(cutoff) {
+		b := m.buckets[drop]
+		l.decay(m, b.start.Add(l.slice))
+		m.baseDecisions += float64(b.decisions)
+		m.baseDeclined += float64(b.declined)
+		drop++
+	}
+	m.buckets = m.buckets[drop:]
+}
+
+// decay ages the baseline counts to now. Callers must hold the lock.
+func (l *Limiter) decay(m *merchant, now time.Time) {
+	if elapsed := now.Sub(m.baseAt); elapsed > 0 {
+		factor := math.Exp2(-elapsed.Hours() / l.config.BaselineHalfLife.Hours())
+		m.baseDecisions *= factor
+		m.baseDeclined *= factor
+		m.baseAt = now
+	}
+}
+
+func (l *Limiter) recent(m *merchant) (int, float64) {
+	decisions, declined := 0, 0
+	for _, b := range m.buckets {
+		decisions += b.decisions
+		declined += b.declined
+	}
+	if decisions == 0 {
+		return 0, 0
+	}
+	return decisions, float64(declined) / float64(decisions)
+}
+
+func (l *Limiter) baseline(m *merchant) float64 {
+	if m.baseDecisions == 0 {
+		return l.config.BaselineFloor
+	}
+	return math.Max(l.config.BaselineFloor, m.baseDeclined/m.baseDecisions)
+}
+
+// evaluate escalates a merchant as soon as its recent rate calls for it and
+// relaxes it once the rate has been lower for the cooldown. Too few recent
+// decisions count as calm. Callers must hold the lock.
+func (l *Limiter) evaluate(merchantID string, m *merchant, now time.Time) {
+	decisions, rate := l.recent(m)
+	baseline := l.baseline(m)
+	target := ModeNormal
+	if decisions >= l.config.MinDecisions {
+		switch {
+		case rate >= l.config.ThrottleFactor*baseline:
+			target = ModeThrottled
+		case rate >= l.config.FrictionFactor*baseline:
+			target = ModeFriction
+		case m.mode != ModeNormal && rate >= l.config.RelaxFactor*baseline:
+			// Between relaxing and friction, a limited merchant keeps friction
+			target = ModeFriction
+		}
+	}
+
+	switch {
+	case severity[target] > severity[m.mode]:
+		l.setMode(merchantID, m, target, now)
+	case severity[target] == severity[m.mode]:
+		m.calmSince = time.Time{}
+	case m.calmSince.IsZero():
+		m.calmSince = now
+	case now.Sub(m.calmSince) >= l.config.Cooldown:
+		l.setMode(merchantID, m, target, now)
+	}
+}
+
+// setMode changes the mode of a merchant. Callers must hold the lock.
+func (l *Limiter) setMode(merchantID string, m *merchant, mode string, now time.Time) {
+	from := m.mode
+	m.mode = mode
+	m.since = now
+	m.calmSince = time.Time{}
+	if mode == ModeThrottled {
+		m.tokens = float64(l.config.ThrottleRate)
+		m.tokensAt = now
+		m.rejected = 0
+	}
+	if from != mode && l.onChange != nil {
+		l.onChange(merchantID, from, mode)
+	}
+}
+
+func (l *Limiter) status(merchantID string, m *merchant, now time.Time) Status {
+	l.decay(m, now)
+	decisions, rate := l.recent(m)
+	status := Status{
+		MerchantID: merchantID,
+		Mode:       m.mode,
+		Since:      m.since,
+		Decisions:  decisions,
+		RecentRate: rate,
+		Baseline:   l.baseline(m),
+	}
+	if m.mode == ModeThrottled {
+		status.Rejected = m.rejected
+	}
+	return status
+}
@@ -0,0 +1,125 @@
+package throttle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+// observe counts n decisions of a merchant a second apart from at, declined
+// of them spread evenly declined, and returns the time after the last
+func observe(l *throttle.Limiter, merchantID string, at time.Time, n, declined int) time.Time {
+	for i := 0; i < n; i++ {
+		l.Observe(merchantID, (i+1)*declined/n > i*declined/n, at)
+		at = at.Add(time.Second)
+	}
+	return at
+}
+
+func TestLimiter_EscalatesOnSpikeAndRelaxes(t *testing.T) {
+	limiter, err := throttle.New(throttle.DefaultConfig())
+	require.NoError(t, err)
+	var changes []string
+	limiter.OnChange(func(merchantID, from, to string) { changes = append(changes, merchantID+":"+from+">"+to) })
+
+	// An hour of 1% declines, then 3 minutes of 10%
+	at := start
+	for i := 0; i < 6; i++ {
+		at = observe(limiter, "MER-1", at, 500, 5)
+		at = at.Add(2 * time.Minute)
+	}
+	status, exists := limiter.Status("MER-1", at)
+	require.True(t, exists)
+	assert.Equal(t, throttle.ModeNormal, status.Mode)
+	assert.Equal(t, 0.02, status.Baseline, "the floor applies to merchants declining less")
+
+	at = at.Add(20 * time.Minute)
+	at = observe(limiter, "MER-1", at, 100, 10)
+	status, _ = limiter.Status("MER-1", at)
+	assert.Equal(t, throttle.ModeFriction, status.Mode)
+	assert.InDelta(t, 0.1, status.RecentRate, 0.001)
+
+	// A card testing run declines most analyses
+	at = observe(limiter, "MER-1", at, 100, 90)
+	mode, allowed := limiter.Allow("MER-1", 1, at)
+	assert.Equal(t, throttle.ModeThrottled, mode)
+	assert.True(t, allowed)
+	mode, allowed = limiter.Allow("MER-1", 100, at)
+	assert.False(t, allowed, "beyond the throttle rate")
+	assert.Equal(t, time.Minute, limiter.RetryAfter(60))
+	status, _ = limiter.Status("MER-1", at)
+	assert.Equal(t, 100, status.Rejected)
+
+	// The spike leaves the window, and the merchant relaxes after the cooldown
+	at = at.Add(11 * time.Minute)
+	mode, _ = limiter.Allow("MER-1", 1, at)
+	assert.Equal(t, throttle.ModeThrottled, mode, "the cooldown starts")
+	at = at.Add(14 * time.Minute)
+	mode, _ = limiter.Allow("MER-1", 1, at)
+	assert.Equal(t, throttle.ModeThrottled, mode)
+	at = at.Add(time.Minute)
+	mode, _ = limiter.Allow("MER-1", 1, at)
+	assert.Equal(t, throttle.ModeNormal, mode)
+
+	assert.Equal(t, []string{"MER-1:normal>friction", "MER-1:friction>throttled", "MER-1:throttled>normal"}, changes)
+}
+
+func TestLimiter_JudgesMerchantsAgainstTheirOwnBaseline(t *testing.T) {
+	limiter, err := throttle.New(throttle.DefaultConfig())
+	require.NoError(t, err)
+
+	// MER-HIGH always declines a fifth, MER-LOW nothing
+	at := start
+	for i := 0; i < 4; i++ {
+		observe(limiter, "MER-HIGH", at, 100, 20)
+		observe(limiter, "MER-LOW", at, 100, 0)
+		at = at.Add(10 * time.Minute)
+	}
+	observe(limiter, "MER-HIGH", at, 100, 30)
+	observe(limiter, "MER-LOW", at, 100, 30)
+
+	statuses := limiter.List("", at.Add(time.Minute))
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "MER-LOW", statuses[0].MerchantID, "the most limited first")
+	assert.Equal(t, throttle.ModeThrottled, statuses[0].Mode)
+	assert.Equal(t, throttle.ModeNormal, statuses[1].Mode)
+	assert.InDelta(t, 0.2, statuses[1].Baseline, 0.01)
+
+	assert.Len(t, limiter.List(throttle.ModeFriction, at), 0)
+	assert.True(t, limiter.Reset("MER-LOW", at))
+	mode, allowed := limiter.Allow("MER-LOW", 1000, at)
+	assert.Equal(t, throttle.ModeNormal, mode)
+	assert.True(t, allowed)
+	assert.False(t, limiter.Reset("MER-NONE", at))
+}
+
+func TestLimiter_NeedsEnoughDecisions(t *testing.T) {
+	limiter, err := throttle.New(throttle.DefaultConfig())
+	require.NoError(t, err)
+
+	observe(limiter, "MER-1", start, 19, 19)
+	mode, allowed := limiter.Allow("MER-1", 1, start.Add(time.Minute))
+	assert.Equal(t, throttle.ModeNormal, mode)
+	assert.True(t, allowed)
+
+	mode, _ = limiter.Allow("MER-2", 1, start)
+	assert.Equal(t, throttle.ModeNormal, mode, "unknown merchants are not limited")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, throttle.DefaultConfig().Validate())
+
+	config := throttle.DefaultConfig()
+	config.FrictionFactor = 1.2
+	assert.Error(t, config.Validate())
+
+	config = throttle.DefaultConfig()
+	config.ThrottleRate = 0
+	_, err := throttle.New(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,250 @@
+// Package wasm runs custom scoring modules compiled to WebAssembly, each
+// sandboxed with its own memory limit and a deadline per call.
+//
+// A module exports its memory and two functions:
+//
+//	alloc(size i32) i32          returns a buffer of size bytes for the input
+//	score(ptr i32, size i32) i64 scores the transaction JSON in the buffer
+//
+// score returns the address of a JSON result in the upper 32 bits and its
+// length in the lower 32 bits. The result is a detector.ExternalResult:
+// {"score": 0.4, "reasons": ["..."], "codes": ["..."]}. Modules may import
+// WASI (wasi_snapshot_preview1) but get no files, environment or network.
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+)
+
+// pageSize is the size of a WebAssembly memory page
+const pageSize = 64 << 10
+
+// Limits bound what each module may use
+type Limits struct {
+	// Timeout is the deadline of one score call
+	Timeout time.Duration
+	// MemoryBytes caps the linear memory of each instance
+	MemoryBytes uint32
+	// Instances is the number of instances kept to score concurrently
+	Instances int
+}
+
+// DefaultLimits returns the default module limits
+func DefaultLimits() Limits {
+	return Limits{
+		Timeout:     20 * time.Millisecond,
+		MemoryBytes: 16 << 20,
+		Instances:   4,
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	defaults := DefaultLimits()
+	if l.Timeout <= 0 {
+		l.Timeout = defaults.Timeout
+	}
+	if l.MemoryBytes < pageSize {
+		l.MemoryBytes = defaults.MemoryBytes
+	}
+	if l.Instances <= 0 {
+		l.Instances = defaults.Instances
+	}
+	return l
+}
+
+// Module is a compiled scoring module. It implements detector.ExternalScorer.
+type Module struct {
+	name     string
+	limits   Limits
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	// pool holds idle instances. Instances are single-threaded and are
+	// discarded after any failure, since a trap or timeout leaves them
+	// unusable.
+	pool chan api.Module
+}
+
+// Load compiles a module and checks its exports
+func Load(ctx context.Context, name string, binary []byte, limits Limits) (*Module, error) {
+	limits = limits.withDefaults()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(limits.MemoryBytes/pageSize).
+		WithCloseOnContextDone(true))
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("module %s: %w", name, err)
+	}
+	exports := compiled.ExportedFunctions()
+	for _, export := range []string{"alloc", "score"} {
+		if _, exists := exports[export]; !exists {
+			runtime.Close(ctx)
+			return nil, fmt.Errorf("module %s does not export %s", name, export)
+		}
+	}
+	if _, exists := compiled.ExportedMemories()["memory"]; !exists {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("module %s does not export memory", name)
+	}
+
+	m := &Module{
+		name:     name,
+		limits:   limits,
+		runtime:  runtime,
+		compiled: compiled,
+		pool:     make(chan api.Module, limits.Instances),
+	}
+	// Fail at load time on modules that cannot be instantiated
+	instance, err := m.instantiate(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("module %s: %w", name, err)
+	}
+	m.release(instance)
+	return m, nil
+}
+
+// LoadDir loads every .wasm file of a directory, named after the file
+func LoadDir(ctx context.Context, dir string, limits Limits) ([]*Module, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	modules := make([]*Module, 0, len(paths))
+	for _, path := range paths {
+		module, err := loadFile(ctx, path, limits)
+		if err != nil {
+			for _, loaded := range modules {
+				loaded.Close(ctx)
+			}
+			return nil, err
+		}
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
+
+func loadFile(ctx context.Context, path string, limits Limits) (*Module, error) {
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(ctx, strings.TrimSuffix(filepath.Base(path), ".wasm"), binary, limits)
+}
+
+// Name returns the module name
+func (m *Module) Name() string {
+	return m.name
+}
+
+func (m *Module) instantiate(ctx context.Context) (api.Module, error) {
+	// Reactor modules initialize with _initialize; WASI commands, which
+	// exit from _start, cannot be called afterwards and are not supported
+	return m.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+}
+
+// release returns an instance to the pool, or closes it when the pool is
+// full
+func (m *Module) release(instance api.Module) {
+	select {
+	case m.pool <- instance:
+	default:
+		instance.Close(context.Background())
+	}
+}
+
+// Score runs the module on a transaction within the time limit
+func (m *Module) Score(ctx context.Context, tx *detector.Transaction) (detector.ExternalResult, error) {
+	result, err := m.score(ctx, tx)
+	if err != nil {
+		err = fmt.Errorf("module %s: %w", m.name, err)
+		log.Printf("Scoring module failed: %v", err)
+	}
+	return result, err
+}
+
+func (m *Module) score(ctx context.Context, tx *detector.Transaction) (detector.ExternalResult, error) {
+	input, err := json.Marshal(tx)
+	if err != nil {
+		return detector.ExternalResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.limits.Timeout)
+	defer cancel()
+
+	var instance api.Module
+	select {
+	case instance = <-m.pool:
+	default:
+		if instance, err = m.instantiate(ctx); err != nil {
+			return detector.ExternalResult{}, err
+		}
+	}
+
+	result, err := call(ctx, instance, input)
+	if err != nil {
+		instance.Close(context.Background())
+		if ctx.Err() != nil {
+			return detector.ExternalResult{}, fmt.Errorf("exceeded the %s time limit", m.limits.Timeout)
+		}
+		return detector.ExternalResult{}, err
+	}
+	m.release(instance)
+	return result, nil
+}
+
+// call passes the input to an instance and decodes its result
+func call(ctx context.Context, instance api.Module, input []byte) (detector.ExternalResult, error) {
+	var result detector.ExternalResult
+
+	allocated, err := instance.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return result, fmt.Errorf("alloc: %w", err)
+	}
+	ptr := uint32(allocated[0])
+	if !instance.Memory().Write(ptr, input) {
+		return result, errors.New("alloc returned a buffer outside memory")
+	}
+
+	packed, err := instance.ExportedFunction("score").Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return result, fmt.Errorf("score: %w", err)
+	}
+	output, ok := instance.Memory().Read(uint32(packed[0]>>32), uint32(packed[0]))
+	if !ok {
+		return result, errors.New("score returned a result outside memory")
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return result, fmt.Errorf("invalid result: %w", err)
+	}
+	return result, nil
+}
+
+// Close releases the module's instances and compiled code
+func (m *Module) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
@@ -0,0 +1,130 @@
+package wasm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/detector"
+	"github.com/josuebarros1995/golang-fraud-detection/internal/wasm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const result = `{"score":0.4,"reasons":["Custom module finding"],"codes":["CUSTOM_FINDING"]}`
+
+func leb(value int64) []byte {
+	var out []byte
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	out := leb(int64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func section(id byte, content []byte) []byte {
+	return append(append([]byte{id}, leb(int64(len(content)))...), content...)
+}
+
+func name(s string) []byte {
+	return append(leb(int64(len(s))), s...)
+}
+
+func code(body ...byte) []byte {
+	function := append([]byte{0}, body...)
+	return append(leb(int64(len(function))), function...)
+}
+
+// assemble builds a module exporting memory with the given initial pages,
+// alloc returning address 1024 and score with the given body. result is
+// stored at address 16.
+func assemble(pages int64, scoreBody ...byte) []byte {
+	binary := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	binary = append(binary, section(1, vec(
+		[]byte{0x60, 1, 0x7f, 1, 0x7f},
+		[]byte{0x60, 2, 0x7f, 0x7f, 1, 0x7e},
+	))...)
+	binary = append(binary, section(3, vec([]byte{0}, []byte{1}))...)
+	binary = append(binary, section(5, vec(append([]byte{0x00}, leb(pages)...)))...)
+	binary = append(binary, section(7, vec(
+		append(name("memory"), 2, 0),
+		append(name("alloc"), 0, 0),
+		append(name("score"), 0, 1),
+	))...)
+	alloc := append(append([]byte{0x41}, leb(1024)...), 0x0b)
+	binary = append(binary, section(10, vec(code(alloc...), code(scoreBody...)))...)
+	return append(binary, section(11, vec(append([]byte{0x00, 0x41, 16, 0x0b}, name(result)...)))...)
+}
+
+// staticScore returns the stored result
+var staticScore = append(append([]byte{0x42}, leb(16<<32|int64(len(result)))...), 0x0b)
+
+// loopScore never returns
+var loopScore = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b}
+
+func TestModule_Score(t *testing.T) {
+	ctx := context.Background()
+	module, err := wasm.Load(ctx, "custom", assemble(1, staticScore...), wasm.DefaultLimits())
+	require.NoError(t, err)
+	defer module.Close(ctx)
+
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.AddExternalScorer(module)
+	for i := 0; i < 3; i++ {
+		score, err := d.Analyze(ctx, &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 42, Timestamp: time.Now()})
+		require.NoError(t, err)
+		assert.Contains(t, score.ReasonCodes, "CUSTOM_FINDING")
+		assert.Contains(t, score.Reasons, "Custom module finding")
+	}
+}
+
+func TestModule_Limits(t *testing.T) {
+	ctx := context.Background()
+
+	module, err := wasm.Load(ctx, "loop", assemble(1, loopScore...), wasm.Limits{Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer module.Close(ctx)
+	start := time.Now()
+	_, err = module.Score(ctx, &detector.Transaction{ID: "TXN-1"})
+	assert.ErrorContains(t, err, "time limit")
+	assert.Less(t, time.Since(start), time.Second)
+
+	d := detector.NewDetector(detector.DefaultConfig())
+	d.AddExternalScorer(module)
+	score, err := d.Analyze(ctx, &detector.Transaction{ID: "TXN-1", AccountID: "ACC-1", Amount: 42, Timestamp: time.Now()})
+	require.NoError(t, err, "failing modules add nothing")
+	assert.NotContains(t, score.ReasonCodes, "CUSTOM_FINDING")
+
+	// 64 pages are 4MB
+	_, err = wasm.Load(ctx, "large", assemble(64, staticScore...), wasm.Limits{MemoryBytes: 1 << 20})
+	assert.Error(t, err)
+}
+
+func TestLoadDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "custom.wasm"), assemble(1, staticScore...), 0o644))
+
+	modules, err := wasm.LoadDir(ctx, dir, wasm.DefaultLimits())
+	require.NoError(t, err)
+	require.Len(t, modules, 1)
+	assert.Equal(t, "custom", modules[0].Name())
+	modules[0].Close(ctx)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.wasm"), []byte("not wasm"), 0o644))
+	_, err = wasm.LoadDir(ctx, dir, wasm.DefaultLimits())
+	assert.ErrorContains(t, err, "broken")
+}
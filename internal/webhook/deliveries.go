@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// Delivery statuses
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+	// StatusDropped events were never attempted, the queue being full
+	StatusDropped = "dropped"
+)
+
+// Delivery is the outcome of delivering an event
+type Delivery struct {
+	EventID       string    `json:"event_id"`
+	TransactionID string    `json:"transaction_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	Error         string    `json:"error,omitempty"`
+	// Replay is set on deliveries of replayed events
+	Replay bool      `json:"replay,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// DeliveryLog keeps the latest deliveries of a webhook
+type DeliveryLog struct {
+	entries []Delivery
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+// NewDeliveryLog creates a log of the last size deliveries
+func NewDeliveryLog(size int) *DeliveryLog {
+	if size <= 0 {
+		size = DefaultConfig().LogSize
+	}
+	return &DeliveryLog{entries: make([]Delivery, size)}
+}
+
+func (l *DeliveryLog) record(delivery Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = delivery
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// List returns the deliveries made within [since, until), newest first and
+// at most limit of them. Zero bounds, an empty status and a limit of zero
+// filter nothing.
+func (l *DeliveryLog) List(since, until time.Time, status string, limit int) []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	deliveries := []Delivery{}
+	for i := 1; i <= count; i++ {
+		delivery := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		if !since.IsZero() && delivery.At.Before(since) ||
+			!until.IsZero() && !delivery.At.Before(until) ||
+			status != "" && delivery.Status != status {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+		if limit > 0 && len(deliveries) == limit {
+			break
+		}
+	}
+	return deliveries
+}
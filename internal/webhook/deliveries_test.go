@@ -0,0 +1,126 @@
+package webhook_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSender_LogsDeliveriesAndReplays(t *testing.T) {
+	var mu sync.Mutex
+	var replays []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		replays = append(replays, r.Header.Get(webhook.ReplayHeader))
+	}))
+	defer server.Close()
+
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", Backoff: time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, sender.Send(event("TX-1")))
+	require.NoError(t, sender.Replay(context.Background(), event("TX-1")))
+	sender.Close()
+
+	deliveries := sender.Deliveries().List(time.Time{}, time.Time{}, "", 0)
+	require.Len(t, deliveries, 2)
+	assert.True(t, deliveries[0].Replay, "newest first")
+	assert.False(t, deliveries[1].Replay)
+	for _, delivery := range deliveries {
+		assert.Equal(t, "TX-1", delivery.EventID)
+		assert.Equal(t, webhook.StatusDelivered, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"", "true"}, replays)
+
+	assert.ErrorIs(t, sender.Replay(context.Background(), event("TX-2")), webhook.ErrClosed)
+}
+
+func TestSender_LogsFailedAndDroppedDeliveries(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", QueueSize: 1, MaxAttempts: 1})
+	require.NoError(t, err)
+	sender.Send(event("TX-1"))
+	// TX-1 is being delivered or queued; fill the queue until one is dropped
+	dropped := false
+	for i := 0; i < 3 && !dropped; i++ {
+		dropped = !sender.Send(event("TX-2"))
+	}
+	require.True(t, dropped)
+	close(block)
+	sender.Close()
+
+	failed := sender.Deliveries().List(time.Time{}, time.Time{}, webhook.StatusFailed, 0)
+	require.NotEmpty(t, failed)
+	assert.Contains(t, failed[0].Error, "400")
+	assert.Len(t, sender.Deliveries().List(time.Time{}, time.Time{}, webhook.StatusDropped, 1), 1)
+}
+
+func TestSender_ReplayWaitsForRoom(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer server.Close()
+	defer close(block)
+
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", QueueSize: 1})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var replayErr error
+	for i := 0; i < 3 && replayErr == nil; i++ {
+		replayErr = sender.Replay(ctx, event("TX-1"))
+	}
+	assert.ErrorIs(t, replayErr, context.DeadlineExceeded)
+}
+
+func TestDeliveryLog_KeepsLatest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", LogSize: 2})
+	require.NoError(t, err)
+	for _, id := range []string{"TX-1", "TX-2", "TX-3"} {
+		sender.Send(event(id))
+	}
+	sender.Close()
+
+	deliveries := sender.Deliveries().List(time.Time{}, time.Time{}, "", 0)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "TX-3", deliveries[0].EventID)
+	assert.Equal(t, "TX-2", deliveries[1].EventID)
+	assert.Empty(t, sender.Deliveries().List(time.Now().Add(time.Minute), time.Time{}, "", 0))
+}
+
+func TestRouter_KeepsLogWhenWebhookReplaced(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	router := webhook.NewRouter(webhook.DefaultConfig())
+	require.NoError(t, router.Set("MER-1", server.URL, "s3cret", nil))
+	first, _ := router.Sender("MER-1")
+	require.NoError(t, router.Set("MER-1", server.URL, "other", nil))
+	second, exists := router.Sender("MER-1")
+	require.True(t, exists)
+	assert.Same(t, first.Deliveries(), second.Deliveries())
+
+	router.Remove("MER-1")
+	_, exists = router.Sender("MER-1")
+	assert.False(t, exists)
+	router.Close()
+}
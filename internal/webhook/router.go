@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"crypto"
+	"sync"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// Router delivers the decision events of each merchant to the webhook the
+// merchant registered, with a sender of its own so that a slow endpoint
+// only delays its merchant's events
+type Router struct {
+	// config holds the delivery settings; URL and Secret are per merchant
+	config  Config
+	senders map[string]*Sender
+	// logs are the delivery logs of the merchants, kept when a merchant
+	// replaces its webhook
+	logs map[string]*DeliveryLog
+	mu   sync.RWMutex
+}
+
+// NewRouter creates a router delivering with the given settings
+func NewRouter(config Config) *Router {
+	return &Router{
+		config:  config,
+		senders: make(map[string]*Sender),
+		logs:    make(map[string]*DeliveryLog),
+	}
+}
+
+// Set registers or replaces the webhook of a merchant, encrypting its
+// deliveries to key unless it is nil. A replaced webhook still delivers the
+// events it has queued.
+func (r *Router) Set(merchantID, url, secret string, key crypto.PublicKey) error {
+	config := r.config
+	config.URL = url
+	config.Secret = secret
+	config.EncryptionKey = key
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deliveries, exists := r.logs[merchantID]
+	if !exists {
+		deliveries = NewDeliveryLog(config.LogSize)
+	}
+	config.Deliveries = deliveries
+	sender, err := NewSender(config)
+	if err != nil {
+		return err
+	}
+	previous := r.senders[merchantID]
+	r.senders[merchantID] = sender
+	r.logs[merchantID] = deliveries
+
+	if previous != nil {
+		go previous.Close()
+	}
+	return nil
+}
+
+// Remove unregisters the webhook of a merchant, reporting whether it had one
+func (r *Router) Remove(merchantID string) bool {
+	r.mu.Lock()
+	sender, exists := r.senders[merchantID]
+	delete(r.senders, merchantID)
+	delete(r.logs, merchantID)
+	r.mu.Unlock()
+
+	if exists {
+		go sender.Close()
+	}
+	return exists
+}
+
+// URL returns the webhook URL of a merchant
+func (r *Router) URL(merchantID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sender, exists := r.senders[merchantID]
+	if !exists {
+		return "", false
+	}
+	return sender.config.URL, true
+}
+
+// Sender returns the sender of a merchant's webhook
+func (r *Router) Sender(merchantID string) (*Sender, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sender, exists := r.senders[merchantID]
+	return sender, exists
+}
+
+// Encrypted reports whether the webhook of a merchant receives encrypted
+// deliveries
+func (r *Router) Encrypted(merchantID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sender, exists := r.senders[merchantID]
+	return exists && sender.config.EncryptionKey != nil
+}
+
+// Send queues an event for the webhook of a merchant. It returns false when
+// the merchant's queue is full and the event was dropped; events of
+// merchants without a webhook are ignored.
+func (r *Router) Send(merchantID string, event *events.DecisionEvent) bool {
+	r.mu.RLock()
+	sender, exists := r.senders[merchantID]
+	r.mu.RUnlock()
+	if !exists {
+		return true
+	}
+	return sender.Send(event)
+}
+
+// Close delivers the queued events of every merchant and stops the senders
+func (r *Router) Close() {
+	r.mu.Lock()
+	senders := r.senders
+	r.senders = make(map[string]*Sender)
+	r.mu.Unlock()
+
+	for _, sender := range senders {
+		sender.Close()
+	}
+}
@@ -0,0 +1,300 @@
+// Package webhook delivers decision events to an HTTP endpoint. Deliveries
+// are asynchronous, retried with backoff and signed with HMAC-SHA256.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+)
+
+// SignatureHeader carries the signature of each delivery, see events.Sign
+const SignatureHeader = events.SignatureHeader
+
+// Config holds webhook delivery settings
+type Config struct {
+	URL    string
+	Secret string
+	// EncryptionKey, when set, is the public key bodies are encrypted to as a
+	// compact JWE before they are signed
+	EncryptionKey crypto.PublicKey
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+	// MaxAttempts includes the first delivery
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each retry
+	Backoff time.Duration
+	// QueueSize bounds the undelivered events; newer events are dropped when
+	// it is full
+	QueueSize int
+	// LogSize is the number of deliveries the delivery log keeps
+	LogSize int
+	// Deliveries is the delivery log, created when nil; a webhook replaced
+	// keeps the log of its predecessor
+	Deliveries *DeliveryLog
+}
+
+// DefaultConfig returns the default delivery settings
+func DefaultConfig() Config {
+	return Config{
+		Timeout:     5 * time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		QueueSize:   1000,
+		LogSize:     1000,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.Timeout <= 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaults.MaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaults.Backoff
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaults.QueueSize
+	}
+	if c.LogSize <= 0 {
+		c.LogSize = defaults.LogSize
+	}
+	if c.Deliveries == nil {
+		c.Deliveries = NewDeliveryLog(c.LogSize)
+	}
+	return c
+}
+
+// ReplayHeader is set on the deliveries of replayed events, which carry the
+// event ID of their first delivery
+const ReplayHeader = "X-Fraud-Replay"
+
+// ErrClosed is returned when replaying to a sender that was closed, such as
+// the webhook of a merchant that replaced or removed it
+var ErrClosed = errors.New("webhook sender closed")
+
+// RequestFunc builds the request delivering an event. It is called for each
+// attempt.
+type RequestFunc func(event *events.DecisionEvent) (*http.Request, error)
+
+// Sender delivers decision events to a webhook
+type Sender struct {
+	config Config
+	client *http.Client
+	build  RequestFunc
+	queue  chan queued
+	wg     sync.WaitGroup
+	// closing stops new events before the queue is closed; mu is held by
+	// the sends in progress
+	closing chan struct{}
+	mu      sync.RWMutex
+}
+
+// queued is an event waiting for delivery
+type queued struct {
+	event  *events.DecisionEvent
+	replay bool
+}
+
+// NewSender validates the configuration and starts delivering
+func NewSender(config Config) (*Sender, error) {
+	config = config.withDefaults()
+	target, err := url.Parse(config.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q", config.URL)
+	}
+	if config.Secret == "" {
+		return nil, errors.New("webhook secret is required")
+	}
+
+	if config.EncryptionKey != nil {
+		if err := events.CheckEncryptionKey(config.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewRequestSender(config, signedRequest(config.URL, config.Secret, config.EncryptionKey)), nil
+}
+
+// NewRequestSender starts delivering events with the requests build returns,
+// with the timeout, retry and queue settings of config; its URL and Secret
+// are not used
+func NewRequestSender(config Config, build RequestFunc) *Sender {
+	config = config.withDefaults()
+	s := &Sender{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		build:   build,
+		queue:   make(chan queued, config.QueueSize),
+		closing: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Send queues an event for delivery. It returns false when the queue is full
+// and the event was dropped.
+func (s *Sender) Send(event *events.DecisionEvent) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case <-s.closing:
+	case s.queue <- queued{event: event}:
+		return true
+	default:
+	}
+	s.config.Deliveries.record(Delivery{
+		EventID:       event.EventID,
+		TransactionID: event.TransactionID,
+		OccurredAt:    event.OccurredAt,
+		Status:        StatusDropped,
+		At:            time.Now(),
+	})
+	return false
+}
+
+// Replay queues an event delivered before for delivery again, with the
+// ReplayHeader set. It waits for room in the queue rather than dropping the
+// event.
+func (s *Sender) Replay(ctx context.Context, event *events.DecisionEvent) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case <-s.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.queue <- queued{event: event, replay: true}:
+		return nil
+	case <-s.closing:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Deliveries returns the delivery log of the sender
+func (s *Sender) Deliveries() *DeliveryLog {
+	return s.config.Deliveries
+}
+
+// Close delivers the queued events and stops the sender
+func (s *Sender) Close() {
+	close(s.closing)
+	s.mu.Lock()
+	close(s.queue)
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Sender) run() {
+	defer s.wg.Done()
+	for item := range s.queue {
+		attempts, err := s.deliver(item)
+		delivery := Delivery{
+			EventID:       item.event.EventID,
+			TransactionID: item.event.TransactionID,
+			OccurredAt:    item.event.OccurredAt,
+			Status:        StatusDelivered,
+			Attempts:      attempts,
+			Replay:        item.replay,
+			At:            time.Now(),
+		}
+		if err != nil {
+			delivery.Status = StatusFailed
+			delivery.Error = err.Error()
+			log.Printf("Webhook delivery of %s failed: %v", item.event.EventID, err)
+		}
+		s.config.Deliveries.record(delivery)
+	}
+}
+
+// deliver posts an event, retrying server errors, throttling and network
+// failures. It returns the number of attempts made.
+func (s *Sender) deliver(item queued) (int, error) {
+	backoff := s.config.Backoff
+	var err error
+	for attempt := 1; attempt <= s.config.MaxAttempts; attempt++ {
+		var retry bool
+		retry, err = s.post(item)
+		if err == nil || !retry {
+			return attempt, err
+		}
+		if attempt < s.config.MaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return s.config.MaxAttempts, fmt.Errorf("giving up after %d attempts: %w", s.config.MaxAttempts, err)
+}
+
+// signedRequest posts events as JSON, encrypted to the key when there is one
+// and signed with the secret
+func signedRequest(target, secret string, key crypto.PublicKey) RequestFunc {
+	return func(event *events.DecisionEvent) (*http.Request, error) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("encoding the event: %w", err)
+		}
+		contentType := "application/json"
+		if key != nil {
+			token, err := events.Encrypt(key, body)
+			if err != nil {
+				return nil, fmt.Errorf("encrypting the event: %w", err)
+			}
+			body = []byte(token)
+			contentType = events.EncryptedContentType
+		}
+		req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+		return req, nil
+	}
+}
+
+func (s *Sender) post(item queued) (bool, error) {
+	req, err := s.build(item.event)
+	if err != nil {
+		return false, err
+	}
+	if item.replay {
+		req.Header.Set(ReplayHeader, "true")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return false, fmt.Errorf("webhook rejected the event: %s", resp.Status)
+}
+
+// Sign returns the signature header value of a body sent at t
+func Sign(secret string, t time.Time, body []byte) string {
+	return events.Sign(secret, t, body)
+}
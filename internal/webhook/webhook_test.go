@@ -0,0 +1,177 @@
+package webhook_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/internal/webhook"
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receiver struct {
+	mu         sync.Mutex
+	failFirst  int
+	attempts   int
+	bodies     []string
+	signatures []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts++
+	if r.attempts <= r.failFirst {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	r.bodies = append(r.bodies, string(body))
+	r.signatures = append(r.signatures, req.Header.Get(webhook.SignatureHeader))
+}
+
+func event(id string) *events.DecisionEvent {
+	return &events.DecisionEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       id,
+		TransactionID: id,
+		Decision:      "DECLINE",
+	}
+}
+
+func TestSender_DeliversSignedEvents(t *testing.T) {
+	recv := &receiver{failFirst: 1}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", Backoff: time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, sender.Send(event("TX-1")))
+	sender.Close()
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	assert.Equal(t, 2, recv.attempts, "retried after the 503")
+	require.Len(t, recv.bodies, 1)
+
+	delivered, err := events.UnmarshalJSON([]byte(recv.bodies[0]))
+	require.NoError(t, err)
+	assert.Equal(t, "TX-1", delivered.TransactionID)
+
+	signature := recv.signatures[0]
+	seconds, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Sign("s3cret", time.Unix(seconds, 0), []byte(recv.bodies[0])), signature)
+	assert.NotEqual(t, webhook.Sign("other", time.Unix(seconds, 0), []byte(recv.bodies[0])), signature)
+}
+
+func TestSender_EncryptsToKey(t *testing.T) {
+	var contentType string
+	recv := &receiver{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		recv.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", EncryptionKey: &key.PublicKey})
+	require.NoError(t, err)
+	assert.True(t, sender.Send(event("TX-1")))
+	sender.Close()
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	require.Len(t, recv.bodies, 1)
+	assert.Equal(t, events.EncryptedContentType, contentType)
+	assert.NotContains(t, recv.bodies[0], "TX-1")
+	require.NoError(t, events.VerifySignature("s3cret", recv.signatures[0], []byte(recv.bodies[0]), 0, time.Now()))
+
+	plaintext, err := events.Decrypt(key, recv.bodies[0])
+	require.NoError(t, err)
+	delivered, err := events.UnmarshalJSON(plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, "TX-1", delivered.TransactionID)
+
+	weak, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", EncryptionKey: &weak.PublicKey})
+	assert.ErrorIs(t, err, events.ErrUnsupportedKey)
+}
+
+func TestSender_DoesNotRetryRejections(t *testing.T) {
+	var attempts int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sender, err := webhook.NewSender(webhook.Config{URL: server.URL, Secret: "s3cret", Backoff: time.Millisecond})
+	require.NoError(t, err)
+	sender.Send(event("TX-1"))
+	sender.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, attempts)
+}
+
+func TestNewSender_ValidatesConfig(t *testing.T) {
+	_, err := webhook.NewSender(webhook.Config{URL: "ftp://example.com", Secret: "s"})
+	assert.Error(t, err)
+	_, err = webhook.NewSender(webhook.Config{URL: "https://example.com/hook"})
+	assert.Error(t, err)
+}
+
+func TestRouter_DeliversPerMerchant(t *testing.T) {
+	shop, travel := &receiver{}, &receiver{}
+	shopServer, travelServer := httptest.NewServer(shop), httptest.NewServer(travel)
+	defer shopServer.Close()
+	defer travelServer.Close()
+
+	router := webhook.NewRouter(webhook.Config{Backoff: time.Millisecond})
+	require.NoError(t, router.Set("shop", shopServer.URL, "shop-secret", nil))
+	require.NoError(t, router.Set("travel", travelServer.URL, "travel-secret", nil))
+	assert.Error(t, router.Set("travel", "ftp://example.com", "secret", nil))
+
+	url, exists := router.URL("travel")
+	assert.True(t, exists)
+	assert.Equal(t, travelServer.URL, url, "a rejected webhook keeps the previous one")
+	assert.False(t, router.Encrypted("travel"))
+
+	assert.True(t, router.Send("shop", event("TX-1")))
+	assert.True(t, router.Send("travel", event("TX-2")))
+	assert.True(t, router.Send("elsewhere", event("TX-3")), "merchants without a webhook are ignored")
+	assert.True(t, router.Remove("travel"))
+	assert.False(t, router.Remove("travel"))
+	router.Close()
+
+	shop.mu.Lock()
+	defer shop.mu.Unlock()
+	require.Len(t, shop.bodies, 1)
+	assert.Contains(t, shop.bodies[0], "TX-1")
+	assert.True(t, strings.HasPrefix(shop.signatures[0], "t="))
+
+	// Removed webhooks deliver what they had queued in the background
+	assert.Eventually(t, func() bool {
+		travel.mu.Lock()
+		defer travel.mu.Unlock()
+		return len(travel.bodies) == 1
+	}, time.Second, 10*time.Millisecond)
+}
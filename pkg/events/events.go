@@ -0,0 +1,166 @@
+// Package events defines the versioned decision events the engine publishes
+// and helps consumers decode them safely as the schema evolves.
+//
+// Events are encoded as JSON, using the field names of the protobuf schema in
+// schema/decision_event.proto, or as protobuf. Minor versions only add
+// fields, which decoders ignore until they are upgraded; a new major version
+// is rejected with ErrUnsupportedVersion.
+//
+// Webhook receivers verify the X-Fraud-Signature of deliveries with
+// VerifySignature, or verify and decode them in one step with ParseWebhook.
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema version of the events produced by this package
+const (
+	MajorVersion  = 1
+	MinorVersion  = 1
+	SchemaVersion = "1.1"
+)
+
+// ErrUnsupportedVersion is returned for events of another major version
+var ErrUnsupportedVersion = errors.New("unsupported decision event schema version")
+
+// DecisionEvent is emitted for every scored transaction
+type DecisionEvent struct {
+	SchemaVersion string    `json:"schema_version"`
+	EventID       string    `json:"event_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	TransactionID string    `json:"transaction_id"`
+	AccountID     string    `json:"account_id,omitempty"`
+	MerchantID    string    `json:"merchant_id,omitempty"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency,omitempty"`
+	Decision      string    `json:"decision"`
+	RiskScore     float64   `json:"risk_score"`
+	RuleScore     float64   `json:"rule_score"`
+	MLScore       float64   `json:"ml_score"`
+	Confidence    float64   `json:"confidence"`
+	ReasonCodes   []string  `json:"reason_codes,omitempty"`
+	Reasons       []string  `json:"reasons,omitempty"`
+	// Retry is the retry guidance of a SOFT_DECLINE, since 1.1
+	Retry string `json:"retry,omitempty"`
+}
+
+// NetworkAlertEvent is posted when an account or device was sent to review
+// or declined at many merchants within a window. It is encoded as JSON
+// only, signed like decision events.
+type NetworkAlertEvent struct {
+	SchemaVersion string    `json:"schema_version"`
+	EventID       string    `json:"event_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	// Entity is the account or device, as "account:<id>" or "device:<id>"
+	Entity    string    `json:"entity"`
+	Merchants []string  `json:"merchants"`
+	Decisions int       `json:"decisions"`
+	FirstAt   time.Time `json:"first_at"`
+	// EscalateUntil is when the escalation of the entity's transactions
+	// ends, absent when they are not escalated
+	EscalateUntil *time.Time `json:"escalate_until,omitempty"`
+}
+
+// ScenarioAlertEvent is posted when a scenario alert rule on aggregate
+// decisions starts firing and again when it resolves. It is encoded as JSON
+// only, signed like decision events.
+type ScenarioAlertEvent struct {
+	SchemaVersion string    `json:"schema_version"`
+	EventID       string    `json:"event_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Scenario      string    `json:"scenario"`
+	Description   string    `json:"description,omitempty"`
+	// Status is firing or resolved
+	Status     string `json:"status"`
+	MerchantID string `json:"merchant_id,omitempty"`
+	// Value is the count or rate of the window, over Threshold while firing
+	Aggregate   string     `json:"aggregate"`
+	Value       float64    `json:"value"`
+	Threshold   float64    `json:"threshold"`
+	Matched     uint64     `json:"matched"`
+	Total       uint64     `json:"total"`
+	Window      string     `json:"window"`
+	FiringSince *time.Time `json:"firing_since,omitempty"`
+}
+
+// Validate checks the schema version and required fields
+func (e *DecisionEvent) Validate() error {
+	major, err := parseMajor(e.SchemaVersion)
+	if err != nil {
+		return err
+	}
+	if major != MajorVersion {
+		return fmt.Errorf("%w %q, expected %d.x", ErrUnsupportedVersion, e.SchemaVersion, MajorVersion)
+	}
+	if e.EventID == "" {
+		return errors.New("event_id is required")
+	}
+	if e.TransactionID == "" {
+		return errors.New("transaction_id is required")
+	}
+	if e.Decision == "" {
+		return errors.New("decision is required")
+	}
+	return nil
+}
+
+func parseMajor(version string) (int, error) {
+	if version == "" {
+		return 0, errors.New("schema_version is required")
+	}
+	majorText, _, _ := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema_version %q", version)
+	}
+	return major, nil
+}
+
+// UnmarshalJSON decodes and validates a JSON decision event. Unknown fields
+// are ignored.
+func UnmarshalJSON(data []byte) (*DecisionEvent, error) {
+	var event DecisionEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("invalid decision event: %w", err)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Decoder reads a stream of decision events, one JSON event per line
+type Decoder struct {
+	scanner *bufio.Scanner
+}
+
+// NewDecoder creates a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &Decoder{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF at the end of the stream. Blank
+// lines are skipped.
+func (d *Decoder) Next() (*DecisionEvent, error) {
+	for d.scanner.Scan() {
+		line := d.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		return UnmarshalJSON(line)
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
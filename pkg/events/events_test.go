@@ -0,0 +1,135 @@
+package events_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleEvent() *events.DecisionEvent {
+	return &events.DecisionEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       "TX-1:1700000000000000000",
+		OccurredAt:    time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC),
+		TransactionID: "TX-1",
+		AccountID:     "ACC-1",
+		MerchantID:    "MERCH-1",
+		Amount:        1250.5,
+		Currency:      "USD",
+		Decision:      "SOFT_DECLINE",
+		RiskScore:     0.62,
+		RuleScore:     0.7,
+		MLScore:       0.54,
+		Confidence:    0.88,
+		ReasonCodes:   []string{"HIGH_VELOCITY", "CROSS_BORDER"},
+		Reasons:       []string{"High transaction velocity", "Cross-border transaction"},
+		Retry:         "retry_with_3ds",
+	}
+}
+
+func TestJSON_RoundTrip(t *testing.T) {
+	data, err := json.Marshal(sampleEvent())
+	require.NoError(t, err)
+
+	event, err := events.UnmarshalJSON(data)
+	require.NoError(t, err)
+	assert.Equal(t, sampleEvent(), event)
+}
+
+func TestJSON_ToleratesNewerMinorVersions(t *testing.T) {
+	event, err := events.UnmarshalJSON([]byte(`{"schema_version":"1.7","event_id":"E1","transaction_id":"TX-1",
+		"decision":"APPROVE","new_field":{"nested":true}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "1.7", event.SchemaVersion)
+	assert.Equal(t, "APPROVE", event.Decision)
+}
+
+func TestJSON_RejectsOtherMajorVersions(t *testing.T) {
+	_, err := events.UnmarshalJSON([]byte(`{"schema_version":"2.0","event_id":"E1","transaction_id":"TX-1","decision":"APPROVE"}`))
+	assert.ErrorIs(t, err, events.ErrUnsupportedVersion)
+
+	_, err = events.UnmarshalJSON([]byte(`{"event_id":"E1","transaction_id":"TX-1","decision":"APPROVE"}`))
+	assert.Error(t, err, "schema_version is required")
+
+	_, err = events.UnmarshalJSON([]byte(`{"schema_version":"1.0","event_id":"E1","decision":"APPROVE"}`))
+	assert.Error(t, err, "transaction_id is required")
+}
+
+func TestDecoder_ReadsEventsPerLine(t *testing.T) {
+	var stream bytes.Buffer
+	for i := 0; i < 2; i++ {
+		require.NoError(t, json.NewEncoder(&stream).Encode(sampleEvent()))
+		stream.WriteString("\n")
+	}
+
+	decoder := events.NewDecoder(&stream)
+	for i := 0; i < 2; i++ {
+		event, err := decoder.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "TX-1", event.TransactionID)
+	}
+	_, err := decoder.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestProto_RoundTrip(t *testing.T) {
+	event, err := events.UnmarshalProto(events.MarshalProto(sampleEvent()))
+	require.NoError(t, err)
+	assert.Equal(t, sampleEvent(), event)
+}
+
+func TestProto_SkipsUnknownFields(t *testing.T) {
+	data := events.MarshalProto(sampleEvent())
+	// Field 99 as a string and field 100 as a varint, as a newer producer
+	// might send
+	data = binary.AppendUvarint(data, 99<<3|2)
+	data = binary.AppendUvarint(data, 3)
+	data = append(data, "new"...)
+	data = binary.AppendUvarint(data, 100<<3|0)
+	data = binary.AppendUvarint(data, 42)
+
+	event, err := events.UnmarshalProto(data)
+	require.NoError(t, err)
+	assert.Equal(t, sampleEvent(), event)
+}
+
+func TestProto_RejectsMalformedMessages(t *testing.T) {
+	data := events.MarshalProto(sampleEvent())
+	_, err := events.UnmarshalProto(data[:len(data)-3])
+	assert.Error(t, err)
+
+	// transaction_id sent as a varint
+	bad := binary.AppendUvarint(nil, 4<<3|0)
+	bad = binary.AppendUvarint(bad, 1)
+	_, err = events.UnmarshalProto(bad)
+	assert.Error(t, err)
+}
+
+func TestProtoDecoder_ReadsDelimitedStream(t *testing.T) {
+	var stream bytes.Buffer
+	first, second := sampleEvent(), sampleEvent()
+	second.TransactionID = "TX-2"
+	require.NoError(t, events.WriteDelimited(&stream, first))
+	require.NoError(t, events.WriteDelimited(&stream, second))
+
+	decoder := events.NewProtoDecoder(&stream)
+	event, err := decoder.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "TX-1", event.TransactionID)
+	event, err = decoder.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "TX-2", event.TransactionID)
+	_, err = decoder.Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = events.NewProtoDecoder(strings.NewReader("\x05ab")).Next()
+	assert.Error(t, err)
+}
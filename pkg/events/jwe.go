@@ -0,0 +1,306 @@
+package events
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EncryptedContentType is the content type of webhook deliveries encrypted as
+// a compact JWE
+const EncryptedContentType = "application/jose"
+
+// JWE algorithms: content is encrypted with A256GCM under a key wrapped with
+// RSA-OAEP-256 for RSA recipients or agreed with ECDH-ES for P-256 ones
+const (
+	algRSAOAEP256 = "RSA-OAEP-256"
+	algECDHES     = "ECDH-ES"
+	encA256GCM    = "A256GCM"
+)
+
+// Encryption errors
+var (
+	ErrUnsupportedKey = errors.New("unsupported encryption key: want RSA of 2048 bits or more, or EC P-256")
+	ErrInvalidJWE     = errors.New("invalid JWE")
+)
+
+type jweHeader struct {
+	Algorithm  string `json:"alg"`
+	Encryption string `json:"enc"`
+	Ephemeral  *ecJWK `json:"epk,omitempty"`
+}
+
+type ecJWK struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// ParsePublicKey reads the PEM-encoded public key webhook deliveries are
+// encrypted to
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("encryption key is not PEM-encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if err := CheckEncryptionKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParsePrivateKey reads the PEM-encoded private key a receiver decrypts
+// deliveries with, in PKCS #8, PKCS #1 or SEC 1 form
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("decryption key is not PEM-encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decryption key: %w", err)
+	}
+	return key, nil
+}
+
+// CheckEncryptionKey reports whether bodies can be encrypted to a public key
+func CheckEncryptionKey(key crypto.PublicKey) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() >= 2048 {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			return nil
+		}
+	}
+	return ErrUnsupportedKey
+}
+
+// Encrypt encrypts a body to a public key as a compact JWE
+func Encrypt(key crypto.PublicKey, plaintext []byte) (string, error) {
+	if err := CheckEncryptionKey(key); err != nil {
+		return "", err
+	}
+
+	header := jweHeader{Encryption: encA256GCM}
+	var cek, encryptedKey []byte
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		header.Algorithm = algRSAOAEP256
+		cek = make([]byte, 32)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		var err error
+		if encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, key, cek, nil); err != nil {
+			return "", err
+		}
+	case *ecdsa.PublicKey:
+		recipient, err := key.ECDH()
+		if err != nil {
+			return "", err
+		}
+		ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		shared, err := ephemeral.ECDH(recipient)
+		if err != nil {
+			return "", err
+		}
+		header.Algorithm = algECDHES
+		header.Ephemeral = toJWK(ephemeral.PublicKey())
+		cek = concatKDF(shared, encA256GCM)
+	}
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(encodedHeader)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt returns the body of a compact JWE encrypted to the public key of
+// an RSA or EC P-256 private key
+func Decrypt(key crypto.PrivateKey, token string) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: want 5 parts, got %d", ErrInvalidJWE, len(parts))
+	}
+	decoded := make([][]byte, 5)
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+		}
+	}
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidJWE, err)
+	}
+	if header.Encryption != encA256GCM {
+		return nil, fmt.Errorf("%w: unsupported enc %q", ErrInvalidJWE, header.Encryption)
+	}
+
+	var cek []byte
+	switch {
+	case header.Algorithm == algRSAOAEP256:
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s needs an RSA key", ErrInvalidJWE, header.Algorithm)
+		}
+		var err error
+		if cek, err = rsa.DecryptOAEP(sha256.New(), nil, private, decoded[1], nil); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+		}
+	case header.Algorithm == algECDHES && header.Ephemeral != nil:
+		private, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s needs an EC key", ErrInvalidJWE, header.Algorithm)
+		}
+		recipient, err := private.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := fromJWK(header.Ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := recipient.ECDH(ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+		}
+		cek = concatKDF(shared, encA256GCM)
+	default:
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrInvalidJWE, header.Algorithm)
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded[2]) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: bad IV", ErrInvalidJWE)
+	}
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+	}
+	return plaintext, nil
+}
+
+// ParseEncryptedWebhook reads the decision event of an encrypted webhook
+// delivery, verifying the signature of the JWE with DefaultTolerance before
+// decrypting and decoding it
+func ParseEncryptedWebhook(r *http.Request, secret string, key crypto.PrivateKey) (*DecisionEvent, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		return nil, fmt.Errorf("reading webhook body: %w", err)
+	}
+	if err := VerifySignature(secret, r.Header.Get(SignatureHeader), body, DefaultTolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	plaintext, err := Decrypt(key, string(body))
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalJSON(plaintext)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// concatKDF derives the 256-bit content key of ECDH-ES in direct key
+// agreement mode, with empty party infos (RFC 7518, section 4.6.2)
+func concatKDF(shared []byte, algorithm string) []byte {
+	hash := sha256.New()
+	binary.Write(hash, binary.BigEndian, uint32(1))
+	hash.Write(shared)
+	binary.Write(hash, binary.BigEndian, uint32(len(algorithm)))
+	hash.Write([]byte(algorithm))
+	binary.Write(hash, binary.BigEndian, uint32(0)) // PartyUInfo
+	binary.Write(hash, binary.BigEndian, uint32(0)) // PartyVInfo
+	binary.Write(hash, binary.BigEndian, uint32(256))
+	return hash.Sum(nil)
+}
+
+// toJWK encodes an uncompressed P-256 point as a JWK
+func toJWK(key *ecdh.PublicKey) *ecJWK {
+	point := key.Bytes()
+	return &ecJWK{
+		KeyType: "EC",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(point[1:33]),
+		Y:       base64.RawURLEncoding.EncodeToString(point[33:]),
+	}
+}
+
+func fromJWK(jwk *ecJWK) (*ecdh.PublicKey, error) {
+	if jwk.KeyType != "EC" || jwk.Curve != "P-256" {
+		return nil, fmt.Errorf("%w: unsupported epk", ErrInvalidJWE)
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("%w: malformed epk", ErrInvalidJWE)
+	}
+	key, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,114 @@
+package events_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		private crypto.PrivateKey
+		public  crypto.PublicKey
+		alg     string
+	}{
+		"rsa": {rsaKey, &rsaKey.PublicKey, "RSA-OAEP-256"},
+		"ec":  {ecKey, &ecKey.PublicKey, "ECDH-ES"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := []byte(`{"event_id":"TX-1:1"}`)
+			token, err := events.Encrypt(tc.public, body)
+			require.NoError(t, err)
+			assert.NotContains(t, token, "TX-1")
+
+			parts := strings.Split(token, ".")
+			require.Len(t, parts, 5)
+			header, err := base64.RawURLEncoding.DecodeString(parts[0])
+			require.NoError(t, err)
+			var protected map[string]interface{}
+			require.NoError(t, json.Unmarshal(header, &protected))
+			assert.Equal(t, tc.alg, protected["alg"])
+			assert.Equal(t, "A256GCM", protected["enc"])
+
+			decrypted, err := events.Decrypt(tc.private, token)
+			require.NoError(t, err)
+			assert.Equal(t, body, decrypted)
+
+			// Tampering with the ciphertext fails authentication
+			ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+			require.NoError(t, err)
+			ciphertext[0] ^= 1
+			parts[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+			_, err = events.Decrypt(tc.private, strings.Join(parts, "."))
+			assert.ErrorIs(t, err, events.ErrInvalidJWE)
+		})
+	}
+
+	_, err = events.Decrypt(ecKey, "not.a.jwe")
+	assert.ErrorIs(t, err, events.ErrInvalidJWE)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	require.NoError(t, err)
+	key, err := events.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, &ecKey.PublicKey, key)
+
+	weak, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKIXPublicKey(&weak.PublicKey)
+	require.NoError(t, err)
+	_, err = events.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.ErrorIs(t, err, events.ErrUnsupportedKey)
+
+	_, err = events.ParsePublicKey([]byte("not a key"))
+	assert.Error(t, err)
+
+	der, err = x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	private, err := events.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, ecKey, private)
+}
+
+func TestParseEncryptedWebhook(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	body, err := json.Marshal(sampleEvent())
+	require.NoError(t, err)
+	token, err := events.Encrypt(&key.PublicKey, body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/hook", strings.NewReader(token))
+	req.Header.Set(events.SignatureHeader, events.Sign("s3cret", time.Now(), []byte(token)))
+	event, err := events.ParseEncryptedWebhook(req, "s3cret", key)
+	require.NoError(t, err)
+	assert.Equal(t, sampleEvent(), event)
+
+	req = httptest.NewRequest("POST", "/hook", strings.NewReader(token))
+	req.Header.Set(events.SignatureHeader, events.Sign("s3cret", time.Now(), body))
+	_, err = events.ParseEncryptedWebhook(req, "s3cret", key)
+	assert.ErrorIs(t, err, events.ErrInvalidSignature, "the signature covers the encrypted body")
+}
@@ -0,0 +1,289 @@
+package events
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Field numbers of DecisionEvent in schema/decision_event.proto
+const (
+	fieldSchemaVersion = 1
+	fieldEventID       = 2
+	fieldOccurredAt    = 3
+	fieldTransactionID = 4
+	fieldAccountID     = 5
+	fieldMerchantID    = 6
+	fieldAmount        = 7
+	fieldCurrency      = 8
+	fieldDecision      = 9
+	fieldRiskScore     = 10
+	fieldRuleScore     = 11
+	fieldMLScore       = 12
+	fieldConfidence    = 13
+	fieldReasonCodes   = 14
+	fieldReasons       = 15
+	fieldRetry         = 16
+)
+
+// MarshalProto encodes a decision event as protobuf. As in proto3, zero
+// values are omitted.
+func MarshalProto(e *DecisionEvent) []byte {
+	var b []byte
+	b = appendString(b, fieldSchemaVersion, e.SchemaVersion)
+	b = appendString(b, fieldEventID, e.EventID)
+	if !e.OccurredAt.IsZero() {
+		var ts []byte
+		if seconds := e.OccurredAt.Unix(); seconds != 0 {
+			ts = appendVarint(ts, 1, uint64(seconds))
+		}
+		if nanos := e.OccurredAt.Nanosecond(); nanos != 0 {
+			ts = appendVarint(ts, 2, uint64(nanos))
+		}
+		b = appendBytes(b, fieldOccurredAt, ts)
+	}
+	b = appendString(b, fieldTransactionID, e.TransactionID)
+	b = appendString(b, fieldAccountID, e.AccountID)
+	b = appendString(b, fieldMerchantID, e.MerchantID)
+	b = appendDouble(b, fieldAmount, e.Amount)
+	b = appendString(b, fieldCurrency, e.Currency)
+	b = appendString(b, fieldDecision, e.Decision)
+	b = appendDouble(b, fieldRiskScore, e.RiskScore)
+	b = appendDouble(b, fieldRuleScore, e.RuleScore)
+	b = appendDouble(b, fieldMLScore, e.MLScore)
+	b = appendDouble(b, fieldConfidence, e.Confidence)
+	for _, code := range e.ReasonCodes {
+		b = appendBytes(b, fieldReasonCodes, []byte(code))
+	}
+	for _, reason := range e.Reasons {
+		b = appendBytes(b, fieldReasons, []byte(reason))
+	}
+	b = appendString(b, fieldRetry, e.Retry)
+	return b
+}
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendBytes(b, field, []byte(v))
+}
+
+func appendDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(appendTag(b, field, wireFixed64), math.Float64bits(v))
+}
+
+// UnmarshalProto decodes and validates a protobuf decision event. Unknown
+// fields are skipped.
+func UnmarshalProto(data []byte) (*DecisionEvent, error) {
+	var event DecisionEvent
+	err := eachField(data, func(field, wireType int, value []byte, number uint64) error {
+		switch field {
+		case fieldSchemaVersion, fieldEventID, fieldTransactionID, fieldAccountID, fieldMerchantID,
+			fieldCurrency, fieldDecision, fieldReasonCodes, fieldReasons, fieldRetry:
+			if wireType != wireBytes {
+				return fmt.Errorf("field %d: expected a string", field)
+			}
+			setString(&event, field, string(value))
+		case fieldAmount, fieldRiskScore, fieldRuleScore, fieldMLScore, fieldConfidence:
+			if wireType != wireFixed64 {
+				return fmt.Errorf("field %d: expected a double", field)
+			}
+			setDouble(&event, field, math.Float64frombits(number))
+		case fieldOccurredAt:
+			if wireType != wireBytes {
+				return fmt.Errorf("field %d: expected a timestamp", field)
+			}
+			occurredAt, err := unmarshalTimestamp(value)
+			if err != nil {
+				return err
+			}
+			event.OccurredAt = occurredAt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid decision event: %w", err)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func setString(e *DecisionEvent, field int, v string) {
+	switch field {
+	case fieldSchemaVersion:
+		e.SchemaVersion = v
+	case fieldEventID:
+		e.EventID = v
+	case fieldTransactionID:
+		e.TransactionID = v
+	case fieldAccountID:
+		e.AccountID = v
+	case fieldMerchantID:
+		e.MerchantID = v
+	case fieldCurrency:
+		e.Currency = v
+	case fieldDecision:
+		e.Decision = v
+	case fieldReasonCodes:
+		e.ReasonCodes = append(e.ReasonCodes, v)
+	case fieldReasons:
+		e.Reasons = append(e.Reasons, v)
+	case fieldRetry:
+		e.Retry = v
+	}
+}
+
+func setDouble(e *DecisionEvent, field int, v float64) {
+	switch field {
+	case fieldAmount:
+		e.Amount = v
+	case fieldRiskScore:
+		e.RiskScore = v
+	case fieldRuleScore:
+		e.RuleScore = v
+	case fieldMLScore:
+		e.MLScore = v
+	case fieldConfidence:
+		e.Confidence = v
+	}
+}
+
+// unmarshalTimestamp decodes a google.protobuf.Timestamp
+func unmarshalTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := eachField(data, func(field, wireType int, _ []byte, number uint64) error {
+		if (field == 1 || field == 2) && wireType != wireVarint {
+			return errors.New("invalid timestamp")
+		}
+		switch field {
+		case 1:
+			seconds = int64(number)
+		case 2:
+			nanos = int64(int32(number))
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
+
+// eachField walks the fields of a protobuf message. Length-delimited values
+// are passed as bytes, the others as numbers.
+func eachField(data []byte, fn func(field, wireType int, value []byte, number uint64) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("truncated field tag")
+		}
+		data = data[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		if field == 0 {
+			return errors.New("invalid field number 0")
+		}
+
+		var value []byte
+		var number uint64
+		switch wireType {
+		case wireVarint:
+			number, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("field %d: truncated varint", field)
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("field %d: truncated fixed64", field)
+			}
+			number, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("field %d: truncated fixed32", field)
+			}
+			number, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return fmt.Errorf("field %d: truncated value", field)
+			}
+			value, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return fmt.Errorf("field %d: unsupported wire type %d", field, wireType)
+		}
+
+		if err := fn(field, wireType, value, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDelimited writes an event prefixed with its varint encoded length, the
+// framing used for protobuf event streams
+func WriteDelimited(w io.Writer, e *DecisionEvent) error {
+	message := MarshalProto(e)
+	frame := binary.AppendUvarint(make([]byte, 0, len(message)+binary.MaxVarintLen64), uint64(len(message)))
+	_, err := w.Write(append(frame, message...))
+	return err
+}
+
+// ProtoDecoder reads a stream of length-delimited protobuf decision events
+type ProtoDecoder struct {
+	r *bufio.Reader
+}
+
+// NewProtoDecoder creates a decoder reading from r
+func NewProtoDecoder(r io.Reader) *ProtoDecoder {
+	return &ProtoDecoder{r: bufio.NewReader(r)}
+}
+
+// maxEventSize bounds the size of a single event in a stream
+const maxEventSize = 1 << 20
+
+// Next returns the next event, or io.EOF at the end of the stream
+func (d *ProtoDecoder) Next() (*DecisionEvent, error) {
+	length, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxEventSize {
+		return nil, fmt.Errorf("decision event of %d bytes exceeds %d", length, maxEventSize)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(d.r, message); err != nil {
+		return nil, fmt.Errorf("truncated decision event: %w", err)
+	}
+	return UnmarshalProto(message)
+}
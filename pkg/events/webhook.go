@@ -0,0 +1,98 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>" where the
+// HMAC is computed over "<unix seconds>.<body>" with the shared secret
+const SignatureHeader = "X-Fraud-Signature"
+
+// DefaultTolerance is how far the signature timestamp of a webhook delivery
+// may be from the receiver's clock
+const DefaultTolerance = 5 * time.Minute
+
+// maxWebhookBody bounds the webhook bodies ParseWebhook reads
+const maxWebhookBody = 1 << 20
+
+// Signature verification errors
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature timestamp outside the tolerance")
+)
+
+// Sign returns the signature header value of a body sent at t
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + digest(secret, timestamp, body)
+}
+
+func digest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature header of a webhook body against the
+// secret, and that it was signed within tolerance of now. A tolerance of zero
+// skips the timestamp check. Any of several v1 values may match, so that
+// senders can sign with an old and a new secret while rotating.
+func VerifySignature(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed %s header", ErrInvalidSignature, SignatureHeader)
+	}
+
+	expected := digest(secret, timestamp, body)
+	matched := false
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			matched = true
+		}
+	}
+	if !matched {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(seconds, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrExpiredSignature
+		}
+	}
+	return nil
+}
+
+// ParseWebhook reads the decision event of a webhook delivery, verifying its
+// signature with DefaultTolerance before decoding it
+func ParseWebhook(r *http.Request, secret string) (*DecisionEvent, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		return nil, fmt.Errorf("reading webhook body: %w", err)
+	}
+	if err := VerifySignature(secret, r.Header.Get(SignatureHeader), body, DefaultTolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	return UnmarshalJSON(body)
+}
@@ -0,0 +1,49 @@
+package events_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"event_id":"TX-1:1"}`)
+	signedAt := time.Unix(1772368200, 0)
+	header := events.Sign("s3cret", signedAt, body)
+
+	assert.NoError(t, events.VerifySignature("s3cret", header, body, events.DefaultTolerance, signedAt.Add(time.Minute)))
+	assert.ErrorIs(t, events.VerifySignature("other", header, body, events.DefaultTolerance, signedAt), events.ErrInvalidSignature)
+	assert.ErrorIs(t, events.VerifySignature("s3cret", header, []byte(`{"event_id":"TX-2:1"}`), events.DefaultTolerance, signedAt), events.ErrInvalidSignature)
+	assert.ErrorIs(t, events.VerifySignature("s3cret", header, body, events.DefaultTolerance, signedAt.Add(time.Hour)), events.ErrExpiredSignature)
+	assert.NoError(t, events.VerifySignature("s3cret", header, body, 0, signedAt.Add(time.Hour)))
+	assert.ErrorIs(t, events.VerifySignature("s3cret", "v1=abc", body, 0, signedAt), events.ErrInvalidSignature)
+
+	// Either secret verifies while the sender rotates them
+	_, current, _ := strings.Cut(events.Sign("s3cret", signedAt, body), ",v1=")
+	rotating := events.Sign("old", signedAt, body) + ",v1=" + current
+	assert.NoError(t, events.VerifySignature("s3cret", rotating, body, 0, signedAt))
+	assert.NoError(t, events.VerifySignature("old", rotating, body, 0, signedAt))
+}
+
+func TestParseWebhook(t *testing.T) {
+	body, err := json.Marshal(sampleEvent())
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader(body))
+	req.Header.Set(events.SignatureHeader, events.Sign("s3cret", time.Now(), body))
+	event, err := events.ParseWebhook(req, "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, sampleEvent(), event)
+
+	req = httptest.NewRequest("POST", "/hook", bytes.NewReader(body))
+	req.Header.Set(events.SignatureHeader, events.Sign("other", time.Now(), body))
+	_, err = events.ParseWebhook(req, "s3cret")
+	assert.ErrorIs(t, err, events.ErrInvalidSignature)
+}
@@ -0,0 +1,242 @@
+package synthetic
+
+import (
+	"fmt"
+	"time"
+)
+
+type city struct {
+	name    string
+	country string
+	lat     float64
+	lon     float64
+}
+
+// homes are the cities everyday accounts live in
+var homes = []city{
+	{"New York", "US", 40.7128, -74.0060},
+	{"San Francisco", "US", 37.7749, -122.4194},
+	{"Chicago", "US", 41.8781, -87.6298},
+	{"London", "GB", 51.5074, -0.1278},
+	{"Berlin", "DE", 52.5200, 13.4050},
+	{"São Paulo", "BR", -23.5505, -46.6333},
+	{"Tokyo", "JP", 35.6762, 139.6503},
+	{"Sydney", "AU", -33.8688, 151.2093},
+}
+
+// abroad are the cities fraudsters operate from
+var abroad = []city{
+	{"Lagos", "NG", 6.5244, 3.3792},
+	{"Moscow", "RU", 55.7558, 37.6173},
+	{"Bucharest", "RO", 44.4268, 26.1025},
+	{"Jakarta", "ID", -6.2088, 106.8456},
+}
+
+var platforms = []string{"web", "ios", "android"}
+
+// episodeSize is the average number of transactions of an episode
+type episodeSize struct {
+	fraud float64
+	total float64
+}
+
+var episodeSizes = map[Scenario]episodeSize{
+	BustOut:         {fraud: 6, total: 13.5},
+	AccountTakeover: {fraud: 3.5, total: 4.5},
+	CardTesting:     {fraud: 22, total: 22},
+	MuleFlow:        {fraud: 8.5, total: 8.5},
+}
+
+// account is the everyday behavior of an account
+type account struct {
+	id        string
+	home      city
+	device    string
+	platform  string
+	ip        string
+	mean      float64
+	merchants []int
+	createdAt time.Time
+}
+
+func (g *Generator) newAccount(id string) account {
+	a := account{
+		id:        id,
+		home:      homes[g.rng.Intn(len(homes))],
+		device:    "dev_" + id,
+		platform:  platforms[g.rng.Intn(len(platforms))],
+		ip:        fmt.Sprintf("10.%d.%d.%d", g.rng.Intn(256), g.rng.Intn(256), 1+g.rng.Intn(254)),
+		mean:      15 + 85*g.rng.Float64(),
+		createdAt: g.config.Start.Add(-g.between(30*24*time.Hour, 5*365*24*time.Hour)),
+	}
+	for i := 0; i < 3+g.rng.Intn(5); i++ {
+		a.merchants = append(a.merchants, g.rng.Intn(g.config.Merchants))
+	}
+	return a
+}
+
+func (g *Generator) pickAccount() *account {
+	return &g.accounts[g.rng.Intn(len(g.accounts))]
+}
+
+func merchant(index int) string {
+	return fmt.Sprintf("merchant_%d", index)
+}
+
+// purchase is a card purchase of an account from its home and device
+func (g *Generator) purchase(a *account, amount float64, at time.Time) Transaction {
+	return Transaction{
+		Amount:        amount,
+		Currency:      "USD",
+		MerchantID:    merchant(a.merchants[g.rng.Intn(len(a.merchants))]),
+		CustomerID:    a.id,
+		PaymentMethod: "card",
+		Location: Location{
+			Country:   a.home.country,
+			City:      a.home.name,
+			Latitude:  a.home.lat,
+			Longitude: a.home.lon,
+			IPAddress: a.ip,
+		},
+		DeviceInfo:       DeviceInfo{DeviceID: a.device, Platform: a.platform},
+		Timestamp:        at,
+		AccountCreatedAt: a.createdAt,
+		InstrumentID:     "card_" + a.id,
+	}
+}
+
+// fraudster returns the location, device and IP of a fraudster abroad
+func (g *Generator) fraudster(tag string) (Location, DeviceInfo) {
+	c := abroad[g.rng.Intn(len(abroad))]
+	location := Location{
+		Country:   c.country,
+		City:      c.name,
+		Latitude:  c.lat,
+		Longitude: c.lon,
+		IPAddress: fmt.Sprintf("185.%d.%d.%d", g.rng.Intn(256), g.rng.Intn(256), 1+g.rng.Intn(254)),
+	}
+	return location, DeviceInfo{DeviceID: fmt.Sprintf("dev_%s_%d", tag, g.episodes), Platform: "web", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)"}
+}
+
+func (g *Generator) normal(a *account, at time.Time) {
+	g.schedule(g.purchase(a, g.amount(a.mean), at), Normal, false)
+}
+
+// bustOut opens an account that spends modestly for a few weeks, then
+// spends many times as much within half an hour
+func (g *Generator) bustOut() {
+	a := g.newAccount(fmt.Sprintf("bo_%d", g.episodes))
+	a.createdAt = g.clock
+	at := g.clock
+	for i := 0; i < 5+g.rng.Intn(6); i++ {
+		at = at.Add(g.between(12*time.Hour, 4*24*time.Hour))
+		g.schedule(g.purchase(&a, g.amount(a.mean), at), BustOut, false)
+	}
+	at = at.Add(g.between(time.Hour, 48*time.Hour))
+	for i := 0; i < 4+g.rng.Intn(5); i++ {
+		at = at.Add(g.between(time.Minute, 8*time.Minute))
+		tx := g.purchase(&a, g.amount(a.mean*(20+30*g.rng.Float64())), at)
+		tx.MerchantID = merchant(g.rng.Intn(g.config.Merchants))
+		g.schedule(tx, BustOut, true)
+	}
+}
+
+// accountTakeover lets an account spend as usual, then has a fraudster
+// abroad spend and transfer out from a new device
+func (g *Generator) accountTakeover() {
+	a := g.pickAccount()
+	at := g.clock
+	g.normal(a, at)
+	at = at.Add(g.between(10*time.Minute, 6*time.Hour))
+
+	location, device := g.fraudster("ato")
+	payee := fmt.Sprintf("payee_ato_%d", g.episodes)
+	added := at
+	for i := 0; i < 2+g.rng.Intn(4); i++ {
+		at = at.Add(g.between(30*time.Second, 10*time.Minute))
+		tx := g.purchase(a, g.amount(a.mean*(8+12*g.rng.Float64())), at)
+		tx.Location = location
+		tx.DeviceInfo = device
+		if i%2 == 1 {
+			tx.TransactionType = "transfer"
+			tx.PaymentMethod = "bank_transfer"
+			tx.MerchantID = ""
+			tx.Destination = payee
+			tx.BeneficiaryAddedAt = added
+		} else {
+			tx.MerchantID = merchant(g.rng.Intn(g.config.Merchants))
+		}
+		g.schedule(tx, AccountTakeover, true)
+	}
+}
+
+// cardTesting authorizes tiny amounts on many stolen cards from one device
+// at one merchant, then buys with a few of them
+func (g *Generator) cardTesting() {
+	location, device := g.fraudster("ct")
+	target := merchant(g.rng.Intn(g.config.Merchants))
+	at := g.clock
+	cards := 10 + g.rng.Intn(21)
+	for i := 0; i < cards; i++ {
+		at = at.Add(g.between(3*time.Second, 30*time.Second))
+		g.schedule(g.stolenCard(i, target, 0.5+float64(g.rng.Intn(250))/100, at, location, device), CardTesting, true)
+	}
+	for i := 0; i < 1+g.rng.Intn(3); i++ {
+		at = at.Add(g.between(time.Minute, 20*time.Minute))
+		g.schedule(g.stolenCard(g.rng.Intn(cards), merchant(g.rng.Intn(g.config.Merchants)), g.amount(400), at, location, device), CardTesting, true)
+	}
+}
+
+func (g *Generator) stolenCard(card int, merchantID string, amount float64, at time.Time, location Location, device DeviceInfo) Transaction {
+	holder := fmt.Sprintf("ct_%d_%d", g.episodes, card)
+	return Transaction{
+		Amount:        amount,
+		Currency:      "USD",
+		MerchantID:    merchantID,
+		CustomerID:    holder,
+		PaymentMethod: "card",
+		Location:      location,
+		DeviceInfo:    device,
+		Timestamp:     at,
+		InstrumentID:  "card_" + holder,
+	}
+}
+
+// muleFlow has several accounts transfer into a new mule account, which
+// sends most of the money on to a payee within the hour
+func (g *Generator) muleFlow() {
+	mule := g.newAccount(fmt.Sprintf("mule_%d", g.episodes))
+	mule.createdAt = g.clock.Add(-g.between(24*time.Hour, 14*24*time.Hour))
+	at := g.clock
+	total := 0.0
+	for i := 0; i < 3+g.rng.Intn(4); i++ {
+		at = at.Add(g.between(5*time.Minute, 45*time.Minute))
+		tx := g.purchase(g.pickAccount(), g.amount(600), at)
+		tx.TransactionType = "transfer"
+		tx.PaymentMethod = "bank_transfer"
+		tx.MerchantID = ""
+		tx.Destination = mule.id
+		tx.BeneficiaryAddedAt = at.Add(-g.between(time.Minute, time.Hour))
+		total += tx.Amount
+		g.schedule(tx, MuleFlow, true)
+	}
+
+	payee := fmt.Sprintf("payee_mule_%d", g.episodes)
+	remaining := total * (0.85 + 0.1*g.rng.Float64())
+	for remaining > 1 {
+		at = at.Add(g.between(2*time.Minute, 20*time.Minute))
+		amount := remaining
+		if amount > 900 {
+			amount = 500 + float64(g.rng.Intn(400))
+		}
+		amount = float64(int(amount*100)) / 100
+		tx := g.purchase(&mule, amount, at)
+		tx.TransactionType = "transfer"
+		tx.PaymentMethod = "bank_transfer"
+		tx.MerchantID = ""
+		tx.Destination = payee
+		tx.BeneficiaryAddedAt = at.Add(-g.between(time.Minute, 10*time.Minute))
+		remaining -= amount
+		g.schedule(tx, MuleFlow, true)
+	}
+}
@@ -0,0 +1,279 @@
+// Package synthetic generates labeled transaction streams for tests, demos,
+// load generation and training models before real labels exist.
+//
+// A stream interleaves the everyday spending of a population of accounts
+// with fraud scenarios: bust-outs, account takeovers, card testing and mule
+// flows. Each scenario is an episode of several transactions spread over
+// time, such as the weeks of good behavior before a bust-out, so the
+// transactions of a stream come out in time order with the episodes
+// overlapping. Transactions are shaped like the /fraud/analyze request body
+// and every one is labeled with its scenario and whether it is fraud.
+//
+// Streams are deterministic: the same Config always generates the same
+// transactions.
+package synthetic
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Scenario is the behavior a transaction was generated by
+type Scenario string
+
+// Scenarios
+const (
+	// Normal is the everyday spending of an account at its usual merchants,
+	// from its home and device
+	Normal Scenario = "normal"
+	// BustOut builds a good history on a new account, then maxes it out in
+	// a burst of large purchases
+	BustOut Scenario = "bust_out"
+	// AccountTakeover follows an account's normal activity with large
+	// purchases and transfers to a new payee from a new device abroad
+	AccountTakeover Scenario = "account_takeover"
+	// CardTesting runs many tiny authorizations of different cards from one
+	// device at one merchant, then spends with the cards that passed
+	CardTesting Scenario = "card_testing"
+	// MuleFlow moves money from several accounts into a mule account, which
+	// passes most of it on within the hour
+	MuleFlow Scenario = "mule_flow"
+)
+
+// FraudScenarios are the fraud scenarios a stream mixes in by default
+var FraudScenarios = []Scenario{BustOut, AccountTakeover, CardTesting, MuleFlow}
+
+// Transaction mirrors the /fraud/analyze request body
+type Transaction struct {
+	ID                 string     `json:"id"`
+	Amount             float64    `json:"amount"`
+	Currency           string     `json:"currency"`
+	MerchantID         string     `json:"merchant_id"`
+	CustomerID         string     `json:"customer_id"`
+	PaymentMethod      string     `json:"payment_method"`
+	Location           Location   `json:"location"`
+	DeviceInfo         DeviceInfo `json:"device_info"`
+	Timestamp          time.Time  `json:"timestamp"`
+	TransactionType    string     `json:"transaction_type,omitempty"`
+	AccountCreatedAt   time.Time  `json:"account_created_at,omitempty"`
+	Destination        string     `json:"destination,omitempty"`
+	InstrumentID       string     `json:"instrument_id,omitempty"`
+	BeneficiaryAddedAt time.Time  `json:"beneficiary_added_at,omitempty"`
+}
+
+type Location struct {
+	Country   string  `json:"country"`
+	City      string  `json:"city"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	IPAddress string  `json:"ip_address"`
+}
+
+type DeviceInfo struct {
+	DeviceID  string `json:"device_id"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Platform  string `json:"platform"`
+}
+
+// Record is a generated transaction with its labels
+type Record struct {
+	Transaction Transaction `json:"transaction"`
+	Scenario    Scenario    `json:"scenario"`
+	Fraud       bool        `json:"fraud"`
+}
+
+// Config shapes a stream
+type Config struct {
+	Seed int64
+	// Accounts and Merchants are the number of everyday accounts and
+	// merchants
+	Accounts  int
+	Merchants int
+	// Start is the time of the first transaction
+	Start time.Time
+	// DailyTransactions is the average number of everyday transactions of
+	// an account per day, which sets the pace of the stream's time
+	DailyTransactions float64
+	// FraudRate is the share of fraud transactions, spread evenly over
+	// Scenarios
+	FraudRate float64
+	Scenarios []Scenario
+	// IDPrefix prefixes the transaction IDs
+	IDPrefix string
+}
+
+// DefaultConfig returns a stream of 1000 accounts spending twice a day at
+// 100 merchants from 1 January 2024, with 2% fraud transactions of every
+// scenario
+func DefaultConfig() Config {
+	return Config{
+		Seed:              1,
+		Accounts:          1000,
+		Merchants:         100,
+		Start:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		DailyTransactions: 2,
+		FraudRate:         0.02,
+		Scenarios:         FraudScenarios,
+		IDPrefix:          "syn",
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.Accounts <= 0 {
+		c.Accounts = defaults.Accounts
+	}
+	if c.Merchants <= 0 {
+		c.Merchants = defaults.Merchants
+	}
+	if c.Start.IsZero() {
+		c.Start = defaults.Start
+	}
+	if c.DailyTransactions <= 0 {
+		c.DailyTransactions = defaults.DailyTransactions
+	}
+	if c.FraudRate < 0 {
+		c.FraudRate = 0
+	}
+	var scenarios []Scenario
+	for _, s := range c.Scenarios {
+		if _, known := episodeSizes[s]; known {
+			scenarios = append(scenarios, s)
+		}
+	}
+	if len(scenarios) == 0 {
+		scenarios = defaults.Scenarios
+	}
+	c.Scenarios = scenarios
+	if c.IDPrefix == "" {
+		c.IDPrefix = defaults.IDPrefix
+	}
+	return c
+}
+
+// Generator produces a stream of labeled transactions. It is not safe for
+// concurrent use.
+type Generator struct {
+	config   Config
+	rng      *rand.Rand
+	accounts []account
+	clock    time.Time
+	pending  queue
+	seq      int
+	episodes int
+	// gap is the average time between episodes
+	gap time.Duration
+	// weight is the fraud transactions a scenario makes per episode
+	weight float64
+}
+
+// New creates the generator of a stream
+func New(config Config) *Generator {
+	config = config.withDefaults()
+	g := &Generator{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		clock:  config.Start,
+		gap:    time.Duration(float64(24*time.Hour) / (float64(config.Accounts) * config.DailyTransactions)),
+	}
+	// Fraud episodes also make legitimate transactions, so a scenario's
+	// weight w solves FraudRate = n*w / (1 + w*sum((total-1)/fraud))
+	var extra float64
+	for _, s := range config.Scenarios {
+		size := episodeSizes[s]
+		extra += (size.total - 1) / size.fraud
+	}
+	if denominator := float64(len(config.Scenarios)) - config.FraudRate*extra; denominator > 0 {
+		g.weight = config.FraudRate / denominator
+	}
+
+	g.accounts = make([]account, config.Accounts)
+	for i := range g.accounts {
+		g.accounts[i] = g.newAccount(fmt.Sprintf("acc_%d", i))
+	}
+	return g
+}
+
+// Next returns the next transaction of the stream
+func (g *Generator) Next() Record {
+	for len(g.pending) == 0 || g.pending[0].Transaction.Timestamp.After(g.clock) {
+		g.startEpisode()
+		g.clock = g.clock.Add(time.Duration(g.rng.ExpFloat64() * float64(g.gap)))
+	}
+	record := heap.Pop(&g.pending).(Record)
+	g.seq++
+	record.Transaction.ID = fmt.Sprintf("%s_%d", g.config.IDPrefix, g.seq)
+	return record
+}
+
+// Dataset returns the next n transactions of the stream
+func (g *Generator) Dataset(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = g.Next()
+	}
+	return records
+}
+
+// startEpisode schedules the transactions of an episode starting now. Each
+// scenario starts in inverse proportion to the fraud transactions it makes,
+// so that they contribute evenly to the fraud rate.
+func (g *Generator) startEpisode() {
+	g.episodes++
+	scenario := Normal
+	draw := g.rng.Float64()
+	for _, s := range g.config.Scenarios {
+		draw -= g.weight / episodeSizes[s].fraud
+		if draw < 0 {
+			scenario = s
+			break
+		}
+	}
+
+	switch scenario {
+	case BustOut:
+		g.bustOut()
+	case AccountTakeover:
+		g.accountTakeover()
+	case CardTesting:
+		g.cardTesting()
+	case MuleFlow:
+		g.muleFlow()
+	default:
+		g.normal(g.pickAccount(), g.clock)
+	}
+}
+
+func (g *Generator) schedule(tx Transaction, scenario Scenario, fraud bool) {
+	heap.Push(&g.pending, Record{Transaction: tx, Scenario: scenario, Fraud: fraud})
+}
+
+// between returns a random duration within [min, max)
+func (g *Generator) between(min, max time.Duration) time.Duration {
+	return min + time.Duration(g.rng.Int63n(int64(max-min)))
+}
+
+// amount returns a random amount around mean, log-normally spread
+func (g *Generator) amount(mean float64) float64 {
+	amount := mean * math.Exp(0.6*g.rng.NormFloat64()-0.18)
+	return math.Max(1, math.Round(amount*100)/100)
+}
+
+// queue orders the scheduled transactions by time
+type queue []Record
+
+func (q queue) Len() int { return len(q) }
+func (q queue) Less(i, j int) bool {
+	return q[i].Transaction.Timestamp.Before(q[j].Transaction.Timestamp)
+}
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(Record)) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	record := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return record
+}
@@ -0,0 +1,106 @@
+package synthetic_test
+
+import (
+	"testing"
+
+	"github.com/josuebarros1995/golang-fraud-detection/pkg/synthetic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator_IsDeterministic(t *testing.T) {
+	config := synthetic.DefaultConfig()
+	config.Accounts = 50
+	first := synthetic.New(config).Dataset(500)
+	second := synthetic.New(config).Dataset(500)
+	assert.Equal(t, first, second)
+
+	config.Seed = 2
+	assert.NotEqual(t, first, synthetic.New(config).Dataset(500))
+}
+
+func TestGenerator_StreamsInTimeOrder(t *testing.T) {
+	records := synthetic.New(synthetic.DefaultConfig()).Dataset(5000)
+	ids := make(map[string]bool)
+	for i, record := range records {
+		assert.False(t, ids[record.Transaction.ID], "duplicate ID %s", record.Transaction.ID)
+		ids[record.Transaction.ID] = true
+		if i > 0 {
+			assert.False(t, record.Transaction.Timestamp.Before(records[i-1].Transaction.Timestamp))
+		}
+	}
+	assert.False(t, records[0].Transaction.Timestamp.Before(synthetic.DefaultConfig().Start))
+}
+
+func TestGenerator_LabelsScenarios(t *testing.T) {
+	config := synthetic.DefaultConfig()
+	config.Accounts = 200
+	config.FraudRate = 0.2
+	records := synthetic.New(config).Dataset(50000)
+
+	fraud := make(map[synthetic.Scenario]int)
+	total := 0
+	for _, record := range records {
+		tx := record.Transaction
+		if record.Fraud {
+			fraud[record.Scenario]++
+			total++
+		}
+		switch record.Scenario {
+		case synthetic.Normal:
+			assert.False(t, record.Fraud)
+			assert.Equal(t, "dev_"+tx.CustomerID, tx.DeviceInfo.DeviceID)
+		case synthetic.AccountTakeover:
+			if record.Fraud {
+				assert.NotEqual(t, "dev_"+tx.CustomerID, tx.DeviceInfo.DeviceID)
+			}
+		case synthetic.CardTesting:
+			assert.True(t, record.Fraud)
+			assert.NotEqual(t, "dev_"+tx.CustomerID, tx.DeviceInfo.DeviceID)
+		case synthetic.MuleFlow:
+			assert.Equal(t, "transfer", tx.TransactionType)
+			assert.NotEmpty(t, tx.Destination)
+		}
+	}
+	for _, scenario := range synthetic.FraudScenarios {
+		assert.NotZero(t, fraud[scenario], "no %s fraud", scenario)
+	}
+	assert.InDelta(t, config.FraudRate, float64(total)/float64(len(records)), 0.05)
+}
+
+func TestGenerator_CardTestingUsesTinyAmounts(t *testing.T) {
+	config := synthetic.DefaultConfig()
+	config.FraudRate = 0.5
+	config.Scenarios = []synthetic.Scenario{synthetic.CardTesting}
+	records := synthetic.New(config).Dataset(2000)
+
+	devices := make(map[string]map[string]bool)
+	tiny := 0
+	for _, record := range records {
+		if record.Scenario != synthetic.CardTesting {
+			continue
+		}
+		tx := record.Transaction
+		if devices[tx.DeviceInfo.DeviceID] == nil {
+			devices[tx.DeviceInfo.DeviceID] = make(map[string]bool)
+		}
+		devices[tx.DeviceInfo.DeviceID][tx.InstrumentID] = true
+		if tx.Amount < 3 {
+			tiny++
+		}
+	}
+	require.NotEmpty(t, devices)
+	for device, cards := range devices {
+		assert.GreaterOrEqual(t, len(cards), 2, "device %s tested one card", device)
+	}
+	assert.NotZero(t, tiny)
+}
+
+func TestGenerator_NoFraud(t *testing.T) {
+	config := synthetic.DefaultConfig()
+	config.FraudRate = 0
+	for _, record := range synthetic.New(config).Dataset(1000) {
+		assert.Equal(t, synthetic.Normal, record.Scenario)
+		assert.False(t, record.Fraud)
+	}
+}